@@ -0,0 +1,107 @@
+// Command audit-verify verifies an exported audit stream and its checkpoints
+// offline, without access to the platform.
+//
+// Usage:
+//
+//	audit-verify -entries audit.jsonl [-checkpoints checkpoints.jsonl]
+//	             [-tsa-anchors tsa.pem] [-agency-anchors agencies.pem] [-json]
+//
+// It exits 0 when everything verifies, 1 when verification fails and 2 when
+// the input cannot be read.
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/serbia-gov/platform/internal/audit"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("audit-verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	entriesPath := fs.String("entries", "", "exported audit entries (JSON Lines, from GET /api/v1/audit/export)")
+	checkpointsPath := fs.String("checkpoints", "", "exported checkpoints (JSON Lines, from GET /api/v1/audit/checkpoints/export)")
+	tsaAnchors := fs.String("tsa-anchors", "", "PEM trust anchors for RFC 3161 timestamp tokens")
+	agencyAnchors := fs.String("agency-anchors", "", "PEM trust anchors for multi-agency witness signatures")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *entriesPath == "" {
+		fmt.Fprintln(stderr, "audit-verify: -entries is required")
+		fs.Usage()
+		return 2
+	}
+
+	var anchors audit.OfflineAnchors
+	var err error
+	if anchors.TSA, err = loadAnchors(*tsaAnchors); err != nil {
+		fmt.Fprintf(stderr, "audit-verify: TSA anchors: %v\n", err)
+		return 2
+	}
+	if anchors.Agencies, err = loadAnchors(*agencyAnchors); err != nil {
+		fmt.Fprintf(stderr, "audit-verify: agency anchors: %v\n", err)
+		return 2
+	}
+
+	entries, err := os.Open(*entriesPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "audit-verify: %v\n", err)
+		return 2
+	}
+	defer entries.Close()
+
+	var checkpoints io.Reader
+	if *checkpointsPath != "" {
+		f, err := os.Open(*checkpointsPath)
+		if err != nil {
+			fmt.Fprintf(stderr, "audit-verify: %v\n", err)
+			return 2
+		}
+		defer f.Close()
+		checkpoints = f
+	}
+
+	report, err := audit.VerifyExport(entries, checkpoints, anchors)
+	if err != nil {
+		fmt.Fprintf(stderr, "audit-verify: %v\n", err)
+		return 2
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(struct {
+			*audit.OfflineReport
+			Valid bool `json:"valid"`
+		}{report, report.Valid()})
+	} else {
+		fmt.Fprint(stdout, report.String())
+	}
+
+	if !report.Valid() {
+		return 1
+	}
+	return 0
+}
+
+// loadAnchors reads a PEM file of trust anchors; no path means no anchors
+func loadAnchors(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return audit.LoadCertPool(data)
+}
@@ -1,31 +1,37 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/ed25519"
-	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/serbia-gov/platform/internal/adapters/health/heliant"
 	"github.com/serbia-gov/platform/internal/agency"
 	"github.com/serbia-gov/platform/internal/ai"
 	"github.com/serbia-gov/platform/internal/audit"
+	roles "github.com/serbia-gov/platform/internal/auth"
 	caseapi "github.com/serbia-gov/platform/internal/case/api"
 	caseinfra "github.com/serbia-gov/platform/internal/case/infrastructure"
 	"github.com/serbia-gov/platform/internal/coordination"
+	"github.com/serbia-gov/platform/internal/doctemplate"
 	"github.com/serbia-gov/platform/internal/document"
 	"github.com/serbia-gov/platform/internal/federation/gateway"
 	"github.com/serbia-gov/platform/internal/federation/trust"
 	"github.com/serbia-gov/platform/internal/notification"
 	"github.com/serbia-gov/platform/internal/privacy"
+	"github.com/serbia-gov/platform/internal/retention"
 	"github.com/serbia-gov/platform/internal/shared/auth"
 	"github.com/serbia-gov/platform/internal/shared/config"
 	"github.com/serbia-gov/platform/internal/shared/database"
@@ -35,6 +41,7 @@ import (
 	"github.com/serbia-gov/platform/internal/shared/policy"
 	"github.com/serbia-gov/platform/internal/shared/types"
 	"github.com/serbia-gov/platform/internal/simulation"
+	"github.com/serbia-gov/platform/internal/tsa"
 )
 
 // App holds all application dependencies
@@ -51,6 +58,8 @@ type App struct {
 	CoordinationSvc   *coordination.Service
 	TrustAuthority    *trust.Authority
 	FederationGateway *gateway.Gateway
+	PostgresAudit     *audit.Repository                  // Shared so that all writers extend the same chain
+	HealthAdapter     *privacy.PrivacyAwareHealthAdapter // nil when no hospital system is configured
 }
 
 func main() {
@@ -117,16 +126,16 @@ func main() {
 	if cfg.Privacy.EnablePrivacyGuard && cfg.Privacy.FacilityType == "central" {
 		// Create a simple violation logger using audit
 		var violationHandler privacy.ViolationHandler
-		if app.EventBus != nil {
-			var auditRepo audit.AuditRepository
-			if app.EventBusType == "http" && app.HTTPBus != nil {
-				auditRepo = audit.NewHTTPRepository(app.HTTPBus.HTTPClient())
-			} else if app.Bus != nil {
-				auditRepo = audit.NewKurrentDBRepository(app.Bus.Client())
-			}
-			if auditRepo != nil {
-				violationHandler = &auditViolationHandler{auditRepo: auditRepo}
-			}
+		var auditRepo audit.AuditRepository
+		if usePostgresAudit(app) {
+			auditRepo = postgresAuditRepository(ctx, app)
+		} else if app.EventBusType == "http" && app.HTTPBus != nil {
+			auditRepo = audit.NewHTTPRepository(app.HTTPBus.HTTPClient())
+		} else if app.Bus != nil {
+			auditRepo = audit.NewKurrentDBRepository(app.Bus.Client())
+		}
+		if auditRepo != nil {
+			violationHandler = &auditViolationHandler{auditRepo: auditRepo}
 		}
 
 		guardConfig := privacy.PrivacyGuardConfig{
@@ -164,12 +173,84 @@ func main() {
 	// API info
 	r.Get("/", infoHandler)
 
+	// Federation Trust Authority. Its CRL and OCSP responder are public, since
+	// remote gateways check agency certificates against them.
+	var trustAuthority *trust.Authority
+	if app.DB != nil {
+		authority, err := newTrustAuthority(ctx, cfg, app)
+		if err != nil {
+			fmt.Printf("Warning: Trust Authority initialization failed: %v\n", err)
+		} else {
+			trustAuthority = authority
+			app.TrustAuthority = trustAuthority
+			pkiLimiter := secmiddleware.NewIPRateLimiter(10, 50)
+			r.With(pkiLimiter.Middleware).Mount("/federation/pki", trust.NewHandler(trustAuthority).RevocationRoutes())
+		}
+	}
+
+	// Public document authenticity check (unauthenticated, rate limited per IP)
+	if app.DB != nil {
+		verifyHandler := document.NewPublicVerifyHandler(
+			document.NewRepository(app.DB.Pool),
+			agency.NewRepository(app.DB.Pool),
+		)
+		if store, err := document.NewFileStore(cfg.Storage.DocumentPath); err != nil {
+			fmt.Printf("Warning: Document storage not available for verification: %v\n", err)
+		} else {
+			verifyHandler.SetContentStore(store)
+		}
+		if trustAuthority != nil {
+			verifyHandler.SetCertificateVerifier(trustAuthority)
+			verifyHandler.SetCertificateChecker(trustAuthority.RevocationChecker())
+		}
+		verifyLimiter := secmiddleware.NewIPRateLimiter(5, 20)
+		r.With(verifyLimiter.Middleware).Mount("/verify", verifyHandler.Routes())
+	}
+
+	// RFC 3161 Time Stamping Authority (unauthenticated protocol, rate limited per IP).
+	// The same TSA witnesses audit checkpoints and signs access reports.
+	var tsaServer *tsa.Server
+	var tsaArchiver *tsa.Archiver
+	if cfg.TSA.Enabled {
+		server, err := audit.NewTSAServerFromConfig(cfg.TSA)
+		if err != nil {
+			fmt.Printf("Warning: TSA initialization failed: %v\n", err)
+		} else {
+			tsaServer = server
+			if app.DB != nil {
+				tokenStore := tsa.NewPostgresTokenStore(app.DB.Pool)
+				tsaServer.SetStore(tokenStore)
+
+				// Archive timestamps keep tokens, checkpoints and signatures
+				// verifiable after the TSA certificate expires
+				if cfg.TSA.ArchiveEnabled {
+					archiver, err := audit.NewArchiverFromConfig(cfg.TSA, tsaServer)
+					if err != nil {
+						fmt.Printf("Warning: TSA archive timestamps disabled: %v\n", err)
+					} else {
+						tsaArchiver = archiver
+						tsaArchiver.SetStore(tsa.NewPostgresArchiveStore(app.DB.Pool))
+						tsaArchiver.AddSource("tsa_token", tokenStore)
+					}
+				}
+			}
+			tsaLimiter := secmiddleware.NewIPRateLimiter(10, 50)
+			r.With(tsaLimiter.Middleware).Mount("/tsa", tsa.NewProtocolHandler(tsaServer).Routes())
+			fmt.Printf("TSA enabled (issuer: %s)\n", tsaServer.GetCertificate().Subject.CommonName)
+		}
+	}
+
 	// API routes
 	r.Route("/api/v1", func(r chi.Router) {
 		// Public routes (no auth required for now in dev mode)
 		if cfg.Server.Env == "production" {
 			r.Use(auth.Middleware(cfg.Auth))
 		}
+		r.Use(audit.AccessPurposeMiddleware)
+
+		// Refused requests are recorded once the audit log is up
+		deniedAccess := audit.NewDeniedAccessLogger()
+		r.Use(deniedAccess.Middleware)
 
 		// Agency module
 		if app.DB != nil {
@@ -185,87 +266,293 @@ func main() {
 			// Document module
 			documentRepo := document.NewRepository(app.DB.Pool)
 			documentHandler := document.NewHandler(documentRepo, app.EventBus)
+			documentHandler.SetPublicURL(cfg.Server.PublicURL)
+			documentHandler.SetPIIScanner(privacy.NewPrivacyGuard(nil, privacy.DefaultPrivacyGuardConfig()))
+			if trustAuthority != nil {
+				documentHandler.SetCertificateVerifier(trustAuthority)
+			}
 			r.Mount("/documents", documentHandler.Routes())
+			if tsaArchiver != nil {
+				tsaArchiver.AddSource("document_signature", documentRepo)
+			}
 
-			// Audit module - uses EventStoreDB (append-only event store)
-			if app.EventBus != nil {
-				var auditRepo audit.AuditRepository
-
-				if app.EventBusType == "http" && app.HTTPBus != nil {
-					// Use HTTP repository
-					httpRepo := audit.NewHTTPRepository(app.HTTPBus.HTTPClient())
-					if err := httpRepo.Initialize(ctx); err != nil {
-						fmt.Printf("Warning: Audit initialization failed: %v\n", err)
-					}
-					auditRepo = httpRepo
-					fmt.Println("Audit module initialized (HTTP mode)")
-
-					// Start audit subscriber for HTTP mode
-					auditSubscriber := audit.NewSubscriber(httpRepo, app.EventBus)
-					if err := auditSubscriber.Start(ctx); err != nil {
-						fmt.Printf("Warning: Audit subscriber failed to start: %v\n", err)
-					} else {
-						fmt.Println("Audit subscriber started (HTTP mode)")
-					}
-				} else if app.Bus != nil {
-					// Use gRPC repository
-					grpcRepo := audit.NewKurrentDBRepository(app.Bus.Client())
-					if err := grpcRepo.Initialize(ctx); err != nil {
-						fmt.Printf("Warning: Audit initialization failed: %v\n", err)
-					}
-					auditRepo = grpcRepo
+			// Document templates and generation
+			var contentStore document.ContentStore
+			documentStore, err := document.NewFileStore(cfg.Storage.DocumentPath)
+			if err != nil {
+				fmt.Printf("Warning: Document storage not available: %v\n", err)
+			} else {
+				contentStore = documentStore
+				documentHandler.SetContentStore(documentStore)
+
+				templateRepo := doctemplate.NewRepository(app.DB.Pool)
+				templateGenerator := doctemplate.NewGenerator(
+					templateRepo, documentRepo, caseRepo, agencyRepo,
+					documentStore, app.EventBus, cfg.Server.PublicURL,
+				)
+				templateHandler := doctemplate.NewHandler(templateRepo, templateGenerator, app.EventBus)
+				r.Mount("/templates", templateHandler.Routes())
+			}
 
-					// Start audit subscriber for gRPC mode
-					auditSubscriber := audit.NewSubscriber(grpcRepo, app.EventBus)
-					if err := auditSubscriber.Start(ctx); err != nil {
-						fmt.Printf("Warning: Audit subscriber failed to start: %v\n", err)
-					} else {
-						fmt.Println("Audit subscriber started (gRPC mode)")
-					}
-				}
+			// Retention schedules and disposition
+			retentionRepo := retention.NewRepository(app.DB.Pool)
+			retentionSvc, err := retention.NewService(retentionRepo, retention.DefaultSchedule(), contentStore, app.EventBus)
+			if err != nil {
+				fmt.Printf("Warning: Retention initialization failed: %v\n", err)
+			} else {
+				retentionHandler := retention.NewHandler(retentionSvc, retentionRepo)
+				r.Mount("/retention", retentionHandler.Routes())
 
-				if auditRepo != nil {
-					auditHandler := audit.NewHandler(auditRepo)
-					r.Mount("/audit", auditHandler.Routes())
+				if cfg.Retention.DispositionEnabled {
+					interval := time.Duration(cfg.Retention.DispositionIntervalHours) * time.Hour
+					go retentionSvc.Start(ctx, retention.Mode(cfg.Retention.DispositionMode), interval)
+					fmt.Printf("Retention disposition scheduled (mode: %s, every %s)\n", cfg.Retention.DispositionMode, interval)
 				}
 			}
 
 			// Federation - Trust Authority
-			trustAuthority, err := trust.NewAuthority(nil) // nil repo for in-memory MVP
-			if err != nil {
-				fmt.Printf("Warning: Trust Authority initialization failed: %v\n", err)
-			} else {
-				app.TrustAuthority = trustAuthority
+			if trustAuthority != nil {
+				trustAuthority.SetEnrollmentTTL(time.Duration(cfg.Federation.EnrollmentTTLHours) * time.Hour)
+				trustAuthority.SetKeyOverlap(time.Duration(cfg.Federation.KeyOverlapHours) * time.Hour)
+				trustAuthority.SetRenewBefore(time.Duration(cfg.Federation.RenewBeforeDays) * 24 * time.Hour)
+				trustAuthority.SetExpiryHandler(func(ctx context.Context, expiry trust.CertificateExpiry) {
+					warnCertificateExpiry(ctx, app, expiry)
+				})
+				go trustAuthority.StartExpiryMonitor(ctx, 24*time.Hour)
+
+				// This agency enrolls with its own gateway key, kept on disk
+				localAgency, gatewayKey, err := enrollLocalAgency(ctx, cfg, trustAuthority)
+				if err != nil {
+					fmt.Printf("Warning: Local agency enrollment failed: %v\n", err)
+				}
 
 				// Seed Kikinda pilot agencies
-				seedKikindaPilot(trustAuthority)
+				seedKikindaPilot(trustAuthority, cfg.Federation.EnrollmentTokenDir)
 
 				trustHandler := trust.NewHandler(trustAuthority)
 				r.Mount("/federation/trust", trustHandler.Routes())
 				fmt.Println("Federation Trust Authority initialized")
 
 				// Federation Gateway - for cross-agency communication
-				_, privateKey, err := ed25519.GenerateKey(rand.Reader)
-				if err != nil {
-					fmt.Printf("Warning: Failed to generate gateway key: %v\n", err)
-				} else {
+				if localAgency != nil {
 					gatewayConfig := gateway.Config{
-						AgencyID:   types.NewID(),
-						AgencyCode: cfg.Privacy.FacilityCode,
-						PrivateKey: privateKey,
+						AgencyID:   localAgency.ID,
+						AgencyCode: localAgency.Code,
+						PrivateKey: gatewayKey,
 					}
 					federationGateway, err := gateway.NewGateway(gatewayConfig, trustAuthority)
 					if err != nil {
 						fmt.Printf("Warning: Federation Gateway initialization failed: %v\n", err)
 					} else {
 						app.FederationGateway = federationGateway
-						gatewayHandler := gateway.NewHandler(federationGateway, app.EventBus, r)
+						federationGateway.SetClockSkew(time.Duration(cfg.Federation.ClockSkewSeconds) * time.Second)
+						federationGateway.SetMaxBodySize(int64(cfg.Federation.MaxBodyBytes))
+						federationGateway.SetForwardedHeaders(cfg.Federation.ForwardedHeaders)
+						if cfg.Federation.NonceBackend == "postgres" {
+							federationGateway.SetNonceStore(gateway.NewPostgresNonceStore(app.DB.Pool))
+						} else {
+							federationGateway.SetNonceStore(gateway.NewMemoryNonceStore(cfg.Federation.NonceCapacity))
+						}
+						go federationGateway.StartNonceCleanup(ctx, time.Minute)
+						gatewayHandler := gateway.NewHandler(federationGateway, app.EventBus)
+						registerFederatedRoutes(cfg, gatewayHandler, caseHandler)
+
+						// Cross-agency document exchange
+						documentExchanger := document.NewExchanger(documentRepo, federationGateway, gatewayConfig.AgencyID, app.EventBus)
+						if contentStore != nil {
+							documentExchanger.SetContentStore(contentStore)
+						}
+						documentExchanger.SetCertificateVerifier(trustAuthority)
+						documentHandler.SetExchanger(documentExchanger)
+						gatewayHandler.HandleService(document.ExchangeServicePath, documentExchanger.Receive)
+
+						// Witness for other agencies' audit checkpoints
+						if cfg.TSA.Enabled {
+							registerWitnessService(app, cfg, federationGateway, gatewayHandler)
+						}
+
 						r.Mount("/federation/gateway", gatewayHandler.Routes())
 						fmt.Println("Federation Gateway initialized")
 					}
 				}
 			}
 
+			// Audit module - uses EventStoreDB (append-only event store), or
+			// PostgreSQL when selected or when no event store is available
+			var auditRepo audit.AuditRepository
+
+			if usePostgresAudit(app) {
+				pgRepo := postgresAuditRepository(ctx, app)
+				auditRepo = pgRepo
+				fmt.Println("Audit module initialized (PostgreSQL mode)")
+
+				if app.EventBus != nil {
+					auditSubscriber := audit.NewSubscriber(pgRepo, app.EventBus)
+					if err := auditSubscriber.Start(ctx); err != nil {
+						fmt.Printf("Warning: Audit subscriber failed to start: %v\n", err)
+					} else {
+						fmt.Println("Audit subscriber started (PostgreSQL mode)")
+					}
+				}
+			} else if app.EventBusType == "http" && app.HTTPBus != nil {
+				// Use HTTP repository
+				httpRepo := audit.NewHTTPRepository(app.HTTPBus.HTTPClient())
+				if err := httpRepo.Initialize(ctx); err != nil {
+					fmt.Printf("Warning: Audit initialization failed: %v\n", err)
+				}
+				auditRepo = httpRepo
+				fmt.Println("Audit module initialized (HTTP mode)")
+
+				// Keep the secondary indexes used by audit queries current
+				go httpRepo.StartIndexer(ctx, time.Minute)
+
+				// Start audit subscriber for HTTP mode
+				auditSubscriber := audit.NewSubscriber(httpRepo, app.EventBus)
+				if err := auditSubscriber.Start(ctx); err != nil {
+					fmt.Printf("Warning: Audit subscriber failed to start: %v\n", err)
+				} else {
+					fmt.Println("Audit subscriber started (HTTP mode)")
+				}
+			} else if app.Bus != nil {
+				// Use gRPC repository
+				grpcRepo := audit.NewKurrentDBRepository(app.Bus.Client())
+				if err := grpcRepo.Initialize(ctx); err != nil {
+					fmt.Printf("Warning: Audit initialization failed: %v\n", err)
+				}
+				auditRepo = grpcRepo
+
+				// Start audit subscriber for gRPC mode
+				auditSubscriber := audit.NewSubscriber(grpcRepo, app.EventBus)
+				if err := auditSubscriber.Start(ctx); err != nil {
+					fmt.Printf("Warning: Audit subscriber failed to start: %v\n", err)
+				} else {
+					fmt.Println("Audit subscriber started (gRPC mode)")
+				}
+			}
+
+			if auditRepo != nil {
+				// Checkpoint witness selected by TSA configuration
+				witness, err := audit.NewWitnessFromConfig(cfg.TSA, audit.WitnessDeps{
+					TSA:     tsaServer,
+					Gateway: app.FederationGateway,
+					Proofs:  tsa.NewPostgresProofStore(app.DB.Pool),
+				})
+				if err != nil {
+					fmt.Printf("Warning: Audit witness initialization failed, using local witness: %v\n", err)
+					witness = audit.NewLocalWitness()
+				}
+				retryDelay := time.Duration(cfg.Audit.WitnessRetryDelaySeconds) * time.Second
+				witness = audit.NewRetryWitness(witness, cfg.Audit.WitnessRetries, retryDelay)
+				checkpointService := audit.NewCheckpointService(auditRepo, witness)
+				fmt.Printf("Audit checkpoint witness: %s\n", witness.Type())
+				if tsaArchiver != nil {
+					tsaArchiver.AddSource("audit_checkpoint", checkpointService)
+				}
+
+				if cfg.Audit.CheckpointEnabled {
+					checkpointer := audit.NewCheckpointer(checkpointService, audit.CheckpointerConfig{
+						Interval:     time.Duration(cfg.Audit.CheckpointIntervalMinutes) * time.Minute,
+						EveryEntries: int64(cfg.Audit.CheckpointEveryEntries),
+					})
+					checkpointer.SetAlertHandler(func(ctx context.Context, alert audit.CheckpointAlert) {
+						fmt.Printf("ALERT: audit checkpoint %s: %s\n", alert.Reason, alert.Error)
+						event := events.NewEvent("audit.checkpoint."+alert.Reason, "audit", map[string]any{
+							"alert": alert,
+						}).WithActor(types.ID(""), "system", types.ID(""))
+						if app.EventBus != nil {
+							app.EventBus.Publish(ctx, event)
+						}
+					})
+					go checkpointer.Start(ctx)
+					fmt.Printf("Audit checkpoints scheduled (every %d minutes or %d entries)\n",
+						cfg.Audit.CheckpointIntervalMinutes, cfg.Audit.CheckpointEveryEntries)
+				}
+
+				// Real-time forwarding to the SOC syslog collector
+				if cfg.Audit.SIEMSyslogAddr != "" {
+					sink, err := audit.NewSyslogSinkFromConfig(cfg.Audit)
+					if err != nil {
+						fmt.Printf("Warning: SIEM export disabled: %v\n", err)
+					} else {
+						exporter := audit.NewSIEMExporter(auditRepo, sink, audit.NewExportCursorRepository(app.DB.Pool))
+						go exporter.Start(ctx, 5*time.Second)
+						fmt.Printf("Audit SIEM export to %s (CEF over syslog, TLS: %t)\n", cfg.Audit.SIEMSyslogAddr, cfg.Audit.SIEMSyslogTLS)
+					}
+				}
+
+				auditHandler := audit.NewHandler(auditRepo, checkpointService)
+
+				// Read access to citizens' data, reported to them on request
+				pseudonymizer := privacy.NewPseudonymizationService(
+					[]byte(cfg.Privacy.HMACKey),
+					cfg.Privacy.FacilityCode,
+					privacy.NewPostgresPseudonymRepository(app.DB.Pool),
+					nil,
+				)
+				accessRecorder := audit.NewAccessRecorder(auditRepo, audit.NewPostgresSubjectResolver(app.DB.Pool, pseudonymizer))
+				caseHandler.SetAccessRecorder(accessRecorder)
+				documentHandler.SetAccessRecorder(accessRecorder)
+				deniedAccess.SetRecorder(accessRecorder)
+
+				// Health record lookups at the local hospital, pseudonymized
+				// and recorded for the citizens they concern
+				if cfg.Health.HeliantHost != "" {
+					healthAdapter, err := newHealthAdapter(ctx, cfg, pseudonymizer, accessRecorder)
+					if err != nil {
+						fmt.Printf("Warning: Health adapter not available: %v\n", err)
+					} else {
+						app.HealthAdapter = healthAdapter
+						fmt.Printf("Health adapter connected (%s)\n", healthAdapter.Underlying().SourceInstitution())
+					}
+				}
+
+				accessReports := audit.NewAccessReportService(auditRepo, pseudonymizer)
+				accessReports.SetDirectory(agencyRepo)
+				if tsaServer != nil {
+					accessReports.SetSigner(tsaServer)
+				} else if reportSigner, err := audit.NewTSAServerFromConfig(cfg.TSA); err != nil {
+					fmt.Printf("Warning: Access reports will not be signed: %v\n", err)
+				} else {
+					accessReports.SetSigner(reportSigner)
+				}
+				auditHandler.SetAccessReports(accessReports)
+
+				// Alerts on suspicious behaviour, raised to security auditors
+				if cfg.Audit.AlertsEnabled {
+					rulesConfig := audit.DefaultAlertRulesConfig()
+					rulesConfig.WorkStartHour = cfg.Audit.WorkStartHour
+					rulesConfig.WorkEndHour = cfg.Audit.WorkEndHour
+					if location, err := time.LoadLocation(cfg.Audit.WorkTimezone); err != nil {
+						fmt.Printf("Warning: Unknown audit work timezone %q, using UTC: %v\n", cfg.Audit.WorkTimezone, err)
+					} else {
+						rulesConfig.Location = location
+					}
+
+					alertStore := audit.NewAlertRepository(app.DB.Pool)
+					alertEngine := audit.NewAlertEngine(auditRepo, audit.DefaultAlertRules(rulesConfig)...)
+					alertEngine.SetAlertHandler(func(ctx context.Context, alert *audit.Alert) {
+						raiseAuditAlert(ctx, app, alertStore, alert)
+					})
+					go alertEngine.Start(ctx, 30*time.Second)
+					auditHandler.SetAlerts(alertStore)
+					fmt.Println("Audit alert rules enabled")
+				}
+
+				r.Mount("/audit", auditHandler.Routes())
+			}
+
+			// Log of issued timestamp tokens
+			if tsaServer != nil {
+				tsaHandler := tsa.NewHandler(tsa.NewPostgresTokenStore(app.DB.Pool))
+				if tsaArchiver != nil {
+					tsaHandler.SetArchiver(tsaArchiver, tsaServer)
+					go tsaArchiver.Start(ctx)
+					fmt.Printf("TSA archive timestamps renewed %d days before certificate expiry (%s)\n",
+						cfg.TSA.ArchiveRenewBeforeDays, cfg.TSA.ArchiveHashAlgorithm)
+				}
+				r.Mount("/tsa", tsaHandler.Routes())
+			}
+
 			// Notification Service - with mock providers for MVP
 			pushProvider := notification.NewMockPushProvider()
 			smsProvider := notification.NewMockSMSProvider()
@@ -454,6 +741,48 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// usePostgresAudit reports whether the audit log is stored in PostgreSQL,
+// either because it is configured or because no event store is available
+func usePostgresAudit(app *App) bool {
+	return app.DB != nil && (app.Config.Audit.Backend == "postgres" || app.EventBus == nil)
+}
+
+// postgresAuditRepository returns the shared PostgreSQL audit repository
+func postgresAuditRepository(ctx context.Context, app *App) *audit.Repository {
+	if app.PostgresAudit == nil {
+		app.PostgresAudit = audit.NewRepository(app.DB.Pool)
+		if err := app.PostgresAudit.Initialize(ctx); err != nil {
+			fmt.Printf("Warning: Audit initialization failed: %v\n", err)
+		}
+	}
+	return app.PostgresAudit
+}
+
+// newHealthAdapter connects to the Heliant HIS of the local hospital. Lookups
+// through the returned adapter are pseudonymized and recorded for access reports.
+func newHealthAdapter(ctx context.Context, cfg *config.Config, pseudonymizer *privacy.PseudonymizationService, access privacy.AccessRecorder) (*privacy.PrivacyAwareHealthAdapter, error) {
+	heliantConfig := heliant.DefaultHeliantConfig()
+	heliantConfig.Host = cfg.Health.HeliantHost
+	heliantConfig.Port = cfg.Health.HeliantPort
+	heliantConfig.Database = cfg.Health.HeliantDatabase
+	heliantConfig.User = cfg.Health.HeliantUser
+	heliantConfig.Password = cfg.Health.HeliantPassword
+	heliantConfig.InstitutionCode = cfg.Health.InstitutionCode
+	heliantConfig.InstitutionName = cfg.Health.InstitutionName
+
+	adapter, err := heliant.New(heliantConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := adapter.Start(ctx); err != nil {
+		return nil, err
+	}
+
+	healthAdapter := privacy.NewPrivacyAwareHealthAdapter(adapter, pseudonymizer, nil)
+	healthAdapter.SetAccessRecorder(access)
+	return healthAdapter, nil
+}
+
 // auditViolationHandler wraps audit repository to implement ViolationHandler.
 type auditViolationHandler struct {
 	auditRepo audit.AuditRepository
@@ -490,8 +819,266 @@ func (h *auditViolationHandler) HandleViolation(ctx context.Context, violation *
 	return h.auditRepo.Append(ctx, entry)
 }
 
-// seedKikindaPilot registers Kikinda pilot agencies in the Trust Authority
-func seedKikindaPilot(authority *trust.Authority) {
+// raiseAuditAlert stores an audit alert and notifies security auditors
+func raiseAuditAlert(ctx context.Context, app *App, store audit.AlertStore, alert *audit.Alert) {
+	fmt.Printf("ALERT: audit %s (%s): %s\n", alert.Rule, alert.Severity, alert.Summary)
+	if err := store.Save(ctx, alert); err != nil {
+		fmt.Printf("Warning: Failed to save audit alert: %v\n", err)
+	}
+
+	if app.NotificationSvc != nil {
+		priority := notification.PriorityHigh
+		switch alert.Severity {
+		case audit.AlertSeverityCritical:
+			priority = notification.PriorityCritical
+		case audit.AlertSeverityHigh:
+			priority = notification.PriorityUrgent
+		}
+
+		err := app.NotificationSvc.SendNotification(ctx, &notification.Notification{
+			Type:          notification.NotificationTypeInApp,
+			Priority:      priority,
+			RecipientID:   string(roles.RoleSecurityAuditor),
+			RecipientType: "role",
+			Subject:       "Audit alert: " + alert.Rule,
+			Body:          alert.Summary,
+			Data: map[string]any{
+				"alert_id": alert.ID,
+				"rule":     alert.Rule,
+				"severity": alert.Severity,
+				"actor_id": alert.ActorID,
+			},
+		})
+		if err != nil {
+			fmt.Printf("Warning: Failed to notify security auditors: %v\n", err)
+		}
+	}
+
+	if app.EventBus != nil {
+		event := events.NewEvent("audit.alert.raised", "audit", map[string]any{
+			"alert": alert,
+		}).WithActor(types.ID(""), "system", types.ID(""))
+		app.EventBus.Publish(ctx, event)
+	}
+}
+
+// warnCertificateExpiry tells agency admins that a federation certificate
+// is about to expire and must be renewed
+func warnCertificateExpiry(ctx context.Context, app *App, expiry trust.CertificateExpiry) {
+	summary := fmt.Sprintf("Federation certificate of agency %s (key %s) expires on %s, in %d days",
+		expiry.AgencyCode, expiry.KeyID, expiry.NotAfter.Format("2006-01-02"), expiry.DaysLeft)
+	fmt.Printf("Warning: %s\n", summary)
+
+	if app.NotificationSvc != nil {
+		priority := notification.PriorityHigh
+		if expiry.DaysLeft < 7 {
+			priority = notification.PriorityUrgent
+		}
+
+		err := app.NotificationSvc.SendNotification(ctx, &notification.Notification{
+			Type:          notification.NotificationTypeInApp,
+			Priority:      priority,
+			RecipientID:   string(roles.RoleAgencyAdmin),
+			RecipientType: "role",
+			Subject:       "Federation certificate expiring: " + expiry.AgencyCode,
+			Body:          summary,
+			Data: map[string]any{
+				"agency_id":   expiry.AgencyID,
+				"agency_code": expiry.AgencyCode,
+				"key_id":      expiry.KeyID,
+				"not_after":   expiry.NotAfter,
+			},
+		})
+		if err != nil {
+			fmt.Printf("Warning: Failed to notify agency admins: %v\n", err)
+		}
+	}
+
+	if app.EventBus != nil {
+		event := events.NewEvent("federation.certificate.expiring", "federation", map[string]any{
+			"expiry": expiry,
+		}).WithActor(types.ID(""), "system", types.ID(""))
+		app.EventBus.Publish(ctx, event)
+	}
+}
+
+// registerFederatedRoutes makes the case routes remote agencies may call
+// through the federation gateway available to them, with the permissions
+// granted as CODE:permission. No other local route is forwarded to.
+func registerFederatedRoutes(cfg *config.Config, handler *gateway.Handler, caseHandler *caseapi.Handler) {
+	routes := []struct {
+		method     string
+		pattern    string
+		permission string
+		fn         http.HandlerFunc
+	}{
+		{http.MethodGet, "/cases/{caseID}", caseapi.PermissionFederatedRead, caseHandler.GetCase},
+		{http.MethodPost, "/cases/{caseID}/share", caseapi.PermissionFederatedShare, caseHandler.ShareCase},
+	}
+	for _, route := range routes {
+		if err := handler.HandleRoute(route.method, route.pattern, route.permission, audit.AccessPurposeMiddleware(route.fn)); err != nil {
+			fmt.Printf("Warning: federated route %s %s not registered: %v\n", route.method, route.pattern, err)
+		}
+	}
+
+	for _, grant := range cfg.Federation.Grants {
+		code, permission, ok := strings.Cut(grant, ":")
+		if !ok || code == "" || permission == "" {
+			fmt.Printf("Warning: ignoring federation grant %q, expected CODE:permission\n", grant)
+			continue
+		}
+		handler.Grant(strings.ToUpper(code), permission)
+	}
+}
+
+// registerWitnessService lets other agencies ask this node to cosign their
+// audit checkpoints over the federation gateway. Cosigned checkpoints are
+// kept so that a rewritten history is refused.
+func registerWitnessService(app *App, cfg *config.Config, gw *gateway.Gateway, handler *gateway.Handler) {
+	local, err := audit.NewLocalAgencyFromConfig(cfg.TSA, gw)
+	if err != nil {
+		fmt.Printf("Warning: Witness service disabled: %v\n", err)
+		return
+	}
+	witness, err := tsa.NewMultiAgencyWitness(&tsa.MultiAgencyConfig{Enabled: true, MinSignatures: 1}, local)
+	if err != nil {
+		fmt.Printf("Warning: Witness service disabled: %v\n", err)
+		return
+	}
+	witness.SetHistory(tsa.NewPostgresWitnessHistory(app.DB.Pool))
+	handler.HandleService(tsa.WitnessServicePath, witness.ReceiveSignRequest)
+	fmt.Printf("Audit witness service enabled (agency: %s)\n", local.AgencyCode)
+}
+
+// newTrustAuthority creates the Trust Authority with the root CA on disk,
+// generated on first start, and the agencies registered before
+func newTrustAuthority(ctx context.Context, cfg *config.Config, app *App) (*trust.Authority, error) {
+	rootCert, rootKey, created, err := trust.LoadOrCreateRootCA(cfg.Federation.RootCertPath, cfg.Federation.RootKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		fmt.Printf("Trust Authority root CA generated (%s); keep the key safe, every agency certificate depends on it\n",
+			cfg.Federation.RootKeyPath)
+	}
+
+	authority, err := trust.NewAuthorityWithRoot(trust.NewPostgresRepository(app.DB.Pool), rootCert, rootKey)
+	if err != nil {
+		return nil, err
+	}
+	authority.SetRevocationEndpoints(cfg.Server.PublicURL+"/federation/pki/crl", cfg.Server.PublicURL+"/federation/pki/ocsp")
+	authority.SetRootPaths(cfg.Federation.RootCertPath, cfg.Federation.RootKeyPath)
+
+	// Sector intermediate CAs are loaded first, so that the certificates
+	// they issued verify when the registry is loaded
+	authority.SetIntermediateDir(cfg.Federation.IntermediateDir)
+	if _, err := authority.LoadIntermediates(); err != nil {
+		return nil, fmt.Errorf("failed to load intermediate CAs: %w", err)
+	}
+	if err := issueSectorCAs(authority); err != nil {
+		return nil, fmt.Errorf("failed to issue intermediate CAs: %w", err)
+	}
+
+	loaded, err := authority.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load registered agencies: %w", err)
+	}
+	fmt.Printf("Trust Authority root CA: %s (%d agencies registered)\n", rootCert.Subject.CommonName, loaded)
+
+	return authority, nil
+}
+
+// kikindaSectors are the Kikinda pilot agencies whose certificates the
+// intermediate CA of each sector issues. Government-wide agencies are issued
+// certificates by the root CA.
+var kikindaSectors = map[string][]string{
+	trust.SectorHealth:    {"MINZDRAVLJA", "DZ-KI", "OB-KI", "APO-KI"},
+	trust.SectorSocial:    {"MINRZS", "MINDEM", "CSR-KI", "GC-KI", "NSZ-KI"},
+	trust.SectorPolice:    {"MUP", "PU-KI"},
+	trust.SectorJustice:   {"MINPRAVDE", "SUD-KI"},
+	trust.SectorEducation: {"MINPROSVETE", "PU-DU-KI", "OS-VK-KI", "GIM-KI"},
+}
+
+// issueSectorCAs issues the intermediate CA of each pilot sector, or
+// reissues it with the same key when pilot agencies were added to the sector
+func issueSectorCAs(authority *trust.Authority) error {
+	existing := make(map[string][]string)
+	for _, ca := range authority.Intermediates() {
+		existing[ca.Sector] = ca.Codes
+	}
+
+	for _, sector := range trust.Sectors {
+		codes := kikindaSectors[sector]
+		missing := slices.ContainsFunc(codes, func(code string) bool {
+			return !slices.Contains(existing[sector], code)
+		})
+		if !missing {
+			continue
+		}
+		ca, err := authority.IssueIntermediate(sector, append(slices.Clone(existing[sector]), codes...))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Intermediate CA of sector %s issued for %d agencies\n", sector, len(ca.Codes))
+	}
+	return nil
+}
+
+// enrollLocalAgency loads this agency's gateway key, generated on first
+// start, and enrolls the agency with a certificate signing request for it
+// when it is not registered yet. A certificate close to expiry is renewed
+// for the same key.
+func enrollLocalAgency(ctx context.Context, cfg *config.Config, authority *trust.Authority) (*trust.TrustedAgency, ed25519.PrivateKey, error) {
+	key, created, err := gateway.LoadOrCreateKey(cfg.Federation.GatewayKeyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if created {
+		fmt.Printf("Federation gateway key generated (%s)\n", cfg.Federation.GatewayKeyPath)
+	}
+
+	code := cfg.Privacy.FacilityCode
+	agency, _ := authority.GetAgencyByCode(ctx, code)
+	if agency != nil {
+		if !bytes.Equal(agency.PublicKey, key.Public().(ed25519.PublicKey)) {
+			return nil, nil, fmt.Errorf("agency %s is registered with a different key than %s", code, cfg.Federation.GatewayKeyPath)
+		}
+		renewBefore := time.Duration(cfg.Federation.RenewBeforeDays) * 24 * time.Hour
+		if agency.Status == "active" && time.Until(agency.ExpiresAt()) < renewBefore {
+			csr, proof, err := trust.CreateRenewal(code, key, key)
+			if err != nil {
+				return nil, nil, err
+			}
+			if agency, err = authority.Renew(ctx, agency.ID, csr, proof); err != nil {
+				return nil, nil, fmt.Errorf("failed to renew certificate of %s: %w", code, err)
+			}
+			fmt.Printf("Certificate of agency %s renewed until %s\n", code, agency.ExpiresAt().Format("2006-01-02"))
+		}
+		return agency, key, nil
+	}
+
+	_, token, err := authority.CreateEnrollment(ctx, code, code, cfg.Server.PublicURL+"/api/v1", 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := trust.CreateCSR(code, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	agency, err = authority.Enroll(ctx, token, csr)
+	if err != nil {
+		return nil, nil, err
+	}
+	fmt.Printf("Agency %s enrolled with the Trust Authority\n", code)
+
+	return agency, key, nil
+}
+
+// seedKikindaPilot registers Kikinda pilot agencies in the Trust Authority.
+// Agencies that have not enrolled get an enrollment token, written to
+// tokenDir for the platform admin to hand over; their services are
+// registered once they have enrolled.
+func seedKikindaPilot(authority *trust.Authority, tokenDir string) {
 	ctx := context.Background()
 
 	// Kikinda pilot - full hierarchy from local to national level
@@ -536,10 +1123,29 @@ func seedKikindaPilot(authority *trust.Authority) {
 	}
 
 	// Register all pilot agencies
+	enrolled, issued := 0, 0
 	for _, a := range agencies {
-		agency, err := authority.RegisterAgency(ctx, a.name, a.code, a.gatewayURL)
+		agency, _ := authority.GetAgencyByCode(ctx, a.code)
+		if agency == nil {
+			pending, err := authority.PendingEnrollment(ctx, a.code)
+			if err != nil {
+				fmt.Printf("Warning: Failed to check enrollment of %s: %v\n", a.code, err)
+				continue
+			}
+			if pending == nil {
+				if err := issueEnrollmentToken(ctx, authority, tokenDir, a.name, a.code, a.gatewayURL); err != nil {
+					fmt.Printf("Warning: Failed to issue enrollment token for %s: %v\n", a.code, err)
+					continue
+				}
+				issued++
+			}
+			continue
+		}
+		enrolled++
+
+		existing, err := authority.GetServices(ctx, agency.ID)
 		if err != nil {
-			fmt.Printf("Warning: Failed to register %s: %v\n", a.code, err)
+			fmt.Printf("Warning: Failed to list services of %s: %v\n", a.code, err)
 			continue
 		}
 
@@ -557,6 +1163,9 @@ func seedKikindaPilot(authority *trust.Authority) {
 		}
 
 		for _, s := range services {
+			if hasService(existing, s.serviceType, s.version) {
+				continue
+			}
 			_, err := authority.RegisterService(ctx, agency.ID, s.serviceType, s.path, s.version)
 			if err != nil {
 				fmt.Printf("Warning: Failed to register service %s for %s: %v\n", s.serviceType, a.code, err)
@@ -564,5 +1173,29 @@ func seedKikindaPilot(authority *trust.Authority) {
 		}
 	}
 
-	fmt.Println("Kikinda pilot agencies registered (20 agencies - local to national)")
+	fmt.Printf("Kikinda pilot agencies: %d of %d enrolled - local to national (%d new enrollment tokens in %s)\n",
+		enrolled, len(agencies), issued, tokenDir)
+}
+
+// issueEnrollmentToken authorizes an agency to enroll and writes the token
+// to <tokenDir>/<code>.token, readable only by the platform user
+func issueEnrollmentToken(ctx context.Context, authority *trust.Authority, tokenDir, name, code, gatewayURL string) error {
+	_, token, err := authority.CreateEnrollment(ctx, name, code, gatewayURL, 0)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tokenDir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(tokenDir, code+".token"), []byte(token+"\n"), 0600)
+}
+
+// hasService reports whether a service type and version is among services
+func hasService(services []trust.ServiceEndpoint, serviceType, version string) bool {
+	for _, s := range services {
+		if s.ServiceType == serviceType && s.Version == version {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,282 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/serbia-gov/platform/internal/privacy"
+	"github.com/serbia-gov/platform/internal/shared/auth"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// Read access to a citizen's data is recorded as one entry per data subject,
+// with the subject's pseudonym as the resource. Citizens can then be told
+// which officials looked at their data without the audit log holding a JMBG.
+
+const (
+	// ActionDataAccessed is the action of read-access entries
+	ActionDataAccessed = "data.accessed"
+	// ResourceTypeDataSubject is the resource type of read-access entries
+	ResourceTypeDataSubject = "data_subject"
+
+	// AccessPurposeHeader carries the purpose an official states for a read
+	AccessPurposeHeader = "X-Access-Purpose"
+
+	maxPurposeLength = 200
+)
+
+// subjectNamespace derives data-subject resource IDs from pseudonyms
+var subjectNamespace = uuid.NewSHA1(uuid.NameSpaceOID, []byte("serbia-gov/audit/data-subject"))
+
+// anonymousActorID is recorded when a read has no authenticated user (development)
+var anonymousActorID = types.ID(uuid.Nil.String())
+
+// SubjectResourceID returns the resource ID under which reads of a data
+// subject's records are logged
+func SubjectResourceID(pseudonymID privacy.PseudonymID) types.ID {
+	return types.ID(uuid.NewSHA1(subjectNamespace, []byte(pseudonymID)).String())
+}
+
+type accessPurposeKey struct{}
+
+// AccessPurposeMiddleware stores the purpose stated in the X-Access-Purpose
+// header in the request context, where the access recorder picks it up
+func AccessPurposeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if purpose := strings.TrimSpace(r.Header.Get(AccessPurposeHeader)); purpose != "" {
+			if len(purpose) > maxPurposeLength {
+				purpose = purpose[:maxPurposeLength]
+			}
+			r = r.WithContext(WithAccessPurpose(r.Context(), purpose))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WithAccessPurpose returns a context carrying the purpose of a read
+func WithAccessPurpose(ctx context.Context, purpose string) context.Context {
+	return context.WithValue(ctx, accessPurposeKey{}, purpose)
+}
+
+// AccessPurpose returns the purpose of a read, if one was stated
+func AccessPurpose(ctx context.Context) string {
+	purpose, _ := ctx.Value(accessPurposeKey{}).(string)
+	return purpose
+}
+
+// Pseudonymizer converts a JMBG to a pseudonym (implemented by privacy.PseudonymizationService)
+type Pseudonymizer interface {
+	Pseudonymize(ctx context.Context, jmbg string) (privacy.PseudonymID, error)
+}
+
+// SubjectResolver returns the pseudonyms of the data subjects of a case
+type SubjectResolver interface {
+	CaseSubjects(ctx context.Context, caseID types.ID) ([]privacy.PseudonymID, error)
+}
+
+// PostgresSubjectResolver resolves the citizens participating in a case
+type PostgresSubjectResolver struct {
+	pool          *pgxpool.Pool
+	pseudonymizer Pseudonymizer
+}
+
+// NewPostgresSubjectResolver creates a new subject resolver
+func NewPostgresSubjectResolver(pool *pgxpool.Pool, pseudonymizer Pseudonymizer) *PostgresSubjectResolver {
+	return &PostgresSubjectResolver{pool: pool, pseudonymizer: pseudonymizer}
+}
+
+// CaseSubjects returns the pseudonyms of the citizens participating in a case
+func (r *PostgresSubjectResolver) CaseSubjects(ctx context.Context, caseID types.ID) ([]privacy.PseudonymID, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT DISTINCT c.jmbg
+		FROM cases.participants p
+		JOIN identity.citizens c ON c.id = p.citizen_id
+		WHERE p.case_id = $1`, caseID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query case subjects")
+	}
+	defer rows.Close()
+
+	var jmbgs []string
+	for rows.Next() {
+		var jmbg string
+		if err := rows.Scan(&jmbg); err != nil {
+			return nil, errors.Wrap(err, "failed to scan case subject")
+		}
+		jmbgs = append(jmbgs, jmbg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read case subjects")
+	}
+
+	pseudonyms := make([]privacy.PseudonymID, 0, len(jmbgs))
+	for _, jmbg := range jmbgs {
+		pseudonymID, err := r.pseudonymizer.Pseudonymize(ctx, jmbg)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to pseudonymize case subject")
+		}
+		pseudonyms = append(pseudonyms, pseudonymID)
+	}
+
+	return pseudonyms, nil
+}
+
+// userActor returns the audit actor fields of an authenticated user
+func userActor(user *auth.User) (ActorType, types.ID, *types.ID) {
+	actorType := ActorTypeWorker
+	if user.UserType == string(ActorTypeCitizen) {
+		actorType = ActorTypeCitizen
+	}
+
+	var agencyID *types.ID
+	if !user.AgencyID.IsZero() {
+		id := user.AgencyID
+		agencyID = &id
+	}
+
+	return actorType, user.ID, agencyID
+}
+
+// AccessRecorder appends read-access entries to the audit log.
+// Recording never fails the read: errors are logged.
+type AccessRecorder struct {
+	repo     AuditRepository
+	subjects SubjectResolver
+}
+
+// NewAccessRecorder creates a new access recorder
+func NewAccessRecorder(repo AuditRepository, subjects SubjectResolver) *AccessRecorder {
+	return &AccessRecorder{repo: repo, subjects: subjects}
+}
+
+// RecordCaseAccess records a read of a case, or of a record belonging to a
+// case, for every data subject of the case
+func (a *AccessRecorder) RecordCaseAccess(ctx context.Context, caseID types.ID, resourceType string, resourceID types.ID) {
+	if a.subjects == nil {
+		return
+	}
+
+	subjects, err := a.subjects.CaseSubjects(ctx, caseID)
+	if err != nil {
+		fmt.Printf("Warning: failed to resolve data subjects of case %s: %v\n", caseID, err)
+		return
+	}
+
+	for _, pseudonymID := range subjects {
+		a.record(ctx, pseudonymID, resourceType, &resourceID, map[string]any{"case_id": caseID})
+	}
+}
+
+// RecordSubjectAccess records a read of a data subject's records in a source
+// system, e.g. a health record lookup through an adapter
+func (a *AccessRecorder) RecordSubjectAccess(ctx context.Context, pseudonymID privacy.PseudonymID, source string) {
+	a.record(ctx, pseudonymID, source, nil, nil)
+}
+
+func (a *AccessRecorder) record(ctx context.Context, pseudonymID privacy.PseudonymID, resourceType string, resourceID *types.ID, extra map[string]any) {
+	actorType := ActorTypeSystem
+	actorID := anonymousActorID
+	var agencyID *types.ID
+
+	if user := auth.GetUser(ctx); user != nil {
+		actorType, actorID, agencyID = userActor(user)
+	}
+
+	changes := map[string]any{
+		"resource_type": resourceType,
+	}
+	if resourceID != nil {
+		changes["resource_id"] = *resourceID
+	}
+	if purpose := AccessPurpose(ctx); purpose != "" {
+		changes["purpose"] = purpose
+	}
+	for k, v := range extra {
+		changes[k] = v
+	}
+
+	subjectID := SubjectResourceID(pseudonymID)
+	entry := NewAuditEntry(actorType, actorID, agencyID, ActionDataAccessed, ResourceTypeDataSubject, &subjectID, changes, "")
+	entry.WithContext(nil, nil, AccessPurpose(ctx))
+
+	if err := a.repo.Append(ctx, entry); err != nil {
+		fmt.Printf("Warning: failed to record data access: %v\n", err)
+	}
+}
+
+// RecordDenied records a request that was refused with 401 or 403
+func (a *AccessRecorder) RecordDenied(ctx context.Context, r *http.Request, status int) {
+	actorType := ActorTypeExternal
+	actorID := anonymousActorID
+	var agencyID *types.ID
+
+	if user := auth.GetUser(ctx); user != nil {
+		actorType, actorID, agencyID = userActor(user)
+	}
+
+	entry := NewAuditEntry(actorType, actorID, agencyID, ActionAccessDenied, "request", nil, map[string]any{
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"status": status,
+	}, "")
+	entry.WithRequest(r.RemoteAddr, r.UserAgent())
+
+	if err := a.repo.Append(ctx, entry); err != nil {
+		fmt.Printf("Warning: failed to record denied access: %v\n", err)
+	}
+}
+
+// DeniedAccessLogger is middleware recording refused requests. Routes are
+// set up before the audit log, so it records nothing until SetRecorder is
+// called. Installed after the auth middleware, the refusal is attributed to
+// the authenticated user.
+type DeniedAccessLogger struct {
+	recorder *AccessRecorder
+}
+
+// NewDeniedAccessLogger creates a new denied access logger
+func NewDeniedAccessLogger() *DeniedAccessLogger {
+	return &DeniedAccessLogger{}
+}
+
+// SetRecorder sets the recorder that refused requests are written to
+func (l *DeniedAccessLogger) SetRecorder(recorder *AccessRecorder) {
+	l.recorder = recorder
+}
+
+// Middleware records responses with status 401 or 403
+func (l *DeniedAccessLogger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.recorder == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		if sw.status == http.StatusUnauthorized || sw.status == http.StatusForbidden {
+			l.recorder.RecordDenied(r.Context(), r, sw.status)
+		}
+	})
+}
+
+// statusWriter captures the status code of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
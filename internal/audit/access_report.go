@@ -0,0 +1,440 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"sort"
+	"time"
+
+	"github.com/serbia-gov/platform/internal/agency"
+	"github.com/serbia-gov/platform/internal/doctemplate"
+	"github.com/serbia-gov/platform/internal/privacy"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/types"
+	"github.com/serbia-gov/platform/internal/tsa"
+)
+
+const (
+	accessReportPageSize = 100
+	// maxAccessReportEntries bounds the size of a single report
+	maxAccessReportEntries = 10000
+)
+
+// AccessRecord is a single read of a data subject's records
+type AccessRecord struct {
+	EntryID      types.ID  `json:"entry_id"`
+	Sequence     int64     `json:"sequence"`
+	Timestamp    time.Time `json:"timestamp"`
+	ResourceType string    `json:"resource_type"`
+	ResourceID   *types.ID `json:"resource_id,omitempty"`
+	CaseID       *types.ID `json:"case_id,omitempty"`
+}
+
+// AccessGroup collects the reads by one official of one agency, for one
+// purpose, on one day
+type AccessGroup struct {
+	Date       string         `json:"date"` // YYYY-MM-DD (UTC)
+	AgencyID   *types.ID      `json:"agency_id,omitempty"`
+	AgencyName string         `json:"agency_name,omitempty"`
+	ActorType  ActorType      `json:"actor_type"`
+	ActorID    types.ID       `json:"actor_id"`
+	ActorName  string         `json:"actor_name,omitempty"`
+	Purpose    string         `json:"purpose,omitempty"`
+	Count      int            `json:"count"`
+	Accesses   []AccessRecord `json:"accesses"`
+}
+
+// AccessReport lists every recorded read of a data subject's records
+type AccessReport struct {
+	ID            types.ID      `json:"id"`
+	Subject       string        `json:"subject"` // masked JMBG
+	From          *time.Time    `json:"from,omitempty"`
+	To            *time.Time    `json:"to,omitempty"`
+	TotalAccesses int           `json:"total_accesses"`
+	Truncated     bool          `json:"truncated,omitempty"`
+	Groups        []AccessGroup `json:"groups"`
+	// The audit chain head when the report was generated
+	ChainSequence int64     `json:"chain_sequence"`
+	ChainHash     string    `json:"chain_hash"`
+	GeneratedAt   time.Time `json:"generated_at"`
+}
+
+// ReportSignature is an RFC 3161 timestamp token over the SHA-256 hash of
+// the report exactly as encoded in the signed report
+type ReportSignature struct {
+	Algorithm    string    `json:"algorithm"`
+	Hash         string    `json:"hash"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber uint64    `json:"serial_number"`
+	Timestamp    time.Time `json:"timestamp"`
+	Token        []byte    `json:"token"`
+}
+
+// SignedAccessReport is an access report with its signature. The signature
+// covers the bytes of Report, which are kept as encoded.
+type SignedAccessReport struct {
+	Report    json.RawMessage  `json:"report"`
+	Signature *ReportSignature `json:"signature,omitempty"`
+
+	report *AccessReport
+}
+
+// ReportSigner timestamps report contents (implemented by tsa.Server)
+type ReportSigner interface {
+	TimestampData(ctx context.Context, data []byte) (*tsa.TimestampResponse, error)
+}
+
+// AccessDirectory resolves the agency and official names shown in access
+// reports (implemented by agency.Repository)
+type AccessDirectory interface {
+	GetAgency(ctx context.Context, id types.ID) (*agency.Agency, error)
+	GetWorker(ctx context.Context, id types.ID) (*agency.Worker, error)
+}
+
+// AccessReportService produces data-subject access reports
+type AccessReportService struct {
+	repo          AuditRepository
+	pseudonymizer Pseudonymizer
+	directory     AccessDirectory // nil when names are not resolved
+	signer        ReportSigner    // nil when reports are not signed
+}
+
+// NewAccessReportService creates a new access report service
+func NewAccessReportService(repo AuditRepository, pseudonymizer Pseudonymizer) *AccessReportService {
+	return &AccessReportService{repo: repo, pseudonymizer: pseudonymizer}
+}
+
+// SetDirectory enables agency and official names in reports
+func (s *AccessReportService) SetDirectory(directory AccessDirectory) {
+	s.directory = directory
+}
+
+// SetSigner enables report signatures
+func (s *AccessReportService) SetSigner(signer ReportSigner) {
+	s.signer = signer
+}
+
+// Generate produces the signed access report of the citizen with the given
+// JMBG, optionally limited to a time range
+func (s *AccessReportService) Generate(ctx context.Context, jmbg string, from, to *time.Time) (*SignedAccessReport, error) {
+	if len(jmbg) != 13 {
+		return nil, errors.BadRequest("JMBG must have 13 digits")
+	}
+	for _, c := range jmbg {
+		if c < '0' || c > '9' {
+			return nil, errors.BadRequest("JMBG must have 13 digits")
+		}
+	}
+	if from != nil && to != nil && to.Before(*from) {
+		return nil, errors.BadRequest("to must not be before from")
+	}
+
+	pseudonymID, err := s.pseudonymizer.Pseudonymize(ctx, jmbg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pseudonymize subject")
+	}
+
+	entries, truncated, err := s.subjectEntries(ctx, pseudonymID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	report := buildAccessReport(entries, time.Now().UTC())
+	report.Subject = privacy.MaskJMBG(jmbg)
+	report.From = from
+	report.To = to
+	report.Truncated = truncated
+	report.ChainSequence = s.repo.GetSequence()
+	report.ChainHash = s.repo.GetLastHash()
+	s.resolveNames(ctx, report)
+
+	return s.sign(ctx, report)
+}
+
+// subjectEntries reads the read-access entries of a data subject, newest first
+func (s *AccessReportService) subjectEntries(ctx context.Context, pseudonymID privacy.PseudonymID, from, to *time.Time) ([]*AuditEntry, bool, error) {
+	subjectID := SubjectResourceID(pseudonymID)
+	filter := ListEntriesFilter{
+		Action:       ActionDataAccessed,
+		ResourceType: ResourceTypeDataSubject,
+		ResourceID:   &subjectID,
+		StartTime:    from,
+		EndTime:      to,
+		Limit:        accessReportPageSize,
+	}
+
+	// Pages are read until one comes back short, so the report is complete
+	// unless the subject has more accesses than a report holds
+	var entries []*AuditEntry
+	for {
+		page, _, err := s.repo.List(ctx, filter)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "failed to read access entries")
+		}
+		entries = append(entries, page...)
+
+		if len(entries) > maxAccessReportEntries {
+			return entries[:maxAccessReportEntries], true, nil
+		}
+		if len(page) < accessReportPageSize {
+			return entries, false, nil
+		}
+		filter.Offset += len(page)
+	}
+}
+
+// buildAccessReport groups read-access entries by day, agency, official and purpose
+func buildAccessReport(entries []*AuditEntry, now time.Time) *AccessReport {
+	type groupKey struct {
+		date     string
+		agencyID types.ID
+		actorID  types.ID
+		purpose  string
+	}
+
+	groups := make(map[groupKey]*AccessGroup)
+	total := 0
+	for _, e := range entries {
+		if e.Action != ActionDataAccessed {
+			continue
+		}
+		total++
+
+		purpose, _ := e.Changes["purpose"].(string)
+		key := groupKey{date: e.Timestamp.UTC().Format("2006-01-02"), actorID: e.ActorID, purpose: purpose}
+		if e.ActorAgencyID != nil {
+			key.agencyID = *e.ActorAgencyID
+		}
+
+		group, ok := groups[key]
+		if !ok {
+			group = &AccessGroup{
+				Date:      key.date,
+				AgencyID:  e.ActorAgencyID,
+				ActorType: e.ActorType,
+				ActorID:   e.ActorID,
+				Purpose:   purpose,
+			}
+			groups[key] = group
+		}
+
+		record := AccessRecord{
+			EntryID:   e.ID,
+			Sequence:  e.Sequence,
+			Timestamp: e.Timestamp,
+		}
+		record.ResourceType, _ = e.Changes["resource_type"].(string)
+		record.ResourceID = changeID(e.Changes, "resource_id")
+		record.CaseID = changeID(e.Changes, "case_id")
+
+		group.Accesses = append(group.Accesses, record)
+		group.Count++
+	}
+
+	report := &AccessReport{
+		ID:            types.NewID(),
+		TotalAccesses: total,
+		Groups:        make([]AccessGroup, 0, len(groups)),
+		GeneratedAt:   now,
+	}
+	for _, group := range groups {
+		sort.Slice(group.Accesses, func(i, j int) bool {
+			return group.Accesses[i].Timestamp.Before(group.Accesses[j].Timestamp)
+		})
+		report.Groups = append(report.Groups, *group)
+	}
+
+	// Newest day first, then by agency, official and purpose
+	sort.Slice(report.Groups, func(i, j int) bool {
+		a, b := report.Groups[i], report.Groups[j]
+		if a.Date != b.Date {
+			return a.Date > b.Date
+		}
+		if ai, bi := idString(a.AgencyID), idString(b.AgencyID); ai != bi {
+			return ai < bi
+		}
+		if a.ActorID != b.ActorID {
+			return a.ActorID < b.ActorID
+		}
+		return a.Purpose < b.Purpose
+	})
+
+	return report
+}
+
+// resolveNames fills in agency and official names where the directory knows them
+func (s *AccessReportService) resolveNames(ctx context.Context, report *AccessReport) {
+	if s.directory == nil {
+		return
+	}
+
+	agencies := make(map[types.ID]string)
+	workers := make(map[types.ID]string)
+	for i := range report.Groups {
+		group := &report.Groups[i]
+
+		if group.AgencyID != nil {
+			name, ok := agencies[*group.AgencyID]
+			if !ok {
+				if a, err := s.directory.GetAgency(ctx, *group.AgencyID); err == nil {
+					name = a.Name
+				}
+				agencies[*group.AgencyID] = name
+			}
+			group.AgencyName = name
+		}
+
+		if group.ActorType == ActorTypeWorker {
+			name, ok := workers[group.ActorID]
+			if !ok {
+				if w, err := s.directory.GetWorker(ctx, group.ActorID); err == nil {
+					name = w.FirstName + " " + w.LastName
+				}
+				workers[group.ActorID] = name
+			}
+			group.ActorName = name
+		}
+	}
+}
+
+// sign encodes the report and timestamps its hash
+func (s *AccessReportService) sign(ctx context.Context, report *AccessReport) (*SignedAccessReport, error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode access report")
+	}
+
+	signed := &SignedAccessReport{Report: data, report: report}
+	if s.signer == nil {
+		return signed, nil
+	}
+
+	resp, err := s.signer.TimestampData(ctx, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign access report")
+	}
+
+	hash := sha256.Sum256(data)
+	signed.Signature = &ReportSignature{
+		Algorithm:    "RFC3161-SHA256",
+		Hash:         hex.EncodeToString(hash[:]),
+		Issuer:       resp.Issuer,
+		SerialNumber: resp.SerialNumber,
+		Timestamp:    resp.Timestamp,
+		Token:        resp.Token,
+	}
+
+	return signed, nil
+}
+
+var accessReportTemplate = template.Must(template.New("access-report").Funcs(template.FuncMap{
+	"time": func(t time.Time) string { return t.Local().Format("02.01.2006 15:04:05") },
+	"date": func(t *time.Time) string {
+		if t == nil {
+			return "-"
+		}
+		return t.Local().Format("02.01.2006")
+	},
+	"agency": func(g AccessGroup) string {
+		if g.AgencyName != "" {
+			return g.AgencyName
+		}
+		if g.AgencyID != nil {
+			return g.AgencyID.String()
+		}
+		return "-"
+	},
+	"official": func(g AccessGroup) string {
+		if g.ActorName != "" {
+			return g.ActorName
+		}
+		return g.ActorID.String()
+	},
+	"purpose": func(g AccessGroup) string {
+		if g.Purpose == "" {
+			return "nije navedena"
+		}
+		return g.Purpose
+	},
+}).Parse(`<h1>Izveštaj o pristupu ličnim podacima</h1>
+<p>Lice: <strong>{{.Subject}}</strong></p>
+<p>Period: {{date .From}} - {{date .To}}</p>
+<p>Ukupno pristupa: <strong>{{.TotalAccesses}}</strong>{{if .Truncated}} (izveštaj je skraćen){{end}}</p>
+<p>Izveštaj {{.ID}}, sačinjen {{time .GeneratedAt}}</p>
+{{if .Groups}}
+<table>
+<tr><th>Datum</th><th>Organ</th><th>Službenik</th><th>Svrha</th><th>Pristupi</th></tr>
+{{range .Groups}}<tr><td>{{.Date}}</td><td>{{agency .}}</td><td>{{official .}}</td><td>{{purpose .}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{range .Groups}}
+<h3>{{.Date}} - {{official .}}, {{agency .}}</h3>
+<ul>
+{{range .Accesses}}<li>{{time .Timestamp}} {{.ResourceType}}{{if .ResourceID}} {{.ResourceID}}{{end}} (audit #{{.Sequence}})</li>
+{{end}}</ul>
+{{end}}
+{{else}}
+<p>Nije evidentiran nijedan pristup.</p>
+{{end}}
+<hr>
+<p>Stanje audit lanca: #{{.ChainSequence}} {{.ChainHash}}</p>
+`))
+
+var signatureTemplate = template.Must(template.New("signature").Parse(`<h2>Potpis</h2>
+<p>SHA-256 izveštaja (JSON): {{.Hash}}</p>
+<p>Vremenski žig ({{.Algorithm}}): {{.Issuer}}, serijski broj {{.SerialNumber}}, {{.Timestamp.UTC.Format "2006-01-02T15:04:05Z"}}</p>
+`))
+
+// RenderPDF renders the report as a PDF/A document. The signature block
+// references the JSON export, which carries the timestamp token.
+func (r *SignedAccessReport) RenderPDF() ([]byte, error) {
+	report := r.report
+	if report == nil {
+		report = &AccessReport{}
+		if err := json.Unmarshal(r.Report, report); err != nil {
+			return nil, fmt.Errorf("failed to decode access report: %w", err)
+		}
+	}
+
+	var body bytes.Buffer
+	if err := accessReportTemplate.Execute(&body, report); err != nil {
+		return nil, fmt.Errorf("failed to render access report: %w", err)
+	}
+	if r.Signature != nil {
+		if err := signatureTemplate.Execute(&body, r.Signature); err != nil {
+			return nil, fmt.Errorf("failed to render access report signature: %w", err)
+		}
+	}
+
+	return doctemplate.RenderPDF(body.Bytes(), doctemplate.PDFOptions{
+		Title:     "Izveštaj o pristupu ličnim podacima",
+		Subject:   report.ID.String(),
+		Language:  "sr-Latn",
+		CreatedAt: report.GeneratedAt,
+	})
+}
+
+// changeID reads an ID stored in an entry's changes
+func changeID(changes map[string]any, key string) *types.ID {
+	switch v := changes[key].(type) {
+	case string:
+		id := types.ID(v)
+		return &id
+	case types.ID:
+		return &v
+	case *types.ID:
+		return v
+	}
+	return nil
+}
+
+func idString(id *types.ID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
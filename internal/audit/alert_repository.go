@@ -0,0 +1,197 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// AlertStore persists alerts raised by the alert engine
+type AlertStore interface {
+	Save(ctx context.Context, alert *Alert) error
+	Get(ctx context.Context, id types.ID) (*Alert, error)
+	List(ctx context.Context, filter AlertFilter) ([]*Alert, int, error)
+	Update(ctx context.Context, alert *Alert) error
+}
+
+// AlertFilter defines filters for listing alerts
+type AlertFilter struct {
+	Status   AlertStatus
+	Severity AlertSeverity
+	Rule     string
+	ActorID  *types.ID
+	Limit    int
+	Offset   int
+}
+
+// AlertRepository stores alerts in PostgreSQL
+type AlertRepository struct {
+	pool *pgxpool.Pool
+}
+
+var _ AlertStore = (*AlertRepository)(nil)
+
+// NewAlertRepository creates a new alert repository
+func NewAlertRepository(pool *pgxpool.Pool) *AlertRepository {
+	return &AlertRepository{pool: pool}
+}
+
+const alertColumns = `id, rule, severity, status, summary,
+			actor_type, actor_id, actor_agency_id, entry_ids, details, raised_at,
+			acknowledged_by, acknowledged_at, resolved_by, resolved_at, resolution`
+
+// Save inserts a new alert
+func (r *AlertRepository) Save(ctx context.Context, alert *Alert) error {
+	details, err := json.Marshal(alert.Details)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal alert details")
+	}
+
+	_, err = r.pool.Exec(ctx, `
+		INSERT INTO audit.alerts (`+alertColumns+`
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
+		alert.ID, alert.Rule, alert.Severity, alert.Status, alert.Summary,
+		alert.ActorType, alert.ActorID.String(), alert.ActorAgencyID, alert.EntryIDs, details, alert.RaisedAt,
+		alert.AcknowledgedBy, alert.AcknowledgedAt, alert.ResolvedBy, alert.ResolvedAt, nullString(alert.Resolution),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to save alert")
+	}
+	return nil
+}
+
+// Get returns an alert by ID
+func (r *AlertRepository) Get(ctx context.Context, id types.ID) (*Alert, error) {
+	row := r.pool.QueryRow(ctx, `
+		SELECT `+alertColumns+`
+		FROM audit.alerts
+		WHERE id = $1`, id)
+
+	alert, err := scanAlert(row)
+	if err == pgx.ErrNoRows {
+		return nil, errors.NotFound("alert", id.String())
+	}
+	return alert, err
+}
+
+// List returns alerts matching the filter, newest first, and the total count
+func (r *AlertRepository) List(ctx context.Context, filter AlertFilter) ([]*Alert, int, error) {
+	var conditions []string
+	var args []any
+	argNum := 1
+
+	if filter.Status != "" {
+		conditions = append(conditions, fmt.Sprintf("status = $%d", argNum))
+		args = append(args, filter.Status)
+		argNum++
+	}
+	if filter.Severity != "" {
+		conditions = append(conditions, fmt.Sprintf("severity = $%d", argNum))
+		args = append(args, filter.Severity)
+		argNum++
+	}
+	if filter.Rule != "" {
+		conditions = append(conditions, fmt.Sprintf("rule = $%d", argNum))
+		args = append(args, filter.Rule)
+		argNum++
+	}
+	if filter.ActorID != nil {
+		conditions = append(conditions, fmt.Sprintf("actor_id = $%d", argNum))
+		args = append(args, filter.ActorID.String())
+		argNum++
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.pool.QueryRow(ctx, "SELECT COUNT(*) FROM audit.alerts "+where, args...).Scan(&total); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count alerts")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	rows, err := r.pool.Query(ctx, fmt.Sprintf(`
+		SELECT `+alertColumns+`
+		FROM audit.alerts
+		%s
+		ORDER BY raised_at DESC
+		LIMIT $%d OFFSET $%d`, where, argNum, argNum+1),
+		append(args, limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to list alerts")
+	}
+	defer rows.Close()
+
+	alerts := []*Alert{}
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, total, rows.Err()
+}
+
+// Update stores the handling status of an alert
+func (r *AlertRepository) Update(ctx context.Context, alert *Alert) error {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE audit.alerts
+		SET status = $2, acknowledged_by = $3, acknowledged_at = $4,
+			resolved_by = $5, resolved_at = $6, resolution = $7
+		WHERE id = $1`,
+		alert.ID, alert.Status, alert.AcknowledgedBy, alert.AcknowledgedAt,
+		alert.ResolvedBy, alert.ResolvedAt, nullString(alert.Resolution),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to update alert")
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.NotFound("alert", alert.ID.String())
+	}
+	return nil
+}
+
+func scanAlert(row pgx.Row) (*Alert, error) {
+	var a Alert
+	var actorID string
+	var details []byte
+	var resolution *string
+
+	err := row.Scan(
+		&a.ID, &a.Rule, &a.Severity, &a.Status, &a.Summary,
+		&a.ActorType, &actorID, &a.ActorAgencyID, &a.EntryIDs, &details, &a.RaisedAt,
+		&a.AcknowledgedBy, &a.AcknowledgedAt, &a.ResolvedBy, &a.ResolvedAt, &resolution,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scan alert")
+	}
+
+	a.ActorID = types.ID(actorID)
+	if len(details) > 0 {
+		if err := json.Unmarshal(details, &a.Details); err != nil {
+			a.Details = nil
+		}
+	}
+	if resolution != nil {
+		a.Resolution = *resolution
+	}
+
+	return &a, nil
+}
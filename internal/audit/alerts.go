@@ -0,0 +1,473 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/serbia-gov/platform/internal/privacy"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// AlertSeverity defines how urgently an alert needs attention
+type AlertSeverity string
+
+const (
+	AlertSeverityMedium   AlertSeverity = "medium"
+	AlertSeverityHigh     AlertSeverity = "high"
+	AlertSeverityCritical AlertSeverity = "critical"
+)
+
+// AlertStatus defines the handling status of an alert
+type AlertStatus string
+
+const (
+	AlertStatusOpen         AlertStatus = "open"
+	AlertStatusAcknowledged AlertStatus = "acknowledged"
+	AlertStatusResolved     AlertStatus = "resolved"
+)
+
+// Alert is raised when audit entries match a suspicious pattern
+type Alert struct {
+	ID            types.ID       `json:"id"`
+	Rule          string         `json:"rule"`
+	Severity      AlertSeverity  `json:"severity"`
+	Status        AlertStatus    `json:"status"`
+	Summary       string         `json:"summary"`
+	ActorType     ActorType      `json:"actor_type"`
+	ActorID       types.ID       `json:"actor_id"`
+	ActorAgencyID *types.ID      `json:"actor_agency_id,omitempty"`
+	EntryIDs      []types.ID     `json:"entry_ids"` // entries that triggered the alert
+	Details       map[string]any `json:"details,omitempty"`
+	RaisedAt      time.Time      `json:"raised_at"`
+
+	AcknowledgedBy *types.ID  `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	ResolvedBy     *types.ID  `json:"resolved_by,omitempty"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	Resolution     string     `json:"resolution,omitempty"`
+}
+
+func newAlert(rule string, severity AlertSeverity, entry *AuditEntry, summary string) *Alert {
+	return &Alert{
+		ID:            types.NewID(),
+		Rule:          rule,
+		Severity:      severity,
+		Status:        AlertStatusOpen,
+		Summary:       summary,
+		ActorType:     entry.ActorType,
+		ActorID:       entry.ActorID,
+		ActorAgencyID: entry.ActorAgencyID,
+		EntryIDs:      []types.ID{entry.ID},
+		RaisedAt:      time.Now().UTC(),
+	}
+}
+
+// Acknowledge marks the alert as being looked into
+func (a *Alert) Acknowledge(by types.ID) error {
+	if a.Status != AlertStatusOpen {
+		return errors.Conflict("only open alerts can be acknowledged")
+	}
+	now := time.Now().UTC()
+	a.Status = AlertStatusAcknowledged
+	a.AcknowledgedBy = &by
+	a.AcknowledgedAt = &now
+	return nil
+}
+
+// Resolve closes the alert with the outcome of the investigation
+func (a *Alert) Resolve(by types.ID, resolution string) error {
+	if a.Status == AlertStatusResolved {
+		return errors.Conflict("alert is already resolved")
+	}
+	if resolution == "" {
+		return errors.BadRequest("resolution is required")
+	}
+	now := time.Now().UTC()
+	if a.AcknowledgedAt == nil {
+		a.AcknowledgedBy = &by
+		a.AcknowledgedAt = &now
+	}
+	a.Status = AlertStatusResolved
+	a.ResolvedBy = &by
+	a.ResolvedAt = &now
+	a.Resolution = resolution
+	return nil
+}
+
+// AlertRule detects a suspicious pattern in audit entries. Rules are called
+// with every entry in sequence order and keep their own state.
+type AlertRule interface {
+	Name() string
+	Check(entry *AuditEntry) *Alert
+}
+
+// AlertRulesConfig holds the thresholds of the default rules
+type AlertRulesConfig struct {
+	// ManySubjects alerts when a worker reads this many unrelated citizens within SubjectsWindow
+	ManySubjects   int
+	SubjectsWindow time.Duration
+	// Working hours in Location; reads outside them (and on weekends) raise an alert
+	WorkStartHour int
+	WorkEndHour   int
+	Location      *time.Location
+	// DeniedAttempts alerts on this many denied attempts by one actor within DeniedWindow
+	DeniedAttempts int
+	DeniedWindow   time.Duration
+	// BulkDownloads alerts on this many document downloads by one actor within DownloadWindow
+	BulkDownloads  int
+	DownloadWindow time.Duration
+}
+
+// DefaultAlertRulesConfig returns the default rule thresholds
+func DefaultAlertRulesConfig() AlertRulesConfig {
+	return AlertRulesConfig{
+		ManySubjects:   30,
+		SubjectsWindow: time.Hour,
+		WorkStartHour:  7,
+		WorkEndHour:    19,
+		Location:       time.UTC,
+		DeniedAttempts: 5,
+		DeniedWindow:   10 * time.Minute,
+		BulkDownloads:  50,
+		DownloadWindow: 10 * time.Minute,
+	}
+}
+
+// DefaultAlertRules returns the built-in rules
+func DefaultAlertRules(cfg AlertRulesConfig) []AlertRule {
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+	return []AlertRule{
+		&ManySubjectsRule{Threshold: cfg.ManySubjects, Window: cfg.SubjectsWindow},
+		&OffHoursRule{StartHour: cfg.WorkStartHour, EndHour: cfg.WorkEndHour, Location: cfg.Location},
+		&DeniedAttemptsRule{Threshold: cfg.DeniedAttempts, Window: cfg.DeniedWindow},
+		&PIIViolationRule{Cooldown: 5 * time.Minute},
+		&BulkDownloadRule{Threshold: cfg.BulkDownloads, Window: cfg.DownloadWindow},
+	}
+}
+
+// ManySubjectsRule alerts when a worker reads the data of many unrelated
+// citizens in a short time. Citizens of the same case count once.
+type ManySubjectsRule struct {
+	Threshold int
+	Window    time.Duration
+
+	seen     map[types.ID]map[string]time.Time // actor -> case or subject -> last read
+	cooldown cooldown
+}
+
+func (r *ManySubjectsRule) Name() string { return "many_subjects" }
+
+func (r *ManySubjectsRule) Check(entry *AuditEntry) *Alert {
+	if entry.Action != ActionDataAccessed || entry.ActorType != ActorTypeWorker || entry.ResourceID == nil {
+		return nil
+	}
+	if r.seen == nil {
+		r.seen = make(map[types.ID]map[string]time.Time)
+	}
+
+	key := entry.ResourceID.String()
+	if caseID := changeID(entry.Changes, "case_id"); caseID != nil {
+		key = "case:" + caseID.String()
+	}
+
+	seen := r.seen[entry.ActorID]
+	if seen == nil {
+		seen = make(map[string]time.Time)
+		r.seen[entry.ActorID] = seen
+	}
+	seen[key] = entry.Timestamp
+	for k, t := range seen {
+		if entry.Timestamp.Sub(t) > r.Window {
+			delete(seen, k)
+		}
+	}
+
+	if len(seen) < r.Threshold || !r.cooldown.ready(entry.ActorID.String(), entry.Timestamp, r.Window) {
+		return nil
+	}
+
+	alert := newAlert(r.Name(), AlertSeverityHigh, entry,
+		fmt.Sprintf("Worker read the data of %d unrelated citizens within %s", len(seen), r.Window))
+	alert.Details = map[string]any{"unrelated_subjects": len(seen), "window": r.Window.String()}
+	return alert
+}
+
+// OffHoursRule alerts when a worker reads citizens' data outside working
+// hours or on a weekend. It alerts once per worker and day.
+type OffHoursRule struct {
+	StartHour int
+	EndHour   int
+	Location  *time.Location
+
+	cooldown cooldown
+}
+
+func (r *OffHoursRule) Name() string { return "off_hours_access" }
+
+func (r *OffHoursRule) Check(entry *AuditEntry) *Alert {
+	if entry.Action != ActionDataAccessed || entry.ActorType != ActorTypeWorker {
+		return nil
+	}
+
+	local := entry.Timestamp.In(r.Location)
+	weekend := local.Weekday() == time.Saturday || local.Weekday() == time.Sunday
+	if !weekend && local.Hour() >= r.StartHour && local.Hour() < r.EndHour {
+		return nil
+	}
+
+	day := entry.ActorID.String() + "/" + local.Format("2006-01-02")
+	if !r.cooldown.ready(day, entry.Timestamp, 24*time.Hour) {
+		return nil
+	}
+
+	alert := newAlert(r.Name(), AlertSeverityMedium, entry,
+		fmt.Sprintf("Worker read citizens' data outside working hours (%s)", local.Format("Mon 15:04")))
+	alert.Details = map[string]any{"local_time": local.Format(time.RFC3339)}
+	return alert
+}
+
+// deniedActions are actions recording an attempt that was refused
+var deniedActions = map[string]bool{
+	ActionLoginFailed:                   true,
+	ActionAccessDenied:                  true,
+	privacy.AuditActionAIAccessDenied:   true,
+	privacy.AuditActionDepseudoRejected: true,
+}
+
+// DeniedAttemptsRule alerts on repeated denied attempts by one actor
+type DeniedAttemptsRule struct {
+	Threshold int
+	Window    time.Duration
+
+	attempts slidingWindow
+	cooldown cooldown
+}
+
+func (r *DeniedAttemptsRule) Name() string { return "denied_attempts" }
+
+func (r *DeniedAttemptsRule) Check(entry *AuditEntry) *Alert {
+	if !deniedActions[entry.Action] {
+		return nil
+	}
+
+	// Unauthenticated attempts are told apart by address
+	key := entry.ActorID.String()
+	if entry.ActorID == anonymousActorID && entry.ActorIP != "" {
+		key = "ip:" + entry.ActorIP
+	}
+	ids := r.attempts.add(key, entry, r.Window)
+	if len(ids) < r.Threshold || !r.cooldown.ready(key, entry.Timestamp, r.Window) {
+		return nil
+	}
+
+	alert := newAlert(r.Name(), AlertSeverityHigh, entry,
+		fmt.Sprintf("%d denied attempts within %s", len(ids), r.Window))
+	alert.EntryIDs = ids
+	if entry.ActorIP != "" {
+		alert.Details = map[string]any{"ip": entry.ActorIP}
+	}
+	return alert
+}
+
+// PIIViolationRule alerts on personal data detected by the privacy guard.
+// Repeated violations on the same path are reported once per cooldown.
+type PIIViolationRule struct {
+	Cooldown time.Duration
+
+	cooldown cooldown
+}
+
+func (r *PIIViolationRule) Name() string { return "pii_violation" }
+
+func (r *PIIViolationRule) Check(entry *AuditEntry) *Alert {
+	var severity AlertSeverity
+	switch entry.Action {
+	case privacy.AuditActionPIIViolationBlocked:
+		severity = AlertSeverityHigh
+	case privacy.AuditActionPIIViolationDetected:
+		// Detected but not blocked: the data may have reached the central system
+		severity = AlertSeverityCritical
+	default:
+		return nil
+	}
+
+	path, _ := entry.Changes["request_path"].(string)
+	field, _ := entry.Changes["field"].(string)
+	if !r.cooldown.ready(entry.Action+"/"+path+"/"+field, entry.Timestamp, r.Cooldown) {
+		return nil
+	}
+
+	alert := newAlert(r.Name(), severity, entry,
+		fmt.Sprintf("Personal data (%s) detected in %s", field, path))
+	alert.Details = map[string]any{
+		"field":        field,
+		"request_path": path,
+		"blocked":      entry.Action == privacy.AuditActionPIIViolationBlocked,
+	}
+	return alert
+}
+
+// BulkDownloadRule alerts when one actor downloads many documents in a short time
+type BulkDownloadRule struct {
+	Threshold int
+	Window    time.Duration
+
+	downloads slidingWindow
+	cooldown  cooldown
+}
+
+func (r *BulkDownloadRule) Name() string { return "bulk_download" }
+
+func (r *BulkDownloadRule) Check(entry *AuditEntry) *Alert {
+	download := entry.Action == ActionDocumentDownloaded
+	if entry.Action == ActionDataAccessed {
+		resourceType, _ := entry.Changes["resource_type"].(string)
+		download = resourceType == "document"
+	}
+	if !download {
+		return nil
+	}
+
+	key := entry.ActorID.String()
+	ids := r.downloads.add(key, entry, r.Window)
+	if len(ids) < r.Threshold || !r.cooldown.ready(key, entry.Timestamp, r.Window) {
+		return nil
+	}
+
+	alert := newAlert(r.Name(), AlertSeverityHigh, entry,
+		fmt.Sprintf("%d document downloads within %s", len(ids), r.Window))
+	alert.EntryIDs = ids
+	return alert
+}
+
+// slidingWindow keeps the entries of each key within a time window
+type slidingWindow struct {
+	entries map[string][]windowEntry
+}
+
+type windowEntry struct {
+	id types.ID
+	at time.Time
+}
+
+// add records an entry and returns the IDs of the key's entries within the window
+func (w *slidingWindow) add(key string, entry *AuditEntry, window time.Duration) []types.ID {
+	if w.entries == nil {
+		w.entries = make(map[string][]windowEntry)
+	}
+
+	kept := w.entries[key][:0]
+	for _, e := range w.entries[key] {
+		if entry.Timestamp.Sub(e.at) <= window {
+			kept = append(kept, e)
+		}
+	}
+	kept = append(kept, windowEntry{id: entry.ID, at: entry.Timestamp})
+	w.entries[key] = kept
+
+	ids := make([]types.ID, len(kept))
+	for i, e := range kept {
+		ids[i] = e.id
+	}
+	return ids
+}
+
+// cooldown suppresses repeated alerts for the same key
+type cooldown struct {
+	last map[string]time.Time
+}
+
+// ready reports whether an alert may be raised for key at time t, and if so
+// starts a new cooldown period
+func (c *cooldown) ready(key string, t time.Time, period time.Duration) bool {
+	if c.last == nil {
+		c.last = make(map[string]time.Time)
+	}
+	if last, ok := c.last[key]; ok && t.Sub(last) < period {
+		return false
+	}
+	c.last[key] = t
+	return true
+}
+
+// AlertEngine evaluates alert rules against new audit entries
+type AlertEngine struct {
+	repo  AuditRepository
+	rules []AlertRule
+	alert func(ctx context.Context, alert *Alert)
+
+	mu       sync.Mutex
+	position int64 // last evaluated sequence
+	started  bool
+}
+
+// NewAlertEngine creates a new alert engine
+func NewAlertEngine(repo AuditRepository, rules ...AlertRule) *AlertEngine {
+	return &AlertEngine{
+		repo:  repo,
+		rules: rules,
+		alert: func(ctx context.Context, alert *Alert) {
+			fmt.Printf("ALERT: audit %s: %s\n", alert.Rule, alert.Summary)
+		},
+	}
+}
+
+// SetAlertHandler sets the function that receives alerts
+func (e *AlertEngine) SetAlertHandler(fn func(ctx context.Context, alert *Alert)) {
+	e.alert = fn
+}
+
+// Start evaluates entries appended from now on until the context is cancelled
+func (e *AlertEngine) Start(ctx context.Context, interval time.Duration) {
+	e.mu.Lock()
+	if !e.started {
+		e.position = e.repo.GetSequence()
+		e.started = true
+	}
+	e.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Process(ctx); err != nil {
+				fmt.Printf("Warning: audit alert evaluation failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// Process evaluates the rules against entries appended since the last call
+func (e *AlertEngine) Process(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for {
+		entries, err := e.repo.ReadEntries(ctx, e.position+1, indexSyncBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			for _, rule := range e.rules {
+				if alert := rule.Check(entry); alert != nil {
+					e.alert(ctx, alert)
+				}
+			}
+			e.position = entry.Sequence
+		}
+
+		if len(entries) < indexSyncBatch {
+			return nil
+		}
+	}
+}
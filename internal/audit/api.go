@@ -2,12 +2,14 @@ package audit
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	roles "github.com/serbia-gov/platform/internal/auth"
 	"github.com/serbia-gov/platform/internal/shared/auth"
 	"github.com/serbia-gov/platform/internal/shared/errors"
 	"github.com/serbia-gov/platform/internal/shared/types"
@@ -17,27 +19,40 @@ import (
 type Handler struct {
 	repo               AuditRepository
 	checkpointService  *CheckpointService
+	corrections        *CorrectionService
+	accessReports      *AccessReportService // nil when access reports are not available
+	alerts             AlertStore           // nil when alerting is not enabled
 	devMode            bool
 }
 
-// NewHandler creates a new audit handler
-func NewHandler(repo AuditRepository) *Handler {
+// NewHandler creates a new audit handler. If checkpointService is nil,
+// checkpoints are witnessed locally.
+func NewHandler(repo AuditRepository, checkpointService *CheckpointService) *Handler {
 	env := os.Getenv("ENV")
 	devMode := env == "" || env == "development" || env == "dev"
 
-	// Create checkpoint service with local witness for now
-	// In production, this would be configured via TSA settings to use
-	// RFC3161Witness, MultiAgencyWitness, or CompositeWitness
-	witness := NewLocalWitness()
-	checkpointService := NewCheckpointService(repo, witness)
+	if checkpointService == nil {
+		checkpointService = NewCheckpointService(repo, NewLocalWitness())
+	}
 
 	return &Handler{
 		repo:              repo,
 		checkpointService: checkpointService,
+		corrections:       NewCorrectionService(repo),
 		devMode:           devMode,
 	}
 }
 
+// SetAccessReports enables data-subject access reports
+func (h *Handler) SetAccessReports(service *AccessReportService) {
+	h.accessReports = service
+}
+
+// SetAlerts enables the alerts API
+func (h *Handler) SetAlerts(store AlertStore) {
+	h.alerts = store
+}
+
 // Routes registers the audit routes
 func (h *Handler) Routes() chi.Router {
 	r := chi.NewRouter()
@@ -46,16 +61,39 @@ func (h *Handler) Routes() chi.Router {
 	r.Get("/", h.ListEntries)
 	r.Get("/verify", h.VerifyChain)
 	r.Get("/resource/{resourceType}/{resourceID}", h.GetByResource)
+	r.Get("/entries/{entryID}/proof", h.GetInclusionProof)
+
+	// Corrections: requested by a supervisor, approved by a second one
+	r.Get("/entries/{entryID}/corrections", h.ListCorrections)
+	r.Post("/entries/{entryID}/corrections", h.RequestCorrection)
+	r.Post("/corrections/{requestID}/approve", h.ApproveCorrection)
+	r.Post("/corrections/{requestID}/reject", h.RejectCorrection)
+
+	// Bulk JSON Lines export for SIEM import
+	r.Get("/export", h.ExportEntries)
+
+	// Data-subject access report (POST keeps the JMBG out of URLs and logs)
+	r.Post("/subject-access-report", h.SubjectAccessReport)
 
 	// Checkpoint endpoints (external witness for tamper evidence)
 	r.Route("/checkpoints", func(r chi.Router) {
 		r.Get("/", h.ListCheckpoints)
 		r.Post("/", h.CreateCheckpoint)
 		r.Get("/latest", h.GetLatestCheckpoint)
+		r.Get("/consistency", h.GetConsistencyProof)
+		r.Get("/export", h.ExportCheckpoints)
 		r.Get("/{checkpointID}", h.GetCheckpoint)
 		r.Get("/{checkpointID}/verify", h.VerifyCheckpoint)
 	})
 
+	// Alerts raised by audit stream rules (security auditors)
+	r.Route("/alerts", func(r chi.Router) {
+		r.Get("/", h.ListAlerts)
+		r.Get("/{alertID}", h.GetAlert)
+		r.Post("/{alertID}/acknowledge", h.AcknowledgeAlert)
+		r.Post("/{alertID}/resolve", h.ResolveAlert)
+	})
+
 	// Entry by ID (must be after /verify and /checkpoints to avoid conflicts)
 	r.Get("/{entryID}", h.GetEntry)
 
@@ -135,8 +173,14 @@ func (h *Handler) ListEntries(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	withCorrections, err := h.corrections.WithCorrections(r.Context(), entries)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
 	writeJSON(w, http.StatusOK, map[string]any{
-		"data":  entries,
+		"data":  withCorrections,
 		"total": total,
 	})
 }
@@ -164,7 +208,13 @@ func (h *Handler) GetEntry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, http.StatusOK, entry)
+	corrections, err := h.corrections.Applied(r.Context(), entry.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, EntryWithCorrections{AuditEntry: entry, Corrections: corrections})
 }
 
 // VerifyChain verifies the integrity of the audit chain
@@ -361,6 +411,452 @@ func (h *Handler) VerifyCheckpoint(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, result)
 }
 
+// --- Merkle Proof Handlers ---
+
+// GetInclusionProof proves that an entry is included in a checkpoint's Merkle
+// tree. The checkpoint defaults to the latest one.
+func (h *Handler) GetInclusionProof(w http.ResponseWriter, r *http.Request) {
+	if !h.devMode {
+		user := auth.GetUser(r.Context())
+		if user == nil || !user.IsAdmin() {
+			writeError(w, errors.Forbidden("admin access required"))
+			return
+		}
+	}
+
+	entryID, err := types.ParseID(chi.URLParam(r, "entryID"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid entry ID"))
+		return
+	}
+
+	var checkpointID *types.ID
+	if c := r.URL.Query().Get("checkpoint"); c != "" {
+		id, err := types.ParseID(c)
+		if err != nil {
+			writeError(w, errors.BadRequest("invalid checkpoint ID"))
+			return
+		}
+		checkpointID = &id
+	}
+
+	proof, err := h.checkpointService.InclusionProof(r.Context(), entryID, checkpointID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, proof)
+}
+
+// GetConsistencyProof proves that the tree of checkpoint "to" is an
+// append-only extension of the tree of checkpoint "from". "to" defaults to
+// the latest checkpoint.
+func (h *Handler) GetConsistencyProof(w http.ResponseWriter, r *http.Request) {
+	if !h.devMode {
+		user := auth.GetUser(r.Context())
+		if user == nil || !user.IsAdmin() {
+			writeError(w, errors.Forbidden("admin access required"))
+			return
+		}
+	}
+
+	fromID, err := types.ParseID(r.URL.Query().Get("from"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid or missing from checkpoint ID"))
+		return
+	}
+
+	var toID *types.ID
+	if t := r.URL.Query().Get("to"); t != "" {
+		id, err := types.ParseID(t)
+		if err != nil {
+			writeError(w, errors.BadRequest("invalid to checkpoint ID"))
+			return
+		}
+		toID = &id
+	}
+
+	proof, err := h.checkpointService.ConsistencyProof(r.Context(), fromID, toID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, proof)
+}
+
+// SubjectAccessReportRequest requests the access report of a citizen
+type SubjectAccessReportRequest struct {
+	JMBG   string     `json:"jmbg"`
+	From   *time.Time `json:"from,omitempty"`
+	To     *time.Time `json:"to,omitempty"`
+	Format string     `json:"format,omitempty"` // json (default) or pdf
+}
+
+// SubjectAccessReport reports every recorded read of a citizen's data
+func (h *Handler) SubjectAccessReport(w http.ResponseWriter, r *http.Request) {
+	if !h.devMode {
+		user := auth.GetUser(r.Context())
+		if user == nil || !user.IsAdmin() {
+			writeError(w, errors.Forbidden("admin access required"))
+			return
+		}
+	}
+
+	if h.accessReports == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "access reports are not configured"})
+		return
+	}
+
+	var req SubjectAccessReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+	if req.Format != "" && req.Format != "json" && req.Format != "pdf" {
+		writeError(w, errors.BadRequest("format must be json or pdf"))
+		return
+	}
+
+	report, err := h.accessReports.Generate(r.Context(), req.JMBG, req.From, req.To)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if req.Format != "pdf" {
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+
+	pdf, err := report.RenderPDF()
+	if err != nil {
+		writeError(w, errors.Internal(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(pdf)
+}
+
+// --- Correction Handlers ---
+
+// RejectCorrectionRequest is the request body for rejecting a correction
+type RejectCorrectionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ListCorrections lists the correction requests of an entry with their status
+func (h *Handler) ListCorrections(w http.ResponseWriter, r *http.Request) {
+	if !h.devMode {
+		user := auth.GetUser(r.Context())
+		if user == nil || !user.IsAdmin() {
+			writeError(w, errors.Forbidden("admin access required"))
+			return
+		}
+	}
+
+	id, err := types.ParseID(chi.URLParam(r, "entryID"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid entry ID"))
+		return
+	}
+
+	requests, err := h.corrections.Requests(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data":  requests,
+		"total": len(requests),
+	})
+}
+
+// RequestCorrection requests a correction of an entry. Corrections need a
+// supervisor in every environment, so dev mode does not skip the check.
+func (h *Handler) RequestCorrection(w http.ResponseWriter, r *http.Request) {
+	id, err := types.ParseID(chi.URLParam(r, "entryID"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid entry ID"))
+		return
+	}
+
+	var input CorrectionInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+
+	request, err := h.corrections.Request(r.Context(), auth.GetUser(r.Context()), id, input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, request)
+}
+
+// ApproveCorrection approves a pending correction request, appending the correction entry
+func (h *Handler) ApproveCorrection(w http.ResponseWriter, r *http.Request) {
+	id, err := types.ParseID(chi.URLParam(r, "requestID"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid correction request ID"))
+		return
+	}
+
+	entry, err := h.corrections.Approve(r.Context(), auth.GetUser(r.Context()), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, entry)
+}
+
+// RejectCorrection rejects a pending correction request
+func (h *Handler) RejectCorrection(w http.ResponseWriter, r *http.Request) {
+	id, err := types.ParseID(chi.URLParam(r, "requestID"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid correction request ID"))
+		return
+	}
+
+	var req RejectCorrectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+
+	request, err := h.corrections.Reject(r.Context(), auth.GetUser(r.Context()), id, req.Reason)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, request)
+}
+
+// ExportEntries streams the entries of a time range as JSON Lines for bulk
+// SIEM import. An interrupted export is resumed with after_sequence set to
+// the sequence of the last line received.
+func (h *Handler) ExportEntries(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorizeAuditor(w, r); !ok {
+		return
+	}
+
+	from, err := time.Parse(time.RFC3339, r.URL.Query().Get("from"))
+	if err != nil {
+		writeError(w, errors.BadRequest("from must be an RFC 3339 time"))
+		return
+	}
+	to, err := time.Parse(time.RFC3339, r.URL.Query().Get("to"))
+	if err != nil {
+		writeError(w, errors.BadRequest("to must be an RFC 3339 time"))
+		return
+	}
+	if to.Before(from) {
+		writeError(w, errors.BadRequest("to must not be before from"))
+		return
+	}
+
+	var afterSequence int64
+	if after := r.URL.Query().Get("after_sequence"); after != "" {
+		afterSequence, err = strconv.ParseInt(after, 10, 64)
+		if err != nil || afterSequence < 0 {
+			writeError(w, errors.BadRequest("invalid after_sequence"))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-%s-%s.jsonl"`,
+		from.UTC().Format("20060102T150405Z"), to.UTC().Format("20060102T150405Z")))
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are sent; a failure shows as a truncated export, which the
+	// client resumes from its last sequence
+	if _, err := ExportJSONLines(r.Context(), h.repo, w, from, to, afterSequence); err != nil {
+		fmt.Printf("Warning: audit export interrupted: %v\n", err)
+	}
+}
+
+// ExportCheckpoints exports all checkpoints as JSON Lines, oldest first,
+// for offline verification with an entry export
+func (h *Handler) ExportCheckpoints(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorizeAuditor(w, r); !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit-checkpoints.jsonl"`)
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := h.checkpointService.ExportCheckpoints(r.Context(), w); err != nil {
+		fmt.Printf("Warning: checkpoint export interrupted: %v\n", err)
+	}
+}
+
+// ResolveAlertRequest is the request body for resolving an alert
+type ResolveAlertRequest struct {
+	Resolution string `json:"resolution"`
+}
+
+// ListAlerts lists alerts, newest first
+func (h *Handler) ListAlerts(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorizeAlerts(w, r); !ok {
+		return
+	}
+
+	filter := AlertFilter{
+		Status:   AlertStatus(r.URL.Query().Get("status")),
+		Severity: AlertSeverity(r.URL.Query().Get("severity")),
+		Rule:     r.URL.Query().Get("rule"),
+	}
+
+	if actorID := r.URL.Query().Get("actor_id"); actorID != "" {
+		id := types.ID(actorID)
+		filter.ActorID = &id
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		if l, err := strconv.Atoi(limit); err == nil {
+			filter.Limit = l
+		}
+	}
+
+	if offset := r.URL.Query().Get("offset"); offset != "" {
+		if o, err := strconv.Atoi(offset); err == nil {
+			filter.Offset = o
+		}
+	}
+
+	alerts, total, err := h.alerts.List(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data":  alerts,
+		"total": total,
+	})
+}
+
+// GetAlert gets an alert by ID
+func (h *Handler) GetAlert(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorizeAlerts(w, r); !ok {
+		return
+	}
+
+	alert, err := h.findAlert(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, alert)
+}
+
+// AcknowledgeAlert marks an alert as being looked into
+func (h *Handler) AcknowledgeAlert(w http.ResponseWriter, r *http.Request) {
+	by, ok := h.authorizeAlerts(w, r)
+	if !ok {
+		return
+	}
+
+	alert, err := h.findAlert(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := alert.Acknowledge(by); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.alerts.Update(r.Context(), alert); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, alert)
+}
+
+// ResolveAlert closes an alert with the outcome of the investigation
+func (h *Handler) ResolveAlert(w http.ResponseWriter, r *http.Request) {
+	by, ok := h.authorizeAlerts(w, r)
+	if !ok {
+		return
+	}
+
+	var req ResolveAlertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+
+	alert, err := h.findAlert(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := alert.Resolve(by, req.Resolution); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.alerts.Update(r.Context(), alert); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, alert)
+}
+
+// authorizeAlerts allows security auditors to use the alerts API
+// and returns the ID of the caller. It writes the error response on failure.
+func (h *Handler) authorizeAlerts(w http.ResponseWriter, r *http.Request) (types.ID, bool) {
+	by, ok := h.authorizeAuditor(w, r)
+	if !ok {
+		return "", false
+	}
+
+	if h.alerts == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "audit alerts are not enabled"})
+		return "", false
+	}
+
+	return by, true
+}
+
+// authorizeAuditor allows admins and security auditors (anyone in dev mode)
+// and returns the ID of the caller. It writes the error response on failure.
+func (h *Handler) authorizeAuditor(w http.ResponseWriter, r *http.Request) (types.ID, bool) {
+	user := auth.GetUser(r.Context())
+	if !h.devMode && (user == nil || (!user.IsAdmin() && !user.HasRole(string(roles.RoleSecurityAuditor)))) {
+		writeError(w, errors.Forbidden("security auditor access required"))
+		return "", false
+	}
+
+	if user == nil {
+		return anonymousActorID, true
+	}
+	return user.ID, true
+}
+
+func (h *Handler) findAlert(r *http.Request) (*Alert, error) {
+	id, err := types.ParseID(chi.URLParam(r, "alertID"))
+	if err != nil {
+		return nil, errors.BadRequest("invalid alert ID")
+	}
+	return h.alerts.Get(r.Context(), id)
+}
+
 // --- Helpers ---
 
 func writeJSON(w http.ResponseWriter, status int, data any) {
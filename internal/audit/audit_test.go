@@ -1,10 +1,45 @@
 package audit
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/serbia-gov/platform/internal/adapters/health"
+	"github.com/serbia-gov/platform/internal/federation/gateway"
+	"github.com/serbia-gov/platform/internal/privacy"
+	"github.com/serbia-gov/platform/internal/shared/auth"
+	"github.com/serbia-gov/platform/internal/shared/config"
+	"github.com/serbia-gov/platform/internal/shared/database"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/events"
 	"github.com/serbia-gov/platform/internal/shared/types"
+	"github.com/serbia-gov/platform/internal/tsa"
 )
 
 // TestNewAuditEntry tests creating a new audit entry
@@ -429,3 +464,2217 @@ func TestActorTypes(t *testing.T) {
 		})
 	}
 }
+
+// referenceRoot computes MTH(D[0:n]) directly from RFC 6962 section 2.1
+func referenceRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	case 1:
+		return HashLeaf(leaves[0])
+	}
+	k := splitPoint(int64(len(leaves)))
+	return HashChildren(referenceRoot(leaves[:k]), referenceRoot(leaves[k:]))
+}
+
+func testTree(n int) (*MerkleTree, [][]byte) {
+	tree := NewMerkleTree()
+	var leaves [][]byte
+	for i := 0; i < n; i++ {
+		data := []byte{byte(i), byte(i >> 8)}
+		tree.Append(data)
+		leaves = append(leaves, data)
+	}
+	return tree, leaves
+}
+
+// TestMerkleTreeRFC6962Vectors checks roots against the RFC 6962 reference test vectors
+func TestMerkleTreeRFC6962Vectors(t *testing.T) {
+	inputs := []string{"", "00", "10", "2021", "3031", "40414243", "5051525354555657", "606162636465666768696a6b6c6d6e6f"}
+	roots := []string{
+		"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+		"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+		"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+		"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+		"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+		"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+	}
+
+	tree := NewMerkleTree()
+	if got := hex.EncodeToString(tree.Root()); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("Empty tree root: got %s", got)
+	}
+
+	for i, in := range inputs {
+		data, _ := hex.DecodeString(in)
+		tree.Append(data)
+		if got := hex.EncodeToString(tree.Root()); got != roots[i] {
+			t.Errorf("Root of %d leaves: expected %s, got %s", i+1, roots[i], got)
+		}
+	}
+
+	// Earlier roots remain available after the tree grows
+	for i := range roots {
+		root, err := tree.RootAt(int64(i + 1))
+		if err != nil || hex.EncodeToString(root) != roots[i] {
+			t.Errorf("RootAt(%d) mismatch: %v", i+1, err)
+		}
+	}
+}
+
+// TestMerkleInclusionProofs tests inclusion proofs for every leaf of trees up to 33 leaves
+func TestMerkleInclusionProofs(t *testing.T) {
+	tree, leaves := testTree(33)
+
+	for size := int64(1); size <= tree.Size(); size++ {
+		root := referenceRoot(leaves[:size])
+		if got, _ := tree.RootAt(size); !bytes.Equal(got, root) {
+			t.Fatalf("RootAt(%d) does not match reference root", size)
+		}
+
+		for index := int64(0); index < size; index++ {
+			proof, err := tree.InclusionProof(index, size)
+			if err != nil {
+				t.Fatalf("InclusionProof(%d, %d): %v", index, size, err)
+			}
+			leaf := HashLeaf(leaves[index])
+			if err := VerifyInclusion(leaf, index, size, proof, root); err != nil {
+				t.Errorf("Valid proof for leaf %d in tree %d rejected: %v", index, size, err)
+			}
+
+			// A proof for one leaf must not verify another
+			if size > 1 {
+				other := HashLeaf(leaves[(index+1)%size])
+				if err := VerifyInclusion(other, index, size, proof, root); err == nil {
+					t.Errorf("Proof for leaf %d in tree %d accepted wrong leaf", index, size)
+				}
+			}
+			if len(proof) > 0 {
+				proof[0] = HashLeaf([]byte("tampered"))
+				if err := VerifyInclusion(leaf, index, size, proof, root); err == nil {
+					t.Errorf("Tampered proof for leaf %d in tree %d accepted", index, size)
+				}
+				if err := VerifyInclusion(leaf, index, size, proof[1:], root); err == nil {
+					t.Errorf("Truncated proof for leaf %d in tree %d accepted", index, size)
+				}
+			}
+		}
+	}
+
+	if _, err := tree.InclusionProof(5, 5); err == nil {
+		t.Error("Expected error for leaf outside tree")
+	}
+	if _, err := tree.InclusionProof(0, 34); err == nil {
+		t.Error("Expected error for tree larger than log")
+	}
+}
+
+// TestMerkleConsistencyProofs tests consistency proofs between all tree sizes up to 33
+func TestMerkleConsistencyProofs(t *testing.T) {
+	tree, leaves := testTree(33)
+
+	for newSize := int64(1); newSize <= tree.Size(); newSize++ {
+		newRoot := referenceRoot(leaves[:newSize])
+		for oldSize := int64(1); oldSize <= newSize; oldSize++ {
+			oldRoot := referenceRoot(leaves[:oldSize])
+
+			proof, err := tree.ConsistencyProof(oldSize, newSize)
+			if err != nil {
+				t.Fatalf("ConsistencyProof(%d, %d): %v", oldSize, newSize, err)
+			}
+			if err := VerifyConsistency(oldSize, newSize, oldRoot, newRoot, proof); err != nil {
+				t.Errorf("Valid consistency proof %d -> %d rejected: %v", oldSize, newSize, err)
+			}
+
+			if oldSize < newSize {
+				// A rewritten history must not verify
+				forked := HashLeaf([]byte("forked"))
+				if err := VerifyConsistency(oldSize, newSize, forked, newRoot, proof); err == nil {
+					t.Errorf("Consistency proof %d -> %d accepted wrong old root", oldSize, newSize)
+				}
+				if err := VerifyConsistency(oldSize, newSize, oldRoot, forked, proof); err == nil {
+					t.Errorf("Consistency proof %d -> %d accepted wrong new root", oldSize, newSize)
+				}
+				if err := VerifyConsistency(oldSize, newSize, oldRoot, newRoot, proof[:len(proof)-1]); err == nil {
+					t.Errorf("Truncated consistency proof %d -> %d accepted", oldSize, newSize)
+				}
+			}
+		}
+	}
+
+	if _, err := tree.ConsistencyProof(5, 4); err == nil {
+		t.Error("Expected error when old tree is larger than new tree")
+	}
+}
+
+// TestEntryLeafHash tests that audit entries map to Merkle leaves via their content hash
+func TestEntryLeafHash(t *testing.T) {
+	entry := NewAuditEntry(ActorTypeSystem, types.NewID(), nil, ActionCaseCreated, "case", nil, nil, "")
+
+	leaf, err := EntryLeafHash(entry.Hash)
+	if err != nil {
+		t.Fatalf("EntryLeafHash failed: %v", err)
+	}
+
+	raw, _ := hex.DecodeString(entry.Hash)
+	if !bytes.Equal(leaf, HashLeaf(raw)) {
+		t.Error("Leaf hash should be the RFC 6962 leaf hash of the entry hash")
+	}
+
+	if _, err := EntryLeafHash("not-a-hash"); err == nil {
+		t.Error("Expected error for invalid entry hash")
+	}
+
+	proof, err := DecodeProof(encodeProof([][]byte{leaf}))
+	if err != nil || !bytes.Equal(proof[0], leaf) {
+		t.Error("Proof encoding should round-trip")
+	}
+}
+
+// memRepository is an in-memory AuditRepository for checkpoint tests
+type memRepository struct {
+	entries     []*AuditEntry
+	checkpoints []Checkpoint
+}
+
+func (r *memRepository) Initialize(ctx context.Context) error { return nil }
+
+func (r *memRepository) Append(ctx context.Context, entry *AuditEntry) error {
+	entry.Sequence = int64(len(r.entries)) + 1
+	entry.PrevHash = r.GetLastHash()
+	entry.Hash = entry.ComputeHash()
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *memRepository) FindByID(ctx context.Context, id types.ID) (*AuditEntry, error) {
+	for _, e := range r.entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("not found")
+}
+
+func (r *memRepository) List(ctx context.Context, filter ListEntriesFilter) ([]*AuditEntry, int, error) {
+	var matched []*AuditEntry
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		if filter.matches(newIndexPointer(r.entries[i])) {
+			matched = append(matched, r.entries[i])
+		}
+	}
+	page := matched[min(filter.Offset, len(matched)):]
+	if filter.Limit > 0 && len(page) > filter.Limit {
+		page = page[:filter.Limit]
+	}
+	return page, len(matched), nil
+}
+
+func (r *memRepository) GetByResource(ctx context.Context, resourceType string, resourceID types.ID, limit int) ([]*AuditEntry, error) {
+	entries, _, err := r.List(ctx, ListEntriesFilter{ResourceType: resourceType, ResourceID: &resourceID, Limit: limit})
+	return entries, err
+}
+
+func (r *memRepository) GetByResources(ctx context.Context, resourceType string, resourceIDs []types.ID, limit int) (map[types.ID][]*AuditEntry, error) {
+	result := make(map[types.ID][]*AuditEntry)
+	for _, id := range resourceIDs {
+		entries, err := r.GetByResource(ctx, resourceType, id, limit)
+		if err != nil {
+			return nil, err
+		}
+		result[id] = entries
+	}
+	return result, nil
+}
+
+func (r *memRepository) ReadEntries(ctx context.Context, fromSequence int64, limit int) ([]*AuditEntry, error) {
+	start := min(int(fromSequence-1), len(r.entries))
+	end := min(start+limit, len(r.entries))
+	return r.entries[start:end], nil
+}
+
+func (r *memRepository) VerifyChain(ctx context.Context, limit int, includeDetails bool) (*VerifyResult, error) {
+	return &VerifyResult{Valid: true}, nil
+}
+
+func (r *memRepository) GetLastHash() string {
+	if len(r.entries) == 0 {
+		return ""
+	}
+	return r.entries[len(r.entries)-1].Hash
+}
+
+func (r *memRepository) GetSequence() int64 { return int64(len(r.entries)) }
+
+func (r *memRepository) Count(ctx context.Context) (int, error) { return len(r.entries), nil }
+
+func (r *memRepository) SaveCheckpoint(ctx context.Context, checkpoint *Checkpoint) error {
+	r.checkpoints = append(r.checkpoints, *checkpoint)
+	return nil
+}
+
+func (r *memRepository) GetLatestCheckpoint(ctx context.Context) (*Checkpoint, error) {
+	if len(r.checkpoints) == 0 {
+		return nil, nil
+	}
+	cp := r.checkpoints[len(r.checkpoints)-1]
+	return &cp, nil
+}
+
+func (r *memRepository) ListCheckpoints(ctx context.Context, limit int) ([]Checkpoint, error) {
+	return r.checkpoints, nil
+}
+
+func (r *memRepository) GetCheckpoint(ctx context.Context, id types.ID) (*Checkpoint, error) {
+	for _, cp := range r.checkpoints {
+		if cp.ID == id {
+			return &cp, nil
+		}
+	}
+	return nil, fmt.Errorf("not found")
+}
+
+// eventStoreServer is an in-memory EventStoreDB HTTP API for HTTPRepository tests
+type eventStoreServer struct {
+	mu      sync.Mutex
+	streams map[string][]events.RecordedEvent
+	served  map[string]int // events returned per stream
+}
+
+func newEventStoreServer(t *testing.T) (*eventStoreServer, *events.HTTPClient) {
+	s := &eventStoreServer{
+		streams: make(map[string][]events.RecordedEvent),
+		served:  make(map[string]int),
+	}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	portNum, _ := strconv.Atoi(port)
+	return s, events.NewHTTPClient(config.KurrentDBConfig{Host: host, Port: portNum, Insecure: true})
+}
+
+func (s *eventStoreServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/streams/"), "/")
+	name := parts[0]
+
+	if r.Method == http.MethodPost {
+		var appended []struct {
+			EventID   string          `json:"eventId"`
+			EventType string          `json:"eventType"`
+			Data      json.RawMessage `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&appended); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, e := range appended {
+			s.streams[name] = append(s.streams[name], events.RecordedEvent{
+				EventID:     e.EventID,
+				EventType:   e.EventType,
+				EventNumber: int64(len(s.streams[name])),
+				Data:        e.Data,
+				StreamID:    name,
+			})
+		}
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	stream, ok := s.streams[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// head/{count}, head/backward/{count} or {start}/{direction}/{count}
+	start, backward := int64(len(stream)-1), true
+	if parts[1] != "head" {
+		start, _ = strconv.ParseInt(parts[1], 10, 64)
+		backward = parts[2] == "backward"
+	}
+	count, _ := strconv.Atoi(parts[len(parts)-1])
+
+	var entries []map[string]any
+	for i := start; i >= 0 && i < int64(len(stream)) && len(entries) < count; {
+		e := stream[i]
+		entries = append(entries, map[string]any{
+			"eventId":     e.EventID,
+			"eventType":   e.EventType,
+			"eventNumber": e.EventNumber,
+			"data":        string(e.Data),
+			"streamId":    e.StreamID,
+		})
+		if backward {
+			i--
+		} else {
+			i++
+		}
+	}
+	s.served[name] += len(entries)
+
+	json.NewEncoder(w).Encode(map[string]any{"entries": entries})
+}
+
+// servedFrom returns the number of events read from a stream
+func (s *eventStoreServer) servedFrom(stream string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.served[stream]
+}
+
+// eventCount returns the number of events in a stream
+func (s *eventStoreServer) eventCount(stream string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams[stream])
+}
+
+func appendEntries(t *testing.T, repo AuditRepository, n int) []*AuditEntry {
+	t.Helper()
+	var entries []*AuditEntry
+	for i := 0; i < n; i++ {
+		resourceID := types.NewID()
+		entry := NewAuditEntry(ActorTypeSystem, types.NewID(), nil, ActionCaseCreated, "case", &resourceID, nil, "")
+		if err := repo.Append(context.Background(), entry); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// TestCheckpointMerkleProofs tests that checkpoints commit to the Merkle root and serve verifiable proofs
+func TestCheckpointMerkleProofs(t *testing.T) {
+	ctx := context.Background()
+	repo := &memRepository{}
+	service := NewCheckpointService(repo, NewLocalWitness())
+
+	if _, err := service.CreateCheckpoint(ctx); err == nil {
+		t.Error("Expected error when there are no entries to checkpoint")
+	}
+
+	entries := appendEntries(t, repo, 7)
+	first, err := service.CreateCheckpoint(ctx)
+	if err != nil {
+		t.Fatalf("CreateCheckpoint failed: %v", err)
+	}
+	if first.TreeSize != 7 || first.LastEntryID != entries[6].ID || first.RootHash == "" {
+		t.Errorf("Unexpected checkpoint: size %d, last entry %s", first.TreeSize, first.LastEntryID)
+	}
+
+	entries = append(entries, appendEntries(t, repo, 6)...)
+	second, err := service.CreateCheckpoint(ctx)
+	if err != nil {
+		t.Fatalf("CreateCheckpoint failed: %v", err)
+	}
+
+	// Inclusion of an early entry in the latest checkpoint
+	proof, err := service.InclusionProof(ctx, entries[2].ID, nil)
+	if err != nil {
+		t.Fatalf("InclusionProof failed: %v", err)
+	}
+	if proof.CheckpointID != second.ID || proof.TreeSize != 13 {
+		t.Errorf("Expected proof against latest checkpoint, got %s size %d", proof.CheckpointID, proof.TreeSize)
+	}
+	path, _ := DecodeProof(proof.Proof)
+	leaf, _ := hex.DecodeString(proof.LeafHash)
+	root, _ := hex.DecodeString(second.RootHash)
+	if err := VerifyInclusion(leaf, proof.LeafIndex, proof.TreeSize, path, root); err != nil {
+		t.Errorf("Inclusion proof does not verify: %v", err)
+	}
+
+	// Entries after a checkpoint are not covered by it
+	if _, err := service.InclusionProof(ctx, entries[10].ID, &first.ID); err == nil {
+		t.Error("Expected error for entry not covered by checkpoint")
+	}
+
+	consistency, err := service.ConsistencyProof(ctx, first.ID, nil)
+	if err != nil {
+		t.Fatalf("ConsistencyProof failed: %v", err)
+	}
+	path, _ = DecodeProof(consistency.Proof)
+	oldRoot, _ := hex.DecodeString(first.RootHash)
+	if err := VerifyConsistency(first.TreeSize, second.TreeSize, oldRoot, root, path); err != nil {
+		t.Errorf("Consistency proof does not verify: %v", err)
+	}
+
+	if _, err := service.ConsistencyProof(ctx, second.ID, &first.ID); err == nil {
+		t.Error("Expected error when from checkpoint is newer than to checkpoint")
+	}
+
+	result, err := service.VerifyCheckpoint(ctx, first.ID)
+	if err != nil || !result.Valid {
+		t.Errorf("Expected checkpoint to verify, got %v %v", err, result.Violations)
+	}
+
+	// Rewriting history is detected by a fresh Merkle log
+	entries[3].Action = "tampered"
+	entries[3].Hash = entries[3].ComputeHash()
+	result, err = NewCheckpointService(repo, NewLocalWitness()).VerifyCheckpoint(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("VerifyCheckpoint failed: %v", err)
+	}
+	if result.Valid || result.EntriesIntact {
+		t.Error("Expected rewritten entry to invalidate checkpoint")
+	}
+}
+
+// failingWitness fails a number of timestamp requests before succeeding
+type failingWitness struct {
+	LocalWitness
+	failures int
+	calls    int
+}
+
+func (w *failingWitness) Timestamp(ctx context.Context, hash string, lastSequence int64, entryCount int, rootHash string) ([]byte, string, error) {
+	w.calls++
+	if w.calls <= w.failures {
+		return nil, "", fmt.Errorf("witness unavailable")
+	}
+	return w.LocalWitness.Timestamp(ctx, hash, lastSequence, entryCount, rootHash)
+}
+
+// TestRetryWitness tests that failed witness calls are retried
+func TestRetryWitness(t *testing.T) {
+	inner := &failingWitness{failures: 2}
+	witness := NewRetryWitness(inner, 3, time.Millisecond)
+
+	if _, _, err := witness.Timestamp(context.Background(), "abc", 1, 1, "def"); err != nil {
+		t.Errorf("Expected success after retries, got %v", err)
+	}
+	if inner.calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", inner.calls)
+	}
+
+	inner = &failingWitness{failures: 10}
+	witness = NewRetryWitness(inner, 2, time.Millisecond)
+	if _, _, err := witness.Timestamp(context.Background(), "abc", 1, 1, "def"); err == nil {
+		t.Error("Expected error when all retries fail")
+	}
+	if inner.calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", inner.calls)
+	}
+}
+
+// TestCheckpointerSchedule tests when the checkpointer creates checkpoints and raises alerts
+func TestCheckpointerSchedule(t *testing.T) {
+	ctx := context.Background()
+	repo := &memRepository{}
+	witness := &failingWitness{}
+	checkpointer := NewCheckpointer(NewCheckpointService(repo, witness), CheckpointerConfig{
+		Interval:     time.Hour,
+		EveryEntries: 5,
+		PollInterval: time.Minute,
+	})
+
+	var alerts []CheckpointAlert
+	checkpointer.SetAlertHandler(func(ctx context.Context, alert CheckpointAlert) {
+		alerts = append(alerts, alert)
+	})
+
+	now := time.Now()
+	if checkpointer.due(now) {
+		t.Error("Nothing to checkpoint without entries")
+	}
+
+	appendEntries(t, repo, 3)
+	if !checkpointer.due(now) {
+		t.Error("First checkpoint should be due as soon as there are entries")
+	}
+	if _, err := checkpointer.Run(ctx); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	appendEntries(t, repo, 4)
+	if checkpointer.due(time.Now()) {
+		t.Error("Checkpoint should not be due below the entry threshold and interval")
+	}
+	if !checkpointer.due(time.Now().Add(2 * time.Hour)) {
+		t.Error("Checkpoint should be due after the interval")
+	}
+
+	appendEntries(t, repo, 1)
+	if !checkpointer.due(time.Now()) {
+		t.Error("Checkpoint should be due at the entry threshold")
+	}
+
+	// A witness failure raises an alert and backs off
+	witness.failures = witness.calls + 1
+	if _, err := checkpointer.Run(ctx); err == nil {
+		t.Fatal("Expected witness failure")
+	}
+	if len(alerts) != 1 || alerts[0].Reason != "failed" || alerts[0].PendingEntries != 5 {
+		t.Errorf("Expected one failure alert, got %+v", alerts)
+	}
+	if checkpointer.due(time.Now()) {
+		t.Error("Checkpoint should not be retried before the backoff")
+	}
+	if !checkpointer.due(time.Now().Add(time.Hour)) {
+		t.Error("Checkpoint should be retried after the backoff")
+	}
+}
+
+// TestMultiAgencyAndCompositeWitness tests that witness proofs verify against the checkpoint hash
+func TestMultiAgencyAndCompositeWitness(t *testing.T) {
+	ctx := context.Background()
+	local, err := tsa.NewLocalAgencyWithGeneratedCert("TEST", "Test Agency")
+	if err != nil {
+		t.Fatalf("Failed to create local agency: %v", err)
+	}
+	inner, err := tsa.NewMultiAgencyWitness(&tsa.MultiAgencyConfig{Enabled: true, MinSignatures: 1}, local)
+	if err != nil {
+		t.Fatalf("Failed to create multi-agency witness: %v", err)
+	}
+	multi := NewMultiAgencyWitness(inner)
+
+	hash := hex.EncodeToString(HashLeaf([]byte("checkpoint")))
+	proof, _, err := multi.Timestamp(ctx, hash, 42, 42, hash)
+	if err != nil {
+		t.Fatalf("Timestamp failed: %v", err)
+	}
+	if valid, err := multi.Verify(ctx, hash, proof); err != nil || !valid {
+		t.Errorf("Multi-agency proof should verify: %v", err)
+	}
+
+	composite := NewCompositeWitness(&failingWitness{failures: 1}, multi)
+	proof, _, err = composite.Timestamp(ctx, hash, 42, 42, hash)
+	if err != nil {
+		t.Fatalf("Composite timestamp failed: %v", err)
+	}
+	if valid, err := composite.Verify(ctx, hash, proof); err != nil || !valid {
+		t.Errorf("Composite proof should verify: %v", err)
+	}
+	if valid, _ := composite.Verify(ctx, hex.EncodeToString(HashLeaf([]byte("other"))), proof); valid {
+		t.Error("Composite proof should not verify another hash")
+	}
+	if status, _ := composite.GetStatus(ctx, proof); status != WitnessStatusConfirmed {
+		t.Errorf("Expected confirmed status, got %s", status)
+	}
+}
+
+// TestWitnessRefusesRewrittenHistory tests that a witness refuses checkpoints
+// that fork from or regress behind those it cosigned before
+func TestWitnessRefusesRewrittenHistory(t *testing.T) {
+	ctx := context.Background()
+	local, err := tsa.NewLocalAgencyWithGeneratedCert("WITNESS", "Witness Agency")
+	if err != nil {
+		t.Fatalf("Failed to create local agency: %v", err)
+	}
+	witness, err := tsa.NewMultiAgencyWitness(&tsa.MultiAgencyConfig{Enabled: true, MinSignatures: 1}, local)
+	if err != nil {
+		t.Fatalf("Failed to create multi-agency witness: %v", err)
+	}
+
+	sign := func(source, hash string, sequence int64, count int) int {
+		body, _ := json.Marshal(&tsa.WitnessRequest{
+			CheckpointHash:   hex.EncodeToString(HashLeaf([]byte(hash))),
+			LastSequence:     sequence,
+			EntryCount:       count,
+			Timestamp:        time.Now().UTC(),
+			RequestingAgency: "CENTRAL",
+		})
+		status, _ := witness.ReceiveSignRequest(ctx, &gateway.SignedRequest{SourceAgency: source, Body: body})
+		return status
+	}
+
+	steps := []struct {
+		name     string
+		source   string
+		hash     string
+		sequence int64
+		count    int
+		want     int
+	}{
+		{"first checkpoint", "CENTRAL", "a", 10, 10, 200},
+		{"extends history", "CENTRAL", "b", 20, 20, 200},
+		{"same checkpoint again", "CENTRAL", "b", 20, 20, 200},
+		{"fork at cosigned sequence", "CENTRAL", "b'", 20, 20, 409},
+		{"regressed sequence", "CENTRAL", "c", 15, 15, 409},
+		{"regressed entry count", "CENTRAL", "c", 30, 19, 409},
+		{"count outgrows sequence", "CENTRAL", "c", 25, 26, 400},
+		{"spoofed requester", "OTHER", "c", 30, 30, 403},
+		{"extends history again", "CENTRAL", "c", 30, 30, 200},
+	}
+	for _, step := range steps {
+		if got := sign(step.source, step.hash, step.sequence, step.count); got != step.want {
+			t.Errorf("%s: expected status %d, got %d", step.name, step.want, got)
+		}
+	}
+}
+
+// TestWitnessRequiresConsistencyProof tests that a witness cosigns a later
+// checkpoint only with a proof that its tree extends the tree cosigned
+// before, and refuses a rewritten prefix at a higher sequence
+func TestWitnessRequiresConsistencyProof(t *testing.T) {
+	ctx := context.Background()
+
+	remoteAgency, err := tsa.NewLocalAgencyWithGeneratedCert("REMOTE", "Remote Agency")
+	if err != nil {
+		t.Fatalf("Failed to create remote agency: %v", err)
+	}
+	remote, err := tsa.NewMultiAgencyWitness(&tsa.MultiAgencyConfig{Enabled: true, MinSignatures: 1}, remoteAgency)
+	if err != nil {
+		t.Fatalf("Failed to create remote witness: %v", err)
+	}
+	var mu sync.Mutex
+	var statuses []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		status, resp := remote.ReceiveSignRequest(r.Context(), &gateway.SignedRequest{SourceAgency: "CENTRAL", Body: body})
+		mu.Lock()
+		statuses = append(statuses, status)
+		mu.Unlock()
+		w.WriteHeader(status)
+		w.Write(resp)
+	}))
+	defer server.Close()
+
+	newService := func(repo AuditRepository, deadline time.Duration) *CheckpointService {
+		t.Helper()
+		local, err := tsa.NewLocalAgencyWithGeneratedCert("CENTRAL", "Central Platform")
+		if err != nil {
+			t.Fatalf("Failed to create local agency: %v", err)
+		}
+		witness, err := tsa.NewMultiAgencyWitness(&tsa.MultiAgencyConfig{
+			Enabled:       true,
+			MinSignatures: 2,
+			Agencies:      []tsa.AgencyWitnessConfig{{AgencyCode: "REMOTE", EndpointURL: server.URL}},
+			Deadline:      deadline,
+			RetryDelay:    10 * time.Millisecond,
+		}, local)
+		if err != nil {
+			t.Fatalf("Failed to create multi-agency witness: %v", err)
+		}
+		return NewCheckpointService(repo, NewMultiAgencyWitness(witness))
+	}
+	witnessed := func(service *CheckpointService, want WitnessStatus) []int {
+		t.Helper()
+		mu.Lock()
+		statuses = nil
+		mu.Unlock()
+		cp, err := service.CreateCheckpoint(ctx)
+		if err != nil {
+			t.Fatalf("CreateCheckpoint failed: %v", err)
+		}
+		for i := 0; i < 200; i++ {
+			current, err := service.GetCheckpoint(ctx, cp.ID)
+			if err != nil {
+				t.Fatalf("GetCheckpoint failed: %v", err)
+			}
+			if current.WitnessStatus == want {
+				mu.Lock()
+				defer mu.Unlock()
+				return slices.Clone(statuses)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("Checkpoint %s did not become %s", cp.ID, want)
+		return nil
+	}
+
+	repo := &memRepository{}
+	appendEntries(t, repo, 3)
+	service := newService(repo, time.Minute)
+	if got := witnessed(service, WitnessStatusConfirmed); !slices.Equal(got, []int{200}) {
+		t.Errorf("First checkpoint: expected statuses [200], got %v", got)
+	}
+
+	// An extension is cosigned once the proof from the cosigned tree is sent
+	appendEntries(t, repo, 5)
+	if got := witnessed(service, WitnessStatusConfirmed); !slices.Equal(got, []int{428, 200}) {
+		t.Errorf("Extended checkpoint: expected statuses [428 200], got %v", got)
+	}
+
+	// A log whose first 8 entries were rewritten, checkpointed at a higher
+	// sequence, cannot prove that it extends the cosigned tree
+	rewritten := &memRepository{}
+	appendEntries(t, rewritten, 12)
+	got := witnessed(newService(rewritten, 200*time.Millisecond), WitnessStatusFailed)
+	if len(got) < 2 || got[0] != 428 || got[1] != 409 || slices.Contains(got, 200) {
+		t.Errorf("Rewritten checkpoint: expected statuses [428 409 ...] and no signature, got %v", got)
+	}
+}
+
+// TestAsyncWitnessQuorum tests that checkpoints are witnessed pending and
+// confirmed by late signatures, or reported when quorum is never reached
+func TestAsyncWitnessQuorum(t *testing.T) {
+	ctx := context.Background()
+
+	// A remote agency that is unavailable for its first requests
+	remoteAgency, err := tsa.NewLocalAgencyWithGeneratedCert("REMOTE", "Remote Agency")
+	if err != nil {
+		t.Fatalf("Failed to create remote agency: %v", err)
+	}
+	remote, err := tsa.NewMultiAgencyWitness(&tsa.MultiAgencyConfig{
+		Enabled:       true,
+		MinSignatures: 1,
+		Agencies:      []tsa.AgencyWitnessConfig{{AgencyCode: "CENTRAL"}},
+	}, remoteAgency)
+	if err != nil {
+		t.Fatalf("Failed to create remote witness: %v", err)
+	}
+	unavailable := 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unavailable > 0 {
+			unavailable--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var request tsa.WitnessRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		sig, err := remote.HandleSignRequest(r.Context(), &request)
+		if err != nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		json.NewEncoder(w).Encode(sig)
+	}))
+	defer server.Close()
+
+	newService := func(endpoint string, deadline time.Duration) *CheckpointService {
+		t.Helper()
+		local, err := tsa.NewLocalAgencyWithGeneratedCert("CENTRAL", "Central Platform")
+		if err != nil {
+			t.Fatalf("Failed to create local agency: %v", err)
+		}
+		witness, err := tsa.NewMultiAgencyWitness(&tsa.MultiAgencyConfig{
+			Enabled:       true,
+			MinSignatures: 2,
+			Agencies:      []tsa.AgencyWitnessConfig{{AgencyCode: "REMOTE", EndpointURL: endpoint}},
+			Deadline:      deadline,
+			RetryDelay:    10 * time.Millisecond,
+		}, local)
+		if err != nil {
+			t.Fatalf("Failed to create multi-agency witness: %v", err)
+		}
+		repo := &memRepository{}
+		appendEntries(t, repo, 3)
+		return NewCheckpointService(repo, NewRetryWitness(NewMultiAgencyWitness(witness), 0, 0))
+	}
+
+	waitFor := func(service *CheckpointService, id types.ID, want WitnessStatus) *Checkpoint {
+		t.Helper()
+		for i := 0; i < 200; i++ {
+			cp, err := service.GetCheckpoint(ctx, id)
+			if err != nil {
+				t.Fatalf("GetCheckpoint failed: %v", err)
+			}
+			if cp.WitnessStatus == want {
+				return cp
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("Checkpoint %s did not become %s", id, want)
+		return nil
+	}
+
+	// Returns at once, and is confirmed once the remote agency signs
+	service := newService(server.URL, time.Minute)
+	cp, err := service.CreateCheckpoint(ctx)
+	if err != nil {
+		t.Fatalf("CreateCheckpoint failed: %v", err)
+	}
+	if cp.WitnessStatus != WitnessStatusPending {
+		t.Errorf("Expected pending checkpoint, got %s", cp.WitnessStatus)
+	}
+	confirmed := waitFor(service, cp.ID, WitnessStatusConfirmed)
+	proof, err := tsa.DeserializeProof(confirmed.WitnessProof)
+	if err != nil || len(proof.Signatures) != 2 || proof.ConfirmedAt == nil {
+		t.Fatalf("Expected a confirmed proof with 2 signatures: %+v, %v", proof, err)
+	}
+	if result, _ := service.VerifyCheckpoint(ctx, cp.ID); !result.Valid {
+		t.Errorf("Confirmed checkpoint should verify: %v", result.Violations)
+	}
+
+	// An agency that never answers leaves the proof without quorum
+	unreachable := newService("http://127.0.0.1:1", 100*time.Millisecond)
+	checkpointer := NewCheckpointer(unreachable, CheckpointerConfig{})
+	var alerts []CheckpointAlert
+	checkpointer.SetAlertHandler(func(ctx context.Context, alert CheckpointAlert) {
+		alerts = append(alerts, alert)
+	})
+	cp, err = checkpointer.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("A pending checkpoint should not raise an alert yet: %+v", alerts)
+	}
+	waitFor(unreachable, cp.ID, WitnessStatusFailed)
+	checkpointer.CheckPending(ctx)
+	if len(alerts) != 1 || alerts[0].Reason != "quorum_not_reached" || alerts[0].CheckpointID != cp.ID {
+		t.Errorf("Expected a quorum_not_reached alert, got %+v", alerts)
+	}
+	checkpointer.CheckPending(ctx)
+	if len(alerts) != 1 {
+		t.Errorf("Quorum failure should be reported once, got %d alerts", len(alerts))
+	}
+}
+
+// testTSA creates a TSA whose certificate, issued by root, expires at notAfter
+func testTSA(t *testing.T, root *x509.Certificate, rootKey *ecdsa.PrivateKey, notAfter time.Time) *tsa.Server {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate TSA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "Test TSA " + notAfter.Format("2006-01-02")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, root, &key.PublicKey, rootKey)
+	if err != nil {
+		t.Fatalf("Failed to create TSA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	config := tsa.DefaultConfig()
+	config.Certificate = cert
+	config.CertificateChain = []*x509.Certificate{cert, root}
+	config.PrivateKey = key
+	server, err := tsa.NewServer(config)
+	if err != nil {
+		t.Fatalf("Failed to create TSA: %v", err)
+	}
+	return server
+}
+
+// TestArchiveTimestampRenewal tests that archive timestamps are renewed
+// before the TSA certificate expires or the hash algorithm changes, and that
+// the TSA verifies tokens against the chain of renewals
+func TestArchiveTimestampRenewal(t *testing.T) {
+	ctx := context.Background()
+	rootKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test TSA Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(20, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatalf("Failed to create root: %v", err)
+	}
+	root, _ := x509.ParseCertificate(rootDER)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	// Checkpoints witnessed by a TSA whose certificate expires next month
+	expiring := testTSA(t, root, rootKey, time.Now().AddDate(0, 1, 0))
+	current := testTSA(t, root, rootKey, time.Now().AddDate(5, 0, 0))
+	repo := &memRepository{}
+	appendEntries(t, repo, 3)
+	cp, err := NewCheckpointService(repo, NewRFC3161Witness(expiring)).CreateCheckpoint(ctx)
+	if err != nil {
+		t.Fatalf("CreateCheckpoint failed: %v", err)
+	}
+	service := NewCheckpointService(repo, NewRFC3161Witness(current))
+
+	archiver := tsa.NewArchiver(current, &tsa.ArchiveConfig{RenewBefore: 90 * 24 * time.Hour})
+	archiver.AddSource("audit_checkpoint", service)
+	enrolled, renewed, err := archiver.Run(ctx)
+	if err != nil || enrolled != 1 || renewed != 1 {
+		t.Fatalf("Expected 1 enrolled and 1 renewed, got %d, %d: %v", enrolled, renewed, err)
+	}
+
+	record, err := archiver.GetEvidence(ctx, "audit_checkpoint", cp.ID.String())
+	if err != nil {
+		t.Fatalf("GetEvidence failed: %v", err)
+	}
+	if len(record.Timestamps) != 2 || record.Timestamps[1].Renewal != tsa.RenewalTimestamp {
+		t.Fatalf("Expected a timestamp renewal, got %+v", record.Timestamps)
+	}
+	if !bytes.Equal(record.Timestamps[0].Token, cp.WitnessProof) {
+		t.Error("The witness token should be the first archive timestamp")
+	}
+
+	hash, _ := hex.DecodeString(cp.CheckpointHash)
+	result, err := current.Verify(ctx, cp.WitnessProof, hash)
+	if err != nil || !result.Valid || result.Renewals != 1 {
+		t.Fatalf("Expected token verified with 1 renewal, got %+v: %v", result, err)
+	}
+	if !result.ArchivedUntil.Equal(current.GetCertificate().NotAfter) {
+		t.Errorf("Expected archived until %s, got %s", current.GetCertificate().NotAfter, result.ArchivedUntil)
+	}
+	if verification, _ := service.VerifyCheckpoint(ctx, cp.ID); !verification.WitnessValid {
+		t.Errorf("Checkpoint witness should verify through its renewals: %v", verification.Violations)
+	}
+
+	// Nothing is due until the new certificate nears expiry
+	if enrolled, renewed, _ := archiver.Run(ctx); enrolled != 0 || renewed != 0 {
+		t.Errorf("Expected nothing to do, got %d enrolled, %d renewed", enrolled, renewed)
+	}
+	if result := tsa.VerifyEvidence(record, roots, time.Now().AddDate(6, 0, 0)); result.Valid {
+		t.Error("Evidence should not verify after its latest archive timestamp expired")
+	}
+
+	// A renewal does not verify for another object
+	forged := *record
+	forged.ObjectHash = hex.EncodeToString(HashLeaf([]byte("other")))
+	if result := tsa.VerifyEvidence(&forged, roots, time.Now()); result.Valid {
+		t.Error("Evidence should not verify for another object hash")
+	}
+
+	// A new hash algorithm rehashes the object with the whole chain
+	upgraded := tsa.NewArchiver(current, &tsa.ArchiveConfig{HashAlgorithm: crypto.SHA512})
+	upgraded.AddSource("audit_checkpoint", service)
+	if _, renewed, err := upgraded.Run(ctx); err != nil || renewed != 1 {
+		t.Fatalf("Expected a hash-tree renewal: %d, %v", renewed, err)
+	}
+	record, _ = upgraded.GetEvidence(ctx, "audit_checkpoint", cp.ID.String())
+	if latest := record.Timestamps[len(record.Timestamps)-1]; latest.Renewal != tsa.RenewalHashTree || latest.HashAlgorithm != "SHA-512" {
+		t.Errorf("Expected a SHA-512 hash-tree renewal, got %s %s", latest.Renewal, latest.HashAlgorithm)
+	}
+	if result, _ := current.Verify(ctx, cp.WitnessProof, hash); !result.Valid || result.Renewals != 1 {
+		t.Errorf("Expected token verified through the hash-tree renewal, got %+v", result)
+	}
+}
+
+// TestIndexStreamSelection tests that queries read the most selective index
+func TestIndexStreamSelection(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	resourceID := types.NewID()
+	actorID := types.NewID()
+	start := now.AddDate(0, 0, -2)
+	longAgo := now.AddDate(-1, 0, 0)
+
+	tests := []struct {
+		name   string
+		filter ListEntriesFilter
+		want   []string
+	}{
+		{"resource", ListEntriesFilter{ResourceID: &resourceID, ActorID: &actorID}, []string{resourceIndex(resourceID)}},
+		{"actor", ListEntriesFilter{ActorID: &actorID, Action: ActionCaseCreated}, []string{actorIndex(actorID)}},
+		{"days", ListEntriesFilter{StartTime: &start, Action: ActionCaseCreated}, []string{
+			dayIndex(now), dayIndex(now.AddDate(0, 0, -1)), dayIndex(start),
+		}},
+		{"action", ListEntriesFilter{Action: ActionCaseCreated, StartTime: &longAgo}, []string{actionIndex(ActionCaseCreated)}},
+		{"resource type", ListEntriesFilter{ResourceType: "case"}, []string{resourceTypeIndex("case")}},
+		{"unfiltered", ListEntriesFilter{}, nil},
+	}
+
+	for _, tt := range tests {
+		got := indexStreamsForFilter(tt.filter, now)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	if got := indexStream("type", "a/b c"); got != "$audit-idx-type-a%2Fb%20c" {
+		t.Errorf("Index stream keys should be escaped, got %s", got)
+	}
+}
+
+// TestIndexPointers tests that every entry is indexed under all its keys and filters apply to pointers
+func TestIndexPointers(t *testing.T) {
+	resourceID := types.NewID()
+	entry := NewAuditEntry(ActorTypeWorker, types.NewID(), nil, ActionCaseCreated, "case", &resourceID, nil, "")
+
+	streams := indexStreamsFor(entry)
+	for _, want := range []string{
+		actorIndex(entry.ActorID), actionIndex(entry.Action), resourceTypeIndex("case"),
+		dayIndex(entry.Timestamp), resourceIndex(resourceID),
+	} {
+		found := false
+		for _, s := range streams {
+			found = found || s == want
+		}
+		if !found {
+			t.Errorf("Entry should be indexed in %s", want)
+		}
+	}
+
+	pointer := newIndexPointer(entry)
+	worker := ActorTypeWorker
+	system := ActorTypeSystem
+	before := entry.Timestamp.Add(-time.Minute)
+	after := entry.Timestamp.Add(time.Minute)
+
+	if !(ListEntriesFilter{ResourceID: &resourceID, ActorType: &worker, StartTime: &before, EndTime: &after}).matches(pointer) {
+		t.Error("Pointer should match its own fields")
+	}
+	if (ListEntriesFilter{ActorType: &system}).matches(pointer) {
+		t.Error("Pointer should not match another actor type")
+	}
+	if (ListEntriesFilter{StartTime: &after}).matches(pointer) {
+		t.Error("Pointer should not match a later time range")
+	}
+}
+
+// TestHTTPRepositoryFindByID tests finding entries by ID in a log longer
+// than a list page, without scanning the audit stream
+func TestHTTPRepositoryFindByID(t *testing.T) {
+	ctx := context.Background()
+	store, client := newEventStoreServer(t)
+	repo := NewHTTPRepository(client)
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	entries := appendEntries(t, repo, maxListEntries+50)
+	if err := repo.SyncIndexes(ctx); err != nil {
+		t.Fatalf("SyncIndexes failed: %v", err)
+	}
+	entries = append(entries, appendEntries(t, repo, 3)...)
+
+	for _, want := range []*AuditEntry{entries[0], entries[maxListEntries/2], entries[len(entries)-1]} {
+		before := store.servedFrom(AuditStreamName)
+		found, err := repo.FindByID(ctx, want.ID)
+		if err != nil {
+			t.Fatalf("FindByID of entry %d failed: %v", want.Sequence, err)
+		}
+		if found.Sequence != want.Sequence || found.Hash != want.Hash {
+			t.Errorf("Expected entry %d, got %d", want.Sequence, found.Sequence)
+		}
+		if read := store.servedFrom(AuditStreamName) - before; read > 10 {
+			t.Errorf("FindByID of entry %d read %d audit events", want.Sequence, read)
+		}
+	}
+
+	if _, err := repo.FindByID(ctx, types.NewID()); !stderrors.Is(err, errors.ErrNotFound) {
+		t.Errorf("Expected not found for an unknown entry, got %v", err)
+	}
+
+	// The chain is verified to the end, not to a page cap
+	result, err := repo.VerifyChain(ctx, 0, false)
+	if err != nil {
+		t.Fatalf("VerifyChain failed: %v", err)
+	}
+	if !result.Valid || result.Checked != len(entries) {
+		t.Errorf("Expected %d valid entries, got %d (valid: %v)", len(entries), result.Checked, result.Valid)
+	}
+}
+
+// TestHTTPRepositoryListPages tests paging filtered lists through the
+// indexes and the entries the indexer has not reached yet
+func TestHTTPRepositoryListPages(t *testing.T) {
+	ctx := context.Background()
+	store, client := newEventStoreServer(t)
+	repo := NewHTTPRepository(client)
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	// 120 entries by one official, alternating actions, among other entries;
+	// the last 4 are appended after the indexes were synced
+	actorID := types.NewID()
+	var actorEntries []*AuditEntry
+	record := func(n int) {
+		for i := 0; i < n; i++ {
+			action := ActionCaseCreated
+			if len(actorEntries)%2 == 1 {
+				action = ActionCaseUpdated
+			}
+			entry := NewAuditEntry(ActorTypeWorker, actorID, nil, action, "case", nil, nil, "")
+			if err := repo.Append(ctx, entry); err != nil {
+				t.Fatalf("Append failed: %v", err)
+			}
+			actorEntries = append(actorEntries, entry)
+			if i%10 == 0 {
+				appendEntries(t, repo, 3)
+			}
+		}
+	}
+	record(116)
+	if err := repo.SyncIndexes(ctx); err != nil {
+		t.Fatalf("SyncIndexes failed: %v", err)
+	}
+	record(4)
+	slices.Reverse(actorEntries) // newest first
+
+	indexed := store.eventCount(actorIndex(actorID))
+	position := store.eventCount(auditIndexPositionStream)
+	served := store.servedFrom(actorIndex(actorID))
+
+	// Single-key filter: pages of 50 with the exact total
+	var listed []*AuditEntry
+	for offset := 0; ; offset += 50 {
+		page, total, err := repo.List(ctx, ListEntriesFilter{ActorID: &actorID, Limit: 50, Offset: offset})
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		if total != len(actorEntries) {
+			t.Errorf("Offset %d: expected total %d, got %d", offset, len(actorEntries), total)
+		}
+		if len(page) > 50 {
+			t.Fatalf("Offset %d: page exceeds the limit with %d entries", offset, len(page))
+		}
+		listed = append(listed, page...)
+		if len(page) < 50 {
+			if len(page) != 20 {
+				t.Errorf("Expected a last page of 20 entries, got %d", len(page))
+			}
+			break
+		}
+	}
+	if len(listed) != len(actorEntries) {
+		t.Fatalf("Expected %d entries over all pages, got %d", len(actorEntries), len(listed))
+	}
+	for i, e := range listed {
+		if e.ID != actorEntries[i].ID {
+			t.Fatalf("Entry %d of the listing is out of order", i)
+		}
+	}
+
+	page, total, err := repo.List(ctx, ListEntriesFilter{ActorID: &actorID, Limit: 50, Offset: 200})
+	if err != nil || len(page) != 0 || total != len(actorEntries) {
+		t.Errorf("Expected an empty page past the end with the total, got %d of %d (%v)", len(page), total, err)
+	}
+
+	// Reads leave the indexes to the indexer
+	if store.eventCount(actorIndex(actorID)) != indexed || store.eventCount(auditIndexPositionStream) != position {
+		t.Error("List should not write to the indexes")
+	}
+
+	// A first page reads the pointers on it, not the whole index
+	before := store.servedFrom(actorIndex(actorID))
+	if page, _, err := repo.List(ctx, ListEntriesFilter{ActorID: &actorID, Limit: 10}); err != nil || len(page) != 10 || page[0].ID != actorEntries[0].ID {
+		t.Fatalf("Expected the newest 10 entries (%v)", err)
+	}
+	if read := store.servedFrom(actorIndex(actorID)) - before; read > 20 {
+		t.Errorf("Expected the first page to read a few pointers, read %d of %d", read, indexed)
+	}
+	if store.servedFrom(actorIndex(actorID)) == served {
+		t.Error("Expected the page to be read from the actor index")
+	}
+
+	// Compound filter: the total counts up to the page and shows that more follow
+	updates := ListEntriesFilter{ActorID: &actorID, Action: ActionCaseUpdated, Limit: 20}
+	page, total, err = repo.List(ctx, updates)
+	if err != nil || len(page) != 20 || total != 21 {
+		t.Errorf("Expected a full first page and a total past it, got %d of %d (%v)", len(page), total, err)
+	}
+	for _, e := range page {
+		if e.Action != ActionCaseUpdated || e.ActorID != actorID {
+			t.Fatalf("Entry %d does not match the filter", e.Sequence)
+		}
+	}
+	updates.Offset = 40
+	page, total, err = repo.List(ctx, updates)
+	if err != nil || len(page) != 20 || total != 60 {
+		t.Errorf("Expected the last page of 20 with the exact total 60, got %d of %d (%v)", len(page), total, err)
+	}
+}
+
+type staticSubjects map[types.ID][]privacy.PseudonymID
+
+func (s staticSubjects) CaseSubjects(ctx context.Context, caseID types.ID) ([]privacy.PseudonymID, error) {
+	return s[caseID], nil
+}
+
+type hashPseudonymizer struct{}
+
+func (hashPseudonymizer) Pseudonymize(ctx context.Context, jmbg string) (privacy.PseudonymID, error) {
+	hash := sha256.Sum256([]byte(jmbg))
+	return privacy.PseudonymID("PSE-" + hex.EncodeToString(hash[:8])), nil
+}
+
+func TestSubjectAccessReport(t *testing.T) {
+	repo := &memRepository{}
+	jmbg := "0101990710006"
+	subject, _ := hashPseudonymizer{}.Pseudonymize(context.Background(), jmbg)
+	other := privacy.PseudonymID("PSE-other")
+
+	caseID := types.NewID()
+	documentID := types.NewID()
+	recorder := NewAccessRecorder(repo, staticSubjects{caseID: {subject, other}})
+
+	agencyID := types.NewID()
+	worker := &auth.User{ID: types.NewID(), UserType: "worker", AgencyID: agencyID}
+	ctx := context.WithValue(context.Background(), auth.UserContextKey, worker)
+
+	recorder.RecordCaseAccess(WithAccessPurpose(ctx, "procena rizika"), caseID, "case", caseID)
+	recorder.RecordCaseAccess(WithAccessPurpose(ctx, "procena rizika"), caseID, "document", documentID)
+	recorder.RecordCaseAccess(ctx, caseID, "case", caseID)
+	recorder.RecordSubjectAccess(ctx, other, "health_record")
+
+	if len(repo.entries) != 7 {
+		t.Fatalf("Expected one entry per subject and read, got %d", len(repo.entries))
+	}
+	for _, e := range repo.entries {
+		if e.Action != ActionDataAccessed || e.ResourceType != ResourceTypeDataSubject {
+			t.Errorf("Unexpected access entry %s %s", e.Action, e.ResourceType)
+		}
+		if e.ActorID != worker.ID || e.ActorAgencyID == nil || *e.ActorAgencyID != agencyID {
+			t.Error("Access entry should record the official and agency")
+		}
+		if !e.VerifyHash() {
+			t.Error("Access entry hash should be valid")
+		}
+	}
+
+	tsaServer, err := tsa.NewServerWithGeneratedCert("Test TSA")
+	if err != nil {
+		t.Fatalf("Failed to create TSA: %v", err)
+	}
+	service := NewAccessReportService(repo, hashPseudonymizer{})
+	service.SetSigner(tsaServer)
+
+	if _, err := service.Generate(context.Background(), "123", nil, nil); err == nil {
+		t.Error("Expected error for invalid JMBG")
+	}
+
+	signed, err := service.Generate(context.Background(), jmbg, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to generate report: %v", err)
+	}
+
+	var report AccessReport
+	if err := json.Unmarshal(signed.Report, &report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if report.TotalAccesses != 3 {
+		t.Errorf("Expected 3 accesses of the subject, got %d", report.TotalAccesses)
+	}
+	// Same day, official and agency; grouped by purpose
+	if len(report.Groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(report.Groups))
+	}
+	for _, g := range report.Groups {
+		switch g.Purpose {
+		case "procena rizika":
+			if g.Count != 2 {
+				t.Errorf("Expected 2 accesses for the stated purpose, got %d", g.Count)
+			}
+		case "":
+			if g.Count != 1 {
+				t.Errorf("Expected 1 access without purpose, got %d", g.Count)
+			}
+		default:
+			t.Errorf("Unexpected purpose %q", g.Purpose)
+		}
+	}
+	if report.Subject == jmbg {
+		t.Error("Report should not contain the full JMBG")
+	}
+	if report.ChainSequence != 7 || report.ChainHash != repo.GetLastHash() {
+		t.Error("Report should record the audit chain head")
+	}
+
+	// The signature covers the report bytes
+	hash := sha256.Sum256(signed.Report)
+	if signed.Signature == nil || signed.Signature.Hash != hex.EncodeToString(hash[:]) {
+		t.Fatal("Expected signature over the report hash")
+	}
+	if len(signed.Signature.Token) == 0 || signed.Signature.Issuer == "" {
+		t.Error("Expected timestamp token and issuer")
+	}
+
+	pdf, err := signed.RenderPDF()
+	if err != nil {
+		t.Fatalf("Failed to render PDF: %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Error("Expected a PDF document")
+	}
+}
+
+// TestAccessReportTruncation tests that a report is only marked truncated
+// when the subject has more accesses than a report holds
+func TestAccessReportTruncation(t *testing.T) {
+	ctx := context.Background()
+	repo := &memRepository{}
+	service := NewAccessReportService(repo, hashPseudonymizer{})
+	subject, _ := hashPseudonymizer{}.Pseudonymize(ctx, "0101990710006")
+	subjectID := SubjectResourceID(subject)
+
+	access := func(n int) {
+		for i := 0; i < n; i++ {
+			// Other entries in between must not end the scan early
+			if i%1000 == 0 {
+				appendEntries(t, repo, 150)
+			}
+			entry := NewAuditEntry(ActorTypeWorker, types.NewID(), nil, ActionDataAccessed, ResourceTypeDataSubject, &subjectID, nil, "")
+			repo.Append(ctx, entry)
+		}
+	}
+
+	access(maxAccessReportEntries)
+	entries, truncated, err := service.subjectEntries(ctx, subject, nil, nil)
+	if err != nil {
+		t.Fatalf("subjectEntries failed: %v", err)
+	}
+	if truncated || len(entries) != maxAccessReportEntries {
+		t.Errorf("Expected all %d accesses untruncated, got %d (truncated %v)", maxAccessReportEntries, len(entries), truncated)
+	}
+
+	access(1)
+	entries, truncated, err = service.subjectEntries(ctx, subject, nil, nil)
+	if err != nil {
+		t.Fatalf("subjectEntries failed: %v", err)
+	}
+	if !truncated || len(entries) != maxAccessReportEntries {
+		t.Errorf("Expected %d accesses truncated, got %d (truncated %v)", maxAccessReportEntries, len(entries), truncated)
+	}
+	if entries[0].Sequence != repo.GetSequence() {
+		t.Error("A truncated report should keep the newest accesses")
+	}
+}
+
+type memPseudonyms map[string]*privacy.PseudonymMapping
+
+func (m memPseudonyms) Store(ctx context.Context, mapping *privacy.PseudonymMapping) error {
+	m[mapping.JMBGHash] = mapping
+	return nil
+}
+
+func (m memPseudonyms) GetByJMBGHash(ctx context.Context, jmbgHash, facilityCode string) (*privacy.PseudonymMapping, error) {
+	if mapping, ok := m[jmbgHash]; ok {
+		return mapping, nil
+	}
+	return nil, errors.NotFound("pseudonym", jmbgHash)
+}
+
+func (m memPseudonyms) GetByPseudonymID(ctx context.Context, pseudonymID privacy.PseudonymID) (*privacy.PseudonymMapping, error) {
+	for _, mapping := range m {
+		if mapping.PseudonymID == pseudonymID {
+			return mapping, nil
+		}
+	}
+	return nil, errors.NotFound("pseudonym", string(pseudonymID))
+}
+
+func (m memPseudonyms) Delete(ctx context.Context, pseudonymID privacy.PseudonymID) error {
+	for hash, mapping := range m {
+		if mapping.PseudonymID == pseudonymID {
+			delete(m, hash)
+		}
+	}
+	return nil
+}
+
+// stubHealthAdapter answers patient lookups with a fixed record
+type stubHealthAdapter struct {
+	health.Adapter
+}
+
+func (stubHealthAdapter) FetchPatientRecord(ctx context.Context, jmbg string) (*health.PatientRecord, error) {
+	return &health.PatientRecord{JMBG: jmbg, LastUpdated: time.Now()}, nil
+}
+
+func (stubHealthAdapter) FetchHospitalizations(ctx context.Context, jmbg string, from, to time.Time) ([]health.Hospitalization, error) {
+	return nil, nil
+}
+
+func (stubHealthAdapter) FetchPrescriptions(ctx context.Context, jmbg string, activeOnly bool) ([]health.Prescription, error) {
+	return nil, nil
+}
+
+func TestHealthLookupInAccessReport(t *testing.T) {
+	repo := &memRepository{}
+	jmbg := "0101990710006"
+	pseudonymizer := privacy.NewPseudonymizationService([]byte("test-hmac-key-32-bytes-long!!!!!"), "OB-KI", memPseudonyms{}, nil)
+
+	adapter := privacy.NewPrivacyAwareHealthAdapter(stubHealthAdapter{}, pseudonymizer, nil)
+	adapter.SetAccessRecorder(NewAccessRecorder(repo, staticSubjects{}))
+
+	worker := &auth.User{ID: types.NewID(), UserType: "worker", AgencyID: types.NewID()}
+	ctx := context.WithValue(context.Background(), auth.UserContextKey, worker)
+	if _, err := adapter.FetchPseudonymizedHealthContext(ctx, jmbg); err != nil {
+		t.Fatalf("Health lookup failed: %v", err)
+	}
+
+	signed, err := NewAccessReportService(repo, pseudonymizer).Generate(context.Background(), jmbg, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to generate report: %v", err)
+	}
+	var report AccessReport
+	if err := json.Unmarshal(signed.Report, &report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if report.TotalAccesses != 1 || len(report.Groups) != 1 {
+		t.Fatalf("Expected the health lookup in the report, got %d accesses", report.TotalAccesses)
+	}
+	group := report.Groups[0]
+	if group.ActorID != worker.ID || len(group.Accesses) != 1 || group.Accesses[0].ResourceType != "health_record" {
+		t.Errorf("Expected a health record read by the official, got %+v", group)
+	}
+}
+
+func TestAlertRules(t *testing.T) {
+	ctx := context.Background()
+	repo := &memRepository{}
+	worker := types.NewID()
+	base := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC) // Wednesday
+
+	add := func(at time.Time, actorID types.ID, action string, changes map[string]any) {
+		resourceID := types.NewID()
+		entry := NewAuditEntry(ActorTypeWorker, actorID, nil, action, ResourceTypeDataSubject, &resourceID, changes, "")
+		entry.Timestamp = at
+		repo.Append(ctx, entry)
+	}
+
+	cfg := DefaultAlertRulesConfig()
+	cfg.ManySubjects = 3
+	cfg.DeniedAttempts = 3
+	cfg.BulkDownloads = 3
+	engine := NewAlertEngine(repo, DefaultAlertRules(cfg)...)
+
+	var alerts []*Alert
+	engine.SetAlertHandler(func(ctx context.Context, alert *Alert) {
+		alerts = append(alerts, alert)
+	})
+	raised := func(rule string) int {
+		n := 0
+		for _, a := range alerts {
+			if a.Rule == rule {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Citizens of one case count once
+	caseID := types.NewID()
+	for i := 0; i < 3; i++ {
+		add(base.Add(time.Duration(i)*time.Minute), worker, ActionDataAccessed, map[string]any{"case_id": caseID, "resource_type": "case"})
+	}
+	engine.Process(ctx)
+	if len(alerts) != 0 {
+		t.Fatalf("Expected no alerts for reads of one case, got %d", len(alerts))
+	}
+
+	// Two more unrelated citizens
+	add(base.Add(5*time.Minute), worker, ActionDataAccessed, map[string]any{"resource_type": "health_record"})
+	add(base.Add(6*time.Minute), worker, ActionDataAccessed, map[string]any{"resource_type": "health_record"})
+	add(base.Add(7*time.Minute), worker, ActionDataAccessed, map[string]any{"resource_type": "health_record"})
+	engine.Process(ctx)
+	if raised("many_subjects") != 1 {
+		t.Errorf("Expected one many_subjects alert (cooldown), got %d", raised("many_subjects"))
+	}
+
+	// Off hours: once per worker and day
+	add(base.Add(12*time.Hour), worker, ActionDataAccessed, map[string]any{"case_id": caseID})
+	add(base.Add(13*time.Hour), worker, ActionDataAccessed, map[string]any{"case_id": caseID})
+	engine.Process(ctx)
+	if raised("off_hours_access") != 1 {
+		t.Errorf("Expected one off_hours_access alert, got %d", raised("off_hours_access"))
+	}
+
+	// Denied attempts within the window
+	other := types.NewID()
+	add(base, other, ActionAccessDenied, nil)
+	add(base.Add(time.Minute), other, privacy.AuditActionAIAccessDenied, nil)
+	add(base.Add(time.Hour), other, ActionLoginFailed, nil)
+	engine.Process(ctx)
+	if raised("denied_attempts") != 0 {
+		t.Error("Attempts outside the window should not raise an alert")
+	}
+	add(base.Add(time.Hour+time.Minute), other, ActionLoginFailed, nil)
+	add(base.Add(time.Hour+2*time.Minute), other, ActionAccessDenied, nil)
+	engine.Process(ctx)
+	if raised("denied_attempts") != 1 {
+		t.Errorf("Expected one denied_attempts alert, got %d", raised("denied_attempts"))
+	}
+	if a := alerts[len(alerts)-1]; a.ActorID != other || len(a.EntryIDs) != 3 {
+		t.Error("Alert should name the actor and the denied entries")
+	}
+
+	// PII violations
+	add(base, "privacy-guard", privacy.AuditActionPIIViolationDetected, map[string]any{"field": "jmbg", "request_path": "/api/v1/cases"})
+	add(base.Add(time.Second), "privacy-guard", privacy.AuditActionPIIViolationDetected, map[string]any{"field": "jmbg", "request_path": "/api/v1/cases"})
+	engine.Process(ctx)
+	if raised("pii_violation") != 1 || alerts[len(alerts)-1].Severity != AlertSeverityCritical {
+		t.Error("Expected one critical pii_violation alert")
+	}
+
+	// Bulk downloads
+	downloader := types.NewID()
+	for i := 0; i < 3; i++ {
+		add(base.Add(time.Duration(i)*time.Second), downloader, ActionDataAccessed, map[string]any{"resource_type": "document"})
+	}
+	engine.Process(ctx)
+	if raised("bulk_download") != 1 {
+		t.Errorf("Expected one bulk_download alert, got %d", raised("bulk_download"))
+	}
+
+	// Entries are evaluated once
+	count := len(alerts)
+	engine.Process(ctx)
+	if len(alerts) != count {
+		t.Error("Processed entries should not be evaluated again")
+	}
+}
+
+func TestAlertLifecycle(t *testing.T) {
+	entry := NewAuditEntry(ActorTypeWorker, types.NewID(), nil, ActionAccessDenied, "request", nil, nil, "")
+	alert := newAlert("denied_attempts", AlertSeverityHigh, entry, "test")
+	auditor := types.NewID()
+
+	if err := alert.Resolve(auditor, ""); err == nil {
+		t.Error("Expected error resolving without a resolution")
+	}
+	if err := alert.Acknowledge(auditor); err != nil {
+		t.Fatalf("Failed to acknowledge: %v", err)
+	}
+	if err := alert.Acknowledge(auditor); err == nil {
+		t.Error("Expected error acknowledging twice")
+	}
+	if err := alert.Resolve(auditor, "false positive: shift change"); err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	if alert.Status != AlertStatusResolved || alert.ResolvedBy == nil || *alert.ResolvedBy != auditor {
+		t.Error("Alert should be resolved by the auditor")
+	}
+	if err := alert.Resolve(auditor, "again"); err == nil {
+		t.Error("Expected error resolving twice")
+	}
+}
+
+type memCursors map[string]int64
+
+func (c memCursors) GetCursor(ctx context.Context, name string) (int64, error) { return c[name], nil }
+
+func (c memCursors) SaveCursor(ctx context.Context, name string, sequence int64) error {
+	c[name] = sequence
+	return nil
+}
+
+type flakySink struct {
+	sent []*AuditEntry
+	fail bool
+}
+
+func (s *flakySink) Send(ctx context.Context, entries []*AuditEntry) error {
+	if s.fail {
+		return fmt.Errorf("collector unavailable")
+	}
+	s.sent = append(s.sent, entries...)
+	return nil
+}
+
+func TestSIEMFormats(t *testing.T) {
+	resourceID := types.NewID()
+	entry := NewAuditEntry(ActorTypeWorker, types.NewID(), nil, privacy.AuditActionPIIViolationDetected, "pii|violation", &resourceID,
+		map[string]any{"request_path": "/a=b"}, "")
+	entry.Sequence = 42
+	entry.Justification = "line1\nline2"
+
+	cef := FormatCEF(entry)
+	if !strings.HasPrefix(cef, "CEF:0|Serbia Gov|Platform|1.0|privacy.pii_violation|privacy.pii_violation pii\\|violation|9|") {
+		t.Errorf("Unexpected CEF header: %s", cef)
+	}
+	if !strings.Contains(cef, `reason=line1\nline2`) || !strings.Contains(cef, `"/a\=b"`) || !strings.Contains(cef, "cn1=42") {
+		t.Errorf("CEF extension not escaped: %s", cef)
+	}
+
+	msg := string(FormatSyslog(entry, "host 1"))
+	// facility 13 (log audit), severity 2 (critical)
+	if !strings.HasPrefix(msg, "<106>1 ") || !strings.Contains(msg, " host1 gov-platform-audit ") {
+		t.Errorf("Unexpected syslog header: %s", msg)
+	}
+
+	// Octet-counted frames over TCP
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		length, _ := r.ReadString(' ')
+		n, _ := strconv.Atoi(strings.TrimSpace(length))
+		buf := make([]byte, n)
+		io.ReadFull(r, buf)
+		received <- string(buf)
+	}()
+
+	sink := NewSyslogSink(ln.Addr().String(), nil)
+	defer sink.Close()
+	if err := sink.Send(context.Background(), []*AuditEntry{entry}); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	select {
+	case got := <-received:
+		if !strings.HasSuffix(got, cef) {
+			t.Errorf("Collector received %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Collector received nothing")
+	}
+}
+
+func TestSIEMExportDelivery(t *testing.T) {
+	ctx := context.Background()
+	repo := &memRepository{}
+	entries := appendEntries(t, repo, 250)
+
+	sink := &flakySink{fail: true}
+	cursors := memCursors{}
+	exporter := NewSIEMExporter(repo, sink, cursors)
+
+	if err := exporter.Process(ctx); err == nil {
+		t.Fatal("Expected error while the collector is unavailable")
+	}
+	if cursors[siemCursorName] != 0 {
+		t.Fatal("Cursor should not advance on failed delivery")
+	}
+
+	sink.fail = false
+	if err := exporter.Process(ctx); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if len(sink.sent) != 250 || cursors[siemCursorName] != 250 {
+		t.Fatalf("Expected 250 entries delivered, got %d (cursor %d)", len(sink.sent), cursors[siemCursorName])
+	}
+
+	// A restarted exporter continues from the cursor
+	appendEntries(t, repo, 3)
+	if err := NewSIEMExporter(repo, sink, cursors).Process(ctx); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if len(sink.sent) != 253 || sink.sent[250].Sequence != 251 {
+		t.Errorf("Expected only new entries after restart, got %d", len(sink.sent))
+	}
+
+	// Bulk JSON Lines export of a time range
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, e := range entries {
+		e.Timestamp = base.Add(time.Duration(i) * time.Hour)
+	}
+	for _, e := range repo.entries[250:] {
+		e.Timestamp = base.Add(1000 * time.Hour)
+	}
+
+	var buf bytes.Buffer
+	n, err := ExportJSONLines(ctx, repo, &buf, base.Add(10*time.Hour), base.Add(19*time.Hour), 0)
+	if err != nil {
+		t.Fatalf("JSON Lines export failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if n != 10 || len(lines) != 10 {
+		t.Fatalf("Expected 10 lines, got %d", len(lines))
+	}
+	var first AuditEntry
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.Sequence != 11 {
+		t.Errorf("Expected first line to be entry 11, got %d (%v)", first.Sequence, err)
+	}
+
+	// Resuming after the last received line
+	buf.Reset()
+	n, _ = ExportJSONLines(ctx, repo, &buf, base.Add(10*time.Hour), base.Add(19*time.Hour), 15)
+	if n != 5 {
+		t.Errorf("Expected 5 entries after sequence 15, got %d", n)
+	}
+}
+
+func TestCorrectionWorkflow(t *testing.T) {
+	ctx := context.Background()
+	repo := &memRepository{}
+	original := appendEntries(t, repo, 3)[1]
+	service := NewCorrectionService(repo)
+
+	worker := &auth.User{ID: types.NewID(), UserType: "worker", Roles: []string{"case_worker"}}
+	supervisor := &auth.User{ID: types.NewID(), UserType: "worker", Roles: []string{"agency_supervisor"}}
+	second := &auth.User{ID: types.NewID(), UserType: "worker", Roles: []string{"agency_supervisor"}}
+
+	input := CorrectionInput{
+		Reason:        CorrectionReasonDataEntry,
+		Justification: "Pogrešno unet naziv predmeta",
+		OldValue:      map[string]any{"title": "Tset"},
+		NewValue:      map[string]any{"title": "Test"},
+	}
+
+	if _, err := service.Request(ctx, worker, original.ID, input); err == nil {
+		t.Error("Expected error for a worker without supervisor role")
+	}
+	if _, err := service.Request(ctx, supervisor, original.ID, CorrectionInput{Reason: CorrectionReasonOther}); err == nil {
+		t.Error("Expected error without justification")
+	}
+
+	request, err := service.Request(ctx, supervisor, original.ID, input)
+	if err != nil {
+		t.Fatalf("Failed to request correction: %v", err)
+	}
+	if request.Status != CorrectionStatusPending {
+		t.Errorf("Expected pending request, got %s", request.Status)
+	}
+
+	if _, err := service.Approve(ctx, supervisor, request.ID); err == nil {
+		t.Error("Requester must not approve their own correction")
+	}
+
+	correction, err := service.Approve(ctx, second, request.ID)
+	if err != nil {
+		t.Fatalf("Failed to approve correction: %v", err)
+	}
+	if correction.Action != ActionCorrection || *correction.ResourceID != original.ID || correction.ActorID != supervisor.ID {
+		t.Error("Correction should reference the original entry in the requester's name")
+	}
+	if approvedBy := changeID(correctionData(correction), "approved_by"); approvedBy == nil || *approvedBy != second.ID {
+		t.Error("Correction should record the approver")
+	}
+
+	if _, err := service.Approve(ctx, second, request.ID); err == nil {
+		t.Error("Expected error approving a decided request")
+	}
+
+	// A second request, rejected
+	rejected, _ := service.Request(ctx, supervisor, original.ID, input)
+	if _, err := service.Reject(ctx, second, rejected.ID, ""); err == nil {
+		t.Error("Expected error rejecting without reason")
+	}
+	if _, err := service.Reject(ctx, second, rejected.ID, "Naziv je bio ispravan"); err != nil {
+		t.Fatalf("Failed to reject: %v", err)
+	}
+
+	requests, err := service.Requests(ctx, original.ID)
+	if err != nil || len(requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d (%v)", len(requests), err)
+	}
+	statuses := map[types.ID]CorrectionStatus{}
+	for _, r := range requests {
+		statuses[r.ID] = r.Status
+	}
+	if statuses[request.ID] != CorrectionStatusApproved || statuses[rejected.ID] != CorrectionStatusRejected {
+		t.Errorf("Unexpected statuses: %v", statuses)
+	}
+
+	// Only the approved correction is shown with the original
+	withCorrections, err := service.WithCorrections(ctx, []*AuditEntry{original})
+	if err != nil {
+		t.Fatalf("Failed to attach corrections: %v", err)
+	}
+	if len(withCorrections[0].Corrections) != 1 || withCorrections[0].Corrections[0].ID != correction.ID {
+		t.Error("Expected the approved correction alongside the original")
+	}
+
+	// The original entry is unchanged and the chain is intact
+	for i, e := range repo.entries {
+		if !e.VerifyHash() || (i > 0 && e.PrevHash != repo.entries[i-1].Hash) {
+			t.Fatalf("Chain broken at entry %d", e.Sequence)
+		}
+	}
+
+	result := &VerifyResult{}
+	for _, e := range repo.entries {
+		result.noteCorrection(e)
+	}
+	if result.Corrections != 1 || result.CorrectedIDs[0] != original.ID {
+		t.Error("Verification should report the correction")
+	}
+}
+
+// TestCorrectionsFarFromOriginal tests that corrections are found through the
+// resource indexes however many entries follow them
+func TestCorrectionsFarFromOriginal(t *testing.T) {
+	ctx := context.Background()
+	store, client := newEventStoreServer(t)
+	repo := NewHTTPRepository(client)
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	service := NewCorrectionService(repo)
+
+	supervisor := &auth.User{ID: types.NewID(), UserType: "worker", Roles: []string{"agency_supervisor"}}
+	second := &auth.User{ID: types.NewID(), UserType: "worker", Roles: []string{"agency_supervisor"}}
+	input := CorrectionInput{Reason: CorrectionReasonDataEntry, Justification: "Pogrešno unet naziv predmeta"}
+
+	correct := func(original *AuditEntry) *AuditEntry {
+		t.Helper()
+		request, err := service.Request(ctx, supervisor, original.ID, input)
+		if err != nil {
+			t.Fatalf("Failed to request correction: %v", err)
+		}
+		correction, err := service.Approve(ctx, second, request.ID)
+		if err != nil {
+			t.Fatalf("Failed to approve correction: %v", err)
+		}
+		return correction
+	}
+
+	// An indexed correction followed by 250 entries, then a correction the indexer has not reached
+	old := appendEntries(t, repo, 1)[0]
+	oldCorrection := correct(old)
+	uncorrected := appendEntries(t, repo, 250)[0]
+	if err := repo.SyncIndexes(ctx); err != nil {
+		t.Fatalf("SyncIndexes failed: %v", err)
+	}
+	recent := appendEntries(t, repo, 1)[0]
+	recentCorrection := correct(recent)
+	appendEntries(t, repo, 5)
+
+	before := store.servedFrom(AuditStreamName)
+	page, err := service.WithCorrections(ctx, []*AuditEntry{recent, uncorrected, old})
+	if err != nil {
+		t.Fatalf("WithCorrections failed: %v", err)
+	}
+	// The unindexed tail (9 entries) and one entry per correction, not the whole log
+	if read := store.servedFrom(AuditStreamName) - before; read > 20 {
+		t.Errorf("Expected the page to read only the unindexed tail, read %d entries", read)
+	}
+
+	want := map[types.ID]*AuditEntry{recent.ID: recentCorrection, old.ID: oldCorrection}
+	for _, e := range page {
+		switch correction := want[e.ID]; {
+		case correction == nil && len(e.Corrections) != 0:
+			t.Errorf("Entry %d should have no corrections, got %d", e.Sequence, len(e.Corrections))
+		case correction != nil && (len(e.Corrections) != 1 || e.Corrections[0].ID != correction.ID):
+			t.Errorf("Entry %d should carry its correction", e.Sequence)
+		}
+	}
+
+	requests, err := service.Requests(ctx, old.ID)
+	if err != nil || len(requests) != 1 || requests[0].Status != CorrectionStatusApproved {
+		t.Errorf("Expected the approved request of the old entry, got %v (%v)", requests, err)
+	}
+}
+
+// TestOfflineVerification tests verifying an exported stream and its checkpoints against trust anchors
+func TestOfflineVerification(t *testing.T) {
+	ctx := context.Background()
+	repo := &memRepository{}
+
+	tsaServer, err := tsa.NewServerWithGeneratedCert("Test TSA")
+	if err != nil {
+		t.Fatalf("Failed to create TSA: %v", err)
+	}
+	local, err := tsa.NewLocalAgencyWithGeneratedCert("TEST", "Test Agency")
+	if err != nil {
+		t.Fatalf("Failed to create local agency: %v", err)
+	}
+	inner, err := tsa.NewMultiAgencyWitness(&tsa.MultiAgencyConfig{Enabled: true, MinSignatures: 1}, local)
+	if err != nil {
+		t.Fatalf("Failed to create multi-agency witness: %v", err)
+	}
+	service := NewCheckpointService(repo, NewCompositeWitness(NewRFC3161Witness(tsaServer), NewMultiAgencyWitness(inner)))
+
+	appendEntries(t, repo, 5)
+	if _, err := service.CreateCheckpoint(ctx); err != nil {
+		t.Fatalf("CreateCheckpoint failed: %v", err)
+	}
+	appendEntries(t, repo, 3)
+	if _, err := service.CreateCheckpoint(ctx); err != nil {
+		t.Fatalf("CreateCheckpoint failed: %v", err)
+	}
+
+	var entries, checkpoints bytes.Buffer
+	now := time.Now()
+	if _, err := ExportJSONLines(ctx, repo, &entries, now.Add(-time.Hour), now.Add(time.Hour), 0); err != nil {
+		t.Fatalf("ExportJSONLines failed: %v", err)
+	}
+	if n, err := service.ExportCheckpoints(ctx, &checkpoints); err != nil || n != 2 {
+		t.Fatalf("Expected 2 exported checkpoints, got %d: %v", n, err)
+	}
+
+	tsaRoots, err := LoadCertPool(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tsaServer.GetCertificate().Raw}))
+	if err != nil {
+		t.Fatalf("LoadCertPool failed: %v", err)
+	}
+	agencyRoots := x509.NewCertPool()
+	agencyRoots.AddCert(local.Certificate)
+	anchors := OfflineAnchors{TSA: tsaRoots, Agencies: agencyRoots}
+
+	verify := func(entries, checkpoints string, anchors OfflineAnchors) *OfflineReport {
+		t.Helper()
+		report, err := VerifyExport(strings.NewReader(entries), strings.NewReader(checkpoints), anchors)
+		if err != nil {
+			t.Fatalf("VerifyExport failed: %v", err)
+		}
+		return report
+	}
+
+	report := verify(entries.String(), checkpoints.String(), anchors)
+	if !report.Valid() {
+		t.Fatalf("Export should verify:\n%s", report)
+	}
+	if report.Entries != 8 || report.Checkpoints != 2 || report.Witnessed != 2 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if !strings.Contains(report.String(), "RESULT: VERIFIED") {
+		t.Errorf("Report should say verified:\n%s", report)
+	}
+
+	// Proofs are only trusted against the anchors given
+	if verify(entries.String(), checkpoints.String(), OfflineAnchors{}).Valid() {
+		t.Error("Export should not verify without trust anchors")
+	}
+	otherTSA, _ := tsa.NewServerWithGeneratedCert("Other TSA")
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(otherTSA.GetCertificate())
+	if verify(entries.String(), checkpoints.String(), OfflineAnchors{TSA: otherRoots, Agencies: agencyRoots}).Valid() {
+		t.Error("Export should not verify against another TSA")
+	}
+
+	lines := strings.SplitAfter(entries.String(), "\n")
+
+	// A modified entry breaks its hash
+	tampered := append([]string{}, lines...)
+	tampered[2] = strings.Replace(tampered[2], ActionCaseCreated, ActionCaseClosed, 1)
+	report = verify(strings.Join(tampered, ""), checkpoints.String(), anchors)
+	if report.Valid() || !strings.Contains(strings.Join(report.Failures, "\n"), "sequence 3: hash mismatch") {
+		t.Errorf("Modified entry should be detected:\n%s", report)
+	}
+
+	// A removed entry leaves a gap
+	removed := append(append([]string{}, lines[:4]...), lines[5:]...)
+	report = verify(strings.Join(removed, ""), checkpoints.String(), anchors)
+	if report.Valid() || !strings.Contains(strings.Join(report.Failures, "\n"), "sequences 5 to 5 are missing") {
+		t.Errorf("Removed entry should be detected:\n%s", report)
+	}
+
+	// A rewritten checkpoint no longer matches its hash
+	rewritten := strings.Replace(checkpoints.String(), `"entry_count":5`, `"entry_count":4`, 1)
+	if verify(entries.String(), rewritten, anchors).Valid() {
+		t.Error("Rewritten checkpoint should be detected")
+	}
+}
+
+// TestOfflineVerificationLegacyCheckpoint tests that checkpoints that predate
+// the Merkle tree are bound by their hash in offline verification
+func TestOfflineVerificationLegacyCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	repo := &memRepository{}
+	entries := appendEntries(t, repo, 4)
+	last := entries[len(entries)-1]
+
+	// A checkpoint as created before the Merkle tree, without its last hash
+	createdAt := time.Now().UTC()
+	legacy := Checkpoint{
+		ID:             types.NewID(),
+		CheckpointHash: computeLegacyCheckpointHash(last.Hash, last.Sequence, 4, createdAt),
+		LastSequence:   last.Sequence,
+		EntryCount:     4,
+		WitnessType:    WitnessTypeLocal,
+		WitnessProof:   []byte("local"),
+		WitnessStatus:  WitnessStatusConfirmed,
+		CreatedAt:      createdAt,
+	}
+
+	var exported bytes.Buffer
+	now := time.Now()
+	if _, err := ExportJSONLines(ctx, repo, &exported, now.Add(-time.Hour), now.Add(time.Hour), 0); err != nil {
+		t.Fatalf("ExportJSONLines failed: %v", err)
+	}
+
+	verify := func(cp Checkpoint) *OfflineReport {
+		t.Helper()
+		line, _ := json.Marshal(cp)
+		report, err := VerifyExport(strings.NewReader(exported.String()), bytes.NewReader(append(line, '\n')), OfflineAnchors{})
+		if err != nil {
+			t.Fatalf("VerifyExport failed: %v", err)
+		}
+		return report
+	}
+
+	if report := verify(legacy); !report.Valid() {
+		t.Fatalf("Legacy checkpoint should verify:\n%s", report)
+	}
+
+	edited := legacy
+	edited.EntryCount = 3
+	report := verify(edited)
+	if report.Valid() || !strings.Contains(strings.Join(report.Failures, "\n"), "checkpoint hash does not match its contents") {
+		t.Errorf("Edited legacy checkpoint should be detected:\n%s", report)
+	}
+
+	edited = legacy
+	edited.CreatedAt = createdAt.Add(time.Second)
+	if verify(edited).Valid() {
+		t.Error("Legacy checkpoint with an edited time should be detected")
+	}
+}
+
+// testPool connects to the migrated database in TEST_DATABASE_URL, or skips
+// the test when none is configured
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	if err := database.Migrate(ctx, pool); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return pool
+}
+
+// TestPostgresConcurrentAppends tests that concurrent writers extend one
+// chain with consecutive sequence numbers
+func TestPostgresConcurrentAppends(t *testing.T) {
+	ctx := context.Background()
+	pool := testPool(t)
+
+	// Two repositories on one database stand in for two platform instances
+	repos := []*Repository{NewRepository(pool), NewRepository(pool)}
+	for _, repo := range repos {
+		if err := repo.Initialize(ctx); err != nil {
+			t.Fatalf("Initialize failed: %v", err)
+		}
+	}
+	start := repos[0].GetSequence()
+
+	const writers, perWriter = 8, 10
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(repo *Repository) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				// A writer that lost the race reloads the head; retrying links to it
+				for attempt := 0; ; attempt++ {
+					entry := NewAuditEntry(ActorTypeSystem, types.NewID(), nil, ActionCaseCreated, "case", nil, nil, "")
+					err := repo.Append(ctx, entry)
+					if err == nil {
+						break
+					}
+					if attempt == 20 {
+						t.Errorf("Append kept failing: %v", err)
+						return
+					}
+				}
+			}
+		}(repos[w%len(repos)])
+	}
+	wg.Wait()
+
+	entries, err := repos[0].ReadEntries(ctx, start+1, writers*perWriter+1)
+	if err != nil {
+		t.Fatalf("ReadEntries failed: %v", err)
+	}
+	if len(entries) < writers*perWriter {
+		t.Fatalf("Expected %d new entries, got %d", writers*perWriter, len(entries))
+	}
+	for i, e := range entries {
+		if e.Sequence != start+int64(i)+1 {
+			t.Fatalf("Expected sequence %d, got %d", start+int64(i)+1, e.Sequence)
+		}
+		if !e.VerifyHash() {
+			t.Errorf("Entry %d has an invalid hash", e.Sequence)
+		}
+		if i > 0 && e.PrevHash != entries[i-1].Hash {
+			t.Errorf("Entry %d does not link to entry %d", e.Sequence, entries[i-1].Sequence)
+		}
+	}
+}
+
+// TestPostgresReadEntries tests reading the chain in sequence order, page by page
+func TestPostgresReadEntries(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository(testPool(t))
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	start := repo.GetSequence()
+	appended := appendEntries(t, repo, 25)
+
+	var read []*AuditEntry
+	for from := start + 1; ; {
+		page, err := repo.ReadEntries(ctx, from, 10)
+		if err != nil {
+			t.Fatalf("ReadEntries failed: %v", err)
+		}
+		if len(page) > 10 {
+			t.Fatalf("Expected at most 10 entries, got %d", len(page))
+		}
+		read = append(read, page...)
+		if len(page) < 10 {
+			break
+		}
+		from = page[len(page)-1].Sequence + 1
+	}
+
+	if len(read) < len(appended) {
+		t.Fatalf("Expected %d entries, got %d", len(appended), len(read))
+	}
+	for i, e := range appended {
+		if read[i].ID != e.ID || read[i].Sequence != e.Sequence || read[i].Hash != e.Hash {
+			t.Errorf("Entry %d read out of order", e.Sequence)
+		}
+	}
+
+	if entries, err := repo.ReadEntries(ctx, repo.GetSequence()+1, 10); err != nil || len(entries) != 0 {
+		t.Errorf("Expected no entries past the head, got %d (%v)", len(entries), err)
+	}
+	if entries, err := repo.ReadEntries(ctx, start+1, 0); err != nil || len(entries) != 0 {
+		t.Errorf("Expected no entries for a zero limit, got %d (%v)", len(entries), err)
+	}
+}
+
+// TestPostgresAppendOnly tests that the database rejects changes to entries and checkpoints
+func TestPostgresAppendOnly(t *testing.T) {
+	ctx := context.Background()
+	pool := testPool(t)
+	repo := NewRepository(pool)
+	if err := repo.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	entry := appendEntries(t, repo, 1)[0]
+
+	checkpoint := &Checkpoint{
+		ID:             types.NewID(),
+		CheckpointHash: strings.Repeat("0", 64),
+		LastSequence:   entry.Sequence,
+		LastEntryID:    entry.ID,
+		LastHash:       entry.Hash,
+		EntryCount:     1,
+		WitnessType:    WitnessTypeLocal,
+		WitnessStatus:  WitnessStatusConfirmed,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if err := repo.SaveCheckpoint(ctx, checkpoint); err != nil {
+		t.Fatalf("SaveCheckpoint failed: %v", err)
+	}
+
+	statements := []struct {
+		name string
+		sql  string
+		args []any
+	}{
+		{"update entry", "UPDATE audit.entries SET action = 'tampered' WHERE id = $1", []any{entry.ID}},
+		{"delete entry", "DELETE FROM audit.entries WHERE id = $1", []any{entry.ID}},
+		{"truncate entries", "TRUNCATE audit.entries", nil},
+		{"update checkpoint", "UPDATE audit.checkpoints SET witness_status = 'failed' WHERE id = $1", []any{checkpoint.ID}},
+		{"delete checkpoint", "DELETE FROM audit.checkpoints WHERE id = $1", []any{checkpoint.ID}},
+		{"truncate checkpoints", "TRUNCATE audit.checkpoints", nil},
+	}
+
+	for _, st := range statements {
+		t.Run(st.name, func(t *testing.T) {
+			// Rolled back either way, so a missing trigger cannot damage the database
+			tx, err := pool.Begin(ctx)
+			if err != nil {
+				t.Fatalf("Begin failed: %v", err)
+			}
+			defer tx.Rollback(ctx)
+
+			_, err = tx.Exec(ctx, st.sql, st.args...)
+			if err == nil || !strings.Contains(err.Error(), "cannot be modified or deleted") {
+				t.Errorf("Expected %s to be rejected by the append-only trigger, got %v", st.name, err)
+			}
+		})
+	}
+
+	found, err := repo.FindByID(ctx, entry.ID)
+	if err != nil || found.Hash != entry.Hash || found.Action != entry.Action {
+		t.Errorf("Entry should be unchanged (%v)", err)
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/serbia-gov/platform/internal/shared/errors"
@@ -37,7 +40,10 @@ type Checkpoint struct {
 	CheckpointHash string        `json:"checkpoint_hash"`
 	LastSequence   int64         `json:"last_sequence"`
 	LastEntryID    types.ID      `json:"last_entry_id"`
+	LastHash       string        `json:"last_hash,omitempty"`
 	EntryCount     int           `json:"entry_count"`
+	TreeSize       int64         `json:"tree_size,omitempty"` // Merkle tree size (entries 1..TreeSize)
+	RootHash       string        `json:"root_hash,omitempty"` // Merkle tree root; empty for checkpoints that predate the tree
 	WitnessType    WitnessType   `json:"witness_type"`
 	WitnessProof   []byte        `json:"witness_proof,omitempty"`
 	WitnessURL     string        `json:"witness_url,omitempty"`
@@ -51,8 +57,10 @@ type Witness interface {
 	// Type returns the witness type
 	Type() WitnessType
 
-	// Timestamp submits a hash to the witness service and returns proof
-	Timestamp(ctx context.Context, hash string, lastSequence int64, entryCount int) (proof []byte, url string, err error)
+	// Timestamp submits a hash to the witness service and returns proof.
+	// The checkpoint commits to the Merkle tree root over entries 1 to
+	// lastSequence.
+	Timestamp(ctx context.Context, hash string, lastSequence int64, entryCount int, rootHash string) (proof []byte, url string, err error)
 
 	// Verify checks if a hash matches the stored proof
 	Verify(ctx context.Context, hash string, proof []byte) (bool, error)
@@ -72,7 +80,7 @@ func (w *LocalWitness) Type() WitnessType {
 	return WitnessTypeLocal
 }
 
-func (w *LocalWitness) Timestamp(ctx context.Context, hash string, lastSequence int64, entryCount int) ([]byte, string, error) {
+func (w *LocalWitness) Timestamp(ctx context.Context, hash string, lastSequence int64, entryCount int, rootHash string) ([]byte, string, error) {
 	// Local witness just stores the hash with timestamp
 	proof := fmt.Sprintf("LOCAL_WITNESS:%s:%d:%d:%d", hash, lastSequence, entryCount, time.Now().UnixNano())
 	proofHash := sha256.Sum256([]byte(proof))
@@ -103,7 +111,7 @@ func (w *RFC3161Witness) Type() WitnessType {
 	return WitnessTypeRFC3161TSA
 }
 
-func (w *RFC3161Witness) Timestamp(ctx context.Context, hash string, lastSequence int64, entryCount int) ([]byte, string, error) {
+func (w *RFC3161Witness) Timestamp(ctx context.Context, hash string, lastSequence int64, entryCount int, rootHash string) ([]byte, string, error) {
 	if w.tsaServer == nil {
 		return nil, "", fmt.Errorf("TSA server not configured")
 	}
@@ -161,13 +169,13 @@ func (w *MultiAgencyWitness) Type() WitnessType {
 	return WitnessTypeMultiAgency
 }
 
-func (w *MultiAgencyWitness) Timestamp(ctx context.Context, hash string, lastSequence int64, entryCount int) ([]byte, string, error) {
+func (w *MultiAgencyWitness) Timestamp(ctx context.Context, hash string, lastSequence int64, entryCount int, rootHash string) ([]byte, string, error) {
 	if w.witness == nil {
 		return nil, "", fmt.Errorf("multi-agency witness not configured")
 	}
 
-	// Create multi-agency proof
-	proof, err := w.witness.CreateProof(ctx, hash, lastSequence, entryCount)
+	// Create multi-agency proof; the tree has one leaf per entry up to lastSequence
+	proof, err := w.witness.CreateProof(ctx, hash, lastSequence, entryCount, lastSequence, rootHash)
 	if err != nil {
 		return nil, "", fmt.Errorf("multi-agency proof creation failed: %w", err)
 	}
@@ -186,10 +194,10 @@ func (w *MultiAgencyWitness) Verify(ctx context.Context, hash string, proof []by
 		return false, fmt.Errorf("multi-agency witness not configured")
 	}
 
-	// Deserialize proof
-	p, err := tsa.DeserializeProof(proof)
+	// Verify the proof with the signatures collected so far
+	p, err := w.current(ctx, proof)
 	if err != nil {
-		return false, fmt.Errorf("failed to deserialize proof: %w", err)
+		return false, err
 	}
 
 	// Verify hash matches
@@ -207,22 +215,80 @@ func (w *MultiAgencyWitness) Verify(ctx context.Context, hash string, proof []by
 }
 
 func (w *MultiAgencyWitness) GetStatus(ctx context.Context, proof []byte) (WitnessStatus, error) {
-	// Deserialize and check status
-	p, err := tsa.DeserializeProof(proof)
+	p, err := w.current(ctx, proof)
 	if err != nil {
 		return WitnessStatusFailed, err
 	}
 
 	switch p.Status {
-	case "confirmed":
+	case tsa.ProofStatusConfirmed:
 		return WitnessStatusConfirmed, nil
-	case "pending":
+	case tsa.ProofStatusPending:
+		// A proof whose collection was lost cannot be completed any more
+		if !p.Deadline.IsZero() && time.Now().After(p.Deadline) {
+			return WitnessStatusFailed, nil
+		}
 		return WitnessStatusPending, nil
 	default:
 		return WitnessStatusFailed, nil
 	}
 }
 
+// CurrentProof returns the proof with the signatures collected since it was
+// created
+func (w *MultiAgencyWitness) CurrentProof(ctx context.Context, proof []byte) ([]byte, error) {
+	p, err := w.current(ctx, proof)
+	if err != nil {
+		return nil, err
+	}
+	return p.Serialize()
+}
+
+// setConsistencyProver lets the witness prove to the other agencies that a
+// checkpoint's tree extends the trees they cosigned before
+func (w *MultiAgencyWitness) setConsistencyProver(prover tsa.ConsistencyProver) {
+	if w.witness != nil {
+		w.witness.SetConsistencyProver(prover)
+	}
+}
+
+// current decodes a proof and looks up its current state; proofs the
+// witness no longer holds are returned as stored
+func (w *MultiAgencyWitness) current(ctx context.Context, proof []byte) (*tsa.MultiAgencyProof, error) {
+	p, err := tsa.DeserializeProof(proof)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize proof: %w", err)
+	}
+	if w.witness == nil {
+		return p, nil
+	}
+
+	latest, err := w.witness.GetProof(ctx, p.ID)
+	if err != nil {
+		if stderrors.Is(err, errors.ErrNotFound) {
+			return p, nil
+		}
+		return nil, err
+	}
+	if latest.CheckpointHash != p.CheckpointHash {
+		return p, nil
+	}
+	return latest, nil
+}
+
+// proofUpdater is implemented by witnesses that complete a proof after the
+// checkpoint holding it was saved. Checkpoints are append-only, so the
+// current proof is looked up whenever a checkpoint is read.
+type proofUpdater interface {
+	CurrentProof(ctx context.Context, proof []byte) ([]byte, error)
+}
+
+// consistencyProving is implemented by witnesses that must prove that the
+// tree of a checkpoint extends the trees witnessed before
+type consistencyProving interface {
+	setConsistencyProver(prover tsa.ConsistencyProver)
+}
+
 // CompositeWitness combines multiple witness types for maximum security.
 // It collects proofs from all configured witnesses.
 type CompositeWitness struct {
@@ -233,24 +299,30 @@ func NewCompositeWitness(witnesses ...Witness) *CompositeWitness {
 	return &CompositeWitness{witnesses: witnesses}
 }
 
+// compositeProof is the serialized form of the proofs collected by a CompositeWitness
+type compositeProof struct {
+	Proofs []compositeProofEntry `json:"proofs"`
+}
+
+type compositeProofEntry struct {
+	Type  WitnessType `json:"type"`
+	Proof string      `json:"proof"` // base64
+}
+
 func (w *CompositeWitness) Type() WitnessType {
 	return "composite"
 }
 
-func (w *CompositeWitness) Timestamp(ctx context.Context, hash string, lastSequence int64, entryCount int) ([]byte, string, error) {
-	type proofEntry struct {
-		Type  WitnessType `json:"type"`
-		Proof string      `json:"proof"` // base64
-	}
-
-	var proofs []proofEntry
+func (w *CompositeWitness) Timestamp(ctx context.Context, hash string, lastSequence int64, entryCount int, rootHash string) ([]byte, string, error) {
+	var proofs []compositeProofEntry
 	for _, witness := range w.witnesses {
-		proof, _, err := witness.Timestamp(ctx, hash, lastSequence, entryCount)
+		proof, _, err := witness.Timestamp(ctx, hash, lastSequence, entryCount, rootHash)
 		if err != nil {
 			// Log but continue with other witnesses
+			fmt.Printf("Warning: %s witness failed: %v\n", witness.Type(), err)
 			continue
 		}
-		proofs = append(proofs, proofEntry{
+		proofs = append(proofs, compositeProofEntry{
 			Type:  witness.Type(),
 			Proof: base64.StdEncoding.EncodeToString(proof),
 		})
@@ -261,11 +333,7 @@ func (w *CompositeWitness) Timestamp(ctx context.Context, hash string, lastSeque
 	}
 
 	// Serialize all proofs
-	composite := struct {
-		Proofs []proofEntry `json:"proofs"`
-	}{Proofs: proofs}
-
-	data, err := canonicalJSON(composite)
+	data, err := canonicalJSON(compositeProof{Proofs: proofs})
 	if err != nil {
 		return nil, "", err
 	}
@@ -273,10 +341,38 @@ func (w *CompositeWitness) Timestamp(ctx context.Context, hash string, lastSeque
 	return data, "", nil
 }
 
+// proofs decodes a composite proof into the proof of each witness that produced one
+func (w *CompositeWitness) proofs(proof []byte) (map[Witness][]byte, error) {
+	var composite compositeProof
+	if err := json.Unmarshal(proof, &composite); err != nil {
+		return nil, fmt.Errorf("failed to decode composite proof: %w", err)
+	}
+
+	out := make(map[Witness][]byte)
+	for _, entry := range composite.Proofs {
+		raw, err := base64.StdEncoding.DecodeString(entry.Proof)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s proof: %w", entry.Type, err)
+		}
+		for _, witness := range w.witnesses {
+			if witness.Type() == entry.Type {
+				out[witness] = raw
+			}
+		}
+	}
+
+	return out, nil
+}
+
 func (w *CompositeWitness) Verify(ctx context.Context, hash string, proof []byte) (bool, error) {
+	proofs, err := w.proofs(proof)
+	if err != nil {
+		return false, err
+	}
+
 	// At least one witness must verify
-	for _, witness := range w.witnesses {
-		valid, err := witness.Verify(ctx, hash, proof)
+	for witness, p := range proofs {
+		valid, err := witness.Verify(ctx, hash, p)
 		if err == nil && valid {
 			return true, nil
 		}
@@ -284,10 +380,52 @@ func (w *CompositeWitness) Verify(ctx context.Context, hash string, proof []byte
 	return false, nil
 }
 
+// CurrentProof updates the proofs of witnesses that complete them later
+func (w *CompositeWitness) CurrentProof(ctx context.Context, proof []byte) ([]byte, error) {
+	var composite compositeProof
+	if err := json.Unmarshal(proof, &composite); err != nil {
+		return nil, fmt.Errorf("failed to decode composite proof: %w", err)
+	}
+
+	for i, entry := range composite.Proofs {
+		for _, witness := range w.witnesses {
+			updater, ok := witness.(proofUpdater)
+			if !ok || witness.Type() != entry.Type {
+				continue
+			}
+			raw, err := base64.StdEncoding.DecodeString(entry.Proof)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode %s proof: %w", entry.Type, err)
+			}
+			updated, err := updater.CurrentProof(ctx, raw)
+			if err != nil {
+				return nil, err
+			}
+			composite.Proofs[i].Proof = base64.StdEncoding.EncodeToString(updated)
+		}
+	}
+
+	return canonicalJSON(composite)
+}
+
+// setConsistencyProver passes the prover to the witnesses that need one
+func (w *CompositeWitness) setConsistencyProver(prover tsa.ConsistencyProver) {
+	for _, witness := range w.witnesses {
+		if proving, ok := witness.(consistencyProving); ok {
+			proving.setConsistencyProver(prover)
+		}
+	}
+}
+
 func (w *CompositeWitness) GetStatus(ctx context.Context, proof []byte) (WitnessStatus, error) {
+	proofs, err := w.proofs(proof)
+	if err != nil {
+		return WitnessStatusFailed, err
+	}
+
 	// Return confirmed if any witness is confirmed
-	for _, witness := range w.witnesses {
-		status, err := witness.GetStatus(ctx, proof)
+	for witness, p := range proofs {
+		status, err := witness.GetStatus(ctx, p)
 		if err == nil && status == WitnessStatusConfirmed {
 			return WitnessStatusConfirmed, nil
 		}
@@ -299,40 +437,40 @@ func (w *CompositeWitness) GetStatus(ctx context.Context, proof []byte) (Witness
 type CheckpointService struct {
 	repo    AuditRepository
 	witness Witness
+	merkle  *MerkleLog
 }
 
 func NewCheckpointService(repo AuditRepository, witness Witness) *CheckpointService {
 	if witness == nil {
 		witness = NewLocalWitness()
 	}
-	return &CheckpointService{repo: repo, witness: witness}
+	merkle := NewMerkleLog(repo)
+	if proving, ok := witness.(consistencyProving); ok {
+		proving.setConsistencyProver(merkle)
+	}
+	return &CheckpointService{repo: repo, witness: witness, merkle: merkle}
 }
 
-// CreateCheckpoint creates a new checkpoint of the current audit chain state
+// CreateCheckpoint creates a new checkpoint of the current audit chain state.
+// The checkpoint commits to the Merkle tree root over all entries, so any
+// entry can later be proven to be included in it.
 func (s *CheckpointService) CreateCheckpoint(ctx context.Context) (*Checkpoint, error) {
-	// Get last hash and sequence from repository
-	lastHash := s.repo.GetLastHash()
-	lastSequence := s.repo.GetSequence()
-
-	if lastHash == "" {
-		return nil, errors.BadRequest("no audit entries to checkpoint")
+	head, err := s.merkle.Sync(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build audit Merkle tree")
 	}
 
-	// Get total count
-	count, err := s.repo.Count(ctx)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to count audit entries")
+	if head.TreeSize == 0 {
+		return nil, errors.BadRequest("no audit entries to checkpoint")
 	}
 
-	// Calculate checkpoint hash (hash of: last_hash + sequence + count + timestamp)
+	// Calculate checkpoint hash (hash of: last_hash + sequence + count + root + timestamp)
 	now := time.Now().UTC()
-	checkpointData := fmt.Sprintf("%s:%d:%d:%d",
-		lastHash, lastSequence, count, now.UnixNano())
-	checkpointHashBytes := sha256.Sum256([]byte(checkpointData))
-	checkpointHash := hex.EncodeToString(checkpointHashBytes[:])
+	count := int(head.TreeSize)
+	checkpointHash := computeCheckpointHash(head.LastHash, head.TreeSize, count, head.RootHash, now)
 
 	// Get witness proof
-	proof, url, err := s.witness.Timestamp(ctx, checkpointHash, lastSequence, count)
+	proof, url, err := s.witness.Timestamp(ctx, checkpointHash, head.TreeSize, count, head.RootHash)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get witness timestamp")
 	}
@@ -344,9 +482,12 @@ func (s *CheckpointService) CreateCheckpoint(ctx context.Context) (*Checkpoint,
 	checkpoint := &Checkpoint{
 		ID:             types.NewID(),
 		CheckpointHash: checkpointHash,
-		LastSequence:   lastSequence,
-		LastEntryID:    "", // We don't have easy access to last entry ID without another query
+		LastSequence:   head.TreeSize,
+		LastEntryID:    head.LastEntryID,
+		LastHash:       head.LastHash,
 		EntryCount:     count,
+		TreeSize:       head.TreeSize,
+		RootHash:       head.RootHash,
 		WitnessType:    s.witness.Type(),
 		WitnessProof:   proof,
 		WitnessURL:     url,
@@ -366,15 +507,75 @@ func (s *CheckpointService) CreateCheckpoint(ctx context.Context) (*Checkpoint,
 	return checkpoint, nil
 }
 
+// computeCheckpointHash computes the hash that is submitted to the witness
+func computeCheckpointHash(lastHash string, sequence int64, count int, rootHash string, timestamp time.Time) string {
+	data := fmt.Sprintf("%s:%d:%d:%s:%d", lastHash, sequence, count, rootHash, timestamp.UnixNano())
+	hash := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(hash[:])
+}
+
+// computeLegacyCheckpointHash is the hash of checkpoints that predate the
+// Merkle tree; it commits to the last entry, the count and the time only
+func computeLegacyCheckpointHash(lastHash string, sequence int64, count int, timestamp time.Time) string {
+	data := fmt.Sprintf("%s:%d:%d:%d", lastHash, sequence, count, timestamp.UnixNano())
+	hash := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(hash[:])
+}
+
+// checkpointHashMatches reports whether a checkpoint hash matches the
+// checkpoint's contents, with the formula of checkpoints with or without a
+// Merkle root. lastHash is the hash of the entry at the checkpoint's last
+// sequence, which checkpoints without a Merkle root do not record.
+func checkpointHashMatches(cp *Checkpoint, lastHash string) bool {
+	if cp.RootHash == "" {
+		return computeLegacyCheckpointHash(lastHash, cp.LastSequence, cp.EntryCount, cp.CreatedAt) == cp.CheckpointHash
+	}
+	return computeCheckpointHash(lastHash, cp.LastSequence, cp.EntryCount, cp.RootHash, cp.CreatedAt) == cp.CheckpointHash
+}
+
 // GetLatestCheckpoint returns the most recent checkpoint
 func (s *CheckpointService) GetLatestCheckpoint(ctx context.Context) (*Checkpoint, error) {
-	return s.repo.GetLatestCheckpoint(ctx)
+	cp, err := s.repo.GetLatestCheckpoint(ctx)
+	if err != nil || cp == nil {
+		return cp, err
+	}
+	s.withCurrentProof(ctx, cp)
+	return cp, nil
+}
+
+// GetCheckpoint returns a checkpoint by ID
+func (s *CheckpointService) GetCheckpoint(ctx context.Context, id types.ID) (*Checkpoint, error) {
+	cp, err := s.repo.GetCheckpoint(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.withCurrentProof(ctx, cp)
+	return cp, nil
+}
+
+// withCurrentProof replaces the witness proof and status of a checkpoint
+// with their current state, for witnesses that complete proofs later
+func (s *CheckpointService) withCurrentProof(ctx context.Context, cp *Checkpoint) {
+	updater, ok := s.witness.(proofUpdater)
+	if !ok || cp.WitnessType != s.witness.Type() {
+		return
+	}
+
+	proof, err := updater.CurrentProof(ctx, cp.WitnessProof)
+	if err != nil {
+		fmt.Printf("Warning: current witness proof of checkpoint %s unavailable: %v\n", cp.ID, err)
+		return
+	}
+	cp.WitnessProof = proof
+	if status, err := s.witness.GetStatus(ctx, proof); err == nil {
+		cp.WitnessStatus = status
+	}
 }
 
 // VerifyCheckpoint verifies that the checkpoint matches the current chain state
 func (s *CheckpointService) VerifyCheckpoint(ctx context.Context, checkpointID types.ID) (*CheckpointVerifyResult, error) {
 	// Get checkpoint
-	cp, err := s.repo.GetCheckpoint(ctx, checkpointID)
+	cp, err := s.GetCheckpoint(ctx, checkpointID)
 	if err != nil {
 		return nil, err
 	}
@@ -399,6 +600,24 @@ func (s *CheckpointService) VerifyCheckpoint(ctx context.Context, checkpointID t
 				cp.EntryCount, count))
 	}
 
+	// Verify the Merkle root still matches the entries it committed to
+	if cp.RootHash != "" {
+		root, err := s.merkle.RootAt(ctx, cp.TreeSize)
+		if err != nil {
+			result.EntriesIntact = false
+			result.Violations = append(result.Violations, "Failed to rebuild Merkle tree: "+err.Error())
+		} else if root != cp.RootHash {
+			result.EntriesIntact = false
+			result.Violations = append(result.Violations,
+				fmt.Sprintf("Merkle root mismatch at tree size %d", cp.TreeSize))
+		}
+
+		if !checkpointHashMatches(cp, cp.LastHash) {
+			result.ChainValid = false
+			result.Violations = append(result.Violations, "Checkpoint hash does not match its contents")
+		}
+	}
+
 	// Verify witness proof
 	if s.witness.Type() == cp.WitnessType {
 		valid, err := s.witness.Verify(ctx, cp.CheckpointHash, cp.WitnessProof)
@@ -418,7 +637,169 @@ func (s *CheckpointService) ListCheckpoints(ctx context.Context, limit int) ([]C
 	if limit <= 0 || limit > 100 {
 		limit = 20
 	}
-	return s.repo.ListCheckpoints(ctx, limit)
+	checkpoints, err := s.repo.ListCheckpoints(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range checkpoints {
+		s.withCurrentProof(ctx, &checkpoints[i])
+	}
+	return checkpoints, nil
+}
+
+// ArchiveObjects lists checkpoints for archive timestamping
+// (tsa.ArchiveSource), oldest first. A checkpoint witnessed by the TSA is
+// protected by its token; others get an archive timestamp over their hash.
+func (s *CheckpointService) ArchiveObjects(ctx context.Context, after time.Time, limit int) ([]tsa.ArchiveObject, error) {
+	checkpoints, err := s.repo.ListCheckpoints(ctx, maxExportCheckpoints)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(checkpoints, func(i, j int) bool {
+		return checkpoints[i].CreatedAt.Before(checkpoints[j].CreatedAt)
+	})
+
+	objects := []tsa.ArchiveObject{}
+	for _, cp := range checkpoints {
+		if cp.CreatedAt.Before(after) {
+			continue
+		}
+		if len(objects) == limit {
+			break
+		}
+		hash, err := hex.DecodeString(cp.CheckpointHash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash of checkpoint %s: %w", cp.ID, err)
+		}
+		obj := tsa.ArchiveObject{ID: cp.ID.String(), Hash: hash, CreatedAt: cp.CreatedAt}
+		if cp.WitnessType == WitnessTypeRFC3161TSA && len(cp.WitnessProof) > 0 {
+			obj.Token = cp.WitnessProof
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// InclusionProof proves that an audit entry is included in the tree committed to by a checkpoint
+type InclusionProof struct {
+	EntryID      types.ID `json:"entry_id"`
+	Sequence     int64    `json:"sequence"`
+	LeafIndex    int64    `json:"leaf_index"`
+	EntryHash    string   `json:"entry_hash"`
+	LeafHash     string   `json:"leaf_hash"`
+	CheckpointID types.ID `json:"checkpoint_id"`
+	TreeSize     int64    `json:"tree_size"`
+	RootHash     string   `json:"root_hash"`
+	Proof        []string `json:"proof"`
+}
+
+// ConsistencyProof proves that a later checkpoint's tree extends an earlier one's
+type ConsistencyProof struct {
+	FromCheckpointID types.ID `json:"from_checkpoint_id"`
+	ToCheckpointID   types.ID `json:"to_checkpoint_id"`
+	FromTreeSize     int64    `json:"from_tree_size"`
+	ToTreeSize       int64    `json:"to_tree_size"`
+	FromRootHash     string   `json:"from_root_hash"`
+	ToRootHash       string   `json:"to_root_hash"`
+	Proof            []string `json:"proof"`
+}
+
+// InclusionProof returns the inclusion proof for an entry against a
+// checkpoint. If checkpointID is nil the latest checkpoint is used.
+func (s *CheckpointService) InclusionProof(ctx context.Context, entryID types.ID, checkpointID *types.ID) (*InclusionProof, error) {
+	entry, err := s.repo.FindByID(ctx, entryID)
+	if err != nil {
+		return nil, err
+	}
+
+	cp, err := s.merkleCheckpoint(ctx, checkpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Sequence > cp.TreeSize {
+		return nil, errors.BadRequest(fmt.Sprintf(
+			"entry %d is not covered by checkpoint %s (tree size %d)", entry.Sequence, cp.ID, cp.TreeSize))
+	}
+
+	leaf, err := EntryLeafHash(entry.Hash)
+	if err != nil {
+		return nil, errors.Internal(err)
+	}
+
+	proof, err := s.merkle.InclusionProof(ctx, entry.Sequence, cp.TreeSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compute inclusion proof")
+	}
+
+	return &InclusionProof{
+		EntryID:      entry.ID,
+		Sequence:     entry.Sequence,
+		LeafIndex:    entry.Sequence - 1,
+		EntryHash:    entry.Hash,
+		LeafHash:     hex.EncodeToString(leaf),
+		CheckpointID: cp.ID,
+		TreeSize:     cp.TreeSize,
+		RootHash:     cp.RootHash,
+		Proof:        proof,
+	}, nil
+}
+
+// ConsistencyProof returns the proof that the tree of checkpoint toID
+// extends the tree of checkpoint fromID. If toID is nil the latest
+// checkpoint is used.
+func (s *CheckpointService) ConsistencyProof(ctx context.Context, fromID types.ID, toID *types.ID) (*ConsistencyProof, error) {
+	from, err := s.merkleCheckpoint(ctx, &fromID)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := s.merkleCheckpoint(ctx, toID)
+	if err != nil {
+		return nil, err
+	}
+
+	if from.TreeSize > to.TreeSize {
+		return nil, errors.BadRequest("from checkpoint must not be newer than to checkpoint")
+	}
+
+	proof, err := s.merkle.ConsistencyProof(ctx, from.TreeSize, to.TreeSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compute consistency proof")
+	}
+
+	return &ConsistencyProof{
+		FromCheckpointID: from.ID,
+		ToCheckpointID:   to.ID,
+		FromTreeSize:     from.TreeSize,
+		ToTreeSize:       to.TreeSize,
+		FromRootHash:     from.RootHash,
+		ToRootHash:       to.RootHash,
+		Proof:            proof,
+	}, nil
+}
+
+// merkleCheckpoint loads a checkpoint that commits to a Merkle root
+func (s *CheckpointService) merkleCheckpoint(ctx context.Context, id *types.ID) (*Checkpoint, error) {
+	var cp *Checkpoint
+	var err error
+	if id != nil {
+		cp, err = s.repo.GetCheckpoint(ctx, *id)
+	} else {
+		cp, err = s.repo.GetLatestCheckpoint(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cp == nil {
+		return nil, errors.NotFound("checkpoint", "latest")
+	}
+	if cp.RootHash == "" {
+		return nil, errors.BadRequest(fmt.Sprintf("checkpoint %s predates Merkle tree commitments", cp.ID))
+	}
+
+	return cp, nil
 }
 
 // CheckpointVerifyResult contains checkpoint verification results
@@ -0,0 +1,428 @@
+package audit
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/serbia-gov/platform/internal/federation/gateway"
+	"github.com/serbia-gov/platform/internal/shared/config"
+	"github.com/serbia-gov/platform/internal/shared/types"
+	"github.com/serbia-gov/platform/internal/tsa"
+)
+
+// WitnessDeps are the services a witness created from configuration shares
+// with the rest of the platform; all are optional
+type WitnessDeps struct {
+	// TSA issues RFC 3161 timestamps; one is created from the configuration when nil
+	TSA *tsa.Server
+	// Gateway carries cosigning requests to other agencies
+	Gateway *gateway.Gateway
+	// Proofs keeps multi-agency proofs while signatures are collected, across restarts
+	Proofs tsa.ProofStore
+}
+
+// NewWitnessFromConfig creates the checkpoint witness selected by the TSA
+// configuration. Without a certificate and key the TSA and the local agency
+// identity use self-signed development certificates.
+func NewWitnessFromConfig(cfg config.TSAConfig, deps WitnessDeps) (Witness, error) {
+	if !cfg.Enabled {
+		return NewLocalWitness(), nil
+	}
+
+	switch WitnessType(cfg.WitnessType) {
+	case "", WitnessTypeLocal:
+		return NewLocalWitness(), nil
+
+	case WitnessTypeRFC3161TSA:
+		return newRFC3161WitnessFromConfig(cfg, deps.TSA)
+
+	case WitnessTypeMultiAgency:
+		return newMultiAgencyWitnessFromConfig(cfg, deps)
+
+	case "composite":
+		tsaWitness, err := newRFC3161WitnessFromConfig(cfg, deps.TSA)
+		if err != nil {
+			return nil, err
+		}
+		witnesses := []Witness{tsaWitness}
+
+		if cfg.MultiAgencyEnabled {
+			multiWitness, err := newMultiAgencyWitnessFromConfig(cfg, deps)
+			if err != nil {
+				return nil, err
+			}
+			witnesses = append(witnesses, multiWitness)
+		}
+
+		return NewCompositeWitness(witnesses...), nil
+
+	default:
+		return nil, fmt.Errorf("unknown witness type: %s", cfg.WitnessType)
+	}
+}
+
+func newRFC3161WitnessFromConfig(cfg config.TSAConfig, server *tsa.Server) (*RFC3161Witness, error) {
+	if server == nil {
+		var err error
+		server, err = NewTSAServerFromConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewRFC3161Witness(server), nil
+}
+
+// NewTSAServerFromConfig creates the TSA from the configured PKCS#12 file or
+// certificate and key, or with a self-signed development certificate
+func NewTSAServerFromConfig(cfg config.TSAConfig) (*tsa.Server, error) {
+	var server *tsa.Server
+	var err error
+	switch {
+	case cfg.PKCS12Path != "":
+		server, err = tsa.NewServerFromPKCS12(cfg.PKCS12Path, cfg.PKCS12Password)
+	case cfg.CertPath != "" && cfg.KeyPath != "":
+		server, err = tsa.NewServerFromFiles(cfg.CertPath, cfg.KeyPath)
+	default:
+		server, err = tsa.NewServerWithGeneratedCert(cfg.OrgName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create TSA server: %w", err)
+	}
+
+	if cfg.PolicyOID != "" {
+		if err := server.SetPolicyOID(cfg.PolicyOID); err != nil {
+			return nil, fmt.Errorf("invalid TSA policy: %w", err)
+		}
+	}
+
+	return server, nil
+}
+
+// NewArchiverFromConfig creates the archiver that renews archive timestamps
+// with the TSA
+func NewArchiverFromConfig(cfg config.TSAConfig, server *tsa.Server) (*tsa.Archiver, error) {
+	hash, err := tsa.ParseHashAlgorithm(cfg.ArchiveHashAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive hash algorithm: %w", err)
+	}
+
+	return tsa.NewArchiver(server, &tsa.ArchiveConfig{
+		RenewBefore:   time.Duration(cfg.ArchiveRenewBeforeDays) * 24 * time.Hour,
+		HashAlgorithm: hash,
+		Interval:      time.Duration(cfg.ArchiveIntervalHours) * time.Hour,
+	}), nil
+}
+
+// loadKeyPairFromConfig loads the configured PKCS#12 file or certificate and
+// key; ok is false when neither is configured
+func loadKeyPairFromConfig(cfg config.TSAConfig) (chain []*x509.Certificate, key crypto.Signer, ok bool, err error) {
+	switch {
+	case cfg.PKCS12Path != "":
+		chain, key, err = tsa.LoadPKCS12(cfg.PKCS12Path, cfg.PKCS12Password)
+	case cfg.CertPath != "" && cfg.KeyPath != "":
+		chain, key, err = tsa.LoadKeyPair(cfg.CertPath, cfg.KeyPath)
+	default:
+		return nil, nil, false, nil
+	}
+	return chain, key, true, err
+}
+
+func newMultiAgencyWitnessFromConfig(cfg config.TSAConfig, deps WitnessDeps) (*MultiAgencyWitness, error) {
+	local, err := NewLocalAgencyFromConfig(cfg, deps.Gateway)
+	if err != nil {
+		return nil, err
+	}
+
+	witness, err := tsa.NewMultiAgencyWitness(&tsa.MultiAgencyConfig{
+		Enabled:       true,
+		MinSignatures: cfg.MultiAgencyMinSignatures,
+		Deadline:      time.Duration(cfg.MultiAgencyDeadlineMinutes) * time.Minute,
+	}, local)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multi-agency witness: %w", err)
+	}
+	if deps.Gateway != nil {
+		witness.SetGateway(deps.Gateway)
+	}
+	if deps.Proofs != nil {
+		witness.SetProofStore(deps.Proofs)
+		// Collection of proofs pending before a restart continues
+		if _, err := witness.Resume(context.Background()); err != nil {
+			fmt.Printf("Warning: pending witness proofs not resumed: %v\n", err)
+		}
+	}
+
+	return NewMultiAgencyWitness(witness), nil
+}
+
+// NewLocalAgencyFromConfig creates the identity this node signs with as a
+// multi-agency witness, from the configured key or with a self-signed
+// development certificate. Over federation the node is known by the agency
+// code of its gateway gw.
+func NewLocalAgencyFromConfig(cfg config.TSAConfig, gw *gateway.Gateway) (*tsa.LocalAgency, error) {
+	agencyCode := cfg.AgencyCode
+	if gw != nil {
+		agencyCode = gw.AgencyCode()
+	}
+
+	chain, key, ok, err := loadKeyPairFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return tsa.NewLocalAgencyWithGeneratedCert(agencyCode, cfg.OrgName)
+	}
+
+	return &tsa.LocalAgency{
+		AgencyCode:  agencyCode,
+		AgencyName:  cfg.OrgName,
+		PrivateKey:  key,
+		Certificate: chain[0],
+	}, nil
+}
+
+// RetryWitness retries failed timestamp requests with exponential backoff
+type RetryWitness struct {
+	Witness
+	retries int
+	delay   time.Duration
+}
+
+// NewRetryWitness wraps a witness so that failed timestamp requests are
+// retried up to retries times, starting after delay and doubling each time
+func NewRetryWitness(witness Witness, retries int, delay time.Duration) *RetryWitness {
+	return &RetryWitness{Witness: witness, retries: retries, delay: delay}
+}
+
+func (w *RetryWitness) Timestamp(ctx context.Context, hash string, lastSequence int64, entryCount int, rootHash string) ([]byte, string, error) {
+	delay := w.delay
+	for attempt := 0; ; attempt++ {
+		proof, url, err := w.Witness.Timestamp(ctx, hash, lastSequence, entryCount, rootHash)
+		if err == nil || attempt >= w.retries {
+			if err != nil && w.retries > 0 {
+				err = fmt.Errorf("%w (after %d attempts)", err, attempt+1)
+			}
+			return proof, url, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// CurrentProof forwards to the wrapped witness if it completes proofs later
+func (w *RetryWitness) CurrentProof(ctx context.Context, proof []byte) ([]byte, error) {
+	if updater, ok := w.Witness.(proofUpdater); ok {
+		return updater.CurrentProof(ctx, proof)
+	}
+	return proof, nil
+}
+
+// setConsistencyProver forwards to the wrapped witness if it needs a prover
+func (w *RetryWitness) setConsistencyProver(prover tsa.ConsistencyProver) {
+	if proving, ok := w.Witness.(consistencyProving); ok {
+		proving.setConsistencyProver(prover)
+	}
+}
+
+// CheckpointerConfig controls when checkpoints are created
+type CheckpointerConfig struct {
+	// Interval is the maximum time between checkpoints while entries are pending
+	Interval time.Duration
+	// EveryEntries creates a checkpoint once this many entries are pending (0 disables)
+	EveryEntries int64
+	// PollInterval is how often the number of pending entries is checked
+	PollInterval time.Duration
+}
+
+// CheckpointAlert is raised when a checkpoint could not be created or witnessed
+type CheckpointAlert struct {
+	Reason              string        `json:"reason"`
+	Error               string        `json:"error,omitempty"`
+	CheckpointID        types.ID      `json:"checkpoint_id,omitempty"`
+	WitnessType         WitnessType   `json:"witness_type"`
+	WitnessStatus       WitnessStatus `json:"witness_status,omitempty"`
+	PendingEntries      int64         `json:"pending_entries"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	LastCheckpointAt    *time.Time    `json:"last_checkpoint_at,omitempty"`
+	RaisedAt            time.Time     `json:"raised_at"`
+}
+
+// Checkpointer creates witnessed checkpoints periodically, every Interval
+// or every EveryEntries entries, whichever comes first
+type Checkpointer struct {
+	service *CheckpointService
+	config  CheckpointerConfig
+	alert   func(ctx context.Context, alert CheckpointAlert)
+
+	mu           sync.Mutex
+	lastSequence int64
+	lastAt       *time.Time
+	failures     int
+	nextAttempt  time.Time
+	pending      map[types.ID]bool // checkpoints whose witness has not confirmed yet
+}
+
+// NewCheckpointer creates a new checkpointer
+func NewCheckpointer(service *CheckpointService, cfg CheckpointerConfig) *Checkpointer {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 30 * time.Second
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+
+	return &Checkpointer{
+		service: service,
+		config:  cfg,
+		pending: make(map[types.ID]bool),
+		alert: func(ctx context.Context, alert CheckpointAlert) {
+			fmt.Printf("ALERT: audit checkpoint %s: %s\n", alert.Reason, alert.Error)
+		},
+	}
+}
+
+// SetAlertHandler sets the function that receives checkpoint alerts
+func (c *Checkpointer) SetAlertHandler(fn func(ctx context.Context, alert CheckpointAlert)) {
+	c.alert = fn
+}
+
+// Start creates checkpoints until the context is cancelled
+func (c *Checkpointer) Start(ctx context.Context) {
+	if latest, err := c.service.GetLatestCheckpoint(ctx); err == nil && latest != nil {
+		c.mu.Lock()
+		c.lastSequence = latest.LastSequence
+		c.lastAt = &latest.CreatedAt
+		c.mu.Unlock()
+	}
+
+	// Witnesses may still complete checkpoints created before a restart
+	if recent, err := c.service.ListCheckpoints(ctx, 100); err == nil {
+		c.mu.Lock()
+		for _, cp := range recent {
+			if cp.WitnessStatus == WitnessStatusPending {
+				c.pending[cp.ID] = true
+			}
+		}
+		c.mu.Unlock()
+	}
+
+	ticker := time.NewTicker(c.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.CheckPending(ctx)
+			if c.due(now) {
+				c.Run(ctx)
+			}
+		}
+	}
+}
+
+// CheckPending follows checkpoints whose witness proof is still pending and
+// raises an alert for those that never reached quorum
+func (c *Checkpointer) CheckPending(ctx context.Context) {
+	c.mu.Lock()
+	ids := make([]types.ID, 0, len(c.pending))
+	for id := range c.pending {
+		ids = append(ids, id)
+	}
+	c.mu.Unlock()
+
+	for _, id := range ids {
+		cp, err := c.service.GetCheckpoint(ctx, id)
+		if err != nil || cp.WitnessStatus == WitnessStatusPending {
+			continue
+		}
+
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+
+		if cp.WitnessStatus != WitnessStatusConfirmed {
+			c.alert(ctx, CheckpointAlert{
+				Reason:        "quorum_not_reached",
+				Error:         "witness proof expired without enough signatures",
+				CheckpointID:  cp.ID,
+				WitnessType:   cp.WitnessType,
+				WitnessStatus: cp.WitnessStatus,
+				RaisedAt:      time.Now(),
+			})
+		}
+	}
+}
+
+// due reports whether a checkpoint should be created now
+func (c *Checkpointer) due(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending := c.service.repo.GetSequence() - c.lastSequence
+	if pending <= 0 || now.Before(c.nextAttempt) {
+		return false
+	}
+	if c.config.EveryEntries > 0 && pending >= c.config.EveryEntries {
+		return true
+	}
+	return c.lastAt == nil || now.Sub(*c.lastAt) >= c.config.Interval
+}
+
+// Run creates a checkpoint now and raises an alert if it could not be witnessed
+func (c *Checkpointer) Run(ctx context.Context) (*Checkpoint, error) {
+	cp, err := c.service.CreateCheckpoint(ctx)
+
+	c.mu.Lock()
+	now := time.Now()
+	alert := CheckpointAlert{
+		WitnessType:      c.service.witness.Type(),
+		PendingEntries:   c.service.repo.GetSequence() - c.lastSequence,
+		LastCheckpointAt: c.lastAt,
+		RaisedAt:         now,
+	}
+
+	if err != nil {
+		c.failures++
+		// Back off so that a witness outage does not raise an alert on every poll
+		backoff := c.config.PollInterval << min(c.failures, 10)
+		c.nextAttempt = now.Add(min(backoff, c.config.Interval))
+		alert.Reason = "failed"
+		alert.Error = err.Error()
+		alert.ConsecutiveFailures = c.failures
+		c.mu.Unlock()
+
+		c.alert(ctx, alert)
+		return nil, err
+	}
+
+	c.failures = 0
+	c.nextAttempt = time.Time{}
+	c.lastSequence = cp.LastSequence
+	c.lastAt = &cp.CreatedAt
+	if cp.WitnessStatus == WitnessStatusPending {
+		c.pending[cp.ID] = true
+	}
+	c.mu.Unlock()
+
+	// Pending proofs are followed by CheckPending until their deadline
+	if cp.WitnessStatus == WitnessStatusFailed {
+		alert.Reason = "not_witnessed"
+		alert.CheckpointID = cp.ID
+		alert.WitnessStatus = cp.WitnessStatus
+		c.alert(ctx, alert)
+	}
+
+	return cp, nil
+}
@@ -0,0 +1,354 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	roles "github.com/serbia-gov/platform/internal/auth"
+	"github.com/serbia-gov/platform/internal/shared/auth"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// Corrections never change an entry. A supervisor requests a correction,
+// which is appended as a correction.requested entry; a second supervisor
+// approves it, appending the correction entry, or rejects it. All three
+// entries use the corrected entry as their resource, so the corrections of
+// an entry are found by resource.
+
+// CorrectionStatus defines the status of a correction request
+type CorrectionStatus string
+
+const (
+	CorrectionStatusPending  CorrectionStatus = "pending"
+	CorrectionStatusApproved CorrectionStatus = "approved"
+	CorrectionStatusRejected CorrectionStatus = "rejected"
+)
+
+// correctionResourceType is the resource type of correction entries
+const correctionResourceType = "correction"
+
+// maxCorrections bounds the correction entries read for one entry
+const maxCorrections = 100
+
+var correctionReasons = map[CorrectionReason]bool{
+	CorrectionReasonDataEntry:        true,
+	CorrectionReasonLegalRequirement: true,
+	CorrectionReasonCourtOrder:       true,
+	CorrectionReasonCitizenRequest:   true,
+	CorrectionReasonSystemError:      true,
+	CorrectionReasonOther:            true,
+}
+
+// CorrectionInput is the request body for requesting a correction
+type CorrectionInput struct {
+	Reason        CorrectionReason `json:"reason"`
+	Justification string           `json:"justification"`
+	OldValue      map[string]any   `json:"old_value,omitempty"`
+	NewValue      map[string]any   `json:"new_value,omitempty"`
+}
+
+// CorrectionRequest is a requested correction and its outcome
+type CorrectionRequest struct {
+	ID              types.ID         `json:"id"` // ID of the correction.requested entry
+	OriginalEntryID types.ID         `json:"original_entry_id"`
+	Status          CorrectionStatus `json:"status"`
+	Reason          CorrectionReason `json:"reason"`
+	Justification   string           `json:"justification"`
+	OldValue        map[string]any   `json:"old_value,omitempty"`
+	NewValue        map[string]any   `json:"new_value,omitempty"`
+	RequestedBy     types.ID         `json:"requested_by"`
+	RequestedAt     time.Time        `json:"requested_at"`
+
+	DecidedBy       *types.ID  `json:"decided_by,omitempty"`
+	DecidedAt       *time.Time `json:"decided_at,omitempty"`
+	DecisionEntryID *types.ID  `json:"decision_entry_id,omitempty"` // correction or correction.rejected entry
+	RejectionReason string     `json:"rejection_reason,omitempty"`
+
+	// Requester as recorded; the correction entry is appended in their name
+	actorType ActorType
+	agencyID  *types.ID
+}
+
+// EntryWithCorrections is an audit entry with the approved corrections that reference it
+type EntryWithCorrections struct {
+	*AuditEntry
+	Corrections []*AuditEntry `json:"corrections,omitempty"`
+}
+
+// CorrectionService appends correction requests, approvals and rejections
+type CorrectionService struct {
+	repo AuditRepository
+	mu   sync.Mutex // serializes decisions so a request is decided once
+}
+
+// NewCorrectionService creates a new correction service
+func NewCorrectionService(repo AuditRepository) *CorrectionService {
+	return &CorrectionService{repo: repo}
+}
+
+// CanSuperviseCorrections reports whether a user may request or approve corrections
+func CanSuperviseCorrections(user *auth.User) bool {
+	return user != nil && (user.IsAdmin() ||
+		user.HasRole(string(roles.RoleAgencySupervisor)) ||
+		user.HasRole(string(roles.RoleAgencyAdmin)))
+}
+
+// Request appends a request to correct an entry
+func (s *CorrectionService) Request(ctx context.Context, requester *auth.User, originalID types.ID, input CorrectionInput) (*CorrectionRequest, error) {
+	if !CanSuperviseCorrections(requester) {
+		return nil, errors.Forbidden("supervisor access required")
+	}
+	if !correctionReasons[input.Reason] {
+		return nil, errors.BadRequest("invalid correction reason")
+	}
+	input.Justification = strings.TrimSpace(input.Justification)
+	if input.Justification == "" {
+		return nil, errors.BadRequest("justification is required")
+	}
+
+	original, err := s.repo.FindByID(ctx, originalID)
+	if err != nil {
+		return nil, err
+	}
+	if original.ResourceType == correctionResourceType && original.Action != ActionCorrection {
+		return nil, errors.BadRequest("correction requests and decisions cannot be corrected")
+	}
+
+	actorType, actorID, agencyID := userActor(requester)
+	entry := NewCorrectionAuditEntry(actorType, actorID, agencyID, CorrectionEntry{
+		OriginalEntryID:   original.ID,
+		OriginalAction:    original.Action,
+		OriginalTimestamp: original.Timestamp,
+		Reason:            input.Reason,
+		Justification:     input.Justification,
+		OldValue:          input.OldValue,
+		NewValue:          input.NewValue,
+	}, "")
+	entry.Action = ActionCorrectionRequested
+	entry.Justification = input.Justification
+
+	if err := s.repo.Append(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return parseCorrectionRequest(entry), nil
+}
+
+// Approve appends the correction of a pending request. The approver must
+// not be the requester.
+func (s *CorrectionService) Approve(ctx context.Context, approver *auth.User, requestID types.ID) (*AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, err := s.pendingRequest(ctx, approver, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := s.repo.FindByID(ctx, request.OriginalEntryID)
+	if err != nil {
+		return nil, err
+	}
+
+	approverID := approver.ID
+	entry := NewCorrectionAuditEntry(request.actorType, request.RequestedBy, request.agencyID, CorrectionEntry{
+		OriginalEntryID:   original.ID,
+		OriginalAction:    original.Action,
+		OriginalTimestamp: original.Timestamp,
+		Reason:            request.Reason,
+		Justification:     request.Justification,
+		ApprovedBy:        &approverID,
+		OldValue:          request.OldValue,
+		NewValue:          request.NewValue,
+		RequestID:         &request.ID,
+	}, "")
+	entry.Justification = request.Justification
+
+	if err := s.repo.Append(ctx, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Reject appends the rejection of a pending request
+func (s *CorrectionService) Reject(ctx context.Context, approver *auth.User, requestID types.ID, reason string) (*CorrectionRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errors.BadRequest("reason is required")
+	}
+
+	request, err := s.pendingRequest(ctx, approver, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	actorType, actorID, agencyID := userActor(approver)
+	entry := NewAuditEntry(actorType, actorID, agencyID, ActionCorrectionRejected, correctionResourceType, &request.OriginalEntryID,
+		map[string]any{
+			"correction": map[string]any{
+				"request_id": request.ID,
+				"reason":     reason,
+			},
+		}, "")
+	entry.Justification = reason
+
+	if err := s.repo.Append(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	request.applyDecision(entry)
+	return request, nil
+}
+
+// Requests returns the correction requests of an entry with their status, newest first
+func (s *CorrectionService) Requests(ctx context.Context, originalID types.ID) ([]*CorrectionRequest, error) {
+	entries, err := s.repo.GetByResource(ctx, correctionResourceType, originalID, maxCorrections)
+	if err != nil {
+		return nil, err
+	}
+
+	requests := []*CorrectionRequest{}
+	byID := make(map[types.ID]*CorrectionRequest)
+	for _, e := range entries {
+		if e.Action == ActionCorrectionRequested {
+			request := parseCorrectionRequest(e)
+			requests = append(requests, request)
+			byID[request.ID] = request
+		}
+	}
+	for _, e := range entries {
+		if requestID := changeID(correctionData(e), "request_id"); requestID != nil {
+			if request, ok := byID[*requestID]; ok {
+				request.applyDecision(e)
+			}
+		}
+	}
+
+	return requests, nil
+}
+
+// Applied returns the approved corrections of an entry, oldest first
+func (s *CorrectionService) Applied(ctx context.Context, originalID types.ID) ([]*AuditEntry, error) {
+	entries, err := s.repo.GetByResource(ctx, correctionResourceType, originalID, maxCorrections)
+	if err != nil {
+		return nil, err
+	}
+	return appliedCorrections(entries), nil
+}
+
+// WithCorrections attaches the approved corrections to each entry. The
+// corrections of all entries are looked up together.
+func (s *CorrectionService) WithCorrections(ctx context.Context, entries []*AuditEntry) ([]EntryWithCorrections, error) {
+	ids := make([]types.ID, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+
+	byEntry, err := s.repo.GetByResources(ctx, correctionResourceType, ids, maxCorrections)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]EntryWithCorrections, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, EntryWithCorrections{AuditEntry: e, Corrections: appliedCorrections(byEntry[e.ID])})
+	}
+	return result, nil
+}
+
+// pendingRequest loads a request that is still pending and checks that the
+// approver may decide it
+func (s *CorrectionService) pendingRequest(ctx context.Context, approver *auth.User, requestID types.ID) (*CorrectionRequest, error) {
+	if !CanSuperviseCorrections(approver) {
+		return nil, errors.Forbidden("supervisor access required")
+	}
+
+	entry, err := s.repo.FindByID(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Action != ActionCorrectionRequested || entry.ResourceID == nil {
+		return nil, errors.NotFound("correction request", requestID.String())
+	}
+
+	requests, err := s.Requests(ctx, *entry.ResourceID)
+	if err != nil {
+		return nil, err
+	}
+	for _, request := range requests {
+		if request.ID != requestID {
+			continue
+		}
+		if request.Status != CorrectionStatusPending {
+			return nil, errors.Conflict(fmt.Sprintf("correction request is already %s", request.Status))
+		}
+		if request.RequestedBy == approver.ID {
+			return nil, errors.Forbidden("a correction must be approved by a second supervisor")
+		}
+		return request, nil
+	}
+
+	return nil, errors.NotFound("correction request", requestID.String())
+}
+
+func (r *CorrectionRequest) applyDecision(e *AuditEntry) {
+	switch e.Action {
+	case ActionCorrection:
+		r.Status = CorrectionStatusApproved
+		r.DecidedBy = changeID(correctionData(e), "approved_by")
+	case ActionCorrectionRejected:
+		r.Status = CorrectionStatusRejected
+		r.DecidedBy = &e.ActorID
+		r.RejectionReason, _ = correctionData(e)["reason"].(string)
+	default:
+		return
+	}
+	decidedAt := e.Timestamp
+	r.DecidedAt = &decidedAt
+	r.DecisionEntryID = &e.ID
+}
+
+func parseCorrectionRequest(e *AuditEntry) *CorrectionRequest {
+	data := correctionData(e)
+	request := &CorrectionRequest{
+		ID:            e.ID,
+		Status:        CorrectionStatusPending,
+		Reason:        CorrectionReason(fmt.Sprint(data["reason"])),
+		Justification: e.Justification,
+		RequestedBy:   e.ActorID,
+		RequestedAt:   e.Timestamp,
+		actorType:     e.ActorType,
+		agencyID:      e.ActorAgencyID,
+	}
+	if e.ResourceID != nil {
+		request.OriginalEntryID = *e.ResourceID
+	}
+	request.OldValue, _ = data["old_value"].(map[string]any)
+	request.NewValue, _ = data["new_value"].(map[string]any)
+	return request
+}
+
+// appliedCorrections picks the approved corrections from the correction
+// entries of one entry, given newest first, and returns them oldest first
+func appliedCorrections(entries []*AuditEntry) []*AuditEntry {
+	var corrections []*AuditEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Action == ActionCorrection {
+			corrections = append(corrections, entries[i])
+		}
+	}
+	return corrections
+}
+
+// correctionData returns the correction details of a correction entry
+func correctionData(e *AuditEntry) map[string]any {
+	data, _ := e.Changes["correction"].(map[string]any)
+	return data
+}
@@ -0,0 +1,510 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/events"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// Secondary indexes for the HTTP repository. The $audit stream remains the
+// source of truth; index streams only hold small pointers to its entries,
+// carrying the fields queries filter on. Indexes are caught up from $audit,
+// so a failed index write is repaired on the next sync and entries are never
+// missing from the chain because an index was unavailable.
+
+const (
+	// AuditIndexEventType is the event type of index pointers
+	AuditIndexEventType = "AuditIndexPointer"
+	// AuditIndexPositionEventType records the last indexed sequence
+	AuditIndexPositionEventType = "AuditIndexPosition"
+
+	auditIndexPrefix         = AuditStreamName + "-idx-"
+	auditIndexPositionStream = AuditStreamName + "-idx-position"
+
+	indexSyncBatch = 500
+	indexReadBatch = 500
+	// maxDayIndexSpan is the longest time range that is read from per-day indexes
+	maxDayIndexSpan = 31
+)
+
+// indexPointer points to an entry in the $audit stream
+type indexPointer struct {
+	Sequence     int64     `json:"sequence"`
+	EntryID      types.ID  `json:"entry_id"`
+	Timestamp    time.Time `json:"timestamp"`
+	ActorType    ActorType `json:"actor_type"`
+	ActorID      types.ID  `json:"actor_id"`
+	Action       string    `json:"action"`
+	ResourceType string    `json:"resource_type"`
+	ResourceID   *types.ID `json:"resource_id,omitempty"`
+}
+
+func newIndexPointer(entry *AuditEntry) indexPointer {
+	return indexPointer{
+		Sequence:     entry.Sequence,
+		EntryID:      entry.ID,
+		Timestamp:    entry.Timestamp,
+		ActorType:    entry.ActorType,
+		ActorID:      entry.ActorID,
+		Action:       entry.Action,
+		ResourceType: entry.ResourceType,
+		ResourceID:   entry.ResourceID,
+	}
+}
+
+// indexStream names an index stream; keys are escaped so that any resource
+// type or action is a valid stream name
+func indexStream(kind string, keys ...string) string {
+	name := auditIndexPrefix + kind
+	for _, k := range keys {
+		name += "-" + url.PathEscape(k)
+	}
+	return name
+}
+
+func actorIndex(actorID types.ID) string           { return indexStream("actor", actorID.String()) }
+func actionIndex(action string) string             { return indexStream("action", action) }
+func resourceIndex(resourceID types.ID) string     { return indexStream("resource", resourceID.String()) }
+func resourceTypeIndex(resourceType string) string { return indexStream("type", resourceType) }
+func dayIndex(t time.Time) string                  { return indexStream("day", t.UTC().Format("2006-01-02")) }
+func entryIndex(entryID types.ID) string           { return indexStream("entry", entryID.String()) }
+
+// indexStreamsFor returns the index streams an entry is added to. The entry
+// stream holds the entry's only pointer, so that it is found by ID.
+func indexStreamsFor(entry *AuditEntry) []string {
+	streams := []string{
+		entryIndex(entry.ID),
+		actorIndex(entry.ActorID),
+		actionIndex(entry.Action),
+		resourceTypeIndex(entry.ResourceType),
+		dayIndex(entry.Timestamp),
+	}
+	if entry.ResourceID != nil {
+		streams = append(streams, resourceIndex(*entry.ResourceID))
+	}
+	return streams
+}
+
+// indexStreamsForFilter returns the most selective index streams for a
+// filter, newest first, or nil if the filter has to be answered from $audit
+func indexStreamsForFilter(filter ListEntriesFilter, now time.Time) []string {
+	end := now
+	if filter.EndTime != nil {
+		end = *filter.EndTime
+	}
+
+	switch {
+	case filter.ResourceID != nil:
+		return []string{resourceIndex(*filter.ResourceID)}
+	case filter.ActorID != nil:
+		return []string{actorIndex(*filter.ActorID)}
+	case filter.StartTime != nil && !end.Before(*filter.StartTime) &&
+		end.Sub(*filter.StartTime) <= maxDayIndexSpan*24*time.Hour:
+		var streams []string
+		first := filter.StartTime.UTC().Truncate(24 * time.Hour)
+		for day := end.UTC().Truncate(24 * time.Hour); !day.Before(first); day = day.AddDate(0, 0, -1) {
+			streams = append(streams, dayIndex(day))
+		}
+		return streams
+	case filter.Action != "":
+		return []string{actionIndex(filter.Action)}
+	case filter.ResourceType != "":
+		return []string{resourceTypeIndex(filter.ResourceType)}
+	}
+	return nil
+}
+
+// matches reports whether an entry with the given fields passes the filter
+func (f ListEntriesFilter) matches(p indexPointer) bool {
+	if f.ActorID != nil && p.ActorID != *f.ActorID {
+		return false
+	}
+	if f.ActorType != nil && p.ActorType != *f.ActorType {
+		return false
+	}
+	if f.Action != "" && p.Action != f.Action {
+		return false
+	}
+	if f.ResourceType != "" && p.ResourceType != f.ResourceType {
+		return false
+	}
+	if f.ResourceID != nil && (p.ResourceID == nil || *p.ResourceID != *f.ResourceID) {
+		return false
+	}
+	if f.StartTime != nil && p.Timestamp.Before(*f.StartTime) {
+		return false
+	}
+	if f.EndTime != nil && p.Timestamp.After(*f.EndTime) {
+		return false
+	}
+	return true
+}
+
+// SyncIndexes adds the entries appended since the last sync to the index streams
+func (r *HTTPRepository) SyncIndexes(ctx context.Context) error {
+	r.syncMu.Lock()
+	defer r.syncMu.Unlock()
+
+	indexed, err := r.indexedSequence(ctx)
+	if err != nil {
+		return err
+	}
+
+	for {
+		entries, err := r.ReadEntries(ctx, indexed+1, indexSyncBatch)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		batches := make(map[string][]events.EventData)
+		for _, entry := range entries {
+			pointer := newIndexPointer(entry)
+			for _, stream := range indexStreamsFor(entry) {
+				batches[stream] = append(batches[stream], events.EventData{
+					// Deterministic IDs make re-indexing after a partial failure idempotent
+					EventID:   uuid.NewSHA1(uuid.NameSpaceOID, []byte(stream+"/"+entry.ID.String())).String(),
+					EventType: AuditIndexEventType,
+					Data:      pointer,
+				})
+			}
+		}
+
+		for stream, batch := range batches {
+			if err := r.client.AppendToStream(ctx, stream, batch...); err != nil {
+				return errors.Wrap(err, "failed to write audit index")
+			}
+		}
+
+		last := entries[len(entries)-1].Sequence
+		if err := r.client.AppendToStream(ctx, auditIndexPositionStream, events.EventData{
+			EventID:   uuid.New().String(),
+			EventType: AuditIndexPositionEventType,
+			Data:      map[string]int64{"sequence": last},
+		}); err != nil {
+			return errors.Wrap(err, "failed to write audit index position")
+		}
+		indexed = last
+		r.indexMu.Lock()
+		r.indexed = last
+		r.indexMu.Unlock()
+
+		if len(entries) < indexSyncBatch {
+			return nil
+		}
+	}
+}
+
+// StartIndexer keeps the indexes current until the context is cancelled.
+// It is the only writer of the indexes; reads combine them with the entries
+// appended since the last sync.
+func (r *HTTPRepository) StartIndexer(ctx context.Context, interval time.Duration) {
+	if err := r.SyncIndexes(ctx); err != nil {
+		fmt.Printf("Warning: audit index sync failed: %v\n", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.SyncIndexes(ctx); err != nil {
+				fmt.Printf("Warning: audit index sync failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// indexedSequence returns the last sequence that was added to the indexes
+func (r *HTTPRepository) indexedSequence(ctx context.Context) (int64, error) {
+	r.indexMu.Lock()
+	defer r.indexMu.Unlock()
+
+	if !r.indexLoaded {
+		position, err := r.readIndexPosition(ctx)
+		if err != nil {
+			return 0, err
+		}
+		r.indexed = position
+		r.indexLoaded = true
+	}
+	return r.indexed, nil
+}
+
+func (r *HTTPRepository) readIndexPosition(ctx context.Context) (int64, error) {
+	event, err := r.client.ReadLastEvent(ctx, auditIndexPositionStream)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read audit index position")
+	}
+	if event == nil {
+		return 0, nil
+	}
+
+	var position struct {
+		Sequence int64 `json:"sequence"`
+	}
+	if err := json.Unmarshal(unwrapData(event.Data), &position); err != nil {
+		return 0, errors.Wrap(err, "failed to unmarshal audit index position")
+	}
+
+	return position.Sequence, nil
+}
+
+// listFromIndexes answers a filtered query from the index streams, newest
+// first. Entries the indexer has not reached yet are read from the end of
+// $audit, so reads never write to the indexes. Pointers are read only up to
+// the requested page: when the filter is a single indexed key the total is
+// the length of its stream, otherwise it counts the matches up to the end of
+// the page, plus one if more entries match.
+func (r *HTTPRepository) listFromIndexes(ctx context.Context, streams []string, filter ListEntriesFilter) ([]*AuditEntry, int, error) {
+	tail, err := r.unindexedEntries(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	seen := make(map[int64]bool, len(tail))
+	var recent []*AuditEntry
+	for _, entry := range tail {
+		seen[entry.Sequence] = true
+		if filter.matches(newIndexPointer(entry)) {
+			recent = append(recent, entry)
+		}
+	}
+
+	// One match past the page shows whether more follow
+	want := filter.Offset + filter.Limit + 1
+	var pointers []indexPointer
+	for _, stream := range streams {
+		need := want - len(recent) - len(pointers)
+		if need <= 0 {
+			break
+		}
+		found, err := r.readPointers(ctx, stream, filter, seen, need)
+		if err != nil {
+			return nil, 0, err
+		}
+		pointers = append(pointers, found...)
+	}
+
+	total := len(recent) + len(pointers)
+	if filter.singleKey() {
+		indexed, err := r.indexLength(ctx, streams[0])
+		if err != nil {
+			return nil, 0, err
+		}
+		total = len(recent) + indexed
+	}
+
+	entries := []*AuditEntry{}
+	end := min(filter.Offset+filter.Limit, len(recent)+len(pointers))
+	for i := filter.Offset; i < end; i++ {
+		if i < len(recent) {
+			entries = append(entries, recent[i])
+			continue
+		}
+		entry, err := r.resolvePointer(ctx, pointers[i-len(recent)], filter)
+		if err != nil {
+			return nil, 0, err
+		}
+		if entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, total, nil
+}
+
+// indexLength returns the number of pointers in an index stream
+func (r *HTTPRepository) indexLength(ctx context.Context, stream string) (int, error) {
+	event, err := r.client.ReadLastEvent(ctx, stream)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read audit index")
+	}
+	if event == nil {
+		return 0, nil
+	}
+	return int(event.EventNumber) + 1, nil
+}
+
+// singleKey reports whether the filter is one indexed key and nothing else,
+// so that every pointer in its index stream matches it
+func (f ListEntriesFilter) singleKey() bool {
+	keys := 0
+	for _, set := range []bool{f.ResourceID != nil, f.ActorID != nil, f.Action != "", f.ResourceType != ""} {
+		if set {
+			keys++
+		}
+	}
+	return keys == 1 && f.ActorType == nil && f.StartTime == nil && f.EndTime == nil
+}
+
+// resolvePointer reads the entry an index pointer refers to. The chain is
+// authoritative: pointers that do not match their entry resolve to nil.
+func (r *HTTPRepository) resolvePointer(ctx context.Context, p indexPointer, filter ListEntriesFilter) (*AuditEntry, error) {
+	found, err := r.ReadEntries(ctx, p.Sequence, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 || found[0].ID != p.EntryID || !filter.matches(newIndexPointer(found[0])) {
+		fmt.Printf("Warning: audit index pointer %d does not match the audit stream\n", p.Sequence)
+		return nil, nil
+	}
+	return found[0], nil
+}
+
+// readPointers reads up to limit pointers matching the filter from one index
+// stream, newest first, skipping the given sequences. Reads start at the
+// size of the page and grow when pointers do not match.
+func (r *HTTPRepository) readPointers(ctx context.Context, stream string, filter ListEntriesFilter, skip map[int64]bool, limit int) ([]indexPointer, error) {
+	var pointers []indexPointer
+	start := int64(-1)
+	count := min(limit, indexReadBatch)
+	for len(pointers) < limit {
+		batch, err := r.client.ReadStream(ctx, stream, events.ReadStreamOptions{
+			Direction: "backward",
+			Start:     start,
+			Count:     count,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read audit index")
+		}
+		if len(batch) == 0 {
+			break
+		}
+		sortEvents(batch, false)
+
+		for _, recorded := range batch {
+			if recorded.EventType != AuditIndexEventType {
+				continue
+			}
+			var p indexPointer
+			if err := json.Unmarshal(unwrapData(recorded.Data), &p); err != nil {
+				continue
+			}
+			if skip[p.Sequence] || !filter.matches(p) {
+				continue
+			}
+			skip[p.Sequence] = true
+			pointers = append(pointers, p)
+			if len(pointers) == limit {
+				break
+			}
+		}
+
+		next := batch[len(batch)-1].EventNumber - 1
+		if next < 0 {
+			break
+		}
+		start = next
+		count = min(count*2, indexReadBatch)
+	}
+	return pointers, nil
+}
+
+// unindexedEntries reads the entries appended since the last index sync,
+// newest first. Reads combine them with the indexes, so that entries are
+// found before the indexer has caught up.
+func (r *HTTPRepository) unindexedEntries(ctx context.Context) ([]*AuditEntry, error) {
+	indexed, err := r.indexedSequence(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*AuditEntry
+	last := r.GetSequence()
+	for from := indexed + 1; from <= last; from += indexReadBatch {
+		batch, err := r.ReadEntries(ctx, from, int(min(indexReadBatch, last-from+1)))
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		entries = append(entries, batch...)
+	}
+
+	slices.Reverse(entries)
+	return entries, nil
+}
+
+// listFromStream answers queries without an index by scanning $audit newest first
+func (r *HTTPRepository) listFromStream(ctx context.Context, filter ListEntriesFilter) ([]*AuditEntry, int, error) {
+	unfiltered := filter.ActorType == nil && filter.StartTime == nil && filter.EndTime == nil
+	last := r.GetSequence()
+
+	var entries []*AuditEntry
+	total := 0
+	end := last
+	if unfiltered {
+		// Every entry matches, so the page can be read directly
+		total = int(last)
+		end = last - int64(filter.Offset)
+	}
+
+	for end >= 1 {
+		from := max(end-indexReadBatch+1, 1)
+		batch, err := r.ReadEntries(ctx, from, int(end-from+1))
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for i := len(batch) - 1; i >= 0; i-- {
+			entry := batch[i]
+			if unfiltered {
+				if filter.Limit <= 0 || len(entries) < filter.Limit {
+					entries = append(entries, entry)
+				}
+				continue
+			}
+			if !filter.matches(newIndexPointer(entry)) {
+				continue
+			}
+			total++
+			if total > filter.Offset && (filter.Limit <= 0 || len(entries) < filter.Limit) {
+				entries = append(entries, entry)
+			}
+		}
+
+		if unfiltered && filter.Limit > 0 && len(entries) >= filter.Limit {
+			break
+		}
+		end = from - 1
+	}
+
+	return entries, total, nil
+}
+
+// unwrapData handles the JSON string format returned with embed=body
+func unwrapData(data json.RawMessage) json.RawMessage {
+	if len(data) > 0 && data[0] == '"' {
+		var dataStr string
+		if err := json.Unmarshal(data, &dataStr); err == nil {
+			return json.RawMessage(dataStr)
+		}
+	}
+	return data
+}
+
+// sortEvents orders events by event number
+func sortEvents(batch []events.RecordedEvent, ascending bool) {
+	sort.Slice(batch, func(i, j int) bool {
+		if ascending {
+			return batch[i].EventNumber < batch[j].EventNumber
+		}
+		return batch[i].EventNumber > batch[j].EventNumber
+	})
+}
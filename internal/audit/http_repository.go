@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/serbia-gov/platform/internal/shared/errors"
 	"github.com/serbia-gov/platform/internal/shared/events"
@@ -17,8 +18,17 @@ type HTTPRepository struct {
 	mu       sync.Mutex
 	lastHash string
 	sequence int64
+
+	// Secondary index state (see http_index.go)
+	syncMu      sync.Mutex // serializes index syncs
+	indexMu     sync.Mutex // guards indexed and indexLoaded
+	indexed     int64
+	indexLoaded bool
 }
 
+// maxListEntries caps queries that do not set a limit
+const maxListEntries = 10000
+
 // NewHTTPRepository creates a new HTTP-based audit repository
 func NewHTTPRepository(client *events.HTTPClient) *HTTPRepository {
 	return &HTTPRepository{client: client}
@@ -93,14 +103,32 @@ func (r *HTTPRepository) Append(ctx context.Context, entry *AuditEntry) error {
 	return nil
 }
 
-// FindByID finds an audit entry by ID
+// FindByID finds an audit entry by ID through its entry index stream.
+// Entries the indexer has not reached yet are looked up at the end of $audit.
 func (r *HTTPRepository) FindByID(ctx context.Context, id types.ID) (*AuditEntry, error) {
-	entries, _, err := r.List(ctx, ListEntriesFilter{Limit: 10000})
+	event, err := r.client.ReadLastEvent(ctx, entryIndex(id))
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "failed to read audit index")
+	}
+	if event != nil && event.EventType == AuditIndexEventType {
+		var p indexPointer
+		if err := json.Unmarshal(unwrapData(event.Data), &p); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal audit index pointer")
+		}
+		entry, err := r.resolvePointer(ctx, p, ListEntriesFilter{})
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			return entry, nil
+		}
 	}
 
-	for _, entry := range entries {
+	tail, err := r.unindexedEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range tail {
 		if entry.ID == id {
 			return entry, nil
 		}
@@ -109,124 +137,130 @@ func (r *HTTPRepository) FindByID(ctx context.Context, id types.ID) (*AuditEntry
 	return nil, errors.NotFound("audit entry", string(id))
 }
 
-// List lists audit entries with filters
+// List lists audit entries with filters, newest first. Filtered queries are
+// answered from the secondary indexes (see listFromIndexes for the total);
+// if they cannot be read the audit stream is scanned instead.
 func (r *HTTPRepository) List(ctx context.Context, filter ListEntriesFilter) ([]*AuditEntry, int, error) {
-	allEvents, err := r.readAllEvents(ctx)
+	if filter.Limit <= 0 || filter.Limit > maxListEntries {
+		filter.Limit = maxListEntries
+	}
+
+	streams := indexStreamsForFilter(filter, time.Now())
+	if streams == nil {
+		return r.listFromStream(ctx, filter)
+	}
+
+	entries, total, err := r.listFromIndexes(ctx, streams, filter)
 	if err != nil {
-		return nil, 0, err
+		fmt.Printf("Warning: audit indexes unavailable, scanning audit stream: %v\n", err)
+		return r.listFromStream(ctx, filter)
+	}
+	return entries, total, nil
+}
+
+// ReadEntries reads up to limit entries in sequence order, starting at fromSequence.
+// Entry n is stored at event number n-1.
+func (r *HTTPRepository) ReadEntries(ctx context.Context, fromSequence int64, limit int) ([]*AuditEntry, error) {
+	if fromSequence < 1 {
+		fromSequence = 1
+	}
+
+	batch, err := r.client.ReadStream(ctx, AuditStreamName, events.ReadStreamOptions{
+		Direction: "forward",
+		Start:     fromSequence - 1,
+		Count:     limit,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read audit stream")
 	}
 
-	var entries []*AuditEntry
-	total := 0
+	sortEvents(batch, true)
 
-	for i := len(allEvents) - 1; i >= 0; i-- { // Reverse order (newest first)
-		recorded := allEvents[i]
+	entries := []*AuditEntry{}
+	for _, recorded := range batch {
 		if recorded.EventType != AuditEventType {
 			continue
 		}
 
-		// Handle JSON string format from embed=body (data may be wrapped in quotes)
-		data := recorded.Data
-		if len(data) > 0 && data[0] == '"' {
-			var dataStr string
-			if err := json.Unmarshal(data, &dataStr); err != nil {
-				continue
-			}
-			data = json.RawMessage(dataStr)
-		}
-
 		var entry AuditEntry
-		if err := json.Unmarshal(data, &entry); err != nil {
-			continue
+		if err := json.Unmarshal(unwrapData(recorded.Data), &entry); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal audit entry")
 		}
+		entries = append(entries, &entry)
+	}
 
-		// Apply filters
-		if filter.ActorID != nil && entry.ActorID != *filter.ActorID {
-			continue
-		}
-		if filter.ActorType != nil && entry.ActorType != *filter.ActorType {
-			continue
-		}
-		if filter.Action != "" && entry.Action != filter.Action {
-			continue
-		}
-		if filter.ResourceType != "" && entry.ResourceType != filter.ResourceType {
-			continue
-		}
-		if filter.ResourceID != nil && (entry.ResourceID == nil || *entry.ResourceID != *filter.ResourceID) {
-			continue
-		}
-		if filter.StartTime != nil && entry.Timestamp.Before(*filter.StartTime) {
-			continue
-		}
-		if filter.EndTime != nil && entry.Timestamp.After(*filter.EndTime) {
-			continue
-		}
+	return entries, nil
+}
 
-		total++
+// GetByResource gets audit entries for a specific resource
+func (r *HTTPRepository) GetByResource(ctx context.Context, resourceType string, resourceID types.ID, limit int) ([]*AuditEntry, error) {
+	found, err := r.GetByResources(ctx, resourceType, []types.ID{resourceID}, limit)
+	if err != nil {
+		return nil, err
+	}
+	return found[resourceID], nil
+}
 
-		// Apply offset and limit
-		if filter.Offset > 0 && total <= filter.Offset {
+// GetByResources gets the audit entries of several resources from their
+// resource index streams. Entries the indexer has not reached yet are read
+// once from the end of the audit stream for all resources.
+func (r *HTTPRepository) GetByResources(ctx context.Context, resourceType string, resourceIDs []types.ID, limit int) (map[types.ID][]*AuditEntry, error) {
+	result := make(map[types.ID][]*AuditEntry, len(resourceIDs))
+	if len(resourceIDs) == 0 {
+		return result, nil
+	}
+	if limit <= 0 || limit > maxListEntries {
+		limit = maxListEntries
+	}
+
+	wanted := make(map[types.ID]bool, len(resourceIDs))
+	for _, id := range resourceIDs {
+		wanted[id] = true
+	}
+
+	tail, err := r.unindexedEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[int64]bool)
+	for _, entry := range tail {
+		seen[entry.Sequence] = true
+		if entry.ResourceType != resourceType || entry.ResourceID == nil || !wanted[*entry.ResourceID] {
 			continue
 		}
-		if filter.Limit > 0 && len(entries) >= filter.Limit {
-			continue
+		if id := *entry.ResourceID; len(result[id]) < limit {
+			result[id] = append(result[id], entry)
 		}
-
-		entries = append(entries, &entry)
 	}
 
-	return entries, total, nil
-}
-
-// readAllEvents reads all events from the audit stream
-func (r *HTTPRepository) readAllEvents(ctx context.Context) ([]events.RecordedEvent, error) {
-	var allEvents []events.RecordedEvent
-	var start int64 = 0
-
-	for {
-		batch, err := r.client.ReadStream(ctx, AuditStreamName, events.ReadStreamOptions{
-			Direction: "forward",
-			Start:     start,
-			Count:     100,
-		})
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to read audit stream")
+	for id := range wanted {
+		remaining := limit - len(result[id])
+		if remaining == 0 {
+			continue
 		}
 
-		if len(batch) == 0 {
-			break
+		filter := ListEntriesFilter{ResourceType: resourceType, ResourceID: &id}
+		pointers, err := r.readPointers(ctx, resourceIndex(id), filter, seen, remaining)
+		if err != nil {
+			return nil, err
 		}
-
-		allEvents = append(allEvents, batch...)
-		start = batch[len(batch)-1].EventNumber + 1
-
-		if len(allEvents) > 10000 {
-			break
+		for _, p := range pointers {
+			entry, err := r.resolvePointer(ctx, p, filter)
+			if err != nil {
+				return nil, err
+			}
+			if entry != nil {
+				result[id] = append(result[id], entry)
+			}
 		}
 	}
 
-	return allEvents, nil
-}
-
-// GetByResource gets audit entries for a specific resource
-func (r *HTTPRepository) GetByResource(ctx context.Context, resourceType string, resourceID types.ID, limit int) ([]*AuditEntry, error) {
-	filter := ListEntriesFilter{
-		ResourceType: resourceType,
-		ResourceID:   &resourceID,
-		Limit:        limit,
-	}
-	entries, _, err := r.List(ctx, filter)
-	return entries, err
+	return result, nil
 }
 
-// VerifyChain verifies the integrity of the audit chain
+// VerifyChain verifies the integrity of the audit chain, reading $audit in
+// batches from the first entry
 func (r *HTTPRepository) VerifyChain(ctx context.Context, limit int, includeDetails bool) (*VerifyResult, error) {
-	allEvents, err := r.readAllEvents(ctx)
-	if err != nil {
-		return nil, err
-	}
-
 	result := &VerifyResult{
 		Valid:          true,
 		Checked:        0,
@@ -238,59 +272,65 @@ func (r *HTTPRepository) VerifyChain(ctx context.Context, limit int, includeDeta
 
 	var prevHash string
 	count := 0
+	var start int64 = 0
 
-	for _, recorded := range allEvents {
-		if recorded.EventType != AuditEventType {
-			continue
+	for {
+		batch, err := r.client.ReadStream(ctx, AuditStreamName, events.ReadStreamOptions{
+			Direction: "forward",
+			Start:     start,
+			Count:     indexReadBatch,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read audit stream")
 		}
+		if len(batch) == 0 {
+			return result, nil
+		}
+		sortEvents(batch, true)
+		start = batch[len(batch)-1].EventNumber + 1
 
-		// Handle JSON string format from embed=body
-		data := recorded.Data
-		if len(data) > 0 && data[0] == '"' {
-			var dataStr string
-			if err := json.Unmarshal(data, &dataStr); err != nil {
+		for _, recorded := range batch {
+			if recorded.EventType != AuditEventType {
 				continue
 			}
-			data = json.RawMessage(dataStr)
-		}
 
-		var entry AuditEntry
-		if err := json.Unmarshal(data, &entry); err != nil {
-			continue
-		}
+			var entry AuditEntry
+			if err := json.Unmarshal(unwrapData(recorded.Data), &entry); err != nil {
+				continue
+			}
 
-		result.Checked++
-		count++
-
-		// Verify content hash
-		computed := entry.ComputeHash()
-		if computed == entry.Hash {
-			result.ContentValid++
-		} else {
-			result.ContentInvalid++
-			result.Valid = false
-			result.Violations = append(result.Violations,
-				fmt.Sprintf("Entry %d: content hash mismatch", entry.Sequence))
-		}
+			result.Checked++
+			result.noteCorrection(&entry)
+			count++
+
+			// Verify content hash
+			computed := entry.ComputeHash()
+			if computed == entry.Hash {
+				result.ContentValid++
+			} else {
+				result.ContentInvalid++
+				result.Valid = false
+				result.Violations = append(result.Violations,
+					fmt.Sprintf("Entry %d: content hash mismatch", entry.Sequence))
+			}
 
-		// Verify chain linkage
-		if entry.PrevHash == prevHash {
-			result.LinkageValid++
-		} else {
-			result.LinkageInvalid++
-			result.Valid = false
-			result.Violations = append(result.Violations,
-				fmt.Sprintf("Entry %d: chain linkage broken", entry.Sequence))
-		}
+			// Verify chain linkage
+			if entry.PrevHash == prevHash {
+				result.LinkageValid++
+			} else {
+				result.LinkageInvalid++
+				result.Valid = false
+				result.Violations = append(result.Violations,
+					fmt.Sprintf("Entry %d: chain linkage broken", entry.Sequence))
+			}
 
-		prevHash = entry.Hash
+			prevHash = entry.Hash
 
-		if limit > 0 && count >= limit {
-			break
+			if limit > 0 && count >= limit {
+				return result, nil
+			}
 		}
 	}
-
-	return result, nil
 }
 
 // GetLastHash returns the last hash in the chain
@@ -24,6 +24,13 @@ type AuditRepository interface {
 	// GetByResource gets audit entries for a specific resource
 	GetByResource(ctx context.Context, resourceType string, resourceID types.ID, limit int) ([]*AuditEntry, error)
 
+	// GetByResources gets the audit entries of several resources of one type,
+	// newest first and at most limit per resource, keyed by resource ID
+	GetByResources(ctx context.Context, resourceType string, resourceIDs []types.ID, limit int) (map[types.ID][]*AuditEntry, error)
+
+	// ReadEntries reads up to limit entries in sequence order, starting at fromSequence
+	ReadEntries(ctx context.Context, fromSequence int64, limit int) ([]*AuditEntry, error)
+
 	// VerifyChain verifies the integrity of the audit chain
 	VerifyChain(ctx context.Context, limit int, includeDetails bool) (*VerifyResult, error)
 
@@ -45,3 +52,4 @@ type AuditRepository interface {
 
 // Ensure implementations satisfy the interface
 var _ AuditRepository = (*KurrentDBRepository)(nil)
+var _ AuditRepository = (*Repository)(nil)
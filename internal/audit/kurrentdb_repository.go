@@ -2,12 +2,9 @@ package audit
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"sync"
-	"time"
 
 	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
 	"github.com/google/uuid"
@@ -99,6 +96,7 @@ func (r *KurrentDBRepository) Append(ctx context.Context, entry *AuditEntry) err
 	// Serialize entry
 	data, err := json.Marshal(entry)
 	if err != nil {
+		r.sequence--
 		return errors.Wrap(err, "failed to marshal audit entry")
 	}
 
@@ -116,6 +114,7 @@ func (r *KurrentDBRepository) Append(ctx context.Context, entry *AuditEntry) err
 	// Append to stream
 	_, err = r.client.AppendToStream(ctx, AuditStreamName, esdb.AppendToStreamOptions{}, eventData)
 	if err != nil {
+		r.sequence-- // Rollback on failure
 		return errors.Wrap(err, "failed to append audit entry")
 	}
 
@@ -159,16 +158,25 @@ func (r *KurrentDBRepository) FindByID(ctx context.Context, id types.ID) (*Audit
 	return nil, errors.NotFound("audit entry", string(id))
 }
 
-// List lists audit entries with filters
+// List lists audit entries with filters. Without indexes only an unfiltered
+// page can be read from the end of the stream; filtered lists scan the whole
+// stream, since matching entries can be anywhere in it.
 func (r *KurrentDBRepository) List(ctx context.Context, filter ListEntriesFilter) ([]*AuditEntry, int, error) {
 	opts := esdb.ReadStreamOptions{
 		Direction: esdb.Backwards,
 		From:      esdb.End{},
 	}
 
-	maxEvents := uint64(1000)
-	if filter.Limit > 0 {
-		maxEvents = uint64(filter.Limit + filter.Offset + 100) // Read extra to account for filtering
+	unfiltered := filter.ActorID == nil && filter.ActorType == nil && filter.Action == "" &&
+		filter.ResourceType == "" && filter.ResourceID == nil && filter.StartTime == nil && filter.EndTime == nil
+
+	sequence := r.GetSequence()
+	maxEvents := uint64(sequence)
+	if unfiltered && filter.Limit > 0 {
+		maxEvents = uint64(min(int64(filter.Limit+filter.Offset), sequence))
+	}
+	if maxEvents == 0 {
+		return []*AuditEntry{}, 0, nil
 	}
 
 	stream, err := r.client.ReadStream(ctx, AuditStreamName, opts, maxEvents)
@@ -232,18 +240,123 @@ func (r *KurrentDBRepository) List(ctx context.Context, filter ListEntriesFilter
 		}
 	}
 
+	if unfiltered {
+		total = int(sequence)
+	}
 	return entries, total, nil
 }
 
 // GetByResource gets audit entries for a specific resource
 func (r *KurrentDBRepository) GetByResource(ctx context.Context, resourceType string, resourceID types.ID, limit int) ([]*AuditEntry, error) {
-	filter := ListEntriesFilter{
-		ResourceType: resourceType,
-		ResourceID:   &resourceID,
-		Limit:        limit,
+	found, err := r.GetByResources(ctx, resourceType, []types.ID{resourceID}, limit)
+	if err != nil {
+		return nil, err
 	}
-	entries, _, err := r.List(ctx, filter)
-	return entries, err
+	return found[resourceID], nil
+}
+
+// GetByResources gets the audit entries of several resources. The stream is
+// scanned backwards once for all of them, stopping when every resource has
+// limit entries.
+func (r *KurrentDBRepository) GetByResources(ctx context.Context, resourceType string, resourceIDs []types.ID, limit int) (map[types.ID][]*AuditEntry, error) {
+	result := make(map[types.ID][]*AuditEntry, len(resourceIDs))
+	wanted := make(map[types.ID]bool, len(resourceIDs))
+	for _, id := range resourceIDs {
+		wanted[id] = true
+	}
+
+	sequence := r.GetSequence()
+	if len(wanted) == 0 || sequence == 0 {
+		return result, nil
+	}
+
+	opts := esdb.ReadStreamOptions{
+		Direction: esdb.Backwards,
+		From:      esdb.End{},
+	}
+
+	stream, err := r.client.ReadStream(ctx, AuditStreamName, opts, uint64(sequence))
+	if err != nil {
+		if esdbErr, ok := esdb.FromError(err); ok {
+			if esdbErr.Code() == esdb.ErrorCodeResourceNotFound {
+				return result, nil
+			}
+		}
+		return nil, errors.Wrap(err, "failed to read audit stream")
+	}
+	defer stream.Close()
+
+	complete := 0
+	for complete < len(wanted) {
+		event, err := stream.Recv()
+		if err != nil {
+			break
+		}
+
+		if event.Event == nil || event.Event.EventType != AuditEventType {
+			continue
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal(event.Event.Data, &entry); err != nil {
+			continue
+		}
+		if entry.ResourceType != resourceType || entry.ResourceID == nil || !wanted[*entry.ResourceID] {
+			continue
+		}
+
+		id := *entry.ResourceID
+		if limit > 0 && len(result[id]) >= limit {
+			continue
+		}
+		result[id] = append(result[id], &entry)
+		if limit > 0 && len(result[id]) == limit {
+			complete++
+		}
+	}
+
+	return result, nil
+}
+
+// ReadEntries reads up to limit entries in sequence order, starting at fromSequence.
+// Entry n is stored at stream revision n-1.
+func (r *KurrentDBRepository) ReadEntries(ctx context.Context, fromSequence int64, limit int) ([]*AuditEntry, error) {
+	if fromSequence < 1 {
+		fromSequence = 1
+	}
+
+	opts := esdb.ReadStreamOptions{
+		Direction: esdb.Forwards,
+		From:      esdb.Revision(uint64(fromSequence - 1)),
+	}
+
+	stream, err := r.client.ReadStream(ctx, AuditStreamName, opts, uint64(limit))
+	if err != nil {
+		if esdbErr, ok := esdb.FromError(err); ok {
+			if esdbErr.Code() == esdb.ErrorCodeResourceNotFound {
+				return []*AuditEntry{}, nil
+			}
+		}
+		return nil, errors.Wrap(err, "failed to read audit stream")
+	}
+	defer stream.Close()
+
+	entries := []*AuditEntry{}
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			break
+		}
+
+		if event.Event != nil && event.Event.EventType == AuditEventType {
+			var entry AuditEntry
+			if err := json.Unmarshal(event.Event.Data, &entry); err != nil {
+				return nil, errors.Wrap(err, "failed to unmarshal audit entry")
+			}
+			entries = append(entries, &entry)
+		}
+	}
+
+	return entries, nil
 }
 
 // VerifyChain verifies the integrity of the audit chain
@@ -292,6 +405,8 @@ func (r *KurrentDBRepository) VerifyChain(ctx context.Context, limit int, includ
 
 	// Verify each entry (entries are in reverse order)
 	for i, entry := range entries {
+		corrects := result.noteCorrection(entry)
+
 		// 1. Content verification: Recalculate hash
 		computedHash := entry.ComputeHash()
 		contentValid := computedHash == entry.Hash
@@ -335,6 +450,7 @@ func (r *KurrentDBRepository) VerifyChain(ctx context.Context, limit int, includ
 				ContentValid: contentValid,
 				LinkageValid: linkageValid,
 				Action:       entry.Action,
+				Corrects:     corrects,
 			})
 		}
 	}
@@ -495,10 +611,3 @@ func (r *KurrentDBRepository) GetCheckpoint(ctx context.Context, id types.ID) (*
 
 	return nil, errors.NotFound("checkpoint", string(id))
 }
-
-// computeCheckpointHash computes a hash for checkpoint verification
-func computeCheckpointHash(lastHash string, sequence int64, count int, timestamp time.Time) string {
-	data := fmt.Sprintf("%s:%d:%d:%d", lastHash, sequence, count, timestamp.UnixNano())
-	hash := sha256.Sum256([]byte(data))
-	return hex.EncodeToString(hash[:])
-}
@@ -0,0 +1,476 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"sync"
+
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// Merkle tree over audit entries following RFC 6962 (Certificate Transparency).
+// Leaf i is the hash of the audit entry with sequence i+1, so the root of a
+// tree of size n commits to the first n entries. An inclusion proof shows
+// that an entry is in a tree with a given root in O(log n) hashes, and a
+// consistency proof shows that a later tree is an append-only extension of
+// an earlier one.
+
+const (
+	leafHashPrefix = 0x00
+	nodeHashPrefix = 0x01
+)
+
+// HashLeaf computes the RFC 6962 hash of a leaf: SHA-256(0x00 || data)
+func HashLeaf(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafHashPrefix})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// HashChildren computes the RFC 6962 hash of an interior node: SHA-256(0x01 || left || right)
+func HashChildren(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodeHashPrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// EntryLeafHash returns the Merkle leaf hash of an audit entry. The leaf
+// data is the entry's content hash, which already commits to every field.
+func EntryLeafHash(entryHash string) ([]byte, error) {
+	data, err := hex.DecodeString(entryHash)
+	if err != nil || len(data) != sha256.Size {
+		return nil, fmt.Errorf("invalid entry hash %q", entryHash)
+	}
+	return HashLeaf(data), nil
+}
+
+// MerkleTree is an append-only RFC 6962 Merkle tree. It keeps the hash of
+// every complete subtree, so roots and proofs for any earlier tree size are
+// computed in O(log n). It is not safe for concurrent use.
+type MerkleTree struct {
+	// levels[k][i] is the hash of the complete subtree of 2^k leaves starting at leaf i*2^k
+	levels [][][sha256.Size]byte
+}
+
+// NewMerkleTree creates an empty tree
+func NewMerkleTree() *MerkleTree {
+	return &MerkleTree{}
+}
+
+// Size returns the number of leaves
+func (t *MerkleTree) Size() int64 {
+	if len(t.levels) == 0 {
+		return 0
+	}
+	return int64(len(t.levels[0]))
+}
+
+// AppendLeafHash appends a leaf given its leaf hash
+func (t *MerkleTree) AppendLeafHash(leafHash []byte) {
+	var h [sha256.Size]byte
+	copy(h[:], leafHash)
+
+	for level := 0; ; level++ {
+		if level == len(t.levels) {
+			t.levels = append(t.levels, nil)
+		}
+		t.levels[level] = append(t.levels[level], h)
+
+		// A right child completes the subtree one level up
+		n := len(t.levels[level])
+		if n%2 == 1 {
+			return
+		}
+		copy(h[:], HashChildren(t.levels[level][n-2][:], t.levels[level][n-1][:]))
+	}
+}
+
+// Append appends a leaf given its data
+func (t *MerkleTree) Append(data []byte) {
+	t.AppendLeafHash(HashLeaf(data))
+}
+
+// LeafHash returns the hash of leaf index
+func (t *MerkleTree) LeafHash(index int64) ([]byte, error) {
+	if index < 0 || index >= t.Size() {
+		return nil, fmt.Errorf("leaf %d out of range for tree of size %d", index, t.Size())
+	}
+	return bytes.Clone(t.levels[0][index][:]), nil
+}
+
+// Root returns the root of the current tree
+func (t *MerkleTree) Root() []byte {
+	root, _ := t.RootAt(t.Size())
+	return root
+}
+
+// RootAt returns the root of the tree as it was when it had size leaves.
+// The root of the empty tree is the hash of the empty string.
+func (t *MerkleTree) RootAt(size int64) ([]byte, error) {
+	if size < 0 || size > t.Size() {
+		return nil, fmt.Errorf("tree size %d out of range (current size %d)", size, t.Size())
+	}
+	if size == 0 {
+		empty := sha256.Sum256(nil)
+		return empty[:], nil
+	}
+	return t.subtreeHash(0, size), nil
+}
+
+// subtreeHash computes MTH(D[start:end]) as defined in RFC 6962 section 2.1.
+// start is always aligned to the largest power of two not exceeding end-start,
+// which holds for every subtree visited by the RFC algorithms.
+func (t *MerkleTree) subtreeHash(start, end int64) []byte {
+	size := end - start
+	if size&(size-1) == 0 {
+		level := bits.TrailingZeros64(uint64(size))
+		return bytes.Clone(t.levels[level][start>>level][:])
+	}
+
+	k := splitPoint(size)
+	return HashChildren(t.subtreeHash(start, start+k), t.subtreeHash(start+k, end))
+}
+
+// InclusionProof returns the audit path for leaf index in the tree of the given size (RFC 6962 section 2.1.1)
+func (t *MerkleTree) InclusionProof(index, size int64) ([][]byte, error) {
+	if size < 1 || size > t.Size() {
+		return nil, fmt.Errorf("tree size %d out of range (current size %d)", size, t.Size())
+	}
+	if index < 0 || index >= size {
+		return nil, fmt.Errorf("leaf %d out of range for tree of size %d", index, size)
+	}
+
+	return t.path(index, 0, size), nil
+}
+
+func (t *MerkleTree) path(index, start, end int64) [][]byte {
+	size := end - start
+	if size == 1 {
+		return [][]byte{}
+	}
+
+	k := splitPoint(size)
+	if index < start+k {
+		return append(t.path(index, start, start+k), t.subtreeHash(start+k, end))
+	}
+	return append(t.path(index, start+k, end), t.subtreeHash(start, start+k))
+}
+
+// ConsistencyProof proves that the tree of size newSize extends the tree of
+// size oldSize (RFC 6962 section 2.1.2)
+func (t *MerkleTree) ConsistencyProof(oldSize, newSize int64) ([][]byte, error) {
+	if newSize < 1 || newSize > t.Size() {
+		return nil, fmt.Errorf("tree size %d out of range (current size %d)", newSize, t.Size())
+	}
+	if oldSize < 1 || oldSize > newSize {
+		return nil, fmt.Errorf("old tree size %d out of range for tree of size %d", oldSize, newSize)
+	}
+	if oldSize == newSize {
+		return [][]byte{}, nil
+	}
+
+	return t.subproof(oldSize, 0, newSize, true), nil
+}
+
+func (t *MerkleTree) subproof(m, start, end int64, complete bool) [][]byte {
+	n := end - start
+	if m == n {
+		if complete {
+			return [][]byte{}
+		}
+		return [][]byte{t.subtreeHash(start, end)}
+	}
+
+	k := splitPoint(n)
+	if m <= k {
+		return append(t.subproof(m, start, start+k, complete), t.subtreeHash(start+k, end))
+	}
+	return append(t.subproof(m-k, start+k, end, false), t.subtreeHash(start, start+k))
+}
+
+// splitPoint returns the largest power of two smaller than n (n > 1)
+func splitPoint(n int64) int64 {
+	return int64(1) << (bits.Len64(uint64(n-1)) - 1)
+}
+
+// VerifyInclusion checks an inclusion proof for the leaf hash at index in a
+// tree of the given size and root (RFC 9162 section 2.1.3.2)
+func VerifyInclusion(leafHash []byte, index, size int64, proof [][]byte, root []byte) error {
+	if index < 0 || index >= size {
+		return fmt.Errorf("leaf %d out of range for tree of size %d", index, size)
+	}
+
+	fn, sn := index, size-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return fmt.Errorf("inclusion proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = HashChildren(p, r)
+			if fn&1 == 0 {
+				for fn&1 == 0 && fn != 0 {
+					fn >>= 1
+					sn >>= 1
+				}
+			}
+		} else {
+			r = HashChildren(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 {
+		return fmt.Errorf("inclusion proof is too short")
+	}
+	if !bytes.Equal(r, root) {
+		return fmt.Errorf("inclusion proof does not match root")
+	}
+
+	return nil
+}
+
+// VerifyConsistency checks that the tree of newSize with newRoot extends the
+// tree of oldSize with oldRoot (RFC 9162 section 2.1.4.2)
+func VerifyConsistency(oldSize, newSize int64, oldRoot, newRoot []byte, proof [][]byte) error {
+	if oldSize < 1 || oldSize > newSize {
+		return fmt.Errorf("invalid tree sizes %d and %d", oldSize, newSize)
+	}
+	if oldSize == newSize {
+		if len(proof) != 0 {
+			return fmt.Errorf("consistency proof for equal trees must be empty")
+		}
+		if !bytes.Equal(oldRoot, newRoot) {
+			return fmt.Errorf("roots of equal-sized trees differ")
+		}
+		return nil
+	}
+	if len(proof) == 0 {
+		return fmt.Errorf("consistency proof is empty")
+	}
+
+	// If the old tree is a complete subtree its root is the first node of the path
+	if oldSize&(oldSize-1) == 0 {
+		proof = append([][]byte{oldRoot}, proof...)
+	}
+
+	fn, sn := oldSize-1, newSize-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return fmt.Errorf("consistency proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = HashChildren(c, fr)
+			sr = HashChildren(c, sr)
+			if fn&1 == 0 {
+				for fn&1 == 0 && fn != 0 {
+					fn >>= 1
+					sn >>= 1
+				}
+			}
+		} else {
+			sr = HashChildren(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 {
+		return fmt.Errorf("consistency proof is too short")
+	}
+	if !bytes.Equal(fr, oldRoot) {
+		return fmt.Errorf("consistency proof does not match old root")
+	}
+	if !bytes.Equal(sr, newRoot) {
+		return fmt.Errorf("consistency proof does not match new root")
+	}
+
+	return nil
+}
+
+// merkleSyncBatch is the number of entries read per round trip when syncing
+const merkleSyncBatch = 500
+
+// MerkleHead describes the tree after the last synced entry
+type MerkleHead struct {
+	TreeSize    int64    `json:"tree_size"`
+	RootHash    string   `json:"root_hash"`
+	LastHash    string   `json:"last_hash"`
+	LastEntryID types.ID `json:"last_entry_id"`
+}
+
+// MerkleLog maintains a Merkle tree over the audit entries in a repository.
+// The tree is built in memory and extended incrementally; each entry is
+// checked against the hash chain before it is added, so a tampered log
+// cannot produce a tree.
+type MerkleLog struct {
+	repo AuditRepository
+
+	mu          sync.Mutex
+	tree        *MerkleTree
+	lastHash    string
+	lastEntryID types.ID
+}
+
+// NewMerkleLog creates a Merkle log over the given repository
+func NewMerkleLog(repo AuditRepository) *MerkleLog {
+	return &MerkleLog{repo: repo, tree: NewMerkleTree()}
+}
+
+// Sync adds the entries appended since the last sync and returns the new head
+func (l *MerkleLog) Sync(ctx context.Context) (*MerkleHead, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for {
+		entries, err := l.repo.ReadEntries(ctx, l.tree.Size()+1, merkleSyncBatch)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if err := l.add(entry); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(entries) < merkleSyncBatch {
+			return l.head(), nil
+		}
+	}
+}
+
+func (l *MerkleLog) add(entry *AuditEntry) error {
+	if want := l.tree.Size() + 1; entry.Sequence != want {
+		return fmt.Errorf("audit entry %s has sequence %d, expected %d", entry.ID, entry.Sequence, want)
+	}
+	if entry.ComputeHash() != entry.Hash {
+		return fmt.Errorf("audit entry %d content hash mismatch", entry.Sequence)
+	}
+	if entry.PrevHash != l.lastHash {
+		return fmt.Errorf("audit entry %d prev_hash does not match entry %d", entry.Sequence, entry.Sequence-1)
+	}
+
+	leaf, err := EntryLeafHash(entry.Hash)
+	if err != nil {
+		return err
+	}
+
+	l.tree.AppendLeafHash(leaf)
+	l.lastHash = entry.Hash
+	l.lastEntryID = entry.ID
+	return nil
+}
+
+func (l *MerkleLog) head() *MerkleHead {
+	return &MerkleHead{
+		TreeSize:    l.tree.Size(),
+		RootHash:    hex.EncodeToString(l.tree.Root()),
+		LastHash:    l.lastHash,
+		LastEntryID: l.lastEntryID,
+	}
+}
+
+// RootAt returns the hex root hash of the tree at the given size
+func (l *MerkleLog) RootAt(ctx context.Context, size int64) (string, error) {
+	if err := l.ensure(ctx, size); err != nil {
+		return "", err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	root, err := l.tree.RootAt(size)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(root), nil
+}
+
+// InclusionProof returns the audit path for the entry with the given
+// sequence in the tree of the given size
+func (l *MerkleLog) InclusionProof(ctx context.Context, sequence, size int64) ([]string, error) {
+	if err := l.ensure(ctx, size); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	proof, err := l.tree.InclusionProof(sequence-1, size)
+	if err != nil {
+		return nil, err
+	}
+	return encodeProof(proof), nil
+}
+
+// ConsistencyProof returns the proof that the tree of newSize extends the tree of oldSize
+func (l *MerkleLog) ConsistencyProof(ctx context.Context, oldSize, newSize int64) ([]string, error) {
+	if err := l.ensure(ctx, newSize); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	proof, err := l.tree.ConsistencyProof(oldSize, newSize)
+	if err != nil {
+		return nil, err
+	}
+	return encodeProof(proof), nil
+}
+
+// ensure syncs the tree if it is smaller than size
+func (l *MerkleLog) ensure(ctx context.Context, size int64) error {
+	l.mu.Lock()
+	current := l.tree.Size()
+	l.mu.Unlock()
+
+	if size <= current {
+		return nil
+	}
+
+	head, err := l.Sync(ctx)
+	if err != nil {
+		return err
+	}
+	if size > head.TreeSize {
+		return fmt.Errorf("tree size %d exceeds audit log size %d", size, head.TreeSize)
+	}
+	return nil
+}
+
+func encodeProof(proof [][]byte) []string {
+	out := make([]string, len(proof))
+	for i, p := range proof {
+		out[i] = hex.EncodeToString(p)
+	}
+	return out
+}
+
+// DecodeProof decodes a hex-encoded proof
+func DecodeProof(proof []string) ([][]byte, error) {
+	out := make([][]byte, len(proof))
+	for i, p := range proof {
+		b, err := hex.DecodeString(p)
+		if err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("invalid proof node %d", i)
+		}
+		out[i] = b
+	}
+	return out, nil
+}
@@ -224,9 +224,10 @@ type ListEntriesFilter struct {
 // Common audit actions
 const (
 	// Authentication
-	ActionLogin       = "auth.login"
-	ActionLogout      = "auth.logout"
-	ActionLoginFailed = "auth.login_failed"
+	ActionLogin        = "auth.login"
+	ActionLogout       = "auth.logout"
+	ActionLoginFailed  = "auth.login_failed"
+	ActionAccessDenied = "auth.access_denied"
 
 	// Cases
 	ActionCaseCreated     = "case.created"
@@ -258,6 +259,8 @@ const (
 	ActionCorrectionData     = "correction.data"      // Data entry error correction
 	ActionCorrectionVoid     = "correction.void"      // Void a previous entry
 	ActionCorrectionOverride = "correction.override"  // Administrative override
+	ActionCorrectionRequested = "correction.requested" // Correction awaiting a second approver
+	ActionCorrectionRejected  = "correction.rejected"  // Correction request turned down
 )
 
 // CorrectionReason defines standard reasons for corrections
@@ -282,6 +285,7 @@ type CorrectionEntry struct {
 	ApprovedBy        *types.ID        `json:"approved_by,omitempty"` // Supervisor who approved (if required)
 	OldValue          map[string]any   `json:"old_value,omitempty"`  // What was recorded
 	NewValue          map[string]any   `json:"new_value,omitempty"`  // What should have been recorded
+	RequestID         *types.ID        `json:"request_id,omitempty"` // Approved correction request (if any)
 }
 
 // NewCorrectionAuditEntry creates an audit entry for a correction
@@ -308,6 +312,9 @@ func NewCorrectionAuditEntry(
 	if correction.ApprovedBy != nil {
 		changes["correction"].(map[string]any)["approved_by"] = correction.ApprovedBy
 	}
+	if correction.RequestID != nil {
+		changes["correction"].(map[string]any)["request_id"] = correction.RequestID
+	}
 
 	return NewAuditEntry(
 		actorType,
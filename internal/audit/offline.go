@@ -0,0 +1,354 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/serbia-gov/platform/internal/tsa"
+)
+
+// Offline verification checks an exported audit stream and its checkpoints
+// without access to the platform: entry hashes, the prev-hash chain,
+// checkpoint hashes, Merkle roots and witness proofs. Witness proofs are
+// verified against trust anchors supplied by the verifier, never against
+// certificates taken from the export alone.
+
+// maxReportedFailures bounds the failures listed in a report
+const maxReportedFailures = 50
+
+// maxExportCheckpoints bounds the checkpoints written by ExportCheckpoints
+const maxExportCheckpoints = 100000
+
+// OfflineAnchors are the trust anchors witness proofs are verified against
+type OfflineAnchors struct {
+	TSA      *x509.CertPool // roots for RFC 3161 timestamp tokens
+	Agencies *x509.CertPool // roots for multi-agency witness signatures
+}
+
+// OfflineReport is the result of verifying an export offline
+type OfflineReport struct {
+	Entries       int      `json:"entries"`
+	FirstSequence int64    `json:"first_sequence"`
+	LastSequence  int64    `json:"last_sequence"`
+	Checkpoints   int      `json:"checkpoints"`
+	Witnessed     int      `json:"witnessed"` // checkpoints whose witness proof verified
+	Failures      []string `json:"failures,omitempty"`
+	Warnings      []string `json:"warnings,omitempty"`
+	Omitted       int      `json:"omitted_failures,omitempty"` // failures beyond maxReportedFailures
+}
+
+// Valid reports whether the export verified without failures
+func (r *OfflineReport) Valid() bool {
+	return len(r.Failures) == 0
+}
+
+func (r *OfflineReport) fail(format string, args ...any) {
+	if len(r.Failures) >= maxReportedFailures {
+		r.Omitted++
+		return
+	}
+	r.Failures = append(r.Failures, fmt.Sprintf(format, args...))
+}
+
+func (r *OfflineReport) warn(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// String formats the report for people
+func (r *OfflineReport) String() string {
+	var b strings.Builder
+
+	if r.Entries > 0 {
+		fmt.Fprintf(&b, "Entries:     %d (sequence %d to %d)\n", r.Entries, r.FirstSequence, r.LastSequence)
+	} else {
+		fmt.Fprintf(&b, "Entries:     0\n")
+	}
+	fmt.Fprintf(&b, "Checkpoints: %d (%d witnessed)\n", r.Checkpoints, r.Witnessed)
+
+	if len(r.Warnings) > 0 {
+		fmt.Fprintf(&b, "\nWarnings:\n")
+		for _, w := range r.Warnings {
+			fmt.Fprintf(&b, "  - %s\n", w)
+		}
+	}
+	if len(r.Failures) > 0 {
+		fmt.Fprintf(&b, "\nFailures:\n")
+		for _, f := range r.Failures {
+			fmt.Fprintf(&b, "  - %s\n", f)
+		}
+		if r.Omitted > 0 {
+			fmt.Fprintf(&b, "  ... and %d more\n", r.Omitted)
+		}
+	}
+
+	if r.Valid() {
+		fmt.Fprintf(&b, "\nRESULT: VERIFIED\n")
+	} else {
+		fmt.Fprintf(&b, "\nRESULT: FAILED (%d failures)\n", len(r.Failures)+r.Omitted)
+	}
+	return b.String()
+}
+
+// VerifyExport verifies exported entries and checkpoints, both JSON Lines.
+// Entries must be in sequence order, as written by ExportJSONLines;
+// checkpoints may be nil. An error is returned only for unreadable input.
+func VerifyExport(entries io.Reader, checkpoints io.Reader, anchors OfflineAnchors) (*OfflineReport, error) {
+	report := &OfflineReport{}
+
+	hashes, tree, err := verifyExportedEntries(entries, report)
+	if err != nil {
+		return nil, err
+	}
+
+	if checkpoints == nil {
+		return report, nil
+	}
+
+	dec := json.NewDecoder(checkpoints)
+	for {
+		var cp Checkpoint
+		if err := dec.Decode(&cp); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("checkpoint %d: %w", report.Checkpoints+1, err)
+		}
+		report.Checkpoints++
+		verifyExportedCheckpoint(&cp, hashes, tree, anchors, report)
+	}
+
+	return report, nil
+}
+
+// verifyExportedEntries checks entry hashes and the prev-hash chain. It
+// returns the entry hashes by sequence and, when the export starts at the
+// first entry without gaps, the Merkle tree over it.
+func verifyExportedEntries(r io.Reader, report *OfflineReport) (map[int64]string, *MerkleTree, error) {
+	hashes := make(map[int64]string)
+	tree := NewMerkleTree()
+	contiguous := true
+
+	var prev *AuditEntry
+	dec := json.NewDecoder(r)
+	for {
+		var entry AuditEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("entry %d: %w", report.Entries+1, err)
+		}
+		report.Entries++
+
+		if prev == nil {
+			report.FirstSequence = entry.Sequence
+			if entry.Sequence != 1 {
+				contiguous = false
+				report.warn("export starts at sequence %d; the link to earlier entries is not checked", entry.Sequence)
+			} else if entry.PrevHash != "" {
+				report.fail("sequence 1: first entry has a previous hash")
+			}
+		} else {
+			switch {
+			case entry.Sequence <= prev.Sequence:
+				report.fail("sequence %d: out of order after sequence %d", entry.Sequence, prev.Sequence)
+				continue
+			case entry.Sequence != prev.Sequence+1:
+				contiguous = false
+				report.fail("sequences %d to %d are missing", prev.Sequence+1, entry.Sequence-1)
+			case entry.PrevHash != prev.Hash:
+				report.fail("sequence %d: previous hash does not match entry %d", entry.Sequence, prev.Sequence)
+			}
+		}
+
+		if entry.ComputeHash() != entry.Hash {
+			report.fail("sequence %d: hash mismatch (entry %s was modified)", entry.Sequence, entry.ID)
+		}
+
+		if contiguous {
+			leaf, err := EntryLeafHash(entry.Hash)
+			if err != nil {
+				report.fail("sequence %d: %v", entry.Sequence, err)
+				contiguous = false
+			} else {
+				tree.AppendLeafHash(leaf)
+			}
+		}
+
+		hashes[entry.Sequence] = entry.Hash
+		report.LastSequence = entry.Sequence
+		prev = &entry
+	}
+
+	if !contiguous {
+		tree = nil
+	}
+	return hashes, tree, nil
+}
+
+// verifyExportedCheckpoint checks a checkpoint against the exported entries
+// and verifies its witness proof
+func verifyExportedCheckpoint(cp *Checkpoint, hashes map[int64]string, tree *MerkleTree, anchors OfflineAnchors, report *OfflineReport) {
+	name := fmt.Sprintf("checkpoint %s (sequence %d)", cp.ID, cp.LastSequence)
+
+	lastHash, exported := hashes[cp.LastSequence]
+	if cp.RootHash == "" {
+		// The hash of a checkpoint without a Merkle root binds the hash of
+		// its last entry, which it does not record itself
+		switch {
+		case !exported:
+			report.warn("%s predates the Merkle tree and its last entry is not in the export; its hash is not checked", name)
+		case !checkpointHashMatches(cp, lastHash):
+			report.fail("%s: checkpoint hash does not match its contents", name)
+		default:
+			report.warn("%s predates the Merkle tree; its root is not checked", name)
+		}
+	} else {
+		if !checkpointHashMatches(cp, cp.LastHash) {
+			report.fail("%s: checkpoint hash does not match its contents", name)
+		}
+
+		if tree == nil || cp.TreeSize > tree.Size() {
+			report.warn("%s: export does not cover entries 1 to %d; Merkle root not checked", name, cp.TreeSize)
+		} else if root, err := tree.RootAt(cp.TreeSize); err != nil {
+			report.fail("%s: %v", name, err)
+		} else if hex.EncodeToString(root) != cp.RootHash {
+			report.fail("%s: Merkle root mismatch at tree size %d", name, cp.TreeSize)
+		}
+	}
+
+	if !exported && cp.RootHash != "" {
+		report.warn("%s: last entry is not in the export", name)
+	} else if cp.LastHash != "" && lastHash != cp.LastHash {
+		report.fail("%s: last hash does not match entry %d", name, cp.LastSequence)
+	}
+
+	if witnessed := verifyOfflineWitness(cp.WitnessType, cp.WitnessProof, cp, anchors, name, report); witnessed {
+		report.Witnessed++
+	}
+}
+
+// verifyOfflineWitness verifies a witness proof of a checkpoint and reports
+// whether it was verified. Local proofs cannot be verified and only warn.
+func verifyOfflineWitness(witnessType WitnessType, proof []byte, cp *Checkpoint, anchors OfflineAnchors, name string, report *OfflineReport) bool {
+	if len(proof) == 0 {
+		report.fail("%s: no %s witness proof", name, witnessType)
+		return false
+	}
+
+	switch witnessType {
+	case WitnessTypeLocal:
+		report.warn("%s: witnessed locally; the proof cannot be verified independently", name)
+		return false
+
+	case WitnessTypeRFC3161TSA:
+		if anchors.TSA == nil {
+			report.fail("%s: RFC 3161 proof but no TSA trust anchors given", name)
+			return false
+		}
+		hash, err := hex.DecodeString(cp.CheckpointHash)
+		if err != nil {
+			report.fail("%s: invalid checkpoint hash: %v", name, err)
+			return false
+		}
+		result := tsa.VerifyToken(proof, hash, anchors.TSA)
+		if !result.Valid {
+			report.fail("%s: RFC 3161 proof invalid: %s", name, result.Message)
+			return false
+		}
+		return true
+
+	case WitnessTypeMultiAgency:
+		if anchors.Agencies == nil {
+			report.fail("%s: multi-agency proof but no agency trust anchors given", name)
+			return false
+		}
+		p, err := tsa.DeserializeProof(proof)
+		if err != nil {
+			report.fail("%s: failed to decode multi-agency proof: %v", name, err)
+			return false
+		}
+		if p.CheckpointHash != cp.CheckpointHash || p.LastSequence != cp.LastSequence {
+			report.fail("%s: multi-agency proof is for a different checkpoint", name)
+			return false
+		}
+		result := tsa.VerifyProofWithRoots(p, anchors.Agencies)
+		if !result.Valid && p.Status == tsa.ProofStatusPending {
+			report.warn("%s: multi-agency proof is still collecting signatures until %s (%s)",
+				name, p.Deadline.Format(time.RFC3339), result.Message)
+			return false
+		}
+		if !result.Valid {
+			report.fail("%s: multi-agency proof invalid: %s", name, result.Message)
+			return false
+		}
+		return true
+
+	case "composite":
+		var composite compositeProof
+		if err := json.Unmarshal(proof, &composite); err != nil {
+			report.fail("%s: failed to decode composite proof: %v", name, err)
+			return false
+		}
+		// Every proof must verify; a local proof only warns
+		verified := false
+		for _, entry := range composite.Proofs {
+			raw, err := base64.StdEncoding.DecodeString(entry.Proof)
+			if err != nil {
+				report.fail("%s: failed to decode %s proof: %v", name, entry.Type, err)
+				return false
+			}
+			failures := len(report.Failures) + report.Omitted
+			ok := verifyOfflineWitness(entry.Type, raw, cp, anchors, name, report)
+			if !ok && len(report.Failures)+report.Omitted > failures {
+				return false
+			}
+			verified = verified || ok
+		}
+		return verified
+
+	default:
+		report.fail("%s: unknown witness type %q", name, witnessType)
+		return false
+	}
+}
+
+// ExportCheckpoints writes all checkpoints as JSON Lines, oldest first, for
+// offline verification alongside an entry export. Witness proofs are written
+// in their current state. It returns the number of checkpoints written.
+func (s *CheckpointService) ExportCheckpoints(ctx context.Context, w io.Writer) (int, error) {
+	checkpoints, err := s.repo.ListCheckpoints(ctx, maxExportCheckpoints)
+	if err != nil {
+		return 0, err
+	}
+	for i := range checkpoints {
+		s.withCurrentProof(ctx, &checkpoints[i])
+	}
+	sort.SliceStable(checkpoints, func(i, j int) bool {
+		return checkpoints[i].CreatedAt.Before(checkpoints[j].CreatedAt)
+	})
+
+	enc := json.NewEncoder(w)
+	for i := range checkpoints {
+		if err := enc.Encode(&checkpoints[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(checkpoints), nil
+}
+
+// LoadCertPool reads PEM certificates into a pool of trust anchors
+func LoadCertPool(pemData []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bytes.TrimSpace(pemData)) {
+		return nil, fmt.Errorf("no PEM certificates found")
+	}
+	return pool, nil
+}
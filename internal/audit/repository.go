@@ -7,40 +7,55 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/serbia-gov/platform/internal/shared/errors"
 	"github.com/serbia-gov/platform/internal/shared/types"
 )
 
-// Repository provides append-only audit log operations
+// Repository provides append-only audit log operations backed by PostgreSQL.
+// Database triggers reject UPDATE, DELETE and TRUNCATE on audit tables.
 type Repository struct {
 	pool     *pgxpool.Pool
 	mu       sync.Mutex
 	lastHash string
+	sequence int64
 }
 
+const entryColumns = `id, sequence, timestamp, hash, prev_hash,
+			actor_type, actor_id, actor_agency_id, actor_ip, actor_device,
+			action, resource_type, resource_id,
+			changes, correlation_id, session_id, justification`
+
 // NewRepository creates a new audit repository
 func NewRepository(pool *pgxpool.Pool) *Repository {
 	return &Repository{pool: pool}
 }
 
-// Initialize loads the last hash from the database
+// Initialize loads the last hash and sequence from the database
 func (r *Repository) Initialize(ctx context.Context) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	return r.loadHead(ctx)
+}
+
+// loadHead loads the last hash and sequence; the caller must hold mu
+func (r *Repository) loadHead(ctx context.Context) error {
 	var hash string
+	var sequence int64
 	err := r.pool.QueryRow(ctx, `
-		SELECT hash FROM audit.entries
+		SELECT hash, sequence FROM audit.entries
 		ORDER BY sequence DESC
 		LIMIT 1
-	`).Scan(&hash)
+	`).Scan(&hash, &sequence)
 
-	if err != nil && !strings.Contains(err.Error(), "no rows") {
+	if err != nil && err != pgx.ErrNoRows {
 		return errors.Wrap(err, "failed to get last audit hash")
 	}
 
 	r.lastHash = hash
+	r.sequence = sequence
 	return nil
 }
 
@@ -49,8 +64,11 @@ func (r *Repository) Append(ctx context.Context, entry *AuditEntry) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// Set previous hash
+	// Set previous hash and the next sequence. The sequence is assigned here
+	// rather than by BIGSERIAL so that rolled back inserts leave no gaps; the
+	// unique constraint rejects a concurrent writer that forked the chain.
 	entry.PrevHash = r.lastHash
+	entry.Sequence = r.sequence + 1
 
 	// Recalculate hash with prev_hash
 	entry.Hash = entry.calculateHash()
@@ -61,34 +79,36 @@ func (r *Repository) Append(ctx context.Context, entry *AuditEntry) error {
 	}
 
 	query := `
-		INSERT INTO audit.entries (
-			id, timestamp, hash, prev_hash,
-			actor_type, actor_id, actor_agency_id, actor_ip, actor_device,
-			action, resource_type, resource_id,
-			changes, correlation_id, session_id, justification
+		INSERT INTO audit.entries (` + entryColumns + `
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16
-		) RETURNING sequence`
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17
+		)`
 
-	err = r.pool.QueryRow(ctx, query,
-		entry.ID, entry.Timestamp, entry.Hash, entry.PrevHash,
+	_, err = r.pool.Exec(ctx, query,
+		entry.ID, entry.Sequence, entry.Timestamp, entry.Hash, entry.PrevHash,
 		entry.ActorType, entry.ActorID, entry.ActorAgencyID, entry.ActorIP, entry.ActorDevice,
 		entry.Action, entry.ResourceType, entry.ResourceID,
 		changesJSON, entry.CorrelationID, entry.SessionID, entry.Justification,
-	).Scan(&entry.Sequence)
+	)
 
 	if err != nil {
+		// Another writer may have extended the chain; reload the head so
+		// that the next append links to it
+		if loadErr := r.loadHead(ctx); loadErr != nil {
+			fmt.Printf("Warning: failed to reload audit chain head: %v\n", loadErr)
+		}
 		return errors.Wrap(err, "failed to append audit entry")
 	}
 
-	// Update last hash
+	// Update last hash and sequence
 	r.lastHash = entry.Hash
+	r.sequence = entry.Sequence
 
 	return nil
 }
 
 // List lists audit entries with filters (read-only)
-func (r *Repository) List(ctx context.Context, filter ListEntriesFilter) ([]AuditEntry, int, error) {
+func (r *Repository) List(ctx context.Context, filter ListEntriesFilter) ([]*AuditEntry, int, error) {
 	var conditions []string
 	var args []interface{}
 	argNum := 1
@@ -106,8 +126,8 @@ func (r *Repository) List(ctx context.Context, filter ListEntriesFilter) ([]Audi
 	}
 
 	if filter.Action != "" {
-		conditions = append(conditions, fmt.Sprintf("action LIKE $%d", argNum))
-		args = append(args, filter.Action+"%")
+		conditions = append(conditions, fmt.Sprintf("action = $%d", argNum))
+		args = append(args, filter.Action)
 		argNum++
 	}
 
@@ -154,44 +174,18 @@ func (r *Repository) List(ctx context.Context, filter ListEntriesFilter) ([]Audi
 	}
 
 	query := fmt.Sprintf(`
-		SELECT id, sequence, timestamp, hash, prev_hash,
-			actor_type, actor_id, actor_agency_id, actor_ip, actor_device,
-			action, resource_type, resource_id,
-			changes, correlation_id, session_id, justification
+		SELECT %s
 		FROM audit.entries
 		%s
 		ORDER BY sequence DESC
-		LIMIT $%d OFFSET $%d`, whereClause, argNum, argNum+1)
+		LIMIT $%d OFFSET $%d`, entryColumns, whereClause, argNum, argNum+1)
 
 	args = append(args, limit, filter.Offset)
 
-	rows, err := r.pool.Query(ctx, query, args...)
+	entries, err := r.queryEntries(ctx, query, args...)
 	if err != nil {
 		return nil, 0, errors.Wrap(err, "failed to list audit entries")
 	}
-	defer rows.Close()
-
-	var entries []AuditEntry
-	for rows.Next() {
-		var e AuditEntry
-		var changesJSON []byte
-
-		err := rows.Scan(
-			&e.ID, &e.Sequence, &e.Timestamp, &e.Hash, &e.PrevHash,
-			&e.ActorType, &e.ActorID, &e.ActorAgencyID, &e.ActorIP, &e.ActorDevice,
-			&e.Action, &e.ResourceType, &e.ResourceID,
-			&changesJSON, &e.CorrelationID, &e.SessionID, &e.Justification,
-		)
-		if err != nil {
-			return nil, 0, errors.Wrap(err, "failed to scan audit entry")
-		}
-
-		if err := json.Unmarshal(changesJSON, &e.Changes); err != nil {
-			e.Changes = nil
-		}
-
-		entries = append(entries, e)
-	}
 
 	return entries, total, nil
 }
@@ -217,7 +211,7 @@ func (r *Repository) FindByID(ctx context.Context, id types.ID) (*AuditEntry, er
 	)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "no rows") {
+		if err == pgx.ErrNoRows {
 			return nil, errors.NotFound("audit entry", id.String())
 		}
 		return nil, errors.Wrap(err, "failed to find audit entry")
@@ -242,6 +236,19 @@ type VerifyResult struct {
 	Entries         []VerifyEntryResult `json:"entries,omitempty"`
 	LastCheckpoint  string              `json:"last_checkpoint,omitempty"`  // Last witnessed hash
 	CheckpointValid bool                `json:"checkpoint_valid,omitempty"` // Checkpoint matches
+	Corrections     int                 `json:"corrections"`                // Approved correction entries checked
+	CorrectedIDs    []types.ID          `json:"corrected_entry_ids,omitempty"` // Entries amended by those corrections
+}
+
+// noteCorrection counts an approved correction entry in the result and
+// returns the ID of the entry it corrects
+func (r *VerifyResult) noteCorrection(e *AuditEntry) *types.ID {
+	if e.Action != ActionCorrection || e.ResourceID == nil {
+		return nil
+	}
+	r.Corrections++
+	r.CorrectedIDs = append(r.CorrectedIDs, *e.ResourceID)
+	return e.ResourceID
 }
 
 // VerifyEntryResult contains verification result for a single entry
@@ -256,6 +263,7 @@ type VerifyEntryResult struct {
 	LinkageValid  bool     `json:"linkage_valid"`  // Chain link is valid
 	Action        string   `json:"action"`
 	ViolationType string   `json:"violation_type,omitempty"` // "content", "linkage", "both"
+	Corrects      *types.ID `json:"corrects,omitempty"`      // Entry amended by this correction
 }
 
 // VerifyChain verifies the integrity of the audit chain
@@ -322,6 +330,7 @@ func (r *Repository) VerifyChain(ctx context.Context, limit int, includeDetails
 			ContentValid: true,
 			LinkageValid: true,
 			Valid:        true,
+			Corrects:     result.noteCorrection(&e),
 		}
 
 		// 1. Content verification: Recalculate hash and compare
@@ -370,7 +379,7 @@ func (r *Repository) VerifyChain(ctx context.Context, limit int, includeDetails
 }
 
 // GetByResource gets all audit entries for a specific resource
-func (r *Repository) GetByResource(ctx context.Context, resourceType string, resourceID types.ID, limit int) ([]AuditEntry, error) {
+func (r *Repository) GetByResource(ctx context.Context, resourceType string, resourceID types.ID, limit int) ([]*AuditEntry, error) {
 	if limit <= 0 || limit > 100 {
 		limit = 50
 	}
@@ -384,3 +393,239 @@ func (r *Repository) GetByResource(ctx context.Context, resourceType string, res
 	entries, _, err := r.List(ctx, filter)
 	return entries, err
 }
+
+// GetByResources gets the audit entries of several resources in one query
+func (r *Repository) GetByResources(ctx context.Context, resourceType string, resourceIDs []types.ID, limit int) (map[types.ID][]*AuditEntry, error) {
+	result := make(map[types.ID][]*AuditEntry, len(resourceIDs))
+	if len(resourceIDs) == 0 {
+		return result, nil
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	ids := make([]string, len(resourceIDs))
+	for i, id := range resourceIDs {
+		ids[i] = id.String()
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY resource_id ORDER BY sequence DESC) AS rank
+			FROM audit.entries
+			WHERE resource_type = $1 AND resource_id = ANY($2::uuid[])
+		) ranked
+		WHERE rank <= $3
+		ORDER BY sequence DESC`, entryColumns)
+
+	entries, err := r.queryEntries(ctx, query, resourceType, ids, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get audit entries by resource")
+	}
+
+	for _, e := range entries {
+		result[*e.ResourceID] = append(result[*e.ResourceID], e)
+	}
+	return result, nil
+}
+
+// ReadEntries reads up to limit entries in sequence order, starting at fromSequence
+func (r *Repository) ReadEntries(ctx context.Context, fromSequence int64, limit int) ([]*AuditEntry, error) {
+	if fromSequence < 1 {
+		fromSequence = 1
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	entries, err := r.queryEntries(ctx, `
+		SELECT `+entryColumns+`
+		FROM audit.entries
+		WHERE sequence >= $1
+		ORDER BY sequence ASC
+		LIMIT $2`, fromSequence, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read audit entries")
+	}
+
+	return entries, nil
+}
+
+// GetLastHash returns the last hash in the chain
+func (r *Repository) GetLastHash() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastHash
+}
+
+// GetSequence returns the current sequence number
+func (r *Repository) GetSequence() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sequence
+}
+
+// Count returns the total number of audit entries
+func (r *Repository) Count(ctx context.Context) (int, error) {
+	var count int
+	if err := r.pool.QueryRow(ctx, `SELECT COUNT(*) FROM audit.entries`).Scan(&count); err != nil {
+		return 0, errors.Wrap(err, "failed to count audit entries")
+	}
+	return count, nil
+}
+
+const checkpointColumns = `id, checkpoint_hash, last_sequence, last_entry_id, last_hash, entry_count,
+			tree_size, root_hash, witness_type, witness_proof, witness_url, witness_status,
+			created_at, confirmed_at`
+
+// SaveCheckpoint saves a checkpoint
+func (r *Repository) SaveCheckpoint(ctx context.Context, checkpoint *Checkpoint) error {
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO audit.checkpoints (`+checkpointColumns+`
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		checkpoint.ID, checkpoint.CheckpointHash, checkpoint.LastSequence, checkpoint.LastEntryID,
+		nullString(checkpoint.LastHash), checkpoint.EntryCount,
+		nullInt64(checkpoint.TreeSize), nullString(checkpoint.RootHash),
+		checkpoint.WitnessType, checkpoint.WitnessProof, nullString(checkpoint.WitnessURL), checkpoint.WitnessStatus,
+		checkpoint.CreatedAt, checkpoint.ConfirmedAt,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to save checkpoint")
+	}
+	return nil
+}
+
+// GetLatestCheckpoint returns the most recent checkpoint, or nil if there is none
+func (r *Repository) GetLatestCheckpoint(ctx context.Context) (*Checkpoint, error) {
+	checkpoints, err := r.ListCheckpoints(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(checkpoints) == 0 {
+		return nil, nil
+	}
+	return &checkpoints[0], nil
+}
+
+// ListCheckpoints returns checkpoints, newest first
+func (r *Repository) ListCheckpoints(ctx context.Context, limit int) ([]Checkpoint, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+checkpointColumns+`
+		FROM audit.checkpoints
+		ORDER BY created_at DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list checkpoints")
+	}
+	defer rows.Close()
+
+	checkpoints := []Checkpoint{}
+	for rows.Next() {
+		cp, err := scanCheckpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, *cp)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+// GetCheckpoint returns a checkpoint by ID
+func (r *Repository) GetCheckpoint(ctx context.Context, id types.ID) (*Checkpoint, error) {
+	row := r.pool.QueryRow(ctx, `
+		SELECT `+checkpointColumns+`
+		FROM audit.checkpoints
+		WHERE id = $1`, id)
+
+	cp, err := scanCheckpoint(row)
+	if err == pgx.ErrNoRows {
+		return nil, errors.NotFound("checkpoint", id.String())
+	}
+	return cp, err
+}
+
+// queryEntries runs a query selecting entryColumns
+func (r *Repository) queryEntries(ctx context.Context, query string, args ...any) ([]*AuditEntry, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var changesJSON []byte
+
+		err := rows.Scan(
+			&e.ID, &e.Sequence, &e.Timestamp, &e.Hash, &e.PrevHash,
+			&e.ActorType, &e.ActorID, &e.ActorAgencyID, &e.ActorIP, &e.ActorDevice,
+			&e.Action, &e.ResourceType, &e.ResourceID,
+			&changesJSON, &e.CorrelationID, &e.SessionID, &e.Justification,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan audit entry")
+		}
+
+		if err := json.Unmarshal(changesJSON, &e.Changes); err != nil {
+			e.Changes = nil
+		}
+
+		entries = append(entries, &e)
+	}
+
+	return entries, rows.Err()
+}
+
+func scanCheckpoint(row pgx.Row) (*Checkpoint, error) {
+	var cp Checkpoint
+	var lastHash, rootHash, witnessURL *string
+	var treeSize *int64
+
+	err := row.Scan(
+		&cp.ID, &cp.CheckpointHash, &cp.LastSequence, &cp.LastEntryID, &lastHash, &cp.EntryCount,
+		&treeSize, &rootHash, &cp.WitnessType, &cp.WitnessProof, &witnessURL, &cp.WitnessStatus,
+		&cp.CreatedAt, &cp.ConfirmedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scan checkpoint")
+	}
+
+	if lastHash != nil {
+		cp.LastHash = *lastHash
+	}
+	if treeSize != nil {
+		cp.TreeSize = *treeSize
+	}
+	if rootHash != nil {
+		cp.RootHash = *rootHash
+	}
+	if witnessURL != nil {
+		cp.WitnessURL = *witnessURL
+	}
+
+	return &cp, nil
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func nullInt64(n int64) *int64 {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
@@ -0,0 +1,443 @@
+package audit
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/serbia-gov/platform/internal/privacy"
+	"github.com/serbia-gov/platform/internal/shared/config"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+)
+
+// Audit entries are forwarded to the security operations centre as CEF
+// events in RFC 5424 syslog messages over TCP or TLS. The exporter keeps a
+// delivery cursor, the last sequence the SIEM accepted, so entries appended
+// while the exporter or the collector is down are sent after a restart.
+
+const (
+	cefVendor  = "Serbia Gov"
+	cefProduct = "Platform"
+	cefVersion = "1.0"
+
+	// syslogFacility is "log audit" (RFC 5424 facility 13)
+	syslogFacility = 13
+	syslogAppName  = "gov-platform-audit"
+
+	// siemCursorName names the delivery cursor of the syslog exporter
+	siemCursorName = "siem-syslog"
+)
+
+// cefSeverity returns the CEF severity (0-10) of an action
+func cefSeverity(action string) int {
+	switch {
+	case action == privacy.AuditActionPIIViolationDetected:
+		return 9
+	case action == privacy.AuditActionPIIViolationBlocked:
+		return 7
+	case action == ActionLoginFailed, action == ActionAccessDenied, action == privacy.AuditActionAIAccessDenied:
+		return 5
+	case strings.HasPrefix(action, "sensitive."), strings.HasPrefix(action, "privacy.depseudo"):
+		return 6
+	case strings.HasPrefix(action, "correction"), strings.HasPrefix(action, "admin."):
+		return 5
+	default:
+		return 3
+	}
+}
+
+// syslogSeverity maps a CEF severity to a syslog severity
+func syslogSeverity(cef int) int {
+	switch {
+	case cef >= 9:
+		return 2 // critical
+	case cef >= 7:
+		return 3 // error
+	case cef >= 5:
+		return 4 // warning
+	default:
+		return 6 // informational
+	}
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+// FormatCEF formats an audit entry as an ArcSight Common Event Format event
+func FormatCEF(entry *AuditEntry) string {
+	var ext []string
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefExtensionEscaper.Replace(value))
+		}
+	}
+
+	add("rt", strconv.FormatInt(entry.Timestamp.UnixMilli(), 10))
+	add("externalId", entry.ID.String())
+	add("act", entry.Action)
+	add("suid", entry.ActorID.String())
+	add("src", entry.ActorIP)
+	add("requestClientApplication", entry.ActorDevice)
+	add("reason", entry.Justification)
+	add("cn1Label", "sequence")
+	add("cn1", strconv.FormatInt(entry.Sequence, 10))
+	add("cs1Label", "actorType")
+	add("cs1", string(entry.ActorType))
+	if entry.ActorAgencyID != nil {
+		add("cs2Label", "actorAgencyId")
+		add("cs2", entry.ActorAgencyID.String())
+	}
+	add("cs3Label", "resourceType")
+	add("cs3", entry.ResourceType)
+	if entry.ResourceID != nil {
+		add("cs4Label", "resourceId")
+		add("cs4", entry.ResourceID.String())
+	}
+	add("cs5Label", "hash")
+	add("cs5", entry.Hash)
+	add("cs6Label", "prevHash")
+	add("cs6", entry.PrevHash)
+	if len(entry.Changes) > 0 {
+		if changes, err := json.Marshal(entry.Changes); err == nil {
+			add("msg", string(changes))
+		}
+	}
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefHeaderEscaper.Replace(cefVendor),
+		cefHeaderEscaper.Replace(cefProduct),
+		cefHeaderEscaper.Replace(cefVersion),
+		cefHeaderEscaper.Replace(entry.Action),
+		cefHeaderEscaper.Replace(entry.Action+" "+entry.ResourceType),
+		cefSeverity(entry.Action),
+		strings.Join(ext, " "),
+	)
+}
+
+// FormatSyslog formats an audit entry as an RFC 5424 syslog message with a
+// CEF payload, without transport framing
+func FormatSyslog(entry *AuditEntry, hostname string) []byte {
+	pri := syslogFacility*8 + syslogSeverity(cefSeverity(entry.Action))
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		pri,
+		entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		syslogHeaderField(hostname, 255),
+		syslogAppName,
+		os.Getpid(),
+		syslogHeaderField(entry.Action, 32),
+		FormatCEF(entry),
+	))
+}
+
+// syslogHeaderField returns a header field of printable US-ASCII, or the
+// NILVALUE when empty
+func syslogHeaderField(s string, max int) string {
+	var b strings.Builder
+	for _, c := range s {
+		if c > 32 && c < 127 && b.Len() < max {
+			b.WriteRune(c)
+		}
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	return b.String()
+}
+
+// SIEMSink delivers audit entries to a SIEM. Send returns nil only when
+// every entry was handed over.
+type SIEMSink interface {
+	Send(ctx context.Context, entries []*AuditEntry) error
+}
+
+// SyslogSink sends audit entries to a syslog collector over TCP or TLS,
+// framed by octet counting (RFC 5425, RFC 6587)
+type SyslogSink struct {
+	addr      string
+	tlsConfig *tls.Config // nil for plain TCP
+	hostname  string
+	timeout   time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogSink creates a syslog sink. With a nil tlsConfig messages are sent over plain TCP.
+func NewSyslogSink(addr string, tlsConfig *tls.Config) *SyslogSink {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = ""
+	}
+	return &SyslogSink{
+		addr:      addr,
+		tlsConfig: tlsConfig,
+		hostname:  hostname,
+		timeout:   10 * time.Second,
+	}
+}
+
+// NewSyslogSinkFromConfig creates the syslog sink of the audit configuration
+func NewSyslogSinkFromConfig(cfg config.AuditConfig) (*SyslogSink, error) {
+	if !cfg.SIEMSyslogTLS {
+		return NewSyslogSink(cfg.SIEMSyslogAddr, nil), nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.SIEMSyslogCAFile != "" {
+		pem, err := os.ReadFile(cfg.SIEMSyslogCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read syslog CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in syslog CA file %s", cfg.SIEMSyslogCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return NewSyslogSink(cfg.SIEMSyslogAddr, tlsConfig), nil
+}
+
+// Send writes the entries to the collector, connecting if necessary.
+// After a failed write the connection is dropped and re-established on the next call.
+func (s *SyslogSink) Send(ctx context.Context, entries []*AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		dialer := &net.Dialer{Timeout: s.timeout}
+		var conn net.Conn
+		var err error
+		if s.tlsConfig != nil {
+			conn, err = (&tls.Dialer{NetDialer: dialer, Config: s.tlsConfig}).DialContext(ctx, "tcp", s.addr)
+		} else {
+			conn, err = dialer.DialContext(ctx, "tcp", s.addr)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog collector %s: %w", s.addr, err)
+		}
+		s.conn = conn
+	}
+
+	for _, entry := range entries {
+		msg := FormatSyslog(entry, s.hostname)
+		s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+		if _, err := fmt.Fprintf(s.conn, "%d %s", len(msg), msg); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return fmt.Errorf("failed to send audit entry %d to syslog: %w", entry.Sequence, err)
+		}
+	}
+
+	return nil
+}
+
+// Close closes the connection to the collector
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// ExportCursorStore persists delivery cursors of audit exports
+type ExportCursorStore interface {
+	// GetCursor returns the last delivered sequence, 0 if nothing was delivered
+	GetCursor(ctx context.Context, name string) (int64, error)
+	SaveCursor(ctx context.Context, name string, sequence int64) error
+}
+
+// ExportCursorRepository stores export cursors in PostgreSQL
+type ExportCursorRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewExportCursorRepository creates a new export cursor repository
+func NewExportCursorRepository(pool *pgxpool.Pool) *ExportCursorRepository {
+	return &ExportCursorRepository{pool: pool}
+}
+
+// GetCursor returns the last delivered sequence of an export
+func (r *ExportCursorRepository) GetCursor(ctx context.Context, name string) (int64, error) {
+	var sequence int64
+	err := r.pool.QueryRow(ctx, `
+		SELECT last_sequence FROM audit.export_cursors
+		WHERE name = $1`, name).Scan(&sequence)
+	if err == pgx.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get export cursor")
+	}
+	return sequence, nil
+}
+
+// SaveCursor records the last delivered sequence of an export
+func (r *ExportCursorRepository) SaveCursor(ctx context.Context, name string, sequence int64) error {
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO audit.export_cursors (name, last_sequence, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (name) DO UPDATE
+		SET last_sequence = EXCLUDED.last_sequence, updated_at = NOW()`, name, sequence)
+	if err != nil {
+		return errors.Wrap(err, "failed to save export cursor")
+	}
+	return nil
+}
+
+// SIEMExporter forwards audit entries to a SIEM sink in sequence order.
+// Delivery is at least once: the cursor advances only after the sink
+// accepted a batch, so a batch interrupted by a crash is sent again.
+type SIEMExporter struct {
+	repo    AuditRepository
+	sink    SIEMSink
+	cursors ExportCursorStore
+	name    string
+	batch   int
+
+	mu sync.Mutex
+}
+
+// NewSIEMExporter creates a new SIEM exporter
+func NewSIEMExporter(repo AuditRepository, sink SIEMSink, cursors ExportCursorStore) *SIEMExporter {
+	return &SIEMExporter{
+		repo:    repo,
+		sink:    sink,
+		cursors: cursors,
+		name:    siemCursorName,
+		batch:   100,
+	}
+}
+
+// Start forwards new entries until the context is cancelled
+func (e *SIEMExporter) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.Process(ctx); err != nil {
+			fmt.Printf("Warning: SIEM export failed: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process forwards the entries appended since the last delivered sequence
+func (e *SIEMExporter) Process(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	position, err := e.cursors.GetCursor(ctx, e.name)
+	if err != nil {
+		return err
+	}
+
+	for {
+		entries, err := e.repo.ReadEntries(ctx, position+1, e.batch)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		if err := e.sink.Send(ctx, entries); err != nil {
+			return err
+		}
+
+		position = entries[len(entries)-1].Sequence
+		if err := e.cursors.SaveCursor(ctx, e.name, position); err != nil {
+			return err
+		}
+
+		if len(entries) < e.batch {
+			return nil
+		}
+	}
+}
+
+// exportClockSkew allows for entries appended slightly out of timestamp order
+const exportClockSkew = time.Minute
+
+// ExportJSONLines writes the entries with timestamps in [from, to] as JSON
+// Lines in sequence order. Only entries after afterSequence are written, so
+// an interrupted export resumes from the last sequence received.
+// It returns the number of entries written.
+func ExportJSONLines(ctx context.Context, repo AuditRepository, w io.Writer, from, to time.Time, afterSequence int64) (int, error) {
+	start, err := firstSequenceAt(ctx, repo, from.Add(-exportClockSkew))
+	if err != nil {
+		return 0, err
+	}
+	if start <= afterSequence {
+		start = afterSequence + 1
+	}
+
+	enc := json.NewEncoder(w)
+	written := 0
+	for {
+		entries, err := repo.ReadEntries(ctx, start, indexSyncBatch)
+		if err != nil {
+			return written, err
+		}
+
+		for _, entry := range entries {
+			if entry.Timestamp.After(to.Add(exportClockSkew)) {
+				return written, nil
+			}
+			if entry.Timestamp.Before(from) || entry.Timestamp.After(to) {
+				continue
+			}
+			if err := enc.Encode(entry); err != nil {
+				return written, err
+			}
+			written++
+		}
+
+		if len(entries) < indexSyncBatch {
+			return written, nil
+		}
+		start = entries[len(entries)-1].Sequence + 1
+	}
+}
+
+// firstSequenceAt returns the first sequence with a timestamp at or after t,
+// found by binary search over the chain
+func firstSequenceAt(ctx context.Context, repo AuditRepository, t time.Time) (int64, error) {
+	lo, hi := int64(1), repo.GetSequence()+1
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		entries, err := repo.ReadEntries(ctx, mid, 1)
+		if err != nil {
+			return 0, err
+		}
+		if len(entries) == 0 || !entries[0].Timestamp.Before(t) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo, nil
+}
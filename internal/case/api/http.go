@@ -13,10 +13,24 @@ import (
 	"github.com/serbia-gov/platform/internal/shared/types"
 )
 
+// Permissions remote agencies are granted on the case routes the federation
+// gateway forwards to
+const (
+	PermissionFederatedRead  = "case.read"
+	PermissionFederatedShare = "case.share"
+)
+
 // Handler provides HTTP handlers for the case module
 type Handler struct {
-	repo domain.Repository
-	bus  events.EventBus
+	repo   domain.Repository
+	bus    events.EventBus
+	access AccessRecorder // nil when read access is not recorded
+}
+
+// AccessRecorder records reads of case data for data-subject access reports
+// (implemented by audit.AccessRecorder)
+type AccessRecorder interface {
+	RecordCaseAccess(ctx context.Context, caseID types.ID, resourceType string, resourceID types.ID)
 }
 
 // NewHandler creates a new case handler
@@ -24,6 +38,11 @@ func NewHandler(repo domain.Repository, bus events.EventBus) *Handler {
 	return &Handler{repo: repo, bus: bus}
 }
 
+// SetAccessRecorder enables recording of case views
+func (h *Handler) SetAccessRecorder(access AccessRecorder) {
+	h.access = access
+}
+
 // Routes registers the case routes
 func (h *Handler) Routes() chi.Router {
 	r := chi.NewRouter()
@@ -46,6 +65,10 @@ func (h *Handler) Routes() chi.Router {
 		r.Post("/share", h.ShareCase)
 		r.Post("/transfer", h.TransferCase)
 
+		// Legal hold
+		r.Post("/legal-hold", h.PlaceLegalHold)
+		r.Delete("/legal-hold", h.ReleaseLegalHold)
+
 		// Participants
 		r.Route("/participants", func(r chi.Router) {
 			r.Get("/", h.ListParticipants)
@@ -91,6 +114,11 @@ type EscalateCaseRequest struct {
 	EscalateTo  types.ID `json:"escalate_to"`
 }
 
+type LegalHoldRequest struct {
+	Reason    string `json:"reason"`
+	Reference string `json:"reference,omitempty"`
+}
+
 type ShareCaseRequest struct {
 	AgencyID    types.ID            `json:"agency_id"`
 	AccessLevel domain.AccessLevel  `json:"access_level"`
@@ -205,6 +233,9 @@ func (h *Handler) GetCase(w http.ResponseWriter, r *http.Request) {
 
 	// Check access
 	user := auth.GetUser(r.Context())
+	if !authorizeAgency(w, user, c, PermissionFederatedRead, domain.AccessLevelRead) {
+		return
+	}
 	if user != nil && !user.AgencyID.IsZero() {
 		if !c.CanAccess(user.AgencyID, domain.AccessLevelRead) {
 			writeError(w, errors.Forbidden("no access to this case"))
@@ -212,6 +243,10 @@ func (h *Handler) GetCase(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if h.access != nil {
+		h.access.RecordCaseAccess(r.Context(), c.ID, "case", c.ID)
+	}
+
 	writeJSON(w, http.StatusOK, c)
 }
 
@@ -301,6 +336,17 @@ func (h *Handler) DeleteCase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	c, err := h.repo.FindByID(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := c.CanDelete(); err != nil {
+		writeError(w, errors.Conflict(err.Error()))
+		return
+	}
+
 	if err := h.repo.Delete(r.Context(), id); err != nil {
 		writeError(w, err)
 		return
@@ -309,6 +355,70 @@ func (h *Handler) DeleteCase(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *Handler) PlaceLegalHold(w http.ResponseWriter, r *http.Request) {
+	c, user := h.getCaseAndUser(w, r)
+	if c == nil {
+		return
+	}
+
+	if user.AgencyID != c.OwningAgencyID {
+		writeError(w, errors.Forbidden("only the owning agency can place a legal hold"))
+		return
+	}
+
+	var req LegalHoldRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+
+	if err := c.PlaceLegalHold(req.Reason, req.Reference, user.ID, user.AgencyID); err != nil {
+		writeError(w, errors.Conflict(err.Error()))
+		return
+	}
+
+	if err := h.repo.Update(r.Context(), c); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	h.publishEvents(r.Context(), c)
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (h *Handler) ReleaseLegalHold(w http.ResponseWriter, r *http.Request) {
+	c, user := h.getCaseAndUser(w, r)
+	if c == nil {
+		return
+	}
+
+	if user.AgencyID != c.OwningAgencyID {
+		writeError(w, errors.Forbidden("only the owning agency can release a legal hold"))
+		return
+	}
+
+	var req LegalHoldRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, errors.BadRequest("invalid request body"))
+			return
+		}
+	}
+
+	if err := c.ReleaseLegalHold(req.Reason, user.ID, user.AgencyID); err != nil {
+		writeError(w, errors.Conflict(err.Error()))
+		return
+	}
+
+	if err := h.repo.Update(r.Context(), c); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	h.publishEvents(r.Context(), c)
+	writeJSON(w, http.StatusOK, c)
+}
+
 func (h *Handler) OpenCase(w http.ResponseWriter, r *http.Request) {
 	c, user := h.getCaseAndUser(w, r)
 	if c == nil {
@@ -406,6 +516,9 @@ func (h *Handler) ShareCase(w http.ResponseWriter, r *http.Request) {
 	if c == nil {
 		return
 	}
+	if !authorizeAgency(w, user, c, PermissionFederatedShare, domain.AccessLevelFull) {
+		return
+	}
 
 	var req ShareCaseRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -609,6 +722,24 @@ func (h *Handler) getCaseAndUser(w http.ResponseWriter, r *http.Request) (*domai
 	return c, user
 }
 
+// authorizeAgency checks that a remote agency calling through the federation
+// gateway holds the permission and the access level on the case. Other users
+// are not affected.
+func authorizeAgency(w http.ResponseWriter, user *auth.User, c *domain.Case, permission string, level domain.AccessLevel) bool {
+	if user == nil || !user.IsAgency() {
+		return true
+	}
+	if !user.HasPermission(permission) {
+		writeError(w, errors.Forbidden("agency "+user.AgencyCode+" lacks permission "+permission))
+		return false
+	}
+	if !c.CanAccess(user.AgencyID, level) {
+		writeError(w, errors.Forbidden("agency "+user.AgencyCode+" has no access to this case"))
+		return false
+	}
+	return true
+}
+
 func (h *Handler) publishEvents(ctx context.Context, c *domain.Case) {
 	if h.bus == nil {
 		return
@@ -94,6 +94,9 @@ type Case struct {
 	SharedWith   []types.ID             `json:"shared_with"`
 	AccessLevels map[string]AccessLevel `json:"access_levels"`
 
+	// Legal hold blocks deletion and disposition
+	LegalHold *types.LegalHold `json:"legal_hold,omitempty"`
+
 	// Timestamps
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
@@ -345,6 +348,58 @@ func (c *Case) Escalate(level int, reason string, escalatedTo types.ID, actorID,
 	return nil
 }
 
+// PlaceLegalHold places the case under legal hold
+func (c *Case) PlaceLegalHold(reason, reference string, actorID, actorAgencyID types.ID) error {
+	if c.LegalHold != nil {
+		return fmt.Errorf("case is already under legal hold")
+	}
+
+	hold, err := types.NewLegalHold(reason, reference, actorID)
+	if err != nil {
+		return err
+	}
+
+	c.LegalHold = hold
+	c.UpdatedAt = hold.PlacedAt
+
+	c.addEvent(CaseEventTypeLegalHoldPlaced, actorID, actorAgencyID, reason, map[string]any{
+		"reference": reference,
+	})
+
+	return nil
+}
+
+// ReleaseLegalHold releases the legal hold on the case
+func (c *Case) ReleaseLegalHold(reason string, actorID, actorAgencyID types.ID) error {
+	if c.LegalHold == nil {
+		return fmt.Errorf("case is not under legal hold")
+	}
+
+	hold := c.LegalHold
+	c.LegalHold = nil
+	c.UpdatedAt = time.Now()
+
+	c.addEvent(CaseEventTypeLegalHoldReleased, actorID, actorAgencyID, reason, map[string]any{
+		"hold_reason": hold.Reason,
+		"reference":   hold.Reference,
+		"placed_at":   hold.PlacedAt,
+	})
+
+	return nil
+}
+
+// CanDelete checks if the case may be deleted. Only drafts can be deleted;
+// registered cases are disposed of under their retention schedule.
+func (c *Case) CanDelete() error {
+	if c.LegalHold != nil {
+		return fmt.Errorf("cannot delete case under legal hold")
+	}
+	if c.Status != CaseStatusDraft {
+		return fmt.Errorf("only draft cases can be deleted; %s cases are disposed of under their retention schedule", c.Status)
+	}
+	return nil
+}
+
 // CanAccess checks if an agency can access this case with the required level
 func (c *Case) CanAccess(agencyID types.ID, requiredLevel AccessLevel) bool {
 	// Owner always has full access
@@ -526,3 +526,57 @@ func TestCaseNumberGeneration(t *testing.T) {
 		})
 	}
 }
+
+// TestCaseLegalHold tests placing and releasing a legal hold
+func TestCaseLegalHold(t *testing.T) {
+	agencyID := types.NewID()
+	workerID := types.NewID()
+
+	c, _ := NewCase(CaseTypeCriminal, PriorityHigh, "Hold Test", "Testing legal hold", agencyID, workerID)
+	c.GetDomainEvents() // Clear creation event
+
+	if err := c.CanDelete(); err != nil {
+		t.Errorf("Expected draft case to be deletable, got: %v", err)
+	}
+
+	if err := c.PlaceLegalHold("", "", workerID, agencyID); err == nil {
+		t.Error("Expected error for legal hold without reason")
+	}
+
+	if err := c.PlaceLegalHold("Criminal investigation", "KT-45/2026", workerID, agencyID); err != nil {
+		t.Fatalf("PlaceLegalHold failed: %v", err)
+	}
+	if c.LegalHold == nil || c.LegalHold.Reference != "KT-45/2026" {
+		t.Error("Expected legal hold to be set")
+	}
+	if err := c.PlaceLegalHold("Again", "", workerID, agencyID); err == nil {
+		t.Error("Expected error placing a second legal hold")
+	}
+	if err := c.CanDelete(); err == nil {
+		t.Error("Expected error deleting case under legal hold")
+	}
+
+	if err := c.ReleaseLegalHold("Investigation concluded", workerID, agencyID); err != nil {
+		t.Fatalf("ReleaseLegalHold failed: %v", err)
+	}
+	if c.LegalHold != nil {
+		t.Error("Expected legal hold to be released")
+	}
+	if err := c.ReleaseLegalHold("", workerID, agencyID); err == nil {
+		t.Error("Expected error releasing case without legal hold")
+	}
+
+	events := c.GetDomainEvents()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if events[0].Type != string(CaseEventTypeLegalHoldPlaced) || events[1].Type != string(CaseEventTypeLegalHoldReleased) {
+		t.Errorf("Unexpected events: %s, %s", events[0].Type, events[1].Type)
+	}
+
+	// Registered cases are disposed of under the retention schedule
+	c.Open(workerID, agencyID)
+	if err := c.CanDelete(); err == nil {
+		t.Error("Expected error deleting open case")
+	}
+}
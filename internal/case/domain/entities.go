@@ -81,23 +81,25 @@ func (a *Assignment) Complete() {
 type CaseEventType string
 
 const (
-	CaseEventTypeCreated          CaseEventType = "created"
-	CaseEventTypeUpdated          CaseEventType = "updated"
-	CaseEventTypeStatusChanged    CaseEventType = "status_changed"
-	CaseEventTypeAssigned         CaseEventType = "assigned"
-	CaseEventTypeReassigned       CaseEventType = "reassigned"
-	CaseEventTypeTransferred      CaseEventType = "transferred"
-	CaseEventTypeEscalated        CaseEventType = "escalated"
-	CaseEventTypeDocumentAdded    CaseEventType = "document_added"
-	CaseEventTypeDocumentSigned   CaseEventType = "document_signed"
-	CaseEventTypeNoteAdded        CaseEventType = "note_added"
-	CaseEventTypeParticipantAdded CaseEventType = "participant_added"
-	CaseEventTypeShared           CaseEventType = "shared"
-	CaseEventTypeAccessChanged    CaseEventType = "access_changed"
-	CaseEventTypeSLAWarning       CaseEventType = "sla_warning"
-	CaseEventTypeSLABreached      CaseEventType = "sla_breached"
-	CaseEventTypeClosed           CaseEventType = "closed"
-	CaseEventTypeReopened         CaseEventType = "reopened"
+	CaseEventTypeCreated           CaseEventType = "created"
+	CaseEventTypeUpdated           CaseEventType = "updated"
+	CaseEventTypeStatusChanged     CaseEventType = "status_changed"
+	CaseEventTypeAssigned          CaseEventType = "assigned"
+	CaseEventTypeReassigned        CaseEventType = "reassigned"
+	CaseEventTypeTransferred       CaseEventType = "transferred"
+	CaseEventTypeEscalated         CaseEventType = "escalated"
+	CaseEventTypeDocumentAdded     CaseEventType = "document_added"
+	CaseEventTypeDocumentSigned    CaseEventType = "document_signed"
+	CaseEventTypeNoteAdded         CaseEventType = "note_added"
+	CaseEventTypeParticipantAdded  CaseEventType = "participant_added"
+	CaseEventTypeShared            CaseEventType = "shared"
+	CaseEventTypeAccessChanged     CaseEventType = "access_changed"
+	CaseEventTypeSLAWarning        CaseEventType = "sla_warning"
+	CaseEventTypeSLABreached       CaseEventType = "sla_breached"
+	CaseEventTypeClosed            CaseEventType = "closed"
+	CaseEventTypeReopened          CaseEventType = "reopened"
+	CaseEventTypeLegalHoldPlaced   CaseEventType = "legal_hold_placed"
+	CaseEventTypeLegalHoldReleased CaseEventType = "legal_hold_released"
 )
 
 // CaseEvent represents an event in the case timeline
@@ -13,7 +13,7 @@ type Repository interface {
 	FindByID(ctx context.Context, id types.ID) (*Case, error)
 	FindByCaseNumber(ctx context.Context, caseNumber string) (*Case, error)
 	Update(ctx context.Context, c *Case) error
-	Delete(ctx context.Context, id types.ID) error
+	Delete(ctx context.Context, id types.ID) error // drafts not under legal hold only
 
 	// Query operations
 	List(ctx context.Context, filter ListFilter) ([]Case, int, error)
@@ -42,17 +42,17 @@ func (r *PostgresRepository) Save(ctx context.Context, c *domain.Case) error {
 			id, case_number, type, status, priority, title, description,
 			owning_agency_id, lead_worker_id,
 			sla_deadline, sla_status,
-			shared_with, access_levels,
+			shared_with, access_levels, legal_hold,
 			created_at, updated_at
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16
 		)`
 
 	_, err = tx.Exec(ctx, query,
 		c.ID, c.CaseNumber, c.Type, c.Status, c.Priority, c.Title, c.Description,
 		c.OwningAgencyID, c.LeadWorkerID,
 		c.SLADeadline, c.SLAStatus,
-		c.SharedWith, accessLevelsJSON,
+		c.SharedWith, accessLevelsJSON, c.LegalHold,
 		c.CreatedAt, c.UpdatedAt,
 	)
 
@@ -97,7 +97,7 @@ func (r *PostgresRepository) FindByID(ctx context.Context, id types.ID) (*domain
 		SELECT id, case_number, type, status, priority, title, description,
 			owning_agency_id, lead_worker_id,
 			sla_deadline, sla_status,
-			shared_with, access_levels,
+			shared_with, access_levels, legal_hold,
 			created_at, updated_at, closed_at
 		FROM cases.cases
 		WHERE id = $1`
@@ -109,7 +109,7 @@ func (r *PostgresRepository) FindByID(ctx context.Context, id types.ID) (*domain
 		&c.ID, &c.CaseNumber, &c.Type, &c.Status, &c.Priority, &c.Title, &c.Description,
 		&c.OwningAgencyID, &c.LeadWorkerID,
 		&c.SLADeadline, &c.SLAStatus,
-		&c.SharedWith, &accessLevelsJSON,
+		&c.SharedWith, &accessLevelsJSON, &c.LegalHold,
 		&c.CreatedAt, &c.UpdatedAt, &c.ClosedAt,
 	)
 
@@ -168,15 +168,15 @@ func (r *PostgresRepository) Update(ctx context.Context, c *domain.Case) error {
 			status = $2, priority = $3, title = $4, description = $5,
 			owning_agency_id = $6, lead_worker_id = $7,
 			sla_deadline = $8, sla_status = $9,
-			shared_with = $10, access_levels = $11,
-			updated_at = $12, closed_at = $13
+			shared_with = $10, access_levels = $11, legal_hold = $12,
+			updated_at = $13, closed_at = $14
 		WHERE id = $1`
 
 	result, err := r.pool.Exec(ctx, query,
 		c.ID, c.Status, c.Priority, c.Title, c.Description,
 		c.OwningAgencyID, c.LeadWorkerID,
 		c.SLADeadline, c.SLAStatus,
-		c.SharedWith, accessLevelsJSON,
+		c.SharedWith, accessLevelsJSON, c.LegalHold,
 		c.UpdatedAt, c.ClosedAt,
 	)
 
@@ -191,14 +191,26 @@ func (r *PostgresRepository) Update(ctx context.Context, c *domain.Case) error {
 	return nil
 }
 
-// Delete deletes a case
+// Delete deletes a draft case that is not under legal hold
 func (r *PostgresRepository) Delete(ctx context.Context, id types.ID) error {
-	result, err := r.pool.Exec(ctx, `DELETE FROM cases.cases WHERE id = $1`, id)
+	// The conditions of CanDelete are repeated here, so that a legal hold
+	// placed after the check is not deleted through
+	result, err := r.pool.Exec(ctx, `
+		DELETE FROM cases.cases
+		WHERE id = $1 AND legal_hold IS NULL AND status = $2
+	`, id, domain.CaseStatusDraft)
 	if err != nil {
 		return errors.Wrap(err, "failed to delete case")
 	}
 
 	if result.RowsAffected() == 0 {
+		var exists bool
+		if err := r.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM cases.cases WHERE id = $1)`, id).Scan(&exists); err != nil {
+			return errors.Wrap(err, "failed to delete case")
+		}
+		if exists {
+			return errors.Conflict("case is under legal hold or no longer a draft")
+		}
 		return errors.NotFound("case", id.String())
 	}
 
@@ -305,7 +317,7 @@ func (r *PostgresRepository) listCases(ctx context.Context, filter domain.ListFi
 		SELECT id, case_number, type, status, priority, title, description,
 			owning_agency_id, lead_worker_id,
 			sla_deadline, sla_status,
-			shared_with, access_levels,
+			shared_with, access_levels, legal_hold,
 			created_at, updated_at, closed_at
 		FROM cases.cases
 		%s
@@ -329,7 +341,7 @@ func (r *PostgresRepository) listCases(ctx context.Context, filter domain.ListFi
 			&c.ID, &c.CaseNumber, &c.Type, &c.Status, &c.Priority, &c.Title, &c.Description,
 			&c.OwningAgencyID, &c.LeadWorkerID,
 			&c.SLADeadline, &c.SLAStatus,
-			&c.SharedWith, &accessLevelsJSON,
+			&c.SharedWith, &accessLevelsJSON, &c.LegalHold,
 			&c.CreatedAt, &c.UpdatedAt, &c.ClosedAt,
 		)
 		if err != nil {
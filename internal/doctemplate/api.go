@@ -0,0 +1,335 @@
+package doctemplate
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/serbia-gov/platform/internal/document"
+	"github.com/serbia-gov/platform/internal/shared/auth"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/events"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// Handler provides HTTP handlers for the template module
+type Handler struct {
+	repo      *Repository
+	generator *Generator
+	bus       events.EventBus
+}
+
+// NewHandler creates a new template handler
+func NewHandler(repo *Repository, generator *Generator, bus events.EventBus) *Handler {
+	return &Handler{repo: repo, generator: generator, bus: bus}
+}
+
+// Routes registers the template routes
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/", h.ListTemplates)
+	r.Post("/", h.CreateTemplate)
+
+	r.Route("/{templateID}", func(r chi.Router) {
+		r.Get("/", h.GetTemplate)
+		r.Post("/retire", h.RetireTemplate)
+
+		// Revisions
+		r.Post("/revisions", h.AddRevision)
+		r.Get("/revisions/{revision}", h.GetRevision)
+
+		// Generation
+		r.Post("/preview", h.Preview)
+		r.Post("/generate", h.Generate)
+	})
+
+	return r
+}
+
+// ListTemplates lists templates available to the caller's agency
+func (h *Handler) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	filter := ListTemplatesFilter{}
+
+	if t := r.URL.Query().Get("document_type"); t != "" {
+		docType := document.DocumentType(t)
+		filter.DocumentType = &docType
+	}
+
+	if s := r.URL.Query().Get("status"); s != "" {
+		status := Status(s)
+		filter.Status = &status
+	}
+
+	if user := auth.GetUser(r.Context()); user != nil && !user.IsAdmin() {
+		filter.OwnerAgencyID = &user.AgencyID
+	}
+
+	templates, total, err := h.repo.List(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data":  templates,
+		"total": total,
+	})
+}
+
+// CreateTemplate creates a template with its first revision
+func (h *Handler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var req CreateTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+
+	userID, agencyID := actor(r)
+
+	// National templates are managed centrally
+	var owner *types.ID
+	if req.National {
+		if user := auth.GetUser(r.Context()); user != nil && !user.IsAdmin() {
+			writeError(w, errors.Forbidden("only administrators can create national templates"))
+			return
+		}
+	} else {
+		owner = &agencyID
+	}
+
+	t, err := NewTemplate(req.Code, req.Name, req.Description, req.DocumentType, req.Script, owner, req.Body, userID)
+	if err != nil {
+		writeError(w, errors.BadRequest(err.Error()))
+		return
+	}
+
+	if err := h.repo.Save(r.Context(), t); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	h.publish(r, "document.template.created", t, userID, agencyID)
+
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// GetTemplate gets a template with all revisions
+func (h *Handler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.loadTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, t)
+}
+
+// AddRevision adds a new revision to a template
+func (h *Handler) AddRevision(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.loadTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	var req AddRevisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+
+	userID, agencyID := actor(r)
+	if !h.canManage(r, t, agencyID) {
+		writeError(w, errors.Forbidden("template belongs to another agency"))
+		return
+	}
+
+	rev, err := t.AddRevision(req.Body, req.ChangeSummary, userID)
+	if err != nil {
+		writeError(w, errors.BadRequest(err.Error()))
+		return
+	}
+
+	if err := h.repo.AddRevision(r.Context(), t, rev); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	h.publish(r, "document.template.revised", t, userID, agencyID)
+
+	writeJSON(w, http.StatusCreated, rev)
+}
+
+// GetRevision gets a specific template revision
+func (h *Handler) GetRevision(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.loadTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	revision, err := strconv.Atoi(chi.URLParam(r, "revision"))
+	if err != nil || revision < 1 {
+		writeError(w, errors.BadRequest("invalid revision"))
+		return
+	}
+
+	rev, err := t.Revision(revision)
+	if err != nil {
+		writeError(w, errors.NotFound("template revision", chi.URLParam(r, "revision")))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rev)
+}
+
+// RetireTemplate prevents further generation from a template
+func (h *Handler) RetireTemplate(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.loadTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	userID, agencyID := actor(r)
+	if !h.canManage(r, t, agencyID) {
+		writeError(w, errors.Forbidden("template belongs to another agency"))
+		return
+	}
+
+	if err := t.Retire(); err != nil {
+		writeError(w, errors.BadRequest(err.Error()))
+		return
+	}
+
+	if err := h.repo.Update(r.Context(), t); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	h.publish(r, "document.template.retired", t, userID, agencyID)
+
+	writeJSON(w, http.StatusOK, t)
+}
+
+// Preview renders a template to PDF without creating a document
+func (h *Handler) Preview(w http.ResponseWriter, r *http.Request) {
+	id, err := types.ParseID(chi.URLParam(r, "templateID"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid template ID"))
+		return
+	}
+
+	var req GenerateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+
+	_, agencyID := actor(r)
+
+	pdf, err := h.generator.Preview(r.Context(), id, req, agencyID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(pdf)
+}
+
+// Generate creates a document version from a template
+func (h *Handler) Generate(w http.ResponseWriter, r *http.Request) {
+	id, err := types.ParseID(chi.URLParam(r, "templateID"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid template ID"))
+		return
+	}
+
+	var req GenerateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+
+	userID, agencyID := actor(r)
+
+	generated, err := h.generator.Generate(r.Context(), id, req, userID, agencyID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, generated)
+}
+
+// --- Helpers ---
+
+func (h *Handler) loadTemplate(w http.ResponseWriter, r *http.Request) (*Template, bool) {
+	id, err := types.ParseID(chi.URLParam(r, "templateID"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid template ID"))
+		return nil, false
+	}
+
+	t, err := h.repo.FindByID(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+
+	return t, true
+}
+
+// canManage checks if the caller may revise or retire a template
+func (h *Handler) canManage(r *http.Request, t *Template, agencyID types.ID) bool {
+	if user := auth.GetUser(r.Context()); user == nil || user.IsAdmin() {
+		return true
+	}
+	return t.OwnerAgencyID != nil && *t.OwnerAgencyID == agencyID
+}
+
+func (h *Handler) publish(r *http.Request, eventType string, t *Template, userID, agencyID types.ID) {
+	if h.bus == nil {
+		return
+	}
+
+	event := events.NewEvent(eventType, "document", map[string]any{
+		"template_id":      t.ID,
+		"template_code":    t.Code,
+		"current_revision": t.CurrentRevision,
+	}).WithActor(userID, "worker", agencyID)
+
+	h.bus.Publish(r.Context(), event)
+}
+
+// actor returns the calling user and agency
+func actor(r *http.Request) (userID, agencyID types.ID) {
+	if user := auth.GetUser(r.Context()); user != nil {
+		return user.ID, user.AgencyID
+	}
+	return types.NewID(), types.NewID()
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if appErr, ok := err.(*errors.AppError); ok {
+		w.WriteHeader(appErr.HTTPStatus)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error":   appErr.Message,
+			"code":    appErr.Code,
+			"details": appErr.Details,
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]string{"error": "internal server error"})
+}
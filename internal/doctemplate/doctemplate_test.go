@@ -0,0 +1,260 @@
+package doctemplate
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/serbia-gov/platform/internal/agency"
+	"github.com/serbia-gov/platform/internal/case/domain"
+	"github.com/serbia-gov/platform/internal/document"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+const testBody = `<h1>РЕШЕЊЕ</h1>
+<p>Број: {{.Document.Number}}<br>Датум: {{date .Document.Date}}</p>
+<p><strong>{{.Agency.Name | cyr}}</strong> доноси решење у предмету {{.Case.CaseNumber}}.</p>
+<ul>{{range byRole .Participants "subject"}}<li>{{cyr .Name}}</li>{{end}}</ul>
+<table><tr><th>Услуга</th><th>Износ</th></tr><tr><td>{{.Values.service}}</td><td class="right">{{.Values.amount}}</td></tr></table>`
+
+func newTestTemplate(t *testing.T) *Template {
+	t.Helper()
+	tmpl, err := NewTemplate("CSR-RESENJE", "Решење", "", document.DocumentTypeDecision, ScriptCyrillic, nil, testBody, types.NewID())
+	if err != nil {
+		t.Fatalf("NewTemplate failed: %v", err)
+	}
+	return tmpl
+}
+
+func newTestRenderData() *RenderData {
+	c := &domain.Case{
+		CaseNumber: "CSR-2026-00042",
+		Participants: []domain.Participant{
+			{Name: "Ljubica Đorđević", Role: domain.ParticipantRoleSubject},
+			{Name: "Marko Marković", Role: domain.ParticipantRoleWitness},
+		},
+	}
+	return &RenderData{
+		Document: DocumentData{Number: "DEC-2026-000001", Date: time.Date(2026, 3, 5, 10, 0, 0, 0, time.UTC)},
+		Case:     c,
+		Agency:   &agency.Agency{Name: "Centar za socijalni rad Kikinda"},
+		Values:   map[string]string{"service": "Помоћ у кући", "amount": "12.000,00"},
+	}
+}
+
+func TestTransliteration(t *testing.T) {
+	tests := []struct {
+		latin    string
+		cyrillic string
+	}{
+		{"Ljubica Đorđević", "Љубица Ђорђевић"},
+		{"Njegoš", "Његош"},
+		{"Džonić", "Џонић"},
+		{"ČAČAK", "ЧАЧАК"},
+		{"LJUBOVIJA", "ЉУБОВИЈА"},
+		{"Kikinda 23300", "Кикинда 23300"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.latin, func(t *testing.T) {
+			if got := ToCyrillic(tt.latin); got != tt.cyrillic {
+				t.Errorf("ToCyrillic(%q) = %q, want %q", tt.latin, got, tt.cyrillic)
+			}
+			if got := ToLatin(tt.cyrillic); got != tt.latin {
+				t.Errorf("ToLatin(%q) = %q, want %q", tt.cyrillic, got, tt.latin)
+			}
+		})
+	}
+}
+
+func TestTemplateRevisions(t *testing.T) {
+	tmpl := newTestTemplate(t)
+
+	if tmpl.CurrentRevision != 1 || len(tmpl.Revisions) != 1 {
+		t.Fatalf("Expected initial revision 1, got %d", tmpl.CurrentRevision)
+	}
+	if tmpl.Revisions[0].BodyHash == "" {
+		t.Error("Expected body hash to be set")
+	}
+
+	if _, err := tmpl.AddRevision("<p>{{.Broken</p>", "broken", types.NewID()); err == nil {
+		t.Error("Expected error for invalid template body")
+	}
+	if tmpl.CurrentRevision != 1 {
+		t.Error("Invalid revision should not advance current revision")
+	}
+
+	rev, err := tmpl.AddRevision("<p>{{.Document.Number}}</p>", "Shorter", types.NewID())
+	if err != nil {
+		t.Fatalf("AddRevision failed: %v", err)
+	}
+	if rev.Revision != 2 {
+		t.Errorf("Expected revision 2, got %d", rev.Revision)
+	}
+
+	current, _ := tmpl.Revision(0)
+	if current.Revision != 2 {
+		t.Error("Revision(0) should return the current revision")
+	}
+	if _, err := tmpl.Revision(5); err == nil {
+		t.Error("Expected error for unknown revision")
+	}
+
+	if err := tmpl.Retire(); err != nil {
+		t.Fatalf("Retire failed: %v", err)
+	}
+	if _, err := tmpl.AddRevision("<p>x</p>", "", types.NewID()); err == nil {
+		t.Error("Expected error revising retired template")
+	}
+}
+
+func TestTemplateOwnership(t *testing.T) {
+	owner := types.NewID()
+	tmpl, err := NewTemplate("LOCAL", "Local", "", document.DocumentTypeReport, ScriptLatin, &owner, "<p>x</p>", types.NewID())
+	if err != nil {
+		t.Fatalf("NewTemplate failed: %v", err)
+	}
+
+	if !tmpl.CanUse(owner) {
+		t.Error("Owner should be able to use template")
+	}
+	if tmpl.CanUse(types.NewID()) {
+		t.Error("Other agency should not be able to use agency template")
+	}
+	if tmpl.Language() != "sr-Latn" {
+		t.Errorf("Expected sr-Latn, got %s", tmpl.Language())
+	}
+
+	national := newTestTemplate(t)
+	if !national.CanUse(types.NewID()) {
+		t.Error("National template should be usable by any agency")
+	}
+}
+
+func TestRender(t *testing.T) {
+	tmpl := newTestTemplate(t)
+	rev, _ := tmpl.Revision(0)
+
+	out, err := Render(tmpl, rev, newTestRenderData())
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	html := string(out)
+	for _, want := range []string{
+		"DEC-2026-000001",
+		"05.03.2026.",
+		"Центар за социјални рад Кикинда",
+		"CSR-2026-00042",
+		"<li>Љубица Ђорђевић</li>",
+		"Помоћ у кући",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Rendered HTML missing %q", want)
+		}
+	}
+	if strings.Contains(html, "Марко") {
+		t.Error("byRole should filter participants")
+	}
+}
+
+func TestRenderPDFA(t *testing.T) {
+	tmpl := newTestTemplate(t)
+	rev, _ := tmpl.Revision(0)
+
+	body, err := Render(tmpl, rev, newTestRenderData())
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	stamp, err := document.NewVerificationStamp("https://eid.gov.rs", "ABCD-EFGH-IJKL-MNOP", 128)
+	if err != nil {
+		t.Fatalf("NewVerificationStamp failed: %v", err)
+	}
+
+	pdf, err := RenderPDF(body, PDFOptions{
+		Title:        "Решење о помоћи у кући",
+		Author:       "Центар за социјални рад Кикинда",
+		Language:     tmpl.Language(),
+		Verification: stamp,
+	})
+	if err != nil {
+		t.Fatalf("RenderPDF failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"%PDF-1.7",
+		"<pdfaid:part>2</pdfaid:part>",
+		"<pdfaid:conformance>B</pdfaid:conformance>",
+		"/OutputIntents",
+		"/GTS_PDFA1",
+		"/Lang (sr-Cyrl)",
+		"/ID [<",
+		"/FontFile2",
+	} {
+		if !bytes.Contains(pdf, []byte(want)) {
+			t.Errorf("PDF missing %q", want)
+		}
+	}
+
+	// Standard (non-embedded) fonts are not allowed in PDF/A
+	if bytes.Contains(pdf, []byte("/Helvetica")) {
+		t.Error("PDF should not reference standard fonts")
+	}
+
+	// The rewritten cross-reference table must point at every object
+	offsets, err := parseXref(pdf)
+	if err != nil {
+		t.Fatalf("parseXref failed: %v", err)
+	}
+	for i := 1; i < len(offsets); i++ {
+		if !bytes.HasPrefix(pdf[offsets[i]:], []byte(fmt.Sprintf("%d 0 obj", i))) {
+			t.Errorf("xref entry %d does not point at object %d", i, i)
+		}
+	}
+}
+
+func TestSRGBProfile(t *testing.T) {
+	profile := SRGBProfile()
+
+	size := int(profile[0])<<24 | int(profile[1])<<16 | int(profile[2])<<8 | int(profile[3])
+	if size != len(profile) {
+		t.Errorf("Profile size %d does not match length %d", size, len(profile))
+	}
+	if string(profile[36:40]) != "acsp" {
+		t.Error("Profile missing acsp signature")
+	}
+	if string(profile[12:16]) != "mntr" || string(profile[16:20]) != "RGB " {
+		t.Error("Expected RGB display profile")
+	}
+}
+
+func TestPDFTextString(t *testing.T) {
+	if got := pdfTextString("Report (draft)"); got != `(Report \(draft\))` {
+		t.Errorf("Unexpected literal string: %s", got)
+	}
+	if got := pdfTextString("Ђ"); got != "<FEFF0402>" {
+		t.Errorf("Unexpected UTF-16 string: %s", got)
+	}
+}
+
+func TestVerificationCodeKeepsSuppliedCode(t *testing.T) {
+	doc := &document.Document{VerificationCode: "ABCD-EFGH-JKMN-PQRS"}
+	code, err := verificationCode(doc)
+	if err != nil {
+		t.Fatalf("verificationCode failed: %v", err)
+	}
+	if code != doc.VerificationCode {
+		t.Errorf("Expected supplied code %s to be kept, got %s", doc.VerificationCode, code)
+	}
+
+	code, err = verificationCode(&document.Document{})
+	if err != nil {
+		t.Fatalf("verificationCode failed: %v", err)
+	}
+	if code == "" || code != document.NormalizeVerificationCode(code) {
+		t.Errorf("Expected a generated verification code, got %q", code)
+	}
+}
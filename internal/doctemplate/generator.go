@@ -0,0 +1,259 @@
+package doctemplate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/serbia-gov/platform/internal/agency"
+	"github.com/serbia-gov/platform/internal/case/domain"
+	"github.com/serbia-gov/platform/internal/document"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/events"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+const qrPixels = 256
+
+// AgencyDirectory resolves the agency issuing a generated document
+type AgencyDirectory interface {
+	GetAgency(ctx context.Context, id types.ID) (*agency.Agency, error)
+}
+
+// Generator produces PDF/A documents from templates and stores them as document versions
+type Generator struct {
+	templates *Repository
+	documents *document.Repository
+	cases     domain.Repository
+	agencies  AgencyDirectory
+	store     document.ContentStore
+	bus       events.EventBus
+	publicURL string // Base URL encoded in verification QR codes
+}
+
+// NewGenerator creates a new document generator
+func NewGenerator(
+	templates *Repository,
+	documents *document.Repository,
+	cases domain.Repository,
+	agencies AgencyDirectory,
+	store document.ContentStore,
+	bus events.EventBus,
+	publicURL string,
+) *Generator {
+	return &Generator{
+		templates: templates,
+		documents: documents,
+		cases:     cases,
+		agencies:  agencies,
+		store:     store,
+		bus:       bus,
+		publicURL: publicURL,
+	}
+}
+
+// Generated is the result of generating a document from a template
+type Generated struct {
+	Document *document.Document        `json:"document"`
+	Version  *document.DocumentVersion `json:"version"`
+}
+
+// Preview renders a template revision to PDF without storing anything
+func (g *Generator) Preview(ctx context.Context, templateID types.ID, req GenerateRequest, agencyID types.ID) ([]byte, error) {
+	t, rev, err := g.loadTemplate(ctx, templateID, req.Revision, agencyID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := g.renderData(ctx, req, agencyID)
+	if err != nil {
+		return nil, err
+	}
+	data.Document = DocumentData{Type: t.DocumentType, Title: titleOrName(req.Title, t), Date: data.GeneratedAt}
+
+	return g.render(t, rev, data)
+}
+
+// Generate fills a template from case data, renders it to PDF/A and adds it
+// as a new version of a new or existing document
+func (g *Generator) Generate(ctx context.Context, templateID types.ID, req GenerateRequest, actorID, agencyID types.ID) (*Generated, error) {
+	t, rev, err := g.loadTemplate(ctx, templateID, req.Revision, agencyID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := g.renderData(ctx, req, agencyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc *document.Document
+	isNew := req.DocumentID == nil
+	if isNew {
+		doc, err = document.NewDocument(t.DocumentType, titleOrName(req.Title, t), t.Description, agencyID, actorID, req.CaseID)
+		if err != nil {
+			return nil, errors.BadRequest(err.Error())
+		}
+	} else {
+		doc, err = g.documents.FindByID(ctx, *req.DocumentID)
+		if err != nil {
+			return nil, err
+		}
+		if doc.OwnerAgencyID != agencyID {
+			return nil, errors.Forbidden("only the owning agency can add versions")
+		}
+	}
+
+	// The verification code is printed on the document, so it is assigned
+	// before rendering and kept when the document is later signed
+	code, err := verificationCode(doc)
+	if err != nil {
+		return nil, errors.Internal(err)
+	}
+	data.Verification, err = document.NewVerificationStamp(g.publicURL, code, qrPixels)
+	if err != nil {
+		return nil, errors.Internal(err)
+	}
+	data.Document = DocumentData{
+		Number: doc.DocumentNumber,
+		Type:   doc.Type,
+		Title:  doc.Title,
+		Date:   data.GeneratedAt,
+	}
+
+	pdf, err := g.render(t, rev, data)
+	if err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("documents/%s/v%d.pdf", doc.ID, doc.CurrentVersion+1)
+	summary := fmt.Sprintf("Generated from template %s revision %d", t.Code, rev.Revision)
+
+	version, err := doc.AddTemplateVersion(path, "application/pdf", pdf, actorID, t.ID, rev.Revision, summary)
+	if err != nil {
+		return nil, errors.BadRequest(err.Error())
+	}
+	doc.VerificationCode = code
+
+	if err := g.store.Put(ctx, path, pdf); err != nil {
+		return nil, errors.Wrap(err, "failed to store generated document")
+	}
+
+	if isNew {
+		err = g.documents.Save(ctx, doc)
+	} else if err = g.documents.AddVersion(ctx, version); err == nil {
+		err = g.documents.Update(ctx, doc)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if g.bus != nil {
+		event := events.NewEvent("document.generated", "document", map[string]any{
+			"document_id":       doc.ID,
+			"document_number":   doc.DocumentNumber,
+			"version":           version.Version,
+			"file_hash":         version.FileHash,
+			"template_id":       t.ID,
+			"template_code":     t.Code,
+			"template_revision": rev.Revision,
+			"case_id":           doc.CaseID,
+		}).WithActor(actorID, "worker", agencyID)
+
+		g.bus.Publish(ctx, event)
+	}
+
+	return &Generated{Document: doc, Version: version}, nil
+}
+
+// verificationCode returns the code registered for public verification of a
+// document, generating one only when the document has none yet, so that the
+// code printed on a new version is the one that verifies it
+func verificationCode(doc *document.Document) (string, error) {
+	if doc.VerificationCode != "" {
+		return doc.VerificationCode, nil
+	}
+	return document.NewVerificationCode()
+}
+
+func (g *Generator) loadTemplate(ctx context.Context, templateID types.ID, revision int, agencyID types.ID) (*Template, *TemplateRevision, error) {
+	t, err := g.templates.FindByID(ctx, templateID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.Status != StatusActive {
+		return nil, nil, errors.BadRequest("template is retired")
+	}
+	if !t.CanUse(agencyID) {
+		return nil, nil, errors.Forbidden("template belongs to another agency")
+	}
+
+	rev, err := t.Revision(revision)
+	if err != nil {
+		return nil, nil, errors.NotFound("template revision", fmt.Sprint(revision))
+	}
+
+	return t, rev, nil
+}
+
+// renderData loads the case and issuing agency for a generation request
+func (g *Generator) renderData(ctx context.Context, req GenerateRequest, agencyID types.ID) (*RenderData, error) {
+	data := &RenderData{
+		Values:      req.Values,
+		GeneratedAt: time.Now(),
+	}
+
+	if req.CaseID != nil {
+		c, err := g.cases.FindByID(ctx, *req.CaseID)
+		if err != nil {
+			return nil, err
+		}
+		if !c.CanAccess(agencyID, domain.AccessLevelContribute) {
+			return nil, errors.Forbidden("no access to case")
+		}
+		data.Case = c
+		data.Participants = c.Participants
+	}
+
+	if g.agencies != nil {
+		a, err := g.agencies.GetAgency(ctx, agencyID)
+		if err != nil {
+			return nil, err
+		}
+		data.Agency = a
+	}
+
+	return data, nil
+}
+
+func (g *Generator) render(t *Template, rev *TemplateRevision, data *RenderData) ([]byte, error) {
+	body, err := Render(t, rev, data)
+	if err != nil {
+		return nil, errors.BadRequest(err.Error())
+	}
+
+	opts := PDFOptions{
+		Title:        data.Document.Title,
+		Subject:      t.Name,
+		Language:     t.Language(),
+		Verification: data.Verification,
+		CreatedAt:    data.GeneratedAt,
+	}
+	if data.Agency != nil {
+		opts.Author = data.Agency.Name
+	}
+
+	pdf, err := RenderPDF(body, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to render PDF")
+	}
+
+	return pdf, nil
+}
+
+func titleOrName(title string, t *Template) string {
+	if title != "" {
+		return title
+	}
+	return t.Name
+}
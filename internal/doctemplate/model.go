@@ -0,0 +1,223 @@
+package doctemplate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"time"
+
+	"github.com/serbia-gov/platform/internal/document"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// Format defines the template source format
+type Format string
+
+const (
+	FormatHTML Format = "html"
+)
+
+// Script defines the Serbian script a template is written in
+type Script string
+
+const (
+	ScriptCyrillic Script = "cyrillic"
+	ScriptLatin    Script = "latin"
+)
+
+// Status defines the status of a template
+type Status string
+
+const (
+	StatusActive  Status = "active"
+	StatusRetired Status = "retired"
+)
+
+// Template is a reusable document layout filled from case, participant and agency data
+type Template struct {
+	ID           types.ID              `json:"id"`
+	Code         string                `json:"code"` // e.g. "CSR-RESENJE-SMESTAJ"
+	Name         string                `json:"name"`
+	Description  string                `json:"description,omitempty"`
+	DocumentType document.DocumentType `json:"document_type"`
+	Format       Format                `json:"format"`
+	Script       Script                `json:"script"`
+
+	// Ownership (nil for national templates usable by every agency)
+	OwnerAgencyID *types.ID `json:"owner_agency_id,omitempty"`
+
+	Status          Status             `json:"status"`
+	CurrentRevision int                `json:"current_revision"`
+	Revisions       []TemplateRevision `json:"revisions,omitempty"`
+
+	CreatedBy types.ID  `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TemplateRevision is an immutable revision of a template body
+type TemplateRevision struct {
+	ID            types.ID  `json:"id"`
+	TemplateID    types.ID  `json:"template_id"`
+	Revision      int       `json:"revision"`
+	Body          string    `json:"body"`
+	BodyHash      string    `json:"body_hash"` // SHA-256
+	ChangeSummary string    `json:"change_summary,omitempty"`
+	CreatedBy     types.ID  `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// NewTemplate creates a new template with its first revision
+func NewTemplate(
+	code, name, description string,
+	docType document.DocumentType,
+	script Script,
+	ownerAgencyID *types.ID,
+	body string,
+	createdBy types.ID,
+) (*Template, error) {
+	if code == "" {
+		return nil, fmt.Errorf("code is required")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if docType == "" {
+		return nil, fmt.Errorf("document type is required")
+	}
+	if script == "" {
+		script = ScriptCyrillic
+	}
+	if script != ScriptCyrillic && script != ScriptLatin {
+		return nil, fmt.Errorf("invalid script: %s", script)
+	}
+
+	now := time.Now()
+	t := &Template{
+		ID:            types.NewID(),
+		Code:          code,
+		Name:          name,
+		Description:   description,
+		DocumentType:  docType,
+		Format:        FormatHTML,
+		Script:        script,
+		OwnerAgencyID: ownerAgencyID,
+		Status:        StatusActive,
+		CreatedBy:     createdBy,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	if _, err := t.AddRevision(body, "Initial revision", createdBy); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// AddRevision validates a new template body and adds it as the current revision
+func (t *Template) AddRevision(body, changeSummary string, createdBy types.ID) (*TemplateRevision, error) {
+	if t.Status == StatusRetired {
+		return nil, fmt.Errorf("cannot revise retired template")
+	}
+	if body == "" {
+		return nil, fmt.Errorf("template body is required")
+	}
+	if _, err := parseBody(t.Code, body); err != nil {
+		return nil, fmt.Errorf("invalid template body: %w", err)
+	}
+
+	hash := sha256.Sum256([]byte(body))
+
+	t.CurrentRevision++
+	revision := TemplateRevision{
+		ID:            types.NewID(),
+		TemplateID:    t.ID,
+		Revision:      t.CurrentRevision,
+		Body:          body,
+		BodyHash:      hex.EncodeToString(hash[:]),
+		ChangeSummary: changeSummary,
+		CreatedBy:     createdBy,
+		CreatedAt:     time.Now(),
+	}
+
+	t.Revisions = append(t.Revisions, revision)
+	t.UpdatedAt = time.Now()
+
+	return &revision, nil
+}
+
+// Revision returns a specific revision, or the current one when revision is 0
+func (t *Template) Revision(revision int) (*TemplateRevision, error) {
+	if revision == 0 {
+		revision = t.CurrentRevision
+	}
+	for i := range t.Revisions {
+		if t.Revisions[i].Revision == revision {
+			return &t.Revisions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("template revision %d not found", revision)
+}
+
+// Retire prevents further use of the template for generation
+func (t *Template) Retire() error {
+	if t.Status == StatusRetired {
+		return fmt.Errorf("template is already retired")
+	}
+	t.Status = StatusRetired
+	t.UpdatedAt = time.Now()
+	return nil
+}
+
+// CanUse checks if an agency may generate documents from the template
+func (t *Template) CanUse(agencyID types.ID) bool {
+	return t.OwnerAgencyID == nil || *t.OwnerAgencyID == agencyID
+}
+
+// Language returns the BCP 47 language tag of documents produced from the template
+func (t *Template) Language() string {
+	if t.Script == ScriptLatin {
+		return "sr-Latn"
+	}
+	return "sr-Cyrl"
+}
+
+// parseBody parses a template body with the rendering functions available
+func parseBody(name, body string) (*htmltemplate.Template, error) {
+	return htmltemplate.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(body)
+}
+
+// --- Request/Response types ---
+
+type CreateTemplateRequest struct {
+	Code         string                `json:"code"`
+	Name         string                `json:"name"`
+	Description  string                `json:"description,omitempty"`
+	DocumentType document.DocumentType `json:"document_type"`
+	Script       Script                `json:"script,omitempty"`
+	National     bool                  `json:"national,omitempty"` // usable by all agencies
+	Body         string                `json:"body"`
+}
+
+type AddRevisionRequest struct {
+	Body          string `json:"body"`
+	ChangeSummary string `json:"change_summary"`
+}
+
+type GenerateRequest struct {
+	CaseID     *types.ID         `json:"case_id,omitempty"`
+	DocumentID *types.ID         `json:"document_id,omitempty"` // add a version to an existing document
+	Title      string            `json:"title,omitempty"`
+	Revision   int               `json:"revision,omitempty"` // defaults to current revision
+	Values     map[string]string `json:"values,omitempty"`   // free-form placeholder values
+}
+
+type ListTemplatesFilter struct {
+	DocumentType  *document.DocumentType `json:"document_type,omitempty"`
+	OwnerAgencyID *types.ID              `json:"owner_agency_id,omitempty"`
+	Status        *Status                `json:"status,omitempty"`
+	Limit         int                    `json:"limit,omitempty"`
+	Offset        int                    `json:"offset,omitempty"`
+}
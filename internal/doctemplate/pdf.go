@@ -0,0 +1,484 @@
+package doctemplate
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/serbia-gov/platform/internal/document"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Only embedded fonts are used: PDF/A forbids relying on the viewer's
+// standard fonts, and DejaVu covers both Serbian scripts.
+//
+//go:embed fonts/*.ttf
+var fontFiles embed.FS
+
+const (
+	fontFamily = "DejaVu"
+
+	pageMargin   = 20.0 // mm
+	footerHeight = 30.0 // mm reserved for the verification stamp
+	qrSize       = 20.0 // mm
+	bodyFontSize = 11.0
+)
+
+// PDFOptions describes the document metadata written to the PDF
+type PDFOptions struct {
+	Title        string
+	Author       string // issuing agency
+	Subject      string
+	Language     string // BCP 47, e.g. "sr-Cyrl"
+	Verification *document.VerificationStamp
+	CreatedAt    time.Time
+}
+
+// RenderPDF lays out rendered template HTML as a PDF/A-2b document.
+//
+// A subset of HTML is supported: h1-h3, p, div, br, hr, ul, ol, li, table,
+// strong and b. Alignment is taken from the align attribute, a text-align
+// style or a left/center/right/justify class.
+func RenderPDF(body []byte, opts PDFOptions) ([]byte, error) {
+	root, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	if opts.CreatedAt.IsZero() {
+		opts.CreatedAt = time.Now()
+	}
+	opts.CreatedAt = opts.CreatedAt.UTC().Truncate(time.Second)
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pageMargin, pageMargin, pageMargin)
+	pdf.SetAutoPageBreak(true, footerHeight)
+	pdf.SetCreationDate(opts.CreatedAt)
+	pdf.SetModificationDate(opts.CreatedAt)
+	pdf.AliasNbPages("{nb}")
+
+	if err := loadFonts(pdf); err != nil {
+		return nil, err
+	}
+
+	if opts.Verification != nil {
+		pdf.RegisterImageOptionsReader("verification-qr",
+			fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(opts.Verification.QRCode))
+	}
+	pdf.SetFooterFunc(func() { writeFooter(pdf, opts) })
+
+	pdf.AddPage()
+	pdf.SetFont(fontFamily, "", bodyFontSize)
+
+	l := &layout{pdf: pdf}
+	if b := findElement(root, atom.Body); b != nil {
+		l.blocks(b)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("failed to write PDF: %w", err)
+	}
+
+	return ConvertToPDFA(buf.Bytes(), PDFAMetadata{
+		Title:     opts.Title,
+		Author:    opts.Author,
+		Subject:   opts.Subject,
+		Language:  opts.Language,
+		Creator:   "Serbia Government Interoperability Platform",
+		CreatedAt: opts.CreatedAt,
+	})
+}
+
+func loadFonts(pdf *fpdf.Fpdf) error {
+	for style, file := range map[string]string{
+		"":  "fonts/DejaVuSansCondensed.ttf",
+		"B": "fonts/DejaVuSansCondensed-Bold.ttf",
+	} {
+		data, err := fontFiles.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to load font: %w", err)
+		}
+		pdf.AddUTF8FontFromBytes(fontFamily, style, data)
+	}
+	if pdf.Err() {
+		return fmt.Errorf("failed to load font: %w", pdf.Error())
+	}
+	return nil
+}
+
+// writeFooter prints the page number and, when present, the verification stamp
+func writeFooter(pdf *fpdf.Fpdf, opts PDFOptions) {
+	pageWidth, pageHeight := pdf.GetPageSize()
+	top := pageHeight - footerHeight + 5
+
+	pdf.SetDrawColor(160, 160, 160)
+	pdf.Line(pageMargin, top-2, pageWidth-pageMargin, top-2)
+	pdf.SetFont(fontFamily, "", 8)
+
+	if v := opts.Verification; v != nil {
+		pdf.ImageOptions("verification-qr", pageMargin, top, qrSize, qrSize,
+			false, fpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+
+		label := "Верификациони код"
+		hint := "Аутентичност документа проверите на"
+		if opts.Language == "sr-Latn" {
+			label, hint = ToLatin(label), ToLatin(hint)
+		}
+
+		pdf.SetXY(pageMargin+qrSize+3, top+3)
+		pdf.CellFormat(0, 4, label+": "+v.Code, "", 2, "L", false, 0, "")
+		pdf.SetX(pageMargin + qrSize + 3)
+		pdf.CellFormat(0, 4, hint+" "+v.URL, "", 0, "L", false, 0, "")
+	}
+
+	pdf.SetXY(pageMargin, pageHeight-pageMargin+5)
+	pdf.CellFormat(0, 4, strconv.Itoa(pdf.PageNo())+" / {nb}", "", 0, "R", false, 0, "")
+}
+
+// run is a piece of inline text with a single style
+type run struct {
+	text string
+	bold bool
+}
+
+// layout writes HTML block elements to the PDF
+type layout struct {
+	pdf *fpdf.Fpdf
+}
+
+func (l *layout) blocks(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		l.block(c)
+	}
+}
+
+func (l *layout) block(n *html.Node) {
+	if n.Type == html.TextNode {
+		if strings.TrimSpace(n.Data) != "" {
+			l.paragraph([]run{{text: collapseSpace(n.Data)}}, "L", bodyFontSize)
+		}
+		return
+	}
+	if n.Type != html.ElementNode {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.H1:
+		l.paragraph(inlineRuns(n, true), alignOf(n, "C"), 16)
+		l.pdf.Ln(3)
+	case atom.H2:
+		l.paragraph(inlineRuns(n, true), alignOf(n, "L"), 13)
+		l.pdf.Ln(2)
+	case atom.H3:
+		l.paragraph(inlineRuns(n, true), alignOf(n, "L"), 11.5)
+		l.pdf.Ln(1)
+	case atom.P:
+		l.paragraph(inlineRuns(n, false), alignOf(n, "J"), bodyFontSize)
+		l.pdf.Ln(2)
+	case atom.Div, atom.Section, atom.Header, atom.Footer:
+		if hasBlockChildren(n) {
+			l.blocks(n)
+			return
+		}
+		l.paragraph(inlineRuns(n, false), alignOf(n, "L"), bodyFontSize)
+	case atom.Ul, atom.Ol:
+		l.list(n, n.DataAtom == atom.Ol)
+		l.pdf.Ln(2)
+	case atom.Table:
+		l.table(n)
+		l.pdf.Ln(3)
+	case atom.Hr:
+		left, _, right, _ := l.pdf.GetMargins()
+		width, _ := l.pdf.GetPageSize()
+		y := l.pdf.GetY() + 2
+		l.pdf.SetDrawColor(0, 0, 0)
+		l.pdf.Line(left, y, width-right, y)
+		l.pdf.Ln(4)
+	case atom.Br:
+		l.pdf.Ln(lineHeight(bodyFontSize))
+	case atom.Head, atom.Style, atom.Script:
+		// Not rendered
+	default:
+		l.paragraph(inlineRuns(n, false), alignOf(n, "L"), bodyFontSize)
+	}
+}
+
+// paragraph writes inline runs, wrapping at the right margin
+func (l *layout) paragraph(runs []run, align string, size float64) {
+	if len(runs) == 0 {
+		return
+	}
+	lh := lineHeight(size)
+
+	// Single-style text can use MultiCell, which supports every alignment;
+	// mixed bold and regular text flows left-aligned with Write
+	if uniform(runs) {
+		l.setFont(runs[0].bold, size)
+		var text strings.Builder
+		for _, r := range runs {
+			text.WriteString(r.text)
+		}
+		l.pdf.MultiCell(0, lh, text.String(), "", align, false)
+		return
+	}
+
+	for _, r := range runs {
+		l.setFont(r.bold, size)
+		l.pdf.Write(lh, r.text)
+	}
+	l.pdf.Ln(lh)
+}
+
+func (l *layout) list(n *html.Node, ordered bool) {
+	left, _, _, _ := l.pdf.GetMargins()
+	lh := lineHeight(bodyFontSize)
+	item := 0
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.DataAtom != atom.Li {
+			continue
+		}
+		item++
+
+		marker := "•"
+		if ordered {
+			marker = strconv.Itoa(item) + "."
+		}
+
+		l.setFont(false, bodyFontSize)
+		l.pdf.SetX(left)
+		l.pdf.CellFormat(6, lh, marker, "", 0, "R", false, 0, "")
+
+		// Indent wrapped lines under the item text
+		l.pdf.SetLeftMargin(left + 8)
+		l.pdf.SetX(left + 8)
+		l.paragraph(inlineRuns(c, false), "L", bodyFontSize)
+		l.pdf.SetLeftMargin(left)
+	}
+}
+
+func (l *layout) table(n *html.Node) {
+	var rows [][]*html.Node
+	walkElements(n, atom.Tr, func(tr *html.Node) {
+		var cells []*html.Node
+		for c := tr.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && (c.DataAtom == atom.Td || c.DataAtom == atom.Th) {
+				cells = append(cells, c)
+			}
+		}
+		if len(cells) > 0 {
+			rows = append(rows, cells)
+		}
+	})
+
+	columns := 0
+	for _, cells := range rows {
+		columns = max(columns, len(cells))
+	}
+	if columns == 0 {
+		return
+	}
+
+	left, _, right, _ := l.pdf.GetMargins()
+	pageWidth, pageHeight := l.pdf.GetPageSize()
+	colWidth := (pageWidth - left - right) / float64(columns)
+	lh := lineHeight(10)
+	l.pdf.SetDrawColor(0, 0, 0)
+
+	for _, cells := range rows {
+		// Row height is set by the cell with the most wrapped lines
+		lines := 1
+		for _, c := range cells {
+			l.setFont(c.DataAtom == atom.Th, 10)
+			lines = max(lines, len(l.pdf.SplitText(cellText(c), colWidth-2)))
+		}
+		height := float64(lines)*lh + 2
+
+		y := l.pdf.GetY()
+		if y+height > pageHeight-footerHeight {
+			l.pdf.AddPage()
+			y = l.pdf.GetY()
+		}
+
+		for i, c := range cells {
+			x := left + float64(i)*colWidth
+			l.pdf.Rect(x, y, colWidth, height, "D")
+			l.pdf.SetXY(x+1, y+1)
+			l.setFont(c.DataAtom == atom.Th, 10)
+			l.pdf.MultiCell(colWidth-2, lh, cellText(c), "", alignOf(c, "L"), false)
+		}
+
+		l.pdf.SetXY(left, y+height)
+	}
+}
+
+func (l *layout) setFont(bold bool, size float64) {
+	style := ""
+	if bold {
+		style = "B"
+	}
+	l.pdf.SetFont(fontFamily, style, size)
+}
+
+func lineHeight(size float64) float64 {
+	return size * 0.5
+}
+
+// inlineRuns flattens the inline content of an element into styled runs
+func inlineRuns(n *html.Node, bold bool) []run {
+	var runs []run
+
+	var walk func(n *html.Node, bold bool)
+	walk = func(n *html.Node, bold bool) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch {
+			case c.Type == html.TextNode:
+				runs = append(runs, run{text: collapseSpace(c.Data), bold: bold})
+			case c.Type != html.ElementNode:
+			case c.DataAtom == atom.Br:
+				runs = append(runs, run{text: "\n", bold: bold})
+			case c.DataAtom == atom.Strong || c.DataAtom == atom.B:
+				walk(c, true)
+			default:
+				walk(c, bold)
+			}
+		}
+	}
+	walk(n, bold)
+
+	// Trim whitespace at the paragraph edges and around line breaks
+	for i := range runs {
+		if i == 0 || runs[i-1].text == "\n" {
+			runs[i].text = strings.TrimLeft(runs[i].text, " ")
+		}
+		if i == len(runs)-1 || runs[i+1].text == "\n" {
+			runs[i].text = strings.TrimRight(runs[i].text, " ")
+		}
+	}
+
+	out := runs[:0]
+	for _, r := range runs {
+		if r.text == "" {
+			continue
+		}
+		// Merge adjacent runs of the same style
+		if len(out) > 0 && out[len(out)-1].bold == r.bold {
+			out[len(out)-1].text += r.text
+			continue
+		}
+		out = append(out, r)
+	}
+
+	return out
+}
+
+func cellText(n *html.Node) string {
+	var b strings.Builder
+	for _, r := range inlineRuns(n, false) {
+		b.WriteString(r.text)
+	}
+	return b.String()
+}
+
+func uniform(runs []run) bool {
+	for _, r := range runs[1:] {
+		if r.bold != runs[0].bold {
+			return false
+		}
+	}
+	return true
+}
+
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// alignOf returns the fpdf alignment (L, C, R, J) requested by an element
+func alignOf(n *html.Node, fallback string) string {
+	values := map[string]string{"left": "L", "center": "C", "right": "R", "justify": "J"}
+
+	for _, a := range n.Attr {
+		switch a.Key {
+		case "align":
+			if v, ok := values[strings.ToLower(a.Val)]; ok {
+				return v
+			}
+		case "style":
+			for _, decl := range strings.Split(a.Val, ";") {
+				prop, val, ok := strings.Cut(decl, ":")
+				if ok && strings.TrimSpace(prop) == "text-align" {
+					if v, ok := values[strings.ToLower(strings.TrimSpace(val))]; ok {
+						return v
+					}
+				}
+			}
+		case "class":
+			for _, class := range strings.Fields(a.Val) {
+				if v, ok := values[class]; ok {
+					return v
+				}
+			}
+		}
+	}
+
+	return fallback
+}
+
+func hasBlockChildren(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.DataAtom {
+		case atom.P, atom.Div, atom.H1, atom.H2, atom.H3, atom.Ul, atom.Ol,
+			atom.Table, atom.Hr, atom.Section, atom.Header, atom.Footer:
+			return true
+		}
+	}
+	return false
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func walkElements(n *html.Node, a atom.Atom, fn func(*html.Node)) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		if c.DataAtom == a {
+			fn(c)
+			continue
+		}
+		walkElements(c, a, fn)
+	}
+}
@@ -0,0 +1,319 @@
+package doctemplate
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// PDFAMetadata is the document information written to both the Info
+// dictionary and the XMP packet; PDF/A requires the two to agree.
+type PDFAMetadata struct {
+	Title     string
+	Author    string
+	Subject   string
+	Language  string
+	Creator   string
+	CreatedAt time.Time
+}
+
+const pdfaProducer = "fpdf"
+
+var (
+	startXrefPattern = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	xrefEntryPattern = regexp.MustCompile(`^(\d{10}) (\d{5}) ([nf])`)
+)
+
+// ConvertToPDFA rewrites a PDF produced by fpdf so that it conforms to
+// PDF/A-2b. fpdf always writes the Info and Catalog dictionaries as the last
+// two objects, so they are cut off and replaced by an Info dictionary
+// matching the XMP metadata and a Catalog that references the metadata
+// stream and an sRGB output intent. A binary marker comment is added after
+// the header and a single cross-reference table with a document ID is written.
+func ConvertToPDFA(raw []byte, meta PDFAMetadata) ([]byte, error) {
+	offsets, err := parseXref(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// Objects 1..n; the last two are Info (n-1) and Catalog (n)
+	n := len(offsets) - 1
+	if n < 3 {
+		return nil, fmt.Errorf("unexpected PDF structure")
+	}
+	infoObj, catalogObj := n-1, n
+
+	header := bytes.IndexByte(raw, '\n')
+	if header < 0 || !bytes.HasPrefix(raw, []byte("%PDF-1.")) {
+		return nil, fmt.Errorf("missing PDF header")
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.7\n")
+	out.WriteString("%\xE2\xE3\xCF\xD3\n")
+	shift := out.Len() - (header + 1)
+	out.Write(raw[header+1 : offsets[infoObj]])
+
+	for i := 1; i < infoObj; i++ {
+		offsets[i] += shift
+	}
+
+	created := meta.CreatedAt.UTC()
+	if created.IsZero() {
+		created = time.Now().UTC()
+	}
+	if meta.Language == "" {
+		meta.Language = "sr-Cyrl"
+	}
+
+	metadataObj := n + 1
+	iccObj := n + 2
+	intentObj := n + 3
+	size := intentObj + 1
+	offsets = append(offsets, 0, 0, 0)
+
+	writeObject := func(num int, body string) {
+		offsets[num] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", num, body)
+	}
+	writeStream := func(num int, dict string, data []byte) {
+		offsets[num] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n<< %s /Length %d >>\nstream\n", num, dict, len(data))
+		out.Write(data)
+		out.WriteString("\nendstream\nendobj\n")
+	}
+
+	pdfDate := pdfDateString(created)
+	info := []string{
+		"/Producer " + pdfTextString(pdfaProducer),
+		"/CreationDate " + pdfTextString(pdfDate),
+		"/ModDate " + pdfTextString(pdfDate),
+	}
+	if meta.Title != "" {
+		info = append(info, "/Title "+pdfTextString(meta.Title))
+	}
+	if meta.Author != "" {
+		info = append(info, "/Author "+pdfTextString(meta.Author))
+	}
+	if meta.Subject != "" {
+		info = append(info, "/Subject "+pdfTextString(meta.Subject))
+	}
+	if meta.Creator != "" {
+		info = append(info, "/Creator "+pdfTextString(meta.Creator))
+	}
+	writeObject(infoObj, "<< "+strings.Join(info, " ")+" >>")
+
+	writeObject(catalogObj, fmt.Sprintf(
+		"<< /Type /Catalog /Pages 1 0 R /Lang %s /Metadata %d 0 R /OutputIntents [%d 0 R] "+
+			"/ViewerPreferences << /DisplayDocTitle true >> >>",
+		pdfTextString(meta.Language), metadataObj, intentObj))
+
+	// The metadata stream must stay uncompressed so it is readable without a PDF parser
+	writeStream(metadataObj, "/Type /Metadata /Subtype /XML", xmpPacket(meta, created))
+	writeStream(iccObj, "/N 3", SRGBProfile())
+	writeObject(intentObj, fmt.Sprintf(
+		"<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (sRGB IEC61966-2.1) "+
+			"/Info (sRGB IEC61966-2.1) /DestOutputProfile %d 0 R >>", iccObj))
+
+	// Cross-reference table and trailer
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", size)
+	for i := 1; i < size; i++ {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offsets[i])
+	}
+
+	id := md5.Sum(append(raw, []byte(pdfDate)...))
+	docID := hex.EncodeToString(id[:])
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R /ID [<%s> <%s>] >>\nstartxref\n%d\n%%%%EOF\n",
+		size, catalogObj, infoObj, docID, docID, xref)
+
+	return out.Bytes(), nil
+}
+
+// parseXref reads the object offsets from the cross-reference table of an
+// fpdf document (a single table, no object streams). Index 0 is unused.
+func parseXref(raw []byte) ([]int, error) {
+	m := startXrefPattern.FindSubmatch(raw)
+	if m == nil {
+		return nil, fmt.Errorf("missing startxref")
+	}
+	start, err := strconv.Atoi(string(m[1]))
+	if err != nil || start >= len(raw) {
+		return nil, fmt.Errorf("invalid startxref")
+	}
+
+	lines := strings.Split(string(raw[start:]), "\n")
+	if len(lines) < 3 || strings.TrimSpace(lines[0]) != "xref" {
+		return nil, fmt.Errorf("missing xref table")
+	}
+
+	var first, count int
+	if _, err := fmt.Sscanf(lines[1], "%d %d", &first, &count); err != nil || first != 0 {
+		return nil, fmt.Errorf("unsupported xref section")
+	}
+	if len(lines) < 2+count {
+		return nil, fmt.Errorf("truncated xref table")
+	}
+
+	offsets := make([]int, count)
+	for i := 1; i < count; i++ {
+		e := xrefEntryPattern.FindStringSubmatch(lines[2+i])
+		if e == nil || e[3] != "n" {
+			return nil, fmt.Errorf("invalid xref entry %d", i)
+		}
+		offsets[i], _ = strconv.Atoi(e[1])
+	}
+
+	return offsets, nil
+}
+
+// xmpPacket builds the XMP metadata identifying the file as PDF/A-2b
+func xmpPacket(meta PDFAMetadata, created time.Time) []byte {
+	esc := func(s string) string {
+		var b bytes.Buffer
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	date := created.Format("2006-01-02T15:04:05Z")
+
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\xEF\xBB\xBF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">` + "\n")
+	b.WriteString(`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + "\n")
+	b.WriteString(`<rdf:Description rdf:about=""` +
+		` xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/"` +
+		` xmlns:dc="http://purl.org/dc/elements/1.1/"` +
+		` xmlns:xmp="http://ns.adobe.com/xap/1.0/"` +
+		` xmlns:pdf="http://ns.adobe.com/pdf/1.3/">` + "\n")
+	b.WriteString("<pdfaid:part>2</pdfaid:part>\n<pdfaid:conformance>B</pdfaid:conformance>\n")
+	if meta.Title != "" {
+		b.WriteString(`<dc:title><rdf:Alt><rdf:li xml:lang="x-default">` + esc(meta.Title) + "</rdf:li></rdf:Alt></dc:title>\n")
+	}
+	if meta.Author != "" {
+		b.WriteString("<dc:creator><rdf:Seq><rdf:li>" + esc(meta.Author) + "</rdf:li></rdf:Seq></dc:creator>\n")
+	}
+	if meta.Subject != "" {
+		b.WriteString(`<dc:description><rdf:Alt><rdf:li xml:lang="x-default">` + esc(meta.Subject) + "</rdf:li></rdf:Alt></dc:description>\n")
+	}
+	b.WriteString("<dc:language><rdf:Bag><rdf:li>" + esc(meta.Language) + "</rdf:li></rdf:Bag></dc:language>\n")
+	b.WriteString("<xmp:CreateDate>" + date + "</xmp:CreateDate>\n")
+	b.WriteString("<xmp:ModifyDate>" + date + "</xmp:ModifyDate>\n")
+	if meta.Creator != "" {
+		b.WriteString("<xmp:CreatorTool>" + esc(meta.Creator) + "</xmp:CreatorTool>\n")
+	}
+	b.WriteString("<pdf:Producer>" + esc(pdfaProducer) + "</pdf:Producer>\n")
+	b.WriteString("</rdf:Description>\n</rdf:RDF>\n</x:xmpmeta>\n")
+	b.WriteString(`<?xpacket end="w"?>`)
+
+	return []byte(b.String())
+}
+
+func pdfDateString(t time.Time) string {
+	return "D:" + t.UTC().Format("20060102150405") + "Z"
+}
+
+// pdfTextString encodes a PDF text string: a literal for ASCII, otherwise
+// UTF-16BE with a byte order mark as required for non-Latin-1 text
+func pdfTextString(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r > 0x7E || r < 0x20 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s) + ")"
+	}
+
+	units := utf16.Encode([]rune(s))
+	buf := make([]byte, 2+2*len(units))
+	buf[0], buf[1] = 0xFE, 0xFF
+	for i, u := range units {
+		binary.BigEndian.PutUint16(buf[2+2*i:], u)
+	}
+	return "<" + strings.ToUpper(hex.EncodeToString(buf)) + ">"
+}
+
+// SRGBProfile returns a minimal ICC v2 display profile for sRGB, used as the
+// PDF/A output intent. It carries the D50-adapted sRGB primaries and a 2.2
+// gamma curve, which is sufficient for documents that only use DeviceRGB
+// and DeviceGray text and graphics.
+func SRGBProfile() []byte {
+	s15 := func(v float64) []byte {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(int32(v*65536+0.5)))
+		return b
+	}
+	xyz := func(x, y, z float64) []byte {
+		b := []byte("XYZ \x00\x00\x00\x00")
+		b = append(b, s15(x)...)
+		b = append(b, s15(y)...)
+		return append(b, s15(z)...)
+	}
+
+	description := "sRGB IEC61966-2.1"
+	desc := []byte("desc\x00\x00\x00\x00")
+	desc = binary.BigEndian.AppendUint32(desc, uint32(len(description)+1))
+	desc = append(desc, description...)
+	desc = append(desc, 0)
+	desc = append(desc, make([]byte, 4+4+2+1+67)...) // empty Unicode and ScriptCode descriptions
+
+	cprt := append([]byte("text\x00\x00\x00\x00"), "No copyright, use freely\x00"...)
+	curve := []byte("curv\x00\x00\x00\x00\x00\x00\x00\x01\x02\x33\x00\x00") // gamma 2.2 (u8Fixed8)
+
+	type tag struct {
+		sig  string
+		data []byte
+	}
+	tags := []tag{
+		{"desc", desc},
+		{"cprt", cprt},
+		{"wtpt", xyz(0.9642, 1.0, 0.8249)},
+		{"rXYZ", xyz(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", xyz(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", xyz(0.1431, 0.0606, 0.7141)},
+		{"rTRC", curve},
+		{"gTRC", curve},
+		{"bTRC", curve},
+	}
+
+	// Header (128 bytes) + tag count + tag table
+	offset := 128 + 4 + 12*len(tags)
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	var data []byte
+	for _, t := range tags {
+		for len(t.data)%4 != 0 {
+			t.data = append(t.data, 0)
+		}
+		table = append(table, t.sig...)
+		table = binary.BigEndian.AppendUint32(table, uint32(offset+len(data)))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(t.data)))
+		data = append(data, t.data...)
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[0:], uint32(offset+len(data)))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000) // version 2.1
+	copy(header[12:], "mntr")
+	copy(header[16:], "RGB ")
+	copy(header[20:], "XYZ ")
+	for i, v := range []uint16{2000, 1, 1, 0, 0, 0} {
+		binary.BigEndian.PutUint16(header[24+2*i:], v)
+	}
+	copy(header[36:], "acsp")
+	copy(header[68:], s15(0.9642))
+	copy(header[72:], s15(1.0))
+	copy(header[76:], s15(0.8249))
+
+	profile := append(header, table...)
+	return append(profile, data...)
+}
@@ -0,0 +1,80 @@
+package doctemplate
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	"time"
+
+	"github.com/serbia-gov/platform/internal/agency"
+	"github.com/serbia-gov/platform/internal/case/domain"
+	"github.com/serbia-gov/platform/internal/document"
+)
+
+// RenderData is the data available to template placeholders
+type RenderData struct {
+	Document     DocumentData                `json:"document"`
+	Case         *domain.Case                `json:"case,omitempty"`
+	Participants []domain.Participant        `json:"participants,omitempty"`
+	Agency       *agency.Agency              `json:"agency,omitempty"`
+	Values       map[string]string           `json:"values,omitempty"`
+	Verification *document.VerificationStamp `json:"verification,omitempty"`
+	GeneratedAt  time.Time                   `json:"generated_at"`
+}
+
+// DocumentData describes the document being produced
+type DocumentData struct {
+	Number string                `json:"number"`
+	Type   document.DocumentType `json:"type"`
+	Title  string                `json:"title"`
+	Date   time.Time             `json:"date"`
+}
+
+// templateFuncs are the helper functions available in template bodies
+var templateFuncs = htmltemplate.FuncMap{
+	"cyr":   ToCyrillic,
+	"lat":   ToLatin,
+	"upper": strings.ToUpper,
+	"date": func(t any) string {
+		switch v := t.(type) {
+		case time.Time:
+			return v.Format("02.01.2006.")
+		case *time.Time:
+			if v == nil {
+				return ""
+			}
+			return v.Format("02.01.2006.")
+		default:
+			return ""
+		}
+	},
+	"byRole": func(participants []domain.Participant, role string) []domain.Participant {
+		var out []domain.Participant
+		for _, p := range participants {
+			if string(p.Role) == role {
+				out = append(out, p)
+			}
+		}
+		return out
+	},
+}
+
+// Render fills a template revision with data and returns the resulting HTML
+func Render(t *Template, rev *TemplateRevision, data *RenderData) ([]byte, error) {
+	tmpl, err := parseBody(t.Code, rev.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template body: %w", err)
+	}
+
+	if data.Case != nil && data.Participants == nil {
+		data.Participants = data.Case.Participants
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
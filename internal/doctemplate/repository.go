@@ -0,0 +1,278 @@
+package doctemplate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// Repository provides database operations for templates
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+// NewRepository creates a new template repository
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+// Save saves a new template with its revisions
+func (r *Repository) Save(ctx context.Context, t *Template) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO documents.templates (
+			id, code, name, description, document_type, format, script,
+			owner_agency_id, status, current_revision, created_by,
+			created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+
+	_, err = tx.Exec(ctx, query,
+		t.ID, t.Code, t.Name, t.Description, t.DocumentType, t.Format, t.Script,
+		t.OwnerAgencyID, t.Status, t.CurrentRevision, t.CreatedBy,
+		t.CreatedAt, t.UpdatedAt,
+	)
+
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return errors.Conflict("template with this code already exists")
+		}
+		return errors.Wrap(err, "failed to save template")
+	}
+
+	for _, rev := range t.Revisions {
+		if err := r.saveRevision(ctx, tx, &rev); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return nil
+}
+
+// FindByID finds a template by ID including all revisions
+func (r *Repository) FindByID(ctx context.Context, id types.ID) (*Template, error) {
+	query := `
+		SELECT id, code, name, COALESCE(description, ''), document_type, format, script,
+			owner_agency_id, status, current_revision, created_by,
+			created_at, updated_at
+		FROM documents.templates
+		WHERE id = $1`
+
+	t := &Template{}
+	err := r.pool.QueryRow(ctx, query, id).Scan(
+		&t.ID, &t.Code, &t.Name, &t.Description, &t.DocumentType, &t.Format, &t.Script,
+		&t.OwnerAgencyID, &t.Status, &t.CurrentRevision, &t.CreatedBy,
+		&t.CreatedAt, &t.UpdatedAt,
+	)
+
+	if err == pgx.ErrNoRows {
+		return nil, errors.NotFound("template", id.String())
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find template")
+	}
+
+	revisions, err := r.getRevisions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	t.Revisions = revisions
+
+	return t, nil
+}
+
+// Update updates template metadata
+func (r *Repository) Update(ctx context.Context, t *Template) error {
+	query := `
+		UPDATE documents.templates SET
+			name = $2, description = $3, status = $4,
+			current_revision = $5, updated_at = $6
+		WHERE id = $1`
+
+	result, err := r.pool.Exec(ctx, query,
+		t.ID, t.Name, t.Description, t.Status,
+		t.CurrentRevision, t.UpdatedAt,
+	)
+
+	if err != nil {
+		return errors.Wrap(err, "failed to update template")
+	}
+
+	if result.RowsAffected() == 0 {
+		return errors.NotFound("template", t.ID.String())
+	}
+
+	return nil
+}
+
+// AddRevision stores a new revision and advances the template's current revision
+func (r *Repository) AddRevision(ctx context.Context, t *Template, rev *TemplateRevision) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	if err := r.saveRevision(ctx, tx, rev); err != nil {
+		return err
+	}
+
+	// Guard against concurrent revisions taking the same number
+	result, err := tx.Exec(ctx, `
+		UPDATE documents.templates SET current_revision = $2, updated_at = $3
+		WHERE id = $1 AND current_revision = $4`,
+		t.ID, rev.Revision, t.UpdatedAt, rev.Revision-1,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to update template revision")
+	}
+	if result.RowsAffected() == 0 {
+		return errors.Conflict("template was revised concurrently")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return nil
+}
+
+// List lists templates with filtering (revision bodies are not loaded)
+func (r *Repository) List(ctx context.Context, filter ListTemplatesFilter) ([]Template, int, error) {
+	var conditions []string
+	var args []interface{}
+	argNum := 1
+
+	if filter.DocumentType != nil {
+		conditions = append(conditions, fmt.Sprintf("document_type = $%d", argNum))
+		args = append(args, *filter.DocumentType)
+		argNum++
+	}
+
+	if filter.Status != nil {
+		conditions = append(conditions, fmt.Sprintf("status = $%d", argNum))
+		args = append(args, *filter.Status)
+		argNum++
+	}
+
+	// Agencies see national templates and their own
+	if filter.OwnerAgencyID != nil {
+		conditions = append(conditions, fmt.Sprintf("(owner_agency_id IS NULL OR owner_agency_id = $%d)", argNum))
+		args = append(args, *filter.OwnerAgencyID)
+		argNum++
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM documents.templates %s", whereClause)
+	var total int
+	if err := r.pool.QueryRow(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count templates")
+	}
+
+	limit := 50
+	if filter.Limit > 0 && filter.Limit <= 100 {
+		limit = filter.Limit
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, code, name, COALESCE(description, ''), document_type, format, script,
+			owner_agency_id, status, current_revision, created_by,
+			created_at, updated_at
+		FROM documents.templates
+		%s
+		ORDER BY code
+		LIMIT $%d OFFSET $%d`, whereClause, argNum, argNum+1)
+
+	args = append(args, limit, filter.Offset)
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to list templates")
+	}
+	defer rows.Close()
+
+	var templates []Template
+	for rows.Next() {
+		var t Template
+		err := rows.Scan(
+			&t.ID, &t.Code, &t.Name, &t.Description, &t.DocumentType, &t.Format, &t.Script,
+			&t.OwnerAgencyID, &t.Status, &t.CurrentRevision, &t.CreatedBy,
+			&t.CreatedAt, &t.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to scan template")
+		}
+		templates = append(templates, t)
+	}
+
+	return templates, total, nil
+}
+
+func (r *Repository) saveRevision(ctx context.Context, tx pgx.Tx, rev *TemplateRevision) error {
+	query := `
+		INSERT INTO documents.template_revisions (
+			id, template_id, revision, body, body_hash,
+			change_summary, created_by, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err := tx.Exec(ctx, query,
+		rev.ID, rev.TemplateID, rev.Revision, rev.Body, rev.BodyHash,
+		rev.ChangeSummary, rev.CreatedBy, rev.CreatedAt,
+	)
+
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return errors.Conflict("template revision already exists")
+		}
+		return errors.Wrap(err, "failed to save template revision")
+	}
+
+	return nil
+}
+
+func (r *Repository) getRevisions(ctx context.Context, templateID types.ID) ([]TemplateRevision, error) {
+	query := `
+		SELECT id, template_id, revision, body, body_hash,
+			COALESCE(change_summary, ''), created_by, created_at
+		FROM documents.template_revisions
+		WHERE template_id = $1
+		ORDER BY revision`
+
+	rows, err := r.pool.Query(ctx, query, templateID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get template revisions")
+	}
+	defer rows.Close()
+
+	var revisions []TemplateRevision
+	for rows.Next() {
+		var rev TemplateRevision
+		err := rows.Scan(
+			&rev.ID, &rev.TemplateID, &rev.Revision, &rev.Body, &rev.BodyHash,
+			&rev.ChangeSummary, &rev.CreatedBy, &rev.CreatedAt,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan template revision")
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, nil
+}
@@ -0,0 +1,83 @@
+package doctemplate
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Serbian Cyrillic and Latin alphabets map one-to-one, except that the
+// Latin digraphs lj, nj and dž each stand for a single Cyrillic letter.
+
+var latinDigraphs = map[string]rune{
+	"lj": 'љ', "Lj": 'Љ', "LJ": 'Љ',
+	"nj": 'њ', "Nj": 'Њ', "NJ": 'Њ',
+	"dž": 'џ', "Dž": 'Џ', "DŽ": 'Џ',
+}
+
+var latinToCyrillic = map[rune]rune{
+	'a': 'а', 'b': 'б', 'c': 'ц', 'č': 'ч', 'ć': 'ћ', 'd': 'д', 'đ': 'ђ',
+	'e': 'е', 'f': 'ф', 'g': 'г', 'h': 'х', 'i': 'и', 'j': 'ј', 'k': 'к',
+	'l': 'л', 'm': 'м', 'n': 'н', 'o': 'о', 'p': 'п', 'r': 'р', 's': 'с',
+	'š': 'ш', 't': 'т', 'u': 'у', 'v': 'в', 'z': 'з', 'ž': 'ж',
+	'A': 'А', 'B': 'Б', 'C': 'Ц', 'Č': 'Ч', 'Ć': 'Ћ', 'D': 'Д', 'Đ': 'Ђ',
+	'E': 'Е', 'F': 'Ф', 'G': 'Г', 'H': 'Х', 'I': 'И', 'J': 'Ј', 'K': 'К',
+	'L': 'Л', 'M': 'М', 'N': 'Н', 'O': 'О', 'P': 'П', 'R': 'Р', 'S': 'С',
+	'Š': 'Ш', 'T': 'Т', 'U': 'У', 'V': 'В', 'Z': 'З', 'Ž': 'Ж',
+}
+
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'ђ': "đ", 'е': "e",
+	'ж': "ž", 'з': "z", 'и': "i", 'ј': "j", 'к': "k", 'л': "l", 'љ': "lj",
+	'м': "m", 'н': "n", 'њ': "nj", 'о': "o", 'п': "p", 'р': "r", 'с': "s",
+	'т': "t", 'ћ': "ć", 'у': "u", 'ф': "f", 'х': "h", 'ц': "c", 'ч': "č",
+	'џ': "dž", 'ш': "š",
+	'А': "A", 'Б': "B", 'В': "V", 'Г': "G", 'Д': "D", 'Ђ': "Đ", 'Е': "E",
+	'Ж': "Ž", 'З': "Z", 'И': "I", 'Ј': "J", 'К': "K", 'Л': "L", 'Љ': "Lj",
+	'М': "M", 'Н': "N", 'Њ': "Nj", 'О': "O", 'П': "P", 'Р': "R", 'С': "S",
+	'Т': "T", 'Ћ': "Ć", 'У': "U", 'Ф': "F", 'Х': "H", 'Ц': "C", 'Ч': "Č",
+	'Џ': "Dž", 'Ш': "Š",
+}
+
+// ToCyrillic transliterates Serbian Latin text to Cyrillic
+func ToCyrillic(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); i++ {
+		if i+1 < len(runes) {
+			if c, ok := latinDigraphs[string(runes[i:i+2])]; ok {
+				b.WriteRune(c)
+				i++
+				continue
+			}
+		}
+		if c, ok := latinToCyrillic[runes[i]]; ok {
+			b.WriteRune(c)
+			continue
+		}
+		b.WriteRune(runes[i])
+	}
+
+	return b.String()
+}
+
+// ToLatin transliterates Serbian Cyrillic text to Latin
+func ToLatin(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+
+	for i, r := range runes {
+		l, ok := cyrillicToLatin[r]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+		// Digraphs of capital letters inside all-caps words stay all-caps (ЉУБА -> LJUBA)
+		if len(l) > 1 && unicode.IsUpper(r) && i+1 < len(runes) && unicode.IsUpper(runes[i+1]) {
+			l = strings.ToUpper(l)
+		}
+		b.WriteString(l)
+	}
+
+	return b.String()
+}
@@ -1,8 +1,11 @@
 package document
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -14,15 +17,58 @@ import (
 
 // Handler provides HTTP handlers for the document module
 type Handler struct {
-	repo *Repository
-	bus  events.EventBus
+	repo      DocumentRepository
+	bus       events.EventBus
+	exchanger *Exchanger // nil when the federation gateway is not available
+	publicURL string       // Base URL encoded in verification QR codes
+	store     ContentStore // nil when content storage is not configured
+	scanner   PIIScanner   // nil when redaction suggestions are not available
+	access    AccessRecorder // nil when read access is not recorded
+	chains    CertificateVerifier // nil refuses signing
+}
+
+// AccessRecorder records reads of case data for data-subject access reports
+// (implemented by audit.AccessRecorder)
+type AccessRecorder interface {
+	RecordCaseAccess(ctx context.Context, caseID types.ID, resourceType string, resourceID types.ID)
 }
 
 // NewHandler creates a new document handler
-func NewHandler(repo *Repository, bus events.EventBus) *Handler {
+func NewHandler(repo DocumentRepository, bus events.EventBus) *Handler {
 	return &Handler{repo: repo, bus: bus}
 }
 
+// SetPublicURL sets the public base URL used in verification QR codes
+func (h *Handler) SetPublicURL(publicURL string) {
+	h.publicURL = publicURL
+}
+
+// SetContentStore enables downloading version content
+func (h *Handler) SetContentStore(store ContentStore) {
+	h.store = store
+}
+
+// SetPIIScanner enables redaction suggestions
+func (h *Handler) SetPIIScanner(scanner PIIScanner) {
+	h.scanner = scanner
+}
+
+// SetAccessRecorder enables recording of document downloads
+func (h *Handler) SetAccessRecorder(access AccessRecorder) {
+	h.access = access
+}
+
+// SetCertificateVerifier sets what verifies that signing certificates chain
+// to a trusted root; signing is refused until it is set
+func (h *Handler) SetCertificateVerifier(chains CertificateVerifier) {
+	h.chains = chains
+}
+
+// SetExchanger enables cross-agency document exchange
+func (h *Handler) SetExchanger(exchanger *Exchanger) {
+	h.exchanger = exchanger
+}
+
 // Routes registers the document routes
 func (h *Handler) Routes() chi.Router {
 	r := chi.NewRouter()
@@ -42,9 +88,20 @@ func (h *Handler) Routes() chi.Router {
 		r.Post("/share", h.ShareDocument)
 		r.Post("/archive", h.ArchiveDocument)
 		r.Post("/void", h.VoidDocument)
+		r.Post("/exchange", h.ExchangeDocument)
+
+		// Legal hold
+		r.Post("/legal-hold", h.PlaceLegalHold)
+		r.Delete("/legal-hold", h.ReleaseLegalHold)
+
+		// Redaction
+		r.Get("/redactions", h.ListRedactions)
+		r.Post("/redactions", h.CreateRedaction)
 
 		// Versions
 		r.Get("/versions", h.ListVersions)
+		r.Get("/versions/{version}/content", h.GetVersionContent)
+		r.Get("/versions/{version}/redaction-suggestions", h.SuggestRedactions)
 		// POST /versions would handle file upload - simplified here
 
 		// Signatures
@@ -55,6 +112,10 @@ func (h *Handler) Routes() chi.Router {
 
 		// Per-document verify (alternative endpoint)
 		r.Get("/verify", h.VerifyDocument)
+
+		// Public verification stamp (code + QR) for printed copies
+		r.Get("/verification", h.GetVerificationStamp)
+		r.Get("/verification/qr", h.GetVerificationQRCode)
 	})
 
 	return r
@@ -103,21 +164,12 @@ func (h *Handler) GetDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	doc, err := h.repo.FindByID(r.Context(), id)
+	doc, err := h.findAccessible(r, id)
 	if err != nil {
 		writeError(w, err)
 		return
 	}
 
-	// Check access
-	user := auth.GetUser(r.Context())
-	if user != nil && !user.AgencyID.IsZero() {
-		if !doc.CanAccess(user.AgencyID) {
-			writeError(w, errors.Forbidden("no access to this document"))
-			return
-		}
-	}
-
 	writeJSON(w, http.StatusOK, doc)
 }
 
@@ -228,6 +280,17 @@ func (h *Handler) DeleteDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	doc, err := h.repo.FindByID(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := doc.CanDelete(); err != nil {
+		writeError(w, errors.Conflict(err.Error()))
+		return
+	}
+
 	if err := h.repo.Delete(r.Context(), id); err != nil {
 		writeError(w, err)
 		return
@@ -236,6 +299,89 @@ func (h *Handler) DeleteDocument(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// PlaceLegalHold places a document under legal hold
+func (h *Handler) PlaceLegalHold(w http.ResponseWriter, r *http.Request) {
+	doc, ok := h.loadOwned(w, r)
+	if !ok {
+		return
+	}
+
+	var req LegalHoldRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+
+	user := auth.GetUser(r.Context())
+	actorID := types.NewID()
+	if user != nil {
+		actorID = user.ID
+	}
+
+	hold, err := types.NewLegalHold(req.Reason, req.Reference, actorID)
+	if err != nil {
+		writeError(w, errors.BadRequest(err.Error()))
+		return
+	}
+
+	if err := doc.PlaceLegalHold(hold); err != nil {
+		writeError(w, errors.Conflict(err.Error()))
+		return
+	}
+
+	if err := h.repo.Update(r.Context(), doc); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if h.bus != nil {
+		event := events.NewEvent("document.legal_hold_placed", "document", map[string]any{
+			"document_id": doc.ID,
+			"reason":      hold.Reason,
+			"reference":   hold.Reference,
+		}).WithActor(actorID, "worker", doc.OwnerAgencyID)
+		h.bus.Publish(r.Context(), event)
+	}
+
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// ReleaseLegalHold releases the legal hold on a document
+func (h *Handler) ReleaseLegalHold(w http.ResponseWriter, r *http.Request) {
+	doc, ok := h.loadOwned(w, r)
+	if !ok {
+		return
+	}
+
+	hold := doc.LegalHold
+	if err := doc.ReleaseLegalHold(); err != nil {
+		writeError(w, errors.Conflict(err.Error()))
+		return
+	}
+
+	if err := h.repo.Update(r.Context(), doc); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if h.bus != nil {
+		user := auth.GetUser(r.Context())
+		actorID := types.NewID()
+		if user != nil {
+			actorID = user.ID
+		}
+		event := events.NewEvent("document.legal_hold_released", "document", map[string]any{
+			"document_id": doc.ID,
+			"reason":      hold.Reason,
+			"reference":   hold.Reference,
+			"placed_at":   hold.PlacedAt,
+		}).WithActor(actorID, "worker", doc.OwnerAgencyID)
+		h.bus.Publish(r.Context(), event)
+	}
+
+	writeJSON(w, http.StatusOK, doc)
+}
+
 // ShareDocument shares a document with an agency
 func (h *Handler) ShareDocument(w http.ResponseWriter, r *http.Request) {
 	id, err := types.ParseID(chi.URLParam(r, "documentID"))
@@ -363,8 +509,13 @@ func (h *Handler) VoidDocument(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, doc)
 }
 
-// ListVersions lists document versions
-func (h *Handler) ListVersions(w http.ResponseWriter, r *http.Request) {
+// ExchangeDocument sends a document version to another agency over the federation gateway
+func (h *Handler) ExchangeDocument(w http.ResponseWriter, r *http.Request) {
+	if h.exchanger == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "document exchange is not configured"})
+		return
+	}
+
 	id, err := types.ParseID(chi.URLParam(r, "documentID"))
 	if err != nil {
 		writeError(w, errors.BadRequest("invalid document ID"))
@@ -377,21 +528,324 @@ func (h *Handler) ListVersions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var req ExchangeDocumentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+
+	if req.TargetAgency == "" || len(req.Content) == 0 {
+		writeError(w, errors.BadRequest("target_agency and content are required"))
+		return
+	}
+
+	// Check access
+	user := auth.GetUser(r.Context())
+	if user != nil && !user.AgencyID.IsZero() && user.AgencyID != doc.OwnerAgencyID {
+		writeError(w, errors.Forbidden("only the owner agency can exchange this document"))
+		return
+	}
+
+	envelope, err := NewExchangeEnvelope(doc, req.Version, req.Content, h.exchanger.AgencyCode(), req.TargetAgency)
+	if err != nil {
+		writeError(w, errors.BadRequest(err.Error()))
+		return
+	}
+
+	receipt, err := h.exchanger.Send(r.Context(), envelope)
+	if err != nil {
+		writeError(w, errors.Internal(err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, receipt)
+}
+
+// ListVersions lists document versions. Agencies redirected to a redacted
+// copy receive the versions of the copy.
+func (h *Handler) ListVersions(w http.ResponseWriter, r *http.Request) {
+	id, err := types.ParseID(chi.URLParam(r, "documentID"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid document ID"))
+		return
+	}
+
+	doc, err := h.findAccessible(r, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
 	writeJSON(w, http.StatusOK, map[string]any{
 		"data":  doc.Versions,
 		"total": len(doc.Versions),
 	})
 }
 
-// ListSignatures lists document signatures
-func (h *Handler) ListSignatures(w http.ResponseWriter, r *http.Request) {
+// GetVersionContent downloads the content of a document version
+func (h *Handler) GetVersionContent(w http.ResponseWriter, r *http.Request) {
+	if h.store == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "content storage is not configured"})
+		return
+	}
+
 	id, err := types.ParseID(chi.URLParam(r, "documentID"))
 	if err != nil {
 		writeError(w, errors.BadRequest("invalid document ID"))
 		return
 	}
 
+	versionNumber, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid version"))
+		return
+	}
+
+	doc, err := h.findAccessible(r, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Agencies redirected to a redacted copy receive its current version
+	if doc.ID != id {
+		versionNumber = doc.CurrentVersion
+	}
+
+	content, version, err := h.versionContent(r, doc, versionNumber)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if h.access != nil && doc.CaseID != nil {
+		h.access.RecordCaseAccess(r.Context(), *doc.CaseID, "document", doc.ID)
+	}
+
+	w.Header().Set("Content-Type", version.MimeType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
+
+// SuggestRedactions scans a version for personal data and proposes regions to redact
+func (h *Handler) SuggestRedactions(w http.ResponseWriter, r *http.Request) {
+	if h.store == nil || h.scanner == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "redaction is not configured"})
+		return
+	}
+
+	doc, ok := h.loadOwned(w, r)
+	if !ok {
+		return
+	}
+
+	versionNumber, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid version"))
+		return
+	}
+
+	content, version, err := h.versionContent(r, doc, versionNumber)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	text, err := ExtractText(version.MimeType, content)
+	if err != nil {
+		writeError(w, errors.BadRequest(err.Error()))
+		return
+	}
+
+	fields, suggestions := SuggestRedactions(h.scanner, text)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"document_id":     doc.ID,
+		"version":         version.Version,
+		"detected_fields": fields,
+		"suggestions":     suggestions,
+	})
+}
+
+// CreateRedaction creates a redacted copy of a document version
+func (h *Handler) CreateRedaction(w http.ResponseWriter, r *http.Request) {
+	if h.store == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "content storage is not configured"})
+		return
+	}
+
+	doc, ok := h.loadOwned(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateRedactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+	if req.Version == 0 {
+		req.Version = doc.CurrentVersion
+	}
+
+	content, _, err := h.versionContent(r, doc, req.Version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	user := auth.GetUser(r.Context())
+	actorID := doc.CreatedBy
+	if user != nil {
+		actorID = user.ID
+	}
+
+	redacted, redactedContent, err := doc.Redact(req.Version, content, req.Redactions, actorID)
+	if err != nil {
+		writeError(w, errors.BadRequest(err.Error()))
+		return
+	}
+	for _, agencyID := range req.ShareWith {
+		if err := redacted.Share(agencyID); err != nil {
+			writeError(w, errors.BadRequest(err.Error()))
+			return
+		}
+	}
+
+	if err := h.store.Put(r.Context(), redacted.Versions[0].FilePath, redactedContent); err != nil {
+		writeError(w, errors.Wrap(err, "failed to store redacted content"))
+		return
+	}
+	if err := h.repo.Save(r.Context(), redacted); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.repo.Update(r.Context(), doc); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if h.bus != nil {
+		event := events.NewEvent("document.redacted", "document", map[string]any{
+			"document_id":          redacted.ID,
+			"original_document_id": doc.ID,
+			"original_version":     req.Version,
+			"region_count":         len(redacted.Redaction.Regions),
+			"shared_with":          redacted.SharedWith,
+		}).WithActor(actorID, "worker", doc.OwnerAgencyID)
+		h.bus.Publish(r.Context(), event)
+	}
+
+	writeJSON(w, http.StatusCreated, redacted)
+}
+
+// ListRedactions lists the redacted copies of a document
+func (h *Handler) ListRedactions(w http.ResponseWriter, r *http.Request) {
+	doc, ok := h.loadOwned(w, r)
+	if !ok {
+		return
+	}
+
+	copies, err := h.repo.FindRedactedCopies(r.Context(), doc.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data":  copies,
+		"total": len(copies),
+	})
+}
+
+// findAccessible loads a document for the calling agency. Agencies with
+// shared access to an original that has redacted copies receive the most
+// recent redacted copy shared with them instead.
+func (h *Handler) findAccessible(r *http.Request, id types.ID) (*Document, error) {
+	doc, err := h.repo.FindByID(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	user := auth.GetUser(r.Context())
+	if user == nil || user.AgencyID.IsZero() || doc.CanAccess(user.AgencyID) {
+		return doc, nil
+	}
+
+	if doc.RequiresRedaction && doc.isSharedWith(user.AgencyID) {
+		copies, err := h.repo.FindRedactedCopies(r.Context(), doc.ID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range copies {
+			if copies[i].CanAccess(user.AgencyID) {
+				return &copies[i], nil
+			}
+		}
+	}
+
+	return nil, errors.Forbidden("no access to this document")
+}
+
+// loadOwned loads a document that only the owning agency may operate on
+func (h *Handler) loadOwned(w http.ResponseWriter, r *http.Request) (*Document, bool) {
+	id, err := types.ParseID(chi.URLParam(r, "documentID"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid document ID"))
+		return nil, false
+	}
+
 	doc, err := h.repo.FindByID(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+
+	user := auth.GetUser(r.Context())
+	if user != nil && !user.AgencyID.IsZero() && user.AgencyID != doc.OwnerAgencyID {
+		writeError(w, errors.Forbidden("only the owning agency can perform this operation"))
+		return nil, false
+	}
+
+	return doc, true
+}
+
+// versionContent reads stored version content and checks it against the version hash
+func (h *Handler) versionContent(r *http.Request, doc *Document, versionNumber int) ([]byte, *DocumentVersion, error) {
+	var version *DocumentVersion
+	for i := range doc.Versions {
+		if doc.Versions[i].Version == versionNumber {
+			version = &doc.Versions[i]
+			break
+		}
+	}
+	if version == nil {
+		return nil, nil, errors.NotFound("document version", strconv.Itoa(versionNumber))
+	}
+
+	content, err := h.store.Get(r.Context(), version.FilePath)
+	if err != nil {
+		return nil, nil, errors.NotFound("document content", version.FilePath)
+	}
+
+	if hashContent(content) != version.FileHash {
+		return nil, nil, errors.Internal(fmt.Errorf("stored content of %s v%d does not match its hash", doc.ID, version.Version))
+	}
+
+	return content, version, nil
+}
+
+// ListSignatures lists document signatures, or those of the redacted copy
+// the calling agency is redirected to
+func (h *Handler) ListSignatures(w http.ResponseWriter, r *http.Request) {
+	id, err := types.ParseID(chi.URLParam(r, "documentID"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid document ID"))
+		return
+	}
+
+	doc, err := h.findAccessible(r, id)
 	if err != nil {
 		writeError(w, err)
 		return
@@ -468,8 +922,15 @@ func (h *Handler) RequestSignature(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusCreated, sig)
 }
 
-// SignDocument signs a document
+// SignDocument signs a document with the signer's signature over the content
+// hash of the version to sign. The signature must verify with a trusted
+// certificate before it is recorded, so that the public check accepts it.
 func (h *Handler) SignDocument(w http.ResponseWriter, r *http.Request) {
+	if h.chains == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "signature verification is not configured"})
+		return
+	}
+
 	id, err := types.ParseID(chi.URLParam(r, "documentID"))
 	if err != nil {
 		writeError(w, errors.BadRequest("invalid document ID"))
@@ -482,28 +943,59 @@ func (h *Handler) SignDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var req SignDocumentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+	if len(req.SignatureData) == 0 || len(req.Certificate) == 0 {
+		writeError(w, errors.BadRequest("signature_data and certificate are required"))
+		return
+	}
+
 	user := auth.GetUser(r.Context())
 	signerID := types.NewID()
 	if user != nil {
 		signerID = user.ID
 	}
 
-	// In production, signature data would come from the request
-	if err := doc.Sign(signerID, nil, nil, nil); err != nil {
-		writeError(w, errors.BadRequest(err.Error()))
+	index := -1
+	for i, s := range doc.Signatures {
+		if s.SignerID == signerID && s.Status == SignatureStatusPending {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		writeError(w, errors.BadRequest("no pending signature found for this signer"))
 		return
 	}
 
-	// Update signature and document
-	for _, s := range doc.Signatures {
-		if s.SignerID == signerID && s.Status == SignatureStatusSigned {
-			if err := h.repo.UpdateSignature(r.Context(), &s); err != nil {
-				writeError(w, err)
-				return
-			}
+	signed := doc.Signatures[index]
+	signed.SignatureData = req.SignatureData
+	signed.Certificate = req.Certificate
+	var fileHash string
+	for _, v := range doc.Versions {
+		if v.Version == signed.Version {
+			fileHash = v.FileHash
 			break
 		}
 	}
+	if err := VerifySignature(h.chains, &signed, fileHash); err != nil {
+		writeError(w, errors.BadRequest("invalid signature: "+err.Error()))
+		return
+	}
+
+	if err := doc.Sign(signerID, req.SignatureData, req.Certificate, req.TimestampToken); err != nil {
+		writeError(w, errors.BadRequest(err.Error()))
+		return
+	}
+
+	// Update signature and document
+	if err := h.repo.UpdateSignature(r.Context(), &doc.Signatures[index]); err != nil {
+		writeError(w, err)
+		return
+	}
 
 	if err := h.repo.Update(r.Context(), doc); err != nil {
 		writeError(w, err)
@@ -575,7 +1067,8 @@ func (h *Handler) RejectSignature(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, doc)
 }
 
-// VerifyDocument verifies a document's integrity and signatures
+// VerifyDocument verifies a document's integrity and signatures, or those of
+// the redacted copy the calling agency is redirected to
 func (h *Handler) VerifyDocument(w http.ResponseWriter, r *http.Request) {
 	id, err := types.ParseID(chi.URLParam(r, "documentID"))
 	if err != nil {
@@ -583,7 +1076,7 @@ func (h *Handler) VerifyDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	doc, err := h.repo.FindByID(r.Context(), id)
+	doc, err := h.findAccessible(r, id)
 	if err != nil {
 		writeError(w, err)
 		return
@@ -635,6 +1128,9 @@ func (h *Handler) VerifyDocument(w http.ResponseWriter, r *http.Request) {
 			sigVerification.VerificationDetails = "Signature rejected: " + sig.Reason
 			sigVerification.IsValid = false
 			allSigned = false
+		} else if sig.Status == SignatureStatusUnverified {
+			sigVerification.VerificationDetails = "Signature received from another agency could not be verified"
+			allSigned = false
 		}
 
 		verification.Signatures = append(verification.Signatures, sigVerification)
@@ -652,6 +1148,63 @@ func (h *Handler) VerifyDocument(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, verification)
 }
 
+// GetVerificationStamp returns the public verification code and URL of a signed document
+func (h *Handler) GetVerificationStamp(w http.ResponseWriter, r *http.Request) {
+	stamp, ok := h.verificationStamp(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stamp)
+}
+
+// GetVerificationQRCode returns the verification QR code of a signed document as PNG
+func (h *Handler) GetVerificationQRCode(w http.ResponseWriter, r *http.Request) {
+	stamp, ok := h.verificationStamp(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.WriteHeader(http.StatusOK)
+	w.Write(stamp.QRCode)
+}
+
+func (h *Handler) verificationStamp(w http.ResponseWriter, r *http.Request) (*VerificationStamp, bool) {
+	id, err := types.ParseID(chi.URLParam(r, "documentID"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid document ID"))
+		return nil, false
+	}
+
+	doc, err := h.repo.FindByID(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+
+	user := auth.GetUser(r.Context())
+	if user != nil && !user.AgencyID.IsZero() {
+		if !doc.CanAccess(user.AgencyID) {
+			writeError(w, errors.Forbidden("no access to this document"))
+			return nil, false
+		}
+	}
+
+	if doc.VerificationCode == "" {
+		writeError(w, errors.BadRequest("document is not fully signed"))
+		return nil, false
+	}
+
+	stamp, err := NewVerificationStamp(h.publicURL, doc.VerificationCode, 256)
+	if err != nil {
+		writeError(w, errors.Internal(err))
+		return nil, false
+	}
+
+	return stamp, true
+}
+
 // DocumentVerification represents the verification result for a document
 type DocumentVerification struct {
 	DocumentID          types.ID                `json:"document_id"`
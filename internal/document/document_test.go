@@ -2,8 +2,25 @@ package document
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/serbia-gov/platform/internal/federation/gateway"
+	"github.com/serbia-gov/platform/internal/federation/trust"
+	"github.com/serbia-gov/platform/internal/privacy"
+	"github.com/serbia-gov/platform/internal/shared/auth"
+	"github.com/serbia-gov/platform/internal/shared/errors"
 	"github.com/serbia-gov/platform/internal/shared/types"
 )
 
@@ -764,3 +781,998 @@ func TestRejectWithoutPendingRequest(t *testing.T) {
 		t.Error("Expected error when rejecting without pending request")
 	}
 }
+
+// newExchangeTestDocument creates a signed document with one version for exchange tests
+func newExchangeTestDocument(t *testing.T, content []byte) *Document {
+	t.Helper()
+
+	agencyID := types.NewID()
+	workerID := types.NewID()
+	signerID := types.NewID()
+
+	doc, _ := NewDocument(DocumentTypeDecision, "Rešenje o smeštaju", "", agencyID, workerID, nil)
+	doc.AddVersion("/path/to/decision.pdf", "application/pdf", int64(len(content)), bytes.NewReader(content), workerID, "Initial")
+	doc.RequestSignature(signerID, agencyID, workerID, SignatureTypeAdvanced, nil, "Approval", "Kikinda")
+
+	if err := doc.Sign(signerID, []byte("sig"), []byte("cert"), []byte("tst")); err != nil {
+		t.Fatalf("Failed to sign test document: %v", err)
+	}
+
+	return doc
+}
+
+// TestExchangeEnvelope tests packaging a document for cross-agency exchange
+func TestExchangeEnvelope(t *testing.T) {
+	content := []byte("decision content")
+	doc := newExchangeTestDocument(t, content)
+
+	envelope, err := NewExchangeEnvelope(doc, 0, content, "CSR-KI", "PU-KI")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if envelope.Version.Version != 1 {
+		t.Errorf("Expected current version 1, got %d", envelope.Version.Version)
+	}
+
+	if len(envelope.Signatures) != 1 {
+		t.Fatalf("Expected 1 signature, got %d", len(envelope.Signatures))
+	}
+
+	if string(envelope.Signatures[0].SignatureData) != "sig" {
+		t.Error("Signature data should be carried in the envelope")
+	}
+
+	if err := envelope.Verify("CSR-KI", "PU-KI"); err != nil {
+		t.Errorf("Expected valid envelope, got: %v", err)
+	}
+
+	if err := envelope.Verify("DZ-KI", "PU-KI"); err == nil {
+		t.Error("Expected error for mismatched source agency")
+	}
+
+	if err := envelope.Verify("CSR-KI", "DZ-KI"); err == nil {
+		t.Error("Expected error for mismatched target agency")
+	}
+
+	envelope.Version.Content = []byte("tampered content")
+	envelope.Version.FileSize = int64(len(envelope.Version.Content))
+	if err := envelope.Verify("CSR-KI", "PU-KI"); err == nil {
+		t.Error("Expected error for tampered content")
+	}
+}
+
+// TestExchangeEnvelopeValidation tests envelope creation errors
+func TestExchangeEnvelopeValidation(t *testing.T) {
+	content := []byte("decision content")
+	doc := newExchangeTestDocument(t, content)
+
+	if _, err := NewExchangeEnvelope(doc, 0, []byte("other content"), "CSR-KI", "PU-KI"); err == nil {
+		t.Error("Expected error for content not matching version hash")
+	}
+
+	if _, err := NewExchangeEnvelope(doc, 2, content, "CSR-KI", "PU-KI"); err == nil {
+		t.Error("Expected error for unknown version")
+	}
+
+	if _, err := NewExchangeEnvelope(doc, 0, content, "CSR-KI", "CSR-KI"); err == nil {
+		t.Error("Expected error for exchange with own agency")
+	}
+
+	doc.Void()
+	if _, err := NewExchangeEnvelope(doc, 0, content, "CSR-KI", "PU-KI"); err == nil {
+		t.Error("Expected error for voided document")
+	}
+}
+
+// newSigningAgency enrolls an agency with a new trust authority and returns
+// the authority, the agency's signing key and its certificate
+func newSigningAgency(t *testing.T) (*trust.Authority, ed25519.PrivateKey, []byte) {
+	t.Helper()
+	ctx := context.Background()
+	authority, _ := trust.NewAuthority(nil)
+
+	_, token, _ := authority.CreateEnrollment(ctx, "Centar za socijalni rad Kikinda", "CSR-KI", "", 0)
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	csr, _ := trust.CreateCSR("CSR-KI", key)
+	agency, err := authority.Enroll(ctx, token, csr)
+	if err != nil {
+		t.Fatalf("Failed to enroll agency: %v", err)
+	}
+	return authority, key, agency.Certificate
+}
+
+// signContent signs the content hash of a version the way VerifySignature expects
+func signContent(key ed25519.PrivateKey, fileHash string) []byte {
+	digest, _ := hex.DecodeString(fileHash)
+	return ed25519.Sign(key, digest)
+}
+
+// TestNewReceivedDocument tests storing a received envelope as a local document
+func TestNewReceivedDocument(t *testing.T) {
+	content := []byte("decision content")
+	origin := newExchangeTestDocument(t, content)
+	authority, key, certificate := newSigningAgency(t)
+	origin.Signatures[0].SignatureData = signContent(key, origin.Versions[0].FileHash)
+	origin.Signatures[0].Certificate = certificate
+	envelope, _ := NewExchangeEnvelope(origin, 0, content, "CSR-KI", "PU-KI")
+
+	receiverAgencyID := types.NewID()
+	doc, err := NewReceivedDocument(envelope, receiverAgencyID, receiverAgencyID, authority)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if doc.ID == origin.ID {
+		t.Error("Received document should get a new ID")
+	}
+
+	if doc.OwnerAgencyID != receiverAgencyID {
+		t.Error("Received document should be owned by the receiver")
+	}
+
+	if doc.Status != DocumentStatusSigned {
+		t.Errorf("Expected status signed, got %s", doc.Status)
+	}
+
+	if len(doc.Signatures) != 1 || doc.Signatures[0].DocumentID != doc.ID {
+		t.Error("Origin signatures should be attached to the received document")
+	}
+
+	if doc.Signatures[0].Status != SignatureStatusSigned {
+		t.Errorf("Expected verified signature, got %s", doc.Signatures[0].Status)
+	}
+
+	if doc.Versions[0].FileHash != origin.Versions[0].FileHash {
+		t.Error("Received version hash should match origin")
+	}
+
+	if !strings.Contains(doc.Versions[0].FilePath, doc.ID.String()) {
+		t.Errorf("Received content should be stored under the received document, got %s", doc.Versions[0].FilePath)
+	}
+
+	if doc.Provenance == nil {
+		t.Fatal("Provenance should be recorded")
+	}
+
+	if doc.Provenance.OriginAgency != "CSR-KI" || doc.Provenance.OriginDocumentID != origin.ID {
+		t.Error("Provenance should point back to the origin document")
+	}
+
+	if doc.Provenance.ExchangeID != envelope.ExchangeID {
+		t.Error("Provenance should record the exchange ID")
+	}
+}
+
+// TestNewReceivedDocumentUnverifiedSignatures tests that signatures that do
+// not verify are kept as unverified and the document is not marked signed
+func TestNewReceivedDocumentUnverifiedSignatures(t *testing.T) {
+	content := []byte("decision content")
+	authority, key, certificate := newSigningAgency(t)
+	otherAuthority, _, _ := newSigningAgency(t)
+
+	tests := []struct {
+		name        string
+		data        []byte
+		certificate []byte
+		verifier    CertificateVerifier
+	}{
+		{"no signature data", nil, certificate, authority},
+		{"placeholder signature", []byte("sig"), []byte("cert"), authority},
+		{"signature over other content", signContent(key, hashContent([]byte("other content"))), certificate, authority},
+		{"untrusted certificate", signContent(key, hashContent(content)), certificate, otherAuthority},
+		{"no certificate verifier", signContent(key, hashContent(content)), certificate, nil},
+	}
+	for _, tt := range tests {
+		origin := newExchangeTestDocument(t, content)
+		origin.Signatures[0].SignatureData = tt.data
+		origin.Signatures[0].Certificate = tt.certificate
+		envelope, _ := NewExchangeEnvelope(origin, 0, content, "CSR-KI", "PU-KI")
+
+		receiverAgencyID := types.NewID()
+		doc, err := NewReceivedDocument(envelope, receiverAgencyID, receiverAgencyID, tt.verifier)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got: %v", tt.name, err)
+		}
+		if doc.Signatures[0].Status != SignatureStatusUnverified {
+			t.Errorf("%s: expected unverified signature, got %s", tt.name, doc.Signatures[0].Status)
+		}
+		if doc.Status == DocumentStatusSigned {
+			t.Errorf("%s: document with unverified signatures should not be marked signed", tt.name)
+		}
+	}
+
+	// Content that does not match the declared hash is refused
+	origin := newExchangeTestDocument(t, content)
+	envelope, _ := NewExchangeEnvelope(origin, 0, content, "CSR-KI", "PU-KI")
+	envelope.Version.Content = []byte("tampered content")
+	if _, err := NewReceivedDocument(envelope, types.NewID(), types.NewID(), authority); err == nil {
+		t.Error("Expected error for content not matching the declared hash")
+	}
+}
+
+// TestDeliveryReceiptSigningPayload tests that every receipt field is covered by the signature
+func TestDeliveryReceiptSigningPayload(t *testing.T) {
+	receipt := DeliveryReceipt{
+		ExchangeID:         "exchange-1",
+		OriginAgency:       "CSR-KI",
+		ReceiverAgency:     "PU-KI",
+		OriginDocumentID:   types.NewID(),
+		ReceivedDocumentID: types.NewID(),
+		ContentHash:        "abc",
+		ReceivedAt:         time.Now(),
+	}
+
+	payload := string(receipt.SigningPayload())
+
+	receipt.ContentHash = "def"
+	if string(receipt.SigningPayload()) == payload {
+		t.Error("Changing the content hash should change the signing payload")
+	}
+}
+
+// memRepository is an in-memory DocumentRepository
+type memRepository struct {
+	mu   sync.Mutex
+	docs map[types.ID]Document
+}
+
+func newMemRepository() *memRepository {
+	return &memRepository{docs: make(map[types.ID]Document)}
+}
+
+// clone copies a document so that callers do not share its versions and signatures
+func clone(d Document) *Document {
+	d.Versions = slices.Clone(d.Versions)
+	d.Signatures = slices.Clone(d.Signatures)
+	return &d
+}
+
+func (r *memRepository) Save(ctx context.Context, d *Document) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, other := range r.docs {
+		if d.Provenance != nil && other.Provenance != nil &&
+			other.Provenance.OriginAgency == d.Provenance.OriginAgency && other.Provenance.ExchangeID == d.Provenance.ExchangeID {
+			return errors.Conflict("document exchange already received")
+		}
+	}
+	r.docs[d.ID] = *clone(*d)
+	return nil
+}
+
+func (r *memRepository) FindByID(ctx context.Context, id types.ID) (*Document, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, ok := r.docs[id]
+	if !ok {
+		return nil, errors.NotFound("document", id.String())
+	}
+	return clone(d), nil
+}
+
+func (r *memRepository) FindByVerificationCode(ctx context.Context, code string) (*Document, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.docs {
+		if d.VerificationCode == code {
+			return clone(d), nil
+		}
+	}
+	return nil, errors.NotFound("document", code)
+}
+
+func (r *memRepository) FindByExchangeID(ctx context.Context, originAgency, exchangeID string) (*Document, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.docs {
+		if d.Provenance != nil && d.Provenance.OriginAgency == originAgency && d.Provenance.ExchangeID == exchangeID {
+			return clone(d), nil
+		}
+	}
+	return nil, errors.NotFound("document exchange", exchangeID)
+}
+
+func (r *memRepository) FindRedactedCopies(ctx context.Context, originalID types.ID) ([]Document, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var copies []Document
+	for _, d := range r.docs {
+		if d.Redaction != nil && d.Redaction.OriginalDocumentID == originalID {
+			copies = append(copies, *clone(d))
+		}
+	}
+	slices.SortFunc(copies, func(a, b Document) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return copies, nil
+}
+
+func (r *memRepository) List(ctx context.Context, filter ListDocumentsFilter) ([]Document, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var docs []Document
+	for _, d := range r.docs {
+		docs = append(docs, *clone(d))
+	}
+	return docs, len(docs), nil
+}
+
+// Update stores the document fields; versions and signatures are stored separately
+func (r *memRepository) Update(ctx context.Context, d *Document) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.docs[d.ID]
+	if !ok {
+		return errors.NotFound("document", d.ID.String())
+	}
+	updated := *clone(*d)
+	updated.Versions = stored.Versions
+	updated.Signatures = stored.Signatures
+	r.docs[d.ID] = updated
+	return nil
+}
+
+func (r *memRepository) Delete(ctx context.Context, id types.ID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.docs, id)
+	return nil
+}
+
+func (r *memRepository) AddSignature(ctx context.Context, s *Signature) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, ok := r.docs[s.DocumentID]
+	if !ok {
+		return errors.NotFound("document", s.DocumentID.String())
+	}
+	d.Signatures = append(slices.Clone(d.Signatures), *s)
+	r.docs[d.ID] = d
+	return nil
+}
+
+func (r *memRepository) UpdateSignature(ctx context.Context, s *Signature) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, ok := r.docs[s.DocumentID]
+	if !ok {
+		return errors.NotFound("signature", s.ID.String())
+	}
+	d.Signatures = slices.Clone(d.Signatures)
+	for i := range d.Signatures {
+		if d.Signatures[i].ID == s.ID {
+			d.Signatures[i] = *s
+			r.docs[d.ID] = d
+			return nil
+		}
+	}
+	return errors.NotFound("signature", s.ID.String())
+}
+
+// TestReceiveDuplicateExchange tests that an envelope received again is
+// answered with the original receipt and creates no second document
+func TestReceiveDuplicateExchange(t *testing.T) {
+	ctx := context.Background()
+	content := []byte("decision content")
+
+	_, gatewayKey, _ := ed25519.GenerateKey(rand.Reader)
+	gw, err := gateway.NewGateway(gateway.Config{AgencyID: types.NewID(), AgencyCode: "PU-KI", PrivateKey: gatewayKey}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create gateway: %v", err)
+	}
+	store, _ := NewFileStore(t.TempDir())
+	repo := newMemRepository()
+	exchanger := NewExchanger(repo, gw, types.NewID(), nil)
+	exchanger.SetContentStore(store)
+
+	origin := newExchangeTestDocument(t, content)
+	envelope, _ := NewExchangeEnvelope(origin, 0, content, "CSR-KI", "PU-KI")
+	body, _ := json.Marshal(envelope)
+	receive := func(body []byte) (int, DeliveryReceipt) {
+		status, resp := exchanger.Receive(ctx, &gateway.SignedRequest{ID: types.NewID().String(), SourceAgency: "CSR-KI", Body: body})
+		var receipt DeliveryReceipt
+		json.Unmarshal(resp, &receipt)
+		return status, receipt
+	}
+
+	status, first := receive(body)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", status)
+	}
+
+	status, again := receive(body)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200 for a repeated exchange, got %d", status)
+	}
+	if again != first {
+		t.Errorf("Expected the original receipt, got %+v", again)
+	}
+	if len(repo.docs) != 1 {
+		t.Errorf("Expected one received document, got %d", len(repo.docs))
+	}
+
+	// The same exchange ID with other content is refused
+	otherContent := []byte("other decision content")
+	other := newExchangeTestDocument(t, otherContent)
+	reused, _ := NewExchangeEnvelope(other, 0, otherContent, "CSR-KI", "PU-KI")
+	reused.ExchangeID = envelope.ExchangeID
+	body, _ = json.Marshal(reused)
+	if status, _ := receive(body); status != http.StatusConflict {
+		t.Errorf("Expected status 409 for a reused exchange ID, got %d", status)
+	}
+
+	// Exchange IDs are scoped to the origin agency
+	envelope.OriginAgency = "DZ-KI"
+	body, _ = json.Marshal(envelope)
+	status, _ = exchanger.Receive(ctx, &gateway.SignedRequest{ID: types.NewID().String(), SourceAgency: "DZ-KI", Body: body})
+	if status != http.StatusCreated || len(repo.docs) != 2 {
+		t.Errorf("Expected the exchange of another agency to be received, got status %d", status)
+	}
+}
+
+// TestVerificationCodeIssuedOnSign tests that fully signed documents get a verification code
+func TestVerificationCodeIssuedOnSign(t *testing.T) {
+	content := []byte("certificate content")
+	doc := newExchangeTestDocument(t, content)
+
+	if doc.VerificationCode == "" {
+		t.Fatal("Fully signed document should have a verification code")
+	}
+
+	if len(doc.VerificationCode) != 19 {
+		t.Errorf("Expected code in XXXX-XXXX-XXXX-XXXX form, got %s", doc.VerificationCode)
+	}
+
+	doc.AddVersion("/path/to/v2.pdf", "application/pdf", 2, bytes.NewReader([]byte("v2")), types.NewID(), "Changed")
+	if doc.VerificationCode != "" {
+		t.Error("Adding a version should invalidate the verification code")
+	}
+}
+
+// TestNormalizeVerificationCode tests normalization of typed codes
+func TestNormalizeVerificationCode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"ABCD-EFGH-IJKL-MNOP", "ABCD-EFGH-IJKL-MNOP"},
+		{"abcdefghijklmnop", "ABCD-EFGH-IJKL-MNOP"},
+		{"abcd efgh ijkl mnop", "ABCD-EFGH-IJKL-MNOP"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeVerificationCode(tt.input); got != tt.expected {
+			t.Errorf("NormalizeVerificationCode(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// newVerifiableTestDocument creates a signed document whose signature
+// verifies with the returned authority, and the key it was signed with
+func newVerifiableTestDocument(t *testing.T, content []byte) (*Document, *trust.Authority, ed25519.PrivateKey) {
+	t.Helper()
+	doc := newExchangeTestDocument(t, content)
+	authority, key, certificate := newSigningAgency(t)
+	doc.Signatures[0].SignatureData = signContent(key, doc.Versions[0].FileHash)
+	doc.Signatures[0].Certificate = certificate
+	return doc, authority, key
+}
+
+// TestPublicVerification tests the public authenticity check result
+func TestPublicVerification(t *testing.T) {
+	content := []byte("certificate content")
+	doc, authority, key := newVerifiableTestDocument(t, content)
+
+	v := NewPublicVerification(doc, content, authority)
+
+	if !v.IsValid {
+		t.Errorf("Expected valid document, got reason: %s", v.Reason)
+	}
+
+	if v.Hash != doc.Versions[0].FileHash {
+		t.Error("Verification should expose the current version hash")
+	}
+
+	if v.IssuedAt == nil {
+		t.Error("Issue date should be set from the signature time")
+	}
+
+	if v.SignatureCount != 1 || !v.SignaturesValid {
+		t.Error("Expected one valid signature")
+	}
+
+	// Stored content that no longer matches the recorded hash
+	v = NewPublicVerification(doc, []byte("altered content"), authority)
+	if v.IsValid || v.Reason != "Document content does not match its hash" {
+		t.Errorf("Altered content should not verify, got reason: %s", v.Reason)
+	}
+
+	v = NewPublicVerification(doc, nil, authority)
+	if v.IsValid {
+		t.Error("Document whose content cannot be read should not verify")
+	}
+
+	// Signed status alone does not make a signature valid
+	otherAuthority, _, _ := newSigningAgency(t)
+	signatures := []struct {
+		name     string
+		data     []byte
+		verifier CertificateVerifier
+	}{
+		{"placeholder signature", []byte("sig"), authority},
+		{"signature over other content", signContent(key, hashContent([]byte("other content"))), authority},
+		{"untrusted certificate", doc.Signatures[0].SignatureData, otherAuthority},
+		{"no certificate verifier", doc.Signatures[0].SignatureData, nil},
+	}
+	valid := doc.Signatures[0].SignatureData
+	for _, tt := range signatures {
+		doc.Signatures[0].SignatureData = tt.data
+		v = NewPublicVerification(doc, content, tt.verifier)
+		if v.IsValid || v.SignaturesValid {
+			t.Errorf("%s: expected invalid signatures", tt.name)
+		}
+	}
+	doc.Signatures[0].SignatureData = valid
+
+	doc.Void()
+	v = NewPublicVerification(doc, content, authority)
+	if v.IsValid {
+		t.Error("Voided document should not verify")
+	}
+}
+
+// serve sends a request to a handler as user and returns the response
+func serve(handler http.Handler, user *auth.User, method, path string, body any) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if user != nil {
+		req = req.WithContext(auth.WithUser(req.Context(), user))
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestSignAndVerifyPublicly tests that a document signed through the API
+// passes the public authenticity check
+func TestSignAndVerifyPublicly(t *testing.T) {
+	ctx := context.Background()
+	content := []byte("decision content")
+	authority, key, certificate := newSigningAgency(t)
+	repo := newMemRepository()
+	store, _ := NewFileStore(t.TempDir())
+
+	agencyID := types.NewID()
+	worker := &auth.User{ID: types.NewID(), AgencyID: agencyID}
+	signer := &auth.User{ID: types.NewID(), AgencyID: agencyID}
+	doc, _ := NewDocument(DocumentTypeDecision, "Rešenje o smeštaju", "", agencyID, worker.ID, nil)
+	version, _ := doc.AddVersion("decisions/v1", "application/pdf", int64(len(content)), bytes.NewReader(content), worker.ID, "Initial")
+	store.Put(ctx, version.FilePath, content)
+	repo.Save(ctx, doc)
+
+	handler := NewHandler(repo, nil)
+	handler.SetContentStore(store)
+	routes := handler.Routes()
+
+	rec := serve(routes, worker, http.MethodPost, "/"+doc.ID.String()+"/signatures", RequestSignatureRequest{
+		SignerID:       signer.ID,
+		SignerAgencyID: agencyID,
+		Type:           SignatureTypeAdvanced,
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected signature request to be created, got %d: %s", rec.Code, rec.Body)
+	}
+	var requested Signature
+	json.Unmarshal(rec.Body.Bytes(), &requested)
+	signPath := "/" + doc.ID.String() + "/signatures/" + requested.ID.String() + "/sign"
+	signature := SignDocumentRequest{SignatureData: signContent(key, version.FileHash), Certificate: certificate}
+
+	if rec := serve(routes, signer, http.MethodPost, signPath, signature); rec.Code != http.StatusNotImplemented {
+		t.Errorf("Expected signing to be refused without a certificate verifier, got %d", rec.Code)
+	}
+	handler.SetCertificateVerifier(authority)
+
+	// Signatures that would fail the public check are refused
+	_, otherKey, otherCertificate := newSigningAgency(t)
+	refused := []struct {
+		name string
+		req  SignDocumentRequest
+	}{
+		{"no signature", SignDocumentRequest{}},
+		{"placeholder signature", SignDocumentRequest{SignatureData: []byte("sig"), Certificate: []byte("cert")}},
+		{"signature over other content", SignDocumentRequest{SignatureData: signContent(key, hashContent([]byte("other"))), Certificate: certificate}},
+		{"untrusted certificate", SignDocumentRequest{SignatureData: signContent(otherKey, version.FileHash), Certificate: otherCertificate}},
+	}
+	for _, tt := range refused {
+		if rec := serve(routes, signer, http.MethodPost, signPath, tt.req); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", tt.name, rec.Code)
+		}
+	}
+	if rec := serve(routes, signer, http.MethodPost, signPath, signature); rec.Code != http.StatusOK {
+		t.Fatalf("Expected document to be signed, got %d: %s", rec.Code, rec.Body)
+	}
+
+	signed, _ := repo.FindByID(ctx, doc.ID)
+	if signed.Status != DocumentStatusSigned || signed.VerificationCode == "" {
+		t.Fatalf("Expected a signed document with a verification code, got %s", signed.Status)
+	}
+
+	verifier := NewPublicVerifyHandler(repo, nil)
+	verifier.SetContentStore(store)
+	verifier.SetCertificateVerifier(authority)
+	rec = serve(verifier.Routes(), nil, http.MethodGet, "/"+signed.VerificationCode, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected verification to succeed, got %d", rec.Code)
+	}
+	var v PublicVerification
+	json.Unmarshal(rec.Body.Bytes(), &v)
+	if !v.IsValid {
+		t.Errorf("Expected the signed document to verify, got reason: %s", v.Reason)
+	}
+}
+
+// TestSignatureCertificateRevocation tests that revoked signing certificates
+// invalidate signatures made after the revocation
+func TestSignatureCertificateRevocation(t *testing.T) {
+	ctx := context.Background()
+	content := []byte("decision content")
+	doc, authority, _ := newVerifiableTestDocument(t, content)
+	agency, err := authority.GetAgencyByCode(ctx, "CSR-KI")
+	if err != nil {
+		t.Fatalf("Failed to get agency: %v", err)
+	}
+	checker := authority.RevocationChecker()
+
+	v := NewPublicVerification(doc, content, authority)
+	CheckSignatureCertificates(ctx, checker, doc, v)
+	if !v.IsValid {
+		t.Fatalf("Expected valid document, got reason: %s", v.Reason)
+	}
+
+	// Signatures made before the revocation stay valid
+	authority.RevokeAgency(ctx, agency.ID, "Agency dissolved")
+	v = NewPublicVerification(doc, content, authority)
+	CheckSignatureCertificates(ctx, checker, doc, v)
+	if !v.IsValid {
+		t.Errorf("Signature made before revocation should stay valid, got reason: %s", v.Reason)
+	}
+
+	signedAt := time.Now().Add(time.Minute)
+	doc.Signatures[0].SignedAt = &signedAt
+	v = NewPublicVerification(doc, content, authority)
+	CheckSignatureCertificates(ctx, checker, doc, v)
+	if v.IsValid || v.SignaturesValid {
+		t.Error("Signature made after revocation should not verify")
+	}
+
+	// A certificate that cannot be parsed fails verification
+	doc.Signatures[0].Certificate = []byte("cert")
+	v = NewPublicVerification(doc, content, authority)
+	CheckSignatureCertificates(ctx, checker, doc, v)
+	if v.IsValid {
+		t.Error("Unparseable signing certificate should not verify")
+	}
+}
+
+// TestVerificationStamp tests QR code generation for printed documents
+func TestVerificationStamp(t *testing.T) {
+	stamp, err := NewVerificationStamp("https://platform.gov.rs/", "ABCD-EFGH-IJKL-MNOP", 128)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if stamp.URL != "https://platform.gov.rs/verify/ABCD-EFGH-IJKL-MNOP" {
+		t.Errorf("Unexpected verification URL: %s", stamp.URL)
+	}
+
+	if !bytes.HasPrefix(stamp.QRCode, []byte("\x89PNG")) {
+		t.Error("QR code should be a PNG image")
+	}
+
+	if _, err := NewVerificationStamp("https://platform.gov.rs", "", 128); err == nil {
+		t.Error("Expected error for document without verification code")
+	}
+}
+
+// --- Redaction Tests ---
+
+func newRedactionTestDocument(t *testing.T, content []byte) *Document {
+	t.Helper()
+
+	agencyID := types.NewID()
+	workerID := types.NewID()
+
+	doc, _ := NewDocument(DocumentTypeReport, "Psihološki nalaz", "", agencyID, workerID, nil)
+	doc.AddVersion("/documents/report.txt", "text/plain; charset=utf-8", int64(len(content)), bytes.NewReader(content), workerID, "Initial")
+
+	return doc
+}
+
+// TestApplyRedactions tests region and text redactions
+func TestApplyRedactions(t *testing.T) {
+	text := "Dijagnoza: F32.1. Pacijent Marko. Terapija: sertralin. Marko dolazi redovno."
+
+	redacted, regions, err := ApplyRedactions(text, []Redaction{
+		{Text: "Marko", Reason: "name"},
+		{Start: 0, End: 17, Reason: "health"},
+		{Start: 11, End: 16, Reason: "health"}, // overlaps previous
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if strings.Contains(redacted, "Marko") || strings.Contains(redacted, "F32.1") {
+		t.Errorf("Redacted text still contains removed content: %s", redacted)
+	}
+	if len(regions) != 3 {
+		t.Errorf("Expected 3 merged regions, got %d", len(regions))
+	}
+	if !strings.HasPrefix(redacted, RedactionMarker+" Pacijent") {
+		t.Errorf("Unexpected redacted text: %s", redacted)
+	}
+
+	invalid := []struct {
+		name       string
+		redactions []Redaction
+	}{
+		{"empty", nil},
+		{"missing reason", []Redaction{{Start: 0, End: 4}}},
+		{"out of range", []Redaction{{Start: 0, End: 1000, Reason: "x"}}},
+		{"text not found", []Redaction{{Text: "Petar", Reason: "x"}}},
+		{"splits character", []Redaction{{Start: 0, End: 1, Reason: "x"}}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			input := text
+			if tt.name == "splits character" {
+				input = "Čačak"
+			}
+			if _, _, err := ApplyRedactions(input, tt.redactions); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+// TestRedactCreatesCopy tests that redaction creates a linked copy and restricts the original
+func TestRedactCreatesCopy(t *testing.T) {
+	content := []byte("Nalaz: anksiozni poremećaj. Kontakt: 064 123 4567.")
+	doc := newRedactionTestDocument(t, content)
+
+	police := types.NewID()
+	if err := doc.Share(police); err != nil {
+		t.Fatalf("Share failed: %v", err)
+	}
+
+	redacted, out, err := doc.Redact(1, content, []Redaction{{Text: "anksiozni poremećaj", Reason: "health"}}, doc.CreatedBy)
+	if err != nil {
+		t.Fatalf("Redact failed: %v", err)
+	}
+
+	if strings.Contains(string(out), "anksiozni") {
+		t.Error("Redacted content should not contain removed text")
+	}
+	if redacted.Redaction == nil || redacted.Redaction.OriginalDocumentID != doc.ID {
+		t.Fatal("Redacted copy should link to the original")
+	}
+	if redacted.Redaction.OriginalHash != doc.Versions[0].FileHash {
+		t.Error("Redacted copy should record the original version hash")
+	}
+	if redacted.Versions[0].FileHash != hashContent(out) {
+		t.Error("Redacted copy version hash should match redacted content")
+	}
+
+	// The original is restricted to its owner; shared agencies get the copy
+	if !doc.RequiresRedaction {
+		t.Error("Original should require redaction")
+	}
+	if doc.CanAccess(police) {
+		t.Error("Shared agency should not access the original")
+	}
+	if !doc.CanAccess(doc.OwnerAgencyID) {
+		t.Error("Owner should still access the original")
+	}
+	if !redacted.CanAccess(police) {
+		t.Error("Shared agency should access the redacted copy")
+	}
+	if err := doc.Share(types.NewID()); err == nil {
+		t.Error("Sharing the original should fail once redacted copies exist")
+	}
+	if _, err := NewExchangeEnvelope(doc, 1, content, "CSR-KI", "PU-KI"); err == nil {
+		t.Error("Exchanging the original should fail once redacted copies exist")
+	}
+}
+
+// TestSharedAccessRoutes tests that an agency with shared access to a
+// redacted original is answered from the redacted copy on every route
+func TestSharedAccessRoutes(t *testing.T) {
+	ctx := context.Background()
+	content := []byte("Nalaz: anksiozni poremećaj. Kontakt: 064 123 4567.")
+	doc := newRedactionTestDocument(t, content)
+	signerID := types.NewID()
+	doc.RequestSignature(signerID, doc.OwnerAgencyID, doc.CreatedBy, SignatureTypeAdvanced, nil, "Approval", "Kikinda")
+	doc.Sign(signerID, []byte("sig"), []byte("cert"), nil)
+
+	police := types.NewID()
+	doc.Share(police)
+	redacted, out, err := doc.Redact(1, content, []Redaction{{Text: "anksiozni poremećaj", Reason: "health"}}, doc.CreatedBy)
+	if err != nil {
+		t.Fatalf("Redact failed: %v", err)
+	}
+	redacted.RequestSignature(signerID, doc.OwnerAgencyID, doc.CreatedBy, SignatureTypeAdvanced, nil, "Approval", "Kikinda")
+	redacted.Sign(signerID, []byte("sig"), []byte("cert"), nil)
+
+	repo := newMemRepository()
+	repo.Save(ctx, doc)
+	repo.Save(ctx, redacted)
+	store, _ := NewFileStore(t.TempDir())
+	store.Put(ctx, doc.Versions[0].FilePath, content)
+	store.Put(ctx, redacted.Versions[0].FilePath, out)
+	handler := NewHandler(repo, nil)
+	handler.SetContentStore(store)
+	routes := handler.Routes()
+
+	owner := &auth.User{ID: doc.CreatedBy, AgencyID: doc.OwnerAgencyID}
+	shared := &auth.User{ID: types.NewID(), AgencyID: police}
+	stranger := &auth.User{ID: types.NewID(), AgencyID: types.NewID()}
+	base := "/" + doc.ID.String()
+
+	// Each route answers with the ID and version hash of the document it read
+	routesUnderTest := []struct {
+		path    string
+		respond func(body []byte) (types.ID, string)
+	}{
+		{base + "/", func(body []byte) (types.ID, string) {
+			var d Document
+			json.Unmarshal(body, &d)
+			return d.ID, d.Versions[0].FileHash
+		}},
+		{base + "/versions", func(body []byte) (types.ID, string) {
+			var resp struct{ Data []DocumentVersion }
+			json.Unmarshal(body, &resp)
+			return resp.Data[0].DocumentID, resp.Data[0].FileHash
+		}},
+		{base + "/signatures", func(body []byte) (types.ID, string) {
+			var resp struct{ Data []Signature }
+			json.Unmarshal(body, &resp)
+			return resp.Data[0].DocumentID, ""
+		}},
+		{base + "/verify", func(body []byte) (types.ID, string) {
+			var v DocumentVerification
+			json.Unmarshal(body, &v)
+			return v.DocumentID, v.Hash
+		}},
+		{"/verify/" + doc.ID.String(), func(body []byte) (types.ID, string) {
+			var v DocumentVerification
+			json.Unmarshal(body, &v)
+			return v.DocumentID, v.Hash
+		}},
+		{base + "/versions/1/content", func(body []byte) (types.ID, string) {
+			if hashContent(body) == redacted.Versions[0].FileHash {
+				return redacted.ID, hashContent(body)
+			}
+			return doc.ID, hashContent(body)
+		}},
+	}
+	for _, route := range routesUnderTest {
+		rec := serve(routes, owner, http.MethodGet, route.path, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200 for the owner, got %d", route.path, rec.Code)
+		}
+		if id, hash := route.respond(rec.Body.Bytes()); id != doc.ID || (hash != "" && hash != doc.Versions[0].FileHash) {
+			t.Errorf("%s: owner should read the original", route.path)
+		}
+
+		rec = serve(routes, shared, http.MethodGet, route.path, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200 for the shared agency, got %d", route.path, rec.Code)
+		}
+		if id, hash := route.respond(rec.Body.Bytes()); id != redacted.ID || (hash != "" && hash != redacted.Versions[0].FileHash) {
+			t.Errorf("%s: shared agency should read the redacted copy", route.path)
+		}
+
+		if rec := serve(routes, stranger, http.MethodGet, route.path, nil); rec.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status 403 for an agency without access, got %d", route.path, rec.Code)
+		}
+	}
+}
+
+// TestRedactValidation tests redaction input checks
+func TestRedactValidation(t *testing.T) {
+	content := []byte("text")
+	doc := newRedactionTestDocument(t, content)
+
+	if _, _, err := doc.Redact(2, content, []Redaction{{Text: "t", Reason: "x"}}, doc.CreatedBy); err == nil {
+		t.Error("Expected error for unknown version")
+	}
+	if _, _, err := doc.Redact(1, []byte("other"), []Redaction{{Text: "t", Reason: "x"}}, doc.CreatedBy); err == nil {
+		t.Error("Expected error for content not matching hash")
+	}
+
+	pdf := newExchangeTestDocument(t, content)
+	if _, _, err := pdf.Redact(1, content, []Redaction{{Text: "t", Reason: "x"}}, pdf.CreatedBy); err == nil {
+		t.Error("Expected error for binary content")
+	}
+	if doc.RequiresRedaction {
+		t.Error("Failed redaction should not restrict the original")
+	}
+}
+
+// TestSuggestRedactions tests PII-based redaction suggestions
+func TestSuggestRedactions(t *testing.T) {
+	guard := privacy.NewPrivacyGuard(nil, privacy.DefaultPrivacyGuardConfig())
+	text := "Roditelj: JMBG 0101990710006, telefon 064 123 4567."
+
+	fields, suggestions := SuggestRedactions(guard, text)
+	if len(fields) != 2 || len(suggestions) != 2 {
+		t.Fatalf("Expected 2 fields and suggestions, got %v / %d", fields, len(suggestions))
+	}
+
+	redactions := make([]Redaction, len(suggestions))
+	for i, s := range suggestions {
+		redactions[i] = s.Redaction
+	}
+	redacted, _, err := ApplyRedactions(text, redactions)
+	if err != nil {
+		t.Fatalf("Applying suggestions failed: %v", err)
+	}
+	if guard.ContainsPII(redacted) {
+		t.Errorf("Redacted text still contains PII: %s", redacted)
+	}
+
+	if _, none := SuggestRedactions(guard, "Bez ličnih podataka."); none != nil {
+		t.Error("Expected no suggestions")
+	}
+}
+
+// TestLegalHold tests that a legal hold blocks voiding and deletion
+func TestLegalHold(t *testing.T) {
+	agencyID := types.NewID()
+	workerID := types.NewID()
+
+	doc, _ := NewDocument(DocumentTypeReport, "Test Report", "", agencyID, workerID, nil)
+
+	if err := doc.CanDelete(); err != nil {
+		t.Errorf("Expected draft document to be deletable, got: %v", err)
+	}
+
+	hold, err := types.NewLegalHold("Pending litigation", "P-123/2026", workerID)
+	if err != nil {
+		t.Fatalf("NewLegalHold failed: %v", err)
+	}
+	if err := doc.PlaceLegalHold(hold); err != nil {
+		t.Fatalf("PlaceLegalHold failed: %v", err)
+	}
+	if err := doc.PlaceLegalHold(hold); err == nil {
+		t.Error("Expected error placing a second legal hold")
+	}
+
+	if err := doc.Void(); err == nil {
+		t.Error("Expected error voiding document under legal hold")
+	}
+	if err := doc.CanDelete(); err == nil {
+		t.Error("Expected error deleting document under legal hold")
+	}
+
+	if err := doc.ReleaseLegalHold(); err != nil {
+		t.Fatalf("ReleaseLegalHold failed: %v", err)
+	}
+	if err := doc.ReleaseLegalHold(); err == nil {
+		t.Error("Expected error releasing document without legal hold")
+	}
+	if err := doc.Void(); err != nil {
+		t.Errorf("Expected void after release, got: %v", err)
+	}
+
+	// Void documents are official records disposed of under the retention schedule
+	if err := doc.CanDelete(); err == nil {
+		t.Error("Expected error deleting non-draft document")
+	}
+
+	if _, err := types.NewLegalHold("", "", workerID); err == nil {
+		t.Error("Expected error for legal hold without reason")
+	}
+}
@@ -0,0 +1,480 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/serbia-gov/platform/internal/federation/gateway"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/events"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// ExchangeServicePath is the federation path of the document.exchange service
+const ExchangeServicePath = "/api/v1/documents/exchange"
+
+// DocumentProvenance records where a document received over federation came from
+type DocumentProvenance struct {
+	OriginAgency         string    `json:"origin_agency"`
+	OriginDocumentID     types.ID  `json:"origin_document_id"`
+	OriginDocumentNumber string    `json:"origin_document_number"`
+	OriginVersion        int       `json:"origin_version"`
+	ExchangeID           string    `json:"exchange_id"`
+	ContentHash          string    `json:"content_hash"`
+	ReceivedAt           time.Time `json:"received_at"`
+}
+
+// ExchangeEnvelope is the package sent to another agency's document.exchange service.
+// The envelope itself is carried in a gateway.SignedRequest, so its integrity and
+// origin are covered by the sending agency's request signature.
+type ExchangeEnvelope struct {
+	ExchangeID   string    `json:"exchange_id"`
+	OriginAgency string    `json:"origin_agency"`
+	TargetAgency string    `json:"target_agency"`
+	SentAt       time.Time `json:"sent_at"`
+
+	Document   ExchangedDocument    `json:"document"`
+	Version    ExchangedVersion     `json:"version"`
+	Signatures []ExchangedSignature `json:"signatures,omitempty"`
+}
+
+// ExchangedDocument carries the document metadata in an exchange envelope
+type ExchangedDocument struct {
+	ID             types.ID     `json:"id"`
+	DocumentNumber string       `json:"document_number"`
+	Type           DocumentType `json:"type"`
+	Title          string       `json:"title"`
+	Description    string       `json:"description,omitempty"`
+}
+
+// ExchangedVersion carries a single document version and its content
+type ExchangedVersion struct {
+	Version  int    `json:"version"`
+	FileHash string `json:"file_hash"`
+	FileSize int64  `json:"file_size"`
+	MimeType string `json:"mime_type"`
+	Content  []byte `json:"content"`
+}
+
+// ExchangedSignature carries a completed signature on the exchanged version,
+// including the signature material that Signature hides from API responses
+type ExchangedSignature struct {
+	SignerID       types.ID      `json:"signer_id"`
+	SignerAgencyID types.ID      `json:"signer_agency_id"`
+	Type           SignatureType `json:"type"`
+	SignatureData  []byte        `json:"signature_data,omitempty"`
+	Certificate    []byte        `json:"certificate,omitempty"`
+	TimestampToken []byte        `json:"timestamp_token,omitempty"`
+	Reason         string        `json:"reason,omitempty"`
+	Location       string        `json:"location,omitempty"`
+	SignedAt       *time.Time    `json:"signed_at,omitempty"`
+}
+
+// DeliveryReceipt is returned by the receiving agency and signed with its key
+type DeliveryReceipt struct {
+	ExchangeID             string    `json:"exchange_id"`
+	OriginAgency           string    `json:"origin_agency"`
+	ReceiverAgency         string    `json:"receiver_agency"`
+	OriginDocumentID       types.ID  `json:"origin_document_id"`
+	ReceivedDocumentID     types.ID  `json:"received_document_id"`
+	ReceivedDocumentNumber string    `json:"received_document_number"`
+	ContentHash            string    `json:"content_hash"`
+	ReceivedAt             time.Time `json:"received_at"`
+	Signature              string    `json:"signature"`
+}
+
+// NewExchangeEnvelope packages a document version, its content and its completed
+// signatures for delivery to another agency
+func NewExchangeEnvelope(d *Document, version int, content []byte, originAgency, targetAgency string) (*ExchangeEnvelope, error) {
+	if targetAgency == "" {
+		return nil, fmt.Errorf("target agency is required")
+	}
+	if targetAgency == originAgency {
+		return nil, fmt.Errorf("cannot exchange document with own agency")
+	}
+	if d.Status == DocumentStatusVoid {
+		return nil, fmt.Errorf("cannot exchange voided document")
+	}
+	if d.RequiresRedaction {
+		return nil, fmt.Errorf("document has redacted copies; exchange a redacted copy instead")
+	}
+
+	if version == 0 {
+		version = d.CurrentVersion
+	}
+
+	var v *DocumentVersion
+	for i := range d.Versions {
+		if d.Versions[i].Version == version {
+			v = &d.Versions[i]
+			break
+		}
+	}
+	if v == nil {
+		return nil, fmt.Errorf("document version %d not found", version)
+	}
+
+	if hashContent(content) != v.FileHash {
+		return nil, fmt.Errorf("content does not match hash of version %d", version)
+	}
+
+	envelope := &ExchangeEnvelope{
+		ExchangeID:   types.NewID().String(),
+		OriginAgency: originAgency,
+		TargetAgency: targetAgency,
+		SentAt:       time.Now().UTC(),
+		Document: ExchangedDocument{
+			ID:             d.ID,
+			DocumentNumber: d.DocumentNumber,
+			Type:           d.Type,
+			Title:          d.Title,
+			Description:    d.Description,
+		},
+		Version: ExchangedVersion{
+			Version:  v.Version,
+			FileHash: v.FileHash,
+			FileSize: v.FileSize,
+			MimeType: v.MimeType,
+			Content:  content,
+		},
+	}
+
+	for _, s := range d.Signatures {
+		if s.Version != version || s.Status != SignatureStatusSigned {
+			continue
+		}
+		envelope.Signatures = append(envelope.Signatures, ExchangedSignature{
+			SignerID:       s.SignerID,
+			SignerAgencyID: s.SignerAgencyID,
+			Type:           s.Type,
+			SignatureData:  s.SignatureData,
+			Certificate:    s.Certificate,
+			TimestampToken: s.TimestampToken,
+			Reason:         s.Reason,
+			Location:       s.Location,
+			SignedAt:       s.SignedAt,
+		})
+	}
+
+	return envelope, nil
+}
+
+// Verify checks that the envelope was sent by sourceAgency to targetAgency and
+// that the carried content matches the declared version hash
+func (e *ExchangeEnvelope) Verify(sourceAgency, targetAgency string) error {
+	if e.ExchangeID == "" {
+		return fmt.Errorf("exchange ID is required")
+	}
+	if e.OriginAgency != sourceAgency {
+		return fmt.Errorf("envelope origin %s does not match request source %s", e.OriginAgency, sourceAgency)
+	}
+	if e.TargetAgency != targetAgency {
+		return fmt.Errorf("envelope is addressed to %s, not %s", e.TargetAgency, targetAgency)
+	}
+	if e.Document.Title == "" {
+		return fmt.Errorf("document title is required")
+	}
+	if len(e.Version.Content) == 0 {
+		return fmt.Errorf("document content is required")
+	}
+	if int64(len(e.Version.Content)) != e.Version.FileSize {
+		return fmt.Errorf("content size %d does not match declared size %d", len(e.Version.Content), e.Version.FileSize)
+	}
+	if hashContent(e.Version.Content) != e.Version.FileHash {
+		return fmt.Errorf("content hash does not match declared hash")
+	}
+
+	return nil
+}
+
+// NewReceivedDocument creates a document owned by the receiving agency from a verified envelope.
+// The new document records its provenance and keeps the origin's signatures.
+// Each signature is verified over the content hash with certificates; those
+// that do not verify are kept as unverified. The document is marked signed
+// only when it carries signatures and all of them verify.
+func NewReceivedDocument(e *ExchangeEnvelope, ownerAgencyID, receivedBy types.ID, certificates CertificateVerifier) (*Document, error) {
+	doc, err := NewDocument(e.Document.Type, e.Document.Title, e.Document.Description, ownerAgencyID, receivedBy, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stored under the received document, so a version received twice does
+	// not overwrite the first copy
+	filePath := fmt.Sprintf("federation/%s/%s/v1", e.OriginAgency, doc.ID)
+	version, err := doc.AddVersion(
+		filePath,
+		e.Version.MimeType,
+		e.Version.FileSize,
+		bytes.NewReader(e.Version.Content),
+		receivedBy,
+		fmt.Sprintf("Received from %s (%s v%d)", e.OriginAgency, e.Document.DocumentNumber, e.Version.Version),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if version.FileHash != e.Version.FileHash {
+		return nil, fmt.Errorf("content hash does not match declared hash")
+	}
+
+	verified := len(e.Signatures) > 0
+	for _, s := range e.Signatures {
+		sig := Signature{
+			ID:             types.NewID(),
+			DocumentID:     doc.ID,
+			Version:        version.Version,
+			SignerID:       s.SignerID,
+			SignerAgencyID: s.SignerAgencyID,
+			Type:           s.Type,
+			Status:         SignatureStatusSigned,
+			SignatureData:  s.SignatureData,
+			Certificate:    s.Certificate,
+			TimestampToken: s.TimestampToken,
+			Reason:         s.Reason,
+			Location:       s.Location,
+			SignedAt:       s.SignedAt,
+			CreatedAt:      time.Now(),
+		}
+		if err := VerifySignature(certificates, &sig, version.FileHash); err != nil {
+			fmt.Printf("Warning: signature of %s on document %s from %s not verified: %v\n",
+				s.SignerID, e.Document.ID, e.OriginAgency, err)
+			sig.Status = SignatureStatusUnverified
+			verified = false
+		}
+		doc.Signatures = append(doc.Signatures, sig)
+	}
+	if verified {
+		doc.Status = DocumentStatusSigned
+	}
+
+	doc.Provenance = &DocumentProvenance{
+		OriginAgency:         e.OriginAgency,
+		OriginDocumentID:     e.Document.ID,
+		OriginDocumentNumber: e.Document.DocumentNumber,
+		OriginVersion:        e.Version.Version,
+		ExchangeID:           e.ExchangeID,
+		ContentHash:          version.FileHash,
+		ReceivedAt:           time.Now().UTC(),
+	}
+
+	return doc, nil
+}
+
+// SigningPayload returns the canonical representation of the receipt used for signing
+func (r *DeliveryReceipt) SigningPayload() []byte {
+	return []byte(fmt.Sprintf("%s|%s|%s|%s|%s|%s|%s|%s",
+		r.ExchangeID,
+		r.OriginAgency,
+		r.ReceiverAgency,
+		r.OriginDocumentID,
+		r.ReceivedDocumentID,
+		r.ReceivedDocumentNumber,
+		r.ContentHash,
+		r.ReceivedAt.Format(time.RFC3339Nano),
+	))
+}
+
+// Exchanger sends documents to other agencies and receives documents sent to this agency
+type Exchanger struct {
+	repo         DocumentRepository
+	gateway      *gateway.Gateway
+	agencyID     types.ID // Local agency that owns received documents
+	bus          events.EventBus
+	store        ContentStore        // nil refuses received documents
+	certificates CertificateVerifier // nil leaves received signatures unverified
+}
+
+// NewExchanger creates a new document exchanger
+func NewExchanger(repo DocumentRepository, gw *gateway.Gateway, agencyID types.ID, bus events.EventBus) *Exchanger {
+	return &Exchanger{
+		repo:     repo,
+		gateway:  gw,
+		agencyID: agencyID,
+		bus:      bus,
+	}
+}
+
+// SetContentStore sets where the content of received documents is stored
+func (x *Exchanger) SetContentStore(store ContentStore) {
+	x.store = store
+}
+
+// SetCertificateVerifier sets what verifies the certificates of signatures
+// on received documents
+func (x *Exchanger) SetCertificateVerifier(certificates CertificateVerifier) {
+	x.certificates = certificates
+}
+
+// AgencyCode returns the code of the local agency used as exchange origin
+func (x *Exchanger) AgencyCode() string {
+	return x.gateway.AgencyCode()
+}
+
+// Send delivers an exchange envelope to its target agency and returns the verified delivery receipt
+func (x *Exchanger) Send(ctx context.Context, envelope *ExchangeEnvelope) (*DeliveryReceipt, error) {
+	targetAgency := envelope.TargetAgency
+
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal exchange envelope: %w", err)
+	}
+
+	resp, err := x.gateway.SendRequest(ctx, targetAgency, http.MethodPost, ExchangeServicePath, body)
+	if err != nil {
+		return nil, fmt.Errorf("document exchange failed: %w", err)
+	}
+
+	// A retried exchange is answered with the receipt of the first delivery
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("document exchange rejected by %s: status %d: %s", targetAgency, resp.StatusCode, resp.Body)
+	}
+
+	var receipt DeliveryReceipt
+	if err := json.Unmarshal(resp.Body, &receipt); err != nil {
+		return nil, fmt.Errorf("failed to parse delivery receipt: %w", err)
+	}
+
+	if receipt.ExchangeID != envelope.ExchangeID || receipt.ContentHash != envelope.Version.FileHash {
+		return nil, fmt.Errorf("delivery receipt does not match sent envelope")
+	}
+	if receipt.ReceiverAgency != targetAgency {
+		return nil, fmt.Errorf("delivery receipt issued by %s, expected %s", receipt.ReceiverAgency, targetAgency)
+	}
+
+	if err := x.gateway.VerifyAgencySignature(ctx, targetAgency, receipt.SigningPayload(), receipt.Signature); err != nil {
+		return nil, fmt.Errorf("invalid delivery receipt signature: %w", err)
+	}
+
+	if x.bus != nil {
+		event := events.NewEvent("document.exchange.delivered", "document", map[string]any{
+			"document_id":          envelope.Document.ID,
+			"exchange_id":          receipt.ExchangeID,
+			"version":              envelope.Version.Version,
+			"target_agency":        targetAgency,
+			"received_document_id": receipt.ReceivedDocumentID,
+			"content_hash":         receipt.ContentHash,
+			"receipt_signature":    receipt.Signature,
+		}).WithActor(types.ID(""), "system", x.agencyID)
+		x.bus.Publish(ctx, event)
+	}
+
+	return &receipt, nil
+}
+
+// Receive handles document.exchange requests delivered by the federation gateway.
+// It implements gateway.ServiceHandler.
+func (x *Exchanger) Receive(ctx context.Context, req *gateway.SignedRequest) (int, []byte) {
+	var envelope ExchangeEnvelope
+	if err := json.Unmarshal(req.Body, &envelope); err != nil {
+		return exchangeError(http.StatusBadRequest, "invalid exchange envelope")
+	}
+
+	if err := envelope.Verify(req.SourceAgency, x.gateway.AgencyCode()); err != nil {
+		return exchangeError(http.StatusBadRequest, "envelope verification failed: "+err.Error())
+	}
+
+	if x.store == nil {
+		return exchangeError(http.StatusServiceUnavailable, "document storage is not configured")
+	}
+
+	// A replayed or retried envelope is answered with the original receipt
+	existing, err := x.repo.FindByExchangeID(ctx, envelope.OriginAgency, envelope.ExchangeID)
+	if err == nil {
+		return x.receivedAgain(&envelope, existing)
+	}
+	if !stderrors.Is(err, errors.ErrNotFound) {
+		return exchangeError(http.StatusInternalServerError, "failed to look up document exchange")
+	}
+
+	// Received documents are created on behalf of the receiving agency itself
+	doc, err := NewReceivedDocument(&envelope, x.agencyID, x.agencyID, x.certificates)
+	if err != nil {
+		return exchangeError(http.StatusBadRequest, err.Error())
+	}
+
+	filePath := doc.Versions[0].FilePath
+	if err := x.store.Put(ctx, filePath, envelope.Version.Content); err != nil {
+		return exchangeError(http.StatusInternalServerError, "failed to store received content")
+	}
+
+	if err := x.repo.Save(ctx, doc); err != nil {
+		if err := x.store.Delete(ctx, filePath); err != nil {
+			fmt.Printf("Warning: content of unsaved received document %s not deleted: %v\n", doc.ID, err)
+		}
+		// The same envelope was received concurrently
+		if stderrors.Is(err, errors.ErrConflict) {
+			if existing, err := x.repo.FindByExchangeID(ctx, envelope.OriginAgency, envelope.ExchangeID); err == nil {
+				return x.receivedAgain(&envelope, existing)
+			}
+		}
+		return exchangeError(http.StatusInternalServerError, "failed to store received document")
+	}
+
+	receipt := x.receipt(doc)
+
+	if x.bus != nil {
+		event := events.NewEvent("document.exchange.received", "document", map[string]any{
+			"document_id":        doc.ID,
+			"exchange_id":        envelope.ExchangeID,
+			"origin_agency":      envelope.OriginAgency,
+			"origin_document_id": envelope.Document.ID,
+			"content_hash":       receipt.ContentHash,
+		}).WithActor(types.ID(""), "external", x.agencyID).WithCorrelation(req.ID)
+		x.bus.Publish(ctx, event)
+	}
+
+	body, err := json.Marshal(receipt)
+	if err != nil {
+		return exchangeError(http.StatusInternalServerError, "failed to encode delivery receipt")
+	}
+
+	return http.StatusCreated, body
+}
+
+// receivedAgain answers an envelope whose exchange was already received with
+// the receipt of the document it delivered. Reusing an exchange ID for other
+// content is refused.
+func (x *Exchanger) receivedAgain(envelope *ExchangeEnvelope, doc *Document) (int, []byte) {
+	if doc.Provenance.OriginDocumentID != envelope.Document.ID || doc.Provenance.ContentHash != envelope.Version.FileHash {
+		return exchangeError(http.StatusConflict, "exchange ID was already used for other content")
+	}
+
+	body, err := json.Marshal(x.receipt(doc))
+	if err != nil {
+		return exchangeError(http.StatusInternalServerError, "failed to encode delivery receipt")
+	}
+
+	return http.StatusOK, body
+}
+
+// receipt creates the signed delivery receipt of a received document
+func (x *Exchanger) receipt(doc *Document) *DeliveryReceipt {
+	receipt := &DeliveryReceipt{
+		ExchangeID:             doc.Provenance.ExchangeID,
+		OriginAgency:           doc.Provenance.OriginAgency,
+		ReceiverAgency:         x.gateway.AgencyCode(),
+		OriginDocumentID:       doc.Provenance.OriginDocumentID,
+		ReceivedDocumentID:     doc.ID,
+		ReceivedDocumentNumber: doc.DocumentNumber,
+		ContentHash:            doc.Provenance.ContentHash,
+		ReceivedAt:             doc.Provenance.ReceivedAt,
+	}
+	receipt.Signature = x.gateway.SignPayload(receipt.SigningPayload())
+	return receipt
+}
+
+func exchangeError(status int, message string) (int, []byte) {
+	body, _ := json.Marshal(map[string]string{"error": message})
+	return status, body
+}
+
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -1,6 +1,7 @@
 package document
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -65,6 +66,19 @@ type Document struct {
 	// Sharing
 	SharedWith []types.ID `json:"shared_with,omitempty"`
 
+	// Public verification code (issued when the document is fully signed)
+	VerificationCode string `json:"verification_code,omitempty"`
+
+	// Provenance (set for documents received from another agency)
+	Provenance *DocumentProvenance `json:"provenance,omitempty"`
+
+	// Redaction (set on redacted copies; RequiresRedaction is set on their original)
+	Redaction         *RedactionInfo `json:"redaction,omitempty"`
+	RequiresRedaction bool           `json:"requires_redaction,omitempty"`
+
+	// Legal hold blocks deletion, voiding and disposition
+	LegalHold *types.LegalHold `json:"legal_hold,omitempty"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -133,6 +147,7 @@ func (d *Document) AddVersion(filePath, mimeType string, fileSize int64, content
 
 	// Reset signatures when new version is added
 	d.Signatures = []Signature{}
+	d.VerificationCode = ""
 	if d.Status == DocumentStatusSigned || d.Status == DocumentStatusPartiallySigned {
 		d.Status = DocumentStatusDraft
 	}
@@ -140,6 +155,19 @@ func (d *Document) AddVersion(filePath, mimeType string, fileSize int64, content
 	return &version, nil
 }
 
+// AddTemplateVersion adds a version generated from a template revision
+func (d *Document) AddTemplateVersion(filePath, mimeType string, content []byte, createdBy, templateID types.ID, templateRevision int, changeSummary string) (*DocumentVersion, error) {
+	if _, err := d.AddVersion(filePath, mimeType, int64(len(content)), bytes.NewReader(content), createdBy, changeSummary); err != nil {
+		return nil, err
+	}
+
+	version := &d.Versions[len(d.Versions)-1]
+	version.TemplateID = &templateID
+	version.TemplateRevision = &templateRevision
+
+	return version, nil
+}
+
 // RequestSignature requests a signature from a worker
 func (d *Document) RequestSignature(signerID, signerAgencyID, requestedBy types.ID, sigType SignatureType, deadline *time.Time, reason, location string) (*Signature, error) {
 	if d.CurrentVersion == 0 {
@@ -211,6 +239,13 @@ func (d *Document) Sign(signerID types.ID, signatureData, certificate, timestamp
 
 	if allSigned {
 		d.Status = DocumentStatusSigned
+		if d.VerificationCode == "" {
+			code, err := NewVerificationCode()
+			if err != nil {
+				return fmt.Errorf("failed to generate verification code: %w", err)
+			}
+			d.VerificationCode = code
+		}
 	} else {
 		d.Status = DocumentStatusPartiallySigned
 	}
@@ -240,6 +275,9 @@ func (d *Document) Share(agencyID types.ID) error {
 	if agencyID == d.OwnerAgencyID {
 		return fmt.Errorf("cannot share with owner agency")
 	}
+	if d.RequiresRedaction {
+		return fmt.Errorf("document has redacted copies; share a redacted copy instead")
+	}
 
 	for _, id := range d.SharedWith {
 		if id == agencyID {
@@ -270,6 +308,9 @@ func (d *Document) Void() error {
 	if d.Status == DocumentStatusArchived {
 		return fmt.Errorf("cannot void archived document")
 	}
+	if d.LegalHold != nil {
+		return fmt.Errorf("cannot void document under legal hold")
+	}
 
 	d.Status = DocumentStatusVoid
 	d.UpdatedAt = time.Now()
@@ -277,12 +318,54 @@ func (d *Document) Void() error {
 	return nil
 }
 
+// CanDelete checks if the document may be deleted. Only drafts can be
+// deleted; other documents are official records that are disposed of
+// under their retention schedule.
+func (d *Document) CanDelete() error {
+	if d.LegalHold != nil {
+		return fmt.Errorf("cannot delete document under legal hold")
+	}
+	if d.Status != DocumentStatusDraft {
+		return fmt.Errorf("only draft documents can be deleted; %s documents are disposed of under their retention schedule", d.Status)
+	}
+	return nil
+}
+
+// PlaceLegalHold places the document under legal hold
+func (d *Document) PlaceLegalHold(hold *types.LegalHold) error {
+	if d.LegalHold != nil {
+		return fmt.Errorf("document is already under legal hold")
+	}
+
+	d.LegalHold = hold
+	d.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// ReleaseLegalHold releases the legal hold on the document
+func (d *Document) ReleaseLegalHold() error {
+	if d.LegalHold == nil {
+		return fmt.Errorf("document is not under legal hold")
+	}
+
+	d.LegalHold = nil
+	d.UpdatedAt = time.Now()
+
+	return nil
+}
+
 // CanAccess checks if an agency can access the document
 func (d *Document) CanAccess(agencyID types.ID) bool {
 	if agencyID == d.OwnerAgencyID {
 		return true
 	}
 
+	// Agencies with shared access receive redacted copies instead of the original
+	if d.RequiresRedaction {
+		return false
+	}
+
 	for _, id := range d.SharedWith {
 		if id == agencyID {
 			return true
@@ -304,6 +387,10 @@ type DocumentVersion struct {
 	CreatedAt     time.Time `json:"created_at"`
 	CreatedBy     types.ID  `json:"created_by"`
 	ChangeSummary string    `json:"change_summary,omitempty"`
+
+	// Template used to generate this version (nil for uploaded content)
+	TemplateID       *types.ID `json:"template_id,omitempty"`
+	TemplateRevision *int      `json:"template_revision,omitempty"`
 }
 
 // SignatureType defines the type of signature
@@ -323,6 +410,9 @@ const (
 	SignatureStatusSigned   SignatureStatus = "signed"
 	SignatureStatusRejected SignatureStatus = "rejected"
 	SignatureStatusRevoked  SignatureStatus = "revoked"
+
+	// A signature received from another agency that could not be verified
+	SignatureStatusUnverified SignatureStatus = "unverified"
 )
 
 // Signature represents a signature on a document
@@ -385,10 +475,33 @@ type RequestSignatureRequest struct {
 	Location       string        `json:"location,omitempty"`
 }
 
+type SignDocumentRequest struct {
+	SignatureData  []byte `json:"signature_data"`            // base64-encoded signature over the SHA-256 content hash
+	Certificate    []byte `json:"certificate"`               // PEM or DER signing certificate
+	TimestampToken []byte `json:"timestamp_token,omitempty"` // RFC 3161 token over the signature
+}
+
 type ShareDocumentRequest struct {
 	AgencyID types.ID `json:"agency_id"`
 }
 
+type ExchangeDocumentRequest struct {
+	TargetAgency string `json:"target_agency"`
+	Version      int    `json:"version,omitempty"` // defaults to current version
+	Content      []byte `json:"content"`           // base64-encoded file content
+}
+
+type CreateRedactionRequest struct {
+	Version    int         `json:"version,omitempty"` // defaults to current version
+	Redactions []Redaction `json:"redactions"`
+	ShareWith  []types.ID  `json:"share_with,omitempty"` // in addition to agencies the original was shared with
+}
+
+type LegalHoldRequest struct {
+	Reason    string `json:"reason"`
+	Reference string `json:"reference,omitempty"`
+}
+
 type ListDocumentsFilter struct {
 	Type      *DocumentType   `json:"type,omitempty"`
 	Status    *DocumentStatus `json:"status,omitempty"`
@@ -0,0 +1,244 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/serbia-gov/platform/internal/privacy"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// RedactionMarker replaces every redacted region in a redacted copy
+const RedactionMarker = "[REDACTED]"
+
+// Redaction specifies a region to remove from a document version: either a
+// byte range [Start, End) of the extracted text or every occurrence of Text
+type Redaction struct {
+	Start  int    `json:"start,omitempty"`
+	End    int    `json:"end,omitempty"`
+	Text   string `json:"text,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// RedactedRegion records a removed region of the original text.
+// The removed text itself is never stored with the copy.
+type RedactedRegion struct {
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Reason string `json:"reason"`
+}
+
+// RedactionInfo links a redacted copy to the unredacted original
+type RedactionInfo struct {
+	OriginalDocumentID types.ID         `json:"original_document_id"`
+	OriginalVersion    int              `json:"original_version"`
+	OriginalHash       string           `json:"original_hash"`
+	Regions            []RedactedRegion `json:"regions"`
+	RedactedBy         types.ID         `json:"redacted_by"`
+	RedactedAt         time.Time        `json:"redacted_at"`
+}
+
+// RedactionSuggestion is a region proposed for redaction because it contains PII
+type RedactionSuggestion struct {
+	Redaction
+	Field       privacy.PIIField `json:"field"`
+	MaskedValue string           `json:"masked_value"`
+}
+
+// PIIScanner detects personal data in text (implemented by privacy.PrivacyGuard)
+type PIIScanner interface {
+	ScanForPII(content string) []privacy.PIIField
+	FindPII(content string, fields ...privacy.PIIField) []privacy.PIIMatch
+}
+
+// ExtractText returns the text of a version that can be redacted.
+// Only text-based formats are supported; binary formats (PDF, images)
+// have to be converted to text before they can be redacted.
+func ExtractText(mimeType string, content []byte) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return "", fmt.Errorf("invalid content type: %s", mimeType)
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json",
+		mediaType == "application/xml",
+		mediaType == "application/xhtml+xml":
+	default:
+		return "", fmt.Errorf("redaction is not supported for %s content", mediaType)
+	}
+
+	if !utf8.Valid(content) {
+		return "", fmt.Errorf("content is not valid UTF-8 text")
+	}
+
+	return string(content), nil
+}
+
+// SuggestRedactions scans text for personal data and proposes regions to redact
+func SuggestRedactions(scanner PIIScanner, text string) ([]privacy.PIIField, []RedactionSuggestion) {
+	fields := scanner.ScanForPII(text)
+	if len(fields) == 0 {
+		return fields, nil
+	}
+
+	var suggestions []RedactionSuggestion
+	for _, m := range scanner.FindPII(text, fields...) {
+		suggestions = append(suggestions, RedactionSuggestion{
+			Redaction: Redaction{
+				Start:  m.Start,
+				End:    m.End,
+				Reason: "pii:" + string(m.Field),
+			},
+			Field:       m.Field,
+			MaskedValue: m.MaskedValue,
+		})
+	}
+
+	return fields, suggestions
+}
+
+// ApplyRedactions replaces the requested regions of text with RedactionMarker.
+// Overlapping regions are merged. It returns the redacted text and the
+// regions removed, in original text offsets.
+func ApplyRedactions(text string, redactions []Redaction) (string, []RedactedRegion, error) {
+	if len(redactions) == 0 {
+		return "", nil, fmt.Errorf("at least one redaction is required")
+	}
+
+	var regions []RedactedRegion
+	for i, r := range redactions {
+		if r.Reason == "" {
+			return "", nil, fmt.Errorf("redaction %d: reason is required", i)
+		}
+
+		if r.Text != "" {
+			found := false
+			for offset := 0; ; {
+				idx := strings.Index(text[offset:], r.Text)
+				if idx < 0 {
+					break
+				}
+				start := offset + idx
+				regions = append(regions, RedactedRegion{Start: start, End: start + len(r.Text), Reason: r.Reason})
+				offset = start + len(r.Text)
+				found = true
+			}
+			if !found {
+				return "", nil, fmt.Errorf("redaction %d: text not found", i)
+			}
+			continue
+		}
+
+		if r.Start < 0 || r.End <= r.Start || r.End > len(text) {
+			return "", nil, fmt.Errorf("redaction %d: invalid range [%d, %d)", i, r.Start, r.End)
+		}
+		if !utf8.RuneStart(text[r.Start]) || (r.End < len(text) && !utf8.RuneStart(text[r.End])) {
+			return "", nil, fmt.Errorf("redaction %d: range splits a character", i)
+		}
+		regions = append(regions, RedactedRegion{Start: r.Start, End: r.End, Reason: r.Reason})
+	}
+
+	sort.Slice(regions, func(i, j int) bool { return regions[i].Start < regions[j].Start })
+
+	merged := regions[:1]
+	for _, r := range regions[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start > last.End {
+			merged = append(merged, r)
+			continue
+		}
+		last.End = max(last.End, r.End)
+		if !strings.Contains(last.Reason, r.Reason) {
+			last.Reason += ", " + r.Reason
+		}
+	}
+
+	var b strings.Builder
+	prev := 0
+	for _, r := range merged {
+		b.WriteString(text[prev:r.Start])
+		b.WriteString(RedactionMarker)
+		prev = r.End
+	}
+	b.WriteString(text[prev:])
+
+	return b.String(), merged, nil
+}
+
+// Redact creates a redacted copy of a version of the document. The copy is a
+// new draft document owned by the same agency, shared with the agencies the
+// original was shared with. From then on only the owner can read the original.
+func (d *Document) Redact(version int, content []byte, redactions []Redaction, redactedBy types.ID) (*Document, []byte, error) {
+	if d.Status == DocumentStatusVoid {
+		return nil, nil, fmt.Errorf("cannot redact void document")
+	}
+
+	var source *DocumentVersion
+	for i := range d.Versions {
+		if d.Versions[i].Version == version {
+			source = &d.Versions[i]
+			break
+		}
+	}
+	if source == nil {
+		return nil, nil, fmt.Errorf("version %d not found", version)
+	}
+	if hashContent(content) != source.FileHash {
+		return nil, nil, fmt.Errorf("content does not match version %d hash", version)
+	}
+
+	text, err := ExtractText(source.MimeType, content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	redacted, regions, err := ApplyRedactions(text, redactions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	redactedCopy, err := NewDocument(d.Type, d.Title+" "+RedactionMarker, d.Description, d.OwnerAgencyID, redactedBy, d.CaseID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := []byte(redacted)
+	filePath := fmt.Sprintf("documents/%s/v1%s", redactedCopy.ID, path.Ext(source.FilePath))
+	summary := fmt.Sprintf("Redacted copy of %s version %d", d.DocumentNumber, version)
+	if _, err := redactedCopy.AddVersion(filePath, source.MimeType, int64(len(out)), bytes.NewReader(out), redactedBy, summary); err != nil {
+		return nil, nil, err
+	}
+
+	redactedCopy.Redaction = &RedactionInfo{
+		OriginalDocumentID: d.ID,
+		OriginalVersion:    version,
+		OriginalHash:       source.FileHash,
+		Regions:            regions,
+		RedactedBy:         redactedBy,
+		RedactedAt:         time.Now(),
+	}
+	redactedCopy.SharedWith = append(redactedCopy.SharedWith, d.SharedWith...)
+
+	d.RequiresRedaction = true
+	d.UpdatedAt = time.Now()
+
+	return redactedCopy, out, nil
+}
+
+// isSharedWith checks if the document was shared with an agency
+func (d *Document) isSharedWith(agencyID types.ID) bool {
+	for _, id := range d.SharedWith {
+		if id == agencyID {
+			return true
+		}
+	}
+	return false
+}
@@ -2,15 +2,33 @@ package document
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/serbia-gov/platform/internal/shared/errors"
 	"github.com/serbia-gov/platform/internal/shared/types"
+	"github.com/serbia-gov/platform/internal/tsa"
 )
 
+// DocumentRepository stores documents for the handlers and the exchanger
+// (implemented by Repository)
+type DocumentRepository interface {
+	Save(ctx context.Context, d *Document) error
+	FindByID(ctx context.Context, id types.ID) (*Document, error)
+	FindByVerificationCode(ctx context.Context, code string) (*Document, error)
+	FindByExchangeID(ctx context.Context, originAgency, exchangeID string) (*Document, error)
+	FindRedactedCopies(ctx context.Context, originalID types.ID) ([]Document, error)
+	List(ctx context.Context, filter ListDocumentsFilter) ([]Document, int, error)
+	Update(ctx context.Context, d *Document) error
+	Delete(ctx context.Context, id types.ID) error
+	AddSignature(ctx context.Context, s *Signature) error
+	UpdateSignature(ctx context.Context, s *Signature) error
+}
+
 // Repository provides database operations for documents
 type Repository struct {
 	pool *pgxpool.Pool
@@ -33,18 +51,28 @@ func (r *Repository) Save(ctx context.Context, d *Document) error {
 		INSERT INTO documents.documents (
 			id, document_number, type, status, title, description,
 			owner_agency_id, created_by, case_id,
-			current_version, shared_with,
+			current_version, shared_with, provenance, verification_code,
+			redacted_from, redaction, requires_redaction, legal_hold,
 			created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`
+
+	var redactedFrom *types.ID
+	if d.Redaction != nil {
+		redactedFrom = &d.Redaction.OriginalDocumentID
+	}
 
 	_, err = tx.Exec(ctx, query,
 		d.ID, d.DocumentNumber, d.Type, d.Status, d.Title, d.Description,
 		d.OwnerAgencyID, d.CreatedBy, d.CaseID,
-		d.CurrentVersion, d.SharedWith,
+		d.CurrentVersion, d.SharedWith, d.Provenance, nullableString(d.VerificationCode),
+		redactedFrom, d.Redaction, d.RequiresRedaction, d.LegalHold,
 		d.CreatedAt, d.UpdatedAt,
 	)
 
 	if err != nil {
+		if strings.Contains(err.Error(), "idx_documents_exchange_id") {
+			return errors.Conflict("document exchange already received")
+		}
 		if strings.Contains(err.Error(), "duplicate key") {
 			return errors.Conflict("document with this number already exists")
 		}
@@ -77,7 +105,8 @@ func (r *Repository) FindByID(ctx context.Context, id types.ID) (*Document, erro
 	query := `
 		SELECT id, document_number, type, status, title, description,
 			owner_agency_id, created_by, case_id,
-			current_version, shared_with,
+			current_version, shared_with, provenance, COALESCE(verification_code, ''),
+			redaction, requires_redaction, legal_hold,
 			created_at, updated_at
 		FROM documents.documents
 		WHERE id = $1`
@@ -86,7 +115,8 @@ func (r *Repository) FindByID(ctx context.Context, id types.ID) (*Document, erro
 	err := r.pool.QueryRow(ctx, query, id).Scan(
 		&d.ID, &d.DocumentNumber, &d.Type, &d.Status, &d.Title, &d.Description,
 		&d.OwnerAgencyID, &d.CreatedBy, &d.CaseID,
-		&d.CurrentVersion, &d.SharedWith,
+		&d.CurrentVersion, &d.SharedWith, &d.Provenance, &d.VerificationCode,
+		&d.Redaction, &d.RequiresRedaction, &d.LegalHold,
 		&d.CreatedAt, &d.UpdatedAt,
 	)
 
@@ -114,17 +144,56 @@ func (r *Repository) FindByID(ctx context.Context, id types.ID) (*Document, erro
 	return d, nil
 }
 
+// FindByVerificationCode finds a document by its public verification code
+func (r *Repository) FindByVerificationCode(ctx context.Context, code string) (*Document, error) {
+	var id types.ID
+	err := r.pool.QueryRow(ctx,
+		`SELECT id FROM documents.documents WHERE verification_code = $1`, code,
+	).Scan(&id)
+
+	if err == pgx.ErrNoRows {
+		return nil, errors.NotFound("document", code)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find document by verification code")
+	}
+
+	return r.FindByID(ctx, id)
+}
+
+// FindByExchangeID finds the document received from originAgency in an exchange
+func (r *Repository) FindByExchangeID(ctx context.Context, originAgency, exchangeID string) (*Document, error) {
+	var id types.ID
+	err := r.pool.QueryRow(ctx, `
+		SELECT id FROM documents.documents
+		WHERE provenance IS NOT NULL
+			AND provenance->>'origin_agency' = $1 AND provenance->>'exchange_id' = $2`,
+		originAgency, exchangeID,
+	).Scan(&id)
+
+	if err == pgx.ErrNoRows {
+		return nil, errors.NotFound("document exchange", exchangeID)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find document by exchange ID")
+	}
+
+	return r.FindByID(ctx, id)
+}
+
 // Update updates a document
 func (r *Repository) Update(ctx context.Context, d *Document) error {
 	query := `
 		UPDATE documents.documents SET
 			status = $2, title = $3, description = $4,
-			current_version = $5, shared_with = $6, updated_at = $7
+			current_version = $5, shared_with = $6, verification_code = $7,
+			requires_redaction = $8, legal_hold = $9, updated_at = $10
 		WHERE id = $1`
 
 	result, err := r.pool.Exec(ctx, query,
 		d.ID, d.Status, d.Title, d.Description,
-		d.CurrentVersion, d.SharedWith, d.UpdatedAt,
+		d.CurrentVersion, d.SharedWith, nullableString(d.VerificationCode),
+		d.RequiresRedaction, d.LegalHold, d.UpdatedAt,
 	)
 
 	if err != nil {
@@ -138,14 +207,26 @@ func (r *Repository) Update(ctx context.Context, d *Document) error {
 	return nil
 }
 
-// Delete deletes a document
+// Delete deletes a draft document that is not under legal hold
 func (r *Repository) Delete(ctx context.Context, id types.ID) error {
-	result, err := r.pool.Exec(ctx, `DELETE FROM documents.documents WHERE id = $1`, id)
+	// The conditions of CanDelete are repeated here, so that a legal hold
+	// placed after the check is not deleted through
+	result, err := r.pool.Exec(ctx, `
+		DELETE FROM documents.documents
+		WHERE id = $1 AND legal_hold IS NULL AND status = $2
+	`, id, DocumentStatusDraft)
 	if err != nil {
 		return errors.Wrap(err, "failed to delete document")
 	}
 
 	if result.RowsAffected() == 0 {
+		var exists bool
+		if err := r.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM documents.documents WHERE id = $1)`, id).Scan(&exists); err != nil {
+			return errors.Wrap(err, "failed to delete document")
+		}
+		if exists {
+			return errors.Conflict("document is under legal hold or no longer a draft")
+		}
 		return errors.NotFound("document", id.String())
 	}
 
@@ -203,7 +284,8 @@ func (r *Repository) List(ctx context.Context, filter ListDocumentsFilter) ([]Do
 	query := fmt.Sprintf(`
 		SELECT id, document_number, type, status, title, description,
 			owner_agency_id, created_by, case_id,
-			current_version, shared_with,
+			current_version, shared_with, provenance, COALESCE(verification_code, ''),
+			redaction, requires_redaction, legal_hold,
 			created_at, updated_at
 		FROM documents.documents
 		%s
@@ -224,7 +306,8 @@ func (r *Repository) List(ctx context.Context, filter ListDocumentsFilter) ([]Do
 		err := rows.Scan(
 			&d.ID, &d.DocumentNumber, &d.Type, &d.Status, &d.Title, &d.Description,
 			&d.OwnerAgencyID, &d.CreatedBy, &d.CaseID,
-			&d.CurrentVersion, &d.SharedWith,
+			&d.CurrentVersion, &d.SharedWith, &d.Provenance, &d.VerificationCode,
+			&d.Redaction, &d.RequiresRedaction, &d.LegalHold,
 			&d.CreatedAt, &d.UpdatedAt,
 		)
 		if err != nil {
@@ -244,16 +327,50 @@ func (r *Repository) FindByCase(ctx context.Context, caseID types.ID, filter Lis
 
 // --- Version operations ---
 
+// FindRedactedCopies finds the redacted copies derived from an original document
+func (r *Repository) FindRedactedCopies(ctx context.Context, originalID types.ID) ([]Document, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id FROM documents.documents WHERE redacted_from = $1 ORDER BY created_at DESC`, originalID,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find redacted copies")
+	}
+
+	var ids []types.ID
+	for rows.Next() {
+		var id types.ID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, errors.Wrap(err, "failed to scan redacted copy")
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	copies := make([]Document, 0, len(ids))
+	for _, id := range ids {
+		d, err := r.FindByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		copies = append(copies, *d)
+	}
+
+	return copies, nil
+}
+
 func (r *Repository) saveVersion(ctx context.Context, tx pgx.Tx, v *DocumentVersion) error {
 	query := `
 		INSERT INTO documents.versions (
 			id, document_id, version, file_path, file_hash,
-			file_size, mime_type, created_at, created_by, change_summary
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+			file_size, mime_type, created_at, created_by, change_summary,
+			template_id, template_revision
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
 
 	_, err := tx.Exec(ctx, query,
 		v.ID, v.DocumentID, v.Version, v.FilePath, v.FileHash,
 		v.FileSize, v.MimeType, v.CreatedAt, v.CreatedBy, v.ChangeSummary,
+		v.TemplateID, v.TemplateRevision,
 	)
 
 	if err != nil {
@@ -268,12 +385,14 @@ func (r *Repository) AddVersion(ctx context.Context, v *DocumentVersion) error {
 	query := `
 		INSERT INTO documents.versions (
 			id, document_id, version, file_path, file_hash,
-			file_size, mime_type, created_at, created_by, change_summary
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+			file_size, mime_type, created_at, created_by, change_summary,
+			template_id, template_revision
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
 
 	_, err := r.pool.Exec(ctx, query,
 		v.ID, v.DocumentID, v.Version, v.FilePath, v.FileHash,
 		v.FileSize, v.MimeType, v.CreatedAt, v.CreatedBy, v.ChangeSummary,
+		v.TemplateID, v.TemplateRevision,
 	)
 
 	if err != nil {
@@ -286,7 +405,8 @@ func (r *Repository) AddVersion(ctx context.Context, v *DocumentVersion) error {
 func (r *Repository) getVersions(ctx context.Context, documentID types.ID) ([]DocumentVersion, error) {
 	query := `
 		SELECT id, document_id, version, file_path, file_hash,
-			file_size, mime_type, created_at, created_by, change_summary
+			file_size, mime_type, created_at, created_by, change_summary,
+			template_id, template_revision
 		FROM documents.versions
 		WHERE document_id = $1
 		ORDER BY version DESC`
@@ -303,6 +423,7 @@ func (r *Repository) getVersions(ctx context.Context, documentID types.ID) ([]Do
 		err := rows.Scan(
 			&v.ID, &v.DocumentID, &v.Version, &v.FilePath, &v.FileHash,
 			&v.FileSize, &v.MimeType, &v.CreatedAt, &v.CreatedBy, &v.ChangeSummary,
+			&v.TemplateID, &v.TemplateRevision,
 		)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to scan version")
@@ -411,3 +532,43 @@ func (r *Repository) getSignatures(ctx context.Context, documentID types.ID) ([]
 
 	return signatures, nil
 }
+
+// ArchiveObjects lists signed signatures for archive timestamping
+// (tsa.ArchiveSource), oldest first. The object is the SHA-256 hash of the
+// signature data; signatures without data have nothing to protect.
+func (r *Repository) ArchiveObjects(ctx context.Context, after time.Time, limit int) ([]tsa.ArchiveObject, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, signature_data, signed_at
+		FROM documents.signatures
+		WHERE status = $1 AND signature_data IS NOT NULL AND signed_at >= $2
+		ORDER BY signed_at, id
+		LIMIT $3`, SignatureStatusSigned, after, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list signatures")
+	}
+	defer rows.Close()
+
+	objects := []tsa.ArchiveObject{}
+	for rows.Next() {
+		var id types.ID
+		var data []byte
+		var signedAt time.Time
+		if err := rows.Scan(&id, &data, &signedAt); err != nil {
+			return nil, errors.Wrap(err, "failed to scan signature")
+		}
+		hash := sha256.Sum256(data)
+		objects = append(objects, tsa.ArchiveObject{
+			ID:        id.String(),
+			Hash:      hash[:],
+			CreatedAt: signedAt,
+		})
+	}
+	return objects, rows.Err()
+}
+
+func nullableString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
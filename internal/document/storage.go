@@ -0,0 +1,91 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ContentStore stores document version content addressed by DocumentVersion.FilePath
+type ContentStore interface {
+	Put(ctx context.Context, path string, content []byte) error
+	Get(ctx context.Context, path string) ([]byte, error)
+	Delete(ctx context.Context, path string) error
+}
+
+// FileStore is a ContentStore backed by a local directory (MinIO in production)
+type FileStore struct {
+	root string
+}
+
+// NewFileStore creates a file store rooted at the given directory
+func NewFileStore(root string) (*FileStore, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &FileStore{root: root}, nil
+}
+
+// Put writes content to path, refusing to overwrite existing content
+func (s *FileStore) Put(ctx context.Context, path string, content []byte) error {
+	full, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(full), 0o750); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	f, err := os.OpenFile(full, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(content); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return f.Sync()
+}
+
+// Get reads content stored at path
+func (s *FileStore) Get(ctx context.Context, path string) ([]byte, error) {
+	full, err := s.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(full)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return content, nil
+}
+
+// Delete removes content stored at path. Deleting missing content is not an error.
+func (s *FileStore) Delete(ctx context.Context, path string) error {
+	full, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	return nil
+}
+
+// resolve maps a storage path to a file below root, rejecting path traversal
+func (s *FileStore) resolve(path string) (string, error) {
+	clean := filepath.Clean("/" + path)
+	if strings.Contains(path, "..") || clean == "/" {
+		return "", fmt.Errorf("invalid storage path: %s", path)
+	}
+	return filepath.Join(s.root, clean), nil
+}
@@ -0,0 +1,372 @@
+package document
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/pem"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/serbia-gov/platform/internal/agency"
+	"github.com/serbia-gov/platform/internal/federation/trust"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/types"
+	"github.com/skip2/go-qrcode"
+)
+
+// verificationCodeEncoding avoids padding so codes are easy to type from paper
+var verificationCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewVerificationCode generates a random code in the form XXXX-XXXX-XXXX-XXXX
+func NewVerificationCode() (string, error) {
+	b := make([]byte, 10) // 80 bits -> 16 base32 characters
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return formatVerificationCode(verificationCodeEncoding.EncodeToString(b)), nil
+}
+
+// NormalizeVerificationCode converts user input (lowercase, spaces, missing dashes)
+// to the canonical XXXX-XXXX-XXXX-XXXX form
+func NormalizeVerificationCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return formatVerificationCode(code)
+}
+
+func formatVerificationCode(code string) string {
+	var groups []string
+	for len(code) > 4 {
+		groups = append(groups, code[:4])
+		code = code[4:]
+	}
+	groups = append(groups, code)
+	return strings.Join(groups, "-")
+}
+
+// VerificationURL returns the public URL where a verification code can be checked
+func VerificationURL(baseURL, code string) string {
+	return strings.TrimRight(baseURL, "/") + "/verify/" + code
+}
+
+// VerificationStamp holds what is printed on a document so third parties can verify it
+type VerificationStamp struct {
+	Code   string `json:"code"`
+	URL    string `json:"url"`
+	QRCode []byte `json:"-"` // PNG image encoding URL
+}
+
+// NewVerificationStamp creates the verification code text and QR code image for a document
+func NewVerificationStamp(baseURL, code string, size int) (*VerificationStamp, error) {
+	if code == "" {
+		return nil, fmt.Errorf("document has no verification code")
+	}
+
+	url := VerificationURL(baseURL, code)
+	png, err := qrcode.Encode(url, qrcode.Medium, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate QR code: %w", err)
+	}
+
+	return &VerificationStamp{Code: code, URL: url, QRCode: png}, nil
+}
+
+// PublicVerification is the result of a public authenticity check.
+// It deliberately omits title, description and signer identities so that
+// no personal content is revealed to whoever holds the code.
+type PublicVerification struct {
+	Code             string         `json:"code"`
+	IsValid          bool           `json:"is_valid"`
+	Status           DocumentStatus `json:"status"`
+	IssuerAgencyCode string         `json:"issuer_agency_code,omitempty"`
+	IssuerAgencyName string         `json:"issuer_agency_name,omitempty"`
+	DocumentType     DocumentType   `json:"document_type"`
+	DocumentNumber   string         `json:"document_number"`
+	IssuedAt         *time.Time     `json:"issued_at,omitempty"`
+	Version          int            `json:"version"`
+	HashAlgorithm    string         `json:"hash_algorithm"`
+	Hash             string         `json:"hash"`
+	SignatureCount   int            `json:"signature_count"`
+	SignaturesValid  bool           `json:"signatures_valid"`
+	Reason           string         `json:"reason,omitempty"`
+	VerifiedAt       time.Time      `json:"verified_at"`
+}
+
+// NewPublicVerification builds the public verification result for a document.
+// content is the stored content of the current version, or nil when it could
+// not be read; its hash must match the recorded one. Every signature on the
+// current version must verify over that hash with a certificate trusted by
+// certificates.
+func NewPublicVerification(d *Document, content []byte, certificates CertificateVerifier) *PublicVerification {
+	v := &PublicVerification{
+		Code:           d.VerificationCode,
+		Status:         d.Status,
+		DocumentType:   d.Type,
+		DocumentNumber: d.DocumentNumber,
+		Version:        d.CurrentVersion,
+		HashAlgorithm:  "SHA-256",
+		VerifiedAt:     time.Now().UTC(),
+	}
+
+	for _, ver := range d.Versions {
+		if ver.Version == d.CurrentVersion {
+			v.Hash = ver.FileHash
+			break
+		}
+	}
+
+	// All signatures on the current version must be complete and verify; the
+	// issue date is the moment the last signature was applied
+	v.SignaturesValid = true
+	for _, s := range d.Signatures {
+		if s.Version != d.CurrentVersion {
+			continue
+		}
+		v.SignatureCount++
+		if s.Status != SignatureStatusSigned || s.SignedAt == nil {
+			v.SignaturesValid = false
+			continue
+		}
+		if err := VerifySignature(certificates, &s, v.Hash); err != nil {
+			v.SignaturesValid = false
+			continue
+		}
+		if v.IssuedAt == nil || s.SignedAt.After(*v.IssuedAt) {
+			signedAt := *s.SignedAt
+			v.IssuedAt = &signedAt
+		}
+	}
+	if v.SignatureCount == 0 {
+		v.SignaturesValid = false
+	}
+
+	switch {
+	case d.Status == DocumentStatusVoid:
+		v.Reason = "Document has been voided"
+	case d.Status != DocumentStatusSigned && d.Status != DocumentStatusArchived:
+		v.Reason = "Document is not signed"
+	case v.Hash == "":
+		v.Reason = "Document has no content hash"
+	case content == nil:
+		v.Reason = "Document content could not be checked"
+	case hashContent(content) != v.Hash:
+		v.Reason = "Document content does not match its hash"
+	case !v.SignaturesValid:
+		v.Reason = "Document signatures are incomplete or invalid"
+	default:
+		v.IsValid = true
+	}
+
+	return v
+}
+
+// CertificateChecker checks whether a certificate was revoked at a point in time
+type CertificateChecker interface {
+	Check(ctx context.Context, cert *x509.Certificate, at time.Time) error
+}
+
+// CheckSignatureCertificates invalidates a verification when a federation
+// certificate that signed the current version was revoked before it signed.
+// Certificates of other issuers are left to their own validation.
+func CheckSignatureCertificates(ctx context.Context, checker CertificateChecker, d *Document, v *PublicVerification) {
+	if !v.IsValid {
+		return
+	}
+
+	for _, s := range d.Signatures {
+		if s.Version != d.CurrentVersion || len(s.Certificate) == 0 || s.SignedAt == nil {
+			continue
+		}
+		cert, err := parseSignatureCertificate(s.Certificate)
+		if err != nil {
+			v.IsValid = false
+			v.SignaturesValid = false
+			v.Reason = "Document signature certificate is invalid"
+			return
+		}
+
+		err = checker.Check(ctx, cert, *s.SignedAt)
+		switch {
+		case err == nil, stderrors.Is(err, trust.ErrUnknownIssuer):
+			continue
+		case stderrors.Is(err, trust.ErrCertificateRevoked):
+			v.IsValid = false
+			v.SignaturesValid = false
+			v.Reason = "Document signature certificate has been revoked"
+		default:
+			v.IsValid = false
+			v.Reason = "Document signature certificate status could not be checked"
+		}
+		return
+	}
+}
+
+// CertificateVerifier verifies that a signing certificate chains to a
+// trusted root and returns it
+type CertificateVerifier interface {
+	VerifyChain(certPEM []byte) (*x509.Certificate, error)
+}
+
+// VerifySignature verifies a completed signature over the version with
+// fileHash: SignatureData must be made over the SHA-256 content hash with
+// the key of the signature's certificate, and the certificate must chain
+// to a root trusted by verifier.
+func VerifySignature(verifier CertificateVerifier, s *Signature, fileHash string) error {
+	if len(s.SignatureData) == 0 {
+		return fmt.Errorf("signature has no signature data")
+	}
+	if len(s.Certificate) == 0 {
+		return fmt.Errorf("signature has no certificate")
+	}
+	if verifier == nil {
+		return fmt.Errorf("no certificate verifier configured")
+	}
+
+	digest, err := hex.DecodeString(fileHash)
+	if err != nil || len(digest) != sha256.Size {
+		return fmt.Errorf("invalid content hash")
+	}
+
+	cert, err := parseSignatureCertificate(s.Certificate)
+	if err != nil {
+		return fmt.Errorf("invalid signing certificate: %w", err)
+	}
+	if _, err := verifier.VerifyChain(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})); err != nil {
+		return fmt.Errorf("signing certificate is not trusted: %w", err)
+	}
+
+	switch pub := cert.PublicKey.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, digest, s.SignatureData) {
+			return fmt.Errorf("signature does not match content hash")
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, s.SignatureData) {
+			return fmt.Errorf("signature does not match content hash")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, s.SignatureData); err != nil {
+			return fmt.Errorf("signature does not match content hash")
+		}
+	default:
+		return fmt.Errorf("unsupported signing key type %T", cert.PublicKey)
+	}
+
+	return nil
+}
+
+// parseSignatureCertificate parses a PEM or DER signing certificate
+func parseSignatureCertificate(data []byte) (*x509.Certificate, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		return x509.ParseCertificate(block.Bytes)
+	}
+	return x509.ParseCertificate(data)
+}
+
+// IssuerDirectory resolves the agency that issued a document
+type IssuerDirectory interface {
+	GetAgency(ctx context.Context, id types.ID) (*agency.Agency, error)
+}
+
+// PublicVerifyHandler serves the unauthenticated document authenticity check
+type PublicVerifyHandler struct {
+	repo         DocumentRepository
+	agencies     IssuerDirectory
+	store        ContentStore        // nil fails every check
+	chains       CertificateVerifier // nil fails every signature
+	certificates CertificateChecker
+}
+
+// NewPublicVerifyHandler creates a new public verification handler
+func NewPublicVerifyHandler(repo DocumentRepository, agencies IssuerDirectory) *PublicVerifyHandler {
+	return &PublicVerifyHandler{repo: repo, agencies: agencies}
+}
+
+// SetContentStore sets where the content whose hash is checked is read from
+func (h *PublicVerifyHandler) SetContentStore(store ContentStore) {
+	h.store = store
+}
+
+// SetCertificateVerifier sets what verifies that signing certificates chain
+// to a trusted root
+func (h *PublicVerifyHandler) SetCertificateVerifier(chains CertificateVerifier) {
+	h.chains = chains
+}
+
+// SetCertificateChecker enables revocation checks of signing certificates
+func (h *PublicVerifyHandler) SetCertificateChecker(checker CertificateChecker) {
+	h.certificates = checker
+}
+
+// Routes registers the public verification routes
+func (h *PublicVerifyHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/{code}", h.Verify)
+
+	return r
+}
+
+// Verify checks a verification code and returns non-personal document facts
+func (h *PublicVerifyHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	code := NormalizeVerificationCode(chi.URLParam(r, "code"))
+	if len(code) != 19 {
+		writeError(w, errors.BadRequest("invalid verification code"))
+		return
+	}
+
+	doc, err := h.repo.FindByVerificationCode(r.Context(), code)
+	if err != nil {
+		// Do not distinguish storage errors from unknown codes
+		writeError(w, errors.NotFound("verification code", code))
+		return
+	}
+
+	verification := NewPublicVerification(doc, h.currentContent(r.Context(), doc), h.chains)
+	if h.certificates != nil {
+		CheckSignatureCertificates(r.Context(), h.certificates, doc, verification)
+	}
+
+	if doc.Provenance != nil {
+		verification.IssuerAgencyCode = doc.Provenance.OriginAgency
+	} else if h.agencies != nil {
+		if issuer, err := h.agencies.GetAgency(r.Context(), doc.OwnerAgencyID); err == nil {
+			verification.IssuerAgencyCode = issuer.Code
+			verification.IssuerAgencyName = issuer.Name
+		}
+	}
+
+	writeJSON(w, http.StatusOK, verification)
+}
+
+// currentContent reads the stored content of the current version, or returns
+// nil when it cannot be read
+func (h *PublicVerifyHandler) currentContent(ctx context.Context, d *Document) []byte {
+	if h.store == nil {
+		return nil
+	}
+	for _, ver := range d.Versions {
+		if ver.Version != d.CurrentVersion {
+			continue
+		}
+		content, err := h.store.Get(ctx, ver.FilePath)
+		if err != nil {
+			fmt.Printf("Warning: content of document %s v%d not read for verification: %v\n", d.ID, ver.Version, err)
+			return nil
+		}
+		return content
+	}
+	return nil
+}
@@ -1,32 +1,112 @@
 package gateway
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"io"
 	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/serbia-gov/platform/internal/federation/trust"
+	"github.com/serbia-gov/platform/internal/shared/auth"
 	"github.com/serbia-gov/platform/internal/shared/errors"
 	"github.com/serbia-gov/platform/internal/shared/events"
+	"github.com/serbia-gov/platform/internal/shared/metrics"
 )
 
+// Error codes of rejected incoming requests, also the status label of the
+// inbound federation request metric
+const (
+	CodeReplayedRequest = "REPLAYED_REQUEST"
+	CodeClockSkew       = "CLOCK_SKEW"
+	CodeBodyTooLarge    = "BODY_TOO_LARGE"
+)
+
+// GatewayPathPrefix is where the gateway's own routes are mounted. Requests
+// received over federation are never forwarded there, so that a remote
+// agency cannot make this gateway sign requests to other agencies.
+const GatewayPathPrefix = "/federation/gateway"
+
+// ErrGatewayRoute is returned when a gateway route is registered as a
+// federated route
+var ErrGatewayRoute = stderrors.New("gateway routes cannot be federated")
+
+// envelopeOverhead allows for the fields around the base64 body of a signed
+// request when bounding what is read
+const envelopeOverhead = 64 << 10
+
+// ServiceHandler processes a verified cross-agency request addressed to a registered path.
+// It returns the status code and body that will be signed and sent back to the caller.
+type ServiceHandler func(ctx context.Context, req *SignedRequest) (int, []byte)
+
 // Handler provides HTTP handlers for the gateway
 type Handler struct {
 	gateway   *Gateway
 	bus       events.EventBus
-	localMux  http.Handler // Router for local services
+	services  map[string]ServiceHandler // Federation services by path
+	routes    *chi.Mux                  // Federated local routes
+	required  map[string]string         // Permission by method and route pattern
+	grants    map[string][]string       // Permissions by agency code
 }
 
 // NewHandler creates a new gateway handler
-func NewHandler(gateway *Gateway, bus events.EventBus, localMux http.Handler) *Handler {
+func NewHandler(gateway *Gateway, bus events.EventBus) *Handler {
 	return &Handler{
 		gateway:  gateway,
 		bus:      bus,
-		localMux: localMux,
+		services: make(map[string]ServiceHandler),
+		routes:   chi.NewRouter(),
+		required: make(map[string]string),
+		grants:   make(map[string][]string),
 	}
 }
 
+// HandleService registers a handler for verified requests to the given path.
+// Registered services take precedence over federated routes and receive the
+// full signed request, including the verified source agency.
+func (h *Handler) HandleService(path string, fn ServiceHandler) {
+	h.services[path] = fn
+}
+
+// HandleRoute makes a local route callable over federation by agencies
+// granted the permission. Only routes registered here are forwarded to; the
+// handler receives the body, query string and forwarded headers of the
+// signed request, with the source agency as an agency user in the auth
+// context, and must still authorise that agency itself.
+func (h *Handler) HandleRoute(method, pattern, permission string, handler http.Handler) error {
+	if isGatewayPath(pattern) {
+		return fmt.Errorf("%w: %s", ErrGatewayRoute, pattern)
+	}
+	if permission == "" {
+		return fmt.Errorf("federated route %s %s needs a permission", method, pattern)
+	}
+	h.routes.Method(method, pattern, handler)
+	h.required[method+" "+pattern] = permission
+	return nil
+}
+
+// Grant gives an agency permissions on federated routes
+func (h *Handler) Grant(agencyCode string, permissions ...string) {
+	for _, permission := range permissions {
+		if !slices.Contains(h.grants[agencyCode], permission) {
+			h.grants[agencyCode] = append(h.grants[agencyCode], permission)
+		}
+	}
+}
+
+// isGatewayPath reports whether a path is one of the gateway's own routes,
+// wherever the gateway is mounted
+func isGatewayPath(p string) bool {
+	return strings.Contains(path.Clean("/"+p)+"/", GatewayPathPrefix+"/")
+}
+
 // Routes registers the gateway routes
 func (h *Handler) Routes() chi.Router {
 	r := chi.NewRouter()
@@ -57,9 +137,19 @@ type SendRequestPayload struct {
 
 // ReceiveRequest handles incoming cross-agency requests
 func (h *Handler) ReceiveRequest(w http.ResponseWriter, r *http.Request) {
-	// Read request body
+	start := time.Now()
+
+	// Read request body, bounded by the signed body it may carry
+	if maxBody := h.gateway.MaxBodySize(); maxBody > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, (maxBody+2)/3*4+envelopeOverhead)
+	}
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if stderrors.As(err, &maxBytesErr) {
+			writeError(w, bodyTooLargeError(fmt.Sprintf("request larger than %d bytes", maxBytesErr.Limit)))
+			return
+		}
 		writeError(w, errors.BadRequest("failed to read request body"))
 		return
 	}
@@ -71,9 +161,18 @@ func (h *Handler) ReceiveRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify signature
-	if err := h.gateway.VerifyRequest(r.Context(), &signedReq); err != nil {
-		writeError(w, errors.Unauthorized("signature verification failed: "+err.Error()))
+	// Verify signature and freshness
+	sourceAgency, err := h.gateway.verifyRequest(r.Context(), &signedReq)
+	if err != nil {
+		appErr := verificationError(err)
+		// The source agency is only known once the signature verified;
+		// until then the claimed one would let callers pick label values
+		source := "unverified"
+		if signatureVerified(err) {
+			source = signedReq.SourceAgency
+		}
+		metrics.RecordFederationRequest("inbound", source, appErr.Code, time.Since(start))
+		writeError(w, appErr)
 		return
 	}
 
@@ -84,6 +183,7 @@ func (h *Handler) ReceiveRequest(w http.ResponseWriter, r *http.Request) {
 			"source_agency": signedReq.SourceAgency,
 			"method":        signedReq.Method,
 			"path":          signedReq.Path,
+			"query":         signedReq.Query,
 		})
 		h.bus.Publish(r.Context(), event)
 	}
@@ -92,35 +192,10 @@ func (h *Handler) ReceiveRequest(w http.ResponseWriter, r *http.Request) {
 	var respBody []byte
 	var statusCode int
 
-	if h.localMux != nil {
-		// Create internal request
-		internalReq, err := http.NewRequestWithContext(
-			r.Context(),
-			signedReq.Method,
-			signedReq.Path,
-			nil,
-		)
-		if err != nil {
-			statusCode = http.StatusInternalServerError
-			respBody = []byte(`{"error":"failed to create internal request"}`)
-		} else {
-			// Add federation headers
-			internalReq.Header.Set("X-Federation-Source", signedReq.SourceAgency)
-			internalReq.Header.Set("X-Federation-Request-ID", signedReq.ID)
-
-			// Capture response
-			rw := &responseWriter{
-				header: make(http.Header),
-				body:   &jsonBuffer{},
-			}
-			h.localMux.ServeHTTP(rw, internalReq)
-
-			statusCode = rw.statusCode
-			respBody = rw.body.Bytes()
-		}
+	if fn, ok := h.services[signedReq.Path]; ok {
+		statusCode, respBody = fn(r.Context(), &signedReq)
 	} else {
-		statusCode = http.StatusNotImplemented
-		respBody = []byte(`{"error":"no local handler configured"}`)
+		statusCode, respBody = h.forward(r.Context(), &signedReq, sourceAgency)
 	}
 
 	// Create signed response
@@ -130,9 +205,97 @@ func (h *Handler) ReceiveRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	metrics.RecordFederationRequest("inbound", signedReq.SourceAgency, "OK", time.Since(start))
 	writeJSON(w, http.StatusOK, signedResp)
 }
 
+// forward passes a verified request to the federated route it addresses, if
+// the source agency holds the route's permission
+func (h *Handler) forward(ctx context.Context, signedReq *SignedRequest, sourceAgency *trust.TrustedAgency) (int, []byte) {
+	if isGatewayPath(signedReq.Path) {
+		return http.StatusForbidden, []byte(`{"error":"gateway routes cannot be called over federation"}`)
+	}
+
+	// Route afresh rather than as part of this request's route
+	rctx := chi.NewRouteContext()
+	pattern := h.routes.Find(rctx, signedReq.Method, signedReq.Path)
+	if pattern == "" {
+		return http.StatusNotFound, []byte(`{"error":"route is not federated"}`)
+	}
+	permissions := h.grants[sourceAgency.Code]
+	if !slices.Contains(permissions, h.required[signedReq.Method+" "+pattern]) {
+		return http.StatusForbidden, []byte(`{"error":"agency is not granted this route"}`)
+	}
+
+	// Create internal request on behalf of the source agency
+	target := signedReq.Path
+	if signedReq.Query != "" {
+		target += "?" + signedReq.Query
+	}
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, chi.NewRouteContext())
+	ctx = auth.WithUser(ctx, auth.NewAgencyUser(sourceAgency.ID, sourceAgency.Code, slices.Clone(permissions)))
+	internalReq, err := http.NewRequestWithContext(ctx, signedReq.Method, target, bytes.NewReader(signedReq.Body))
+	if err != nil {
+		return http.StatusInternalServerError, []byte(`{"error":"failed to create internal request"}`)
+	}
+
+	// Pass on allow-listed headers
+	for name, value := range signedReq.Headers {
+		if h.gateway.ForwardsHeader(name) {
+			internalReq.Header.Set(name, value)
+		}
+	}
+
+	// Add federation headers
+	internalReq.Header.Set("X-Federation-Source", signedReq.SourceAgency)
+	internalReq.Header.Set("X-Federation-Request-ID", signedReq.ID)
+
+	// Capture response
+	rw := &responseWriter{
+		header: make(http.Header),
+		body:   &jsonBuffer{},
+	}
+	h.routes.ServeHTTP(rw, internalReq)
+
+	return rw.statusCode, rw.body.Bytes()
+}
+
+// signatureVerified reports whether a request was refused only after its
+// signature verified, so that its source agency is known
+func signatureVerified(err error) bool {
+	return stderrors.Is(err, ErrReplayedRequest) || stderrors.Is(err, ErrReplayCheckFailed)
+}
+
+// verificationError maps a failed verification of an incoming request to the
+// error returned to the caller. Replays and clock skew get their own codes,
+// so that they can be told apart from bad signatures.
+func verificationError(err error) *errors.AppError {
+	switch {
+	case stderrors.Is(err, ErrReplayedRequest):
+		appErr := errors.Conflict(err.Error())
+		appErr.Code = CodeReplayedRequest
+		return appErr
+	case stderrors.Is(err, ErrReplayCheckFailed):
+		return errors.Internal(err)
+	case stderrors.Is(err, ErrBodyTooLarge):
+		return bodyTooLargeError(err.Error())
+	case stderrors.Is(err, ErrClockSkew):
+		appErr := errors.Unauthorized(err.Error())
+		appErr.Code = CodeClockSkew
+		return appErr
+	default:
+		return errors.Unauthorized("signature verification failed: " + err.Error())
+	}
+}
+
+// bodyTooLargeError is returned for requests over the gateway's body limit
+func bodyTooLargeError(message string) *errors.AppError {
+	appErr := errors.BadRequest(message)
+	appErr.Code = CodeBodyTooLarge
+	appErr.HTTPStatus = http.StatusRequestEntityTooLarge
+	return appErr
+}
+
 // SendRequest handles outgoing cross-agency requests (internal API)
 func (h *Handler) SendRequest(w http.ResponseWriter, r *http.Request) {
 	var req SendRequestPayload
@@ -157,7 +320,11 @@ func (h *Handler) SendRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Send request through gateway
-	resp, err := h.gateway.SendRequest(r.Context(), req.TargetAgency, req.Method, req.Path, req.Body)
+	resp, err := h.gateway.SendRequestWithHeaders(r.Context(), req.TargetAgency, req.Method, req.Path, req.Headers, req.Body)
+	if stderrors.Is(err, ErrBodyTooLarge) {
+		writeError(w, bodyTooLargeError(err.Error()))
+		return
+	}
 	if err != nil {
 		writeError(w, errors.Internal(fmt.Errorf("federation request failed: %w", err)))
 		return
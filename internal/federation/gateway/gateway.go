@@ -7,22 +7,67 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/serbia-gov/platform/internal/federation/trust"
 	"github.com/serbia-gov/platform/internal/shared/types"
 )
 
+// DefaultClockSkew is how far a request timestamp may be from the receiving
+// gateway's clock, in either direction
+const DefaultClockSkew = 5 * time.Minute
+
+// DefaultMaxBodySize bounds the body of a request received through the
+// gateway
+const DefaultMaxBodySize = 10 << 20
+
+// DefaultForwardedHeaders are the request headers passed on to local
+// handlers. Others are signed but dropped, so that a remote agency cannot
+// set credentials or the gateway's own X-Federation headers.
+var DefaultForwardedHeaders = []string{
+	"Accept",
+	"Accept-Language",
+	"Content-Type",
+	"If-Match",
+	"If-None-Match",
+	"X-Access-Purpose",
+	"X-Correlation-ID",
+}
+
+var (
+	// ErrReplayedRequest is returned for a request that was already accepted
+	ErrReplayedRequest = errors.New("request replayed")
+	// ErrClockSkew is returned for a request timestamped outside the
+	// clock-skew window
+	ErrClockSkew = errors.New("request timestamp outside the clock-skew window")
+	// ErrReplayCheckFailed is returned when the nonce store cannot tell
+	// whether a request was seen before; the request is refused
+	ErrReplayCheckFailed = errors.New("replay check failed")
+	// ErrBodyTooLarge is returned for request bodies over the maximum size
+	ErrBodyTooLarge = errors.New("request body too large")
+)
+
 // Gateway handles secure cross-agency communication
 type Gateway struct {
 	agencyID    types.ID
 	agencyCode  string
+	mu          sync.RWMutex
 	privateKey  ed25519.PrivateKey
 	publicKey   ed25519.PublicKey
+	keyID       string
 	authority   *trust.Authority
+	revocation  *trust.RevocationChecker
+	nonces      NonceStore
+	clockSkew   time.Duration
+	maxBodySize int64
+	forwarded   map[string]bool // canonical names of forwarded headers
 	httpClient  *http.Client
 }
 
@@ -41,9 +86,11 @@ type SignedRequest struct {
 	TargetAgency  string            `json:"target_agency"`
 	Method        string            `json:"method"`
 	Path          string            `json:"path"`
+	Query         string            `json:"query,omitempty"`
 	Headers       map[string]string `json:"headers,omitempty"`
 	Body          []byte            `json:"body,omitempty"`
 	Signature     string            `json:"signature"`
+	KeyID         string            `json:"key_id,omitempty"` // selects the signing key, not signed itself
 	CorrelationID string            `json:"correlation_id,omitempty"`
 }
 
@@ -56,6 +103,7 @@ type SignedResponse struct {
 	Headers      map[string]string `json:"headers,omitempty"`
 	Body         []byte            `json:"body,omitempty"`
 	Signature    string            `json:"signature"`
+	KeyID        string            `json:"key_id,omitempty"`
 }
 
 // NewGateway creates a new agency gateway
@@ -66,20 +114,152 @@ func NewGateway(cfg Config, authority *trust.Authority) (*Gateway, error) {
 
 	publicKey := cfg.PrivateKey.Public().(ed25519.PublicKey)
 
-	return &Gateway{
+	g := &Gateway{
 		agencyID:   cfg.AgencyID,
 		agencyCode: cfg.AgencyCode,
 		privateKey: cfg.PrivateKey,
 		publicKey:  publicKey,
+		keyID:      trust.KeyID(publicKey),
 		authority:  authority,
+		nonces:     NewMemoryNonceStore(DefaultNonceCapacity),
+		clockSkew:  DefaultClockSkew,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-	}, nil
+	}
+	if authority != nil {
+		g.revocation = authority.RevocationChecker()
+	}
+	g.SetMaxBodySize(DefaultMaxBodySize)
+	g.SetForwardedHeaders(DefaultForwardedHeaders)
+
+	return g, nil
+}
+
+// SetKey switches signing to a new key, once the agency has renewed its
+// certificate for it. Peers keep accepting the previous key for the Trust
+// Authority's key overlap, so requests in flight are not rejected.
+func (g *Gateway) SetKey(privateKey ed25519.PrivateKey) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.privateKey = privateKey
+	g.publicKey = privateKey.Public().(ed25519.PublicKey)
+	g.keyID = trust.KeyID(g.publicKey)
+}
+
+// KeyID returns the ID of the key the gateway signs with
+func (g *Gateway) KeyID() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.keyID
+}
+
+// sign signs data with the current key and returns the signature and key ID
+func (g *Gateway) sign(data []byte) (string, string) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(g.privateKey, data)), g.keyID
+}
+
+// SetNonceStore sets where the IDs of accepted requests are kept
+func (g *Gateway) SetNonceStore(store NonceStore) {
+	g.nonces = store
+}
+
+// SetClockSkew sets how far request timestamps may be from this gateway's
+// clock, in either direction
+func (g *Gateway) SetClockSkew(skew time.Duration) {
+	g.clockSkew = skew
+}
+
+// SetMaxBodySize sets the largest request body, in bytes, the gateway
+// accepts and sends
+func (g *Gateway) SetMaxBodySize(size int64) {
+	g.maxBodySize = size
+}
+
+// MaxBodySize returns the largest request body the gateway accepts
+func (g *Gateway) MaxBodySize() int64 {
+	return g.maxBodySize
+}
+
+// SetForwardedHeaders sets the request headers passed on to local handlers
+func (g *Gateway) SetForwardedHeaders(names []string) {
+	forwarded := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			forwarded[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+	g.forwarded = forwarded
+}
+
+// ForwardsHeader reports whether a request header is passed on to local
+// handlers
+func (g *Gateway) ForwardsHeader(name string) bool {
+	return g.forwarded[http.CanonicalHeaderKey(name)]
+}
+
+// StartNonceCleanup purges expired request IDs at each interval until the
+// context is cancelled
+func (g *Gateway) StartNonceCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := g.nonces.Purge(ctx, time.Now()); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		}
+	}
+}
+
+// SetRevocationChecker sets how agency certificates are checked for
+// revocation; nil disables the check
+func (g *Gateway) SetRevocationChecker(checker *trust.RevocationChecker) {
+	g.revocation = checker
+}
+
+// checkCertificate rejects agency keys whose certificate does not chain to
+// the Trust Authority's root, through the intermediate CA of the agency's
+// sector if it has one, or has been revoked or suspended
+func (g *Gateway) checkCertificate(ctx context.Context, agency *trust.TrustedAgency, key trust.AgencyKey) error {
+	if g.authority == nil {
+		return nil
+	}
+
+	cert, err := g.authority.VerifyChain(key.Certificate)
+	if err != nil {
+		return fmt.Errorf("invalid certificate of agency %s for key %s: %w", agency.Code, key.KeyID, err)
+	}
+	if cert.Subject.CommonName != agency.Code+".gov.rs" {
+		return fmt.Errorf("certificate for key %s was issued to %s, not agency %s", key.KeyID, cert.Subject.CommonName, agency.Code)
+	}
+
+	if g.revocation == nil {
+		return nil
+	}
+	return g.revocation.Check(ctx, cert, time.Time{})
 }
 
 // SendRequest sends a signed request to another agency
 func (g *Gateway) SendRequest(ctx context.Context, targetAgencyCode, method, path string, body []byte) (*SignedResponse, error) {
+	return g.SendRequestWithHeaders(ctx, targetAgencyCode, method, path, nil, body)
+}
+
+// SendRequestWithHeaders sends a signed request to another agency with
+// request headers. The path may carry a query string. Headers, query and
+// body are all signed; the target passes on only the headers it forwards.
+func (g *Gateway) SendRequestWithHeaders(ctx context.Context, targetAgencyCode, method, path string, headers map[string]string, body []byte) (*SignedResponse, error) {
+	if g.maxBodySize > 0 && int64(len(body)) > g.maxBodySize {
+		return nil, fmt.Errorf("%w: %d bytes, at most %d", ErrBodyTooLarge, len(body), g.maxBodySize)
+	}
+
 	// Get target agency info
 	targetAgency, err := g.authority.GetAgencyByCode(ctx, targetAgencyCode)
 	if err != nil {
@@ -91,6 +271,7 @@ func (g *Gateway) SendRequest(ctx context.Context, targetAgencyCode, method, pat
 	}
 
 	// Create signed request
+	path, query, _ := strings.Cut(path, "?")
 	request := &SignedRequest{
 		ID:           types.NewID().String(),
 		Timestamp:    time.Now().UTC(),
@@ -98,8 +279,15 @@ func (g *Gateway) SendRequest(ctx context.Context, targetAgencyCode, method, pat
 		TargetAgency: targetAgencyCode,
 		Method:       method,
 		Path:         path,
+		Query:        query,
 		Body:         body,
 	}
+	if len(headers) > 0 {
+		request.Headers = make(map[string]string, len(headers))
+		for name, value := range headers {
+			request.Headers[http.CanonicalHeaderKey(name)] = value
+		}
+	}
 
 	// Sign the request
 	if err := g.signRequest(request); err != nil {
@@ -141,7 +329,7 @@ func (g *Gateway) SendRequest(ctx context.Context, targetAgencyCode, method, pat
 	}
 
 	// Verify response signature
-	if err := g.verifyResponse(&signedResp, targetAgency.PublicKey); err != nil {
+	if err := g.verifyAgencyResponse(ctx, targetAgency, &signedResp); err != nil {
 		return nil, fmt.Errorf("failed to verify response signature: %w", err)
 	}
 
@@ -150,73 +338,202 @@ func (g *Gateway) SendRequest(ctx context.Context, targetAgencyCode, method, pat
 
 // signRequest signs a request with the agency's private key
 func (g *Gateway) signRequest(req *SignedRequest) error {
-	// Create canonical representation for signing
+	toSign, err := canonicalRequest(req)
+	if err != nil {
+		return err
+	}
+
+	// Sign
+	req.Signature, req.KeyID = g.sign(toSign)
+
+	return nil
+}
+
+// canonicalRequest is the representation of a request that is signed. The
+// query string follows the path as in a URL, and headers are hashed by
+// canonical name, so that they cannot be reordered or renamed. Requests
+// without a query or headers are signed as before, so gateways that do not
+// send them still verify each other. Fields that contain the separators are
+// rejected, so that no two requests have the same representation.
+func canonicalRequest(req *SignedRequest) ([]byte, error) {
+	if err := checkCanonicalFields(req); err != nil {
+		return nil, err
+	}
+
+	target := req.Path
+	if req.Query != "" {
+		target += "?" + req.Query
+	}
 	toSign := fmt.Sprintf("%s|%s|%s|%s|%s|%s",
 		req.ID,
 		req.Timestamp.Format(time.RFC3339Nano),
 		req.SourceAgency,
 		req.TargetAgency,
 		req.Method,
-		req.Path,
+		target,
 	)
 
+	// Add headers hash if present
+	if len(req.Headers) > 0 {
+		lines := make([]string, 0, len(req.Headers))
+		seen := make(map[string]bool, len(req.Headers))
+		for name, value := range req.Headers {
+			name = http.CanonicalHeaderKey(name)
+			if seen[name] {
+				return nil, fmt.Errorf("header %s given more than once", name)
+			}
+			seen[name] = true
+			lines = append(lines, name+":"+value+"\n")
+		}
+		sort.Strings(lines)
+		headersHash := sha256.Sum256([]byte(strings.Join(lines, "")))
+		toSign += "|headers:" + base64.StdEncoding.EncodeToString(headersHash[:])
+	}
+
 	// Add body hash if present
 	if len(req.Body) > 0 {
 		bodyHash := sha256.Sum256(req.Body)
 		toSign += "|" + base64.StdEncoding.EncodeToString(bodyHash[:])
 	}
 
-	// Sign
-	signature := ed25519.Sign(g.privateKey, []byte(toSign))
-	req.Signature = base64.StdEncoding.EncodeToString(signature)
+	return []byte(toSign), nil
+}
+
+// checkCanonicalFields rejects separators in request fields: "|" between
+// fields, "?" between path and query, and line breaks and ":" in headers
+func checkCanonicalFields(req *SignedRequest) error {
+	fields := []struct{ name, value string }{
+		{"id", req.ID},
+		{"source agency", req.SourceAgency},
+		{"target agency", req.TargetAgency},
+		{"method", req.Method},
+		{"path", req.Path},
+		{"query", req.Query},
+	}
+	for _, field := range fields {
+		if strings.ContainsAny(field.value, "|\r\n") {
+			return fmt.Errorf("request %s contains a separator", field.name)
+		}
+	}
+	if strings.Contains(req.Path, "?") {
+		return fmt.Errorf("request path contains a query separator")
+	}
+
+	for name, value := range req.Headers {
+		if name == "" || strings.ContainsAny(name, ":\r\n") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("header %s contains a line break", name)
+		}
+	}
 
 	return nil
 }
 
-// VerifyRequest verifies an incoming request signature
+// VerifyRequest verifies an incoming request signature and that the request
+// is fresh: timestamped within the clock-skew window and not seen before
 func (g *Gateway) VerifyRequest(ctx context.Context, req *SignedRequest) error {
+	_, err := g.verifyRequest(ctx, req)
+	return err
+}
+
+// verifyRequest verifies an incoming request and returns its source agency
+func (g *Gateway) verifyRequest(ctx context.Context, req *SignedRequest) (*trust.TrustedAgency, error) {
 	// Get source agency
 	sourceAgency, err := g.authority.GetAgencyByCode(ctx, req.SourceAgency)
 	if err != nil {
-		return fmt.Errorf("source agency not found: %w", err)
+		return nil, fmt.Errorf("source agency not found: %w", err)
 	}
 
 	if sourceAgency.Status != "active" {
-		return fmt.Errorf("source agency is not active: %s", sourceAgency.Status)
+		return nil, fmt.Errorf("source agency is not active: %s", sourceAgency.Status)
+	}
+
+	if g.maxBodySize > 0 && int64(len(req.Body)) > g.maxBodySize {
+		return nil, fmt.Errorf("%w: %d bytes, at most %d", ErrBodyTooLarge, len(req.Body), g.maxBodySize)
 	}
 
 	// Check timestamp (prevent replay attacks)
-	if time.Since(req.Timestamp) > 5*time.Minute {
-		return fmt.Errorf("request timestamp too old")
+	now := time.Now()
+	if now.Sub(req.Timestamp) > g.clockSkew {
+		return nil, fmt.Errorf("%w: too old (%s)", ErrClockSkew, req.Timestamp.Format(time.RFC3339))
+	}
+	if req.Timestamp.Sub(now) > g.clockSkew {
+		return nil, fmt.Errorf("%w: in the future (%s)", ErrClockSkew, req.Timestamp.Format(time.RFC3339))
 	}
 
 	// Create canonical representation
-	toSign := fmt.Sprintf("%s|%s|%s|%s|%s|%s",
-		req.ID,
-		req.Timestamp.Format(time.RFC3339Nano),
-		req.SourceAgency,
-		req.TargetAgency,
-		req.Method,
-		req.Path,
-	)
+	toSign, err := canonicalRequest(req)
+	if err != nil {
+		return nil, err
+	}
 
-	if len(req.Body) > 0 {
-		bodyHash := sha256.Sum256(req.Body)
-		toSign += "|" + base64.StdEncoding.EncodeToString(bodyHash[:])
+	if err := g.verifyWithAgencyKeys(ctx, sourceAgency, req.KeyID, toSign, req.Signature); err != nil {
+		return nil, err
 	}
 
-	// Decode signature
-	signature, err := base64.StdEncoding.DecodeString(req.Signature)
+	// Only signed requests are remembered, so that others cannot fill the
+	// store. The ID is signed; past the window the timestamp rejects it.
+	if g.nonces != nil {
+		fresh, err := g.nonces.Remember(ctx, req.SourceAgency, req.ID, req.Timestamp.Add(g.clockSkew))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrReplayCheckFailed, err)
+		}
+		if !fresh {
+			return nil, fmt.Errorf("%w: %s from %s", ErrReplayedRequest, req.ID, req.SourceAgency)
+		}
+	}
+
+	return sourceAgency, nil
+}
+
+// verifyWithAgencyKeys verifies a signature with the agency key it names, or
+// with any of its valid keys when it names none, and checks that the key's
+// certificate has not been revoked
+func (g *Gateway) verifyWithAgencyKeys(ctx context.Context, agency *trust.TrustedAgency, keyID string, data []byte, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
 	if err != nil {
 		return fmt.Errorf("invalid signature encoding: %w", err)
 	}
 
-	// Verify
-	if !ed25519.Verify(sourceAgency.PublicKey, []byte(toSign), signature) {
-		return fmt.Errorf("signature verification failed")
+	keys := agency.VerificationKeys(keyID, time.Now())
+	if len(keys) == 0 {
+		return fmt.Errorf("unknown or retired key %s of agency %s", keyID, agency.Code)
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key.PublicKey, data, sig) {
+			return g.checkCertificate(ctx, agency, key)
+		}
 	}
 
-	return nil
+	return fmt.Errorf("signature verification failed")
+}
+
+// AgencyCode returns the code of the agency this gateway represents
+func (g *Gateway) AgencyCode() string {
+	return g.agencyCode
+}
+
+// SignPayload signs application-level data (e.g. delivery receipts) with the agency's private key
+func (g *Gateway) SignPayload(data []byte) string {
+	signature, _ := g.sign(data)
+	return signature
+}
+
+// VerifyAgencySignature verifies application-level data signed by another registered agency
+func (g *Gateway) VerifyAgencySignature(ctx context.Context, agencyCode string, data []byte, signature string) error {
+	agency, err := g.authority.GetAgencyByCode(ctx, agencyCode)
+	if err != nil {
+		return fmt.Errorf("agency not found: %w", err)
+	}
+
+	if agency.Status != "active" {
+		return fmt.Errorf("agency is not active: %s", agency.Status)
+	}
+
+	// Payload signatures carry no key ID; any valid key of the agency verifies
+	return g.verifyWithAgencyKeys(ctx, agency, "", data, signature)
 }
 
 // CreateResponse creates a signed response
@@ -251,12 +568,28 @@ func (g *Gateway) signResponse(resp *SignedResponse) error {
 		toSign += "|" + base64.StdEncoding.EncodeToString(bodyHash[:])
 	}
 
-	signature := ed25519.Sign(g.privateKey, []byte(toSign))
-	resp.Signature = base64.StdEncoding.EncodeToString(signature)
+	resp.Signature, resp.KeyID = g.sign([]byte(toSign))
 
 	return nil
 }
 
+// verifyAgencyResponse verifies a response with the responding agency key it
+// names, or with any of its valid keys
+func (g *Gateway) verifyAgencyResponse(ctx context.Context, agency *trust.TrustedAgency, resp *SignedResponse) error {
+	keys := agency.VerificationKeys(resp.KeyID, time.Now())
+	if len(keys) == 0 {
+		return fmt.Errorf("unknown or retired key %s of agency %s", resp.KeyID, agency.Code)
+	}
+
+	var err error
+	for _, key := range keys {
+		if err = g.verifyResponse(resp, key.PublicKey); err == nil {
+			return g.checkCertificate(ctx, agency, key)
+		}
+	}
+	return err
+}
+
 // verifyResponse verifies a response signature
 func (g *Gateway) verifyResponse(resp *SignedResponse, publicKey []byte) error {
 	toSign := fmt.Sprintf("%s|%s|%s|%d",
@@ -1,27 +1,48 @@
 package gateway
 
 import (
+	"bytes"
 	"context"
 	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/serbia-gov/platform/internal/federation/trust"
+	"github.com/serbia-gov/platform/internal/shared/auth"
+	"github.com/serbia-gov/platform/internal/shared/config"
 	"github.com/serbia-gov/platform/internal/shared/types"
 )
 
 // --- Mock Repository for Trust Authority ---
 
 type mockRepository struct {
-	agencies map[types.ID]*trust.TrustedAgency
-	services map[types.ID][]trust.ServiceEndpoint
+	agencies    map[types.ID]*trust.TrustedAgency
+	services    map[types.ID][]trust.ServiceEndpoint
+	enrollments map[string]*trust.Enrollment
+	revocations map[string]trust.Revocation
+	keys        map[types.ID][]trust.AgencyKey
+	caCerts     []trust.CACertificate
 }
 
 func newMockRepository() *mockRepository {
 	return &mockRepository{
-		agencies: make(map[types.ID]*trust.TrustedAgency),
-		services: make(map[types.ID][]trust.ServiceEndpoint),
+		agencies:    make(map[types.ID]*trust.TrustedAgency),
+		services:    make(map[types.ID][]trust.ServiceEndpoint),
+		enrollments: make(map[string]*trust.Enrollment),
+		revocations: make(map[string]trust.Revocation),
+		keys:        make(map[types.ID][]trust.AgencyKey),
 	}
 }
 
@@ -82,6 +103,99 @@ func (r *mockRepository) GetServicesByType(ctx context.Context, serviceType stri
 	return result, nil
 }
 
+func (r *mockRepository) SaveEnrollment(ctx context.Context, enrollment *trust.Enrollment) error {
+	r.enrollments[enrollment.TokenHash] = enrollment
+	return nil
+}
+
+func (r *mockRepository) GetEnrollmentByToken(ctx context.Context, tokenHash string) (*trust.Enrollment, error) {
+	return r.enrollments[tokenHash], nil
+}
+
+func (r *mockRepository) GetPendingEnrollment(ctx context.Context, code string, now time.Time) (*trust.Enrollment, error) {
+	for _, e := range r.enrollments {
+		if e.Code == code && e.EnrolledAt == nil && now.Before(e.ExpiresAt) {
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *mockRepository) EnrollAgency(ctx context.Context, enrollmentID types.ID, agency *trust.TrustedAgency, key *trust.AgencyKey) error {
+	for _, e := range r.enrollments {
+		if e.ID == enrollmentID {
+			if e.EnrolledAt != nil {
+				return fmt.Errorf("%w: already used", trust.ErrEnrollmentToken)
+			}
+			enrolledAt := agency.RegisteredAt
+			e.AgencyID = agency.ID
+			e.EnrolledAt = &enrolledAt
+			r.agencies[agency.ID] = agency
+			return r.SaveAgencyKey(ctx, agency.ID, key)
+		}
+	}
+	return errors.New("enrollment not found")
+}
+
+func (r *mockRepository) SaveRevocation(ctx context.Context, revocation *trust.Revocation) error {
+	r.revocations[revocation.SerialNumber] = *revocation
+	return nil
+}
+
+func (r *mockRepository) ListRevocations(ctx context.Context) ([]trust.Revocation, error) {
+	var result []trust.Revocation
+	for _, revocation := range r.revocations {
+		result = append(result, revocation)
+	}
+	return result, nil
+}
+
+func (r *mockRepository) SaveAgencyKey(ctx context.Context, agencyID types.ID, key *trust.AgencyKey) error {
+	for i, existing := range r.keys[agencyID] {
+		if existing.KeyID == key.KeyID {
+			r.keys[agencyID][i] = *key
+			return nil
+		}
+	}
+	r.keys[agencyID] = append(r.keys[agencyID], *key)
+	return nil
+}
+
+func (r *mockRepository) ListAgencyKeys(ctx context.Context, agencyID types.ID) ([]trust.AgencyKey, error) {
+	return r.keys[agencyID], nil
+}
+
+func (r *mockRepository) SaveCACertificate(ctx context.Context, cert *trust.CACertificate) error {
+	r.caCerts = append(r.caCerts, *cert)
+	return nil
+}
+
+func (r *mockRepository) ListCACertificates(ctx context.Context) ([]trust.CACertificate, error) {
+	return r.caCerts, nil
+}
+
+// enrollAgency enrolls an agency with the Trust Authority using a CSR for a
+// new gateway key
+func enrollAgency(t *testing.T, authority *trust.Authority, name, code, gatewayURL string) (*trust.TrustedAgency, ed25519.PrivateKey) {
+	t.Helper()
+	ctx := context.Background()
+
+	_, token, err := authority.CreateEnrollment(ctx, name, code, gatewayURL, 0)
+	if err != nil {
+		t.Fatalf("Failed to create enrollment for %s: %v", code, err)
+	}
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	csr, err := trust.CreateCSR(code, privateKey)
+	if err != nil {
+		t.Fatalf("Failed to create CSR for %s: %v", code, err)
+	}
+	agency, err := authority.Enroll(ctx, token, csr)
+	if err != nil {
+		t.Fatalf("Failed to enroll %s: %v", code, err)
+	}
+	return agency, privateKey
+}
+
 // --- Gateway Tests ---
 
 func TestNewGateway(t *testing.T) {
@@ -129,11 +243,8 @@ func TestSignAndVerifyRequest(t *testing.T) {
 	authority, _ := trust.NewAuthority(repo)
 	ctx := context.Background()
 
-	// Register source agency with authority
-	agency, _ := authority.RegisterAgency(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
-
-	// Create gateway with matching keys
-	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	// Enroll source agency with authority
+	agency, privateKey := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
 
 	cfg := Config{
 		AgencyID:   agency.ID,
@@ -164,10 +275,6 @@ func TestSignAndVerifyRequest(t *testing.T) {
 		t.Error("Signature should not be empty")
 	}
 
-	// Update agency with the gateway's public key for verification
-	agency.PublicKey = gateway.publicKey
-	repo.SaveAgency(ctx, agency)
-
 	// Verify the request
 	err = gateway.VerifyRequest(ctx, request)
 	if err != nil {
@@ -180,10 +287,8 @@ func TestVerifyRequestWithInvalidSignature(t *testing.T) {
 	authority, _ := trust.NewAuthority(repo)
 	ctx := context.Background()
 
-	// Register source agency
-	agency, _ := authority.RegisterAgency(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
-
-	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	// Enroll source agency
+	agency, privateKey := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
 
 	cfg := Config{
 		AgencyID:   agency.ID,
@@ -193,10 +298,6 @@ func TestVerifyRequestWithInvalidSignature(t *testing.T) {
 
 	gateway, _ := NewGateway(cfg, authority)
 
-	// Update agency public key
-	agency.PublicKey = gateway.publicKey
-	repo.SaveAgency(ctx, agency)
-
 	// Create a request with invalid signature
 	request := &SignedRequest{
 		ID:           types.NewID().String(),
@@ -219,10 +320,8 @@ func TestVerifyRequestWithOldTimestamp(t *testing.T) {
 	authority, _ := trust.NewAuthority(repo)
 	ctx := context.Background()
 
-	// Register source agency
-	agency, _ := authority.RegisterAgency(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
-
-	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	// Enroll source agency
+	agency, privateKey := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
 
 	cfg := Config{
 		AgencyID:   agency.ID,
@@ -232,10 +331,6 @@ func TestVerifyRequestWithOldTimestamp(t *testing.T) {
 
 	gateway, _ := NewGateway(cfg, authority)
 
-	// Update agency public key
-	agency.PublicKey = gateway.publicKey
-	repo.SaveAgency(ctx, agency)
-
 	// Create a request with old timestamp (more than 5 minutes ago)
 	request := &SignedRequest{
 		ID:           types.NewID().String(),
@@ -256,15 +351,241 @@ func TestVerifyRequestWithOldTimestamp(t *testing.T) {
 	}
 }
 
-func TestVerifyRequestFromSuspendedAgency(t *testing.T) {
+func TestVerifyRequestRejectsReplay(t *testing.T) {
 	repo := newMockRepository()
 	authority, _ := trust.NewAuthority(repo)
 	ctx := context.Background()
 
-	// Register source agency
-	agency, _ := authority.RegisterAgency(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	agency, privateKey := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	gateway, _ := NewGateway(Config{AgencyID: agency.ID, AgencyCode: "MUP", PrivateKey: privateKey}, authority)
+
+	newRequest := func() *SignedRequest {
+		request := &SignedRequest{
+			ID:           types.NewID().String(),
+			Timestamp:    time.Now().UTC(),
+			SourceAgency: "MUP",
+			TargetAgency: "PURS",
+			Method:       "POST",
+			Path:         "/api/v1/verify",
+		}
+		gateway.signRequest(request)
+		return request
+	}
 
-	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	request := newRequest()
+	if err := gateway.VerifyRequest(ctx, request); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := gateway.VerifyRequest(ctx, request); !errors.Is(err, ErrReplayedRequest) {
+		t.Errorf("Expected ErrReplayedRequest, got: %v", err)
+	}
+	if err := gateway.VerifyRequest(ctx, newRequest()); err != nil {
+		t.Errorf("Expected a new request to verify, got: %v", err)
+	}
+
+	// A request with an invalid signature is not remembered
+	forged := newRequest()
+	forged.Path = "/api/v1/other"
+	gateway.VerifyRequest(ctx, forged)
+	if n := gateway.nonces.(*MemoryNonceStore).Len(); n != 2 {
+		t.Errorf("Expected 2 remembered requests, got %d", n)
+	}
+}
+
+func TestVerifyRequestWithFutureTimestamp(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := trust.NewAuthority(repo)
+	ctx := context.Background()
+
+	agency, privateKey := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	gateway, _ := NewGateway(Config{AgencyID: agency.ID, AgencyCode: "MUP", PrivateKey: privateKey}, authority)
+
+	request := &SignedRequest{
+		ID:           types.NewID().String(),
+		Timestamp:    time.Now().UTC().Add(10 * time.Minute),
+		SourceAgency: "MUP",
+		TargetAgency: "PURS",
+		Method:       "POST",
+		Path:         "/api/v1/verify",
+	}
+	gateway.signRequest(request)
+
+	if err := gateway.VerifyRequest(ctx, request); !errors.Is(err, ErrClockSkew) {
+		t.Errorf("Expected ErrClockSkew, got: %v", err)
+	}
+
+	gateway.SetClockSkew(15 * time.Minute)
+	if err := gateway.VerifyRequest(ctx, request); err != nil {
+		t.Errorf("Expected request within the skew window to verify, got: %v", err)
+	}
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	store := NewMemoryNonceStore(2)
+	ctx := context.Background()
+	now := time.Now()
+
+	if fresh, _ := store.Remember(ctx, "MUP", "1", now.Add(time.Minute)); !fresh {
+		t.Error("Expected a new request ID to be fresh")
+	}
+	if fresh, _ := store.Remember(ctx, "MUP", "1", now.Add(time.Minute)); fresh {
+		t.Error("Expected a known request ID to be a replay")
+	}
+	if fresh, _ := store.Remember(ctx, "PURS", "1", now.Add(time.Minute)); !fresh {
+		t.Error("Request IDs of other agencies should not collide")
+	}
+
+	// Full of unexpired IDs: refuse rather than forget
+	if _, err := store.Remember(ctx, "MUP", "2", now.Add(time.Minute)); !errors.Is(err, ErrNonceStoreFull) {
+		t.Errorf("Expected ErrNonceStoreFull, got: %v", err)
+	}
+
+	// Expired IDs make room
+	store.Purge(ctx, now.Add(2*time.Minute))
+	if store.Len() != 0 {
+		t.Errorf("Expected expired request IDs to be purged, got %d", store.Len())
+	}
+	store.Remember(ctx, "MUP", "3", now.Add(-time.Second))
+	store.Remember(ctx, "MUP", "4", now.Add(time.Minute))
+	if fresh, err := store.Remember(ctx, "MUP", "5", now.Add(time.Minute)); !fresh || err != nil {
+		t.Errorf("Expected expired request IDs to be purged when full, got %v, %v", fresh, err)
+	}
+}
+
+func TestReceiveRequestReplayErrorCode(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := trust.NewAuthority(repo)
+
+	agency, privateKey := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	gateway, _ := NewGateway(Config{AgencyID: agency.ID, AgencyCode: "MUP", PrivateKey: privateKey}, authority)
+	handler := NewHandler(gateway, nil)
+	handler.HandleService("/api/v1/verify", func(ctx context.Context, req *SignedRequest) (int, []byte) {
+		return http.StatusOK, []byte(`{}`)
+	})
+
+	request := &SignedRequest{
+		ID:           types.NewID().String(),
+		Timestamp:    time.Now().UTC(),
+		SourceAgency: "MUP",
+		TargetAgency: "MUP",
+		Method:       "POST",
+		Path:         "/api/v1/verify",
+	}
+	gateway.signRequest(request)
+	body, _ := json.Marshal(request)
+
+	receive := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.Routes().ServeHTTP(rec, httptest.NewRequest("POST", "/receive", bytes.NewReader(body)))
+		return rec
+	}
+
+	if rec := receive(); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := receive()
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a replay, got %d", rec.Code)
+	}
+	var resp map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp["code"] != CodeReplayedRequest {
+		t.Errorf("Expected code %s, got %v", CodeReplayedRequest, resp["code"])
+	}
+}
+
+// inboundRequests returns the federation_requests_total count of inbound
+// requests for a source and status
+func inboundRequests(t *testing.T, source, status string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "federation_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["direction"] == "inbound" && labels["target_agency"] == source && labels["status"] == status {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestReceiveRequestLabelsUnverifiedFailures(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := trust.NewAuthority(repo)
+
+	agency, privateKey := enrollAgency(t, authority, "Tax Administration", "PURS", "https://purs.gov.rs/gateway")
+	gateway, _ := NewGateway(Config{AgencyID: agency.ID, AgencyCode: "PURS", PrivateKey: privateKey}, authority)
+	handler := NewHandler(gateway, nil)
+	handler.HandleService("/api/v1/verify", func(ctx context.Context, req *SignedRequest) (int, []byte) {
+		return http.StatusOK, []byte(`{}`)
+	})
+
+	receive := func(request *SignedRequest) int {
+		body, _ := json.Marshal(request)
+		rec := httptest.NewRecorder()
+		handler.Routes().ServeHTTP(rec, httptest.NewRequest("POST", "/receive", bytes.NewReader(body)))
+		return rec.Code
+	}
+	newRequest := func(timestamp time.Time) *SignedRequest {
+		request := &SignedRequest{
+			ID:           types.NewID().String(),
+			Timestamp:    timestamp,
+			SourceAgency: "PURS",
+			TargetAgency: "PURS",
+			Method:       "POST",
+			Path:         "/api/v1/verify",
+		}
+		gateway.signRequest(request)
+		return request
+	}
+
+	unverified := inboundRequests(t, "unverified", "UNAUTHORIZED") + inboundRequests(t, "unverified", CodeClockSkew)
+
+	// A forged signature and a stale timestamp are not blamed on the claimed agency
+	forged := newRequest(time.Now().UTC())
+	forged.Path = "/api/v1/other"
+	if code := receive(forged); code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for a forged request, got %d", code)
+	}
+	if code := receive(newRequest(time.Now().UTC().Add(-time.Hour))); code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for a stale request, got %d", code)
+	}
+	if n := inboundRequests(t, "PURS", "UNAUTHORIZED") + inboundRequests(t, "PURS", CodeClockSkew); n != 0 {
+		t.Errorf("Expected no failures labelled with the claimed agency, got %v", n)
+	}
+	if n := inboundRequests(t, "unverified", "UNAUTHORIZED") + inboundRequests(t, "unverified", CodeClockSkew); n != unverified+2 {
+		t.Errorf("Expected 2 more unverified failures, got %v", n-unverified)
+	}
+
+	// A replay is only detected after the signature verified
+	request := newRequest(time.Now().UTC())
+	receive(request)
+	if code := receive(request); code != http.StatusConflict {
+		t.Fatalf("Expected status 409 for a replay, got %d", code)
+	}
+	if n := inboundRequests(t, "PURS", CodeReplayedRequest); n != 1 {
+		t.Errorf("Expected the replay labelled with its verified agency, got %v", n)
+	}
+}
+
+func TestVerifyRequestFromSuspendedAgency(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := trust.NewAuthority(repo)
+	ctx := context.Background()
+
+	// Enroll source agency
+	agency, privateKey := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
 
 	cfg := Config{
 		AgencyID:   agency.ID,
@@ -274,10 +595,6 @@ func TestVerifyRequestFromSuspendedAgency(t *testing.T) {
 
 	gateway, _ := NewGateway(cfg, authority)
 
-	// Update agency public key
-	agency.PublicKey = gateway.publicKey
-	repo.SaveAgency(ctx, agency)
-
 	// Suspend the agency
 	authority.SuspendAgency(ctx, agency.ID, "Test suspension")
 
@@ -299,6 +616,120 @@ func TestVerifyRequestFromSuspendedAgency(t *testing.T) {
 	}
 }
 
+func TestVerifyRequestWithRevokedCertificate(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := trust.NewAuthority(repo)
+	ctx := context.Background()
+
+	agency, privateKey := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	gateway, _ := NewGateway(Config{AgencyID: agency.ID, AgencyCode: "MUP", PrivateKey: privateKey}, authority)
+
+	authority.RevokeAgency(ctx, agency.ID, "Key compromise")
+
+	// A stale registry entry still lists the agency as active; the
+	// certificate's revocation status must reject it anyway
+	stale, _ := authority.GetAgencyByCode(ctx, "MUP")
+	stale.Status = "active"
+
+	request := &SignedRequest{
+		ID:           types.NewID().String(),
+		Timestamp:    time.Now().UTC(),
+		SourceAgency: "MUP",
+		TargetAgency: "PURS",
+		Method:       "POST",
+		Path:         "/api/v1/verify",
+	}
+	gateway.signRequest(request)
+
+	err := gateway.VerifyRequest(ctx, request)
+	if !errors.Is(err, trust.ErrCertificateRevoked) {
+		t.Errorf("Expected ErrCertificateRevoked, got: %v", err)
+	}
+}
+
+func TestVerifyRequestDuringKeyRotation(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := trust.NewAuthority(repo)
+	authority.SetKeyOverlap(time.Hour)
+	ctx := context.Background()
+
+	agency, oldKey := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	gateway, _ := NewGateway(Config{AgencyID: agency.ID, AgencyCode: "MUP", PrivateKey: oldKey}, authority)
+
+	newRequest := func() *SignedRequest {
+		request := &SignedRequest{
+			ID:           types.NewID().String(),
+			Timestamp:    time.Now().UTC(),
+			SourceAgency: "MUP",
+			TargetAgency: "PURS",
+			Method:       "POST",
+			Path:         "/api/v1/verify",
+		}
+		gateway.signRequest(request)
+		return request
+	}
+
+	// A request signed before the rotation is still in flight
+	inFlight := newRequest()
+
+	_, nextKey, _ := ed25519.GenerateKey(rand.Reader)
+	csr, proof, _ := trust.CreateRenewal("MUP", oldKey, nextKey)
+	if _, err := authority.Renew(ctx, agency.ID, csr, proof); err != nil {
+		t.Fatalf("Failed to renew: %v", err)
+	}
+	gateway.SetKey(nextKey)
+
+	rotated := newRequest()
+	if rotated.KeyID == inFlight.KeyID {
+		t.Fatal("Expected requests to name the new key")
+	}
+	if err := gateway.VerifyRequest(ctx, inFlight); err != nil {
+		t.Errorf("Expected request signed with the previous key to verify, got: %v", err)
+	}
+	if err := gateway.VerifyRequest(ctx, rotated); err != nil {
+		t.Errorf("Expected request signed with the new key to verify, got: %v", err)
+	}
+
+	unknown := newRequest()
+	unknown.KeyID = "0000000000000000"
+	if err := gateway.VerifyRequest(ctx, unknown); err == nil {
+		t.Error("Expected error for an unknown key ID")
+	}
+}
+
+func TestVerifyRequestFromSectorAgency(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := trust.NewAuthority(repo)
+	ctx := context.Background()
+
+	if _, err := authority.IssueIntermediate(trust.SectorHealth, []string{"DZ-KI"}); err != nil {
+		t.Fatalf("Failed to issue intermediate CA: %v", err)
+	}
+	agency, privateKey := enrollAgency(t, authority, "Dom zdravlja Kikinda", "DZ-KI", "https://dz.kikinda.gov.rs/api")
+	gateway, _ := NewGateway(Config{AgencyID: agency.ID, AgencyCode: "DZ-KI", PrivateKey: privateKey}, authority)
+
+	request := &SignedRequest{
+		ID:           types.NewID().String(),
+		Timestamp:    time.Now().UTC(),
+		SourceAgency: "DZ-KI",
+		TargetAgency: "CSR-KI",
+		Method:       "POST",
+		Path:         "/api/v1/cases/share",
+	}
+	gateway.signRequest(request)
+
+	if err := gateway.VerifyRequest(ctx, request); err != nil {
+		t.Errorf("Expected request from a sector agency to verify, got: %v", err)
+	}
+
+	// A registry entry with another agency's certificate is rejected
+	other, _ := enrollAgency(t, authority, "Opšta bolnica Kikinda", "OB-KI", "https://bolnica.kikinda.gov.rs/api")
+	agency.Certificate = other.Certificate
+	if err := gateway.VerifyRequest(ctx, request); err == nil {
+		t.Error("Expected error for a certificate issued to another agency")
+	}
+}
+
 func TestCreateResponse(t *testing.T) {
 	repo := newMockRepository()
 	authority, _ := trust.NewAuthority(repo)
@@ -478,3 +909,491 @@ func TestSignedRequestFields(t *testing.T) {
 		t.Error("Correlation ID should be preserved")
 	}
 }
+
+func TestSignAndVerifyAgencySignature(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := trust.NewAuthority(repo)
+	ctx := context.Background()
+
+	agency, privateKey := enrollAgency(t, authority, "Centar za socijalni rad", "CSR-KI", "https://csr.kikinda.gov.rs/api")
+
+	gateway, _ := NewGateway(Config{AgencyID: agency.ID, AgencyCode: "CSR-KI", PrivateKey: privateKey}, authority)
+
+	payload := []byte("exchange-1|MUP|CSR-KI|hash")
+	signature := gateway.SignPayload(payload)
+
+	if err := gateway.VerifyAgencySignature(ctx, "CSR-KI", payload, signature); err != nil {
+		t.Errorf("Expected valid signature, got: %v", err)
+	}
+
+	if err := gateway.VerifyAgencySignature(ctx, "CSR-KI", []byte("tampered"), signature); err == nil {
+		t.Error("Expected error for tampered payload")
+	}
+
+	authority.SuspendAgency(ctx, agency.ID, "test")
+	if err := gateway.VerifyAgencySignature(ctx, "CSR-KI", payload, signature); err == nil {
+		t.Error("Expected error for suspended agency")
+	}
+}
+
+func TestReceiveRequestDispatchesToRegisteredService(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := trust.NewAuthority(repo)
+
+	agency, privateKey := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+
+	gateway, _ := NewGateway(Config{AgencyID: agency.ID, AgencyCode: "MUP", PrivateKey: privateKey}, authority)
+
+	localCalled := false
+	handler := NewHandler(gateway, nil)
+	handler.Grant("MUP", "documents.exchange")
+	handler.HandleRoute("POST", "/api/v1/documents/exchange", "documents.exchange", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		localCalled = true
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	var received *SignedRequest
+	handler.HandleService("/api/v1/documents/exchange", func(ctx context.Context, req *SignedRequest) (int, []byte) {
+		received = req
+		return http.StatusCreated, []byte(`{"ok":true}`)
+	})
+
+	request := &SignedRequest{
+		ID:           types.NewID().String(),
+		Timestamp:    time.Now().UTC(),
+		SourceAgency: "MUP",
+		TargetAgency: "MUP",
+		Method:       "POST",
+		Path:         "/api/v1/documents/exchange",
+		Body:         []byte(`{"document":"payload"}`),
+	}
+	gateway.signRequest(request)
+
+	body, _ := json.Marshal(request)
+	rec := httptest.NewRecorder()
+	handler.Routes().ServeHTTP(rec, httptest.NewRequest("POST", "/receive", bytes.NewReader(body)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if localCalled {
+		t.Error("Registered service should take precedence over local router")
+	}
+
+	if received == nil || string(received.Body) != `{"document":"payload"}` {
+		t.Fatal("Service handler should receive the full signed request")
+	}
+
+	var resp SignedResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected wrapped status 201, got %d", resp.StatusCode)
+	}
+
+	if err := gateway.verifyResponse(&resp, gateway.publicKey); err != nil {
+		t.Errorf("Expected signed response, got: %v", err)
+	}
+}
+
+func TestReceiveRequestForwardsToFederatedRoute(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := trust.NewAuthority(repo)
+
+	agency, privateKey := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	gateway, _ := NewGateway(Config{AgencyID: agency.ID, AgencyCode: "MUP", PrivateKey: privateKey}, authority)
+
+	var forwarded *http.Request
+	var forwardedBody []byte
+	handler := NewHandler(gateway, nil)
+	handler.Grant("MUP", "case.share")
+	err := handler.HandleRoute("POST", "/cases/{id}/share", "case.share", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r
+		forwardedBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"shared":true}`))
+	}))
+	if err != nil {
+		t.Fatalf("Failed to register federated route: %v", err)
+	}
+
+	request := &SignedRequest{
+		ID:           types.NewID().String(),
+		Timestamp:    time.Now().UTC(),
+		SourceAgency: "MUP",
+		TargetAgency: "MUP",
+		Method:       "POST",
+		Path:         "/cases/42/share",
+		Query:        "notify=true",
+		Headers: map[string]string{
+			"Content-Type":     "application/json",
+			"X-Access-Purpose": "case transfer",
+			"Authorization":    "Bearer forged",
+		},
+		Body: []byte(`{"target_agency":"CSR"}`),
+	}
+	gateway.signRequest(request)
+	body, _ := json.Marshal(request)
+
+	rec := httptest.NewRecorder()
+	handler.Routes().ServeHTTP(rec, httptest.NewRequest("POST", "/receive", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp SignedResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.StatusCode != http.StatusCreated || string(resp.Body) != `{"shared":true}` {
+		t.Fatalf("Expected the local handler's response, got %d %s", resp.StatusCode, resp.Body)
+	}
+
+	if string(forwardedBody) != `{"target_agency":"CSR"}` {
+		t.Errorf("Expected body to be forwarded, got %q", forwardedBody)
+	}
+	if forwarded.URL.Query().Get("notify") != "true" {
+		t.Errorf("Expected query to be forwarded, got %q", forwarded.URL.RawQuery)
+	}
+	if chi.URLParam(forwarded, "id") != "42" {
+		t.Errorf("Expected route parameter 42, got %q", chi.URLParam(forwarded, "id"))
+	}
+	if forwarded.Header.Get("Content-Type") != "application/json" || forwarded.Header.Get("X-Access-Purpose") != "case transfer" {
+		t.Errorf("Expected allow-listed headers to be forwarded, got %v", forwarded.Header)
+	}
+	if forwarded.Header.Get("Authorization") != "" {
+		t.Error("Authorization header should not be forwarded")
+	}
+	if forwarded.Header.Get("X-Federation-Source") != "MUP" {
+		t.Errorf("Expected X-Federation-Source MUP, got %q", forwarded.Header.Get("X-Federation-Source"))
+	}
+
+	user := auth.GetUser(forwarded.Context())
+	if user == nil || !user.IsAgency() || user.AgencyCode != "MUP" || user.AgencyID != agency.ID {
+		t.Errorf("Expected the remote agency in the auth context, got %+v", user)
+	}
+	if user != nil && (user.IsAdmin() || len(user.Roles) > 0 || !user.HasPermission("case.share")) {
+		t.Errorf("Remote agency should have its granted permissions and no roles, got %+v", user)
+	}
+}
+
+func TestReceiveRequestRejectsUnfederatedRoutes(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := trust.NewAuthority(repo)
+
+	agency, privateKey := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	gateway, _ := NewGateway(Config{AgencyID: agency.ID, AgencyCode: "MUP", PrivateKey: privateKey}, authority)
+
+	// The local API, with the gateway mounted as in the platform
+	localCalled := false
+	local := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		localCalled = true
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := NewHandler(gateway, nil)
+	handler.Grant("MUP", "case.read")
+	handler.HandleRoute("GET", "/cases/{id}", "case.read", local)
+	handler.HandleRoute("POST", "/cases/{id}/share", "case.share", local)
+	api := chi.NewRouter()
+	api.Use(auth.Middleware(config.AuthConfig{JWTSecret: "test-secret"}))
+	api.Delete("/cases/{id}", local)
+	api.Mount(GatewayPathPrefix, handler.Routes())
+
+	if err := handler.HandleRoute("POST", GatewayPathPrefix+"/send", "case.read", local); !errors.Is(err, ErrGatewayRoute) {
+		t.Errorf("Expected ErrGatewayRoute registering a gateway route, got: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{"non-federated route", "DELETE", "/cases/42", http.StatusNotFound},
+		{"gateway send", "POST", GatewayPathPrefix + "/send", http.StatusForbidden},
+		{"gateway send via dot segments", "POST", "/cases/../federation/gateway/send", http.StatusForbidden},
+		{"permission not granted", "POST", "/cases/42/share", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localCalled = false
+			request := &SignedRequest{
+				ID:           types.NewID().String(),
+				Timestamp:    time.Now().UTC(),
+				SourceAgency: "MUP",
+				TargetAgency: "MUP",
+				Method:       tt.method,
+				Path:         tt.path,
+				Body:         []byte(`{"target_agency":"CSR","method":"GET","path":"/cases"}`),
+			}
+			gateway.signRequest(request)
+			body, _ := json.Marshal(request)
+
+			rec := httptest.NewRecorder()
+			handler.Routes().ServeHTTP(rec, httptest.NewRequest("POST", "/receive", bytes.NewReader(body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+
+			var resp SignedResponse
+			json.Unmarshal(rec.Body.Bytes(), &resp)
+			if resp.StatusCode != tt.status {
+				t.Errorf("Expected wrapped status %d, got %d: %s", tt.status, resp.StatusCode, resp.Body)
+			}
+			if localCalled {
+				t.Error("Local handler should not be called")
+			}
+		})
+	}
+
+	// The federated route itself is reachable
+	request := &SignedRequest{
+		ID:           types.NewID().String(),
+		Timestamp:    time.Now().UTC(),
+		SourceAgency: "MUP",
+		TargetAgency: "MUP",
+		Method:       "GET",
+		Path:         "/cases/42",
+	}
+	gateway.signRequest(request)
+	body, _ := json.Marshal(request)
+	rec := httptest.NewRecorder()
+	handler.Routes().ServeHTTP(rec, httptest.NewRequest("POST", "/receive", bytes.NewReader(body)))
+	var resp SignedResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.StatusCode != http.StatusOK || !localCalled {
+		t.Errorf("Expected the granted federated route to be called, got %d", resp.StatusCode)
+	}
+
+	// Local routes still require a token; agencies cannot bypass it
+	rec = httptest.NewRecorder()
+	ctx := auth.WithUser(context.Background(), auth.NewAgencyUser(agency.ID, "MUP", []string{"case.read"}))
+	api.ServeHTTP(rec, httptest.NewRequest("DELETE", "/cases/42", nil).WithContext(ctx))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for an agency user without a token, got %d", rec.Code)
+	}
+}
+
+func TestVerifyRequestWithTamperedQueryOrHeaders(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := trust.NewAuthority(repo)
+	ctx := context.Background()
+
+	agency, privateKey := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	gateway, _ := NewGateway(Config{AgencyID: agency.ID, AgencyCode: "MUP", PrivateKey: privateKey}, authority)
+
+	newRequest := func() *SignedRequest {
+		request := &SignedRequest{
+			ID:           types.NewID().String(),
+			Timestamp:    time.Now().UTC(),
+			SourceAgency: "MUP",
+			TargetAgency: "MUP",
+			Method:       "GET",
+			Path:         "/cases",
+			Query:        "status=open",
+			Headers:      map[string]string{"X-Access-Purpose": "case review"},
+		}
+		gateway.signRequest(request)
+		return request
+	}
+
+	tampered := newRequest()
+	tampered.Query = "status=closed"
+	if err := gateway.VerifyRequest(ctx, tampered); err == nil {
+		t.Error("Expected verification to fail for a tampered query")
+	}
+
+	tampered = newRequest()
+	tampered.Headers["X-Access-Purpose"] = "statistics"
+	if err := gateway.VerifyRequest(ctx, tampered); err == nil {
+		t.Error("Expected verification to fail for a tampered header")
+	}
+
+	tampered = newRequest()
+	tampered.Headers["Accept-Language"] = "sr"
+	if err := gateway.VerifyRequest(ctx, tampered); err == nil {
+		t.Error("Expected verification to fail for an added header")
+	}
+
+	tampered = newRequest()
+	tampered.Headers["x-access-purpose"] = "statistics"
+	if err := gateway.VerifyRequest(ctx, tampered); err == nil {
+		t.Error("Expected verification to fail for a header given twice")
+	}
+
+	if err := gateway.VerifyRequest(ctx, newRequest()); err != nil {
+		t.Errorf("Expected untampered request to verify, got: %v", err)
+	}
+}
+
+func TestVerifyRequestRejectsAmbiguousFields(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := trust.NewAuthority(repo)
+	ctx := context.Background()
+
+	agency, privateKey := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	gateway, _ := NewGateway(Config{AgencyID: agency.ID, AgencyCode: "MUP", PrivateKey: privateKey}, authority)
+
+	sign := func(request *SignedRequest) *SignedRequest {
+		request.ID = types.NewID().String()
+		request.Timestamp = time.Now().UTC()
+		request.SourceAgency = "MUP"
+		request.TargetAgency = "MUP"
+		request.Method = "GET"
+		if err := gateway.signRequest(request); err != nil {
+			t.Fatalf("Failed to sign request: %v", err)
+		}
+		return request
+	}
+
+	tests := []struct {
+		name   string
+		signed *SignedRequest
+		forge  func(r *SignedRequest)
+	}{
+		{
+			// A line break in a value would forge a second header line
+			name: "header line break",
+			signed: sign(&SignedRequest{Path: "/cases", Headers: map[string]string{
+				"X-Access-Purpose": "case review",
+				"X-Forwarded-User": "admin",
+			}}),
+			forge: func(r *SignedRequest) {
+				r.Headers = map[string]string{"X-Access-Purpose": "case review\nX-Forwarded-User:admin"}
+			},
+		},
+		{
+			name:   "header name separator",
+			signed: sign(&SignedRequest{Path: "/cases", Headers: map[string]string{"X-Access-Purpose": "case:review"}}),
+			forge: func(r *SignedRequest) {
+				r.Headers = map[string]string{"X-Access-Purpose:case": "review"}
+			},
+		},
+		{
+			// "/a?b" with no query would read as path "/a" and query "b"
+			name:   "query in path",
+			signed: sign(&SignedRequest{Path: "/cases", Query: "status=open"}),
+			forge: func(r *SignedRequest) {
+				r.Path, r.Query = "/cases?status=open", ""
+			},
+		},
+		{
+			name:   "field separator in path",
+			signed: sign(&SignedRequest{Path: "/cases", Body: []byte(`{}`)}),
+			forge: func(r *SignedRequest) {
+				bodyHash := sha256.Sum256(r.Body)
+				r.Path, r.Body = "/cases|"+base64.StdEncoding.EncodeToString(bodyHash[:]), nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forged := *tt.signed
+			tt.forge(&forged)
+			if err := gateway.VerifyRequest(ctx, &forged); err == nil {
+				t.Error("Expected verification to fail for a forged request")
+			}
+			if err := gateway.signRequest(&forged); err == nil {
+				t.Error("Expected signing to fail for an ambiguous request")
+			}
+			if err := gateway.VerifyRequest(ctx, tt.signed); err != nil {
+				t.Errorf("Expected the signed request to verify, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestReceiveRequestRejectsOversizedBody(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := trust.NewAuthority(repo)
+
+	agency, privateKey := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	gateway, _ := NewGateway(Config{AgencyID: agency.ID, AgencyCode: "MUP", PrivateKey: privateKey}, authority)
+	gateway.SetMaxBodySize(16)
+	handler := NewHandler(gateway, nil)
+
+	payload := []byte(`{"document":"larger than sixteen bytes"}`)
+	if _, err := gateway.SendRequest(context.Background(), "MUP", "POST", "/cases", payload); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("Expected ErrBodyTooLarge when sending, got: %v", err)
+	}
+
+	request := &SignedRequest{
+		ID:           types.NewID().String(),
+		Timestamp:    time.Now().UTC(),
+		SourceAgency: "MUP",
+		TargetAgency: "MUP",
+		Method:       "POST",
+		Path:         "/cases",
+		Body:         payload,
+	}
+	gateway.signRequest(request)
+	body, _ := json.Marshal(request)
+
+	rec := httptest.NewRecorder()
+	handler.Routes().ServeHTTP(rec, httptest.NewRequest("POST", "/receive", bytes.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status 413, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp["code"] != CodeBodyTooLarge {
+		t.Errorf("Expected code %s, got %v", CodeBodyTooLarge, resp["code"])
+	}
+
+	// Envelopes too large to carry an allowed body are not read in full
+	rec = httptest.NewRecorder()
+	handler.Routes().ServeHTTP(rec, httptest.NewRequest("POST", "/receive", bytes.NewReader(make([]byte, 2*envelopeOverhead))))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for an oversized envelope, got %d", rec.Code)
+	}
+}
+
+func TestLoadOrCreateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "federation", "gateway.key")
+
+	key, created, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatalf("Failed to create gateway key: %v", err)
+	}
+	if !created {
+		t.Error("Expected gateway key to be created")
+	}
+
+	reloaded, created, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatalf("Failed to load gateway key: %v", err)
+	}
+	if created {
+		t.Error("Expected existing gateway key to be loaded")
+	}
+	if !key.Equal(reloaded) {
+		t.Error("Expected the same gateway key after reload")
+	}
+
+	// The agency enrolls with its own key and signs with it after a restart
+	repo := newMockRepository()
+	authority, _ := trust.NewAuthority(repo)
+	ctx := context.Background()
+
+	_, token, _ := authority.CreateEnrollment(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway", 0)
+	csr, _ := trust.CreateCSR("MUP", key)
+	agency, err := authority.Enroll(ctx, token, csr)
+	if err != nil {
+		t.Fatalf("Failed to enroll: %v", err)
+	}
+
+	gateway, _ := NewGateway(Config{AgencyID: agency.ID, AgencyCode: "MUP", PrivateKey: reloaded}, authority)
+	request := &SignedRequest{
+		ID:           types.NewID().String(),
+		Timestamp:    time.Now().UTC(),
+		SourceAgency: "MUP",
+		TargetAgency: "PURS",
+		Method:       "GET",
+		Path:         "/api/v1/status",
+	}
+	gateway.signRequest(request)
+	if err := gateway.VerifyRequest(ctx, request); err != nil {
+		t.Errorf("Expected request signed with the enrolled key to verify, got: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// LoadKey loads the gateway's Ed25519 private key (PEM PKCS#8)
+func LoadKey(path string) (ed25519.PrivateKey, error) {
+	keyPEM, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gateway key: %w", err)
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("no PEM PKCS#8 private key in %s", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse gateway key: %w", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported gateway key type %T, Ed25519 is required", parsed)
+	}
+	return key, nil
+}
+
+// LoadOrCreateKey loads the gateway key, or generates it and writes it when
+// the file does not exist. The key never leaves the agency; the Trust
+// Authority only sees it in a certificate signing request.
+func LoadOrCreateKey(path string) (key ed25519.PrivateKey, created bool, err error) {
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		key, err = LoadKey(path)
+		return key, false, err
+	}
+
+	_, key, err = ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to generate gateway key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode gateway key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, false, fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		return nil, false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return key, true, f.Close()
+}
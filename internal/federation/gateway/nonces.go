@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultNonceCapacity bounds how many request IDs the in-memory nonce store
+// keeps; it must hold every request accepted within the clock-skew window
+const DefaultNonceCapacity = 100000
+
+// ErrNonceStoreFull is returned when the in-memory nonce store holds its
+// capacity of unexpired request IDs. Requests are then refused rather than
+// forgetting IDs that could be replayed.
+var ErrNonceStoreFull = errors.New("nonce store full")
+
+// NonceStore remembers the IDs of accepted requests until they fall out of
+// the clock-skew window, so that each request is accepted once
+type NonceStore interface {
+	// Remember records the request ID of a source agency until expiresAt.
+	// It reports false when the ID is already recorded and not yet expired.
+	Remember(ctx context.Context, sourceAgency, requestID string, expiresAt time.Time) (bool, error)
+	// Purge forgets request IDs that expired before now
+	Purge(ctx context.Context, now time.Time) error
+}
+
+// MemoryNonceStore keeps request IDs in memory, for a single gateway
+type MemoryNonceStore struct {
+	mu       sync.Mutex
+	capacity int
+	nonces   map[string]time.Time // expiry by source agency and request ID
+}
+
+// NewMemoryNonceStore creates an in-memory nonce store holding at most
+// capacity request IDs; zero uses DefaultNonceCapacity
+func NewMemoryNonceStore(capacity int) *MemoryNonceStore {
+	if capacity <= 0 {
+		capacity = DefaultNonceCapacity
+	}
+	return &MemoryNonceStore{
+		capacity: capacity,
+		nonces:   make(map[string]time.Time),
+	}
+}
+
+// Remember records a request ID, purging expired IDs when the store is full
+func (s *MemoryNonceStore) Remember(ctx context.Context, sourceAgency, requestID string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	key := sourceAgency + "|" + requestID
+	if expiry, ok := s.nonces[key]; ok && now.Before(expiry) {
+		return false, nil
+	}
+
+	if len(s.nonces) >= s.capacity {
+		s.purge(now)
+		if len(s.nonces) >= s.capacity {
+			return false, fmt.Errorf("%w: %d unexpired request IDs", ErrNonceStoreFull, len(s.nonces))
+		}
+	}
+	s.nonces[key] = expiresAt
+	return true, nil
+}
+
+// Purge forgets request IDs that expired before now
+func (s *MemoryNonceStore) Purge(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge(now)
+	return nil
+}
+
+// purge deletes expired request IDs. The caller holds the lock.
+func (s *MemoryNonceStore) purge(now time.Time) {
+	for key, expiry := range s.nonces {
+		if !now.Before(expiry) {
+			delete(s.nonces, key)
+		}
+	}
+}
+
+// Len returns the number of request IDs held
+func (s *MemoryNonceStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.nonces)
+}
+
+// PostgresNonceStore keeps request IDs in PostgreSQL, so that gateways
+// behind a load balancer reject a request replayed to any of them
+type PostgresNonceStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresNonceStore creates a PostgreSQL nonce store
+func NewPostgresNonceStore(pool *pgxpool.Pool) *PostgresNonceStore {
+	return &PostgresNonceStore{pool: pool}
+}
+
+// Remember inserts a request ID; an existing row is taken over only when it
+// has expired
+func (s *PostgresNonceStore) Remember(ctx context.Context, sourceAgency, requestID string, expiresAt time.Time) (bool, error) {
+	query := `
+		INSERT INTO federation.gateway_nonces (source_agency, request_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (source_agency, request_id) DO UPDATE SET
+			expires_at = EXCLUDED.expires_at,
+			received_at = NOW()
+		WHERE federation.gateway_nonces.expires_at <= NOW()
+	`
+
+	tag, err := s.pool.Exec(ctx, query, sourceAgency, requestID, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to record request nonce: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// Purge deletes request IDs that expired before now
+func (s *PostgresNonceStore) Purge(ctx context.Context, now time.Time) error {
+	query := `DELETE FROM federation.gateway_nonces WHERE expires_at <= $1`
+
+	if _, err := s.pool.Exec(ctx, query, now); err != nil {
+		return fmt.Errorf("failed to purge request nonces: %w", err)
+	}
+
+	return nil
+}
@@ -1,8 +1,14 @@
 package trust
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	stderrors "errors"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/serbia-gov/platform/internal/shared/auth"
@@ -26,11 +32,19 @@ func (h *Handler) Routes() chi.Router {
 
 	// Agency registry
 	r.Get("/agencies", h.ListAgencies)
-	r.Post("/agencies", h.RegisterAgency)
 	r.Get("/agencies/{agencyID}", h.GetAgency)
 	r.Post("/agencies/{agencyID}/suspend", h.SuspendAgency)
 	r.Post("/agencies/{agencyID}/revoke", h.RevokeAgency)
 
+	// Renewal: the agency signs a CSR for its current or next key with the
+	// current key
+	r.Post("/agencies/{agencyID}/renew", h.RenewAgency)
+
+	// Enrollment: an admin issues a one-time token, the agency submits it
+	// with a certificate signing request for its own key
+	r.Post("/enrollments", h.CreateEnrollment)
+	r.Post("/enroll", h.Enroll)
+
 	// Service catalog
 	r.Get("/agencies/{agencyID}/services", h.GetServices)
 	r.Post("/agencies/{agencyID}/services", h.RegisterService)
@@ -38,17 +52,52 @@ func (h *Handler) Routes() chi.Router {
 
 	// Certificates
 	r.Get("/ca/certificate", h.GetRootCertificate)
+	r.Get("/ca/chain", h.GetCAChain)
+	r.Post("/ca/rotate", h.RotateRoot)
+	r.Get("/ca/intermediates", h.ListIntermediates)
+	r.Post("/ca/intermediates", h.IssueIntermediate)
 	r.Post("/verify", h.VerifyCertificate)
 
 	return r
 }
 
+// RevocationRoutes registers the unauthenticated revocation endpoints that
+// issued certificates point to: the CRLs of the root and of each sector
+// intermediate CA, and the OCSP responder (RFC 6960 POST, and GET with the
+// base64 request in the path)
+func (h *Handler) RevocationRoutes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/crl", h.GetCRL)
+	r.Get("/crl/{sector}", h.GetCRL)
+	r.Post("/ocsp", h.OCSP)
+	r.Get("/ocsp/*", h.OCSP)
+
+	return r
+}
+
 // --- Request types ---
 
-type RegisterAgencyRequest struct {
+type CreateEnrollmentRequest struct {
 	Name       string `json:"name"`
 	Code       string `json:"code"`
 	GatewayURL string `json:"gateway_url"`
+	TTLHours   int    `json:"ttl_hours,omitempty"`
+}
+
+type EnrollRequest struct {
+	Token string `json:"token"`
+	CSR   string `json:"csr"` // PEM encoded PKCS#10
+}
+
+type RenewRequest struct {
+	CSR   string `json:"csr"`   // PEM encoded PKCS#10
+	Proof string `json:"proof"` // base64 Ed25519 signature over the CSR (DER) by the current key
+}
+
+type IssueIntermediateRequest struct {
+	Sector string   `json:"sector"`
+	Codes  []string `json:"codes"` // agency codes the intermediate may issue for
 }
 
 type RegisterServiceRequest struct {
@@ -80,15 +129,15 @@ func (h *Handler) ListAgencies(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (h *Handler) RegisterAgency(w http.ResponseWriter, r *http.Request) {
-	// Only admins can register agencies
+func (h *Handler) CreateEnrollment(w http.ResponseWriter, r *http.Request) {
+	// Only admins can authorize agencies to enroll
 	user := auth.GetUser(r.Context())
 	if user != nil && !user.IsAdmin() {
 		writeError(w, errors.Forbidden("admin access required"))
 		return
 	}
 
-	var req RegisterAgencyRequest
+	var req CreateEnrollmentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, errors.BadRequest("invalid request body"))
 		return
@@ -99,12 +148,42 @@ func (h *Handler) RegisterAgency(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	agency, err := h.authority.RegisterAgency(r.Context(), req.Name, req.Code, req.GatewayURL)
+	ttl := time.Duration(req.TTLHours) * time.Hour
+	enrollment, token, err := h.authority.CreateEnrollment(r.Context(), req.Name, req.Code, req.GatewayURL, ttl)
 	if err != nil {
 		writeError(w, errors.BadRequest(err.Error()))
 		return
 	}
 
+	// The token is shown only once
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"enrollment": enrollment,
+		"token":      token,
+	})
+}
+
+func (h *Handler) Enroll(w http.ResponseWriter, r *http.Request) {
+	var req EnrollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+
+	if req.Token == "" || req.CSR == "" {
+		writeError(w, errors.BadRequest("token and csr are required"))
+		return
+	}
+
+	agency, err := h.authority.Enroll(r.Context(), req.Token, []byte(req.CSR))
+	if err != nil {
+		if stderrors.Is(err, ErrEnrollmentToken) {
+			writeError(w, errors.Forbidden(err.Error()))
+			return
+		}
+		writeError(w, errors.BadRequest(err.Error()))
+		return
+	}
+
 	writeJSON(w, http.StatusCreated, agency)
 }
 
@@ -186,6 +265,37 @@ func (h *Handler) RevokeAgency(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
 }
 
+func (h *Handler) RenewAgency(w http.ResponseWriter, r *http.Request) {
+	id, err := types.ParseID(chi.URLParam(r, "agencyID"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid agency ID"))
+		return
+	}
+
+	var req RenewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+
+	if req.CSR == "" || req.Proof == "" {
+		writeError(w, errors.BadRequest("csr and proof are required"))
+		return
+	}
+
+	agency, err := h.authority.Renew(r.Context(), id, []byte(req.CSR), req.Proof)
+	if err != nil {
+		if stderrors.Is(err, ErrRenewalProof) || stderrors.Is(err, ErrCertificateRevoked) {
+			writeError(w, errors.Forbidden(err.Error()))
+			return
+		}
+		writeError(w, errors.BadRequest(err.Error()))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, agency)
+}
+
 func (h *Handler) GetServices(w http.ResponseWriter, r *http.Request) {
 	id, err := types.ParseID(chi.URLParam(r, "agencyID"))
 	if err != nil {
@@ -249,6 +359,112 @@ func (h *Handler) GetRootCertificate(w http.ResponseWriter, r *http.Request) {
 	w.Write(cert)
 }
 
+func (h *Handler) GetCAChain(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("Content-Disposition", "attachment; filename=ca-chain.pem")
+	w.Write(h.authority.CAChainPEM())
+}
+
+func (h *Handler) RotateRoot(w http.ResponseWriter, r *http.Request) {
+	// Only admins can rotate the root CA
+	user := auth.GetUser(r.Context())
+	if user != nil && !user.IsAdmin() {
+		writeError(w, errors.Forbidden("admin access required"))
+		return
+	}
+
+	rotation, err := h.authority.RotateRoot(r.Context())
+	if err != nil {
+		writeError(w, errors.Internal(err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rotation)
+}
+
+func (h *Handler) ListIntermediates(w http.ResponseWriter, r *http.Request) {
+	intermediates := h.authority.Intermediates()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data":  intermediates,
+		"total": len(intermediates),
+	})
+}
+
+func (h *Handler) IssueIntermediate(w http.ResponseWriter, r *http.Request) {
+	// Only admins can issue intermediate CAs
+	user := auth.GetUser(r.Context())
+	if user != nil && !user.IsAdmin() {
+		writeError(w, errors.Forbidden("admin access required"))
+		return
+	}
+
+	var req IssueIntermediateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+
+	ca, err := h.authority.IssueIntermediate(req.Sector, req.Codes)
+	if stderrors.Is(err, ErrUnknownSector) || stderrors.Is(err, ErrSectorPolicy) {
+		writeError(w, errors.BadRequest(err.Error()))
+		return
+	}
+	if err != nil {
+		writeError(w, errors.Internal(err))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, ca)
+}
+
+func (h *Handler) GetCRL(w http.ResponseWriter, r *http.Request) {
+	crl, err := h.authority.SectorCRL(chi.URLParam(r, "sector"))
+	if stderrors.Is(err, ErrUnknownSector) {
+		writeError(w, errors.NotFound("CRL", chi.URLParam(r, "sector")))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pkix-crl")
+	w.Header().Set("Cache-Control", "max-age=3600")
+	w.Write(crl)
+}
+
+func (h *Handler) OCSP(w http.ResponseWriter, r *http.Request) {
+	var request []byte
+	if r.Method == http.MethodGet {
+		encoded, err := url.PathUnescape(strings.TrimPrefix(chi.URLParam(r, "*"), "/"))
+		if err != nil {
+			writeError(w, errors.BadRequest("invalid OCSP request encoding"))
+			return
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			writeError(w, errors.BadRequest("invalid OCSP request encoding"))
+			return
+		}
+		request = decoded
+	} else {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+		if err != nil {
+			writeError(w, errors.BadRequest("invalid OCSP request"))
+			return
+		}
+		request = body
+	}
+
+	response, err := h.authority.OCSPResponse(request)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.Write(response)
+}
+
 func (h *Handler) VerifyCertificate(w http.ResponseWriter, r *http.Request) {
 	var req VerifyCertificateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
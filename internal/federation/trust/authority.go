@@ -2,6 +2,7 @@ package trust
 
 import (
 	"context"
+	"crypto"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/x509"
@@ -9,10 +10,13 @@ import (
 	"encoding/pem"
 	"fmt"
 	"math/big"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/serbia-gov/platform/internal/shared/types"
+	"golang.org/x/crypto/ocsp"
 )
 
 // TrustedAgency represents an agency registered with the Trust Authority
@@ -23,9 +27,13 @@ type TrustedAgency struct {
 	GatewayURL   string    `json:"gateway_url"`
 	PublicKey    []byte    `json:"public_key"`
 	Certificate  []byte    `json:"certificate"`
+	KeyID        string    `json:"key_id"`
 	Status       string    `json:"status"` // active, suspended, revoked
 	RegisteredAt time.Time `json:"registered_at"`
 	LastSeenAt   time.Time `json:"last_seen_at"`
+
+	// PreviousKeys are replaced keys that still verify signatures until they retire
+	PreviousKeys []AgencyKey `json:"previous_keys,omitempty"`
 }
 
 // ServiceEndpoint represents a service offered by an agency
@@ -41,11 +49,31 @@ type ServiceEndpoint struct {
 // Authority manages trust relationships between agencies
 type Authority struct {
 	mu         sync.RWMutex
-	rootKey    ed25519.PrivateKey
+	rootKey    crypto.Signer
 	rootCert   *x509.Certificate
 	agencies   map[types.ID]*TrustedAgency
 	services   map[types.ID][]ServiceEndpoint
 	repository Repository
+
+	enrollments   map[string]*Enrollment // by token hash, without a repository
+	enrollmentTTL time.Duration
+
+	revocations map[string]*Revocation // by certificate serial (hex)
+	crlURL      string
+	ocspURL     string
+	published   publishedStatus // CRL and OCSP responder of the root CA
+
+	keyOverlap    time.Duration
+	renewBefore   time.Duration
+	expiryHandler func(ctx context.Context, expiry CertificateExpiry)
+
+	previousRoots []*x509.Certificate // retired roots, still trusted for their certificates
+	crossCerts    []*x509.Certificate // cross certificates between roots
+	rootCertPath  string
+	rootKeyPath   string
+
+	intermediates   map[string]*IntermediateCA // by sector
+	intermediateDir string
 }
 
 // Repository interface for Trust Authority persistence
@@ -60,108 +88,82 @@ type Repository interface {
 	SaveService(ctx context.Context, service *ServiceEndpoint) error
 	GetServices(ctx context.Context, agencyID types.ID) ([]ServiceEndpoint, error)
 	GetServicesByType(ctx context.Context, serviceType string) ([]ServiceEndpoint, error)
+
+	SaveEnrollment(ctx context.Context, enrollment *Enrollment) error
+	GetEnrollmentByToken(ctx context.Context, tokenHash string) (*Enrollment, error)
+	GetPendingEnrollment(ctx context.Context, code string, now time.Time) (*Enrollment, error)
+	// EnrollAgency marks an enrollment used and saves the enrolled agency and
+	// its key, all or nothing; it fails with ErrEnrollmentToken when the
+	// enrollment already was used
+	EnrollAgency(ctx context.Context, enrollmentID types.ID, agency *TrustedAgency, key *AgencyKey) error
+
+	SaveRevocation(ctx context.Context, revocation *Revocation) error
+	ListRevocations(ctx context.Context) ([]Revocation, error)
+
+	SaveAgencyKey(ctx context.Context, agencyID types.ID, key *AgencyKey) error
+	ListAgencyKeys(ctx context.Context, agencyID types.ID) ([]AgencyKey, error)
+
+	SaveCACertificate(ctx context.Context, cert *CACertificate) error
+	ListCACertificates(ctx context.Context) ([]CACertificate, error)
 }
 
-// NewAuthority creates a new Trust Authority
+// NewAuthority creates a new Trust Authority with a newly generated root CA
 func NewAuthority(repo Repository) (*Authority, error) {
 	// Generate root CA keypair for MVP (in production, use HSM)
-	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+	cert, key, err := generateRootCA(rootCommonName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate root key: %w", err)
-	}
-
-	// Create self-signed root certificate
-	template := &x509.Certificate{
-		SerialNumber: big.NewInt(1),
-		Subject: pkix.Name{
-			Organization:  []string{"Serbia Government"},
-			Country:       []string{"RS"},
-			Province:      []string{"Belgrade"},
-			Locality:      []string{"Belgrade"},
-			StreetAddress: []string{""},
-			PostalCode:    []string{""},
-			CommonName:    "Serbia Gov Interoperability Root CA",
-		},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(10, 0, 0), // 10 years
-		IsCA:                  true,
-		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
-		BasicConstraintsValid: true,
-		MaxPathLen:            2,
+		return nil, err
 	}
 
-	certDER, err := x509.CreateCertificate(rand.Reader, template, template, pubKey, privKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create root certificate: %w", err)
-	}
+	return NewAuthorityWithRoot(repo, cert, key)
+}
 
-	cert, err := x509.ParseCertificate(certDER)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse root certificate: %w", err)
+// NewAuthorityWithRoot creates a Trust Authority that issues certificates
+// with an existing root CA
+func NewAuthorityWithRoot(repo Repository, rootCert *x509.Certificate, rootKey crypto.Signer) (*Authority, error) {
+	if rootCert == nil || rootKey == nil {
+		return nil, fmt.Errorf("root certificate and key are required")
 	}
 
 	return &Authority{
-		rootKey:    privKey,
-		rootCert:   cert,
-		agencies:   make(map[types.ID]*TrustedAgency),
-		services:   make(map[types.ID][]ServiceEndpoint),
-		repository: repo,
+		rootKey:       rootKey,
+		rootCert:      rootCert,
+		agencies:      make(map[types.ID]*TrustedAgency),
+		services:      make(map[types.ID][]ServiceEndpoint),
+		repository:    repo,
+		enrollments:   make(map[string]*Enrollment),
+		enrollmentTTL: DefaultEnrollmentTTL,
+		revocations:   make(map[string]*Revocation),
+		intermediates: make(map[string]*IntermediateCA),
+		keyOverlap:    DefaultKeyOverlap,
+		renewBefore:   DefaultRenewBefore,
+		expiryHandler: func(ctx context.Context, expiry CertificateExpiry) {
+			fmt.Printf("Warning: certificate of agency %s (key %s) expires on %s, renew it\n",
+				expiry.AgencyCode, expiry.KeyID, expiry.NotAfter.Format("2006-01-02"))
+		},
 	}, nil
 }
 
-// RegisterAgency registers a new agency and issues a certificate
-func (a *Authority) RegisterAgency(ctx context.Context, name, code, gatewayURL string) (*TrustedAgency, error) {
-	a.mu.Lock()
-	defer a.mu.Unlock()
-
-	// Check if agency code already exists
-	if a.repository != nil {
-		existing, _ := a.repository.GetAgencyByCode(ctx, code)
-		if existing != nil {
-			return nil, fmt.Errorf("agency with code %s already registered", code)
-		}
-	}
-
-	// Generate keypair for agency
-	pubKey, _, err := ed25519.GenerateKey(rand.Reader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate agency key: %w", err)
-	}
-
-	// Issue certificate for agency
-	cert, err := a.issueCertificate(name, code, pubKey)
+// issueCertificate issues a certificate for an agency, by the intermediate CA
+// of its sector or, for agencies outside the sectors, by the root CA. The
+// caller holds the lock.
+func (a *Authority) issueCertificate(name, code string, pubKey ed25519.PublicKey) ([]byte, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 	if err != nil {
-		return nil, fmt.Errorf("failed to issue certificate: %w", err)
-	}
-
-	agency := &TrustedAgency{
-		ID:           types.NewID(),
-		Name:         name,
-		Code:         code,
-		GatewayURL:   gatewayURL,
-		PublicKey:    pubKey,
-		Certificate:  cert,
-		Status:       "active",
-		RegisteredAt: time.Now(),
-		LastSeenAt:   time.Now(),
+		return nil, err
 	}
 
-	a.agencies[agency.ID] = agency
-
-	if a.repository != nil {
-		if err := a.repository.SaveAgency(ctx, agency); err != nil {
-			return nil, fmt.Errorf("failed to save agency: %w", err)
+	issuer, issuerKey, crlURL := a.rootCert, a.rootKey, a.crlURL
+	if ca := a.sectorCA(code); ca != nil {
+		issuer, issuerKey = ca.cert, ca.key
+		if crlURL != "" {
+			crlURL += "/" + ca.Sector
 		}
 	}
 
-	return agency, nil
-}
-
-// issueCertificate issues a certificate for an agency
-func (a *Authority) issueCertificate(name, code string, pubKey ed25519.PublicKey) ([]byte, error) {
-	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
-	if err != nil {
-		return nil, err
+	notAfter := time.Now().AddDate(1, 0, 0) // 1 year validity
+	if issuer.NotAfter.Before(notAfter) {
+		notAfter = issuer.NotAfter
 	}
 
 	template := &x509.Certificate{
@@ -171,14 +173,24 @@ func (a *Authority) issueCertificate(name, code string, pubKey ed25519.PublicKey
 			Country:      []string{"RS"},
 			CommonName:   code + ".gov.rs",
 		},
+		// Name constraints of intermediate CAs apply to this name
+		DNSNames:              []string{agencyDomain(code)},
 		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(1, 0, 0), // 1 year validity
+		NotAfter:              notAfter,
 		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
 		BasicConstraintsValid: true,
 	}
 
-	certDER, err := x509.CreateCertificate(rand.Reader, template, a.rootCert, pubKey, a.rootKey)
+	// Relying parties learn about revocation from these
+	if crlURL != "" {
+		template.CRLDistributionPoints = []string{crlURL}
+	}
+	if a.ocspURL != "" {
+		template.OCSPServer = []string{a.ocspURL}
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, issuer, pubKey, issuerKey)
 	if err != nil {
 		return nil, err
 	}
@@ -261,6 +273,9 @@ func (a *Authority) SuspendAgency(ctx context.Context, id types.ID, reason strin
 	}
 
 	agency.Status = "suspended"
+	if err := a.revokeAgencyCertificates(ctx, agency, ocsp.CertificateHold, reason); err != nil {
+		return err
+	}
 
 	if a.repository != nil {
 		return a.repository.UpdateAgency(ctx, agency)
@@ -288,6 +303,9 @@ func (a *Authority) RevokeAgency(ctx context.Context, id types.ID, reason string
 	}
 
 	agency.Status = "revoked"
+	if err := a.revokeAgencyCertificates(ctx, agency, ocsp.Unspecified, reason); err != nil {
+		return err
+	}
 
 	if a.repository != nil {
 		return a.repository.UpdateAgency(ctx, agency)
@@ -353,32 +371,86 @@ func (a *Authority) FindService(ctx context.Context, serviceType string) ([]Serv
 	return results, nil
 }
 
-// VerifyCertificate verifies an agency's certificate
+// VerifyCertificate verifies an agency's certificate against the root CA,
+// through the intermediate CA of its sector if it has one, and the
+// revocations recorded by this authority
 func (a *Authority) VerifyCertificate(certPEM []byte) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	cert, err := a.verifyChain(certPEM)
+	if err != nil {
+		return err
+	}
+
+	if revocation, revoked := a.revocations[cert.SerialNumber.Text(16)]; revoked {
+		return fmt.Errorf("%w: %s at %s", ErrCertificateRevoked, cert.Subject.CommonName, revocation.RevokedAt.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// VerifyChain verifies that a certificate chains to the root CA, without
+// checking revocation, and returns it
+func (a *Authority) VerifyChain(certPEM []byte) (*x509.Certificate, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.verifyChain(certPEM)
+}
+
+// verifyChain verifies that a certificate was issued by the root CA, or by a
+// root it replaced, directly or through a sector intermediate CA whose name
+// constraints permit it. The caller holds the lock.
+func (a *Authority) verifyChain(certPEM []byte) (*x509.Certificate, error) {
 	block, _ := pem.Decode(certPEM)
 	if block == nil {
-		return fmt.Errorf("failed to decode certificate PEM")
+		return nil, fmt.Errorf("failed to decode certificate PEM")
 	}
 
 	cert, err := x509.ParseCertificate(block.Bytes)
 	if err != nil {
-		return fmt.Errorf("failed to parse certificate: %w", err)
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
 	}
 
-	// Verify against root CA
+	// Verify against the root CA and the roots it replaced
 	roots := x509.NewCertPool()
 	roots.AddCert(a.rootCert)
+	for _, root := range a.previousRoots {
+		roots.AddCert(root)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cross := range a.crossCerts {
+		intermediates.AddCert(cross)
+	}
+	for _, ca := range a.intermediates {
+		intermediates.AddCert(ca.cert)
+	}
 
-	_, err = cert.Verify(x509.VerifyOptions{
-		Roots:     roots,
-		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	chains, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
 	})
+	if err != nil {
+		return cert, err
+	}
 
-	return err
+	// Name constraints only bind the subject alternative names, so the agency
+	// named in the subject must be one of them
+	if issuer := chains[0][1]; len(issuer.PermittedDNSDomains) > 0 &&
+		!slices.Contains(cert.DNSNames, strings.ToLower(cert.Subject.CommonName)) {
+		return cert, fmt.Errorf("%w: %s is not named in the certificate's DNS names", ErrNameConstraint, cert.Subject.CommonName)
+	}
+
+	return cert, nil
 }
 
 // GetRootCertificatePEM returns the root CA certificate in PEM format
 func (a *Authority) GetRootCertificatePEM() []byte {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
 	return pem.EncodeToMemory(&pem.Block{
 		Type:  "CERTIFICATE",
 		Bytes: a.rootCert.Raw,
@@ -0,0 +1,310 @@
+package trust
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// DefaultRevocationCacheTTL caps how long a revocation status is cached,
+// even when the OCSP response or CRL is valid for longer
+const DefaultRevocationCacheTTL = time.Hour
+
+// maxRevocationResponseSize bounds OCSP responses and CRLs fetched from
+// distribution points
+const maxRevocationResponseSize = 10 << 20
+
+var (
+	// ErrCertificateRevoked is returned for revoked or suspended certificates
+	ErrCertificateRevoked = errors.New("certificate revoked")
+	// ErrRevocationUnavailable is returned when neither OCSP nor a CRL
+	// could establish the revocation status
+	ErrRevocationUnavailable = errors.New("revocation status unavailable")
+	// ErrUnknownIssuer is returned for certificates not issued by the
+	// checker's issuer
+	ErrUnknownIssuer = errors.New("certificate not issued by the trusted root")
+)
+
+// RevocationStatus is the revocation status of a certificate
+type RevocationStatus struct {
+	Revoked    bool      `json:"revoked"`
+	RevokedAt  time.Time `json:"revoked_at,omitempty"`
+	ReasonCode int       `json:"reason_code,omitempty"`
+	Source     string    `json:"source"` // local, ocsp, crl
+	CheckedAt  time.Time `json:"checked_at"`
+	NextUpdate time.Time `json:"next_update"`
+}
+
+// RevocationChecker checks federation certificates against the OCSP
+// responder and CRL distribution points embedded in them, caching results.
+// Certificates of a local authority are checked against it directly.
+type RevocationChecker struct {
+	issuer *x509.Certificate
+	local  *Authority
+	client *http.Client
+	maxAge time.Duration
+
+	mu            sync.Mutex
+	intermediates []*x509.Certificate             // sector CAs issued by issuer
+	statuses      map[string]*RevocationStatus    // by serial
+	crls          map[string]*x509.RevocationList // by URL
+}
+
+// NewRevocationChecker creates a checker for certificates issued by issuer
+func NewRevocationChecker(issuer *x509.Certificate) *RevocationChecker {
+	return &RevocationChecker{
+		issuer:   issuer,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		maxAge:   DefaultRevocationCacheTTL,
+		statuses: make(map[string]*RevocationStatus),
+		crls:     make(map[string]*x509.RevocationList),
+	}
+}
+
+// RevocationChecker returns a checker for certificates issued by this
+// authority, including those issued by the roots it replaced
+func (a *Authority) RevocationChecker() *RevocationChecker {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	checker := NewRevocationChecker(a.rootCert)
+	checker.local = a
+	return checker
+}
+
+// AddIntermediate lets the checker check certificates issued by a sector
+// intermediate CA, which must have been issued by the checker's issuer
+func (c *RevocationChecker) AddIntermediate(cert *x509.Certificate) error {
+	if err := cert.CheckSignatureFrom(c.issuer); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnknownIssuer, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.intermediates = append(c.intermediates, cert)
+	return nil
+}
+
+// issuerOf returns the CA that issued a certificate: the checker's issuer or
+// one of its intermediates
+func (c *RevocationChecker) issuerOf(cert *x509.Certificate) (*x509.Certificate, error) {
+	err := cert.CheckSignatureFrom(c.issuer)
+	if err == nil {
+		return c.issuer, nil
+	}
+
+	c.mu.Lock()
+	intermediates := c.intermediates
+	c.mu.Unlock()
+	for _, intermediate := range intermediates {
+		if cert.CheckSignatureFrom(intermediate) == nil {
+			return intermediate, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnknownIssuer, err)
+}
+
+// SetHTTPClient sets the client used to reach OCSP responders and CRLs
+func (c *RevocationChecker) SetHTTPClient(client *http.Client) {
+	c.client = client
+}
+
+// SetMaxAge sets how long revocation statuses are cached at most
+func (c *RevocationChecker) SetMaxAge(maxAge time.Duration) {
+	c.maxAge = maxAge
+}
+
+// Check returns an error wrapping ErrCertificateRevoked when the certificate
+// was revoked at the given time. A zero time means now. Revocation for key
+// compromise applies regardless of the time.
+func (c *RevocationChecker) Check(ctx context.Context, cert *x509.Certificate, at time.Time) error {
+	status, err := c.Status(ctx, cert)
+	if err != nil {
+		return err
+	}
+	if !status.Revoked {
+		return nil
+	}
+	if at.IsZero() || !at.Before(status.RevokedAt) || status.ReasonCode == ocsp.KeyCompromise {
+		return fmt.Errorf("%w: %s at %s (reason %d, %s)", ErrCertificateRevoked,
+			cert.Subject.CommonName, status.RevokedAt.Format(time.RFC3339), status.ReasonCode, status.Source)
+	}
+	return nil
+}
+
+// Status returns the revocation status of a certificate, from the local
+// authority, the cache, OCSP or the CRL, in that order
+func (c *RevocationChecker) Status(ctx context.Context, cert *x509.Certificate) (*RevocationStatus, error) {
+	if c.local != nil {
+		if !c.local.knownIssuer(cert) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownIssuer, cert.Issuer.CommonName)
+		}
+		status, err := c.local.CertificateStatus(cert.SerialNumber)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrRevocationUnavailable, err)
+		}
+		return status, nil
+	}
+
+	issuer, err := c.issuerOf(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	serial := cert.SerialNumber.Text(16)
+	now := time.Now()
+
+	c.mu.Lock()
+	cached, ok := c.statuses[serial]
+	c.mu.Unlock()
+	if ok && now.Before(cached.NextUpdate) {
+		return cached, nil
+	}
+
+	var errs []error
+	for _, url := range cert.OCSPServer {
+		status, err := c.queryOCSP(ctx, url, cert, issuer)
+		if err == nil {
+			return c.remember(serial, status), nil
+		}
+		errs = append(errs, err)
+	}
+	for _, url := range cert.CRLDistributionPoints {
+		status, err := c.checkCRL(ctx, url, cert, issuer)
+		if err == nil {
+			return c.remember(serial, status), nil
+		}
+		errs = append(errs, err)
+	}
+
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("%w: certificate has no OCSP responder or CRL distribution point", ErrRevocationUnavailable)
+	}
+	return nil, fmt.Errorf("%w: %v", ErrRevocationUnavailable, errors.Join(errs...))
+}
+
+// remember caches a status until its next update, at most maxAge
+func (c *RevocationChecker) remember(serial string, status *RevocationStatus) *RevocationStatus {
+	if limit := status.CheckedAt.Add(c.maxAge); status.NextUpdate.IsZero() || status.NextUpdate.After(limit) {
+		status.NextUpdate = limit
+	}
+
+	c.mu.Lock()
+	c.statuses[serial] = status
+	c.mu.Unlock()
+	return status
+}
+
+// queryOCSP asks an OCSP responder for the status of a certificate
+func (c *RevocationChecker) queryOCSP(ctx context.Context, url string, cert, issuer *x509.Certificate) (*RevocationStatus, error) {
+	reqDER, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ocsp %s: %w", url, err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(reqDER))
+	if err != nil {
+		return nil, fmt.Errorf("ocsp %s: %w", url, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/ocsp-request")
+	body, err := c.fetch(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("ocsp %s: %w", url, err)
+	}
+
+	resp, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("ocsp %s: %w", url, err)
+	}
+	// A delegated responder must be authorized for OCSP signing by the issuer
+	if resp.Certificate != nil {
+		if !slices.Contains(resp.Certificate.ExtKeyUsage, x509.ExtKeyUsageOCSPSigning) {
+			return nil, fmt.Errorf("ocsp %s: responder certificate is not authorized for OCSP signing", url)
+		}
+		if now := time.Now(); now.Before(resp.Certificate.NotBefore) || now.After(resp.Certificate.NotAfter) {
+			return nil, fmt.Errorf("ocsp %s: responder certificate is not valid now", url)
+		}
+	}
+	if !resp.NextUpdate.IsZero() && time.Now().After(resp.NextUpdate) {
+		return nil, fmt.Errorf("ocsp %s: response is stale", url)
+	}
+
+	status := &RevocationStatus{Source: "ocsp", CheckedAt: time.Now().UTC(), NextUpdate: resp.NextUpdate}
+	switch resp.Status {
+	case ocsp.Good:
+	case ocsp.Revoked:
+		status.Revoked = true
+		status.RevokedAt = resp.RevokedAt
+		status.ReasonCode = resp.RevocationReason
+	default:
+		return nil, fmt.Errorf("ocsp %s: certificate unknown to responder", url)
+	}
+	return status, nil
+}
+
+// checkCRL looks a certificate up in the CRL of its issuer at a distribution
+// point, fetching the CRL again once its next update has passed
+func (c *RevocationChecker) checkCRL(ctx context.Context, url string, cert, issuer *x509.Certificate) (*RevocationStatus, error) {
+	c.mu.Lock()
+	crl, ok := c.crls[url]
+	c.mu.Unlock()
+
+	if !ok || time.Now().After(crl.NextUpdate) {
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("crl %s: %w", url, err)
+		}
+		body, err := c.fetch(httpReq)
+		if err != nil {
+			return nil, fmt.Errorf("crl %s: %w", url, err)
+		}
+		crl, err = x509.ParseRevocationList(body)
+		if err != nil {
+			return nil, fmt.Errorf("crl %s: %w", url, err)
+		}
+		if err := crl.CheckSignatureFrom(issuer); err != nil {
+			return nil, fmt.Errorf("crl %s: %w", url, err)
+		}
+		if time.Now().After(crl.NextUpdate) {
+			return nil, fmt.Errorf("crl %s: expired at %s", url, crl.NextUpdate.Format(time.RFC3339))
+		}
+
+		c.mu.Lock()
+		c.crls[url] = crl
+		c.mu.Unlock()
+	}
+
+	status := &RevocationStatus{Source: "crl", CheckedAt: time.Now().UTC(), NextUpdate: crl.NextUpdate}
+	for _, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			status.Revoked = true
+			status.RevokedAt = entry.RevocationTime
+			status.ReasonCode = entry.ReasonCode
+			break
+		}
+	}
+	return status, nil
+}
+
+// fetch performs a request and returns the bounded body of a 200 response
+func (c *RevocationChecker) fetch(req *http.Request) ([]byte, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxRevocationResponseSize))
+}
@@ -0,0 +1,268 @@
+package trust
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// DefaultEnrollmentTTL is how long an enrollment token can be used
+const DefaultEnrollmentTTL = 72 * time.Hour
+
+// ErrEnrollmentToken is returned when an enrollment token is unknown,
+// already used or expired
+var ErrEnrollmentToken = errors.New("invalid enrollment token")
+
+// Enrollment authorizes an agency to enroll once with a certificate signing
+// request. Only a hash of its token is kept.
+type Enrollment struct {
+	ID         types.ID   `json:"id"`
+	Name       string     `json:"name"`
+	Code       string     `json:"code"`
+	GatewayURL string     `json:"gateway_url"`
+	TokenHash  string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AgencyID   types.ID   `json:"agency_id,omitempty"`
+	EnrolledAt *time.Time `json:"enrolled_at,omitempty"`
+}
+
+// pending reports whether the enrollment can still be used
+func (e *Enrollment) pending(now time.Time) bool {
+	return e.EnrolledAt == nil && now.Before(e.ExpiresAt)
+}
+
+// SetEnrollmentTTL sets how long new enrollment tokens can be used
+func (a *Authority) SetEnrollmentTTL(ttl time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.enrollmentTTL = ttl
+}
+
+// CreateEnrollment authorizes an agency to enroll and returns the one-time
+// token to hand over to it. A zero ttl uses the configured default.
+func (a *Authority) CreateEnrollment(ctx context.Context, name, code, gatewayURL string, ttl time.Duration) (*Enrollment, string, error) {
+	if name == "" || code == "" {
+		return nil, "", fmt.Errorf("name and code are required")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if registered, err := a.agencyCodeExists(ctx, code); err != nil {
+		return nil, "", err
+	} else if registered {
+		return nil, "", fmt.Errorf("agency with code %s already registered", code)
+	}
+
+	if ttl <= 0 {
+		ttl = a.enrollmentTTL
+	}
+	if ttl <= 0 {
+		ttl = DefaultEnrollmentTTL
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate enrollment token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now().UTC()
+	enrollment := &Enrollment{
+		ID:         types.NewID(),
+		Name:       name,
+		Code:       code,
+		GatewayURL: gatewayURL,
+		TokenHash:  hashEnrollmentToken(token),
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+
+	if a.repository != nil {
+		if err := a.repository.SaveEnrollment(ctx, enrollment); err != nil {
+			return nil, "", fmt.Errorf("failed to save enrollment: %w", err)
+		}
+	} else {
+		a.enrollments[enrollment.TokenHash] = enrollment
+	}
+
+	return enrollment, token, nil
+}
+
+// PendingEnrollment returns an unused, unexpired enrollment for an agency
+// code, or nil when there is none
+func (a *Authority) PendingEnrollment(ctx context.Context, code string) (*Enrollment, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	now := time.Now()
+	if a.repository != nil {
+		return a.repository.GetPendingEnrollment(ctx, code, now)
+	}
+
+	for _, enrollment := range a.enrollments {
+		if enrollment.Code == code && enrollment.pending(now) {
+			return enrollment, nil
+		}
+	}
+	return nil, nil
+}
+
+// Enroll consumes an enrollment token and issues a certificate for the key
+// in a PKCS#10 certificate signing request. The agency keeps its private
+// key; the CSR signature proves it holds it.
+func (a *Authority) Enroll(ctx context.Context, token string, csrPEM []byte) (*TrustedAgency, error) {
+	csr, pubKey, err := parseCSR(csrPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tokenHash := hashEnrollmentToken(token)
+	var enrollment *Enrollment
+	if a.repository != nil {
+		enrollment, err = a.repository.GetEnrollmentByToken(ctx, tokenHash)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		enrollment = a.enrollments[tokenHash]
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case enrollment == nil:
+		return nil, ErrEnrollmentToken
+	case enrollment.EnrolledAt != nil:
+		return nil, fmt.Errorf("%w: already used", ErrEnrollmentToken)
+	case !now.Before(enrollment.ExpiresAt):
+		return nil, fmt.Errorf("%w: expired at %s", ErrEnrollmentToken, enrollment.ExpiresAt.Format(time.RFC3339))
+	}
+
+	if expected := enrollment.Code + ".gov.rs"; csr.Subject.CommonName != expected {
+		return nil, fmt.Errorf("certificate request subject %q does not match enrollment %q", csr.Subject.CommonName, expected)
+	}
+	if registered, err := a.agencyCodeExists(ctx, enrollment.Code); err != nil {
+		return nil, err
+	} else if registered {
+		return nil, fmt.Errorf("agency with code %s already registered", enrollment.Code)
+	}
+
+	cert, err := a.issueCertificate(enrollment.Name, enrollment.Code, pubKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue certificate: %w", err)
+	}
+	key, err := newAgencyKey(pubKey, cert, now)
+	if err != nil {
+		return nil, err
+	}
+
+	agency := &TrustedAgency{
+		ID:           types.NewID(),
+		Name:         enrollment.Name,
+		Code:         enrollment.Code,
+		GatewayURL:   enrollment.GatewayURL,
+		PublicKey:    pubKey,
+		Certificate:  cert,
+		KeyID:        key.KeyID,
+		Status:       "active",
+		RegisteredAt: now,
+		LastSeenAt:   now,
+	}
+
+	// The token is consumed in the same transaction that saves the agency, so
+	// that it cannot be used twice even by concurrent requests, and a failed
+	// save leaves it usable. The agency is trusted only once it is persisted.
+	if a.repository != nil {
+		if err := a.repository.EnrollAgency(ctx, enrollment.ID, agency, &key); err != nil {
+			return nil, fmt.Errorf("failed to enroll agency: %w", err)
+		}
+	} else {
+		enrollment.AgencyID = agency.ID
+		enrollment.EnrolledAt = &now
+	}
+
+	a.agencies[agency.ID] = agency
+
+	return agency, nil
+}
+
+// agencyCodeExists checks the registry and the repository for an agency code
+func (a *Authority) agencyCodeExists(ctx context.Context, code string) (bool, error) {
+	for _, existing := range a.agencies {
+		if existing.Code == code {
+			return true, nil
+		}
+	}
+	if a.repository != nil {
+		existing, err := a.repository.GetAgencyByCode(ctx, code)
+		if err != nil {
+			return false, err
+		}
+		return existing != nil, nil
+	}
+	return false, nil
+}
+
+// CreateCSR creates a PEM certificate signing request for an agency key, with
+// the subject the Trust Authority expects for the agency code
+func CreateCSR(code string, key crypto.Signer) ([]byte, error) {
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{
+			Country:    []string{"RS"},
+			CommonName: code + ".gov.rs",
+		},
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate request: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// parseCSR parses a PEM certificate signing request and checks its signature.
+// Gateways sign with Ed25519, so only Ed25519 keys are accepted.
+func parseCSR(csrPEM []byte) (*x509.CertificateRequest, ed25519.PublicKey, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, nil, fmt.Errorf("no PEM certificate request")
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse certificate request: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+
+	pubKey, ok := csr.PublicKey.(ed25519.PublicKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported agency key type %T, Ed25519 is required", csr.PublicKey)
+	}
+
+	return csr, pubKey, nil
+}
+
+// hashEnrollmentToken returns the hex SHA-256 under which a token is stored
+func hashEnrollmentToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
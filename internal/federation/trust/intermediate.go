@@ -0,0 +1,276 @@
+package trust
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sectors with their own intermediate CA
+const (
+	SectorHealth    = "health"
+	SectorSocial    = "social"
+	SectorPolice    = "police"
+	SectorJustice   = "justice"
+	SectorEducation = "education"
+)
+
+// Sectors lists the sectors that can have an intermediate CA
+var Sectors = []string{SectorHealth, SectorSocial, SectorPolice, SectorJustice, SectorEducation}
+
+// intermediateValidity is the lifetime of intermediate CA certificates, at
+// most that of the root
+const intermediateValidity = 5 * 365 * 24 * time.Hour
+
+var (
+	// ErrUnknownSector is returned for sectors without an intermediate CA
+	ErrUnknownSector = errors.New("unknown sector")
+	// ErrSectorPolicy is returned when the agency codes of an intermediate
+	// CA are missing or belong to another sector
+	ErrSectorPolicy = errors.New("invalid sector policy")
+	// ErrNameConstraint is returned for agency certificates outside the
+	// agency codes their intermediate CA may issue for
+	ErrNameConstraint = errors.New("certificate violates the name constraints of its issuer")
+)
+
+// IntermediateCA is the CA of a sector. Its name constraints permit only the
+// agency codes of the sector, and its key is held apart from the root key
+// and the keys of other sectors.
+type IntermediateCA struct {
+	Sector      string    `json:"sector"`
+	Codes       []string  `json:"codes"`
+	Certificate []byte    `json:"certificate"` // PEM
+	NotAfter    time.Time `json:"not_after"`
+
+	cert      *x509.Certificate
+	key       crypto.Signer
+	published publishedStatus
+}
+
+// agencyDomain is the DNS name of an agency in its certificate, to which
+// the name constraints of intermediate CAs apply
+func agencyDomain(code string) string {
+	return strings.ToLower(code) + ".gov.rs"
+}
+
+// newIntermediateCA describes an intermediate CA certificate and its key.
+// The agency codes are read from the name constraints.
+func newIntermediateCA(sector string, cert *x509.Certificate, key crypto.Signer) *IntermediateCA {
+	codes := make([]string, 0, len(cert.PermittedDNSDomains))
+	for _, domain := range cert.PermittedDNSDomains {
+		codes = append(codes, strings.ToUpper(strings.TrimSuffix(domain, ".gov.rs")))
+	}
+	return &IntermediateCA{
+		Sector:      sector,
+		Codes:       codes,
+		Certificate: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		NotAfter:    cert.NotAfter,
+		cert:        cert,
+		key:         key,
+	}
+}
+
+// SetIntermediateDir sets where intermediate CAs are kept, as
+// <sector>-ca.pem and <sector>-ca.key
+func (a *Authority) SetIntermediateDir(dir string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.intermediateDir = dir
+}
+
+// intermediatePaths returns the certificate and key files of a sector's
+// intermediate CA
+func (a *Authority) intermediatePaths(sector string) (string, string) {
+	return filepath.Join(a.intermediateDir, sector+"-ca.pem"), filepath.Join(a.intermediateDir, sector+"-ca.key")
+}
+
+// LoadIntermediates loads the intermediate CAs kept in the intermediate
+// directory. Each must have been issued by the current root CA.
+func (a *Authority) LoadIntermediates() (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.intermediateDir == "" {
+		return 0, nil
+	}
+
+	loaded := 0
+	for _, sector := range Sectors {
+		certPath, keyPath := a.intermediatePaths(sector)
+		if _, err := os.Stat(certPath); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		cert, key, err := loadCA(sector+" intermediate", certPath, keyPath)
+		if err != nil {
+			return loaded, err
+		}
+		if err := cert.CheckSignatureFrom(a.rootCert); err != nil {
+			return loaded, fmt.Errorf("intermediate CA in %s was not issued by the root CA: %w", certPath, err)
+		}
+		a.intermediates[sector] = newIntermediateCA(sector, cert, key)
+		loaded++
+	}
+	return loaded, nil
+}
+
+// IssueIntermediate issues the intermediate CA of a sector for the agency
+// codes it may issue certificates for. A sector that already has one keeps
+// its key, so the certificates it issued stay valid under the new policy as
+// long as their code is still permitted. An agency code belongs to one
+// sector at most.
+func (a *Authority) IssueIntermediate(sector string, codes []string) (*IntermediateCA, error) {
+	if !slices.Contains(Sectors, sector) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSector, sector)
+	}
+	permitted := make([]string, 0, len(codes))
+	for _, code := range codes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code != "" && !slices.Contains(permitted, code) {
+			permitted = append(permitted, code)
+		}
+	}
+	if len(permitted) == 0 {
+		return nil, fmt.Errorf("%w: sector %s needs at least one agency code", ErrSectorPolicy, sector)
+	}
+	sort.Strings(permitted)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for other, ca := range a.intermediates {
+		if other == sector {
+			continue
+		}
+		for _, code := range permitted {
+			if slices.Contains(ca.Codes, code) {
+				return nil, fmt.Errorf("%w: agency code %s already belongs to sector %s", ErrSectorPolicy, code, other)
+			}
+		}
+	}
+
+	var key crypto.Signer
+	if existing, ok := a.intermediates[sector]; ok {
+		key = existing.key
+	} else {
+		_, privKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate key of sector %s: %w", sector, err)
+		}
+		key = privKey
+	}
+
+	ca, err := a.signIntermediate(sector, permitted, key)
+	if err != nil {
+		return nil, err
+	}
+	if a.intermediateDir != "" {
+		certPath, keyPath := a.intermediatePaths(sector)
+		if err := replaceCA(certPath, keyPath, ca.cert, key); err != nil {
+			return nil, err
+		}
+	}
+	a.intermediates[sector] = ca
+
+	return ca, nil
+}
+
+// signIntermediate issues an intermediate CA certificate under the root CA
+// for a sector's key, constrained to the agency codes and to issuing agency
+// certificates only. The caller holds the lock.
+func (a *Authority) signIntermediate(sector string, codes []string, key crypto.Signer) (*IntermediateCA, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	notAfter := time.Now().Add(intermediateValidity)
+	if a.rootCert.NotAfter.Before(notAfter) {
+		notAfter = a.rootCert.NotAfter
+	}
+	domains := make([]string, len(codes))
+	for i, code := range codes {
+		domains[i] = agencyDomain(code)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization:       []string{"Serbia Government"},
+			OrganizationalUnit: []string{sector},
+			Country:            []string{"RS"},
+			CommonName:         fmt.Sprintf("Serbia Gov Interoperability %s%s CA", strings.ToUpper(sector[:1]), sector[1:]),
+		},
+		NotBefore:                   time.Now(),
+		NotAfter:                    notAfter,
+		IsCA:                        true,
+		KeyUsage:                    x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid:       true,
+		MaxPathLenZero:              true,
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         domains,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, a.rootCert, key.Public(), a.rootKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue intermediate CA of sector %s: %w", sector, err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return newIntermediateCA(sector, cert, key), nil
+}
+
+// Intermediates returns the sector intermediate CAs, by sector
+func (a *Authority) Intermediates() []IntermediateCA {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	intermediates := make([]IntermediateCA, 0, len(a.intermediates))
+	for _, ca := range a.sortedIntermediates() {
+		intermediates = append(intermediates, IntermediateCA{
+			Sector:      ca.Sector,
+			Codes:       slices.Clone(ca.Codes),
+			Certificate: ca.Certificate,
+			NotAfter:    ca.NotAfter,
+		})
+	}
+	return intermediates
+}
+
+// sortedIntermediates returns the intermediate CAs by sector. The caller
+// holds the lock.
+func (a *Authority) sortedIntermediates() []*IntermediateCA {
+	intermediates := make([]*IntermediateCA, 0, len(a.intermediates))
+	for _, sector := range Sectors {
+		if ca, ok := a.intermediates[sector]; ok {
+			intermediates = append(intermediates, ca)
+		}
+	}
+	return intermediates
+}
+
+// sectorCA returns the intermediate CA permitted to issue for an agency
+// code, or nil when the code belongs to no sector. The caller holds the lock.
+func (a *Authority) sectorCA(code string) *IntermediateCA {
+	code = strings.ToUpper(code)
+	for _, ca := range a.intermediates {
+		if slices.Contains(ca.Codes, code) {
+			return ca
+		}
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package trust
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/serbia-gov/platform/internal/shared/types"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// DefaultKeyOverlap is how long a replaced agency key still verifies
+	// signatures, so that gateways can switch keys without downtime
+	DefaultKeyOverlap = 7 * 24 * time.Hour
+	// DefaultRenewBefore is how long before expiry agency admins are warned
+	// to renew their certificate
+	DefaultRenewBefore = 30 * 24 * time.Hour
+)
+
+// ErrRenewalProof is returned when a renewal request is not signed with the
+// agency's current key
+var ErrRenewalProof = errors.New("renewal request not signed with the current agency key")
+
+// AgencyKey is a key an agency signs with, and its certificate. A replaced
+// key verifies signatures until RetiresAt.
+type AgencyKey struct {
+	KeyID       string     `json:"key_id"`
+	PublicKey   []byte     `json:"public_key"`
+	Certificate []byte     `json:"certificate"`
+	NotAfter    time.Time  `json:"not_after"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RetiresAt   *time.Time `json:"retires_at,omitempty"`
+}
+
+// CertificateExpiry warns that an agency certificate is about to expire
+type CertificateExpiry struct {
+	AgencyID   types.ID  `json:"agency_id"`
+	AgencyCode string    `json:"agency_code"`
+	KeyID      string    `json:"key_id"`
+	NotAfter   time.Time `json:"not_after"`
+	DaysLeft   int       `json:"days_left"`
+}
+
+// KeyID identifies an agency key in signatures: the first 8 bytes of the
+// SHA-256 of the public key, in hex
+func KeyID(publicKey []byte) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+// VerificationKeys returns the keys that verify the agency's signatures at a
+// point in time: the current key and replaced keys until they retire. A
+// key ID selects one of them; an empty one returns all.
+func (t *TrustedAgency) VerificationKeys(keyID string, at time.Time) []AgencyKey {
+	keys := []AgencyKey{{
+		KeyID:       KeyID(t.PublicKey),
+		PublicKey:   t.PublicKey,
+		Certificate: t.Certificate,
+	}}
+	for _, key := range t.PreviousKeys {
+		if key.RetiresAt != nil && at.Before(*key.RetiresAt) {
+			keys = append(keys, key)
+		}
+	}
+
+	if keyID == "" {
+		return keys
+	}
+	for _, key := range keys {
+		if key.KeyID == keyID {
+			return []AgencyKey{key}
+		}
+	}
+	return nil
+}
+
+// ExpiresAt returns when the agency's current certificate expires, or the
+// zero time when it cannot be read
+func (t *TrustedAgency) ExpiresAt() time.Time {
+	cert, err := parseCertificatePEM(t.Certificate)
+	if err != nil {
+		return time.Time{}
+	}
+	return cert.NotAfter
+}
+
+// newAgencyKey describes a key and the certificate just issued for it
+func newAgencyKey(publicKey []byte, certPEM []byte, createdAt time.Time) (AgencyKey, error) {
+	cert, err := parseCertificatePEM(certPEM)
+	if err != nil {
+		return AgencyKey{}, err
+	}
+	return AgencyKey{
+		KeyID:       KeyID(publicKey),
+		PublicKey:   publicKey,
+		Certificate: certPEM,
+		NotAfter:    cert.NotAfter,
+		CreatedAt:   createdAt,
+	}, nil
+}
+
+// SetKeyOverlap sets how long replaced agency keys keep verifying signatures
+func (a *Authority) SetKeyOverlap(overlap time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keyOverlap = overlap
+}
+
+// SetRenewBefore sets how long before expiry certificates are reported
+func (a *Authority) SetRenewBefore(renewBefore time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.renewBefore = renewBefore
+}
+
+// SetExpiryHandler sets the function that receives certificate expiry warnings
+func (a *Authority) SetExpiryHandler(fn func(ctx context.Context, expiry CertificateExpiry)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expiryHandler = fn
+}
+
+// CreateRenewal creates a renewal request for an agency: a CSR for the next
+// key, which may be the current one, and a proof signed with the current key
+func CreateRenewal(code string, current ed25519.PrivateKey, next crypto.Signer) (csrPEM []byte, proof string, err error) {
+	csrPEM, err = CreateCSR(code, next)
+	if err != nil {
+		return nil, "", err
+	}
+	csr, _, err := parseCSR(csrPEM)
+	if err != nil {
+		return nil, "", err
+	}
+	return csrPEM, base64.StdEncoding.EncodeToString(ed25519.Sign(current, csr.Raw)), nil
+}
+
+// Renew re-enrolls an active agency with the current key: the proof is a
+// signature over the CSR by that key. A CSR for the current key renews its
+// certificate; a CSR for a new key rotates to it, and the replaced key keeps
+// verifying signatures for the key overlap.
+func (a *Authority) Renew(ctx context.Context, id types.ID, csrPEM []byte, proof string) (*TrustedAgency, error) {
+	csr, pubKey, err := parseCSR(csrPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	agency, ok := a.agencies[id]
+	if !ok {
+		return nil, fmt.Errorf("agency not found: %s", id)
+	}
+	if agency.Status != "active" {
+		return nil, fmt.Errorf("agency %s is %s and cannot renew", agency.Code, agency.Status)
+	}
+	if expected := agency.Code + ".gov.rs"; csr.Subject.CommonName != expected {
+		return nil, fmt.Errorf("certificate request subject %q does not match agency %q", csr.Subject.CommonName, expected)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(proof)
+	if err != nil || !ed25519.Verify(agency.PublicKey, csr.Raw, signature) {
+		return nil, ErrRenewalProof
+	}
+	current, err := parseCertificatePEM(agency.Certificate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate of %s: %w", agency.Code, err)
+	}
+	if _, revoked := a.revocations[current.SerialNumber.Text(16)]; revoked {
+		return nil, fmt.Errorf("%w: current certificate of %s", ErrCertificateRevoked, agency.Code)
+	}
+
+	certPEM, err := a.issueCertificate(agency.Name, agency.Code, pubKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue certificate: %w", err)
+	}
+	now := time.Now().UTC()
+	key, err := newAgencyKey(pubKey, certPEM, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.KeyID == KeyID(agency.PublicKey) {
+		// Same key: the previous certificate is superseded at once
+		if err := a.revokeCertificate(ctx, agency.ID, agency.Certificate, ocsp.Superseded, "certificate renewed"); err != nil {
+			return nil, err
+		}
+	} else {
+		previous, err := newAgencyKey(agency.PublicKey, agency.Certificate, agency.RegisteredAt)
+		if err != nil {
+			return nil, err
+		}
+		retiresAt := now.Add(a.keyOverlap)
+		previous.RetiresAt = &retiresAt
+		if a.repository != nil {
+			if err := a.repository.SaveAgencyKey(ctx, agency.ID, &previous); err != nil {
+				return nil, err
+			}
+		}
+		agency.PreviousKeys = append([]AgencyKey{previous}, agency.PreviousKeys...)
+	}
+
+	agency.PublicKey = pubKey
+	agency.Certificate = certPEM
+	agency.KeyID = key.KeyID
+
+	if a.repository != nil {
+		if err := a.repository.SaveAgencyKey(ctx, agency.ID, &key); err != nil {
+			return nil, err
+		}
+		if err := a.repository.UpdateAgency(ctx, agency); err != nil {
+			return nil, fmt.Errorf("failed to save agency: %w", err)
+		}
+	}
+
+	return agency, nil
+}
+
+// retireKeys drops replaced keys whose overlap has ended and revokes their
+// certificates as superseded. The caller holds the lock.
+func (a *Authority) retireKeys(ctx context.Context, agency *TrustedAgency, now time.Time) error {
+	kept := agency.PreviousKeys[:0]
+	for _, key := range agency.PreviousKeys {
+		if key.RetiresAt != nil && now.Before(*key.RetiresAt) {
+			kept = append(kept, key)
+			continue
+		}
+		if err := a.revokeCertificate(ctx, agency.ID, key.Certificate, ocsp.Superseded, "key retired"); err != nil {
+			return err
+		}
+	}
+	agency.PreviousKeys = kept
+	return nil
+}
+
+// CheckExpiry retires replaced keys whose overlap has ended and reports the
+// certificates of active agencies that expire within the renewal window
+func (a *Authority) CheckExpiry(ctx context.Context) []CertificateExpiry {
+	a.mu.Lock()
+	now := time.Now().UTC()
+	var expiring []CertificateExpiry
+	for _, agency := range a.agencies {
+		if err := a.retireKeys(ctx, agency, now); err != nil {
+			fmt.Printf("Warning: failed to retire keys of agency %s: %v\n", agency.Code, err)
+		}
+		if agency.Status != "active" {
+			continue
+		}
+
+		notAfter := agency.ExpiresAt()
+		if notAfter.IsZero() || notAfter.Sub(now) > a.renewBefore {
+			continue
+		}
+		expiring = append(expiring, CertificateExpiry{
+			AgencyID:   agency.ID,
+			AgencyCode: agency.Code,
+			KeyID:      KeyID(agency.PublicKey),
+			NotAfter:   notAfter,
+			DaysLeft:   int(notAfter.Sub(now).Hours() / 24),
+		})
+	}
+	handler := a.expiryHandler
+	a.mu.Unlock()
+
+	if handler != nil {
+		for _, expiry := range expiring {
+			handler(ctx, expiry)
+		}
+	}
+	return expiring
+}
+
+// StartExpiryMonitor checks certificate expiry now and at each interval
+// until the context is cancelled
+func (a *Authority) StartExpiryMonitor(ctx context.Context, interval time.Duration) {
+	a.CheckExpiry(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.CheckExpiry(ctx)
+		}
+	}
+}
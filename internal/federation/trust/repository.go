@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/serbia-gov/platform/internal/shared/types"
 )
@@ -19,8 +20,17 @@ func NewPostgresRepository(pool *pgxpool.Pool) *PostgresRepository {
 	return &PostgresRepository{pool: pool}
 }
 
+// executor runs statements on the pool or in a transaction
+type executor interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
 // SaveAgency saves a trusted agency
 func (r *PostgresRepository) SaveAgency(ctx context.Context, agency *TrustedAgency) error {
+	return saveAgency(ctx, r.pool, agency)
+}
+
+func saveAgency(ctx context.Context, db executor, agency *TrustedAgency) error {
 	query := `
 		INSERT INTO federation.trusted_agencies (
 			id, name, code, gateway_url, public_key, certificate,
@@ -35,7 +45,7 @@ func (r *PostgresRepository) SaveAgency(ctx context.Context, agency *TrustedAgen
 			last_seen_at = EXCLUDED.last_seen_at
 	`
 
-	_, err := r.pool.Exec(ctx, query,
+	_, err := db.Exec(ctx, query,
 		agency.ID,
 		agency.Name,
 		agency.Code,
@@ -305,3 +315,311 @@ func (r *PostgresRepository) GetServicesByType(ctx context.Context, serviceType
 
 	return services, nil
 }
+
+// SaveEnrollment saves an enrollment authorization
+func (r *PostgresRepository) SaveEnrollment(ctx context.Context, enrollment *Enrollment) error {
+	query := `
+		INSERT INTO federation.enrollments (
+			id, name, code, gateway_url, token_hash, created_at, expires_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := r.pool.Exec(ctx, query,
+		enrollment.ID,
+		enrollment.Name,
+		enrollment.Code,
+		enrollment.GatewayURL,
+		enrollment.TokenHash,
+		enrollment.CreatedAt,
+		enrollment.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save enrollment: %w", err)
+	}
+
+	return nil
+}
+
+// GetEnrollmentByToken retrieves an enrollment by the hash of its token
+func (r *PostgresRepository) GetEnrollmentByToken(ctx context.Context, tokenHash string) (*Enrollment, error) {
+	query := `
+		SELECT id, name, code, gateway_url, token_hash, created_at, expires_at,
+			   agency_id, enrolled_at
+		FROM federation.enrollments
+		WHERE token_hash = $1
+	`
+
+	return r.scanEnrollment(r.pool.QueryRow(ctx, query, tokenHash).Scan)
+}
+
+// GetPendingEnrollment retrieves the latest unused, unexpired enrollment for an agency code
+func (r *PostgresRepository) GetPendingEnrollment(ctx context.Context, code string, now time.Time) (*Enrollment, error) {
+	query := `
+		SELECT id, name, code, gateway_url, token_hash, created_at, expires_at,
+			   agency_id, enrolled_at
+		FROM federation.enrollments
+		WHERE code = $1 AND enrolled_at IS NULL AND expires_at > $2
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	return r.scanEnrollment(r.pool.QueryRow(ctx, query, code, now).Scan)
+}
+
+// EnrollAgency marks an enrollment used by an agency, once, and saves the
+// agency and its key in the same transaction
+func (r *PostgresRepository) EnrollAgency(ctx context.Context, enrollmentID types.ID, agency *TrustedAgency, key *AgencyKey) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE federation.enrollments
+		SET agency_id = $2, enrolled_at = $3
+		WHERE id = $1 AND enrolled_at IS NULL
+	`
+
+	tag, err := tx.Exec(ctx, query, enrollmentID, agency.ID, agency.RegisteredAt)
+	if err != nil {
+		return fmt.Errorf("failed to complete enrollment: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: enrollment %s already used", ErrEnrollmentToken, enrollmentID)
+	}
+
+	if err := saveAgency(ctx, tx, agency); err != nil {
+		return err
+	}
+	if err := saveAgencyKey(ctx, tx, agency.ID, key); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit enrollment: %w", err)
+	}
+
+	return nil
+}
+
+// scanEnrollment scans an enrollment row, returning nil when there is none
+func (r *PostgresRepository) scanEnrollment(scan func(dest ...any) error) (*Enrollment, error) {
+	var enrollment Enrollment
+	var idStr string
+	var agencyID *string
+
+	err := scan(
+		&idStr,
+		&enrollment.Name,
+		&enrollment.Code,
+		&enrollment.GatewayURL,
+		&enrollment.TokenHash,
+		&enrollment.CreatedAt,
+		&enrollment.ExpiresAt,
+		&agencyID,
+		&enrollment.EnrolledAt,
+	)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get enrollment: %w", err)
+	}
+
+	enrollment.ID = types.ID(idStr)
+	if agencyID != nil {
+		enrollment.AgencyID = types.ID(*agencyID)
+	}
+	return &enrollment, nil
+}
+
+// SaveRevocation saves a certificate revocation; a suspension may later be
+// turned into a revocation
+func (r *PostgresRepository) SaveRevocation(ctx context.Context, revocation *Revocation) error {
+	query := `
+		INSERT INTO federation.certificate_revocations (
+			serial_number, agency_id, reason_code, reason, revoked_at, issuer
+		) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (serial_number) DO UPDATE SET
+			reason_code = EXCLUDED.reason_code,
+			reason = EXCLUDED.reason,
+			revoked_at = EXCLUDED.revoked_at
+	`
+
+	_, err := r.pool.Exec(ctx, query,
+		revocation.SerialNumber,
+		revocation.AgencyID,
+		revocation.ReasonCode,
+		revocation.Reason,
+		revocation.RevokedAt,
+		revocation.Issuer,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save certificate revocation: %w", err)
+	}
+
+	return nil
+}
+
+// ListRevocations lists all certificate revocations
+func (r *PostgresRepository) ListRevocations(ctx context.Context) ([]Revocation, error) {
+	query := `
+		SELECT serial_number, agency_id, reason_code, reason, revoked_at, issuer
+		FROM federation.certificate_revocations
+		ORDER BY revoked_at
+	`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list certificate revocations: %w", err)
+	}
+	defer rows.Close()
+
+	var revocations []Revocation
+	for rows.Next() {
+		var revocation Revocation
+		var agencyIDStr string
+
+		err := rows.Scan(
+			&revocation.SerialNumber,
+			&agencyIDStr,
+			&revocation.ReasonCode,
+			&revocation.Reason,
+			&revocation.RevokedAt,
+			&revocation.Issuer,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan certificate revocation: %w", err)
+		}
+
+		revocation.AgencyID = types.ID(agencyIDStr)
+		revocations = append(revocations, revocation)
+	}
+
+	return revocations, nil
+}
+
+// SaveAgencyKey saves a key of an agency; renewing its certificate or
+// retiring it updates the row
+func (r *PostgresRepository) SaveAgencyKey(ctx context.Context, agencyID types.ID, key *AgencyKey) error {
+	return saveAgencyKey(ctx, r.pool, agencyID, key)
+}
+
+func saveAgencyKey(ctx context.Context, db executor, agencyID types.ID, key *AgencyKey) error {
+	query := `
+		INSERT INTO federation.agency_keys (
+			key_id, agency_id, public_key, certificate, not_after, retires_at, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (key_id) DO UPDATE SET
+			certificate = EXCLUDED.certificate,
+			not_after = EXCLUDED.not_after,
+			retires_at = EXCLUDED.retires_at
+	`
+
+	_, err := db.Exec(ctx, query,
+		key.KeyID,
+		agencyID,
+		key.PublicKey,
+		key.Certificate,
+		key.NotAfter,
+		key.RetiresAt,
+		key.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save agency key: %w", err)
+	}
+
+	return nil
+}
+
+// ListAgencyKeys lists the keys of an agency, newest first
+func (r *PostgresRepository) ListAgencyKeys(ctx context.Context, agencyID types.ID) ([]AgencyKey, error) {
+	query := `
+		SELECT key_id, public_key, certificate, not_after, retires_at, created_at
+		FROM federation.agency_keys
+		WHERE agency_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.pool.Query(ctx, query, agencyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agency keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []AgencyKey
+	for rows.Next() {
+		var key AgencyKey
+		if err := rows.Scan(
+			&key.KeyID,
+			&key.PublicKey,
+			&key.Certificate,
+			&key.NotAfter,
+			&key.RetiresAt,
+			&key.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan agency key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// SaveCACertificate saves a retired root or a cross certificate
+func (r *PostgresRepository) SaveCACertificate(ctx context.Context, cert *CACertificate) error {
+	query := `
+		INSERT INTO federation.ca_certificates (
+			serial_number, kind, subject, certificate, not_after, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (serial_number) DO NOTHING
+	`
+
+	_, err := r.pool.Exec(ctx, query,
+		cert.SerialNumber,
+		cert.Kind,
+		cert.Subject,
+		cert.Certificate,
+		cert.NotAfter,
+		cert.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save CA certificate: %w", err)
+	}
+
+	return nil
+}
+
+// ListCACertificates lists retired roots and cross certificates, oldest first
+func (r *PostgresRepository) ListCACertificates(ctx context.Context) ([]CACertificate, error) {
+	query := `
+		SELECT serial_number, kind, subject, certificate, not_after, created_at
+		FROM federation.ca_certificates
+		ORDER BY created_at
+	`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list CA certificates: %w", err)
+	}
+	defer rows.Close()
+
+	var certs []CACertificate
+	for rows.Next() {
+		var cert CACertificate
+		if err := rows.Scan(
+			&cert.SerialNumber,
+			&cert.Kind,
+			&cert.Subject,
+			&cert.Certificate,
+			&cert.NotAfter,
+			&cert.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan CA certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
@@ -0,0 +1,392 @@
+package trust
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/serbia-gov/platform/internal/shared/types"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// CRLValidity is how long a published CRL is valid; it is reissued
+	// halfway through or as soon as a certificate is revoked
+	CRLValidity = 24 * time.Hour
+	// OCSPValidity is how long an OCSP response may be cached
+	OCSPValidity = time.Hour
+
+	// ocspResponderValidity is the lifetime of the delegated OCSP responder
+	// certificate, reissued on demand before it expires
+	ocspResponderValidity = 30 * 24 * time.Hour
+)
+
+// oidOCSPNoCheck marks the OCSP responder certificate as not to be checked
+// for revocation itself (RFC 6960 section 4.2.2.2.1)
+var oidOCSPNoCheck = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
+
+// Revocation records a revoked or suspended agency certificate. Suspension
+// is published with reason certificateHold.
+type Revocation struct {
+	SerialNumber string    `json:"serial_number"` // hex
+	AgencyID     types.ID  `json:"agency_id"`
+	ReasonCode   int       `json:"reason_code"` // RFC 5280 CRLReason
+	Reason       string    `json:"reason,omitempty"`
+	RevokedAt    time.Time `json:"revoked_at"`
+	// Issuer is the sector of the intermediate CA that issued the
+	// certificate, empty for the root CA
+	Issuer string `json:"issuer,omitempty"`
+}
+
+// publishedStatus is how a CA publishes revocations: its current CRL and
+// its delegated OCSP responder
+type publishedStatus struct {
+	crl         []byte
+	crlIssuedAt time.Time
+	ocspCert    *x509.Certificate
+	ocspKey     crypto.Signer
+}
+
+// SetRevocationEndpoints sets the CRL and OCSP URLs embedded in certificates
+// issued from now on
+func (a *Authority) SetRevocationEndpoints(crlURL, ocspURL string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.crlURL = crlURL
+	a.ocspURL = ocspURL
+}
+
+// revokeAgencyCertificates revokes the certificates of an agency's current
+// key and of replaced keys that have not retired yet
+func (a *Authority) revokeAgencyCertificates(ctx context.Context, agency *TrustedAgency, reasonCode int, reason string) error {
+	if err := a.revokeCertificate(ctx, agency.ID, agency.Certificate, reasonCode, reason); err != nil {
+		return fmt.Errorf("agency %s: %w", agency.Code, err)
+	}
+	for _, key := range agency.PreviousKeys {
+		if err := a.revokeCertificate(ctx, agency.ID, key.Certificate, reasonCode, reason); err != nil {
+			return fmt.Errorf("agency %s: %w", agency.Code, err)
+		}
+	}
+	return nil
+}
+
+// revokeCertificate records the revocation of an agency certificate and
+// invalidates the published CRLs. The caller holds the lock.
+func (a *Authority) revokeCertificate(ctx context.Context, agencyID types.ID, certPEM []byte, reasonCode int, reason string) error {
+	cert, err := parseCertificatePEM(certPEM)
+	if err != nil {
+		return fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	revocation := &Revocation{
+		SerialNumber: cert.SerialNumber.Text(16),
+		AgencyID:     agencyID,
+		ReasonCode:   reasonCode,
+		Reason:       reason,
+		RevokedAt:    time.Now().UTC(),
+		Issuer:       a.issuerSector(cert),
+	}
+	if existing, ok := a.revocations[revocation.SerialNumber]; ok && existing.ReasonCode == reasonCode {
+		return nil
+	}
+
+	if a.repository != nil {
+		if err := a.repository.SaveRevocation(ctx, revocation); err != nil {
+			return fmt.Errorf("failed to save revocation: %w", err)
+		}
+	}
+	a.revocations[revocation.SerialNumber] = revocation
+	a.invalidateCRLs()
+
+	return nil
+}
+
+// invalidateCRLs makes the root and intermediate CAs reissue their CRLs on
+// the next request. The caller holds the lock.
+func (a *Authority) invalidateCRLs() {
+	a.published.crl = nil
+	for _, ca := range a.intermediates {
+		ca.published.crl = nil
+	}
+}
+
+// issuerSector returns the sector of the intermediate CA that issued a
+// certificate, or "" when it was not issued by one. The caller holds the lock.
+func (a *Authority) issuerSector(cert *x509.Certificate) string {
+	for sector, ca := range a.intermediates {
+		if cert.CheckSignatureFrom(ca.cert) == nil {
+			return sector
+		}
+	}
+	return ""
+}
+
+// CertificateStatus returns the revocation status of a certificate issued by
+// this authority
+func (a *Authority) CertificateStatus(serial *big.Int) (*RevocationStatus, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	now := time.Now().UTC()
+	status := &RevocationStatus{Source: "local", CheckedAt: now, NextUpdate: now}
+	if revocation, ok := a.revocations[serial.Text(16)]; ok {
+		status.Revoked = true
+		status.RevokedAt = revocation.RevokedAt
+		status.ReasonCode = revocation.ReasonCode
+		return status, nil
+	}
+	if !a.issued(serial) {
+		return nil, fmt.Errorf("certificate %s was not issued by this authority", serial.Text(16))
+	}
+	return status, nil
+}
+
+// issued reports whether a serial number belongs to the certificate of a
+// registered agency's current or replaced key
+func (a *Authority) issued(serial *big.Int) bool {
+	matches := func(certPEM []byte) bool {
+		cert, err := parseCertificatePEM(certPEM)
+		return err == nil && cert.SerialNumber.Cmp(serial) == 0
+	}
+	for _, agency := range a.agencies {
+		if matches(agency.Certificate) {
+			return true
+		}
+		for _, key := range agency.PreviousKeys {
+			if matches(key.Certificate) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// knownIssuer reports whether a certificate was signed by the root CA, by a
+// root it replaced or by a sector intermediate CA
+func (a *Authority) knownIssuer(cert *x509.Certificate) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if cert.CheckSignatureFrom(a.rootCert) == nil {
+		return true
+	}
+	for _, root := range a.previousRoots {
+		if cert.CheckSignatureFrom(root) == nil {
+			return true
+		}
+	}
+	return a.issuerSector(cert) != ""
+}
+
+// issuingCA returns the certificate, key and published revocation status of
+// the intermediate CA of a sector, or of the root CA for an empty sector. The
+// caller holds the lock.
+func (a *Authority) issuingCA(sector string) (*x509.Certificate, crypto.Signer, *publishedStatus, error) {
+	if sector == "" {
+		return a.rootCert, a.rootKey, &a.published, nil
+	}
+	ca, ok := a.intermediates[sector]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("%w: %s", ErrUnknownSector, sector)
+	}
+	return ca.cert, ca.key, &ca.published, nil
+}
+
+// CRL returns the current DER certificate revocation list signed by the root
+// CA, for the certificates it issued directly
+func (a *Authority) CRL() ([]byte, error) {
+	return a.SectorCRL("")
+}
+
+// SectorCRL returns the current DER certificate revocation list signed by the
+// intermediate CA of a sector, or by the root CA for an empty sector
+func (a *Authority) SectorCRL(sector string) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	issuer, issuerKey, published, err := a.issuingCA(sector)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if published.crl != nil && now.Before(published.crlIssuedAt.Add(CRLValidity/2)) {
+		return published.crl, nil
+	}
+
+	entries := make([]x509.RevocationListEntry, 0, len(a.revocations))
+	for _, revocation := range a.revocations {
+		if revocation.Issuer != sector {
+			continue
+		}
+		serial, ok := new(big.Int).SetString(revocation.SerialNumber, 16)
+		if !ok {
+			continue
+		}
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: revocation.RevokedAt,
+			ReasonCode:     revocation.ReasonCode,
+		})
+	}
+
+	// CRL numbers must increase; the issue time does across restarts
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(now.UnixNano()),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(CRLValidity),
+		RevokedCertificateEntries: entries,
+	}, issuer, issuerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CRL: %w", err)
+	}
+
+	published.crl = crl
+	published.crlIssuedAt = now
+	return crl, nil
+}
+
+// OCSPResponse answers a DER OCSP request for a certificate issued by this
+// authority. Responses are signed by a responder certificate delegated by the
+// issuing CA, since OCSP signing does not support its Ed25519 key.
+func (a *Authority) OCSPResponse(requestDER []byte) ([]byte, error) {
+	req, err := ocsp.ParseRequest(requestDER)
+	if err != nil {
+		return ocsp.MalformedRequestErrorResponse, nil
+	}
+
+	responderCert, responderKey, issuer, err := a.ocspResponder(req)
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return ocsp.UnauthorizedErrorResponse, nil
+	}
+
+	now := time.Now().UTC()
+	template := ocsp.Response{
+		SerialNumber: req.SerialNumber,
+		IssuerHash:   req.HashAlgorithm,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(OCSPValidity),
+		Certificate:  responderCert,
+	}
+
+	status, err := a.CertificateStatus(req.SerialNumber)
+	switch {
+	case err != nil:
+		template.Status = ocsp.Unknown
+	case status.Revoked:
+		template.Status = ocsp.Revoked
+		template.RevokedAt = status.RevokedAt
+		template.RevocationReason = status.ReasonCode
+	default:
+		template.Status = ocsp.Good
+	}
+
+	return ocsp.CreateResponse(issuer, responderCert, template, responderKey)
+}
+
+// issuerMatches reports whether an OCSP request names a CA as issuer
+func issuerMatches(req *ocsp.Request, issuer *x509.Certificate) bool {
+	if !req.HashAlgorithm.Available() {
+		return false
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false
+	}
+
+	h := req.HashAlgorithm.New()
+	h.Write(issuer.RawSubject)
+	nameHash := h.Sum(nil)
+	h.Reset()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+
+	return string(nameHash) == string(req.IssuerNameHash) && string(keyHash) == string(req.IssuerKeyHash)
+}
+
+// ocspResponder returns the delegated OCSP responder certificate and key of
+// the CA an OCSP request names as issuer, issuing a new pair when there is
+// none or it is about to expire, and that CA. The CA is nil when the request
+// names none of this authority's CAs.
+func (a *Authority) ocspResponder(req *ocsp.Request) (*x509.Certificate, crypto.Signer, *x509.Certificate, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var issuer *x509.Certificate
+	var issuerKey crypto.Signer
+	var published *publishedStatus
+	if issuerMatches(req, a.rootCert) {
+		issuer, issuerKey, published = a.rootCert, a.rootKey, &a.published
+	}
+	for _, ca := range a.intermediates {
+		if issuer == nil && issuerMatches(req, ca.cert) {
+			issuer, issuerKey, published = ca.cert, ca.key, &ca.published
+		}
+	}
+	if issuer == nil {
+		return nil, nil, nil, nil
+	}
+
+	if published.ocspCert != nil && time.Now().Before(published.ocspCert.NotAfter.Add(-ocspResponderValidity/4)) {
+		return published.ocspCert, published.ocspKey, issuer, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to generate OCSP responder key: %w", err)
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization: []string{"Serbia Government"},
+			Country:      []string{"RS"},
+			CommonName:   issuer.Subject.CommonName + " OCSP Responder",
+		},
+		NotBefore:       time.Now().Add(-time.Minute),
+		NotAfter:        time.Now().Add(ocspResponderValidity),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+		ExtraExtensions: []pkix.Extension{{Id: oidOCSPNoCheck, Value: asn1.NullBytes}},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to issue OCSP responder certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	published.ocspCert = cert
+	published.ocspKey = key
+	return cert, key, issuer, nil
+}
+
+// parseCertificatePEM parses a PEM, or DER, certificate
+func parseCertificatePEM(certPEM []byte) (*x509.Certificate, error) {
+	if block, _ := pem.Decode(certPEM); block != nil {
+		return x509.ParseCertificate(block.Bytes)
+	}
+	return x509.ParseCertificate(certPEM)
+}
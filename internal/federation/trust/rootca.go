@@ -0,0 +1,489 @@
+package trust
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/serbia-gov/platform/internal/shared/types"
+	"golang.org/x/crypto/ocsp"
+)
+
+// rootCommonName is the subject of the first root CA; rotated roots are
+// numbered generations of it
+const rootCommonName = "Serbia Gov Interoperability Root CA"
+
+// CA certificate kinds kept in the repository
+const (
+	CAKindRoot  = "root"  // a retired root CA
+	CAKindCross = "cross" // a root CA key certified by another root
+)
+
+// CACertificate is a retired root CA certificate or a cross certificate
+type CACertificate struct {
+	SerialNumber string    `json:"serial_number"` // hex
+	Kind         string    `json:"kind"`
+	Subject      string    `json:"subject"`
+	Certificate  []byte    `json:"certificate"` // PEM
+	NotAfter     time.Time `json:"not_after"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// RootRotation is the outcome of a root CA rotation
+type RootRotation struct {
+	Root               []byte `json:"root"`                 // PEM of the new root
+	CrossSigned        []byte `json:"cross_signed"`         // new root key certified by the previous root
+	ReverseCrossSigned []byte `json:"reverse_cross_signed"` // previous root key certified by the new root
+	Reissued           int    `json:"reissued"`             // agency certificates reissued under the new root
+	Intermediates      int    `json:"intermediates"`        // sector intermediate CAs reissued under the new root
+}
+
+// newCACertificate describes a CA certificate for the repository
+func newCACertificate(kind string, cert *x509.Certificate) *CACertificate {
+	return &CACertificate{
+		SerialNumber: cert.SerialNumber.Text(16),
+		Kind:         kind,
+		Subject:      cert.Subject.CommonName,
+		Certificate:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		NotAfter:     cert.NotAfter,
+		CreatedAt:    time.Now().UTC(),
+	}
+}
+
+// generateRootCA creates a self-signed Ed25519 root CA
+func generateRootCA(commonName string) (*x509.Certificate, crypto.Signer, error) {
+	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate root key: %w", err)
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization:  []string{"Serbia Government"},
+			Country:       []string{"RS"},
+			Province:      []string{"Belgrade"},
+			Locality:      []string{"Belgrade"},
+			StreetAddress: []string{""},
+			PostalCode:    []string{""},
+			CommonName:    commonName,
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(10, 0, 0), // 10 years
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		MaxPathLen:            2,
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, pubKey, privKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create root certificate: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse root certificate: %w", err)
+	}
+
+	return cert, privKey, nil
+}
+
+// LoadRootCA loads the root CA certificate (PEM) and its private key (PEM
+// PKCS#8). The certificate must be a CA certificate for the key.
+func LoadRootCA(certPath, keyPath string) (*x509.Certificate, crypto.Signer, error) {
+	return loadCA("root", certPath, keyPath)
+}
+
+// loadCA loads a CA certificate (PEM) and its private key (PEM PKCS#8),
+// checking that they belong together
+func loadCA(name, certPath, keyPath string) (*x509.Certificate, crypto.Signer, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s certificate: %w", name, err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, nil, fmt.Errorf("no PEM certificate in %s", certPath)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s certificate: %w", name, err)
+	}
+	if !cert.IsCA {
+		return nil, nil, fmt.Errorf("certificate in %s is not a CA certificate", certPath)
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s key: %w", name, err)
+	}
+	block, _ = pem.Decode(keyPEM)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, nil, fmt.Errorf("no PEM PKCS#8 private key in %s", keyPath)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s key: %w", name, err)
+	}
+	key, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported %s key type %T", name, parsed)
+	}
+
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode %s public key: %w", name, err)
+	}
+	if !bytes.Equal(pub, cert.RawSubjectPublicKeyInfo) {
+		return nil, nil, fmt.Errorf("%s key in %s does not match the certificate in %s", name, keyPath, certPath)
+	}
+
+	return cert, key, nil
+}
+
+// LoadOrCreateRootCA loads the root CA from disk, or generates it and writes
+// it there when neither file exists, so that it is generated only once
+func LoadOrCreateRootCA(certPath, keyPath string) (cert *x509.Certificate, key crypto.Signer, created bool, err error) {
+	_, certErr := os.Stat(certPath)
+	_, keyErr := os.Stat(keyPath)
+	if !errors.Is(certErr, os.ErrNotExist) || !errors.Is(keyErr, os.ErrNotExist) {
+		cert, key, err = LoadRootCA(certPath, keyPath)
+		return cert, key, false, err
+	}
+
+	cert, key, err = generateRootCA(rootCommonName)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to encode root key: %w", err)
+	}
+	if err := writePEM(keyPath, "PRIVATE KEY", keyDER, 0600); err != nil {
+		return nil, nil, false, err
+	}
+	if err := writePEM(certPath, "CERTIFICATE", cert.Raw, 0644); err != nil {
+		return nil, nil, false, err
+	}
+
+	return cert, key, true, nil
+}
+
+// writePEM writes a PEM block to a new file
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if err := pem.Encode(f, &pem.Block{Type: blockType, Bytes: der}); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// Load fills the in-memory registry from the repository, so agencies, their
+// keys and services, certificate revocations and retired roots survive
+// restarts. Agencies whose certificates do not chain to the root CA are
+// loaded but reported, so sector intermediate CAs are loaded before.
+func (a *Authority) Load(ctx context.Context) (int, error) {
+	if a.repository == nil {
+		return 0, nil
+	}
+
+	agencies, err := a.repository.ListAgencies(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	revocations, err := a.repository.ListRevocations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	caCerts, err := a.repository.ListCACertificates(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	services := make(map[types.ID][]ServiceEndpoint, len(agencies))
+	keys := make(map[types.ID][]AgencyKey, len(agencies))
+	for _, agency := range agencies {
+		svcs, err := a.repository.GetServices(ctx, agency.ID)
+		if err != nil {
+			return 0, err
+		}
+		services[agency.ID] = svcs
+
+		agencyKeys, err := a.repository.ListAgencyKeys(ctx, agency.ID)
+		if err != nil {
+			return 0, err
+		}
+		keys[agency.ID] = agencyKeys
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i := range revocations {
+		a.revocations[revocations[i].SerialNumber] = &revocations[i]
+	}
+	a.invalidateCRLs()
+
+	a.previousRoots, a.crossCerts = nil, nil
+	for _, caCert := range caCerts {
+		cert, err := parseCertificatePEM(caCert.Certificate)
+		if err != nil {
+			return 0, fmt.Errorf("invalid CA certificate %s: %w", caCert.SerialNumber, err)
+		}
+		switch {
+		case caCert.Kind == CAKindCross:
+			a.crossCerts = append(a.crossCerts, cert)
+		case cert.SerialNumber.Cmp(a.rootCert.SerialNumber) != 0:
+			a.previousRoots = append(a.previousRoots, cert)
+		}
+	}
+
+	var untrusted []string
+	for i := range agencies {
+		agency := agencies[i]
+		agency.KeyID = KeyID(agency.PublicKey)
+		// Replaced keys whose certificate is not revoked yet are still to
+		// be retired by the expiry check
+		for _, key := range keys[agency.ID] {
+			if key.KeyID == agency.KeyID || key.RetiresAt == nil {
+				continue
+			}
+			if cert, err := parseCertificatePEM(key.Certificate); err == nil {
+				if _, revoked := a.revocations[cert.SerialNumber.Text(16)]; !revoked {
+					agency.PreviousKeys = append(agency.PreviousKeys, key)
+				}
+			}
+		}
+		a.agencies[agency.ID] = &agency
+		a.services[agency.ID] = services[agency.ID]
+		if _, err := a.verifyChain(agency.Certificate); agency.Status == "active" && err != nil {
+			untrusted = append(untrusted, agency.Code)
+		}
+	}
+	if len(untrusted) > 0 {
+		fmt.Printf("Warning: certificates of %d agencies were not issued by this root CA: %v\n", len(untrusted), untrusted)
+	}
+
+	return len(agencies), nil
+}
+
+// SetRootPaths sets where a rotated root CA is written, so that it is the
+// one loaded on the next start
+func (a *Authority) SetRootPaths(certPath, keyPath string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rootCertPath = certPath
+	a.rootKeyPath = keyPath
+}
+
+// CAChainPEM returns the root CA certificate followed by the sector
+// intermediate CAs, the retired roots and the cross certificates between
+// them, so that relying parties trusting any of the roots can build a chain
+// to agency certificates
+func (a *Authority) CAChainPEM() []byte {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	certs := []*x509.Certificate{a.rootCert}
+	for _, ca := range a.sortedIntermediates() {
+		certs = append(certs, ca.cert)
+	}
+	certs = append(append(certs, a.previousRoots...), a.crossCerts...)
+
+	var chain []byte
+	for _, cert := range certs {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return chain
+}
+
+// RotateRoot replaces the root CA with a new one. The roots cross-certify
+// each other, so that certificates chain to whichever root a relying party
+// trusts. Sector intermediate CAs are reissued under the new root for the
+// same keys, so the certificates they issued stay valid. Certificates the
+// root issued to active agencies are reissued under the new root for the
+// same keys, and the old ones revoked as superseded, so gateways keep working
+// without re-enrolling.
+func (a *Authority) RotateRoot(ctx context.Context) (*RootRotation, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	oldCert, oldKey := a.rootCert, a.rootKey
+	newCert, newKey, err := generateRootCA(fmt.Sprintf("%s G%d", rootCommonName, len(a.previousRoots)+2))
+	if err != nil {
+		return nil, err
+	}
+	crossSigned, err := crossSign(newCert, oldCert, oldKey)
+	if err != nil {
+		return nil, err
+	}
+	reverseCrossSigned, err := crossSign(oldCert, newCert, newKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.repository != nil {
+		for _, caCert := range []*CACertificate{
+			newCACertificate(CAKindRoot, oldCert),
+			newCACertificate(CAKindCross, crossSigned),
+			newCACertificate(CAKindCross, reverseCrossSigned),
+		} {
+			if err := a.repository.SaveCACertificate(ctx, caCert); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if a.rootCertPath != "" && a.rootKeyPath != "" {
+		if err := replaceCA(a.rootCertPath, a.rootKeyPath, newCert, newKey); err != nil {
+			return nil, err
+		}
+	}
+
+	a.previousRoots = append(a.previousRoots, oldCert)
+	a.crossCerts = append(a.crossCerts, crossSigned, reverseCrossSigned)
+	a.rootCert, a.rootKey = newCert, newKey
+	a.published = publishedStatus{}
+
+	rotation := &RootRotation{
+		Root:               pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: newCert.Raw}),
+		CrossSigned:        pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crossSigned.Raw}),
+		ReverseCrossSigned: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: reverseCrossSigned.Raw}),
+	}
+
+	for _, ca := range a.sortedIntermediates() {
+		reissued, err := a.signIntermediate(ca.Sector, ca.Codes, ca.key)
+		if err != nil {
+			return rotation, err
+		}
+		if a.intermediateDir != "" {
+			certPath, keyPath := a.intermediatePaths(ca.Sector)
+			if err := replaceCA(certPath, keyPath, reissued.cert, reissued.key); err != nil {
+				return rotation, err
+			}
+		}
+		a.intermediates[ca.Sector] = reissued
+		rotation.Intermediates++
+	}
+
+	for _, agency := range a.agencies {
+		if agency.Status != "active" {
+			continue
+		}
+		if current, err := parseCertificatePEM(agency.Certificate); err == nil && a.issuerSector(current) != "" {
+			continue
+		}
+		certPEM, err := a.issueCertificate(agency.Name, agency.Code, agency.PublicKey)
+		if err != nil {
+			return rotation, fmt.Errorf("failed to reissue certificate of %s: %w", agency.Code, err)
+		}
+		key, err := newAgencyKey(agency.PublicKey, certPEM, time.Now().UTC())
+		if err != nil {
+			return rotation, err
+		}
+		if err := a.revokeCertificate(ctx, agency.ID, agency.Certificate, ocsp.Superseded, "root CA rotated"); err != nil {
+			return rotation, err
+		}
+		agency.Certificate = certPEM
+
+		if a.repository != nil {
+			if err := a.repository.SaveAgencyKey(ctx, agency.ID, &key); err != nil {
+				return rotation, err
+			}
+			if err := a.repository.UpdateAgency(ctx, agency); err != nil {
+				return rotation, fmt.Errorf("failed to save agency %s: %w", agency.Code, err)
+			}
+		}
+		rotation.Reissued++
+	}
+
+	return rotation, nil
+}
+
+// crossSign certifies the key of one root CA with another root, keeping the
+// subject so that chains built for either root verify
+func crossSign(subject, issuer *x509.Certificate, issuerKey crypto.Signer) (*x509.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	notAfter := subject.NotAfter
+	if issuer.NotAfter.Before(notAfter) {
+		notAfter = issuer.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject.Subject,
+		SubjectKeyId:          subject.SubjectKeyId,
+		NotBefore:             time.Now(),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		KeyUsage:              subject.KeyUsage,
+		BasicConstraintsValid: true,
+		MaxPathLen:            subject.MaxPathLen,
+		MaxPathLenZero:        subject.MaxPathLenZero,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, subject.PublicKey, issuerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cross-sign %s: %w", subject.Subject.CommonName, err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// replaceCA writes a new CA certificate and key over the files of the
+// current ones, which are kept with a .prev suffix
+func replaceCA(certPath, keyPath string, cert *x509.Certificate, key crypto.Signer) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode CA key: %w", err)
+	}
+
+	for _, f := range []struct {
+		path, blockType string
+		der             []byte
+		perm            os.FileMode
+	}{
+		{keyPath, "PRIVATE KEY", keyDER, 0600},
+		{certPath, "CERTIFICATE", cert.Raw, 0644},
+	} {
+		os.Remove(f.path + ".new")
+		if err := writePEM(f.path+".new", f.blockType, f.der, f.perm); err != nil {
+			return err
+		}
+		if err := os.Rename(f.path, f.path+".prev"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to keep previous %s: %w", f.path, err)
+		}
+		if err := os.Rename(f.path+".new", f.path); err != nil {
+			return fmt.Errorf("failed to replace %s: %w", f.path, err)
+		}
+	}
+	return nil
+}
@@ -1,27 +1,57 @@
 package trust
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/serbia-gov/platform/internal/shared/types"
+	"golang.org/x/crypto/ocsp"
 )
 
 // --- Mock Repository ---
 
 type mockRepository struct {
-	agencies map[types.ID]*TrustedAgency
-	services map[types.ID][]ServiceEndpoint
+	agencies    map[types.ID]*TrustedAgency
+	services    map[types.ID][]ServiceEndpoint
+	enrollments map[string]*Enrollment
+	revocations map[string]Revocation
+	keys        map[types.ID][]AgencyKey
+	caCerts     []CACertificate
+	saveErr     error // returned by SaveAgency when set
+	keyErr      error // returned by SaveAgencyKey when set
 }
 
 func newMockRepository() *mockRepository {
 	return &mockRepository{
-		agencies: make(map[types.ID]*TrustedAgency),
-		services: make(map[types.ID][]ServiceEndpoint),
+		agencies:    make(map[types.ID]*TrustedAgency),
+		services:    make(map[types.ID][]ServiceEndpoint),
+		enrollments: make(map[string]*Enrollment),
+		revocations: make(map[string]Revocation),
+		keys:        make(map[types.ID][]AgencyKey),
 	}
 }
 
 func (r *mockRepository) SaveAgency(ctx context.Context, agency *TrustedAgency) error {
+	if r.saveErr != nil {
+		return r.saveErr
+	}
 	r.agencies[agency.ID] = agency
 	return nil
 }
@@ -78,6 +108,119 @@ func (r *mockRepository) GetServicesByType(ctx context.Context, serviceType stri
 	return result, nil
 }
 
+func (r *mockRepository) SaveEnrollment(ctx context.Context, enrollment *Enrollment) error {
+	r.enrollments[enrollment.TokenHash] = enrollment
+	return nil
+}
+
+func (r *mockRepository) GetEnrollmentByToken(ctx context.Context, tokenHash string) (*Enrollment, error) {
+	return r.enrollments[tokenHash], nil
+}
+
+func (r *mockRepository) GetPendingEnrollment(ctx context.Context, code string, now time.Time) (*Enrollment, error) {
+	for _, e := range r.enrollments {
+		if e.Code == code && e.pending(now) {
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+// EnrollAgency applies its steps in order and undoes them when one fails,
+// like the transaction of the Postgres repository
+func (r *mockRepository) EnrollAgency(ctx context.Context, enrollmentID types.ID, agency *TrustedAgency, key *AgencyKey) error {
+	var enrollment *Enrollment
+	for _, e := range r.enrollments {
+		if e.ID == enrollmentID {
+			enrollment = e
+		}
+	}
+	if enrollment == nil {
+		return errors.New("enrollment not found")
+	}
+	if enrollment.EnrolledAt != nil {
+		return fmt.Errorf("%w: already used", ErrEnrollmentToken)
+	}
+
+	enrolledAt := agency.RegisteredAt
+	enrollment.AgencyID = agency.ID
+	enrollment.EnrolledAt = &enrolledAt
+
+	err := r.SaveAgency(ctx, agency)
+	if err == nil {
+		if err = r.SaveAgencyKey(ctx, agency.ID, key); err != nil {
+			delete(r.agencies, agency.ID)
+		}
+	}
+	if err != nil {
+		enrollment.AgencyID = ""
+		enrollment.EnrolledAt = nil
+		return err
+	}
+	return nil
+}
+
+func (r *mockRepository) SaveRevocation(ctx context.Context, revocation *Revocation) error {
+	r.revocations[revocation.SerialNumber] = *revocation
+	return nil
+}
+
+func (r *mockRepository) ListRevocations(ctx context.Context) ([]Revocation, error) {
+	var result []Revocation
+	for _, revocation := range r.revocations {
+		result = append(result, revocation)
+	}
+	return result, nil
+}
+
+func (r *mockRepository) SaveAgencyKey(ctx context.Context, agencyID types.ID, key *AgencyKey) error {
+	if r.keyErr != nil {
+		return r.keyErr
+	}
+	for i, existing := range r.keys[agencyID] {
+		if existing.KeyID == key.KeyID {
+			r.keys[agencyID][i] = *key
+			return nil
+		}
+	}
+	r.keys[agencyID] = append(r.keys[agencyID], *key)
+	return nil
+}
+
+func (r *mockRepository) ListAgencyKeys(ctx context.Context, agencyID types.ID) ([]AgencyKey, error) {
+	return r.keys[agencyID], nil
+}
+
+func (r *mockRepository) SaveCACertificate(ctx context.Context, cert *CACertificate) error {
+	r.caCerts = append(r.caCerts, *cert)
+	return nil
+}
+
+func (r *mockRepository) ListCACertificates(ctx context.Context) ([]CACertificate, error) {
+	return r.caCerts, nil
+}
+
+// enrollAgency enrolls an agency with a CSR for a new key
+func enrollAgency(t *testing.T, authority *Authority, name, code, gatewayURL string) (*TrustedAgency, ed25519.PrivateKey) {
+	t.Helper()
+	ctx := context.Background()
+
+	_, token, err := authority.CreateEnrollment(ctx, name, code, gatewayURL, 0)
+	if err != nil {
+		t.Fatalf("Failed to create enrollment for %s: %v", code, err)
+	}
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	csr, err := CreateCSR(code, key)
+	if err != nil {
+		t.Fatalf("Failed to create CSR for %s: %v", code, err)
+	}
+	agency, err := authority.Enroll(ctx, token, csr)
+	if err != nil {
+		t.Fatalf("Failed to enroll %s: %v", code, err)
+	}
+	return agency, key
+}
+
 // --- Trust Authority Tests ---
 
 func TestNewAuthority(t *testing.T) {
@@ -101,12 +244,19 @@ func TestNewAuthority(t *testing.T) {
 	}
 }
 
-func TestRegisterAgency(t *testing.T) {
+func TestEnrollAgency(t *testing.T) {
 	repo := newMockRepository()
 	authority, _ := NewAuthority(repo)
 	ctx := context.Background()
 
-	agency, err := authority.RegisterAgency(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	_, token, err := authority.CreateEnrollment(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway", 0)
+	if err != nil {
+		t.Fatalf("Expected no error creating enrollment, got: %v", err)
+	}
+
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	csr, _ := CreateCSR("MUP", key)
+	agency, err := authority.Enroll(ctx, token, csr)
 
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
@@ -132,8 +282,8 @@ func TestRegisterAgency(t *testing.T) {
 		t.Errorf("Expected status 'active', got '%s'", agency.Status)
 	}
 
-	if len(agency.PublicKey) == 0 {
-		t.Error("Public key should be generated")
+	if !key.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(agency.PublicKey)) {
+		t.Error("Public key should be the one from the CSR")
 	}
 
 	if len(agency.Certificate) == 0 {
@@ -141,22 +291,158 @@ func TestRegisterAgency(t *testing.T) {
 	}
 }
 
-func TestRegisterDuplicateAgency(t *testing.T) {
+func TestEnrollDuplicateAgency(t *testing.T) {
 	repo := newMockRepository()
 	authority, _ := NewAuthority(repo)
 	ctx := context.Background()
 
-	// Register first agency
-	_, err := authority.RegisterAgency(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
-	if err != nil {
-		t.Fatalf("Expected no error for first registration, got: %v", err)
+	// Two enrollments for the same code before either is used
+	_, first, _ := authority.CreateEnrollment(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway", 0)
+	_, second, _ := authority.CreateEnrollment(ctx, "Different Name", "MUP", "https://different.gov.rs/gateway", 0)
+
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	csr, _ := CreateCSR("MUP", key)
+	if _, err := authority.Enroll(ctx, first, csr); err != nil {
+		t.Fatalf("Expected no error for first enrollment, got: %v", err)
 	}
 
-	// Try to register with same code
-	_, err = authority.RegisterAgency(ctx, "Different Name", "MUP", "https://different.gov.rs/gateway")
-	if err == nil {
+	// Try to enroll with same code
+	if _, err := authority.Enroll(ctx, second, csr); err == nil {
 		t.Error("Expected error for duplicate agency code")
 	}
+	if _, _, err := authority.CreateEnrollment(ctx, "Different Name", "MUP", "https://different.gov.rs/gateway", 0); err == nil {
+		t.Error("Expected error creating enrollment for a registered agency code")
+	}
+}
+
+func TestEnrollTokenIsOneTime(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := NewAuthority(repo)
+	ctx := context.Background()
+
+	_, token, _ := authority.CreateEnrollment(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway", 0)
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	csr, _ := CreateCSR("MUP", key)
+
+	if _, err := authority.Enroll(ctx, "unknown-token", csr); !errors.Is(err, ErrEnrollmentToken) {
+		t.Errorf("Expected enrollment token error for unknown token, got: %v", err)
+	}
+	if _, err := authority.Enroll(ctx, token, csr); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, err := authority.Enroll(ctx, token, csr); !errors.Is(err, ErrEnrollmentToken) {
+		t.Errorf("Expected enrollment token error for reused token, got: %v", err)
+	}
+
+	pending, _ := authority.PendingEnrollment(ctx, "MUP")
+	if pending != nil {
+		t.Error("Used enrollment should not be pending")
+	}
+}
+
+func TestEnrollDoesNotTrustUnsavedAgency(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := NewAuthority(repo)
+	ctx := context.Background()
+
+	_, token, _ := authority.CreateEnrollment(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway", 0)
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	csr, _ := CreateCSR("MUP", key)
+
+	repo.saveErr = errors.New("database unavailable")
+	if _, err := authority.Enroll(ctx, token, csr); err == nil {
+		t.Fatal("Expected enrollment to fail when the agency cannot be saved")
+	}
+
+	if agency, _ := authority.GetAgencyByCode(ctx, "MUP"); agency != nil {
+		t.Error("Unsaved agency should not be trusted")
+	}
+	if agencies, _ := authority.ListAgencies(ctx); len(agencies) != 0 {
+		t.Errorf("Expected no registered agencies, got %d", len(agencies))
+	}
+}
+
+func TestEnrollFailurePartway(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := NewAuthority(repo)
+	ctx := context.Background()
+
+	_, token, _ := authority.CreateEnrollment(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway", 0)
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	csr, _ := CreateCSR("MUP", key)
+
+	// The agency is saved, its key is not
+	repo.keyErr = errors.New("database unavailable")
+	if _, err := authority.Enroll(ctx, token, csr); err == nil {
+		t.Fatal("Expected enrollment to fail when the agency key cannot be saved")
+	}
+	if len(repo.agencies) != 0 {
+		t.Error("Agency without a key should not be saved")
+	}
+	if agency, _ := authority.GetAgencyByCode(ctx, "MUP"); agency != nil {
+		t.Error("Agency without a key should not be trusted")
+	}
+	if pending, _ := authority.PendingEnrollment(ctx, "MUP"); pending == nil {
+		t.Fatal("Failed enrollment should leave the token usable")
+	}
+
+	repo.keyErr = nil
+	agency, err := authority.Enroll(ctx, token, csr)
+	if err != nil {
+		t.Fatalf("Expected retried enrollment to succeed, got: %v", err)
+	}
+	if keys, _ := repo.ListAgencyKeys(ctx, agency.ID); len(keys) != 1 {
+		t.Errorf("Expected the agency key to be saved, got %d keys", len(keys))
+	}
+	if _, err := authority.Enroll(ctx, token, csr); !errors.Is(err, ErrEnrollmentToken) {
+		t.Errorf("Expected enrollment token error for reused token, got: %v", err)
+	}
+}
+
+func TestEnrollExpiredToken(t *testing.T) {
+	authority, _ := NewAuthority(nil)
+	ctx := context.Background()
+
+	enrollment, token, _ := authority.CreateEnrollment(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway", time.Hour)
+	enrollment.ExpiresAt = time.Now().Add(-time.Minute)
+
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	csr, _ := CreateCSR("MUP", key)
+	if _, err := authority.Enroll(ctx, token, csr); !errors.Is(err, ErrEnrollmentToken) {
+		t.Errorf("Expected enrollment token error for expired token, got: %v", err)
+	}
+}
+
+func TestEnrollRejectsInvalidCSR(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := NewAuthority(repo)
+	ctx := context.Background()
+
+	_, token, _ := authority.CreateEnrollment(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway", 0)
+
+	// Subject of another agency
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	csr, _ := CreateCSR("PURS", key)
+	if _, err := authority.Enroll(ctx, token, csr); err == nil {
+		t.Error("Expected error for CSR subject of another agency")
+	}
+
+	// Gateways sign with Ed25519 only
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	csr, _ = CreateCSR("MUP", ecKey)
+	if _, err := authority.Enroll(ctx, token, csr); err == nil {
+		t.Error("Expected error for non-Ed25519 key")
+	}
+
+	if _, err := authority.Enroll(ctx, token, []byte("not a csr")); err == nil {
+		t.Error("Expected error for invalid CSR")
+	}
+
+	// Rejected requests do not consume the token
+	csr, _ = CreateCSR("MUP", key)
+	if _, err := authority.Enroll(ctx, token, csr); err != nil {
+		t.Errorf("Expected no error after rejected requests, got: %v", err)
+	}
 }
 
 func TestGetAgency(t *testing.T) {
@@ -165,7 +451,7 @@ func TestGetAgency(t *testing.T) {
 	ctx := context.Background()
 
 	// Register agency
-	registered, _ := authority.RegisterAgency(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	registered, _ := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
 
 	// Get by ID
 	agency, err := authority.GetAgency(ctx, registered.ID)
@@ -184,7 +470,7 @@ func TestGetAgencyByCode(t *testing.T) {
 	ctx := context.Background()
 
 	// Register agency
-	authority.RegisterAgency(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
 
 	// Get by code
 	agency, err := authority.GetAgencyByCode(ctx, "MUP")
@@ -203,9 +489,9 @@ func TestListAgencies(t *testing.T) {
 	ctx := context.Background()
 
 	// Register multiple agencies
-	authority.RegisterAgency(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
-	authority.RegisterAgency(ctx, "Tax Administration", "PURS", "https://purs.gov.rs/gateway")
-	authority.RegisterAgency(ctx, "Social Welfare", "CSW", "https://csw.gov.rs/gateway")
+	enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	enrollAgency(t, authority, "Tax Administration", "PURS", "https://purs.gov.rs/gateway")
+	enrollAgency(t, authority, "Social Welfare", "CSW", "https://csw.gov.rs/gateway")
 
 	// List agencies
 	agencies, err := authority.ListAgencies(ctx)
@@ -224,7 +510,7 @@ func TestSuspendAgency(t *testing.T) {
 	ctx := context.Background()
 
 	// Register agency
-	agency, _ := authority.RegisterAgency(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	agency, _ := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
 
 	// Suspend
 	err := authority.SuspendAgency(ctx, agency.ID, "Security concern")
@@ -245,7 +531,7 @@ func TestRevokeAgency(t *testing.T) {
 	ctx := context.Background()
 
 	// Register agency
-	agency, _ := authority.RegisterAgency(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	agency, _ := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
 
 	// Revoke
 	err := authority.RevokeAgency(ctx, agency.ID, "Permanent removal")
@@ -266,7 +552,7 @@ func TestRegisterService(t *testing.T) {
 	ctx := context.Background()
 
 	// Register agency
-	agency, _ := authority.RegisterAgency(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	agency, _ := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
 
 	// Register service
 	service, err := authority.RegisterService(ctx, agency.ID, "citizen.verify", "/api/v1/citizen/verify", "1.0")
@@ -293,7 +579,7 @@ func TestGetServices(t *testing.T) {
 	ctx := context.Background()
 
 	// Register agency
-	agency, _ := authority.RegisterAgency(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	agency, _ := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
 
 	// Register multiple services
 	authority.RegisterService(ctx, agency.ID, "citizen.verify", "/api/v1/citizen/verify", "1.0")
@@ -316,8 +602,8 @@ func TestFindService(t *testing.T) {
 	ctx := context.Background()
 
 	// Register multiple agencies with services
-	agency1, _ := authority.RegisterAgency(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
-	agency2, _ := authority.RegisterAgency(ctx, "Tax Administration", "PURS", "https://purs.gov.rs/gateway")
+	agency1, _ := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	agency2, _ := enrollAgency(t, authority, "Tax Administration", "PURS", "https://purs.gov.rs/gateway")
 
 	authority.RegisterService(ctx, agency1.ID, "citizen.verify", "/api/v1/citizen/verify", "1.0")
 	authority.RegisterService(ctx, agency2.ID, "citizen.verify", "/api/v1/citizen/verify", "2.0")
@@ -337,10 +623,9 @@ func TestFindService(t *testing.T) {
 func TestVerifyCertificate(t *testing.T) {
 	repo := newMockRepository()
 	authority, _ := NewAuthority(repo)
-	ctx := context.Background()
 
-	// Register agency
-	agency, _ := authority.RegisterAgency(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	// Enroll agency
+	agency, _ := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
 
 	// Verify certificate
 	err := authority.VerifyCertificate(agency.Certificate)
@@ -375,3 +660,737 @@ func TestGetRootCertificatePEM(t *testing.T) {
 		t.Error("Root certificate should be in PEM format")
 	}
 }
+
+func TestLoadOrCreateRootCA(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "federation", "root-ca.pem")
+	keyPath := filepath.Join(dir, "federation", "root-ca.key")
+
+	cert, _, created, err := LoadOrCreateRootCA(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("Failed to create root CA: %v", err)
+	}
+	if !created {
+		t.Error("Expected root CA to be created")
+	}
+
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatalf("Root key was not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected root key mode 0600, got %o", info.Mode().Perm())
+	}
+
+	reloaded, _, created, err := LoadOrCreateRootCA(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("Failed to load root CA: %v", err)
+	}
+	if created {
+		t.Error("Expected existing root CA to be loaded")
+	}
+	if !reloaded.Equal(cert) {
+		t.Error("Expected the same root certificate after reload")
+	}
+}
+
+func TestLoadRootCAMismatchedKey(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "root-ca.pem")
+	keyPath := filepath.Join(dir, "root-ca.key")
+	otherCert := filepath.Join(dir, "other-ca.pem")
+	otherKey := filepath.Join(dir, "other-ca.key")
+
+	if _, _, _, err := LoadOrCreateRootCA(certPath, keyPath); err != nil {
+		t.Fatalf("Failed to create root CA: %v", err)
+	}
+	if _, _, _, err := LoadOrCreateRootCA(otherCert, otherKey); err != nil {
+		t.Fatalf("Failed to create root CA: %v", err)
+	}
+
+	if _, _, err := LoadRootCA(certPath, otherKey); err == nil {
+		t.Error("Expected error for a key that does not match the certificate")
+	}
+
+	// Only one of the two files present must not regenerate the CA
+	if err := os.Remove(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := LoadOrCreateRootCA(certPath, keyPath); err == nil {
+		t.Error("Expected error when the root key is missing")
+	}
+}
+
+func TestAuthoritySurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "root-ca.pem")
+	keyPath := filepath.Join(dir, "root-ca.key")
+	repo := newMockRepository()
+	ctx := context.Background()
+
+	cert, key, _, err := LoadOrCreateRootCA(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("Failed to create root CA: %v", err)
+	}
+	authority, err := NewAuthorityWithRoot(repo, cert, key)
+	if err != nil {
+		t.Fatalf("Failed to create authority: %v", err)
+	}
+	agency, _ := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	authority.RegisterService(ctx, agency.ID, "citizen.verify", "/api/citizen/verify", "v1")
+
+	// Restart: same root CA from disk, same repository
+	cert, key, _, err = LoadOrCreateRootCA(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("Failed to load root CA: %v", err)
+	}
+	restarted, err := NewAuthorityWithRoot(repo, cert, key)
+	if err != nil {
+		t.Fatalf("Failed to create authority: %v", err)
+	}
+	n, err := restarted.Load(ctx)
+	if err != nil {
+		t.Fatalf("Failed to load registry: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 agency loaded, got %d", n)
+	}
+
+	if err := restarted.VerifyCertificate(agency.Certificate); err != nil {
+		t.Errorf("Expected certificate issued before restart to be valid, got: %v", err)
+	}
+	if _, _, err := restarted.CreateEnrollment(ctx, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway", 0); err == nil {
+		t.Error("Expected error for agency registered before restart")
+	}
+	if len(restarted.services[agency.ID]) != 1 {
+		t.Errorf("Expected 1 service loaded, got %d", len(restarted.services[agency.ID]))
+	}
+}
+
+// --- Revocation Tests ---
+
+func TestRevokedAgencyInCRL(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := NewAuthority(repo)
+	ctx := context.Background()
+
+	suspended, _ := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	revoked, _ := enrollAgency(t, authority, "Tax Administration", "PURS", "https://purs.gov.rs/gateway")
+	active, _ := enrollAgency(t, authority, "Health Fund", "RFZO", "https://rfzo.gov.rs/gateway")
+
+	if err := authority.SuspendAgency(ctx, suspended.ID, "Security concern"); err != nil {
+		t.Fatalf("Failed to suspend: %v", err)
+	}
+	if err := authority.RevokeAgency(ctx, revoked.ID, "Permanent removal"); err != nil {
+		t.Fatalf("Failed to revoke: %v", err)
+	}
+
+	der, err := authority.CRL()
+	if err != nil {
+		t.Fatalf("Failed to create CRL: %v", err)
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatalf("Failed to parse CRL: %v", err)
+	}
+	if err := crl.CheckSignatureFrom(authority.rootCert); err != nil {
+		t.Errorf("CRL should be signed by the root CA: %v", err)
+	}
+
+	reasons := make(map[string]int)
+	for _, entry := range crl.RevokedCertificateEntries {
+		reasons[entry.SerialNumber.Text(16)] = entry.ReasonCode
+	}
+	serial := func(agency *TrustedAgency) string {
+		cert, _ := parseCertificatePEM(agency.Certificate)
+		return cert.SerialNumber.Text(16)
+	}
+	if reason, ok := reasons[serial(suspended)]; !ok || reason != ocsp.CertificateHold {
+		t.Errorf("Suspended certificate should be on hold, got %d (listed %v)", reason, ok)
+	}
+	if _, ok := reasons[serial(revoked)]; !ok {
+		t.Error("Revoked certificate should be listed")
+	}
+	if _, ok := reasons[serial(active)]; ok {
+		t.Error("Active certificate should not be listed")
+	}
+
+	if err := authority.VerifyCertificate(revoked.Certificate); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected ErrCertificateRevoked, got: %v", err)
+	}
+	if err := authority.VerifyCertificate(active.Certificate); err != nil {
+		t.Errorf("Expected active certificate to be valid, got: %v", err)
+	}
+}
+
+func TestOCSPResponse(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := NewAuthority(repo)
+	ctx := context.Background()
+
+	agency, _ := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	cert, _ := parseCertificatePEM(agency.Certificate)
+
+	query := func() *ocsp.Response {
+		t.Helper()
+		req, err := ocsp.CreateRequest(cert, authority.rootCert, nil)
+		if err != nil {
+			t.Fatalf("Failed to create OCSP request: %v", err)
+		}
+		der, err := authority.OCSPResponse(req)
+		if err != nil {
+			t.Fatalf("Failed to answer OCSP request: %v", err)
+		}
+		resp, err := ocsp.ParseResponseForCert(der, cert, authority.rootCert)
+		if err != nil {
+			t.Fatalf("Failed to parse OCSP response: %v", err)
+		}
+		return resp
+	}
+
+	if resp := query(); resp.Status != ocsp.Good {
+		t.Errorf("Expected good status, got %d", resp.Status)
+	}
+
+	authority.RevokeAgency(ctx, agency.ID, "Key compromise suspected")
+	resp := query()
+	if resp.Status != ocsp.Revoked {
+		t.Errorf("Expected revoked status, got %d", resp.Status)
+	}
+	if resp.Certificate == nil || resp.Certificate.ExtKeyUsage[0] != x509.ExtKeyUsageOCSPSigning {
+		t.Error("Response should be signed by a delegated OCSP responder")
+	}
+
+	malformed, _ := authority.OCSPResponse([]byte("not a request"))
+	if _, err := ocsp.ParseResponse(malformed, nil); err == nil {
+		t.Error("Expected malformed request error response")
+	}
+}
+
+func TestRevocationCheckerOverHTTP(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := NewAuthority(repo)
+	ctx := context.Background()
+
+	r := chi.NewRouter()
+	r.Mount("/pki", NewHandler(authority).RevocationRoutes())
+	server := httptest.NewServer(r)
+	defer server.Close()
+	authority.SetRevocationEndpoints(server.URL+"/pki/crl", server.URL+"/pki/ocsp")
+
+	agency, _ := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	cert, _ := parseCertificatePEM(agency.Certificate)
+	if len(cert.OCSPServer) != 1 || len(cert.CRLDistributionPoints) != 1 {
+		t.Fatal("Certificate should point to the OCSP responder and the CRL")
+	}
+
+	checker := NewRevocationChecker(authority.rootCert)
+	status, err := checker.Status(ctx, cert)
+	if err != nil {
+		t.Fatalf("Expected status, got: %v", err)
+	}
+	if status.Revoked || status.Source != "ocsp" {
+		t.Errorf("Expected good status from OCSP, got %+v", status)
+	}
+
+	signedAt := time.Now().Add(-time.Minute)
+	authority.SuspendAgency(ctx, agency.ID, "Security concern")
+
+	// The cached status holds until its next update
+	if err := checker.Check(ctx, cert, time.Time{}); err != nil {
+		t.Errorf("Expected cached good status, got: %v", err)
+	}
+
+	checker = NewRevocationChecker(authority.rootCert)
+	if err := checker.Check(ctx, cert, time.Time{}); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected ErrCertificateRevoked, got: %v", err)
+	}
+	if err := checker.Check(ctx, cert, signedAt); err != nil {
+		t.Errorf("Signature made before suspension should stay valid, got: %v", err)
+	}
+}
+
+func TestRevocationCheckerFallsBackToCRL(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := NewAuthority(repo)
+	ctx := context.Background()
+
+	r := chi.NewRouter()
+	r.Mount("/pki", NewHandler(authority).RevocationRoutes())
+	server := httptest.NewServer(r)
+	defer server.Close()
+	// The OCSP responder is unreachable
+	authority.SetRevocationEndpoints(server.URL+"/pki/crl", server.URL+"/missing/ocsp")
+
+	agency, _ := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	cert, _ := parseCertificatePEM(agency.Certificate)
+	signedAt := time.Now().Add(-time.Minute)
+	authority.revokeCertificate(ctx, agency.ID, agency.Certificate, ocsp.KeyCompromise, "Key compromise")
+
+	checker := NewRevocationChecker(authority.rootCert)
+	status, err := checker.Status(ctx, cert)
+	if err != nil {
+		t.Fatalf("Expected status from CRL, got: %v", err)
+	}
+	if !status.Revoked || status.Source != "crl" {
+		t.Errorf("Expected revoked status from CRL, got %+v", status)
+	}
+
+	// Key compromise invalidates signatures made before the revocation too
+	if err := checker.Check(ctx, cert, signedAt); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected ErrCertificateRevoked, got: %v", err)
+	}
+}
+
+func TestRevocationCheckerUnknownIssuer(t *testing.T) {
+	authority, _ := NewAuthority(newMockRepository())
+	other, _ := NewAuthority(newMockRepository())
+
+	agency, _ := enrollAgency(t, other, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	cert, _ := parseCertificatePEM(agency.Certificate)
+
+	if _, err := authority.RevocationChecker().Status(context.Background(), cert); !errors.Is(err, ErrUnknownIssuer) {
+		t.Errorf("Expected ErrUnknownIssuer, got: %v", err)
+	}
+}
+
+func TestRevocationsSurviveRestart(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := NewAuthority(repo)
+	ctx := context.Background()
+
+	agency, _ := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	authority.RevokeAgency(ctx, agency.ID, "Permanent removal")
+
+	restarted, _ := NewAuthorityWithRoot(repo, authority.rootCert, authority.rootKey)
+	if _, err := restarted.Load(ctx); err != nil {
+		t.Fatalf("Failed to load registry: %v", err)
+	}
+	if err := restarted.VerifyCertificate(agency.Certificate); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected ErrCertificateRevoked after restart, got: %v", err)
+	}
+}
+
+// --- Renewal and Rotation Tests ---
+
+func TestRenewWithCurrentKey(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := NewAuthority(repo)
+	ctx := context.Background()
+
+	agency, key := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	oldCert := agency.Certificate
+
+	csr, proof, err := CreateRenewal("MUP", key, key)
+	if err != nil {
+		t.Fatalf("Failed to create renewal: %v", err)
+	}
+	renewed, err := authority.Renew(ctx, agency.ID, csr, proof)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if renewed.KeyID != KeyID(key.Public().(ed25519.PublicKey)) {
+		t.Error("Renewal with the current key should keep the key ID")
+	}
+	if len(renewed.PreviousKeys) != 0 {
+		t.Error("Renewal with the current key should not keep a previous key")
+	}
+	if err := authority.VerifyCertificate(renewed.Certificate); err != nil {
+		t.Errorf("Expected renewed certificate to be valid, got: %v", err)
+	}
+	if err := authority.VerifyCertificate(oldCert); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected previous certificate to be superseded, got: %v", err)
+	}
+}
+
+func TestRenewWithNewKey(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := NewAuthority(repo)
+	authority.SetKeyOverlap(time.Hour)
+	ctx := context.Background()
+
+	agency, oldKey := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	oldKeyID := agency.KeyID
+	oldCert := agency.Certificate
+
+	_, newKey, _ := ed25519.GenerateKey(rand.Reader)
+	csr, proof, _ := CreateRenewal("MUP", oldKey, newKey)
+	renewed, err := authority.Renew(ctx, agency.ID, csr, proof)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if renewed.KeyID == oldKeyID {
+		t.Fatal("Expected the new key to become current")
+	}
+	now := time.Now()
+	if keys := renewed.VerificationKeys("", now); len(keys) != 2 {
+		t.Errorf("Expected current and previous key during the overlap, got %d", len(keys))
+	}
+	if keys := renewed.VerificationKeys(oldKeyID, now); len(keys) != 1 || keys[0].KeyID != oldKeyID {
+		t.Error("Expected the previous key to be selectable by its ID")
+	}
+	if keys := renewed.VerificationKeys(oldKeyID, now.Add(2*time.Hour)); len(keys) != 0 {
+		t.Error("Previous key should not verify after the overlap")
+	}
+	if err := authority.VerifyCertificate(oldCert); err != nil {
+		t.Errorf("Previous certificate should stay valid during the overlap, got: %v", err)
+	}
+
+	// Once the overlap has ended, the expiry check retires the key
+	retired := now.Add(-time.Minute)
+	renewed.PreviousKeys[0].RetiresAt = &retired
+	authority.CheckExpiry(ctx)
+	if len(renewed.PreviousKeys) != 0 {
+		t.Error("Expected the previous key to be retired")
+	}
+	if err := authority.VerifyCertificate(oldCert); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected retired certificate to be revoked, got: %v", err)
+	}
+
+	// The previous key is kept across restarts until it retires
+	if len(repo.keys[agency.ID]) != 2 {
+		t.Errorf("Expected 2 stored keys, got %d", len(repo.keys[agency.ID]))
+	}
+}
+
+func TestRenewRequiresCurrentKey(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := NewAuthority(repo)
+	ctx := context.Background()
+
+	agency, key := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	csr, proof, _ := CreateRenewal("MUP", otherKey, otherKey)
+	if _, err := authority.Renew(ctx, agency.ID, csr, proof); !errors.Is(err, ErrRenewalProof) {
+		t.Errorf("Expected ErrRenewalProof, got: %v", err)
+	}
+
+	csr, proof, _ = CreateRenewal("PURS", key, key)
+	if _, err := authority.Renew(ctx, agency.ID, csr, proof); err == nil {
+		t.Error("Expected error for a CSR of another agency")
+	}
+
+	authority.SuspendAgency(ctx, agency.ID, "Security concern")
+	csr, proof, _ = CreateRenewal("MUP", key, key)
+	if _, err := authority.Renew(ctx, agency.ID, csr, proof); err == nil {
+		t.Error("Expected error for a suspended agency")
+	}
+}
+
+func TestCheckExpiry(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := NewAuthority(repo)
+	ctx := context.Background()
+
+	agency, _ := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+
+	var warned []CertificateExpiry
+	authority.SetExpiryHandler(func(ctx context.Context, expiry CertificateExpiry) {
+		warned = append(warned, expiry)
+	})
+
+	if expiring := authority.CheckExpiry(ctx); len(expiring) != 0 {
+		t.Errorf("Expected no expiring certificates, got %d", len(expiring))
+	}
+
+	// Certificates are valid for a year
+	authority.SetRenewBefore(400 * 24 * time.Hour)
+	authority.CheckExpiry(ctx)
+	if len(warned) != 1 || warned[0].AgencyCode != "MUP" || warned[0].KeyID != agency.KeyID {
+		t.Fatalf("Expected a warning for MUP, got %+v", warned)
+	}
+	if warned[0].DaysLeft < 364 || warned[0].DaysLeft > 366 {
+		t.Errorf("Expected about a year left, got %d days", warned[0].DaysLeft)
+	}
+}
+
+func TestRotateRoot(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "root-ca.pem")
+	keyPath := filepath.Join(dir, "root-ca.key")
+	repo := newMockRepository()
+	ctx := context.Background()
+
+	rootCert, rootKey, _, _ := LoadOrCreateRootCA(certPath, keyPath)
+	authority, _ := NewAuthorityWithRoot(repo, rootCert, rootKey)
+	authority.SetRootPaths(certPath, keyPath)
+
+	agency, _ := enrollAgency(t, authority, "Ministry of Interior", "MUP", "https://mup.gov.rs/gateway")
+	oldCert, _ := parseCertificatePEM(agency.Certificate)
+
+	rotation, err := authority.RotateRoot(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if rotation.Reissued != 1 {
+		t.Errorf("Expected 1 reissued certificate, got %d", rotation.Reissued)
+	}
+
+	newRoot, _ := parseCertificatePEM(rotation.Root)
+	crossSigned, _ := parseCertificatePEM(rotation.CrossSigned)
+	reverseCrossSigned, _ := parseCertificatePEM(rotation.ReverseCrossSigned)
+	newCert, _ := parseCertificatePEM(agency.Certificate)
+
+	if err := newCert.CheckSignatureFrom(newRoot); err != nil {
+		t.Errorf("Agency certificate should be reissued under the new root: %v", err)
+	}
+	if err := authority.VerifyCertificate(agency.Certificate); err != nil {
+		t.Errorf("Expected reissued certificate to be valid, got: %v", err)
+	}
+	if err := authority.VerifyCertificate(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: oldCert.Raw})); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected certificate under the old root to be superseded, got: %v", err)
+	}
+
+	// Relying parties that trust only the old root reach new certificates
+	// through the cross certificate, and the other way around
+	verify := func(cert, root, cross *x509.Certificate) error {
+		roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+		roots.AddCert(root)
+		intermediates.AddCert(cross)
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		return err
+	}
+	if err := verify(newCert, rootCert, crossSigned); err != nil {
+		t.Errorf("New certificate should chain to the old root: %v", err)
+	}
+	if err := verify(oldCert, newRoot, reverseCrossSigned); err != nil {
+		t.Errorf("Old certificate should chain to the new root: %v", err)
+	}
+
+	// The local revocation checker follows the rotation
+	if _, err := authority.RevocationChecker().Status(ctx, oldCert); err != nil {
+		t.Errorf("Expected status of a certificate under the old root, got: %v", err)
+	}
+
+	// The new root is loaded from disk on restart, with the old one trusted
+	loadedCert, loadedKey, err := LoadRootCA(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("Failed to load rotated root CA: %v", err)
+	}
+	if !loadedCert.Equal(newRoot) {
+		t.Error("Expected the rotated root on disk")
+	}
+	restarted, _ := NewAuthorityWithRoot(repo, loadedCert, loadedKey)
+	if _, err := restarted.Load(ctx); err != nil {
+		t.Fatalf("Failed to load registry: %v", err)
+	}
+	if len(restarted.previousRoots) != 1 || len(restarted.crossCerts) != 2 {
+		t.Errorf("Expected 1 previous root and 2 cross certificates, got %d and %d",
+			len(restarted.previousRoots), len(restarted.crossCerts))
+	}
+	if err := restarted.VerifyCertificate(agency.Certificate); err != nil {
+		t.Errorf("Expected reissued certificate to be valid after restart, got: %v", err)
+	}
+	if chain := restarted.CAChainPEM(); bytes.Count(chain, []byte("BEGIN CERTIFICATE")) != 4 {
+		t.Errorf("Expected 4 certificates in the CA chain, got %d", bytes.Count(chain, []byte("BEGIN CERTIFICATE")))
+	}
+}
+
+// --- Intermediate CA Tests ---
+
+func TestSectorIntermediateIssuesAgencyCertificates(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := NewAuthority(repo)
+	authority.SetRevocationEndpoints("https://trust.gov.rs/pki/crl", "https://trust.gov.rs/pki/ocsp")
+
+	health, err := authority.IssueIntermediate(SectorHealth, []string{"dz-ki", "OB-KI"})
+	if err != nil {
+		t.Fatalf("Failed to issue intermediate CA: %v", err)
+	}
+	if !slices.Equal(health.Codes, []string{"DZ-KI", "OB-KI"}) {
+		t.Errorf("Expected normalized agency codes, got %v", health.Codes)
+	}
+
+	agency, _ := enrollAgency(t, authority, "Dom zdravlja Kikinda", "DZ-KI", "https://dz.kikinda.gov.rs/api")
+	cert, _ := parseCertificatePEM(agency.Certificate)
+	if err := cert.CheckSignatureFrom(authority.intermediates[SectorHealth].cert); err != nil {
+		t.Errorf("Health agency certificate should be issued by the health CA: %v", err)
+	}
+	if !slices.Equal(cert.CRLDistributionPoints, []string{"https://trust.gov.rs/pki/crl/health"}) {
+		t.Errorf("Expected the CRL of the health CA, got %v", cert.CRLDistributionPoints)
+	}
+	if err := authority.VerifyCertificate(agency.Certificate); err != nil {
+		t.Errorf("Expected certificate to chain through the intermediate, got: %v", err)
+	}
+
+	// Agencies outside the sectors are issued by the root
+	government, _ := enrollAgency(t, authority, "Vlada Republike Srbije", "VLADA-RS", "https://vlada.gov.rs/api")
+	cert, _ = parseCertificatePEM(government.Certificate)
+	if err := cert.CheckSignatureFrom(authority.rootCert); err != nil {
+		t.Errorf("Certificate outside the sectors should be issued by the root: %v", err)
+	}
+	if err := authority.VerifyCertificate(government.Certificate); err != nil {
+		t.Errorf("Expected root-issued certificate to be valid, got: %v", err)
+	}
+
+	if chain := authority.CAChainPEM(); bytes.Count(chain, []byte("BEGIN CERTIFICATE")) != 2 {
+		t.Errorf("Expected root and intermediate in the CA chain, got %d", bytes.Count(chain, []byte("BEGIN CERTIFICATE")))
+	}
+}
+
+func TestIntermediateNameConstraints(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := NewAuthority(repo)
+
+	authority.IssueIntermediate(SectorHealth, []string{"DZ-KI"})
+	if _, err := authority.IssueIntermediate(SectorPolice, []string{"PU-KI", "DZ-KI"}); !errors.Is(err, ErrSectorPolicy) {
+		t.Errorf("Expected ErrSectorPolicy for a code of another sector, got: %v", err)
+	}
+	if _, err := authority.IssueIntermediate("finance", []string{"PURS"}); !errors.Is(err, ErrUnknownSector) {
+		t.Errorf("Expected ErrUnknownSector, got: %v", err)
+	}
+
+	// A sector key that issues for an agency outside its sector
+	health := authority.intermediates[SectorHealth]
+	_, agencyKey, _ := ed25519.GenerateKey(rand.Reader)
+	issue := func(commonName string, dnsNames []string) []byte {
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: commonName},
+			DNSNames:     dnsNames,
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, health.cert, agencyKey.Public(), health.key)
+		if err != nil {
+			t.Fatalf("Failed to issue certificate: %v", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+
+	if err := authority.VerifyCertificate(issue("DZ-KI.gov.rs", []string{"dz-ki.gov.rs"})); err != nil {
+		t.Errorf("Expected certificate within the constraints to be valid, got: %v", err)
+	}
+	if err := authority.VerifyCertificate(issue("MUP.gov.rs", []string{"mup.gov.rs"})); err == nil {
+		t.Error("Expected certificate outside the constraints to be rejected")
+	}
+	if err := authority.VerifyCertificate(issue("MUP.gov.rs", []string{"dz-ki.gov.rs"})); !errors.Is(err, ErrNameConstraint) {
+		t.Errorf("Expected ErrNameConstraint for a subject outside the DNS names, got: %v", err)
+	}
+	if err := authority.VerifyCertificate(issue("MUP.gov.rs", nil)); !errors.Is(err, ErrNameConstraint) {
+		t.Errorf("Expected ErrNameConstraint without DNS names, got: %v", err)
+	}
+}
+
+func TestSectorRevocationPublishing(t *testing.T) {
+	repo := newMockRepository()
+	authority, _ := NewAuthority(repo)
+	ctx := context.Background()
+
+	r := chi.NewRouter()
+	r.Mount("/pki", NewHandler(authority).RevocationRoutes())
+	server := httptest.NewServer(r)
+	defer server.Close()
+	authority.SetRevocationEndpoints(server.URL+"/pki/crl", server.URL+"/pki/ocsp")
+
+	authority.IssueIntermediate(SectorSocial, []string{"CSR-KI"})
+	social := authority.intermediates[SectorSocial].cert
+	agency, _ := enrollAgency(t, authority, "Centar za socijalni rad Kikinda", "CSR-KI", "https://csr.kikinda.gov.rs/api")
+	cert, _ := parseCertificatePEM(agency.Certificate)
+
+	authority.RevokeAgency(ctx, agency.ID, "Closed")
+	if repo.revocations[cert.SerialNumber.Text(16)].Issuer != SectorSocial {
+		t.Error("Expected the revocation to record the issuing sector")
+	}
+
+	// The sector CA lists the revocation in its own CRL, the root does not
+	sectorCRL, err := authority.SectorCRL(SectorSocial)
+	if err != nil {
+		t.Fatalf("Failed to get sector CRL: %v", err)
+	}
+	crl, _ := x509.ParseRevocationList(sectorCRL)
+	if err := crl.CheckSignatureFrom(social); err != nil {
+		t.Errorf("Sector CRL should be signed by the sector CA: %v", err)
+	}
+	if len(crl.RevokedCertificateEntries) != 1 {
+		t.Errorf("Expected 1 entry in the sector CRL, got %d", len(crl.RevokedCertificateEntries))
+	}
+	rootCRL, _ := authority.CRL()
+	crl, _ = x509.ParseRevocationList(rootCRL)
+	if len(crl.RevokedCertificateEntries) != 0 {
+		t.Errorf("Expected no entries in the root CRL, got %d", len(crl.RevokedCertificateEntries))
+	}
+	if _, err := authority.SectorCRL(SectorPolice); !errors.Is(err, ErrUnknownSector) {
+		t.Errorf("Expected ErrUnknownSector for a sector without a CA, got: %v", err)
+	}
+
+	// A remote checker that knows the intermediate asks OCSP for the sector
+	checker := NewRevocationChecker(authority.rootCert)
+	if _, err := checker.Status(ctx, cert); !errors.Is(err, ErrUnknownIssuer) {
+		t.Errorf("Expected ErrUnknownIssuer without the intermediate, got: %v", err)
+	}
+	if err := checker.AddIntermediate(social); err != nil {
+		t.Fatalf("Failed to add intermediate: %v", err)
+	}
+	status, err := checker.Status(ctx, cert)
+	if err != nil {
+		t.Fatalf("Expected status, got: %v", err)
+	}
+	if !status.Revoked || status.Source != "ocsp" {
+		t.Errorf("Expected revoked status from OCSP, got %+v", status)
+	}
+
+	// And falls back to the sector CRL
+	crlChecker := NewRevocationChecker(authority.rootCert)
+	crlChecker.AddIntermediate(social)
+	status, err = crlChecker.checkCRL(ctx, cert.CRLDistributionPoints[0], cert, social)
+	if err != nil || !status.Revoked {
+		t.Errorf("Expected revoked status from the sector CRL, got %+v, %v", status, err)
+	}
+}
+
+func TestRotateRootKeepsIntermediates(t *testing.T) {
+	dir := t.TempDir()
+	repo := newMockRepository()
+	ctx := context.Background()
+
+	rootCert, rootKey, _, _ := LoadOrCreateRootCA(filepath.Join(dir, "root-ca.pem"), filepath.Join(dir, "root-ca.key"))
+	authority, _ := NewAuthorityWithRoot(repo, rootCert, rootKey)
+	authority.SetRootPaths(filepath.Join(dir, "root-ca.pem"), filepath.Join(dir, "root-ca.key"))
+	authority.SetIntermediateDir(filepath.Join(dir, "intermediates"))
+
+	authority.IssueIntermediate(SectorJustice, []string{"SUD-KI"})
+	court, _ := enrollAgency(t, authority, "Osnovni sud u Kikindi", "SUD-KI", "https://ki.os.sud.rs/api")
+	courtCert := court.Certificate
+	enrollAgency(t, authority, "Opština Kikinda", "OU-KI", "https://opstina.kikinda.gov.rs/api")
+
+	rotation, err := authority.RotateRoot(ctx)
+	if err != nil {
+		t.Fatalf("Failed to rotate root: %v", err)
+	}
+	if rotation.Intermediates != 1 || rotation.Reissued != 1 {
+		t.Errorf("Expected 1 intermediate and 1 agency certificate reissued, got %d and %d", rotation.Intermediates, rotation.Reissued)
+	}
+	if !bytes.Equal(court.Certificate, courtCert) {
+		t.Error("Certificates issued by an intermediate should not be reissued")
+	}
+	if err := authority.VerifyCertificate(court.Certificate); err != nil {
+		t.Errorf("Expected sector certificate to chain to the new root, got: %v", err)
+	}
+
+	// The reissued intermediate is loaded from disk on restart
+	newRoot, newRootKey, _ := LoadRootCA(filepath.Join(dir, "root-ca.pem"), filepath.Join(dir, "root-ca.key"))
+	restarted, _ := NewAuthorityWithRoot(repo, newRoot, newRootKey)
+	restarted.SetIntermediateDir(filepath.Join(dir, "intermediates"))
+	if loaded, err := restarted.LoadIntermediates(); err != nil || loaded != 1 {
+		t.Fatalf("Expected 1 intermediate loaded, got %d, %v", loaded, err)
+	}
+	if err := restarted.VerifyCertificate(court.Certificate); err != nil {
+		t.Errorf("Expected sector certificate to be valid after restart, got: %v", err)
+	}
+
+	// An intermediate on disk not issued by the root is refused
+	other, _ := NewAuthority(repo)
+	other.SetIntermediateDir(filepath.Join(dir, "intermediates"))
+	if _, err := other.LoadIntermediates(); err == nil {
+		t.Error("Expected error for an intermediate of another root")
+	}
+}
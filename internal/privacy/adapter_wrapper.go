@@ -17,6 +17,13 @@ type PrivacyAwareHealthAdapter struct {
 	pseudoSvc     *PseudonymizationService
 	facilityCode  string
 	accessControl *AIAccessController
+	access        AccessRecorder // nil when lookups are not recorded
+}
+
+// AccessRecorder records lookups of a data subject's records for
+// data-subject access reports (implemented by audit.AccessRecorder)
+type AccessRecorder interface {
+	RecordSubjectAccess(ctx context.Context, pseudonymID PseudonymID, source string)
 }
 
 // NewPrivacyAwareHealthAdapter creates a new privacy-aware health adapter.
@@ -33,6 +40,18 @@ func NewPrivacyAwareHealthAdapter(
 	}
 }
 
+// SetAccessRecorder enables recording of health record lookups
+func (a *PrivacyAwareHealthAdapter) SetAccessRecorder(access AccessRecorder) {
+	a.access = access
+}
+
+// recordAccess records that a subject's health record was read
+func (a *PrivacyAwareHealthAdapter) recordAccess(ctx context.Context, pseudonymID PseudonymID) {
+	if a.access != nil {
+		a.access.RecordSubjectAccess(ctx, pseudonymID, "health_record")
+	}
+}
+
 // FetchPseudonymizedHealthContext fetches health data and returns it in pseudonymized form.
 // This is what the CENTRAL system receives - no JMBG, names, or addresses.
 func (a *PrivacyAwareHealthAdapter) FetchPseudonymizedHealthContext(
@@ -50,6 +69,7 @@ func (a *PrivacyAwareHealthAdapter) FetchPseudonymizedHealthContext(
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch patient record: %w", err)
 	}
+	a.recordAccess(ctx, pseudonymID)
 
 	// Fetch hospitalizations
 	now := time.Now()
@@ -116,6 +136,7 @@ func (a *PrivacyAwareHealthAdapter) FetchPseudonymizedPatientInfo(
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch patient record: %w", err)
 	}
+	a.recordAccess(ctx, pseudonymID)
 
 	// Extract only non-PII data
 	gender := ""
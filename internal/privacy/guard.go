@@ -6,6 +6,8 @@ import (
 	"io"
 	"net/http"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -374,3 +376,51 @@ func (g *PrivacyGuard) ScanForPII(content string) []PIIField {
 
 	return fields
 }
+
+// FindPII returns the location of every PII occurrence of the given types in the content.
+// Matches are ordered by position; an LBO inside a longer match is not reported twice.
+func (g *PrivacyGuard) FindPII(content string, fields ...PIIField) []PIIMatch {
+	patterns := []struct {
+		field   PIIField
+		pattern *regexp.Regexp
+		mask    func(string) string
+	}{
+		{PIIFieldJMBG, g.jmbgPattern, MaskJMBG},
+		{PIIFieldPhone, g.phonePattern, MaskPhone},
+		{PIIFieldEmail, g.emailPattern, MaskEmail},
+		{PIIFieldLBO, g.lboPattern, func(v string) string { return v[:4] + "*******" }},
+	}
+
+	var matches []PIIMatch
+	for _, p := range patterns {
+		if len(fields) > 0 && !slices.Contains(fields, p.field) {
+			continue
+		}
+		for _, loc := range p.pattern.FindAllStringIndex(content, -1) {
+			matches = append(matches, PIIMatch{
+				Field:       p.field,
+				Start:       loc[0],
+				End:         loc[1],
+				MaskedValue: p.mask(content[loc[0]:loc[1]]),
+			})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Start != matches[j].Start {
+			return matches[i].Start < matches[j].Start
+		}
+		return matches[i].End > matches[j].End
+	})
+
+	// Drop matches contained in an earlier, longer match
+	out := matches[:0]
+	for _, m := range matches {
+		if len(out) > 0 && m.End <= out[len(out)-1].End {
+			continue
+		}
+		out = append(out, m)
+	}
+
+	return out
+}
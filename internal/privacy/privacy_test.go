@@ -949,3 +949,37 @@ func TestDepseudonymizationService_ShortJustification(t *testing.T) {
 		t.Error("Expected error for short justification")
 	}
 }
+
+// =============================================================================
+// Privacy Guard Tests
+// =============================================================================
+
+func TestPrivacyGuard_FindPII(t *testing.T) {
+	guard := NewPrivacyGuard(nil, DefaultPrivacyGuardConfig())
+	content := "JMBG 0101990710006, tel. 064 123 4567, email marko@example.rs"
+
+	matches := guard.FindPII(content)
+	if len(matches) != 3 {
+		t.Fatalf("Expected 3 matches, got %d: %+v", len(matches), matches)
+	}
+
+	expected := []PIIField{PIIFieldJMBG, PIIFieldPhone, PIIFieldEmail}
+	for i, m := range matches {
+		if m.Field != expected[i] {
+			t.Errorf("Match %d: expected %s, got %s", i, expected[i], m.Field)
+		}
+		if m.MaskedValue == content[m.Start:m.End] {
+			t.Errorf("Match %d: value should be masked", i)
+		}
+	}
+
+	if content[matches[0].Start:matches[0].End] != "0101990710006" {
+		t.Errorf("Unexpected JMBG span: %q", content[matches[0].Start:matches[0].End])
+	}
+
+	// Restricting to field types
+	onlyEmail := guard.FindPII(content, PIIFieldEmail)
+	if len(onlyEmail) != 1 || onlyEmail[0].Field != PIIFieldEmail {
+		t.Errorf("Expected only email match, got %+v", onlyEmail)
+	}
+}
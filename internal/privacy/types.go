@@ -176,6 +176,15 @@ type PIIViolation struct {
 	RequestIP     string    `json:"request_ip,omitempty"`
 }
 
+// PIIMatch is the location of detected PII within a piece of text.
+// Start and End are byte offsets into the scanned content.
+type PIIMatch struct {
+	Field       PIIField `json:"field"`
+	Start       int      `json:"start"`
+	End         int      `json:"end"`
+	MaskedValue string   `json:"masked_value"`
+}
+
 // AIAccessRequest represents a request for AI system to access data.
 type AIAccessRequest struct {
 	ID             types.ID        `json:"id"`
@@ -0,0 +1,181 @@
+package retention
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/serbia-gov/platform/internal/shared/auth"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// Handler provides HTTP handlers for the retention module
+type Handler struct {
+	service *Service
+	repo    *Repository
+}
+
+// NewHandler creates a new retention handler
+func NewHandler(service *Service, repo *Repository) *Handler {
+	return &Handler{service: service, repo: repo}
+}
+
+// Routes registers the retention routes
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/schedule", h.GetSchedule)
+	r.Get("/due", h.ListDue)
+	r.Post("/disposition", h.RunDisposition)
+
+	// Certificates of destruction
+	r.Get("/certificates", h.ListCertificates)
+	r.Get("/certificates/{certificateID}", h.GetCertificate)
+
+	return r
+}
+
+// GetSchedule returns the retention schedule
+func (h *Handler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.service.Schedule())
+}
+
+// ListDue lists records whose retention period has expired
+func (h *Handler) ListDue(w http.ResponseWriter, r *http.Request) {
+	due, held, err := h.service.Due(r.Context(), time.Now())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Agencies only see their own records
+	if user := auth.GetUser(r.Context()); user != nil && !user.IsAdmin() {
+		due = ownedBy(due, user.AgencyID)
+		held = ownedBy(held, user.AgencyID)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"due":  due,
+		"held": held,
+	})
+}
+
+// RunDisposition runs disposition on demand
+func (h *Handler) RunDisposition(w http.ResponseWriter, r *http.Request) {
+	var req RunDispositionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errors.BadRequest("invalid request body"))
+		return
+	}
+
+	// Disposition destroys records of every agency and is run centrally
+	var authorizedBy *types.ID
+	if user := auth.GetUser(r.Context()); user != nil {
+		if !user.IsAdmin() {
+			writeError(w, errors.Forbidden("only administrators can run disposition"))
+			return
+		}
+		authorizedBy = &user.ID
+	}
+
+	if req.Mode == "" {
+		req.Mode = ModeFlag
+	}
+
+	result, err := h.service.Run(r.Context(), req.Mode, req.DryRun, authorizedBy)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// ListCertificates lists certificates of destruction
+func (h *Handler) ListCertificates(w http.ResponseWriter, r *http.Request) {
+	filter := ListCertificatesFilter{}
+
+	if t := r.URL.Query().Get("item_type"); t != "" {
+		itemType := ItemType(t)
+		filter.ItemType = &itemType
+	}
+	if l := r.URL.Query().Get("limit"); l != "" {
+		filter.Limit, _ = strconv.Atoi(l)
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		filter.Offset, _ = strconv.Atoi(o)
+	}
+
+	if user := auth.GetUser(r.Context()); user != nil && !user.IsAdmin() {
+		filter.OwnerAgencyID = &user.AgencyID
+	}
+
+	certificates, total, err := h.repo.ListCertificates(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data":  certificates,
+		"total": total,
+	})
+}
+
+// GetCertificate gets a certificate of destruction
+func (h *Handler) GetCertificate(w http.ResponseWriter, r *http.Request) {
+	id, err := types.ParseID(chi.URLParam(r, "certificateID"))
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid certificate ID"))
+		return
+	}
+
+	cert, err := h.repo.FindCertificate(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if user := auth.GetUser(r.Context()); user != nil && !user.IsAdmin() && user.AgencyID != cert.OwnerAgencyID {
+		writeError(w, errors.Forbidden("certificate belongs to another agency"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cert)
+}
+
+func ownedBy(dispositions []Disposition, agencyID types.ID) []Disposition {
+	var out []Disposition
+	for _, d := range dispositions {
+		if d.OwnerAgencyID == agencyID {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if appErr, ok := err.(*errors.AppError); ok {
+		w.WriteHeader(appErr.HTTPStatus)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error":   appErr.Message,
+			"code":    appErr.Code,
+			"details": appErr.Details,
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]string{"error": "internal server error"})
+}
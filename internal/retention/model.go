@@ -0,0 +1,302 @@
+package retention
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/serbia-gov/platform/internal/case/domain"
+	"github.com/serbia-gov/platform/internal/document"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// Action defines what happens to a record when its retention period expires
+type Action string
+
+const (
+	// ActionDestroy destroys the record once its retention period expires
+	ActionDestroy Action = "destroy"
+	// ActionReview flags the record for appraisal by an archivist; it is never destroyed automatically
+	ActionReview Action = "review"
+	// ActionPermanent keeps the record permanently (it is transferred to the competent archive)
+	ActionPermanent Action = "permanent"
+)
+
+// Mode defines how a disposition run treats records due for destruction
+type Mode string
+
+const (
+	ModeFlag    Mode = "flag"    // Flag every expired record for review
+	ModeDestroy Mode = "destroy" // Destroy expired records whose class allows it, flag the rest
+)
+
+// ItemType is the kind of record subject to retention
+type ItemType string
+
+const (
+	ItemTypeCase     ItemType = "case"
+	ItemTypeDocument ItemType = "document"
+)
+
+// Class is a retention class from the agency's list of record categories
+type Class struct {
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	Years      int    `json:"years,omitempty"` // Zero for permanent classes
+	Action     Action `json:"action"`
+	LegalBasis string `json:"legal_basis"`
+}
+
+// ExpiresAt returns when the retention period of a record expires. Periods
+// run from 1 January of the year following the base date. Permanent classes
+// never expire.
+func (c Class) ExpiresAt(base time.Time) (time.Time, bool) {
+	if c.Action == ActionPermanent {
+		return time.Time{}, false
+	}
+
+	start := time.Date(base.Year()+1, time.January, 1, 0, 0, 0, 0, base.Location())
+	return start.AddDate(c.Years, 0, 0), true
+}
+
+// Schedule maps document and case types to retention classes
+type Schedule struct {
+	Classes       []Class                          `json:"classes"`
+	DocumentTypes map[document.DocumentType]string `json:"document_types"`
+	CaseTypes     map[domain.CaseType]string       `json:"case_types"`
+	DefaultClass  string                           `json:"default_class"` // For types missing from the schedule
+}
+
+const (
+	lawArchives = "Zakon o arhivskoj građi i arhivskoj službi (Sl. glasnik RS, br. 6/2020)"
+)
+
+// DefaultSchedule returns the platform retention schedule. Agencies adopt
+// their own list of record categories; this schedule follows the periods
+// most common across them.
+func DefaultSchedule() *Schedule {
+	return &Schedule{
+		Classes: []Class{
+			{Code: "PERM", Name: "Trajno", Action: ActionPermanent, LegalBasis: lawArchives},
+			{Code: "R20", Name: "20 godina, uz procenu", Years: 20, Action: ActionReview, LegalBasis: lawArchives + "; Zakonik o krivičnom postupku; Zakon o zdravstvenoj dokumentaciji i evidencijama u oblasti zdravstva"},
+			{Code: "R10", Name: "10 godina, uz procenu", Years: 10, Action: ActionReview, LegalBasis: lawArchives + "; Zakon o socijalnoj zaštiti"},
+			{Code: "D10", Name: "10 godina", Years: 10, Action: ActionDestroy, LegalBasis: lawArchives + "; Zakon o opštem upravnom postupku; Zakon o poreskom postupku i poreskoj administraciji"},
+			{Code: "D5", Name: "5 godina", Years: 5, Action: ActionDestroy, LegalBasis: lawArchives},
+		},
+		DocumentTypes: map[document.DocumentType]string{
+			document.DocumentTypeDecision:       "PERM",
+			document.DocumentTypeReport:         "R10",
+			document.DocumentTypeStatement:      "R10",
+			document.DocumentTypeEvidence:       "R10",
+			document.DocumentTypeOther:          "R10",
+			document.DocumentTypeCertificate:    "D10",
+			document.DocumentTypeContract:       "D10",
+			document.DocumentTypeForm:           "D5",
+			document.DocumentTypeCorrespondence: "D5",
+		},
+		CaseTypes: map[domain.CaseType]string{
+			domain.CaseTypeChildWelfare:     "PERM",
+			domain.CaseTypeCriminal:         "R20",
+			domain.CaseTypeHealthcare:       "R20",
+			domain.CaseTypeSocialAssistance: "R10",
+			domain.CaseTypeCivil:            "R10",
+			domain.CaseTypeAdministrative:   "D10",
+			domain.CaseTypeTax:              "D10",
+		},
+		DefaultClass: "R10",
+	}
+}
+
+// Validate checks that every mapping refers to a defined class
+func (s *Schedule) Validate() error {
+	codes := make(map[string]bool, len(s.Classes))
+	for _, c := range s.Classes {
+		if c.Code == "" {
+			return fmt.Errorf("retention class code is required")
+		}
+		if c.Action != ActionPermanent && c.Years <= 0 {
+			return fmt.Errorf("retention class %s: period is required", c.Code)
+		}
+		codes[c.Code] = true
+	}
+
+	if !codes[s.DefaultClass] {
+		return fmt.Errorf("unknown default retention class %s", s.DefaultClass)
+	}
+	for t, code := range s.DocumentTypes {
+		if !codes[code] {
+			return fmt.Errorf("document type %s: unknown retention class %s", t, code)
+		}
+	}
+	for t, code := range s.CaseTypes {
+		if !codes[code] {
+			return fmt.Errorf("case type %s: unknown retention class %s", t, code)
+		}
+	}
+
+	return nil
+}
+
+// Class returns the retention class with the given code
+func (s *Schedule) Class(code string) (Class, bool) {
+	for _, c := range s.Classes {
+		if c.Code == code {
+			return c, true
+		}
+	}
+	return Class{}, false
+}
+
+// ClassFor returns the retention class of a record
+func (s *Schedule) ClassFor(itemType ItemType, category string) Class {
+	code := s.DefaultClass
+	switch itemType {
+	case ItemTypeDocument:
+		if c, ok := s.DocumentTypes[document.DocumentType(category)]; ok {
+			code = c
+		}
+	case ItemTypeCase:
+		if c, ok := s.CaseTypes[domain.CaseType(category)]; ok {
+			code = c
+		}
+	}
+
+	class, _ := s.Class(code)
+	return class
+}
+
+// Item is a record evaluated for disposition. Closed cases are evaluated
+// together with their documents; documents are evaluated on their own only
+// when they are not linked to a case.
+type Item struct {
+	Type          ItemType   `json:"type"`
+	ID            types.ID   `json:"id"`
+	Number        string     `json:"number"`
+	Category      string     `json:"category"` // Document or case type
+	OwnerAgencyID types.ID   `json:"owner_agency_id"`
+	BaseDate      time.Time  `json:"base_date"` // When the retention period started running
+	OnHold        bool       `json:"on_hold"`   // The record or a record disposed of with it is under legal hold
+	FlaggedAt     *time.Time `json:"flagged_at,omitempty"`
+}
+
+// Disposition is a record whose retention period has expired
+type Disposition struct {
+	Item
+	Class     Class     `json:"class"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Due returns the records whose retention period has expired by now.
+// Records under legal hold are returned separately and must not be disposed of.
+func (s *Schedule) Due(items []Item, now time.Time) (due, held []Disposition) {
+	for _, item := range items {
+		class := s.ClassFor(item.Type, item.Category)
+
+		expiresAt, ok := class.ExpiresAt(item.BaseDate)
+		if !ok || expiresAt.After(now) {
+			continue
+		}
+
+		d := Disposition{Item: item, Class: class, ExpiresAt: expiresAt}
+		if item.OnHold {
+			held = append(held, d)
+		} else {
+			due = append(due, d)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].ExpiresAt.Before(due[j].ExpiresAt) })
+
+	return due, held
+}
+
+// Destroys reports whether a run in the given mode destroys the record
+func (d Disposition) Destroys(mode Mode) bool {
+	return mode == ModeDestroy && d.Class.Action == ActionDestroy && !d.OnHold
+}
+
+// DestructionCertificate records the destruction of a case or document
+type DestructionCertificate struct {
+	ID             types.ID            `json:"id"`
+	Number         string              `json:"certificate_number"`
+	RunID          types.ID            `json:"run_id"`
+	ItemType       ItemType            `json:"item_type"`
+	ItemID         types.ID            `json:"item_id"`
+	ItemNumber     string              `json:"item_number"`
+	Category       string              `json:"category"`
+	OwnerAgencyID  types.ID            `json:"owner_agency_id"`
+	ClassCode      string              `json:"class_code"`
+	RetentionYears int                 `json:"retention_years"`
+	LegalBasis     string              `json:"legal_basis"`
+	BaseDate       time.Time           `json:"base_date"`
+	ExpiredAt      time.Time           `json:"expired_at"`
+	Documents      []DestroyedDocument `json:"documents"`
+	AuthorizedBy   *types.ID           `json:"authorized_by,omitempty"` // Nil for scheduled runs
+	DestroyedAt    time.Time           `json:"destroyed_at"`
+}
+
+// DestroyedDocument lists the destroyed versions of a document
+type DestroyedDocument struct {
+	DocumentID     types.ID           `json:"document_id"`
+	DocumentNumber string             `json:"document_number"`
+	Versions       []DestroyedVersion `json:"versions"`
+}
+
+// DestroyedVersion identifies destroyed content by its hash
+type DestroyedVersion struct {
+	Version  int    `json:"version"`
+	FilePath string `json:"file_path"`
+	FileHash string `json:"file_hash"`
+}
+
+// NewDestructionCertificate creates the certificate for a disposition.
+// The destroyed documents are filled in when the record is destroyed.
+func NewDestructionCertificate(runID types.ID, d Disposition, authorizedBy *types.ID) *DestructionCertificate {
+	now := time.Now()
+	return &DestructionCertificate{
+		ID:             types.NewID(),
+		Number:         fmt.Sprintf("DC-%d-%06d", now.Year(), now.UnixNano()%1000000),
+		RunID:          runID,
+		ItemType:       d.Type,
+		ItemID:         d.ID,
+		ItemNumber:     d.Number,
+		Category:       d.Category,
+		OwnerAgencyID:  d.OwnerAgencyID,
+		ClassCode:      d.Class.Code,
+		RetentionYears: d.Class.Years,
+		LegalBasis:     d.Class.LegalBasis,
+		BaseDate:       d.BaseDate,
+		ExpiredAt:      d.ExpiresAt,
+		Documents:      []DestroyedDocument{},
+		AuthorizedBy:   authorizedBy,
+		DestroyedAt:    now,
+	}
+}
+
+// RunResult summarises a disposition run
+type RunResult struct {
+	RunID      types.ID                 `json:"run_id"`
+	Mode       Mode                     `json:"mode"`
+	DryRun     bool                     `json:"dry_run"`
+	Due        []Disposition            `json:"due"`
+	Held       []Disposition            `json:"held"`
+	Flagged    []Disposition            `json:"flagged"`
+	Destroyed  []DestructionCertificate `json:"destroyed"`
+	Errors     []string                 `json:"errors,omitempty"`
+	StartedAt  time.Time                `json:"started_at"`
+	FinishedAt time.Time                `json:"finished_at"`
+}
+
+// --- Request/Response types ---
+
+type RunDispositionRequest struct {
+	Mode   Mode `json:"mode"`
+	DryRun bool `json:"dry_run"`
+}
+
+type ListCertificatesFilter struct {
+	ItemType      *ItemType `json:"item_type,omitempty"`
+	OwnerAgencyID *types.ID `json:"owner_agency_id,omitempty"`
+	Limit         int       `json:"limit,omitempty"`
+	Offset        int       `json:"offset,omitempty"`
+}
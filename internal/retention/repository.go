@@ -0,0 +1,320 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// Repository provides database operations for retention disposition
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+// NewRepository creates a new retention repository
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+// Candidates returns the records whose retention period has started running:
+// closed cases, and finalised documents that are not linked to a case.
+// Redacted copies are disposed of with their original.
+func (r *Repository) Candidates(ctx context.Context) ([]Item, error) {
+	var items []Item
+
+	caseRows, err := r.pool.Query(ctx, `
+		SELECT c.id, c.case_number, c.type, c.owning_agency_id, c.closed_at,
+			c.legal_hold IS NOT NULL OR EXISTS (
+				SELECT 1 FROM documents.documents d
+				WHERE d.case_id = c.id AND d.legal_hold IS NOT NULL
+			),
+			c.disposition_flagged_at
+		FROM cases.cases c
+		WHERE c.status IN ('closed', 'archived') AND c.closed_at IS NOT NULL`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query closed cases")
+	}
+	items, err = scanItems(caseRows, ItemTypeCase, items)
+	if err != nil {
+		return nil, err
+	}
+
+	docRows, err := r.pool.Query(ctx, `
+		SELECT d.id, d.document_number, d.type, d.owner_agency_id, d.updated_at,
+			d.legal_hold IS NOT NULL OR EXISTS (
+				SELECT 1 FROM documents.documents c
+				WHERE c.redacted_from = d.id AND c.legal_hold IS NOT NULL
+			),
+			d.disposition_flagged_at
+		FROM documents.documents d
+		WHERE d.case_id IS NULL AND d.redacted_from IS NULL
+			AND d.status IN ('signed', 'archived', 'void')`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query finalised documents")
+	}
+	return scanItems(docRows, ItemTypeDocument, items)
+}
+
+func scanItems(rows pgx.Rows, itemType ItemType, items []Item) ([]Item, error) {
+	defer rows.Close()
+
+	for rows.Next() {
+		item := Item{Type: itemType}
+		if err := rows.Scan(
+			&item.ID, &item.Number, &item.Category, &item.OwnerAgencyID, &item.BaseDate,
+			&item.OnHold, &item.FlaggedAt,
+		); err != nil {
+			return nil, errors.Wrap(err, "failed to scan retention candidate")
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read retention candidates")
+	}
+
+	return items, nil
+}
+
+// MarkFlagged records that an expired record was flagged for review
+func (r *Repository) MarkFlagged(ctx context.Context, itemType ItemType, id types.ID, at time.Time) error {
+	table := "documents.documents"
+	if itemType == ItemTypeCase {
+		table = "cases.cases"
+	}
+
+	_, err := r.pool.Exec(ctx,
+		fmt.Sprintf(`UPDATE %s SET disposition_flagged_at = $2 WHERE id = $1`, table), id, at)
+	if err != nil {
+		return errors.Wrap(err, "failed to flag record for disposition")
+	}
+
+	return nil
+}
+
+// Destroy deletes a case with its documents, or a document with its redacted
+// copies, and stores the certificate of destruction in the same transaction.
+// The destroyed versions are added to the certificate; their content has to
+// be removed from the content store afterwards. Destruction is refused with
+// a conflict if a legal hold was placed since the record was evaluated.
+func (r *Repository) Destroy(ctx context.Context, cert *DestructionCertificate) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	documentFilter := "d.id = $1 OR d.redacted_from = $1"
+	if cert.ItemType == ItemTypeCase {
+		var onHold bool
+		err := tx.QueryRow(ctx,
+			`SELECT legal_hold IS NOT NULL FROM cases.cases WHERE id = $1 FOR UPDATE`, cert.ItemID,
+		).Scan(&onHold)
+		if err == pgx.ErrNoRows {
+			return errors.NotFound("case", cert.ItemID.String())
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to lock case")
+		}
+		if onHold {
+			return errors.Conflict("case is under legal hold")
+		}
+		documentFilter = "d.case_id = $1"
+	}
+
+	documents, err := lockDocuments(ctx, tx, documentFilter, cert.ItemID)
+	if err != nil {
+		return err
+	}
+	if cert.ItemType == ItemTypeDocument && len(documents) == 0 {
+		return errors.NotFound("document", cert.ItemID.String())
+	}
+	cert.Documents = documents
+
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM documents.documents d WHERE `+documentFilter, cert.ItemID); err != nil {
+		return errors.Wrap(err, "failed to delete documents")
+	}
+
+	if cert.ItemType == ItemTypeCase {
+		if _, err := tx.Exec(ctx, `DELETE FROM cases.cases WHERE id = $1`, cert.ItemID); err != nil {
+			return errors.Wrap(err, "failed to delete case")
+		}
+	}
+
+	if err := saveCertificate(ctx, tx, cert); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return nil
+}
+
+// lockDocuments locks the documents to be destroyed and lists their versions
+func lockDocuments(ctx context.Context, tx pgx.Tx, filter string, id types.ID) ([]DestroyedDocument, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT d.id, d.document_number, d.legal_hold IS NOT NULL,
+			v.version, v.file_path, v.file_hash
+		FROM documents.documents d
+		LEFT JOIN documents.versions v ON v.document_id = d.id
+		WHERE `+filter+`
+		ORDER BY d.document_number, v.version
+		FOR UPDATE OF d`, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to lock documents")
+	}
+	defer rows.Close()
+
+	var documents []DestroyedDocument
+	for rows.Next() {
+		var (
+			docID    types.ID
+			number   string
+			onHold   bool
+			version  *int
+			filePath *string
+			fileHash *string
+		)
+		if err := rows.Scan(&docID, &number, &onHold, &version, &filePath, &fileHash); err != nil {
+			return nil, errors.Wrap(err, "failed to scan document")
+		}
+		if onHold {
+			return nil, errors.Conflict(fmt.Sprintf("document %s is under legal hold", number))
+		}
+
+		if len(documents) == 0 || documents[len(documents)-1].DocumentID != docID {
+			documents = append(documents, DestroyedDocument{DocumentID: docID, DocumentNumber: number, Versions: []DestroyedVersion{}})
+		}
+		if version != nil {
+			last := &documents[len(documents)-1]
+			last.Versions = append(last.Versions, DestroyedVersion{Version: *version, FilePath: *filePath, FileHash: *fileHash})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read documents")
+	}
+
+	return documents, nil
+}
+
+func saveCertificate(ctx context.Context, tx pgx.Tx, cert *DestructionCertificate) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO retention.destruction_certificates (
+			id, certificate_number, run_id,
+			item_type, item_id, item_number, category, owner_agency_id,
+			class_code, retention_years, legal_basis, base_date, expired_at,
+			documents, authorized_by, destroyed_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
+		cert.ID, cert.Number, cert.RunID,
+		cert.ItemType, cert.ItemID, cert.ItemNumber, cert.Category, cert.OwnerAgencyID,
+		cert.ClassCode, cert.RetentionYears, cert.LegalBasis, cert.BaseDate, cert.ExpiredAt,
+		cert.Documents, cert.AuthorizedBy, cert.DestroyedAt,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return errors.Conflict("certificate with this number already exists")
+		}
+		return errors.Wrap(err, "failed to save destruction certificate")
+	}
+
+	return nil
+}
+
+const certificateColumns = `
+	id, certificate_number, run_id,
+	item_type, item_id, item_number, category, owner_agency_id,
+	class_code, retention_years, legal_basis, base_date, expired_at,
+	documents, authorized_by, destroyed_at`
+
+func scanCertificate(row pgx.Row) (*DestructionCertificate, error) {
+	c := &DestructionCertificate{}
+	err := row.Scan(
+		&c.ID, &c.Number, &c.RunID,
+		&c.ItemType, &c.ItemID, &c.ItemNumber, &c.Category, &c.OwnerAgencyID,
+		&c.ClassCode, &c.RetentionYears, &c.LegalBasis, &c.BaseDate, &c.ExpiredAt,
+		&c.Documents, &c.AuthorizedBy, &c.DestroyedAt,
+	)
+	return c, err
+}
+
+// FindCertificate finds a destruction certificate by ID
+func (r *Repository) FindCertificate(ctx context.Context, id types.ID) (*DestructionCertificate, error) {
+	c, err := scanCertificate(r.pool.QueryRow(ctx,
+		`SELECT `+certificateColumns+` FROM retention.destruction_certificates WHERE id = $1`, id))
+
+	if err == pgx.ErrNoRows {
+		return nil, errors.NotFound("destruction certificate", id.String())
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find destruction certificate")
+	}
+
+	return c, nil
+}
+
+// ListCertificates lists destruction certificates, most recent first
+func (r *Repository) ListCertificates(ctx context.Context, filter ListCertificatesFilter) ([]DestructionCertificate, int, error) {
+	var conditions []string
+	var args []interface{}
+	argNum := 1
+
+	if filter.ItemType != nil {
+		conditions = append(conditions, fmt.Sprintf("item_type = $%d", argNum))
+		args = append(args, *filter.ItemType)
+		argNum++
+	}
+
+	if filter.OwnerAgencyID != nil {
+		conditions = append(conditions, fmt.Sprintf("owner_agency_id = $%d", argNum))
+		args = append(args, *filter.OwnerAgencyID)
+		argNum++
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM retention.destruction_certificates %s", whereClause)
+	if err := r.pool.QueryRow(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count destruction certificates")
+	}
+
+	limit := 50
+	if filter.Limit > 0 && filter.Limit <= 100 {
+		limit = filter.Limit
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM retention.destruction_certificates %s
+		ORDER BY destroyed_at DESC
+		LIMIT $%d OFFSET $%d`, certificateColumns, whereClause, argNum, argNum+1)
+	args = append(args, limit, filter.Offset)
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to list destruction certificates")
+	}
+	defer rows.Close()
+
+	var certificates []DestructionCertificate
+	for rows.Next() {
+		c, err := scanCertificate(rows)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to scan destruction certificate")
+		}
+		certificates = append(certificates, *c)
+	}
+
+	return certificates, total, nil
+}
@@ -0,0 +1,156 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/serbia-gov/platform/internal/case/domain"
+	"github.com/serbia-gov/platform/internal/document"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+func TestDefaultScheduleIsValid(t *testing.T) {
+	s := DefaultSchedule()
+	if err := s.Validate(); err != nil {
+		t.Fatalf("Default schedule is invalid: %v", err)
+	}
+
+	for _, docType := range []document.DocumentType{
+		document.DocumentTypeReport, document.DocumentTypeStatement, document.DocumentTypeDecision,
+		document.DocumentTypeCertificate, document.DocumentTypeEvidence, document.DocumentTypeForm,
+		document.DocumentTypeCorrespondence, document.DocumentTypeContract, document.DocumentTypeOther,
+	} {
+		if _, ok := s.DocumentTypes[docType]; !ok {
+			t.Errorf("Document type %s has no retention class", docType)
+		}
+	}
+
+	for _, caseType := range []domain.CaseType{
+		domain.CaseTypeChildWelfare, domain.CaseTypeCriminal, domain.CaseTypeAdministrative,
+		domain.CaseTypeHealthcare, domain.CaseTypeSocialAssistance, domain.CaseTypeTax, domain.CaseTypeCivil,
+	} {
+		if _, ok := s.CaseTypes[caseType]; !ok {
+			t.Errorf("Case type %s has no retention class", caseType)
+		}
+	}
+}
+
+func TestScheduleValidation(t *testing.T) {
+	s := DefaultSchedule()
+	s.CaseTypes[domain.CaseTypeTax] = "MISSING"
+	if err := s.Validate(); err == nil {
+		t.Error("Expected error for unknown class")
+	}
+
+	s = DefaultSchedule()
+	s.Classes = append(s.Classes, Class{Code: "D0", Action: ActionDestroy})
+	if err := s.Validate(); err == nil {
+		t.Error("Expected error for class without period")
+	}
+}
+
+func TestClassExpiresAt(t *testing.T) {
+	class := Class{Code: "D10", Years: 10, Action: ActionDestroy}
+
+	// Periods run from 1 January of the following year
+	expires, ok := class.ExpiresAt(time.Date(2014, 3, 15, 12, 0, 0, 0, time.UTC))
+	if !ok {
+		t.Fatal("Expected class to expire")
+	}
+	if want := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC); !expires.Equal(want) {
+		t.Errorf("Expected %s, got %s", want, expires)
+	}
+
+	if _, ok := (Class{Code: "PERM", Action: ActionPermanent}).ExpiresAt(time.Now()); ok {
+		t.Error("Permanent class should never expire")
+	}
+}
+
+func TestScheduleDue(t *testing.T) {
+	s := DefaultSchedule()
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	longAgo := time.Date(2010, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	items := []Item{
+		{Type: ItemTypeCase, ID: types.NewID(), Number: "ADM-1", Category: string(domain.CaseTypeAdministrative), BaseDate: longAgo},
+		{Type: ItemTypeCase, ID: types.NewID(), Number: "ADM-2", Category: string(domain.CaseTypeAdministrative), BaseDate: now.AddDate(-2, 0, 0)},
+		{Type: ItemTypeCase, ID: types.NewID(), Number: "CHW-1", Category: string(domain.CaseTypeChildWelfare), BaseDate: longAgo},
+		{Type: ItemTypeCase, ID: types.NewID(), Number: "TAX-1", Category: string(domain.CaseTypeTax), BaseDate: longAgo, OnHold: true},
+		{Type: ItemTypeDocument, ID: types.NewID(), Number: "FRM-1", Category: string(document.DocumentTypeForm), BaseDate: longAgo},
+		{Type: ItemTypeDocument, ID: types.NewID(), Number: "RPT-1", Category: string(document.DocumentTypeReport), BaseDate: longAgo},
+		{Type: ItemTypeDocument, ID: types.NewID(), Number: "UNK-1", Category: "UNKNOWN", BaseDate: longAgo},
+	}
+
+	due, held := s.Due(items, now)
+
+	numbers := map[string]Disposition{}
+	for _, d := range due {
+		numbers[d.Number] = d
+	}
+
+	for _, want := range []string{"ADM-1", "FRM-1", "RPT-1", "UNK-1"} {
+		if _, ok := numbers[want]; !ok {
+			t.Errorf("Expected %s to be due", want)
+		}
+	}
+	if _, ok := numbers["ADM-2"]; ok {
+		t.Error("Case within its retention period should not be due")
+	}
+	if _, ok := numbers["CHW-1"]; ok {
+		t.Error("Permanent records should never be due")
+	}
+
+	if len(held) != 1 || held[0].Number != "TAX-1" {
+		t.Errorf("Expected TAX-1 to be held, got %v", held)
+	}
+
+	// Unknown types fall back to the default class, which requires review
+	if numbers["UNK-1"].Class.Code != s.DefaultClass {
+		t.Errorf("Expected default class, got %s", numbers["UNK-1"].Class.Code)
+	}
+
+	if !numbers["ADM-1"].Destroys(ModeDestroy) {
+		t.Error("Destroy class should be destroyed in destroy mode")
+	}
+	if numbers["ADM-1"].Destroys(ModeFlag) {
+		t.Error("Nothing should be destroyed in flag mode")
+	}
+	if numbers["RPT-1"].Destroys(ModeDestroy) {
+		t.Error("Review class should only be flagged")
+	}
+	if held[0].Destroys(ModeDestroy) {
+		t.Error("Records under legal hold must not be destroyed")
+	}
+}
+
+func TestNewDestructionCertificate(t *testing.T) {
+	runID := types.NewID()
+	authorizedBy := types.NewID()
+	d := Disposition{
+		Item: Item{
+			Type:          ItemTypeCase,
+			ID:            types.NewID(),
+			Number:        "ADM-2012-000001",
+			Category:      string(domain.CaseTypeAdministrative),
+			OwnerAgencyID: types.NewID(),
+			BaseDate:      time.Date(2012, 5, 1, 0, 0, 0, 0, time.UTC),
+		},
+		Class:     DefaultSchedule().ClassFor(ItemTypeCase, string(domain.CaseTypeAdministrative)),
+		ExpiresAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	cert := NewDestructionCertificate(runID, d, &authorizedBy)
+
+	if cert.Number == "" || cert.RunID != runID {
+		t.Error("Expected certificate number and run ID")
+	}
+	if cert.ItemID != d.ID || cert.ItemType != ItemTypeCase || cert.ItemNumber != d.Number {
+		t.Error("Certificate should identify the destroyed record")
+	}
+	if cert.ClassCode != "D10" || cert.RetentionYears != 10 || cert.LegalBasis == "" {
+		t.Errorf("Unexpected class on certificate: %s %d", cert.ClassCode, cert.RetentionYears)
+	}
+	if cert.AuthorizedBy == nil || *cert.AuthorizedBy != authorizedBy {
+		t.Error("Expected authorizing user on certificate")
+	}
+}
@@ -0,0 +1,173 @@
+package retention
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"github.com/serbia-gov/platform/internal/document"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/events"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// Service applies the retention schedule to closed cases and finalised documents
+type Service struct {
+	repo     *Repository
+	schedule *Schedule
+	store    document.ContentStore // nil when content storage is not configured
+	bus      events.EventBus
+}
+
+// NewService creates a new retention service
+func NewService(repo *Repository, schedule *Schedule, store document.ContentStore, bus events.EventBus) (*Service, error) {
+	if err := schedule.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid retention schedule: %w", err)
+	}
+
+	return &Service{repo: repo, schedule: schedule, store: store, bus: bus}, nil
+}
+
+// Schedule returns the retention schedule in use
+func (s *Service) Schedule() *Schedule {
+	return s.schedule
+}
+
+// Due returns the records whose retention period has expired, and separately
+// those that are expired but under legal hold
+func (s *Service) Due(ctx context.Context, now time.Time) (due, held []Disposition, err error) {
+	items, err := s.repo.Candidates(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	due, held = s.schedule.Due(items, now)
+	return due, held, nil
+}
+
+// Run performs a disposition run. In flag mode every expired record is
+// flagged for review; in destroy mode records whose class allows it are
+// destroyed and the rest are flagged. Records under legal hold are skipped.
+// A dry run only reports what would happen. authorizedBy is nil for
+// scheduled runs.
+func (s *Service) Run(ctx context.Context, mode Mode, dryRun bool, authorizedBy *types.ID) (*RunResult, error) {
+	if mode != ModeFlag && mode != ModeDestroy {
+		return nil, errors.BadRequest(fmt.Sprintf("invalid disposition mode: %s", mode))
+	}
+
+	result := &RunResult{
+		RunID:     types.NewID(),
+		Mode:      mode,
+		DryRun:    dryRun,
+		Flagged:   []Disposition{},
+		Destroyed: []DestructionCertificate{},
+		StartedAt: time.Now(),
+	}
+
+	due, held, err := s.Due(ctx, result.StartedAt)
+	if err != nil {
+		return nil, err
+	}
+	result.Due = due
+	result.Held = held
+
+	if dryRun {
+		result.FinishedAt = time.Now()
+		return result, nil
+	}
+
+	for _, d := range due {
+		if !d.Destroys(mode) {
+			if d.FlaggedAt != nil {
+				continue // Already awaiting review
+			}
+			if err := s.repo.MarkFlagged(ctx, d.Type, d.ID, result.StartedAt); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s %s: %v", d.Type, d.Number, err))
+				continue
+			}
+			result.Flagged = append(result.Flagged, d)
+			s.publish(ctx, d.Type, "disposition_due", d.ID, d.OwnerAgencyID, authorizedBy, map[string]any{
+				"run_id":     result.RunID,
+				"class_code": d.Class.Code,
+				"action":     d.Class.Action,
+				"expired_at": d.ExpiresAt,
+			})
+			continue
+		}
+
+		cert := NewDestructionCertificate(result.RunID, d, authorizedBy)
+		if err := s.repo.Destroy(ctx, cert); err != nil {
+			if stderrors.Is(err, errors.ErrConflict) {
+				// A legal hold was placed after the record was evaluated
+				d.OnHold = true
+				result.Held = append(result.Held, d)
+				continue
+			}
+			result.Errors = append(result.Errors, fmt.Sprintf("%s %s: %v", d.Type, d.Number, err))
+			continue
+		}
+
+		// The records are gone; remove their content
+		if s.store != nil {
+			for _, doc := range cert.Documents {
+				for _, v := range doc.Versions {
+					if err := s.store.Delete(ctx, v.FilePath); err != nil {
+						result.Errors = append(result.Errors, fmt.Sprintf("document %s v%d: %v", doc.DocumentNumber, v.Version, err))
+					}
+				}
+			}
+		}
+
+		result.Destroyed = append(result.Destroyed, *cert)
+		s.publish(ctx, d.Type, "destroyed", d.ID, d.OwnerAgencyID, authorizedBy, map[string]any{
+			"run_id":             result.RunID,
+			"certificate_id":     cert.ID,
+			"certificate_number": cert.Number,
+			"certificate":        cert,
+		})
+	}
+
+	result.FinishedAt = time.Now()
+	return result, nil
+}
+
+// Start runs disposition periodically until the context is cancelled
+func (s *Service) Start(ctx context.Context, mode Mode, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result, err := s.Run(ctx, mode, false, nil)
+			if err != nil {
+				fmt.Printf("Retention disposition run failed: %v\n", err)
+				continue
+			}
+			for _, e := range result.Errors {
+				fmt.Printf("Retention disposition: %s\n", e)
+			}
+		}
+	}
+}
+
+// publish emits a case.* or document.* event so that disposition is recorded in the audit log
+func (s *Service) publish(ctx context.Context, itemType ItemType, action string, id, agencyID types.ID, authorizedBy *types.ID, data map[string]any) {
+	if s.bus == nil {
+		return
+	}
+
+	data[string(itemType)+"_id"] = id
+
+	event := events.NewEvent(string(itemType)+"."+action, string(itemType), data)
+	if authorizedBy != nil {
+		event = event.WithActor(*authorizedBy, "worker", agencyID)
+	} else {
+		event = event.WithActor(types.ID(""), "system", agencyID)
+	}
+
+	s.bus.Publish(ctx, event)
+}
@@ -17,10 +17,14 @@ const (
 	UserContextKey contextKey = "user"
 )
 
+// UserTypeAgency is the user type of a remote agency calling local handlers
+// through the federation gateway
+const UserTypeAgency = "agency"
+
 // User represents the authenticated user from JWT claims
 type User struct {
 	ID            types.ID `json:"sub"`
-	UserType      string   `json:"user_type"`      // worker, citizen, admin
+	UserType      string   `json:"user_type"`      // worker, citizen, admin, agency
 	AgencyID      types.ID `json:"agency_id"`
 	Roles         []string `json:"roles"`
 	Permissions   []string `json:"permissions"`
@@ -28,6 +32,7 @@ type User struct {
 	EIDAssurance  string   `json:"eid_assurance"`
 	SessionID     string   `json:"session_id"`
 	MFAVerified   bool     `json:"mfa_verified"`
+	AgencyCode    string   `json:"agency_code,omitempty"` // remote agencies only
 }
 
 // Claims extends JWT claims with platform-specific data
@@ -109,6 +114,29 @@ func GetUser(ctx context.Context) *User {
 	return user
 }
 
+// WithUser returns a context carrying the user
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, UserContextKey, user)
+}
+
+// NewAgencyUser returns the user of a remote agency whose request the
+// federation gateway verified, with the permissions the agency was granted.
+// It has no roles; handlers authorise it by agency and permission.
+func NewAgencyUser(agencyID types.ID, agencyCode string, permissions []string) *User {
+	return &User{
+		ID:          agencyID,
+		UserType:    UserTypeAgency,
+		AgencyID:    agencyID,
+		AgencyCode:  agencyCode,
+		Permissions: permissions,
+	}
+}
+
+// IsAgency checks if the user is a remote agency
+func (u *User) IsAgency() bool {
+	return u.UserType == UserTypeAgency
+}
+
 // RequireRoles creates middleware that requires specific roles
 func RequireRoles(roles ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
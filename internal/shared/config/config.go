@@ -15,6 +15,11 @@ type Config struct {
 	AI         AIConfig
 	Privacy    PrivacyConfig
 	TSA        TSAConfig
+	Storage    StorageConfig
+	Retention  RetentionConfig
+	Audit      AuditConfig
+	Federation FederationConfig
+	Health     HealthConfig
 }
 
 // TSAConfig holds configuration for the Time Stamping Authority.
@@ -29,10 +34,118 @@ type TSAConfig struct {
 	CertPath string
 	// KeyPath for production TSA private key
 	KeyPath string
+	// PKCS12Path for a production TSA key and certificate chain in one file (instead of CertPath/KeyPath)
+	PKCS12Path string
+	// PKCS12Password decrypts the PKCS#12 file
+	PKCS12Password string
+	// PolicyOID is the policy under which timestamps are issued
+	PolicyOID string
 	// MultiAgencyEnabled enables multi-agency witness
 	MultiAgencyEnabled bool
 	// MultiAgencyMinSignatures is the minimum signatures required
 	MultiAgencyMinSignatures int
+	// MultiAgencyDeadlineMinutes is how long agency signatures are collected for a checkpoint
+	MultiAgencyDeadlineMinutes int
+	// AgencyCode identifies this node when signing as a multi-agency witness
+	AgencyCode string
+	// ArchiveEnabled renews archive timestamps of tokens, checkpoints and signatures
+	ArchiveEnabled bool
+	// ArchiveRenewBeforeDays is how long before the TSA certificate expires archive timestamps are renewed
+	ArchiveRenewBeforeDays int
+	// ArchiveHashAlgorithm for new archive timestamps; changing it renews every record
+	ArchiveHashAlgorithm string
+	// ArchiveIntervalHours is the time between archive renewal runs
+	ArchiveIntervalHours int
+}
+
+// FederationConfig holds configuration for the federation Trust Authority.
+type FederationConfig struct {
+	// RootCertPath is the PEM root CA certificate of the Trust Authority
+	RootCertPath string
+	// RootKeyPath is the PEM PKCS#8 root CA private key; both are generated once when neither file exists
+	RootKeyPath string
+	// IntermediateDir holds the sector intermediate CAs (<sector>-ca.pem, <sector>-ca.key), kept apart from the root key
+	IntermediateDir string
+	// GatewayKeyPath is the PEM PKCS#8 Ed25519 key of this agency's gateway; generated once when missing
+	GatewayKeyPath string
+	// EnrollmentTTLHours is how long enrollment tokens can be used
+	EnrollmentTTLHours int
+	// EnrollmentTokenDir is where enrollment tokens for the seeded pilot agencies are written
+	EnrollmentTokenDir string
+	// KeyOverlapHours is how long a replaced agency key still verifies signatures
+	KeyOverlapHours int
+	// RenewBeforeDays is how long before expiry agency admins are warned to renew certificates
+	RenewBeforeDays int
+	// ClockSkewSeconds is how far incoming request timestamps may be from the gateway clock, either way
+	ClockSkewSeconds int
+	// NonceBackend selects where IDs of accepted requests are kept: "memory", or "postgres" for clustered gateways
+	NonceBackend string
+	// NonceCapacity bounds the in-memory nonce store
+	NonceCapacity int
+	// MaxBodyBytes bounds the body of requests received through the gateway
+	MaxBodyBytes int
+	// ForwardedHeaders are the request headers the gateway passes on to local handlers
+	ForwardedHeaders []string
+	// Grants give remote agencies permissions on federated routes, as CODE:permission
+	Grants []string
+}
+
+// HealthConfig holds configuration for the local hospital information system.
+type HealthConfig struct {
+	// HeliantHost is the Heliant HIS database server; empty disables health lookups
+	HeliantHost     string
+	HeliantPort     int
+	HeliantDatabase string
+	HeliantUser     string
+	HeliantPassword string
+	// InstitutionCode and InstitutionName identify the hospital
+	InstitutionCode string
+	InstitutionName string
+}
+
+// StorageConfig holds configuration for document content storage.
+type StorageConfig struct {
+	// DocumentPath is the directory where document version content is stored
+	DocumentPath string
+}
+
+// RetentionConfig holds configuration for retention disposition.
+type RetentionConfig struct {
+	// DispositionEnabled runs disposition periodically
+	DispositionEnabled bool
+	// DispositionMode: "flag" to flag expired records for review, "destroy" to destroy them
+	DispositionMode string
+	// DispositionIntervalHours is the time between scheduled disposition runs
+	DispositionIntervalHours int
+}
+
+// AuditConfig holds configuration for audit storage and scheduled checkpoints.
+type AuditConfig struct {
+	// Backend selects the audit store: "kurrentdb" or "postgres".
+	// Without an event store the audit log falls back to PostgreSQL.
+	Backend string
+	// CheckpointEnabled creates witnessed checkpoints periodically
+	CheckpointEnabled bool
+	// CheckpointIntervalMinutes is the maximum time between checkpoints while entries are pending
+	CheckpointIntervalMinutes int
+	// CheckpointEveryEntries creates a checkpoint once this many entries are pending (0 disables)
+	CheckpointEveryEntries int
+	// WitnessRetries is the number of retries of a failed witness call
+	WitnessRetries int
+	// WitnessRetryDelaySeconds is the delay before the first retry; it doubles on each retry
+	WitnessRetryDelaySeconds int
+	// AlertsEnabled evaluates alert rules against new audit entries
+	AlertsEnabled bool
+	// WorkStartHour and WorkEndHour bound working hours in WorkTimezone;
+	// reads of citizens' data outside them raise an alert
+	WorkStartHour int
+	WorkEndHour   int
+	WorkTimezone  string
+	// SIEMSyslogAddr is the host:port of the SOC syslog collector; empty disables forwarding
+	SIEMSyslogAddr string
+	// SIEMSyslogTLS sends syslog over TLS, verified against SIEMSyslogCAFile or the system roots
+	SIEMSyslogTLS    bool
+	SIEMSyslogCAFile string
 }
 
 type AIConfig struct {
@@ -92,6 +205,8 @@ type KurrentDBConfig struct {
 type ServerConfig struct {
 	Port int
 	Env  string
+	// PublicURL is the externally reachable base URL (used in printed verification links)
+	PublicURL string
 }
 
 type DatabaseConfig struct {
@@ -122,8 +237,9 @@ type AuthConfig struct {
 func Load() (*Config, error) {
 	return &Config{
 		Server: ServerConfig{
-			Port: getEnvInt("SERVER_PORT", 8080),
-			Env:  getEnv("ENV", "development"),
+			Port:      getEnvInt("SERVER_PORT", 8080),
+			Env:       getEnv("ENV", "development"),
+			PublicURL: getEnv("PUBLIC_URL", "http://localhost:8080"),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -174,13 +290,70 @@ func Load() (*Config, error) {
 			MaxRecordsLevel2:     getEnvInt("PRIVACY_MAX_RECORDS_LEVEL2", 100),
 		},
 		TSA: TSAConfig{
-			Enabled:                  getEnvBool("TSA_ENABLED", true),
-			WitnessType:              getEnv("TSA_WITNESS_TYPE", "local"), // local, rfc3161_tsa, multi_agency, composite
-			OrgName:                  getEnv("TSA_ORG_NAME", "Serbia Government Platform"),
-			CertPath:                 getEnv("TSA_CERT_PATH", ""),
-			KeyPath:                  getEnv("TSA_KEY_PATH", ""),
-			MultiAgencyEnabled:       getEnvBool("TSA_MULTI_AGENCY_ENABLED", false),
-			MultiAgencyMinSignatures: getEnvInt("TSA_MULTI_AGENCY_MIN_SIGNATURES", 2),
+			Enabled:                    getEnvBool("TSA_ENABLED", true),
+			WitnessType:                getEnv("TSA_WITNESS_TYPE", "local"), // local, rfc3161_tsa, multi_agency, composite
+			OrgName:                    getEnv("TSA_ORG_NAME", "Serbia Government Platform"),
+			CertPath:                   getEnv("TSA_CERT_PATH", ""),
+			KeyPath:                    getEnv("TSA_KEY_PATH", ""),
+			PKCS12Path:                 getEnv("TSA_PKCS12_PATH", ""),
+			PKCS12Password:             getEnv("TSA_PKCS12_PASSWORD", ""),
+			PolicyOID:                  getEnv("TSA_POLICY_OID", "1.3.6.1.4.1.99999.1.1"),
+			MultiAgencyEnabled:         getEnvBool("TSA_MULTI_AGENCY_ENABLED", false),
+			MultiAgencyMinSignatures:   getEnvInt("TSA_MULTI_AGENCY_MIN_SIGNATURES", 2),
+			MultiAgencyDeadlineMinutes: getEnvInt("TSA_MULTI_AGENCY_DEADLINE_MINUTES", 1440),
+			AgencyCode:                 getEnv("TSA_AGENCY_CODE", "PLATFORM"),
+			ArchiveEnabled:             getEnvBool("TSA_ARCHIVE_ENABLED", true),
+			ArchiveRenewBeforeDays:     getEnvInt("TSA_ARCHIVE_RENEW_BEFORE_DAYS", 90),
+			ArchiveHashAlgorithm:       getEnv("TSA_ARCHIVE_HASH_ALGORITHM", "SHA-256"),
+			ArchiveIntervalHours:       getEnvInt("TSA_ARCHIVE_INTERVAL_HOURS", 24),
+		},
+		Federation: FederationConfig{
+			RootCertPath:       getEnv("FEDERATION_ROOT_CERT_PATH", "./data/federation/root-ca.pem"),
+			RootKeyPath:        getEnv("FEDERATION_ROOT_KEY_PATH", "./data/federation/root-ca.key"),
+			IntermediateDir:    getEnv("FEDERATION_INTERMEDIATE_DIR", "./data/federation/intermediates"),
+			GatewayKeyPath:     getEnv("FEDERATION_GATEWAY_KEY_PATH", "./data/federation/gateway.key"),
+			EnrollmentTTLHours: getEnvInt("FEDERATION_ENROLLMENT_TTL_HOURS", 72),
+			EnrollmentTokenDir: getEnv("FEDERATION_ENROLLMENT_TOKEN_DIR", "./data/federation/enrollments"),
+			KeyOverlapHours:    getEnvInt("FEDERATION_KEY_OVERLAP_HOURS", 168),
+			RenewBeforeDays:    getEnvInt("FEDERATION_RENEW_BEFORE_DAYS", 30),
+			ClockSkewSeconds:   getEnvInt("FEDERATION_CLOCK_SKEW_SECONDS", 300),
+			NonceBackend:       getEnv("FEDERATION_NONCE_BACKEND", "memory"),
+			NonceCapacity:      getEnvInt("FEDERATION_NONCE_CAPACITY", 100000),
+			MaxBodyBytes:       getEnvInt("FEDERATION_MAX_BODY_BYTES", 10<<20),
+			ForwardedHeaders:   getEnvSlice("FEDERATION_FORWARDED_HEADERS", []string{"Accept", "Accept-Language", "Content-Type", "If-Match", "If-None-Match", "X-Access-Purpose", "X-Correlation-ID"}),
+			Grants:             getEnvSlice("FEDERATION_GRANTS", nil),
+		},
+		Health: HealthConfig{
+			HeliantHost:     getEnv("HELIANT_HOST", ""),
+			HeliantPort:     getEnvInt("HELIANT_PORT", 1433),
+			HeliantDatabase: getEnv("HELIANT_DATABASE", "HeliantDB"),
+			HeliantUser:     getEnv("HELIANT_USER", ""),
+			HeliantPassword: getEnv("HELIANT_PASSWORD", ""),
+			InstitutionCode: getEnv("HELIANT_INSTITUTION_CODE", ""),
+			InstitutionName: getEnv("HELIANT_INSTITUTION_NAME", ""),
+		},
+		Storage: StorageConfig{
+			DocumentPath: getEnv("DOCUMENT_STORAGE_PATH", "./data/documents"),
+		},
+		Retention: RetentionConfig{
+			DispositionEnabled:       getEnvBool("RETENTION_DISPOSITION_ENABLED", false),
+			DispositionMode:          getEnv("RETENTION_DISPOSITION_MODE", "flag"), // flag, destroy
+			DispositionIntervalHours: getEnvInt("RETENTION_DISPOSITION_INTERVAL_HOURS", 24),
+		},
+		Audit: AuditConfig{
+			Backend:                   getEnv("AUDIT_BACKEND", "kurrentdb"),
+			CheckpointEnabled:         getEnvBool("AUDIT_CHECKPOINT_ENABLED", true),
+			CheckpointIntervalMinutes: getEnvInt("AUDIT_CHECKPOINT_INTERVAL_MINUTES", 60),
+			CheckpointEveryEntries:    getEnvInt("AUDIT_CHECKPOINT_EVERY_ENTRIES", 1000),
+			WitnessRetries:            getEnvInt("AUDIT_WITNESS_RETRIES", 3),
+			WitnessRetryDelaySeconds:  getEnvInt("AUDIT_WITNESS_RETRY_DELAY_SECONDS", 5),
+			AlertsEnabled:             getEnvBool("AUDIT_ALERTS_ENABLED", true),
+			WorkStartHour:             getEnvInt("AUDIT_WORK_START_HOUR", 7),
+			WorkEndHour:               getEnvInt("AUDIT_WORK_END_HOUR", 19),
+			WorkTimezone:              getEnv("AUDIT_WORK_TIMEZONE", "Europe/Belgrade"),
+			SIEMSyslogAddr:            getEnv("AUDIT_SIEM_SYSLOG_ADDR", ""),
+			SIEMSyslogTLS:             getEnvBool("AUDIT_SIEM_SYSLOG_TLS", true),
+			SIEMSyslogCAFile:          getEnv("AUDIT_SIEM_SYSLOG_CA_FILE", ""),
 		},
 	}, nil
 }
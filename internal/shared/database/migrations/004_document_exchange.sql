@@ -0,0 +1,16 @@
+-- Cross-agency document exchange
+-- Migration: 004_document_exchange.sql
+
+-----------------------------------------------------------
+-- DOCUMENT PROVENANCE
+-----------------------------------------------------------
+
+-- Documents received over the federation gateway keep a reference to the
+-- originating agency, document and exchange that delivered them.
+ALTER TABLE documents.documents ADD COLUMN provenance JSONB;
+
+CREATE INDEX idx_documents_origin_agency ON documents.documents((provenance->>'origin_agency'));
+CREATE INDEX idx_documents_exchange_id ON documents.documents((provenance->>'exchange_id'));
+
+COMMENT ON COLUMN documents.documents.provenance IS
+'Origin of a document received through cross-agency exchange (NULL for locally created documents).';
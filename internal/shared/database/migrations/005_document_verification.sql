@@ -0,0 +1,17 @@
+-- Public document authenticity check
+-- Migration: 005_document_verification.sql
+
+-----------------------------------------------------------
+-- VERIFICATION CODES
+-----------------------------------------------------------
+
+-- Verification code printed (and encoded as QR) on signed documents.
+-- Third parties use it on the public /verify endpoint.
+ALTER TABLE documents.documents ADD COLUMN verification_code VARCHAR(32);
+
+CREATE UNIQUE INDEX idx_documents_verification_code
+    ON documents.documents(verification_code)
+    WHERE verification_code IS NOT NULL;
+
+COMMENT ON COLUMN documents.documents.verification_code IS
+'Public verification code issued when all signatures on the current version are complete.';
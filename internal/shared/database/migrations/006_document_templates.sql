@@ -0,0 +1,57 @@
+-- Document templates and generated documents
+-- Migration: 006_document_templates.sql
+
+-----------------------------------------------------------
+-- TEMPLATES
+-----------------------------------------------------------
+
+CREATE TABLE documents.templates (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    code VARCHAR(100) UNIQUE NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+
+    document_type VARCHAR(50) NOT NULL,
+    format VARCHAR(20) NOT NULL DEFAULT 'html',
+    script VARCHAR(20) NOT NULL DEFAULT 'cyrillic', -- cyrillic, latin
+
+    owner_agency_id UUID, -- NULL for national templates
+    status VARCHAR(20) NOT NULL DEFAULT 'active', -- active, retired
+    current_revision INT NOT NULL DEFAULT 0,
+
+    created_by UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_templates_document_type ON documents.templates(document_type);
+CREATE INDEX idx_templates_owner ON documents.templates(owner_agency_id);
+
+-- Template revisions are immutable; a new revision is added for every change
+CREATE TABLE documents.template_revisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    template_id UUID NOT NULL REFERENCES documents.templates(id) ON DELETE CASCADE,
+    revision INT NOT NULL,
+
+    body TEXT NOT NULL,
+    body_hash VARCHAR(64) NOT NULL, -- SHA-256
+    change_summary VARCHAR(500),
+
+    created_by UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    UNIQUE(template_id, revision)
+);
+
+CREATE INDEX idx_template_revisions_template ON documents.template_revisions(template_id);
+
+-----------------------------------------------------------
+-- GENERATED VERSIONS
+-----------------------------------------------------------
+
+-- Document versions produced from a template record the revision used
+ALTER TABLE documents.versions ADD COLUMN template_id UUID REFERENCES documents.templates(id);
+ALTER TABLE documents.versions ADD COLUMN template_revision INT;
+
+COMMENT ON TABLE documents.template_revisions IS
+'Immutable template revisions. Generated document versions reference the exact revision used.';
@@ -0,0 +1,21 @@
+-- Document redaction
+-- Migration: 007_document_redaction.sql
+
+-----------------------------------------------------------
+-- REDACTED COPIES
+-----------------------------------------------------------
+
+-- A redacted copy is a separate document derived from one version of an original.
+-- The details record which regions were removed and why, never the removed text.
+ALTER TABLE documents.documents ADD COLUMN redacted_from UUID REFERENCES documents.documents(id);
+ALTER TABLE documents.documents ADD COLUMN redaction JSONB;
+
+-- Once a redacted copy exists, agencies other than the owner only receive redacted copies
+ALTER TABLE documents.documents ADD COLUMN requires_redaction BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_documents_redacted_from
+    ON documents.documents(redacted_from)
+    WHERE redacted_from IS NOT NULL;
+
+COMMENT ON COLUMN documents.documents.redacted_from IS
+'Unredacted original of a redacted copy. Only the owning agency can read the original.';
@@ -0,0 +1,54 @@
+-- Retention schedules, disposition and legal hold
+-- Migration: 008_retention.sql
+
+-----------------------------------------------------------
+-- LEGAL HOLD
+-----------------------------------------------------------
+
+-- A legal hold blocks deletion, voiding and disposition while litigation,
+-- an investigation or an inspection is pending
+ALTER TABLE cases.cases ADD COLUMN legal_hold JSONB;
+ALTER TABLE documents.documents ADD COLUMN legal_hold JSONB;
+
+CREATE INDEX idx_cases_legal_hold ON cases.cases(id) WHERE legal_hold IS NOT NULL;
+CREATE INDEX idx_documents_legal_hold ON documents.documents(case_id) WHERE legal_hold IS NOT NULL;
+
+-----------------------------------------------------------
+-- DISPOSITION
+-----------------------------------------------------------
+
+-- Set when a record whose retention period has expired is flagged for review
+ALTER TABLE cases.cases ADD COLUMN disposition_flagged_at TIMESTAMPTZ;
+ALTER TABLE documents.documents ADD COLUMN disposition_flagged_at TIMESTAMPTZ;
+
+CREATE INDEX idx_cases_closed_at ON cases.cases(closed_at) WHERE closed_at IS NOT NULL;
+
+CREATE SCHEMA IF NOT EXISTS retention;
+
+-- Certificate of destruction for every case or document destroyed by disposition.
+-- Records the file hashes of the destroyed content, never the content itself.
+CREATE TABLE retention.destruction_certificates (
+    id UUID PRIMARY KEY,
+    certificate_number VARCHAR(50) UNIQUE NOT NULL,
+    run_id UUID NOT NULL,
+    item_type VARCHAR(20) NOT NULL, -- case, document
+    item_id UUID NOT NULL,
+    item_number VARCHAR(50) NOT NULL,
+    category VARCHAR(50) NOT NULL,
+    owner_agency_id UUID NOT NULL,
+    class_code VARCHAR(20) NOT NULL,
+    retention_years INT NOT NULL,
+    legal_basis TEXT NOT NULL,
+    base_date TIMESTAMPTZ NOT NULL,
+    expired_at TIMESTAMPTZ NOT NULL,
+    documents JSONB NOT NULL DEFAULT '[]',
+    authorized_by UUID, -- NULL for scheduled runs
+    destroyed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_destruction_certificates_item ON retention.destruction_certificates(item_type, item_id);
+CREATE INDEX idx_destruction_certificates_agency ON retention.destruction_certificates(owner_agency_id);
+CREATE INDEX idx_destruction_certificates_destroyed_at ON retention.destruction_certificates(destroyed_at);
+
+COMMENT ON TABLE retention.destruction_certificates IS
+'Certificates of destruction issued by retention disposition. Rows are never updated or deleted.';
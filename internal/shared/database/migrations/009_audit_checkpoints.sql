@@ -0,0 +1,56 @@
+-- Audit checkpoints and append-only enforcement for the PostgreSQL audit backend
+-- Migration: 009_audit_checkpoints.sql
+
+-----------------------------------------------------------
+-- CHECKPOINTS
+-----------------------------------------------------------
+
+-- Witnessed checkpoints of the audit chain (append-only)
+CREATE TABLE audit.checkpoints (
+    id UUID PRIMARY KEY,
+    checkpoint_hash VARCHAR(64) NOT NULL,
+    last_sequence BIGINT NOT NULL,
+    last_entry_id UUID,
+    last_hash VARCHAR(64),
+    entry_count INT NOT NULL,
+
+    -- Merkle tree over entries 1..tree_size; NULL for checkpoints that predate the tree
+    tree_size BIGINT,
+    root_hash VARCHAR(64),
+
+    -- External witness
+    witness_type VARCHAR(20) NOT NULL,
+    witness_proof BYTEA,
+    witness_url VARCHAR(500),
+    witness_status VARCHAR(20) NOT NULL,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    confirmed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_audit_checkpoints_created ON audit.checkpoints(created_at);
+
+CREATE TRIGGER audit_checkpoints_no_update
+    BEFORE UPDATE ON audit.checkpoints
+    FOR EACH ROW
+    EXECUTE FUNCTION audit.prevent_modification();
+
+CREATE TRIGGER audit_checkpoints_no_delete
+    BEFORE DELETE ON audit.checkpoints
+    FOR EACH ROW
+    EXECUTE FUNCTION audit.prevent_modification();
+
+-----------------------------------------------------------
+-- TRUNCATE
+-----------------------------------------------------------
+
+-- Row triggers do not fire on TRUNCATE, which would otherwise empty the chain
+CREATE TRIGGER audit_entries_no_truncate
+    BEFORE TRUNCATE ON audit.entries
+    FOR EACH STATEMENT
+    EXECUTE FUNCTION audit.prevent_modification();
+
+CREATE TRIGGER audit_checkpoints_no_truncate
+    BEFORE TRUNCATE ON audit.checkpoints
+    FOR EACH STATEMENT
+    EXECUTE FUNCTION audit.prevent_modification();
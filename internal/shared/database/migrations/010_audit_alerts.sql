@@ -0,0 +1,34 @@
+-- Alerts raised by audit stream rules
+-- Migration: 010_audit_alerts.sql
+
+-----------------------------------------------------------
+-- ALERTS
+-----------------------------------------------------------
+
+-- Unlike audit entries, alerts are updated as security auditors handle them
+CREATE TABLE audit.alerts (
+    id UUID PRIMARY KEY,
+    rule VARCHAR(50) NOT NULL,
+    severity VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    summary TEXT NOT NULL,
+
+    -- Actor whose behaviour raised the alert; system actors are not always UUIDs
+    actor_type VARCHAR(20) NOT NULL,
+    actor_id VARCHAR(100) NOT NULL,
+    actor_agency_id UUID,
+
+    entry_ids UUID[] NOT NULL,
+    details JSONB,
+    raised_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    acknowledged_by UUID,
+    acknowledged_at TIMESTAMPTZ,
+    resolved_by UUID,
+    resolved_at TIMESTAMPTZ,
+    resolution TEXT
+);
+
+CREATE INDEX idx_audit_alerts_status ON audit.alerts(status, raised_at DESC);
+CREATE INDEX idx_audit_alerts_actor ON audit.alerts(actor_id);
+CREATE INDEX idx_audit_alerts_rule ON audit.alerts(rule);
@@ -0,0 +1,10 @@
+-- Delivery cursors of audit exports (SIEM forwarding)
+-- Migration: 011_audit_export_cursors.sql
+
+-- Last audit sequence delivered by each exporter; entries after it are
+-- sent again after a restart
+CREATE TABLE audit.export_cursors (
+    name VARCHAR(50) PRIMARY KEY,
+    last_sequence BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
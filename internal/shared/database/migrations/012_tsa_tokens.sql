@@ -0,0 +1,39 @@
+-- Time Stamping Authority serial numbers and token log
+-- Migration: 012_tsa_tokens.sql
+
+CREATE SCHEMA IF NOT EXISTS tsa;
+
+-- Serial numbers of issued tokens; a sequence never hands out a value twice,
+-- across restarts and concurrent instances
+CREATE SEQUENCE tsa.serial_numbers AS BIGINT START 1;
+
+-- Every issued timestamp token (append-only)
+CREATE TABLE tsa.tokens (
+    serial_number BIGINT PRIMARY KEY,
+    gen_time TIMESTAMPTZ NOT NULL,
+    hash_algorithm VARCHAR(20) NOT NULL,
+    hashed_message VARCHAR(128) NOT NULL, -- hex
+    nonce VARCHAR(100),
+    policy_oid VARCHAR(100) NOT NULL,
+    requester VARCHAR(100), -- client address; NULL for tokens issued in-process
+    token BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_tsa_tokens_hash ON tsa.tokens(hashed_message);
+CREATE INDEX idx_tsa_tokens_gen_time ON tsa.tokens(gen_time);
+
+CREATE TRIGGER tsa_tokens_no_update
+    BEFORE UPDATE ON tsa.tokens
+    FOR EACH ROW
+    EXECUTE FUNCTION audit.prevent_modification();
+
+CREATE TRIGGER tsa_tokens_no_delete
+    BEFORE DELETE ON tsa.tokens
+    FOR EACH ROW
+    EXECUTE FUNCTION audit.prevent_modification();
+
+CREATE TRIGGER tsa_tokens_no_truncate
+    BEFORE TRUNCATE ON tsa.tokens
+    FOR EACH STATEMENT
+    EXECUTE FUNCTION audit.prevent_modification();
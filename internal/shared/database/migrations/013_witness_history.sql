@@ -0,0 +1,29 @@
+-- Checkpoints this agency cosigned as a multi-agency witness
+-- Migration: 013_witness_history.sql
+
+-- One row per requesting agency and sequence; a witness refuses checkpoints
+-- that fork from or regress behind these (append-only)
+CREATE TABLE tsa.cosigned_checkpoints (
+    requesting_agency VARCHAR(50) NOT NULL,
+    last_sequence BIGINT NOT NULL,
+    entry_count INTEGER NOT NULL,
+    checkpoint_hash VARCHAR(64) NOT NULL,
+    signed_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (requesting_agency, last_sequence)
+);
+
+CREATE TRIGGER tsa_cosigned_checkpoints_no_update
+    BEFORE UPDATE ON tsa.cosigned_checkpoints
+    FOR EACH ROW
+    EXECUTE FUNCTION audit.prevent_modification();
+
+CREATE TRIGGER tsa_cosigned_checkpoints_no_delete
+    BEFORE DELETE ON tsa.cosigned_checkpoints
+    FOR EACH ROW
+    EXECUTE FUNCTION audit.prevent_modification();
+
+CREATE TRIGGER tsa_cosigned_checkpoints_no_truncate
+    BEFORE TRUNCATE ON tsa.cosigned_checkpoints
+    FOR EACH STATEMENT
+    EXECUTE FUNCTION audit.prevent_modification();
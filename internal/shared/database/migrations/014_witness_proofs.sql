@@ -0,0 +1,24 @@
+-- Multi-agency witness proofs collected in the background
+-- Migration: 014_witness_proofs.sql
+
+-- The checkpoint keeps the proof as first signed; signatures that arrive
+-- later, until the deadline, are added here. Every signature is verifiable
+-- on its own, so rows are updated as a proof is completed.
+CREATE TABLE tsa.witness_proofs (
+    id UUID PRIMARY KEY,
+    checkpoint_hash VARCHAR(64) NOT NULL,
+    last_sequence BIGINT NOT NULL,
+    status VARCHAR(20) NOT NULL, -- pending, confirmed, failed
+    deadline TIMESTAMPTZ NOT NULL,
+    proof JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_tsa_witness_proofs_status ON tsa.witness_proofs(status, created_at);
+
+-- Proofs are completed, never removed
+CREATE TRIGGER tsa_witness_proofs_no_delete
+    BEFORE DELETE ON tsa.witness_proofs
+    FOR EACH ROW
+    EXECUTE FUNCTION audit.prevent_modification();
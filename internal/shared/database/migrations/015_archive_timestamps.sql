@@ -0,0 +1,59 @@
+-- Evidence records of archive timestamps (RFC 4998)
+-- Migration: 015_archive_timestamps.sql
+
+-- One record per protected object: timestamp tokens issued to clients, audit
+-- checkpoints and document signatures. Archive timestamps are appended as the
+-- record is renewed; the first ones never change.
+CREATE TABLE tsa.evidence_records (
+    id UUID PRIMARY KEY,
+    object_type VARCHAR(50) NOT NULL,
+    object_id VARCHAR(100) NOT NULL,
+    object_hash VARCHAR(128) NOT NULL, -- hex
+    object_created_at TIMESTAMPTZ NOT NULL,
+    initial_token_hash VARCHAR(64) NOT NULL, -- SHA-256 of the first archive timestamp token
+    timestamps JSONB NOT NULL,
+    hash_algorithm VARCHAR(20) NOT NULL, -- of the latest archive timestamp
+    expires_at TIMESTAMPTZ NOT NULL, -- TSA certificate expiry of the latest archive timestamp
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    renewed_at TIMESTAMPTZ,
+    UNIQUE (object_type, object_id)
+);
+
+CREATE INDEX idx_tsa_evidence_records_token ON tsa.evidence_records(initial_token_hash);
+CREATE INDEX idx_tsa_evidence_records_expires ON tsa.evidence_records(expires_at);
+CREATE INDEX idx_tsa_evidence_records_enrolled ON tsa.evidence_records(object_type, object_created_at);
+
+-- Renewals may only append archive timestamps
+CREATE OR REPLACE FUNCTION tsa.evidence_append_only()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.id <> OLD.id OR NEW.object_type <> OLD.object_type OR NEW.object_id <> OLD.object_id
+        OR NEW.object_hash <> OLD.object_hash OR NEW.initial_token_hash <> OLD.initial_token_hash THEN
+        RAISE EXCEPTION 'evidence record % cannot be changed', OLD.id;
+    END IF;
+    IF jsonb_array_length(NEW.timestamps) < jsonb_array_length(OLD.timestamps) THEN
+        RAISE EXCEPTION 'archive timestamps cannot be removed from evidence record %', OLD.id;
+    END IF;
+    FOR i IN 0 .. jsonb_array_length(OLD.timestamps) - 1 LOOP
+        IF NEW.timestamps -> i IS DISTINCT FROM OLD.timestamps -> i THEN
+            RAISE EXCEPTION 'archive timestamps cannot be replaced in evidence record %', OLD.id;
+        END IF;
+    END LOOP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tsa_evidence_records_append_only
+    BEFORE UPDATE ON tsa.evidence_records
+    FOR EACH ROW
+    EXECUTE FUNCTION tsa.evidence_append_only();
+
+CREATE TRIGGER tsa_evidence_records_no_delete
+    BEFORE DELETE ON tsa.evidence_records
+    FOR EACH ROW
+    EXECUTE FUNCTION audit.prevent_modification();
+
+CREATE TRIGGER tsa_evidence_records_no_truncate
+    BEFORE TRUNCATE ON tsa.evidence_records
+    FOR EACH STATEMENT
+    EXECUTE FUNCTION audit.prevent_modification();
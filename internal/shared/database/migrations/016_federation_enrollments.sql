@@ -0,0 +1,24 @@
+-- Agency enrollment with certificate signing requests
+-- Migration: 016_federation_enrollments.sql
+
+-- One-time authorizations for an agency to enroll with a CSR for its own
+-- key. Only the SHA-256 of the token is stored.
+CREATE TABLE federation.enrollments (
+    id UUID PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    code VARCHAR(50) NOT NULL,
+    gateway_url VARCHAR(500) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+
+    -- Set once, when the token is used
+    agency_id UUID,
+    enrolled_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_enrollments_code ON federation.enrollments(code);
+
+COMMENT ON TABLE federation.enrollments IS
+'One-time enrollment tokens issued by platform admins. An agency submits the
+token with a certificate signing request and keeps its private key.';
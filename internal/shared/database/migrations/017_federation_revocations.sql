@@ -0,0 +1,37 @@
+-- Revocation of federation certificates
+-- Migration: 017_federation_revocations.sql
+
+-- Revoked and suspended (certificateHold) agency certificates, published in
+-- the CRL and by the OCSP responder
+CREATE TABLE federation.certificate_revocations (
+    serial_number VARCHAR(64) PRIMARY KEY, -- hex
+    agency_id UUID NOT NULL,
+    reason_code INT NOT NULL, -- RFC 5280 CRLReason
+    reason TEXT NOT NULL DEFAULT '',
+    revoked_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_certificate_revocations_agency ON federation.certificate_revocations(agency_id);
+
+-- A revoked certificate never becomes valid again
+CREATE OR REPLACE FUNCTION federation.prevent_revocation_removal()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'Certificate revocations cannot be removed';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER certificate_revocations_no_delete
+    BEFORE DELETE ON federation.certificate_revocations
+    FOR EACH ROW
+    EXECUTE FUNCTION federation.prevent_revocation_removal();
+
+CREATE TRIGGER certificate_revocations_no_truncate
+    BEFORE TRUNCATE ON federation.certificate_revocations
+    FOR EACH STATEMENT
+    EXECUTE FUNCTION federation.prevent_revocation_removal();
+
+COMMENT ON TABLE federation.certificate_revocations IS
+'Revoked and suspended agency certificates. Served as a signed CRL and over
+OCSP at /federation/pki so that remote gateways learn about revocations.';
@@ -0,0 +1,33 @@
+-- Agency certificate renewal, key rotation and root CA rotation
+-- Migration: 018_federation_key_rotation.sql
+
+-- Keys an agency has enrolled or renewed with. The current key is also kept
+-- in trusted_agencies; a replaced key stays valid until retires_at, so that
+-- requests signed with it during a rotation are still accepted.
+CREATE TABLE federation.agency_keys (
+    key_id VARCHAR(64) PRIMARY KEY, -- hex SHA-256 prefix of the public key
+    agency_id UUID NOT NULL REFERENCES federation.trusted_agencies(id) ON DELETE CASCADE,
+    public_key BYTEA NOT NULL,
+    certificate BYTEA NOT NULL,
+    not_after TIMESTAMPTZ NOT NULL,
+    retires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_agency_keys_agency ON federation.agency_keys(agency_id);
+
+-- Previous root CA certificates and cross certificates between roots. The
+-- current root and its key are kept on disk.
+CREATE TABLE federation.ca_certificates (
+    serial_number VARCHAR(64) PRIMARY KEY, -- hex
+    kind VARCHAR(20) NOT NULL, -- root, cross
+    subject VARCHAR(255) NOT NULL,
+    certificate BYTEA NOT NULL, -- PEM
+    not_after TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE federation.ca_certificates IS
+'Retired root CA certificates and the cross certificates issued when the root
+was rotated, published at /federation/trust/ca/chain so that relying parties
+trusting either root can verify agency certificates.';
@@ -0,0 +1,13 @@
+-- Sector intermediate CAs in the federation PKI
+-- Migration: 019_federation_intermediate_cas.sql
+
+-- Each CA publishes its own CRL: revocations record the sector of the
+-- intermediate CA that issued the certificate, empty for the root CA. The
+-- intermediate CAs themselves and their keys are kept on disk, apart from
+-- the root key.
+ALTER TABLE federation.certificate_revocations
+    ADD COLUMN issuer VARCHAR(50) NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN federation.certificate_revocations.issuer IS
+'Sector of the issuing intermediate CA (health, social, police, justice,
+education), or empty for certificates issued by the root CA.';
@@ -0,0 +1,15 @@
+-- Replay protection for the federation gateway
+-- Migration: 020_federation_gateway_nonces.sql
+
+-- IDs of signed requests the gateways have accepted, kept until the request
+-- falls out of the clock-skew window. Shared by all gateways of an agency so
+-- that a request replayed to another instance is rejected too.
+CREATE TABLE federation.gateway_nonces (
+    source_agency VARCHAR(50) NOT NULL,
+    request_id VARCHAR(100) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (source_agency, request_id)
+);
+
+CREATE INDEX idx_gateway_nonces_expires ON federation.gateway_nonces(expires_at);
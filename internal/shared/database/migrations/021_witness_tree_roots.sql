@@ -0,0 +1,10 @@
+-- Merkle tree roots of cosigned checkpoints
+-- Migration: 021_witness_tree_roots.sql
+
+-- A witness only cosigns a tree that provably extends the last tree it
+-- cosigned for the agency (RFC 6962 consistency proof). Checkpoints cosigned
+-- before roots were recorded keep an empty root and no proof is required
+-- against them.
+ALTER TABLE tsa.cosigned_checkpoints
+    ADD COLUMN tree_size BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN root_hash VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- Received document exchanges
+-- Migration: 022_document_exchange_ids.sql
+
+-- An exchange is received once per origin agency. A replayed or retried
+-- envelope finds the document it already delivered instead of creating a
+-- second one.
+DROP INDEX documents.idx_documents_exchange_id;
+
+CREATE UNIQUE INDEX idx_documents_exchange_id ON documents.documents(
+    (provenance->>'origin_agency'), (provenance->>'exchange_id')
+) WHERE provenance IS NOT NULL;
@@ -3,6 +3,7 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/time/rate"
@@ -53,6 +54,7 @@ func RateLimiter(requestsPerSecond int, burst int) func(http.Handler) http.Handl
 
 // IPRateLimiter creates per-IP rate limiting
 type IPRateLimiter struct {
+	mu       sync.Mutex
 	limiters map[string]*rate.Limiter
 	rate     rate.Limit
 	burst    int
@@ -69,6 +71,9 @@ func NewIPRateLimiter(rps int, burst int) *IPRateLimiter {
 
 // GetLimiter returns the rate limiter for an IP
 func (i *IPRateLimiter) GetLimiter(ip string) *rate.Limiter {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
 	limiter, exists := i.limiters[ip]
 	if !exists {
 		limiter = rate.NewLimiter(i.rate, i.burst)
@@ -0,0 +1,29 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// LegalHold suspends deletion, voiding and disposition of a record while
+// litigation, an investigation or an inspection is pending
+type LegalHold struct {
+	Reason    string    `json:"reason"`
+	Reference string    `json:"reference,omitempty"` // Court or investigation case number
+	PlacedBy  ID        `json:"placed_by"`
+	PlacedAt  time.Time `json:"placed_at"`
+}
+
+// NewLegalHold creates a legal hold placed now
+func NewLegalHold(reason, reference string, placedBy ID) (*LegalHold, error) {
+	if reason == "" {
+		return nil, fmt.Errorf("legal hold reason is required")
+	}
+
+	return &LegalHold{
+		Reason:    reason,
+		Reference: reference,
+		PlacedBy:  placedBy,
+		PlacedAt:  time.Now(),
+	}, nil
+}
@@ -0,0 +1,749 @@
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// Kinds of archive timestamps in an evidence record (RFC 4998, section 5)
+const (
+	// RenewalInitial is the first timestamp, over the object hash
+	RenewalInitial = "initial"
+
+	// RenewalTimestamp timestamps the previous archive timestamp before the
+	// TSA certificate that signed it expires
+	RenewalTimestamp = "timestamp"
+
+	// RenewalHashTree timestamps the object hash together with every earlier
+	// archive timestamp under a new hash algorithm, before the old one weakens
+	RenewalHashTree = "hash_tree"
+)
+
+// ArchiveTimestamp is one timestamp in the chain of an evidence record
+type ArchiveTimestamp struct {
+	Renewal       string    `json:"renewal"`
+	HashAlgorithm string    `json:"hash_algorithm"`
+	Token         []byte    `json:"token"`
+	GenTime       time.Time `json:"gen_time"`
+	ExpiresAt     time.Time `json:"expires_at"` // of the TSA certificate that signed the token
+}
+
+// EvidenceRecord keeps an object verifiable for longer than the certificates
+// and hash algorithms protecting it last. The first archive timestamp covers
+// the hash of the object; each renewal extends the chain before the previous
+// timestamp loses its strength, so the chain proves the object existed at
+// the time of the first one.
+//
+// Only the object hash is archived. A hash-tree renewal rehashes that hash
+// with the chain, which keeps the chain sound but cannot strengthen the
+// object hash itself; an object whose hash algorithm weakens is enrolled
+// again under a new hash by its owner.
+type EvidenceRecord struct {
+	ID              types.ID           `json:"id"`
+	ObjectType      string             `json:"object_type"`
+	ObjectID        string             `json:"object_id"`
+	ObjectHash      string             `json:"object_hash"` // hex
+	ObjectCreatedAt time.Time          `json:"object_created_at"`
+	Timestamps      []ArchiveTimestamp `json:"timestamps"`
+	CreatedAt       time.Time          `json:"created_at"`
+	RenewedAt       *time.Time         `json:"renewed_at,omitempty"`
+}
+
+// latest returns the newest archive timestamp
+func (r *EvidenceRecord) latest() *ArchiveTimestamp {
+	return &r.Timestamps[len(r.Timestamps)-1]
+}
+
+// renewalHash returns the hash the archive timestamp at index i covers
+func (r *EvidenceRecord) renewalHash(i int, renewal string, h crypto.Hash) ([]byte, error) {
+	objectHash, err := hex.DecodeString(r.ObjectHash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object hash: %w", err)
+	}
+
+	switch renewal {
+	case RenewalInitial:
+		if i != 0 {
+			return nil, fmt.Errorf("initial archive timestamp at position %d", i)
+		}
+		return objectHash, nil
+	case RenewalTimestamp:
+		if i == 0 {
+			return nil, fmt.Errorf("renewal without an initial archive timestamp")
+		}
+		digest := h.New()
+		digest.Write(r.Timestamps[i-1].Token)
+		return digest.Sum(nil), nil
+	case RenewalHashTree:
+		if i == 0 {
+			return nil, fmt.Errorf("renewal without an initial archive timestamp")
+		}
+		digest := h.New()
+		digest.Write(objectHash)
+		for _, ts := range r.Timestamps[:i] {
+			digest.Write(ts.Token)
+		}
+		return digest.Sum(nil), nil
+	default:
+		return nil, fmt.Errorf("unknown renewal %q", renewal)
+	}
+}
+
+// VerifyEvidence verifies the chain of archive timestamps of an evidence
+// record without access to the TSA. Every timestamp must verify against the
+// trust anchors in roots and be made before the certificate of the previous
+// one expired, and the latest must not have expired at now.
+func VerifyEvidence(record *EvidenceRecord, roots *x509.CertPool, now time.Time) *VerifyResult {
+	if len(record.Timestamps) == 0 {
+		return &VerifyResult{Valid: false, Message: "evidence record has no archive timestamps"}
+	}
+
+	var first, previous *VerifyResult
+	for i, ts := range record.Timestamps {
+		h, err := ParseHashAlgorithm(ts.HashAlgorithm)
+		if err != nil {
+			return &VerifyResult{Valid: false, Message: fmt.Sprintf("archive timestamp %d: %v", i, err)}
+		}
+		hash, err := record.renewalHash(i, ts.Renewal, h)
+		if err != nil {
+			return &VerifyResult{Valid: false, Message: fmt.Sprintf("archive timestamp %d: %v", i, err)}
+		}
+
+		result := VerifyToken(ts.Token, hash, roots)
+		if !result.Valid {
+			return &VerifyResult{Valid: false, Message: fmt.Sprintf("archive timestamp %d: %s", i, result.Message)}
+		}
+
+		if previous != nil {
+			if result.Timestamp.Before(previous.Timestamp) {
+				return &VerifyResult{Valid: false, Message: fmt.Sprintf("archive timestamp %d predates the one it renews", i)}
+			}
+			if !result.Timestamp.Before(previous.CertificateExpires) {
+				return &VerifyResult{Valid: false, Message: fmt.Sprintf(
+					"archive timestamp %d was made on %s, after the certificate of the previous one expired on %s",
+					i, result.Timestamp.Format(time.RFC3339), previous.CertificateExpires.Format(time.RFC3339))}
+			}
+		} else {
+			first = result
+		}
+		previous = result
+	}
+
+	if now.After(previous.CertificateExpires) {
+		return &VerifyResult{Valid: false, Message: fmt.Sprintf(
+			"latest archive timestamp expired on %s without renewal", previous.CertificateExpires.Format(time.RFC3339))}
+	}
+
+	return &VerifyResult{
+		Valid:              true,
+		Message:            fmt.Sprintf("timestamp verified with %d archive timestamp renewals", len(record.Timestamps)-1),
+		Timestamp:          first.Timestamp,
+		SerialNumber:       first.SerialNumber,
+		Issuer:             first.Issuer,
+		CertificateExpires: first.CertificateExpires,
+		Renewals:           len(record.Timestamps) - 1,
+		ArchivedUntil:      previous.CertificateExpires,
+	}
+}
+
+// ParseHashAlgorithm returns a hash algorithm accepted by the TSA by name,
+// e.g. "SHA-256"
+func ParseHashAlgorithm(name string) (crypto.Hash, error) {
+	for h := range hashOIDs {
+		if h.String() == name {
+			return h, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported hash algorithm %q", name)
+}
+
+// hashForSize returns the hash algorithm accepted by the TSA with a digest size
+func hashForSize(size int) (crypto.Hash, bool) {
+	for h := range hashOIDs {
+		if h.Size() == size {
+			return h, true
+		}
+	}
+	return 0, false
+}
+
+// ArchiveObject is an object to protect with archive timestamps
+type ArchiveObject struct {
+	ID        string
+	Hash      []byte    // SHA-256 hash of the object, unless Token covers another
+	Token     []byte    // timestamp token of this TSA over Hash; nil to timestamp it on enrollment
+	CreatedAt time.Time // enrollment proceeds in order of creation
+}
+
+// ArchiveSource lists objects of one type to protect with archive timestamps
+type ArchiveSource interface {
+	// ArchiveObjects returns objects created at or after a time, oldest
+	// first, at most limit
+	ArchiveObjects(ctx context.Context, after time.Time, limit int) ([]ArchiveObject, error)
+}
+
+// ArchiveStore keeps evidence records
+type ArchiveStore interface {
+	// Enroll inserts a new evidence record; it reports false if the object
+	// is enrolled already
+	Enroll(ctx context.Context, record *EvidenceRecord) (bool, error)
+
+	// SaveRenewal stores an evidence record with archive timestamps added
+	SaveRenewal(ctx context.Context, record *EvidenceRecord) error
+
+	// GetEvidence returns the evidence record of an object
+	GetEvidence(ctx context.Context, objectType, objectID string) (*EvidenceRecord, error)
+
+	// FindByToken returns the evidence record whose first archive timestamp
+	// is token
+	FindByToken(ctx context.Context, token []byte) (*EvidenceRecord, error)
+
+	// LastEnrolled returns the creation time of the newest enrolled object
+	// of a type, or the zero time
+	LastEnrolled(ctx context.Context, objectType string) (time.Time, error)
+
+	// ListDue returns evidence records whose latest archive timestamp expires
+	// before a time or uses another hash algorithm, soonest expiry first
+	ListDue(ctx context.Context, expiresBefore time.Time, hashAlgorithm string, limit int) ([]*EvidenceRecord, error)
+}
+
+// Archiver enrolls objects from its sources and renews their archive
+// timestamps with the TSA before the TSA certificate expires or the hash
+// algorithm is replaced
+type Archiver struct {
+	server *Server
+	config ArchiveConfig
+
+	mu      sync.Mutex
+	store   ArchiveStore
+	sources map[string]ArchiveSource
+}
+
+// NewArchiver creates an archiver that timestamps with server. The server
+// verifies the tokens it protects against their evidence records from then
+// on. Evidence records are kept in memory until SetStore is called.
+func NewArchiver(server *Server, config *ArchiveConfig) *Archiver {
+	cfg := ArchiveConfig{}
+	if config != nil {
+		cfg = *config
+	}
+	if cfg.RenewBefore <= 0 {
+		cfg.RenewBefore = DefaultArchiveRenewBefore
+	}
+	if cfg.HashAlgorithm == 0 {
+		cfg.HashAlgorithm = crypto.SHA256
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 24 * time.Hour
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+
+	a := &Archiver{
+		server:  server,
+		config:  cfg,
+		sources: make(map[string]ArchiveSource),
+	}
+	a.SetStore(newMemoryArchiveStore())
+	return a
+}
+
+// SetStore sets where evidence records are kept
+func (a *Archiver) SetStore(store ArchiveStore) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.store = store
+	a.server.SetArchiveStore(store)
+}
+
+// AddSource enrolls the objects of a source under an object type
+func (a *Archiver) AddSource(objectType string, source ArchiveSource) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sources[objectType] = source
+}
+
+// GetEvidence returns the evidence record of an object
+func (a *Archiver) GetEvidence(ctx context.Context, objectType, objectID string) (*EvidenceRecord, error) {
+	a.mu.Lock()
+	store := a.store
+	a.mu.Unlock()
+	return store.GetEvidence(ctx, objectType, objectID)
+}
+
+// Start enrolls and renews every Interval until the context is cancelled
+func (a *Archiver) Start(ctx context.Context) {
+	ticker := time.NewTicker(a.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if enrolled, renewed, err := a.Run(ctx); err != nil {
+			fmt.Printf("Warning: archive timestamp run failed: %v\n", err)
+		} else if enrolled > 0 || renewed > 0 {
+			fmt.Printf("Archive timestamps: %d objects enrolled, %d evidence records renewed\n", enrolled, renewed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run enrolls new objects of every source and renews the evidence records
+// that are due. It returns the number of objects enrolled and records renewed.
+func (a *Archiver) Run(ctx context.Context) (int, int, error) {
+	a.mu.Lock()
+	store := a.store
+	sources := make(map[string]ArchiveSource, len(a.sources))
+	for objectType, source := range a.sources {
+		sources[objectType] = source
+	}
+	a.mu.Unlock()
+
+	enrolled := 0
+	for objectType, source := range sources {
+		n, err := a.enroll(ctx, store, objectType, source)
+		enrolled += n
+		if err != nil {
+			return enrolled, 0, fmt.Errorf("failed to enroll %s objects: %w", objectType, err)
+		}
+	}
+
+	renewed, err := a.renew(ctx, store, time.Now())
+	return enrolled, renewed, err
+}
+
+// enroll creates evidence records for the objects of a source created since
+// the newest enrolled one
+func (a *Archiver) enroll(ctx context.Context, store ArchiveStore, objectType string, source ArchiveSource) (int, error) {
+	after, err := store.LastEnrolled(ctx, objectType)
+	if err != nil {
+		return 0, err
+	}
+
+	enrolled := 0
+	for {
+		// Objects created at the cursor are listed again and skipped
+		objects, err := source.ArchiveObjects(ctx, after, a.config.BatchSize)
+		if err != nil {
+			return enrolled, err
+		}
+
+		added := 0
+		for _, obj := range objects {
+			record, err := a.newRecord(ctx, objectType, obj)
+			if err != nil {
+				fmt.Printf("Warning: %s %s not archived: %v\n", objectType, obj.ID, err)
+				continue
+			}
+			ok, err := store.Enroll(ctx, record)
+			if err != nil {
+				return enrolled, err
+			}
+			if ok {
+				added++
+			}
+			after = obj.CreatedAt
+		}
+		enrolled += added
+
+		if len(objects) < a.config.BatchSize || added == 0 {
+			return enrolled, nil
+		}
+	}
+}
+
+// newRecord creates the evidence record of an object with its first archive
+// timestamp: the token of the object, or a new one over its hash
+func (a *Archiver) newRecord(ctx context.Context, objectType string, obj ArchiveObject) (*EvidenceRecord, error) {
+	h, ok := hashForSize(len(obj.Hash))
+	if !ok {
+		return nil, fmt.Errorf("unsupported object hash length %d", len(obj.Hash))
+	}
+
+	var initial ArchiveTimestamp
+	if obj.Token != nil {
+		result, err := a.server.Verify(ctx, obj.Token, obj.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if !result.Valid {
+			return nil, fmt.Errorf("object token is not valid: %s", result.Message)
+		}
+		initial = ArchiveTimestamp{
+			Renewal:       RenewalInitial,
+			HashAlgorithm: h.String(),
+			Token:         obj.Token,
+			GenTime:       result.Timestamp,
+			ExpiresAt:     result.CertificateExpires,
+		}
+	} else {
+		ts, err := a.timestamp(ctx, RenewalInitial, h, obj.Hash)
+		if err != nil {
+			return nil, err
+		}
+		initial = *ts
+	}
+
+	return &EvidenceRecord{
+		ID:              types.NewID(),
+		ObjectType:      objectType,
+		ObjectID:        obj.ID,
+		ObjectHash:      hex.EncodeToString(obj.Hash),
+		ObjectCreatedAt: obj.CreatedAt,
+		Timestamps:      []ArchiveTimestamp{initial},
+		CreatedAt:       time.Now().UTC(),
+	}, nil
+}
+
+// renew adds an archive timestamp to every record that is due
+func (a *Archiver) renew(ctx context.Context, store ArchiveStore, now time.Time) (int, error) {
+	cert := a.server.GetCertificate()
+	if cert == nil {
+		return 0, fmt.Errorf("TSA certificate not configured")
+	}
+	before := now.Add(a.config.RenewBefore)
+	if cert.NotAfter.Before(before) {
+		fmt.Printf("Warning: TSA certificate expires on %s, within the archive renewal window; archive timestamps cannot be renewed beyond it\n",
+			cert.NotAfter.Format(time.RFC3339))
+	}
+
+	hashName := a.config.HashAlgorithm.String()
+	due, err := store.ListDue(ctx, before, hashName, a.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	renewed := 0
+	for _, record := range due {
+		renewal := RenewalTimestamp
+		if record.latest().HashAlgorithm != hashName {
+			renewal = RenewalHashTree
+		} else if !cert.NotAfter.After(record.latest().ExpiresAt) {
+			// A new timestamp would expire no later than the latest one
+			continue
+		}
+
+		hash, err := record.renewalHash(len(record.Timestamps), renewal, a.config.HashAlgorithm)
+		if err != nil {
+			fmt.Printf("Warning: evidence record %s not renewed: %v\n", record.ID, err)
+			continue
+		}
+		ts, err := a.timestamp(ctx, renewal, a.config.HashAlgorithm, hash)
+		if err != nil {
+			return renewed, err
+		}
+
+		record.Timestamps = append(record.Timestamps, *ts)
+		renewedAt := now.UTC()
+		record.RenewedAt = &renewedAt
+		if err := store.SaveRenewal(ctx, record); err != nil {
+			return renewed, err
+		}
+		renewed++
+	}
+	return renewed, nil
+}
+
+// timestamp issues an archive timestamp over a hash
+func (a *Archiver) timestamp(ctx context.Context, renewal string, h crypto.Hash, hash []byte) (*ArchiveTimestamp, error) {
+	expires := a.server.GetCertificate().NotAfter
+	resp, err := a.server.issue(ctx, tokenRequest{
+		hashAlgorithm: h,
+		hashedMessage: hash,
+		certReq:       true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveTimestamp{
+		Renewal:       renewal,
+		HashAlgorithm: h.String(),
+		Token:         resp.Token,
+		GenTime:       resp.Timestamp,
+		ExpiresAt:     expires,
+	}, nil
+}
+
+// tokenHash identifies the first archive timestamp of a record
+func tokenHash(token []byte) string {
+	hash := sha256.Sum256(token)
+	return hex.EncodeToString(hash[:])
+}
+
+// memoryArchiveStore keeps evidence records in memory
+type memoryArchiveStore struct {
+	mu      sync.RWMutex
+	records map[string]*EvidenceRecord // by object type and ID
+}
+
+func newMemoryArchiveStore() *memoryArchiveStore {
+	return &memoryArchiveStore{records: make(map[string]*EvidenceRecord)}
+}
+
+func archiveKey(objectType, objectID string) string {
+	return objectType + "/" + objectID
+}
+
+// copyRecord returns a copy that does not share timestamps with the stored record
+func copyRecord(record *EvidenceRecord) *EvidenceRecord {
+	cp := *record
+	cp.Timestamps = append([]ArchiveTimestamp(nil), record.Timestamps...)
+	return &cp
+}
+
+func (s *memoryArchiveStore) Enroll(ctx context.Context, record *EvidenceRecord) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := archiveKey(record.ObjectType, record.ObjectID)
+	if _, ok := s.records[key]; ok {
+		return false, nil
+	}
+	s.records[key] = copyRecord(record)
+	return true, nil
+}
+
+func (s *memoryArchiveStore) SaveRenewal(ctx context.Context, record *EvidenceRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := archiveKey(record.ObjectType, record.ObjectID)
+	stored, ok := s.records[key]
+	if !ok {
+		return errors.NotFound("evidence record", record.ID.String())
+	}
+	if len(record.Timestamps) < len(stored.Timestamps) {
+		return errors.Conflict("archive timestamps cannot be removed from an evidence record")
+	}
+	for i := range stored.Timestamps {
+		if !bytes.Equal(stored.Timestamps[i].Token, record.Timestamps[i].Token) {
+			return errors.Conflict("archive timestamps cannot be replaced in an evidence record")
+		}
+	}
+	s.records[key] = copyRecord(record)
+	return nil
+}
+
+func (s *memoryArchiveStore) GetEvidence(ctx context.Context, objectType, objectID string) (*EvidenceRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[archiveKey(objectType, objectID)]
+	if !ok {
+		return nil, errors.NotFound("evidence record", archiveKey(objectType, objectID))
+	}
+	return copyRecord(record), nil
+}
+
+func (s *memoryArchiveStore) FindByToken(ctx context.Context, token []byte) (*EvidenceRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, record := range s.records {
+		if bytes.Equal(record.Timestamps[0].Token, token) {
+			return copyRecord(record), nil
+		}
+	}
+	return nil, errors.NotFound("evidence record", tokenHash(token))
+}
+
+func (s *memoryArchiveStore) LastEnrolled(ctx context.Context, objectType string) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var last time.Time
+	for _, record := range s.records {
+		if record.ObjectType == objectType && record.ObjectCreatedAt.After(last) {
+			last = record.ObjectCreatedAt
+		}
+	}
+	return last, nil
+}
+
+func (s *memoryArchiveStore) ListDue(ctx context.Context, expiresBefore time.Time, hashAlgorithm string, limit int) ([]*EvidenceRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var due []*EvidenceRecord
+	for _, record := range s.records {
+		latest := record.latest()
+		if latest.ExpiresAt.Before(expiresBefore) || latest.HashAlgorithm != hashAlgorithm {
+			due = append(due, copyRecord(record))
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].latest().ExpiresAt.Before(due[j].latest().ExpiresAt)
+	})
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// PostgresArchiveStore keeps evidence records in PostgreSQL
+type PostgresArchiveStore struct {
+	pool *pgxpool.Pool
+}
+
+var _ ArchiveStore = (*PostgresArchiveStore)(nil)
+
+// NewPostgresArchiveStore creates a new PostgreSQL archive store
+func NewPostgresArchiveStore(pool *pgxpool.Pool) *PostgresArchiveStore {
+	return &PostgresArchiveStore{pool: pool}
+}
+
+// Enroll inserts a new evidence record
+func (s *PostgresArchiveStore) Enroll(ctx context.Context, record *EvidenceRecord) (bool, error) {
+	timestamps, err := json.Marshal(record.Timestamps)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to encode archive timestamps")
+	}
+	latest := record.latest()
+
+	tag, err := s.pool.Exec(ctx, `
+		INSERT INTO tsa.evidence_records (id, object_type, object_id, object_hash, object_created_at,
+			initial_token_hash, timestamps, hash_algorithm, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (object_type, object_id) DO NOTHING`,
+		record.ID, record.ObjectType, record.ObjectID, record.ObjectHash, record.ObjectCreatedAt,
+		tokenHash(record.Timestamps[0].Token), timestamps, latest.HashAlgorithm, latest.ExpiresAt, record.CreatedAt,
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to enroll evidence record")
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// SaveRenewal stores an evidence record with archive timestamps added; the
+// database refuses changes to earlier timestamps
+func (s *PostgresArchiveStore) SaveRenewal(ctx context.Context, record *EvidenceRecord) error {
+	timestamps, err := json.Marshal(record.Timestamps)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode archive timestamps")
+	}
+	latest := record.latest()
+
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE tsa.evidence_records
+		SET timestamps = $2, hash_algorithm = $3, expires_at = $4, renewed_at = $5
+		WHERE id = $1`,
+		record.ID, timestamps, latest.HashAlgorithm, latest.ExpiresAt, record.RenewedAt,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to save evidence record")
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.NotFound("evidence record", record.ID.String())
+	}
+	return nil
+}
+
+const evidenceColumns = `id, object_type, object_id, object_hash, object_created_at,
+			timestamps, created_at, renewed_at`
+
+// GetEvidence returns the evidence record of an object
+func (s *PostgresArchiveStore) GetEvidence(ctx context.Context, objectType, objectID string) (*EvidenceRecord, error) {
+	row := s.pool.QueryRow(ctx, `
+		SELECT `+evidenceColumns+`
+		FROM tsa.evidence_records
+		WHERE object_type = $1 AND object_id = $2`, objectType, objectID)
+
+	record, err := scanEvidence(row)
+	if err == pgx.ErrNoRows {
+		return nil, errors.NotFound("evidence record", archiveKey(objectType, objectID))
+	}
+	return record, err
+}
+
+// FindByToken returns the evidence record whose first archive timestamp is token
+func (s *PostgresArchiveStore) FindByToken(ctx context.Context, token []byte) (*EvidenceRecord, error) {
+	row := s.pool.QueryRow(ctx, `
+		SELECT `+evidenceColumns+`
+		FROM tsa.evidence_records
+		WHERE initial_token_hash = $1
+		LIMIT 1`, tokenHash(token))
+
+	record, err := scanEvidence(row)
+	if err == pgx.ErrNoRows {
+		return nil, errors.NotFound("evidence record", tokenHash(token))
+	}
+	return record, err
+}
+
+// LastEnrolled returns the creation time of the newest enrolled object of a type
+func (s *PostgresArchiveStore) LastEnrolled(ctx context.Context, objectType string) (time.Time, error) {
+	var last *time.Time
+	err := s.pool.QueryRow(ctx, `
+		SELECT MAX(object_created_at) FROM tsa.evidence_records WHERE object_type = $1`,
+		objectType).Scan(&last)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to read archive enrollment")
+	}
+	if last == nil {
+		return time.Time{}, nil
+	}
+	return *last, nil
+}
+
+// ListDue returns evidence records due for renewal, soonest expiry first
+func (s *PostgresArchiveStore) ListDue(ctx context.Context, expiresBefore time.Time, hashAlgorithm string, limit int) ([]*EvidenceRecord, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+evidenceColumns+`
+		FROM tsa.evidence_records
+		WHERE expires_at < $1 OR hash_algorithm <> $2
+		ORDER BY expires_at
+		LIMIT $3`, expiresBefore, hashAlgorithm, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list evidence records")
+	}
+	defer rows.Close()
+
+	var records []*EvidenceRecord
+	for rows.Next() {
+		record, err := scanEvidence(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func scanEvidence(row pgx.Row) (*EvidenceRecord, error) {
+	var r EvidenceRecord
+	var timestamps []byte
+
+	err := row.Scan(&r.ID, &r.ObjectType, &r.ObjectID, &r.ObjectHash, &r.ObjectCreatedAt,
+		&timestamps, &r.CreatedAt, &r.RenewedAt)
+	if err == pgx.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scan evidence record")
+	}
+	if err := json.Unmarshal(timestamps, &r.Timestamps); err != nil {
+		return nil, errors.Wrap(err, "failed to decode archive timestamps")
+	}
+	if len(r.Timestamps) == 0 {
+		return nil, errors.Internal(fmt.Errorf("evidence record %s has no archive timestamps", r.ID))
+	}
+	return &r, nil
+}
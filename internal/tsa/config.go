@@ -6,6 +6,7 @@ package tsa
 import (
 	"crypto"
 	"crypto/x509"
+	"time"
 )
 
 // Config holds TSA server configuration.
@@ -58,8 +59,41 @@ type MultiAgencyConfig struct {
 
 	// Agencies is the list of participating agencies
 	Agencies []AgencyWitnessConfig
+
+	// Deadline is how long signatures are collected for a proof; late
+	// signatures are accepted until then (default: DefaultWitnessDeadline)
+	Deadline time.Duration
+
+	// RetryDelay is the first delay before asking an agency that has not
+	// signed again; it doubles up to an hour (default: one minute)
+	RetryDelay time.Duration
+}
+
+// DefaultWitnessDeadline is the default time to reach quorum on a proof
+const DefaultWitnessDeadline = 24 * time.Hour
+
+// ArchiveConfig holds configuration for archive timestamp renewal.
+type ArchiveConfig struct {
+	// RenewBefore is how long before a TSA certificate expires the archive
+	// timestamps it signed are renewed (default: DefaultArchiveRenewBefore)
+	RenewBefore time.Duration
+
+	// HashAlgorithm for new archive timestamps; records whose latest archive
+	// timestamp uses another algorithm get a hash-tree renewal (default: SHA-256)
+	HashAlgorithm crypto.Hash
+
+	// Interval between enrollment and renewal runs (default: 24 hours)
+	Interval time.Duration
+
+	// BatchSize bounds the objects enrolled per request to a source and the
+	// records renewed per run (default: 1000)
+	BatchSize int
 }
 
+// DefaultArchiveRenewBefore is the default renewal window before a TSA
+// certificate expires
+const DefaultArchiveRenewBefore = 90 * 24 * time.Hour
+
 // AgencyWitnessConfig holds configuration for a single agency witness.
 type AgencyWitnessConfig struct {
 	// AgencyCode is the unique agency identifier
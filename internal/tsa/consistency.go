@@ -0,0 +1,114 @@
+package tsa
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// RFC 6962 consistency proof verification, used by the witness to check that
+// a requesting agency's Merkle tree only grew since the tree it cosigned
+// last. The audit log builds the trees and proofs (audit.MerkleTree); the
+// check is repeated here because tsa cannot import audit.
+
+const nodeHashPrefix = 0x01
+
+// hashChildren computes the RFC 6962 hash of an interior node: SHA-256(0x01 || left || right)
+func hashChildren(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodeHashPrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// decodeHash decodes a hex-encoded SHA-256 hash
+func decodeHash(s string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != sha256.Size {
+		return nil, fmt.Errorf("invalid hash %q", s)
+	}
+	return b, nil
+}
+
+// verifyConsistency checks that the tree of newSize with newRoot extends the
+// tree of oldSize with oldRoot (RFC 9162 section 2.1.4.2). Roots and proof
+// hashes are hex-encoded.
+func verifyConsistency(oldSize, newSize int64, oldRoot, newRoot string, proof []string) error {
+	if oldSize < 1 || oldSize > newSize {
+		return fmt.Errorf("invalid tree sizes %d and %d", oldSize, newSize)
+	}
+	oldHash, err := decodeHash(oldRoot)
+	if err != nil {
+		return err
+	}
+	newHash, err := decodeHash(newRoot)
+	if err != nil {
+		return err
+	}
+	path := make([][]byte, 0, len(proof)+1)
+	for _, p := range proof {
+		h, err := decodeHash(p)
+		if err != nil {
+			return err
+		}
+		path = append(path, h)
+	}
+
+	if oldSize == newSize {
+		if len(path) != 0 {
+			return fmt.Errorf("consistency proof for equal trees must be empty")
+		}
+		if !bytes.Equal(oldHash, newHash) {
+			return fmt.Errorf("roots of equal-sized trees differ")
+		}
+		return nil
+	}
+	if len(path) == 0 {
+		return fmt.Errorf("consistency proof is empty")
+	}
+
+	// If the old tree is a complete subtree its root is the first node of the path
+	if oldSize&(oldSize-1) == 0 {
+		path = append([][]byte{oldHash}, path...)
+	}
+
+	fn, sn := oldSize-1, newSize-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	fr, sr := path[0], path[0]
+	for _, c := range path[1:] {
+		if sn == 0 {
+			return fmt.Errorf("consistency proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = hashChildren(c, fr)
+			sr = hashChildren(c, sr)
+			if fn&1 == 0 {
+				for fn&1 == 0 && fn != 0 {
+					fn >>= 1
+					sn >>= 1
+				}
+			}
+		} else {
+			sr = hashChildren(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 {
+		return fmt.Errorf("consistency proof is too short")
+	}
+	if !bytes.Equal(fr, oldHash) {
+		return fmt.Errorf("consistency proof does not match old root")
+	}
+	if !bytes.Equal(sr, newHash) {
+		return fmt.Errorf("consistency proof does not match new root")
+	}
+	return nil
+}
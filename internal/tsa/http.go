@@ -0,0 +1,216 @@
+package tsa
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/serbia-gov/platform/internal/shared/auth"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+)
+
+// maxQuerySize bounds the body of a timestamp query
+const maxQuerySize = 16 << 10
+
+// ProtocolHandler serves the RFC 3161 HTTP protocol (section 3.4)
+type ProtocolHandler struct {
+	server *Server
+}
+
+// NewProtocolHandler creates a new RFC 3161 protocol handler
+func NewProtocolHandler(server *Server) *ProtocolHandler {
+	return &ProtocolHandler{server: server}
+}
+
+// Routes registers the protocol routes
+func (h *ProtocolHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Post("/", h.Timestamp)
+	r.Get("/certificate", h.Certificate)
+
+	return r
+}
+
+// Timestamp answers an application/timestamp-query with an application/timestamp-reply
+func (h *ProtocolHandler) Timestamp(w http.ResponseWriter, r *http.Request) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/timestamp-query" {
+		http.Error(w, "expected application/timestamp-query", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	query, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxQuerySize))
+	if err != nil {
+		http.Error(w, "timestamp query too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	reply, err := h.server.HandleRequest(r.Context(), query, r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "failed to create timestamp reply", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.Header().Set("Content-Length", strconv.Itoa(len(reply)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(reply)
+}
+
+// Certificate returns the TSA certificate chain as PEM, for use as trust anchors
+func (h *ProtocolHandler) Certificate(w http.ResponseWriter, r *http.Request) {
+	chain := h.server.GetCertificateChain()
+	if len(chain) == 0 {
+		http.Error(w, "TSA certificate not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	for _, cert := range chain {
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+}
+
+// Handler serves the log of issued tokens to administrators
+type Handler struct {
+	store    TokenStore
+	archiver *Archiver
+	server   *Server
+	devMode  bool
+}
+
+// NewHandler creates a new token log handler
+func NewHandler(store TokenStore) *Handler {
+	env := os.Getenv("ENV")
+	return &Handler{
+		store:   store,
+		devMode: env == "" || env == "development" || env == "dev",
+	}
+}
+
+// Routes registers the token log routes
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/tokens", h.FindTokens)
+	r.Get("/tokens/{serial}", h.GetToken)
+	r.Get("/evidence/{objectType}/{objectID}", h.GetEvidence)
+
+	return r
+}
+
+// SetArchiver serves the evidence records of an archiver, verified by server
+func (h *Handler) SetArchiver(archiver *Archiver, server *Server) {
+	h.archiver = archiver
+	h.server = server
+}
+
+// GetEvidence returns the evidence record of an object with the result of
+// verifying its chain of archive timestamps
+func (h *Handler) GetEvidence(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	if h.archiver == nil {
+		writeError(w, errors.NotFound("evidence record", chi.URLParam(r, "objectID")))
+		return
+	}
+
+	record, err := h.archiver.GetEvidence(r.Context(), chi.URLParam(r, "objectType"), chi.URLParam(r, "objectID"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"evidence":     record,
+		"verification": h.server.VerifyEvidence(record),
+	})
+}
+
+// GetToken returns an issued token by serial number
+func (h *Handler) GetToken(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	serial, err := strconv.ParseUint(chi.URLParam(r, "serial"), 10, 64)
+	if err != nil {
+		writeError(w, errors.BadRequest("invalid serial number"))
+		return
+	}
+
+	token, err := h.store.GetToken(r.Context(), serial)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, token)
+}
+
+// FindTokens returns the tokens issued for a hex-encoded hash
+func (h *Handler) FindTokens(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	hash, err := hex.DecodeString(r.URL.Query().Get("hash"))
+	if err != nil || len(hash) == 0 {
+		writeError(w, errors.BadRequest("hash must be hex-encoded"))
+		return
+	}
+
+	// Hashes are logged in lower case
+	tokens, err := h.store.FindTokens(r.Context(), hex.EncodeToString(hash))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data":  tokens,
+		"total": len(tokens),
+	})
+}
+
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if h.devMode {
+		return true
+	}
+	user := auth.GetUser(r.Context())
+	if user == nil || !user.IsAdmin() {
+		writeError(w, errors.Forbidden("admin access required"))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if appErr, ok := err.(*errors.AppError); ok {
+		w.WriteHeader(appErr.HTTPStatus)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error":   appErr.Message,
+			"code":    appErr.Code,
+			"details": appErr.Details,
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]string{"error": "internal server error"})
+}
@@ -6,19 +6,25 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math/big"
 	"net/http"
 	"sort"
 	"sync"
 	"time"
 
+	"github.com/serbia-gov/platform/internal/federation/gateway"
+	"github.com/serbia-gov/platform/internal/shared/errors"
 	"github.com/serbia-gov/platform/internal/shared/types"
 )
 
@@ -29,7 +35,15 @@ type MultiAgencyWitness struct {
 	config       *MultiAgencyConfig
 	localAgency  *LocalAgency
 	httpClient   *http.Client
+	gateway      *gateway.Gateway // optional, carries requests to other agencies
+	prover       ConsistencyProver // proves our tree extends the one a witness cosigned
 	mu           sync.RWMutex
+
+	history  WitnessHistory // checkpoints cosigned for other agencies
+	cosignMu sync.Mutex
+
+	proofs  ProofStore // proofs of our checkpoints, completed in the background
+	proofMu sync.Mutex
 }
 
 // LocalAgency represents this server's agency identity for signing.
@@ -40,13 +54,20 @@ type LocalAgency struct {
 	Certificate *x509.Certificate
 }
 
-// WitnessRequest is sent to other agencies for co-signing.
+// WitnessRequest is sent to other agencies for co-signing. TreeSize and
+// RootHash identify the Merkle tree the checkpoint commits to; a witness that
+// cosigned an earlier tree for the agency requires ConsistencyProof, the
+// RFC 6962 proof that this tree extends the tree of size ProofFrom.
 type WitnessRequest struct {
-	CheckpointHash string    `json:"checkpoint_hash"`
-	LastSequence   int64     `json:"last_sequence"`
-	EntryCount     int       `json:"entry_count"`
-	Timestamp      time.Time `json:"timestamp"`
-	RequestingAgency string  `json:"requesting_agency"`
+	CheckpointHash   string    `json:"checkpoint_hash"`
+	LastSequence     int64     `json:"last_sequence"`
+	EntryCount       int       `json:"entry_count"`
+	TreeSize         int64     `json:"tree_size,omitempty"`
+	RootHash         string    `json:"root_hash,omitempty"`
+	Timestamp        time.Time `json:"timestamp"`
+	RequestingAgency string    `json:"requesting_agency"`
+	ProofFrom        int64     `json:"proof_from,omitempty"`
+	ConsistencyProof []string  `json:"consistency_proof,omitempty"` // hex-encoded hashes
 }
 
 // AgencySignature represents a single agency's signature.
@@ -62,12 +83,25 @@ type AgencySignature struct {
 type MultiAgencyProof struct {
 	ID             types.ID          `json:"id"`
 	CheckpointHash string            `json:"checkpoint_hash"`
+	LastSequence   int64             `json:"last_sequence"`
+	EntryCount     int               `json:"entry_count"`
+	TreeSize       int64             `json:"tree_size,omitempty"`
+	RootHash       string            `json:"root_hash,omitempty"`
 	Signatures     []AgencySignature `json:"signatures"`
 	MinRequired    int               `json:"min_required"`
 	CreatedAt      time.Time         `json:"created_at"`
+	Deadline       time.Time         `json:"deadline,omitempty"` // signatures are collected until then
+	ConfirmedAt    *time.Time        `json:"confirmed_at,omitempty"`
 	Status         string            `json:"status"` // pending, confirmed, failed
 }
 
+// Proof statuses
+const (
+	ProofStatusPending   = "pending"   // collecting signatures
+	ProofStatusConfirmed = "confirmed" // MinRequired agencies signed
+	ProofStatusFailed    = "failed"    // the deadline passed without quorum
+)
+
 // NewMultiAgencyWitness creates a new multi-agency witness system.
 func NewMultiAgencyWitness(config *MultiAgencyConfig, localAgency *LocalAgency) (*MultiAgencyWitness, error) {
 	if config == nil {
@@ -80,6 +114,12 @@ func NewMultiAgencyWitness(config *MultiAgencyConfig, localAgency *LocalAgency)
 		return nil, fmt.Errorf("min_signatures (%d) exceeds available agencies (%d)",
 			config.MinSignatures, len(config.Agencies)+1)
 	}
+	if config.Deadline <= 0 {
+		config.Deadline = DefaultWitnessDeadline
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = time.Minute
+	}
 
 	return &MultiAgencyWitness{
 		config:      config,
@@ -87,15 +127,67 @@ func NewMultiAgencyWitness(config *MultiAgencyConfig, localAgency *LocalAgency)
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		history: newMemoryWitnessHistory(),
+		proofs:  newMemoryProofStore(),
 	}, nil
 }
 
-// CreateProof creates a multi-agency proof by collecting signatures from participating agencies.
-func (w *MultiAgencyWitness) CreateProof(ctx context.Context, checkpointHash string, lastSequence int64, entryCount int) (*MultiAgencyProof, error) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
+// NewLocalAgencyWithGeneratedCert creates a local agency identity with an
+// ECDSA key and a self-signed certificate. This is useful for development;
+// in production the agency key and certificate come from the PKI.
+func NewLocalAgencyWithGeneratedCert(agencyCode, agencyName string) (*LocalAgency, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ECDSA key: %w", err)
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization:       []string{agencyName},
+			OrganizationalUnit: []string{"Audit Witness"},
+			Country:            []string{"RS"},
+			CommonName:         fmt.Sprintf("%s Witness", agencyCode),
+		},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return &LocalAgency{
+		AgencyCode:  agencyCode,
+		AgencyName:  agencyName,
+		PrivateKey:  privateKey,
+		Certificate: cert,
+	}, nil
+}
 
-	if !w.config.Enabled {
+// CreateProof creates a multi-agency proof for a checkpoint that commits to
+// the Merkle tree of treeSize entries with rootHash. It signs
+// locally and returns at once; signatures of the other agencies are collected
+// in the background until the deadline, and the proof is confirmed as soon
+// as MinSignatures is reached. Use GetProof for its current state.
+func (w *MultiAgencyWitness) CreateProof(ctx context.Context, checkpointHash string, lastSequence int64, entryCount int, treeSize int64, rootHash string) (*MultiAgencyProof, error) {
+	w.mu.RLock()
+	enabled := w.config.Enabled
+	w.mu.RUnlock()
+	if !enabled {
 		return nil, fmt.Errorf("multi-agency witness is not enabled")
 	}
 
@@ -103,20 +195,19 @@ func (w *MultiAgencyWitness) CreateProof(ctx context.Context, checkpointHash str
 	proof := &MultiAgencyProof{
 		ID:             types.NewID(),
 		CheckpointHash: checkpointHash,
+		LastSequence:   lastSequence,
+		EntryCount:     entryCount,
+		TreeSize:       treeSize,
+		RootHash:       rootHash,
 		Signatures:     make([]AgencySignature, 0),
 		MinRequired:    w.config.MinSignatures,
 		CreatedAt:      now,
-		Status:         "pending",
+		Deadline:       now.Add(w.config.Deadline),
+		Status:         ProofStatusPending,
 	}
 
 	// Create the witness request
-	request := &WitnessRequest{
-		CheckpointHash:   checkpointHash,
-		LastSequence:     lastSequence,
-		EntryCount:       entryCount,
-		Timestamp:        now,
-		RequestingAgency: w.localAgency.AgencyCode,
-	}
+	request := w.proofRequest(proof)
 
 	// Sign locally first
 	localSig, err := w.signLocally(request)
@@ -124,49 +215,14 @@ func (w *MultiAgencyWitness) CreateProof(ctx context.Context, checkpointHash str
 		return nil, fmt.Errorf("failed to sign locally: %w", err)
 	}
 	proof.Signatures = append(proof.Signatures, *localSig)
+	proof.checkQuorum(now)
 
-	// Collect signatures from other agencies concurrently
-	var wg sync.WaitGroup
-	sigChan := make(chan *AgencySignature, len(w.config.Agencies))
-	errChan := make(chan error, len(w.config.Agencies))
-
-	for _, agency := range w.config.Agencies {
-		wg.Add(1)
-		go func(ag AgencyWitnessConfig) {
-			defer wg.Done()
-			sig, err := w.requestSignature(ctx, &ag, request)
-			if err != nil {
-				errChan <- fmt.Errorf("agency %s: %w", ag.AgencyCode, err)
-				return
-			}
-			sigChan <- sig
-		}(agency)
-	}
-
-	// Wait for all requests to complete
-	wg.Wait()
-	close(sigChan)
-	close(errChan)
-
-	// Collect successful signatures
-	for sig := range sigChan {
-		proof.Signatures = append(proof.Signatures, *sig)
+	if err := w.proofs.SaveProof(ctx, proof); err != nil {
+		return nil, fmt.Errorf("failed to save proof: %w", err)
 	}
 
-	// Check if we have enough signatures
-	if len(proof.Signatures) >= w.config.MinSignatures {
-		proof.Status = "confirmed"
-	} else {
-		proof.Status = "failed"
-		// Collect errors for debugging
-		var errs []error
-		for err := range errChan {
-			errs = append(errs, err)
-		}
-		if len(errs) > 0 {
-			return proof, fmt.Errorf("insufficient signatures: got %d, need %d. Errors: %v",
-				len(proof.Signatures), w.config.MinSignatures, errs)
-		}
+	if len(w.config.Agencies) > 0 {
+		go w.collect(proof.ID, request, proof.Deadline)
 	}
 
 	return proof, nil
@@ -203,45 +259,85 @@ func (w *MultiAgencyWitness) signLocally(request *WitnessRequest) (*AgencySignat
 	}, nil
 }
 
-// requestSignature requests a signature from a remote agency.
+// requestSignature requests a signature from a remote agency. A witness
+// that cosigned an earlier tree for us answers 428 with the size of that
+// tree, and the request is sent again with a consistency proof from it.
 func (w *MultiAgencyWitness) requestSignature(ctx context.Context, agency *AgencyWitnessConfig, request *WitnessRequest) (*AgencySignature, error) {
+	status, body, err := w.sendSignRequest(ctx, agency, request)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusPreconditionRequired {
+		var required witnessErrorResponse
+		if err := json.Unmarshal(body, &required); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		proved, err := w.withConsistencyProof(ctx, request, required.TreeSize)
+		if err != nil {
+			return nil, err
+		}
+		if status, body, err = w.sendSignRequest(ctx, agency, proved); err != nil {
+			return nil, err
+		}
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("agency returned status %d: %s", status, body)
+	}
+
+	var sig AgencySignature
+	if err := json.Unmarshal(body, &sig); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	// Verify the signature
+	if err := w.verifySignature(&sig, request, agency); err != nil {
+		return nil, fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	return &sig, nil
+}
+
+// sendSignRequest sends a witness request and returns the response status and body
+func (w *MultiAgencyWitness) sendSignRequest(ctx context.Context, agency *AgencyWitnessConfig, request *WitnessRequest) (int, []byte, error) {
 	// Marshal request
 	body, err := json.Marshal(request)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return 0, nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	w.mu.RLock()
+	gw := w.gateway
+	w.mu.RUnlock()
+
+	if gw != nil {
+		// Signed by the gateway, so the witness knows who is asking
+		resp, err := gw.SendRequest(ctx, agency.AgencyCode, http.MethodPost, WitnessServicePath, body)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to send request: %w", err)
+		}
+		return resp.StatusCode, resp.Body, nil
 	}
 
 	// Create HTTP request
-	url := fmt.Sprintf("%s/api/v1/witness/sign", agency.EndpointURL)
+	url := agency.EndpointURL + WitnessServicePath
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return 0, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	// Send request
 	resp, err := w.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return 0, nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("agency returned status %d", resp.StatusCode)
-	}
-
-	// Parse response
-	var sig AgencySignature
-	if err := json.NewDecoder(resp.Body).Decode(&sig); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	// Verify the signature
-	if err := w.verifySignature(&sig, request, agency); err != nil {
-		return nil, fmt.Errorf("signature verification failed: %w", err)
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxWitnessResponseSize))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read response: %w", err)
 	}
-
-	return &sig, nil
+	return resp.StatusCode, respBody, nil
 }
 
 // VerifyProof verifies that a multi-agency proof is valid.
@@ -255,10 +351,7 @@ func (w *MultiAgencyWitness) VerifyProof(ctx context.Context, proof *MultiAgency
 	}
 
 	// Create witness request from proof for verification
-	request := &WitnessRequest{
-		CheckpointHash: proof.CheckpointHash,
-		Timestamp:      proof.CreatedAt,
-	}
+	request := signedRequest(proof)
 
 	// Verify each signature
 	for _, sig := range proof.Signatures {
@@ -340,8 +433,13 @@ func (w *MultiAgencyWitness) verifySignature(sig *AgencySignature, request *Witn
 		return fmt.Errorf("no certificate available for verification")
 	}
 
-	// Create the data that was signed
-	dataToSign := w.createSignatureData(request)
+	return verifySignatureWithCertificate(cert, sigBytes, w.createSignatureData(request))
+}
+
+// verifySignatureWithCertificate verifies a signature over the canonical
+// witness data with the public key of cert.
+func verifySignatureWithCertificate(cert *x509.Certificate, sigBytes, dataToSign []byte) error {
+	var err error
 	hash := sha256.Sum256(dataToSign)
 
 	// Verify based on key type
@@ -365,6 +463,22 @@ func (w *MultiAgencyWitness) verifySignature(sig *AgencySignature, request *Witn
 
 // createSignatureData creates the canonical data to be signed.
 func (w *MultiAgencyWitness) createSignatureData(request *WitnessRequest) []byte {
+	return signatureData(request)
+}
+
+// signedRequest returns the request the agencies signed for a proof
+func signedRequest(proof *MultiAgencyProof) *WitnessRequest {
+	return &WitnessRequest{
+		CheckpointHash: proof.CheckpointHash,
+		LastSequence:   proof.LastSequence,
+		EntryCount:     proof.EntryCount,
+		TreeSize:       proof.TreeSize,
+		RootHash:       proof.RootHash,
+		Timestamp:      proof.CreatedAt,
+	}
+}
+
+func signatureData(request *WitnessRequest) []byte {
 	// Create deterministic JSON
 	data := map[string]interface{}{
 		"checkpoint_hash": request.CheckpointHash,
@@ -372,6 +486,11 @@ func (w *MultiAgencyWitness) createSignatureData(request *WitnessRequest) []byte
 		"entry_count":     request.EntryCount,
 		"timestamp":       request.Timestamp.UTC().Format(time.RFC3339Nano),
 	}
+	// Proofs created before tree roots were witnessed sign without them
+	if request.RootHash != "" {
+		data["tree_size"] = request.TreeSize
+		data["root_hash"] = request.RootHash
+	}
 
 	// Sort keys for deterministic output
 	keys := make([]string, 0, len(data))
@@ -394,17 +513,86 @@ func (w *MultiAgencyWitness) createSignatureData(request *WitnessRequest) []byte
 	return buf.Bytes()
 }
 
-// HandleSignRequest handles incoming witness sign requests from other agencies.
-// This should be exposed as an HTTP endpoint.
-func (w *MultiAgencyWitness) HandleSignRequest(ctx context.Context, request *WitnessRequest) (*AgencySignature, error) {
-	// Validate request
-	if request.CheckpointHash == "" {
-		return nil, fmt.Errorf("checkpoint_hash is required")
+// VerifyProofWithRoots verifies a multi-agency proof without a configured
+// witness. Each signature must carry a certificate that chains to roots at
+// the time it was signed; an agency counts once however often it signed.
+func VerifyProofWithRoots(proof *MultiAgencyProof, roots *x509.CertPool) *VerifyProofResult {
+	result := &VerifyProofResult{
+		TotalSignatures: len(proof.Signatures),
+		Details:         make([]SignatureVerifyDetail, 0, len(proof.Signatures)),
+	}
+
+	data := signatureData(signedRequest(proof))
+
+	counted := make(map[string]bool)
+	for _, sig := range proof.Signatures {
+		detail := SignatureVerifyDetail{
+			AgencyCode: sig.AgencyCode,
+			AgencyName: sig.AgencyName,
+			SignedAt:   sig.SignedAt,
+		}
+
+		if err := verifyAnchoredSignature(&sig, data, roots); err != nil {
+			detail.Error = err.Error()
+			result.InvalidSignatures++
+		} else {
+			detail.Valid = true
+			result.ValidSignatures++
+			counted[sig.AgencyCode] = true
+		}
+
+		result.Details = append(result.Details, detail)
+	}
+
+	result.Valid = proof.MinRequired > 0 && len(counted) >= proof.MinRequired
+	if !result.Valid {
+		result.Message = fmt.Sprintf("insufficient valid signatures: got %d agencies, need %d",
+			len(counted), proof.MinRequired)
+	} else {
+		result.Message = fmt.Sprintf("proof verified with %d/%d valid signatures",
+			result.ValidSignatures, result.TotalSignatures)
+	}
+
+	return result
+}
+
+// verifyAnchoredSignature verifies one signature with its embedded
+// certificate after checking that the certificate chains to roots.
+func verifyAnchoredSignature(sig *AgencySignature, data []byte, roots *x509.CertPool) error {
+	if sig.Certificate == "" {
+		return fmt.Errorf("signature carries no certificate")
+	}
+	certDER, err := base64.StdEncoding.DecodeString(sig.Certificate)
+	if err != nil {
+		return fmt.Errorf("failed to decode certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	if roots == nil {
+		return fmt.Errorf("no trust anchors")
 	}
-	if request.RequestingAgency == "" {
-		return nil, fmt.Errorf("requesting_agency is required")
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:       roots,
+		CurrentTime: sig.SignedAt,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("certificate not trusted: %w", err)
 	}
 
+	sigBytes, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+	return verifySignatureWithCertificate(cert, sigBytes, data)
+}
+
+// HandleSignRequest handles incoming witness sign requests from other agencies.
+// Over federation the gateway verifies the requesting agency instead; see
+// ReceiveSignRequest. Checkpoints that fork from or regress behind those
+// cosigned before for the same agency are refused.
+func (w *MultiAgencyWitness) HandleSignRequest(ctx context.Context, request *WitnessRequest) (*AgencySignature, error) {
 	// Verify the requesting agency is known
 	known := false
 	for _, ag := range w.config.Agencies {
@@ -414,11 +602,10 @@ func (w *MultiAgencyWitness) HandleSignRequest(ctx context.Context, request *Wit
 		}
 	}
 	if !known {
-		return nil, fmt.Errorf("unknown requesting agency: %s", request.RequestingAgency)
+		return nil, errors.Forbidden(fmt.Sprintf("unknown requesting agency: %s", request.RequestingAgency))
 	}
 
-	// Sign the request
-	return w.signLocally(request)
+	return w.cosign(ctx, request)
 }
 
 // Serialize serializes the proof for storage.
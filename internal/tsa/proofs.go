@@ -0,0 +1,319 @@
+package tsa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"github.com/serbia-gov/platform/internal/shared/types"
+)
+
+// maxRetryDelay bounds the delay between requests to an agency that has not
+// signed yet
+const maxRetryDelay = time.Hour
+
+// ProofStore keeps multi-agency proofs while their signatures are collected
+type ProofStore interface {
+	// SaveProof inserts a proof or replaces it with a newer state
+	SaveProof(ctx context.Context, proof *MultiAgencyProof) error
+
+	// GetProof returns a proof by ID
+	GetProof(ctx context.Context, id types.ID) (*MultiAgencyProof, error)
+
+	// ListProofs returns proofs with a status, newest first; limit 0 returns all
+	ListProofs(ctx context.Context, status string, limit int) ([]*MultiAgencyProof, error)
+}
+
+// SetProofStore sets where proofs are kept while signatures are collected.
+// Without it they are kept in memory and collection stops on restart.
+func (w *MultiAgencyWitness) SetProofStore(store ProofStore) {
+	w.proofMu.Lock()
+	defer w.proofMu.Unlock()
+	w.proofs = store
+}
+
+// GetProof returns the current state of a proof created by CreateProof
+func (w *MultiAgencyWitness) GetProof(ctx context.Context, id types.ID) (*MultiAgencyProof, error) {
+	return w.proofs.GetProof(ctx, id)
+}
+
+// Resume continues collecting signatures for pending proofs, after a
+// restart, and fails those whose deadline has passed. It returns the number
+// of proofs still collecting.
+func (w *MultiAgencyWitness) Resume(ctx context.Context) (int, error) {
+	pending, err := w.proofs.ListProofs(ctx, ProofStatusPending, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	resumed := 0
+	now := time.Now()
+	for _, proof := range pending {
+		if !now.Before(proof.Deadline) {
+			w.finish(ctx, proof.ID)
+			continue
+		}
+		go w.collect(proof.ID, w.proofRequest(proof), proof.Deadline)
+		resumed++
+	}
+	return resumed, nil
+}
+
+// proofRequest rebuilds the request every agency signs for a proof
+func (w *MultiAgencyWitness) proofRequest(proof *MultiAgencyProof) *WitnessRequest {
+	request := signedRequest(proof)
+	if w.localAgency != nil {
+		request.RequestingAgency = w.localAgency.AgencyCode
+	}
+	return request
+}
+
+// collect asks every agency that has not signed a proof yet until it signs
+// or the deadline passes, then fails the proof if quorum was not reached
+func (w *MultiAgencyWitness) collect(id types.ID, request *WitnessRequest, deadline time.Time) {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	proof, err := w.proofs.GetProof(ctx, id)
+	if err != nil {
+		fmt.Printf("Warning: witness proof %s not collected: %v\n", id, err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, agency := range w.config.Agencies {
+		if proof.signedBy(agency.AgencyCode) {
+			continue
+		}
+		wg.Add(1)
+		go func(ag AgencyWitnessConfig) {
+			defer wg.Done()
+			w.collectFrom(ctx, id, &ag, request)
+		}(agency)
+	}
+	wg.Wait()
+
+	w.finish(context.Background(), id)
+}
+
+// collectFrom asks one agency to sign, retrying with backoff until the
+// context ends
+func (w *MultiAgencyWitness) collectFrom(ctx context.Context, id types.ID, agency *AgencyWitnessConfig, request *WitnessRequest) {
+	delay := w.config.RetryDelay
+	for {
+		sig, err := w.requestSignature(ctx, agency, request)
+		if err == nil {
+			if err := w.addSignature(context.Background(), id, sig); err != nil {
+				fmt.Printf("Warning: signature of %s on witness proof %s not added: %v\n", agency.AgencyCode, id, err)
+			}
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Printf("Warning: %s did not sign witness proof %s before the deadline: %v\n", agency.AgencyCode, id, err)
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// addSignature adds a late signature to a proof and confirms the proof once
+// it reaches quorum
+func (w *MultiAgencyWitness) addSignature(ctx context.Context, id types.ID, sig *AgencySignature) error {
+	w.proofMu.Lock()
+	defer w.proofMu.Unlock()
+
+	proof, err := w.proofs.GetProof(ctx, id)
+	if err != nil {
+		return err
+	}
+	if proof.Status == ProofStatusFailed {
+		return fmt.Errorf("deadline passed at %s", proof.Deadline.Format(time.RFC3339))
+	}
+	if proof.signedBy(sig.AgencyCode) {
+		return nil
+	}
+
+	proof.Signatures = append(proof.Signatures, *sig)
+	proof.checkQuorum(time.Now().UTC())
+	return w.proofs.SaveProof(ctx, proof)
+}
+
+// finish fails a proof that is still pending once no more signatures will
+// be collected for it
+func (w *MultiAgencyWitness) finish(ctx context.Context, id types.ID) {
+	w.proofMu.Lock()
+	defer w.proofMu.Unlock()
+
+	proof, err := w.proofs.GetProof(ctx, id)
+	if err != nil || proof.Status != ProofStatusPending {
+		return
+	}
+
+	fmt.Printf("Warning: witness proof %s for sequence %d expired with %d of %d signatures\n",
+		id, proof.LastSequence, len(proof.Signatures), proof.MinRequired)
+	proof.Status = ProofStatusFailed
+	if err := w.proofs.SaveProof(ctx, proof); err != nil {
+		fmt.Printf("Warning: failed to save witness proof %s: %v\n", id, err)
+	}
+}
+
+// signedBy reports whether an agency has signed the proof
+func (p *MultiAgencyProof) signedBy(agencyCode string) bool {
+	for _, sig := range p.Signatures {
+		if sig.AgencyCode == agencyCode {
+			return true
+		}
+	}
+	return false
+}
+
+// checkQuorum confirms a pending proof once MinRequired agencies signed it
+func (p *MultiAgencyProof) checkQuorum(now time.Time) {
+	if p.Status != ProofStatusPending {
+		return
+	}
+	agencies := make(map[string]bool)
+	for _, sig := range p.Signatures {
+		agencies[sig.AgencyCode] = true
+	}
+	if len(agencies) >= p.MinRequired {
+		p.Status = ProofStatusConfirmed
+		p.ConfirmedAt = &now
+	}
+}
+
+// memoryProofStore keeps proofs in memory
+type memoryProofStore struct {
+	mu     sync.RWMutex
+	proofs map[types.ID][]byte
+}
+
+func newMemoryProofStore() *memoryProofStore {
+	return &memoryProofStore{proofs: make(map[types.ID][]byte)}
+}
+
+func (s *memoryProofStore) SaveProof(ctx context.Context, proof *MultiAgencyProof) error {
+	data, err := proof.Serialize()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.proofs[proof.ID] = data
+	return nil
+}
+
+func (s *memoryProofStore) GetProof(ctx context.Context, id types.ID) (*MultiAgencyProof, error) {
+	s.mu.RLock()
+	data, ok := s.proofs[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, errors.NotFound("witness proof", id.String())
+	}
+	return DeserializeProof(data)
+}
+
+func (s *memoryProofStore) ListProofs(ctx context.Context, status string, limit int) ([]*MultiAgencyProof, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var proofs []*MultiAgencyProof
+	for _, data := range s.proofs {
+		proof, err := DeserializeProof(data)
+		if err != nil {
+			return nil, err
+		}
+		if proof.Status == status {
+			proofs = append(proofs, proof)
+		}
+	}
+	sort.Slice(proofs, func(i, j int) bool {
+		return proofs[i].CreatedAt.After(proofs[j].CreatedAt)
+	})
+	if limit > 0 && len(proofs) > limit {
+		proofs = proofs[:limit]
+	}
+	return proofs, nil
+}
+
+// PostgresProofStore keeps proofs in PostgreSQL
+type PostgresProofStore struct {
+	pool *pgxpool.Pool
+}
+
+var _ ProofStore = (*PostgresProofStore)(nil)
+
+// NewPostgresProofStore creates a new PostgreSQL proof store
+func NewPostgresProofStore(pool *pgxpool.Pool) *PostgresProofStore {
+	return &PostgresProofStore{pool: pool}
+}
+
+// SaveProof inserts a proof or replaces it with a newer state
+func (s *PostgresProofStore) SaveProof(ctx context.Context, proof *MultiAgencyProof) error {
+	data, err := proof.Serialize()
+	if err != nil {
+		return errors.Wrap(err, "failed to encode witness proof")
+	}
+	_, err = s.pool.Exec(ctx, `
+		INSERT INTO tsa.witness_proofs (id, checkpoint_hash, last_sequence, status, deadline, proof, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE
+		SET status = EXCLUDED.status, proof = EXCLUDED.proof, updated_at = NOW()
+	`, proof.ID, proof.CheckpointHash, proof.LastSequence, proof.Status, proof.Deadline, data, proof.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to save witness proof")
+	}
+	return nil
+}
+
+// GetProof returns a proof by ID
+func (s *PostgresProofStore) GetProof(ctx context.Context, id types.ID) (*MultiAgencyProof, error) {
+	var data []byte
+	err := s.pool.QueryRow(ctx, `SELECT proof FROM tsa.witness_proofs WHERE id = $1`, id).Scan(&data)
+	if err == pgx.ErrNoRows {
+		return nil, errors.NotFound("witness proof", id.String())
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get witness proof")
+	}
+	return DeserializeProof(data)
+}
+
+// ListProofs returns proofs with a status, newest first; limit 0 returns all
+func (s *PostgresProofStore) ListProofs(ctx context.Context, status string, limit int) ([]*MultiAgencyProof, error) {
+	query := `SELECT proof FROM tsa.witness_proofs WHERE status = $1 ORDER BY created_at DESC`
+	args := []any{status}
+	if limit > 0 {
+		query += ` LIMIT $2`
+		args = append(args, limit)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list witness proofs")
+	}
+	defer rows.Close()
+
+	var proofs []*MultiAgencyProof
+	for rows.Next() {
+		var data json.RawMessage
+		if err := rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "failed to scan witness proof")
+		}
+		proof, err := DeserializeProof(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode witness proof")
+		}
+		proofs = append(proofs, proof)
+	}
+	return proofs, rows.Err()
+}
@@ -0,0 +1,71 @@
+package tsa
+
+import (
+	"context"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/digitorus/timestamp"
+)
+
+// timeStampResp is the RFC 3161 TimeStampResp
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status int
+}
+
+// errUnknownHash is the parse error for requests with an unknown hash function
+var errUnknownHash error = timestamp.ParseError("Time-Stamp request uses unknown hash function")
+
+// HandleRequest answers a DER-encoded TimeStampReq with a DER-encoded
+// TimeStampResp. Requests the TSA cannot serve are answered with a rejection
+// naming the failure; an error is returned only when no response can be built.
+func (s *Server) HandleRequest(ctx context.Context, query []byte, requester string) ([]byte, error) {
+	req, err := timestamp.ParseRequest(query)
+	if err != nil {
+		if err == errUnknownHash {
+			return timestamp.CreateErrorResponse(timestamp.Rejection, timestamp.BadAlgorithm)
+		}
+		return timestamp.CreateErrorResponse(timestamp.Rejection, timestamp.BadDataFormat)
+	}
+
+	if _, ok := hashOIDs[req.HashAlgorithm]; !ok {
+		return timestamp.CreateErrorResponse(timestamp.Rejection, timestamp.BadAlgorithm)
+	}
+	if len(req.HashedMessage) != req.HashAlgorithm.Size() {
+		return timestamp.CreateErrorResponse(timestamp.Rejection, timestamp.BadDataFormat)
+	}
+
+	if req.TSAPolicyOID != nil {
+		policy, err := parseOID(s.config.PolicyOID)
+		if err != nil || !req.TSAPolicyOID.Equal(policy) {
+			return timestamp.CreateErrorResponse(timestamp.Rejection, timestamp.UnacceptedPolicy)
+		}
+	}
+	for _, ext := range req.Extensions {
+		if ext.Critical {
+			return timestamp.CreateErrorResponse(timestamp.Rejection, timestamp.UnacceptedExtension)
+		}
+	}
+
+	resp, err := s.issue(ctx, tokenRequest{
+		hashAlgorithm: req.HashAlgorithm,
+		hashedMessage: req.HashedMessage,
+		nonce:         req.Nonce,
+		certReq:       req.Certificates,
+		requester:     requester,
+	})
+	if err != nil {
+		fmt.Printf("Warning: TSA request from %s failed: %v\n", requester, err)
+		return timestamp.CreateErrorResponse(timestamp.Rejection, timestamp.SystemFailure)
+	}
+
+	return asn1.Marshal(timeStampResp{
+		Status:         pkiStatusInfo{Status: int(timestamp.Granted)},
+		TimeStampToken: asn1.RawValue{FullBytes: resp.Token},
+	})
+}
@@ -10,19 +10,28 @@ import (
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/hex"
+	"encoding/pem"
+	stderrors "errors"
 	"fmt"
 	"math/big"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/digitorus/timestamp"
+	"github.com/digitorus/pkcs7"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+	"golang.org/x/crypto/pkcs12"
 )
 
 // Server implements an RFC 3161 compliant Time Stamping Authority.
 type Server struct {
 	config        *Config
 	serialCounter uint64
+	store         TokenStore   // nil: serials are not persisted and tokens are not logged
+	archive       ArchiveStore // nil: tokens are verified without archive timestamps
 	mu            sync.RWMutex
 }
 
@@ -91,8 +100,189 @@ func NewServerWithGeneratedCert(orgName string) (*Server, error) {
 	return NewServer(config)
 }
 
+// NewServerFromFiles creates a TSA server from a PEM certificate chain and
+// private key. The first certificate in the chain is the signing certificate.
+func NewServerFromFiles(certPath, keyPath string) (*Server, error) {
+	chain, key, err := LoadKeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := DefaultConfig()
+	config.Certificate = chain[0]
+	config.CertificateChain = chain
+	config.PrivateKey = key
+
+	return NewServer(config)
+}
+
+// NewServerFromPKCS12 creates a TSA server from a PKCS#12 file holding the
+// private key and certificate chain.
+func NewServerFromPKCS12(path, password string) (*Server, error) {
+	chain, key, err := LoadPKCS12(path, password)
+	if err != nil {
+		return nil, err
+	}
+
+	config := DefaultConfig()
+	config.Certificate = chain[0]
+	config.CertificateChain = chain
+	config.PrivateKey = key
+
+	return NewServer(config)
+}
+
+// SetPolicyOID sets the policy under which timestamps are issued
+func (s *Server) SetPolicyOID(oid string) error {
+	if _, err := parseOID(oid); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config.PolicyOID = oid
+	return nil
+}
+
+// SetStore persists serial numbers and logs every issued token. Without a
+// store serial numbers restart from the clock on each start.
+func (s *Server) SetStore(store TokenStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store = store
+}
+
+// LoadKeyPair loads a PEM certificate chain and a PEM private key
+// (PKCS#8, PKCS#1 or SEC 1).
+func LoadKeyPair(certPath, keyPath string) ([]*x509.Certificate, crypto.Signer, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	var chain []*x509.Certificate
+	for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, nil, fmt.Errorf("no certificate found in %s", certPath)
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, nil, fmt.Errorf("failed to decode private key PEM")
+	}
+
+	var key any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	return chain, signer, nil
+}
+
+// LoadPKCS12 loads a private key and certificate chain from a PKCS#12 file.
+// The certificate matching the key is returned first. Files must use the
+// legacy PKCS#12 encryption (openssl pkcs12 -export -legacy).
+func LoadPKCS12(path, password string) ([]*x509.Certificate, crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read PKCS#12 file: %w", err)
+	}
+
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode PKCS#12 file: %w", err)
+	}
+
+	var certs []*x509.Certificate
+	var signer crypto.Signer
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse certificate: %w", err)
+			}
+			certs = append(certs, cert)
+		case "PRIVATE KEY":
+			// PKCS#1 for RSA keys, SEC 1 for ECDSA keys
+			if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+				signer = key
+			} else if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+				signer = key
+			} else {
+				return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+			}
+		}
+	}
+	if signer == nil {
+		return nil, nil, fmt.Errorf("no private key found in %s", path)
+	}
+
+	// The signing certificate is the one holding the key
+	type publicKey interface{ Equal(crypto.PublicKey) bool }
+	var leaf *x509.Certificate
+	var rest []*x509.Certificate
+	for _, cert := range certs {
+		if pub, ok := cert.PublicKey.(publicKey); ok && leaf == nil && pub.Equal(signer.Public()) {
+			leaf = cert
+		} else {
+			rest = append(rest, cert)
+		}
+	}
+	if leaf == nil {
+		return nil, nil, fmt.Errorf("no certificate for the private key in %s", path)
+	}
+	chain := append([]*x509.Certificate{leaf}, rest...)
+
+	return chain, signer, nil
+}
+
 // Timestamp creates an RFC 3161 timestamp token for the given hash.
 func (s *Server) Timestamp(ctx context.Context, dataHash []byte) (*TimestampResponse, error) {
+	return s.issue(ctx, tokenRequest{
+		hashAlgorithm: s.config.HashAlgorithm,
+		hashedMessage: dataHash,
+		certReq:       true,
+	})
+}
+
+// tokenRequest is a validated request for a timestamp token
+type tokenRequest struct {
+	hashAlgorithm crypto.Hash
+	hashedMessage []byte
+	nonce         *big.Int
+	certReq       bool   // include the TSA certificates in the token
+	requester     string // client address, logged with the token
+}
+
+// issue creates, logs and returns a timestamp token
+func (s *Server) issue(ctx context.Context, req tokenRequest) (*TimestampResponse, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -104,34 +294,59 @@ func (s *Server) Timestamp(ctx context.Context, dataHash []byte) (*TimestampResp
 		return nil, fmt.Errorf("TSA certificate or private key not configured")
 	}
 
-	// Generate serial number
-	serial := atomic.AddUint64(&s.serialCounter, 1)
+	if _, ok := hashOIDs[req.hashAlgorithm]; !ok {
+		return nil, fmt.Errorf("unsupported hash algorithm %v", req.hashAlgorithm)
+	}
+	if len(req.hashedMessage) != req.hashAlgorithm.Size() {
+		return nil, fmt.Errorf("hash length %d does not match %v", len(req.hashedMessage), req.hashAlgorithm)
+	}
+
+	policy, err := parseOID(s.config.PolicyOID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TSA policy OID: %w", err)
+	}
 
-	// Create timestamp request
-	tsReq := timestamp.Request{
-		HashAlgorithm: s.config.HashAlgorithm,
-		HashedMessage: dataHash,
-		// Note: Nonce and CertReq are optional
+	serial, err := s.nextSerial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate serial number: %w", err)
 	}
 
-	// Current time (in production, this should be from a trusted NTP source)
-	now := time.Now().UTC()
+	// Current time (in production, this should be from a trusted NTP source).
+	// GeneralizedTime in the token carries whole seconds.
+	now := time.Now().UTC().Truncate(time.Second)
 
 	// Create the timestamp token
-	tsToken, err := s.createTimestampToken(&tsReq, now, serial)
+	tsToken, err := s.createTimestampToken(req, policy, now, serial)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create timestamp token: %w", err)
 	}
 
-	return &TimestampResponse{
+	resp := &TimestampResponse{
 		SerialNumber:  serial,
 		Timestamp:     now,
-		HashAlgorithm: s.config.HashAlgorithm.String(),
-		HashedMessage: hex.EncodeToString(dataHash),
+		HashAlgorithm: req.hashAlgorithm.String(),
+		HashedMessage: hex.EncodeToString(req.hashedMessage),
 		Token:         tsToken,
 		PolicyOID:     s.config.PolicyOID,
 		Issuer:        s.config.Certificate.Subject.CommonName,
-	}, nil
+	}
+
+	// A token is only handed out once it is in the log
+	if s.store != nil {
+		if err := s.store.SaveToken(ctx, newIssuedToken(resp, req)); err != nil {
+			return nil, fmt.Errorf("failed to log timestamp token: %w", err)
+		}
+	}
+
+	return resp, nil
+}
+
+// nextSerial returns the next token serial number
+func (s *Server) nextSerial(ctx context.Context) (uint64, error) {
+	if s.store != nil {
+		return s.store.NextSerial(ctx)
+	}
+	return atomic.AddUint64(&s.serialCounter, 1), nil
 }
 
 // TimestampHash creates a timestamp for a hex-encoded hash string.
@@ -150,58 +365,224 @@ func (s *Server) TimestampData(ctx context.Context, data []byte) (*TimestampResp
 }
 
 // Verify verifies a timestamp token against the original hash.
+//
+// When the server keeps archive timestamps, a token they protect is only
+// valid if its chain of renewals is, and a token whose TSA certificate has
+// expired without a renewal is no longer valid.
 func (s *Server) Verify(ctx context.Context, token []byte, originalHash []byte) (*VerifyResult, error) {
-	// Parse the timestamp token
-	ts, err := timestamp.Parse(token)
+	s.mu.RLock()
+	roots := s.roots()
+	archive := s.archive
+	s.mu.RUnlock()
+
+	result := VerifyToken(token, originalHash, roots)
+	if !result.Valid || archive == nil {
+		return result, nil
+	}
+
+	record, err := archive.FindByToken(ctx, token)
+	if err != nil && !stderrors.Is(err, errors.ErrNotFound) {
+		return nil, err
+	}
+	if record == nil {
+		if time.Now().After(result.CertificateExpires) {
+			return &VerifyResult{
+				Valid: false,
+				Message: fmt.Sprintf("TSA certificate expired on %s and the token has no archive timestamps",
+					result.CertificateExpires.Format(time.RFC3339)),
+			}, nil
+		}
+		return result, nil
+	}
+
+	evidence := VerifyEvidence(record, roots, time.Now())
+	if !evidence.Valid {
+		return evidence, nil
+	}
+	result.Message = evidence.Message
+	result.Renewals = evidence.Renewals
+	result.ArchivedUntil = evidence.ArchivedUntil
+	return result, nil
+}
+
+// VerifyEvidence verifies an evidence record with the trust anchors of the
+// server
+func (s *Server) VerifyEvidence(record *EvidenceRecord) *VerifyResult {
+	s.mu.RLock()
+	roots := s.roots()
+	s.mu.RUnlock()
+
+	return VerifyEvidence(record, roots, time.Now())
+}
+
+// SetArchiveStore sets the evidence records that Verify checks tokens against
+func (s *Server) SetArchiveStore(store ArchiveStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.archive = store
+}
+
+// roots returns the trust anchors for tokens of this TSA; the caller holds s.mu
+func (s *Server) roots() *x509.CertPool {
+	roots := x509.NewCertPool()
+	for _, cert := range s.config.CertificateChain {
+		roots.AddCert(cert)
+	}
+	if s.config.Certificate != nil {
+		roots.AddCert(s.config.Certificate)
+	}
+	return roots
+}
+
+// VerifyToken verifies a timestamp token against the original hash without
+// access to the TSA: the token signature is checked with the certificate in
+// the token, which must chain to one of the trust anchors in roots. The
+// certificate is validated at the time of the timestamp, so tokens remain
+// verifiable after the TSA certificate expires.
+//
+// Tokens are CMS SignedData as defined by RFC 3161; tokens issued before the
+// TSA produced CMS are verified in their original format.
+func VerifyToken(token []byte, originalHash []byte, roots *x509.CertPool) *VerifyResult {
+	if roots == nil {
+		return &VerifyResult{Valid: false, Message: "no trust anchors for TSA certificates"}
+	}
+
+	p7, err := pkcs7.Parse(token)
 	if err != nil {
+		return verifyLegacyToken(token, originalHash, roots)
+	}
+
+	var info timestampInfo
+	if _, err := asn1.Unmarshal(p7.Content, &info); err != nil {
+		return &VerifyResult{Valid: false, Message: fmt.Sprintf("failed to parse TSTInfo: %v", err)}
+	}
+
+	// Verify the hash matches
+	if !compareHashes(info.MessageImprint.HashedMessage, originalHash) {
 		return &VerifyResult{
 			Valid:   false,
-			Message: fmt.Sprintf("failed to parse timestamp token: %v", err),
-		}, nil
+			Message: "hash mismatch: timestamp was created for different data",
+		}
+	}
+
+	cert := p7.GetOnlySigner()
+	if cert == nil {
+		return &VerifyResult{Valid: false, Message: "timestamp token does not include the TSA certificate"}
+	}
+
+	// Verify the signature and that the certificate chains to a trust anchor
+	intermediates := x509.NewCertPool()
+	for _, c := range p7.Certificates {
+		intermediates.AddCert(c)
+	}
+	if err := p7.VerifyWithOpts(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   info.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}); err != nil {
+		return &VerifyResult{Valid: false, Message: fmt.Sprintf("invalid timestamp token: %v", err)}
+	}
+
+	return &VerifyResult{
+		Valid:              true,
+		Message:            "timestamp verified successfully",
+		Timestamp:          info.GenTime,
+		SerialNumber:       info.SerialNumber.Uint64(),
+		Issuer:             cert.Subject.CommonName,
+		CertificateExpires: cert.NotAfter,
+	}
+}
+
+// verifyLegacyToken verifies a token in the format used before CMS: the
+// DER TSTInfo with a signature over it and the TSA certificate.
+func verifyLegacyToken(token []byte, originalHash []byte, roots *x509.CertPool) *VerifyResult {
+	var resp timestampResponse
+	if _, err := asn1.Unmarshal(token, &resp); err != nil {
+		return &VerifyResult{Valid: false, Message: fmt.Sprintf("failed to parse timestamp token: %v", err)}
+	}
+
+	var info timestampInfo
+	if _, err := asn1.Unmarshal(resp.TSTInfo, &info); err != nil {
+		return &VerifyResult{Valid: false, Message: fmt.Sprintf("failed to parse TSTInfo: %v", err)}
 	}
 
 	// Verify the hash matches
-	if !compareHashes(ts.HashedMessage, originalHash) {
+	if !compareHashes(info.MessageImprint.HashedMessage, originalHash) {
 		return &VerifyResult{
 			Valid:   false,
 			Message: "hash mismatch: timestamp was created for different data",
-		}, nil
+		}
 	}
 
-	// Verify the signature using our certificate chain
-	roots := x509.NewCertPool()
-	for _, cert := range s.config.CertificateChain {
-		roots.AddCert(cert)
+	if len(resp.Certificate) == 0 {
+		return &VerifyResult{Valid: false, Message: "timestamp token does not include the TSA certificate"}
+	}
+	cert, err := x509.ParseCertificate(resp.Certificate)
+	if err != nil {
+		return &VerifyResult{Valid: false, Message: fmt.Sprintf("failed to parse TSA certificate: %v", err)}
+	}
+
+	// Verify the certificate chains to a trust anchor
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:       roots,
+		CurrentTime: info.GenTime,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}); err != nil {
+		return &VerifyResult{Valid: false, Message: fmt.Sprintf("TSA certificate is not trusted: %v", err)}
+	}
+
+	// Verify the signature over the TSTInfo
+	if err := cert.CheckSignature(x509.SHA256WithRSA, resp.TSTInfo, resp.Signature); err != nil {
+		if err := cert.CheckSignature(x509.ECDSAWithSHA256, resp.TSTInfo, resp.Signature); err != nil {
+			return &VerifyResult{Valid: false, Message: fmt.Sprintf("invalid timestamp signature: %v", err)}
+		}
 	}
 
-	// Basic verification passed
 	return &VerifyResult{
-		Valid:        true,
-		Message:      "timestamp verified successfully",
-		Timestamp:    ts.Time,
-		SerialNumber: ts.SerialNumber.Uint64(),
-		Issuer:       s.config.Certificate.Subject.CommonName,
-	}, nil
+		Valid:              true,
+		Message:            "timestamp verified successfully",
+		Timestamp:          info.GenTime,
+		SerialNumber:       info.SerialNumber.Uint64(),
+		Issuer:             cert.Subject.CommonName,
+		CertificateExpires: cert.NotAfter,
+	}
 }
 
-// createTimestampToken creates the actual RFC 3161 timestamp token.
-func (s *Server) createTimestampToken(req *timestamp.Request, now time.Time, serial uint64) ([]byte, error) {
+// createTimestampToken creates the RFC 3161 TimeStampToken: CMS SignedData
+// over the TSTInfo, signed by the TSA certificate.
+func (s *Server) createTimestampToken(req tokenRequest, policy asn1.ObjectIdentifier, now time.Time, serial uint64) ([]byte, error) {
+	cert := s.config.Certificate
+
+	// The TSA is named by the subject of its certificate
+	directoryName, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: cert.RawSubject})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal TSA name: %w", err)
+	}
+	tsaName, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: directoryName})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal TSA name: %w", err)
+	}
+
 	// Create timestamp info structure
 	tsInfo := timestampInfo{
-		Version:        1,
-		Policy:         asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1, 1}, // Our policy OID
+		Version: 1,
+		Policy:  policy,
 		MessageImprint: messageImprint{
 			HashAlgorithm: pkix.AlgorithmIdentifier{
-				Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, // SHA-256
+				Algorithm:  hashOIDs[req.hashAlgorithm],
+				Parameters: asn1.NullRawValue,
 			},
-			HashedMessage: req.HashedMessage,
+			HashedMessage: req.hashedMessage,
 		},
-		SerialNumber: big.NewInt(int64(serial)),
+		SerialNumber: new(big.Int).SetUint64(serial),
 		GenTime:      now,
 		Accuracy: accuracy{
 			Seconds: s.config.AccuracySeconds,
 		},
 		Ordering: false,
+		Nonce:    req.nonce,
+		TSA:      asn1.RawValue{FullBytes: tsaName},
 	}
 
 	// Encode TSTInfo
@@ -210,27 +591,40 @@ func (s *Server) createTimestampToken(req *timestamp.Request, now time.Time, ser
 		return nil, fmt.Errorf("failed to marshal TSTInfo: %w", err)
 	}
 
-	// Sign the TSTInfo
-	hash := sha256.Sum256(tstInfoDER)
-	signature, err := s.config.PrivateKey.Sign(rand.Reader, hash[:], crypto.SHA256)
+	// Bind the signature to the TSA certificate (RFC 5816)
+	certHash := sha256.Sum256(cert.Raw)
+	signingCert, err := asn1.Marshal(signingCertificateV2{Certs: []essCertIDv2{{CertHash: certHash[:]}}})
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign timestamp: %w", err)
+		return nil, fmt.Errorf("failed to marshal signing certificate: %w", err)
 	}
 
-	// Create the response structure
-	response := timestampResponse{
-		TSTInfo:     tstInfoDER,
-		Signature:   signature,
-		Certificate: s.config.Certificate.Raw,
+	signedData, err := pkcs7.NewSignedData(tstInfoDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signed data: %w", err)
+	}
+	signedData.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	signedData.SetContentType(oidTSTInfo)
+	signedData.GetSignedData().Version = 3
+
+	var parents []*x509.Certificate
+	for _, c := range s.config.CertificateChain {
+		if !c.Equal(cert) {
+			parents = append(parents, c)
+		}
 	}
 
-	// Encode the full response
-	responseDER, err := asn1.Marshal(response)
+	// Sign the TSTInfo
+	err = signedData.AddSignerChain(cert, s.config.PrivateKey, parents, pkcs7.SignerInfoConfig{
+		ExtraSignedAttributes: []pkcs7.Attribute{
+			{Type: oidSigningCertificateV2, Value: asn1.RawValue{FullBytes: signingCert}},
+		},
+		SkipCertificates: !req.certReq,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal response: %w", err)
+		return nil, fmt.Errorf("failed to sign timestamp: %w", err)
 	}
 
-	return responseDER, nil
+	return signedData.Finish()
 }
 
 // GetCertificate returns the TSA certificate.
@@ -260,6 +654,22 @@ func compareHashes(a, b []byte) bool {
 	return true
 }
 
+// parseOID parses a dotted object identifier
+func parseOID(s string) (asn1.ObjectIdentifier, error) {
+	var oid asn1.ObjectIdentifier
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid object identifier %q", s)
+		}
+		oid = append(oid, n)
+	}
+	if len(oid) < 2 {
+		return nil, fmt.Errorf("invalid object identifier %q", s)
+	}
+	return oid, nil
+}
+
 // TimestampResponse contains the result of a timestamp operation.
 type TimestampResponse struct {
 	SerialNumber  uint64    `json:"serial_number"`
@@ -273,24 +683,52 @@ type TimestampResponse struct {
 
 // VerifyResult contains the result of timestamp verification.
 type VerifyResult struct {
-	Valid        bool      `json:"valid"`
-	Message      string    `json:"message"`
-	Timestamp    time.Time `json:"timestamp,omitempty"`
-	SerialNumber uint64    `json:"serial_number,omitempty"`
-	Issuer       string    `json:"issuer,omitempty"`
+	Valid              bool      `json:"valid"`
+	Message            string    `json:"message"`
+	Timestamp          time.Time `json:"timestamp,omitempty"`
+	SerialNumber       uint64    `json:"serial_number,omitempty"`
+	Issuer             string    `json:"issuer,omitempty"`
+	CertificateExpires time.Time `json:"certificate_expires,omitempty"` // of the TSA certificate that signed the token
+	Renewals           int       `json:"renewals,omitempty"`            // archive timestamp renewals protecting the token
+	ArchivedUntil      time.Time `json:"archived_until,omitempty"`      // expiry of the latest archive timestamp
 }
 
 // ASN.1 structures for RFC 3161
 
+var (
+	oidTSTInfo              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+)
+
+// hashOIDs are the message imprint hash algorithms the TSA accepts
+var hashOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA256: {2, 16, 840, 1, 101, 3, 4, 2, 1},
+	crypto.SHA384: {2, 16, 840, 1, 101, 3, 4, 2, 2},
+	crypto.SHA512: {2, 16, 840, 1, 101, 3, 4, 2, 3},
+}
+
+// timestampInfo is the TSTInfo. GenTime is parsed from either time type, as
+// tokens issued before CMS carry a UTCTime.
 type timestampInfo struct {
 	Version        int
 	Policy         asn1.ObjectIdentifier
 	MessageImprint messageImprint
 	SerialNumber   *big.Int
-	GenTime        time.Time
-	Accuracy       accuracy `asn1:"optional"`
-	Ordering       bool     `asn1:"optional,default:false"`
-	Nonce          *big.Int `asn1:"optional"`
+	GenTime        time.Time `asn1:"generalized"`
+	Accuracy       accuracy      `asn1:"optional"`
+	Ordering       bool          `asn1:"optional,default:false"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional"` // [0] GeneralName
+}
+
+// signingCertificateV2 is the ESS signing-certificate-v2 attribute
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// essCertIDv2 identifies the signing certificate by its SHA-256 hash
+type essCertIDv2 struct {
+	CertHash []byte
 }
 
 type messageImprint struct {
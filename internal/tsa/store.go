@@ -0,0 +1,199 @@
+package tsa
+
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+)
+
+// TokenStore allocates serial numbers and logs issued tokens
+type TokenStore interface {
+	// NextSerial returns the next serial number; serial numbers never repeat
+	NextSerial(ctx context.Context) (uint64, error)
+
+	// SaveToken logs an issued token
+	SaveToken(ctx context.Context, token *IssuedToken) error
+
+	// GetToken returns an issued token by serial number
+	GetToken(ctx context.Context, serial uint64) (*IssuedToken, error)
+
+	// FindTokens returns the tokens issued for a hex-encoded hash, newest first
+	FindTokens(ctx context.Context, hashedMessage string) ([]*IssuedToken, error)
+}
+
+// IssuedToken is the log record of an issued timestamp token
+type IssuedToken struct {
+	SerialNumber  uint64    `json:"serial_number"`
+	GenTime       time.Time `json:"gen_time"`
+	HashAlgorithm string    `json:"hash_algorithm"`
+	HashedMessage string    `json:"hashed_message"`  // hex
+	Nonce         string    `json:"nonce,omitempty"` // decimal
+	PolicyOID     string    `json:"policy_oid"`
+	Requester     string    `json:"requester,omitempty"` // client address; empty for tokens issued in-process
+	Token         []byte    `json:"token"`
+}
+
+func newIssuedToken(resp *TimestampResponse, req tokenRequest) *IssuedToken {
+	token := &IssuedToken{
+		SerialNumber:  resp.SerialNumber,
+		GenTime:       resp.Timestamp,
+		HashAlgorithm: resp.HashAlgorithm,
+		HashedMessage: resp.HashedMessage,
+		PolicyOID:     resp.PolicyOID,
+		Requester:     req.requester,
+		Token:         resp.Token,
+	}
+	if req.nonce != nil {
+		token.Nonce = req.nonce.String()
+	}
+	return token
+}
+
+// PostgresTokenStore keeps the serial counter and token log in PostgreSQL
+type PostgresTokenStore struct {
+	pool *pgxpool.Pool
+}
+
+var _ TokenStore = (*PostgresTokenStore)(nil)
+
+// NewPostgresTokenStore creates a new PostgreSQL token store
+func NewPostgresTokenStore(pool *pgxpool.Pool) *PostgresTokenStore {
+	return &PostgresTokenStore{pool: pool}
+}
+
+// NextSerial draws the next value of the serial number sequence
+func (s *PostgresTokenStore) NextSerial(ctx context.Context) (uint64, error) {
+	var serial int64
+	if err := s.pool.QueryRow(ctx, "SELECT nextval('tsa.serial_numbers')").Scan(&serial); err != nil {
+		return 0, errors.Wrap(err, "failed to allocate TSA serial number")
+	}
+	return uint64(serial), nil
+}
+
+// SaveToken inserts a token into the log
+func (s *PostgresTokenStore) SaveToken(ctx context.Context, token *IssuedToken) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO tsa.tokens (serial_number, gen_time, hash_algorithm, hashed_message,
+			nonce, policy_oid, requester, token)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		int64(token.SerialNumber), token.GenTime, token.HashAlgorithm, token.HashedMessage,
+		nullString(token.Nonce), token.PolicyOID, nullString(token.Requester), token.Token,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to save timestamp token")
+	}
+	return nil
+}
+
+const tokenColumns = `serial_number, gen_time, hash_algorithm, hashed_message,
+			nonce, policy_oid, requester, token`
+
+// GetToken returns a token by serial number
+func (s *PostgresTokenStore) GetToken(ctx context.Context, serial uint64) (*IssuedToken, error) {
+	row := s.pool.QueryRow(ctx, `
+		SELECT `+tokenColumns+`
+		FROM tsa.tokens
+		WHERE serial_number = $1`, int64(serial))
+
+	token, err := scanToken(row)
+	if err == pgx.ErrNoRows {
+		return nil, errors.NotFound("timestamp token", new(big.Int).SetUint64(serial).String())
+	}
+	return token, err
+}
+
+// FindTokens returns the tokens issued for a hash, newest first
+func (s *PostgresTokenStore) FindTokens(ctx context.Context, hashedMessage string) ([]*IssuedToken, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+tokenColumns+`
+		FROM tsa.tokens
+		WHERE hashed_message = $1
+		ORDER BY serial_number DESC
+		LIMIT 100`, hashedMessage)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find timestamp tokens")
+	}
+	defer rows.Close()
+
+	tokens := []*IssuedToken{}
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// ArchiveObjects lists the tokens issued to clients over the RFC 3161
+// protocol, for archive timestamping. Tokens issued in-process are archived
+// with the objects they protect.
+func (s *PostgresTokenStore) ArchiveObjects(ctx context.Context, after time.Time, limit int) ([]ArchiveObject, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+tokenColumns+`
+		FROM tsa.tokens
+		WHERE requester IS NOT NULL AND gen_time >= $1
+		ORDER BY gen_time, serial_number
+		LIMIT $2`, after, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list timestamp tokens")
+	}
+	defer rows.Close()
+
+	var objects []ArchiveObject
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := hex.DecodeString(token.HashedMessage)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid hash in token log")
+		}
+		objects = append(objects, ArchiveObject{
+			ID:        strconv.FormatUint(token.SerialNumber, 10),
+			Hash:      hash,
+			Token:     token.Token,
+			CreatedAt: token.GenTime,
+		})
+	}
+	return objects, rows.Err()
+}
+
+func scanToken(row pgx.Row) (*IssuedToken, error) {
+	var t IssuedToken
+	var serial int64
+	var nonce, requester *string
+
+	err := row.Scan(&serial, &t.GenTime, &t.HashAlgorithm, &t.HashedMessage,
+		&nonce, &t.PolicyOID, &requester, &t.Token)
+	if err == pgx.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scan timestamp token")
+	}
+
+	t.SerialNumber = uint64(serial)
+	if nonce != nil {
+		t.Nonce = *nonce
+	}
+	if requester != nil {
+		t.Requester = *requester
+	}
+	return &t, nil
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
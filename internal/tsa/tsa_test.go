@@ -0,0 +1,462 @@
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitorus/timestamp"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/serbia-gov/platform/internal/shared/database"
+)
+
+const (
+	testPKCS12         = "testdata/tsa.p12"
+	testPKCS12Password = "test"
+)
+
+// newTestServer creates a TSA from the test PKCS#12 file
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	server, err := NewServerFromPKCS12(testPKCS12, testPKCS12Password)
+	if err != nil {
+		t.Fatalf("Failed to create TSA: %v", err)
+	}
+	return server
+}
+
+// newQuery creates a DER-encoded TimeStampReq for a SHA-256 hash of data
+func newQuery(t *testing.T, data string, nonce *big.Int) ([]byte, []byte) {
+	t.Helper()
+	hash := sha256.Sum256([]byte(data))
+	query, err := (&timestamp.Request{
+		HashAlgorithm: crypto.SHA256,
+		HashedMessage: hash[:],
+		Nonce:         nonce,
+		Certificates:  true,
+	}).Marshal()
+	if err != nil {
+		t.Fatalf("Failed to create query: %v", err)
+	}
+	return query, hash[:]
+}
+
+// replyStatus decodes the status and failure info of a TimeStampResp
+func replyStatus(t *testing.T, reply []byte) (timestamp.Status, timestamp.FailureInfo) {
+	t.Helper()
+	var resp struct {
+		Status struct {
+			Status       timestamp.Status
+			StatusString []string       `asn1:"optional,utf8"`
+			FailInfo     asn1.BitString `asn1:"optional"`
+		}
+		TimeStampToken asn1.RawValue `asn1:"optional"`
+	}
+	if _, err := asn1.Unmarshal(reply, &resp); err != nil {
+		t.Fatalf("Failed to decode reply: %v", err)
+	}
+	for _, fi := range []timestamp.FailureInfo{timestamp.BadAlgorithm, timestamp.BadRequest, timestamp.BadDataFormat,
+		timestamp.UnacceptedPolicy, timestamp.UnacceptedExtension, timestamp.SystemFailure} {
+		if resp.Status.FailInfo.At(int(fi)) != 0 {
+			return resp.Status.Status, fi
+		}
+	}
+	return resp.Status.Status, timestamp.UnknownFailureInfo
+}
+
+// testPool connects to the migrated database in TEST_DATABASE_URL, or skips
+// the test when none is configured
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	if err := database.Migrate(ctx, pool); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return pool
+}
+
+// memTokenStore is an in-memory TokenStore; it outlives the servers using it
+type memTokenStore struct {
+	mu     sync.Mutex
+	serial uint64
+	tokens []*IssuedToken
+	err    error
+}
+
+func (s *memTokenStore) NextSerial(ctx context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return 0, s.err
+	}
+	s.serial++
+	return s.serial, nil
+}
+
+func (s *memTokenStore) SaveToken(ctx context.Context, token *IssuedToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = append(s.tokens, token)
+	return nil
+}
+
+func (s *memTokenStore) GetToken(ctx context.Context, serial uint64) (*IssuedToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range s.tokens {
+		if token.SerialNumber == serial {
+			return token, nil
+		}
+	}
+	return nil, fmt.Errorf("not found")
+}
+
+func (s *memTokenStore) FindTokens(ctx context.Context, hashedMessage string) ([]*IssuedToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tokens []*IssuedToken
+	for i := len(s.tokens) - 1; i >= 0; i-- {
+		if s.tokens[i].HashedMessage == hashedMessage {
+			tokens = append(tokens, s.tokens[i])
+		}
+	}
+	return tokens, nil
+}
+
+// TestHandleRequestGranted tests answering a timestamp query with a signed token
+func TestHandleRequestGranted(t *testing.T) {
+	server := newTestServer(t)
+	nonce := big.NewInt(424242)
+	query, hash := newQuery(t, "document contents", nonce)
+
+	reply, err := server.HandleRequest(context.Background(), query, "192.0.2.1:5000")
+	if err != nil {
+		t.Fatalf("HandleRequest failed: %v", err)
+	}
+
+	ts, err := timestamp.ParseResponse(reply)
+	if err != nil {
+		t.Fatalf("Expected a granted reply: %v", err)
+	}
+	if !bytes.Equal(ts.HashedMessage, hash) {
+		t.Error("Token should carry the requested hash")
+	}
+	if ts.Nonce == nil || ts.Nonce.Cmp(nonce) != 0 {
+		t.Errorf("Token should echo the nonce, got %v", ts.Nonce)
+	}
+	if ts.Policy.String() != DefaultConfig().PolicyOID {
+		t.Errorf("Expected policy %s, got %s", DefaultConfig().PolicyOID, ts.Policy)
+	}
+
+	result := VerifyToken(ts.RawToken, hash, server.roots())
+	if !result.Valid {
+		t.Errorf("Token should verify against the TSA certificate: %s", result.Message)
+	}
+}
+
+// TestHandleRequestRejections tests that queries the TSA cannot serve are rejected with the failure
+func TestHandleRequestRejections(t *testing.T) {
+	server := newTestServer(t)
+	hash := sha256.Sum256([]byte("document contents"))
+	sha1Hash := sha1.Sum([]byte("document contents"))
+
+	marshal := func(req *timestamp.Request) []byte {
+		query, err := req.Marshal()
+		if err != nil {
+			t.Fatalf("Failed to create query: %v", err)
+		}
+		return query
+	}
+
+	tests := []struct {
+		name  string
+		query []byte
+		want  timestamp.FailureInfo
+	}{
+		{
+			name:  "unaccepted policy",
+			query: marshal(&timestamp.Request{HashAlgorithm: crypto.SHA256, HashedMessage: hash[:], TSAPolicyOID: asn1.ObjectIdentifier{1, 2, 3, 4}}),
+			want:  timestamp.UnacceptedPolicy,
+		},
+		{
+			name:  "unsupported hash algorithm",
+			query: marshal(&timestamp.Request{HashAlgorithm: crypto.SHA1, HashedMessage: sha1Hash[:]}),
+			want:  timestamp.BadAlgorithm,
+		},
+		{
+			name:  "hash length does not match algorithm",
+			query: marshal(&timestamp.Request{HashAlgorithm: crypto.SHA256, HashedMessage: sha1Hash[:]}),
+			want:  timestamp.BadDataFormat,
+		},
+		{
+			name: "critical extension",
+			query: marshal(&timestamp.Request{HashAlgorithm: crypto.SHA256, HashedMessage: hash[:],
+				ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Critical: true, Value: []byte{0x05, 0x00}}}}),
+			want: timestamp.UnacceptedExtension,
+		},
+		{
+			name:  "malformed request",
+			query: []byte("not a timestamp query"),
+			want:  timestamp.BadDataFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, err := server.HandleRequest(context.Background(), tt.query, "192.0.2.1:5000")
+			if err != nil {
+				t.Fatalf("HandleRequest failed: %v", err)
+			}
+			status, failure := replyStatus(t, reply)
+			if status != timestamp.Rejection || failure != tt.want {
+				t.Errorf("Expected rejection with %v, got %v with %v", tt.want, status, failure)
+			}
+		})
+	}
+
+	// A failing serial store is a system failure, not a granted token
+	server.SetStore(&memTokenStore{err: fmt.Errorf("database unavailable")})
+	query, _ := newQuery(t, "document contents", nil)
+	reply, err := server.HandleRequest(context.Background(), query, "192.0.2.1:5000")
+	if err != nil {
+		t.Fatalf("HandleRequest failed: %v", err)
+	}
+	if status, failure := replyStatus(t, reply); status != timestamp.Rejection || failure != timestamp.SystemFailure {
+		t.Errorf("Expected rejection with system failure, got %v with %v", status, failure)
+	}
+}
+
+// TestProtocolHandler tests the RFC 3161 HTTP transport
+func TestProtocolHandler(t *testing.T) {
+	server := newTestServer(t)
+	routes := NewProtocolHandler(server).Routes()
+	query, hash := newQuery(t, "document contents", nil)
+
+	post := func(contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post("application/timestamp-query", query)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/timestamp-reply" {
+		t.Errorf("Expected application/timestamp-reply, got %q", ct)
+	}
+	ts, err := timestamp.ParseResponse(rec.Body.Bytes())
+	if err != nil || !bytes.Equal(ts.HashedMessage, hash) {
+		t.Errorf("Expected a token for the query hash (%v)", err)
+	}
+
+	// Media type parameters are allowed
+	if rec := post("application/timestamp-query; charset=binary", query); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 with media type parameters, got %d", rec.Code)
+	}
+
+	for _, contentType := range []string{"", "application/json", "application/timestamp-reply"} {
+		if rec := post(contentType, query); rec.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("Content-Type %q: expected 415, got %d", contentType, rec.Code)
+		}
+	}
+
+	if rec := post("application/timestamp-query", make([]byte, maxQuerySize+1)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for an oversized query, got %d", rec.Code)
+	}
+
+	// Malformed queries are answered with a rejection, not an HTTP error
+	rec = post("application/timestamp-query", []byte("not a timestamp query"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 with a rejection, got %d", rec.Code)
+	}
+	if status, failure := replyStatus(t, rec.Body.Bytes()); status != timestamp.Rejection || failure != timestamp.BadDataFormat {
+		t.Errorf("Expected rejection with bad data format, got %v with %v", status, failure)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/certificate", nil)
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	block, _ := pem.Decode(rec.Body.Bytes())
+	if rec.Code != http.StatusOK || block == nil || !bytes.Equal(block.Bytes, server.GetCertificate().Raw) {
+		t.Errorf("Expected the TSA certificate as PEM, got %d", rec.Code)
+	}
+}
+
+// TestSerialNumbersPersist tests that serial numbers come from the store, so
+// they keep increasing across restarts and every token is logged
+func TestSerialNumbersPersist(t *testing.T) {
+	ctx := context.Background()
+	store := &memTokenStore{}
+
+	issue := func(server *Server, n int) []uint64 {
+		t.Helper()
+		var serials []uint64
+		for i := 0; i < n; i++ {
+			query, _ := newQuery(t, fmt.Sprintf("entry %d", i), nil)
+			reply, err := server.HandleRequest(ctx, query, "192.0.2.1:5000")
+			if err != nil {
+				t.Fatalf("HandleRequest failed: %v", err)
+			}
+			ts, err := timestamp.ParseResponse(reply)
+			if err != nil {
+				t.Fatalf("Expected a granted reply: %v", err)
+			}
+			serials = append(serials, ts.SerialNumber.Uint64())
+		}
+		return serials
+	}
+
+	first := newTestServer(t)
+	first.SetStore(store)
+	serials := issue(first, 3)
+
+	// A restarted server continues from the stored counter
+	restarted := newTestServer(t)
+	restarted.SetStore(store)
+	serials = append(serials, issue(restarted, 3)...)
+
+	for i := 1; i < len(serials); i++ {
+		if serials[i] <= serials[i-1] {
+			t.Fatalf("Serial numbers must increase across restarts: %v", serials)
+		}
+	}
+
+	if len(store.tokens) != len(serials) {
+		t.Fatalf("Expected %d logged tokens, got %d", len(serials), len(store.tokens))
+	}
+	for i, token := range store.tokens {
+		if token.SerialNumber != serials[i] || token.Requester != "192.0.2.1:5000" || len(token.Token) == 0 {
+			t.Errorf("Token %d was not logged as issued", serials[i])
+		}
+	}
+
+	hash := sha256.Sum256([]byte("entry 0"))
+	found, _ := store.FindTokens(ctx, hex.EncodeToString(hash[:]))
+	if len(found) != 2 {
+		t.Errorf("Expected 2 logged tokens for the hash, got %d", len(found))
+	}
+}
+
+// TestLoadPKCS12 tests loading the TSA key and certificate from PKCS#12
+func TestLoadPKCS12(t *testing.T) {
+	chain, key, err := LoadPKCS12(testPKCS12, testPKCS12Password)
+	if err != nil {
+		t.Fatalf("LoadPKCS12 failed: %v", err)
+	}
+	if len(chain) != 1 || chain[0].Subject.CommonName != "Test Agency TSA" {
+		t.Fatalf("Expected the TSA certificate, got %d certificates", len(chain))
+	}
+	type publicKey interface{ Equal(crypto.PublicKey) bool }
+	if pub, ok := chain[0].PublicKey.(publicKey); !ok || !pub.Equal(key.Public()) {
+		t.Error("The first certificate should hold the private key")
+	}
+
+	if _, _, err := LoadPKCS12(testPKCS12, "wrong password"); err == nil {
+		t.Error("Expected error for a wrong password")
+	}
+	if _, _, err := LoadPKCS12("testdata/missing.p12", testPKCS12Password); err == nil {
+		t.Error("Expected error for a missing file")
+	}
+}
+
+// TestPostgresTokenStore tests the serial counter and token log in PostgreSQL
+func TestPostgresTokenStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewPostgresTokenStore(testPool(t))
+
+	first, err := store.NextSerial(ctx)
+	if err != nil {
+		t.Fatalf("NextSerial failed: %v", err)
+	}
+
+	// Concurrent allocations never repeat
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	seen := map[uint64]bool{first: true}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serial, err := store.NextSerial(ctx)
+			if err != nil {
+				t.Errorf("NextSerial failed: %v", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if seen[serial] || serial <= first {
+				t.Errorf("Serial %d repeated or not increasing", serial)
+			}
+			seen[serial] = true
+		}()
+	}
+	wg.Wait()
+
+	// A new connection pool stands in for a restarted server
+	restarted := NewPostgresTokenStore(testPool(t))
+	next, err := restarted.NextSerial(ctx)
+	if err != nil {
+		t.Fatalf("NextSerial failed: %v", err)
+	}
+	for serial := range seen {
+		if next <= serial {
+			t.Fatalf("Serial %d after restart does not follow %d", next, serial)
+		}
+	}
+
+	hash := sha256.Sum256([]byte(fmt.Sprintf("token log %d", next)))
+	token := &IssuedToken{
+		SerialNumber:  next,
+		GenTime:       time.Now().UTC().Truncate(time.Second),
+		HashAlgorithm: crypto.SHA256.String(),
+		HashedMessage: hex.EncodeToString(hash[:]),
+		PolicyOID:     DefaultConfig().PolicyOID,
+		Requester:     "192.0.2.1:5000",
+		Token:         []byte{0x30, 0x00},
+	}
+	if err := restarted.SaveToken(ctx, token); err != nil {
+		t.Fatalf("SaveToken failed: %v", err)
+	}
+	if err := restarted.SaveToken(ctx, token); err == nil {
+		t.Error("Expected error logging a serial number twice")
+	}
+
+	got, err := store.GetToken(ctx, next)
+	if err != nil || got.HashedMessage != token.HashedMessage || got.Requester != token.Requester || got.Nonce != "" {
+		t.Errorf("Expected the logged token, got %+v (%v)", got, err)
+	}
+	found, err := store.FindTokens(ctx, token.HashedMessage)
+	if err != nil || len(found) != 1 || found[0].SerialNumber != next {
+		t.Errorf("Expected the token by hash, got %d (%v)", len(found), err)
+	}
+}
@@ -0,0 +1,391 @@
+package tsa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/serbia-gov/platform/internal/federation/gateway"
+	"github.com/serbia-gov/platform/internal/shared/errors"
+)
+
+// WitnessServicePath is the federation path of the witness.sign service
+const WitnessServicePath = "/api/v1/witness/sign"
+
+// maxWitnessResponseSize bounds the response read from a witness
+const maxWitnessResponseSize = 1 << 20
+
+// ConsistencyProver proves that the Merkle tree of newSize entries of this
+// agency's log extends the tree of oldSize entries. Proofs are hex-encoded.
+type ConsistencyProver interface {
+	ConsistencyProof(ctx context.Context, oldSize, newSize int64) ([]string, error)
+}
+
+// CosignedCheckpoint records a checkpoint this agency cosigned for another.
+// A witness only cosigns checkpoints that extend what it cosigned before, so
+// a requesting agency cannot rewrite history its witnesses have already seen.
+// Checkpoints cosigned before tree roots were witnessed have no RootHash.
+type CosignedCheckpoint struct {
+	RequestingAgency string    `json:"requesting_agency"`
+	LastSequence     int64     `json:"last_sequence"`
+	EntryCount       int       `json:"entry_count"`
+	CheckpointHash   string    `json:"checkpoint_hash"`
+	TreeSize         int64     `json:"tree_size,omitempty"`
+	RootHash         string    `json:"root_hash,omitempty"`
+	SignedAt         time.Time `json:"signed_at"`
+}
+
+// WitnessHistory keeps the checkpoints cosigned per requesting agency
+type WitnessHistory interface {
+	// Latest returns the cosigned checkpoint with the highest sequence, or nil
+	Latest(ctx context.Context, agencyCode string) (*CosignedCheckpoint, error)
+
+	// AtSequence returns the cosigned checkpoint at a sequence, or nil
+	AtSequence(ctx context.Context, agencyCode string, sequence int64) (*CosignedCheckpoint, error)
+
+	// Record stores a cosigned checkpoint; a second checkpoint at the same
+	// sequence is a conflict
+	Record(ctx context.Context, checkpoint *CosignedCheckpoint) error
+}
+
+// SetHistory sets where cosigned checkpoints are kept. Without it they are
+// kept in memory and forgotten on restart.
+func (w *MultiAgencyWitness) SetHistory(history WitnessHistory) {
+	w.cosignMu.Lock()
+	defer w.cosignMu.Unlock()
+	w.history = history
+}
+
+// SetGateway sends witness requests to other agencies through the federation
+// gateway, which signs them as coming from this agency. Without it requests
+// go directly to the configured endpoint URLs.
+func (w *MultiAgencyWitness) SetGateway(gw *gateway.Gateway) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.gateway = gw
+}
+
+// SetConsistencyProver sets what proves to witnesses that our checkpoints
+// extend the trees they cosigned before. Without it witnesses that cosigned
+// a checkpoint of ours refuse every later one.
+func (w *MultiAgencyWitness) SetConsistencyProver(prover ConsistencyProver) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.prover = prover
+}
+
+// withConsistencyProof returns a copy of the request carrying the proof that
+// its tree extends the tree of size from
+func (w *MultiAgencyWitness) withConsistencyProof(ctx context.Context, request *WitnessRequest, from int64) (*WitnessRequest, error) {
+	w.mu.RLock()
+	prover := w.prover
+	w.mu.RUnlock()
+
+	if prover == nil {
+		return nil, fmt.Errorf("witness requires a consistency proof from tree size %d but no prover is configured", from)
+	}
+	if from < 1 || from > request.TreeSize {
+		return nil, fmt.Errorf("witness cosigned tree size %d, which tree size %d cannot extend", from, request.TreeSize)
+	}
+
+	proof, err := prover.ConsistencyProof(ctx, from, request.TreeSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prove consistency from tree size %d: %w", from, err)
+	}
+
+	proved := *request
+	proved.ProofFrom = from
+	proved.ConsistencyProof = proof
+	return &proved, nil
+}
+
+// ReceiveSignRequest handles witness.sign requests delivered by the federation
+// gateway. The requesting agency must be the verified source of the request.
+// It implements gateway.ServiceHandler.
+func (w *MultiAgencyWitness) ReceiveSignRequest(ctx context.Context, req *gateway.SignedRequest) (int, []byte) {
+	var request WitnessRequest
+	if err := json.Unmarshal(req.Body, &request); err != nil {
+		return witnessError(http.StatusBadRequest, "invalid witness request")
+	}
+	if request.RequestingAgency != req.SourceAgency {
+		return witnessError(http.StatusForbidden, "requesting agency does not match request source")
+	}
+
+	sig, err := w.cosign(ctx, &request)
+	if err != nil {
+		if required, ok := err.(*consistencyRequired); ok {
+			body, _ := json.Marshal(witnessErrorResponse{Error: required.Error(), TreeSize: required.treeSize})
+			return http.StatusPreconditionRequired, body
+		}
+		if appErr, ok := err.(*errors.AppError); ok {
+			if appErr.HTTPStatus == http.StatusConflict {
+				fmt.Printf("ALERT: refused to witness checkpoint for %s: %s\n", request.RequestingAgency, appErr.Message)
+			}
+			return witnessError(appErr.HTTPStatus, appErr.Message)
+		}
+		fmt.Printf("Warning: witness request from %s failed: %v\n", request.RequestingAgency, err)
+		return witnessError(http.StatusInternalServerError, "failed to witness checkpoint")
+	}
+
+	body, err := json.Marshal(sig)
+	if err != nil {
+		return witnessError(http.StatusInternalServerError, "failed to encode signature")
+	}
+	return http.StatusOK, body
+}
+
+// witnessErrorResponse is the body of a refused witness request. TreeSize
+// is set with status 428, when a consistency proof from that tree is needed.
+type witnessErrorResponse struct {
+	Error    string `json:"error"`
+	TreeSize int64  `json:"tree_size,omitempty"`
+}
+
+func witnessError(status int, message string) (int, []byte) {
+	body, _ := json.Marshal(witnessErrorResponse{Error: message})
+	return status, body
+}
+
+// consistencyRequired is returned when a request lacks the consistency proof
+// from the tree last cosigned for the requesting agency
+type consistencyRequired struct {
+	treeSize int64
+}
+
+func (e *consistencyRequired) Error() string {
+	return fmt.Sprintf("consistency proof from tree size %d is required", e.treeSize)
+}
+
+// cosign signs a checkpoint of another agency if it is consistent with the
+// checkpoints already cosigned for that agency, and records it
+func (w *MultiAgencyWitness) cosign(ctx context.Context, request *WitnessRequest) (*AgencySignature, error) {
+	if request.CheckpointHash == "" {
+		return nil, errors.BadRequest("checkpoint_hash is required")
+	}
+	if request.RequestingAgency == "" {
+		return nil, errors.BadRequest("requesting_agency is required")
+	}
+	if request.LastSequence < 1 || request.EntryCount < 0 || int64(request.EntryCount) > request.LastSequence {
+		return nil, errors.BadRequest("invalid last_sequence or entry_count")
+	}
+	if request.RootHash != "" {
+		if request.TreeSize < 1 {
+			return nil, errors.BadRequest("tree_size is required with root_hash")
+		}
+		if _, err := decodeHash(request.RootHash); err != nil {
+			return nil, errors.BadRequest("invalid root_hash")
+		}
+	}
+
+	w.cosignMu.Lock()
+	defer w.cosignMu.Unlock()
+
+	seen, err := w.checkHistory(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := w.signLocally(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// A checkpoint cosigned before is signed again, but recorded once
+	if !seen {
+		if err := w.history.Record(ctx, &CosignedCheckpoint{
+			RequestingAgency: request.RequestingAgency,
+			LastSequence:     request.LastSequence,
+			EntryCount:       request.EntryCount,
+			CheckpointHash:   request.CheckpointHash,
+			TreeSize:         request.TreeSize,
+			RootHash:         request.RootHash,
+			SignedAt:         sig.SignedAt,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return sig, nil
+}
+
+// checkHistory refuses a checkpoint that forks from or regresses behind the
+// checkpoints cosigned before, or whose tree is not proven to extend the
+// tree cosigned last. It reports whether the same checkpoint was cosigned
+// already.
+func (w *MultiAgencyWitness) checkHistory(ctx context.Context, request *WitnessRequest) (bool, error) {
+	agency := request.RequestingAgency
+
+	same, err := w.history.AtSequence(ctx, agency, request.LastSequence)
+	if err != nil {
+		return false, err
+	}
+	if same != nil {
+		if same.CheckpointHash != request.CheckpointHash || same.EntryCount != request.EntryCount ||
+			same.TreeSize != request.TreeSize || same.RootHash != request.RootHash {
+			return false, errors.Conflict(fmt.Sprintf(
+				"checkpoint at sequence %d forks from the checkpoint cosigned at %s",
+				request.LastSequence, same.SignedAt.Format(time.RFC3339)))
+		}
+		return true, nil
+	}
+
+	latest, err := w.history.Latest(ctx, agency)
+	if err != nil {
+		return false, err
+	}
+	if latest == nil {
+		return false, nil
+	}
+
+	switch {
+	case request.LastSequence < latest.LastSequence:
+		return false, errors.Conflict(fmt.Sprintf(
+			"sequence %d regresses behind cosigned sequence %d", request.LastSequence, latest.LastSequence))
+	case request.EntryCount < latest.EntryCount:
+		return false, errors.Conflict(fmt.Sprintf(
+			"entry count %d regresses behind %d cosigned at sequence %d",
+			request.EntryCount, latest.EntryCount, latest.LastSequence))
+	case int64(request.EntryCount-latest.EntryCount) > request.LastSequence-latest.LastSequence:
+		return false, errors.Conflict(fmt.Sprintf(
+			"entry count grew by %d but sequence only by %d since cosigned sequence %d",
+			request.EntryCount-latest.EntryCount, request.LastSequence-latest.LastSequence, latest.LastSequence))
+	}
+
+	// A higher sequence alone does not show that history was only appended
+	// to; the tree must provably extend the one cosigned last
+	if latest.RootHash == "" {
+		return false, nil
+	}
+	switch {
+	case request.RootHash == "":
+		return false, errors.Conflict(fmt.Sprintf(
+			"checkpoint has no tree root but a root was cosigned at sequence %d", latest.LastSequence))
+	case request.TreeSize < latest.TreeSize:
+		return false, errors.Conflict(fmt.Sprintf(
+			"tree size %d regresses behind tree size %d cosigned at sequence %d",
+			request.TreeSize, latest.TreeSize, latest.LastSequence))
+	case request.ProofFrom != latest.TreeSize:
+		return false, &consistencyRequired{treeSize: latest.TreeSize}
+	}
+	if err := verifyConsistency(latest.TreeSize, request.TreeSize, latest.RootHash, request.RootHash, request.ConsistencyProof); err != nil {
+		return false, errors.Conflict(fmt.Sprintf(
+			"tree of size %d does not extend the tree cosigned at sequence %d: %v",
+			request.TreeSize, latest.LastSequence, err))
+	}
+
+	return false, nil
+}
+
+// memoryWitnessHistory keeps cosigned checkpoints in memory
+type memoryWitnessHistory struct {
+	mu          sync.RWMutex
+	checkpoints map[string]map[int64]*CosignedCheckpoint
+}
+
+func newMemoryWitnessHistory() *memoryWitnessHistory {
+	return &memoryWitnessHistory{checkpoints: make(map[string]map[int64]*CosignedCheckpoint)}
+}
+
+func (h *memoryWitnessHistory) Latest(ctx context.Context, agencyCode string) (*CosignedCheckpoint, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var latest *CosignedCheckpoint
+	for _, cp := range h.checkpoints[agencyCode] {
+		if latest == nil || cp.LastSequence > latest.LastSequence {
+			latest = cp
+		}
+	}
+	return latest, nil
+}
+
+func (h *memoryWitnessHistory) AtSequence(ctx context.Context, agencyCode string, sequence int64) (*CosignedCheckpoint, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.checkpoints[agencyCode][sequence], nil
+}
+
+func (h *memoryWitnessHistory) Record(ctx context.Context, checkpoint *CosignedCheckpoint) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	byAgency := h.checkpoints[checkpoint.RequestingAgency]
+	if byAgency == nil {
+		byAgency = make(map[int64]*CosignedCheckpoint)
+		h.checkpoints[checkpoint.RequestingAgency] = byAgency
+	}
+	if _, ok := byAgency[checkpoint.LastSequence]; ok {
+		return errors.Conflict(fmt.Sprintf("checkpoint at sequence %d already cosigned", checkpoint.LastSequence))
+	}
+	cp := *checkpoint
+	byAgency[checkpoint.LastSequence] = &cp
+	return nil
+}
+
+// PostgresWitnessHistory keeps cosigned checkpoints in PostgreSQL
+type PostgresWitnessHistory struct {
+	pool *pgxpool.Pool
+}
+
+var _ WitnessHistory = (*PostgresWitnessHistory)(nil)
+
+// NewPostgresWitnessHistory creates a new PostgreSQL witness history
+func NewPostgresWitnessHistory(pool *pgxpool.Pool) *PostgresWitnessHistory {
+	return &PostgresWitnessHistory{pool: pool}
+}
+
+// Latest returns the cosigned checkpoint with the highest sequence, or nil
+func (h *PostgresWitnessHistory) Latest(ctx context.Context, agencyCode string) (*CosignedCheckpoint, error) {
+	return h.queryOne(ctx, `
+		SELECT requesting_agency, last_sequence, entry_count, checkpoint_hash, tree_size, root_hash, signed_at
+		FROM tsa.cosigned_checkpoints
+		WHERE requesting_agency = $1
+		ORDER BY last_sequence DESC
+		LIMIT 1
+	`, agencyCode)
+}
+
+// AtSequence returns the cosigned checkpoint at a sequence, or nil
+func (h *PostgresWitnessHistory) AtSequence(ctx context.Context, agencyCode string, sequence int64) (*CosignedCheckpoint, error) {
+	return h.queryOne(ctx, `
+		SELECT requesting_agency, last_sequence, entry_count, checkpoint_hash, tree_size, root_hash, signed_at
+		FROM tsa.cosigned_checkpoints
+		WHERE requesting_agency = $1 AND last_sequence = $2
+	`, agencyCode, sequence)
+}
+
+// Record inserts a cosigned checkpoint
+func (h *PostgresWitnessHistory) Record(ctx context.Context, checkpoint *CosignedCheckpoint) error {
+	tag, err := h.pool.Exec(ctx, `
+		INSERT INTO tsa.cosigned_checkpoints (requesting_agency, last_sequence, entry_count, checkpoint_hash, tree_size, root_hash, signed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (requesting_agency, last_sequence) DO NOTHING
+	`, checkpoint.RequestingAgency, checkpoint.LastSequence, checkpoint.EntryCount,
+		checkpoint.CheckpointHash, checkpoint.TreeSize, checkpoint.RootHash, checkpoint.SignedAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to record cosigned checkpoint")
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.Conflict(fmt.Sprintf("checkpoint at sequence %d already cosigned", checkpoint.LastSequence))
+	}
+	return nil
+}
+
+func (h *PostgresWitnessHistory) queryOne(ctx context.Context, query string, args ...any) (*CosignedCheckpoint, error) {
+	var cp CosignedCheckpoint
+	err := h.pool.QueryRow(ctx, query, args...).Scan(
+		&cp.RequestingAgency, &cp.LastSequence, &cp.EntryCount, &cp.CheckpointHash, &cp.TreeSize, &cp.RootHash, &cp.SignedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read cosigned checkpoints")
+	}
+	return &cp, nil
+}